@@ -0,0 +1,29 @@
+// Command fake-mcp-server serves the fake MCP server from pkg/mcp/mcptest over
+// stdio, or over HTTP when -http is given. It is used to test MCP clients.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/tcmartin/flowrunner/pkg/mcp/mcptest"
+)
+
+func main() {
+	addr := flag.String("http", "", "serve streamable HTTP and SSE on this address instead of stdio")
+	flag.Parse()
+
+	server := mcptest.NewServer()
+
+	if *addr != "" {
+		log.Printf("Starting fake MCP server on %s", *addr)
+		log.Fatal(http.ListenAndServe(*addr, server))
+	}
+
+	if err := server.ServeStdio(context.Background(), os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
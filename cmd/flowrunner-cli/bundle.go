@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Bundle flags
+	exportOutput         string
+	exportFormat         string
+	importDryRun         bool
+	importRequireSecrets bool
+)
+
+// flowExportCmd represents the flow export command
+var flowExportCmd = &cobra.Command{
+	Use:   "export [id...]",
+	Short: "Export flows with all versions into a bundle (all flows if no IDs are given)",
+	Run:   exportFlows,
+}
+
+// flowImportCmd represents the flow import command
+var flowImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import flows from a bundle",
+	Args:  cobra.ExactArgs(1),
+	Run:   importFlows,
+}
+
+func init() {
+	flowExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file (defaults to flows.<format>)")
+	flowExportCmd.Flags().StringVar(&exportFormat, "format", "tar.gz", "Bundle format (tar.gz or zip)")
+	flowImportCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Validate the bundle without creating flows")
+	flowImportCmd.Flags().BoolVar(&importRequireSecrets, "require-secrets", false, "Fail if referenced secrets are missing")
+}
+
+// exportFlows exports flows into a bundle file
+func exportFlows(cmd *cobra.Command, args []string) {
+	if serverURL == "" {
+		fmt.Println("Error: Server URL is required")
+		os.Exit(1)
+	}
+
+	// Create request body
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"flow_ids": args,
+		"format":   exportFormat,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Create request
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/api/v1/flows/export", serverURL),
+		bytes.NewBuffer(reqBody),
+	)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Add authentication
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	} else if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	} else {
+		fmt.Println("Error: Authentication required")
+		os.Exit(1)
+	}
+
+	// Send request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Error: %s\n", body)
+		os.Exit(1)
+	}
+
+	output := exportOutput
+	if output == "" {
+		output = "flows." + exportFormat
+	}
+	if err := os.WriteFile(output, body, 0644); err != nil {
+		fmt.Printf("Error: Failed to write bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Bundle written to %s\n", output)
+}
+
+// importFlows imports flows from a bundle file
+func importFlows(cmd *cobra.Command, args []string) {
+	if serverURL == "" {
+		fmt.Println("Error: Server URL is required")
+		os.Exit(1)
+	}
+
+	bundle, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Error: Failed to read bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	query := url.Values{}
+	if importDryRun {
+		query.Set("dry_run", "true")
+	}
+	if importRequireSecrets {
+		query.Set("require_secrets", "true")
+	}
+
+	// Create request
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/api/v1/flows/import?%s", serverURL, query.Encode()),
+		bytes.NewBuffer(bundle),
+	)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	// Add authentication
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	} else if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	} else {
+		fmt.Println("Error: Authentication required")
+		os.Exit(1)
+	}
+
+	// Send request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Parse response
+	var result struct {
+		Error  string `json:"error"`
+		Report *struct {
+			Flows []struct {
+				SourceID string `json:"source_id"`
+				ID       string `json:"id"`
+				Name     string `json:"name"`
+				Versions int    `json:"versions"`
+			} `json:"flows"`
+			MissingSecrets []string `json:"missing_secrets"`
+			MissingPlugins []string `json:"missing_plugins"`
+		} `json:"report"`
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		// Successful imports return the report itself
+		if err := json.Unmarshal(body, &result.Report); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Printf("Error: %s\n", body)
+		os.Exit(1)
+	}
+
+	if report := result.Report; report != nil {
+		for _, flow := range report.Flows {
+			if flow.ID != "" {
+				fmt.Printf("%s -> %s (%s, %d versions)\n", flow.SourceID, flow.ID, flow.Name, flow.Versions)
+			} else {
+				fmt.Printf("%s (%s, %d versions)\n", flow.SourceID, flow.Name, flow.Versions)
+			}
+		}
+		if len(report.MissingPlugins) > 0 {
+			fmt.Printf("Missing plugins: %s\n", strings.Join(report.MissingPlugins, ", "))
+		}
+		if len(report.MissingSecrets) > 0 {
+			fmt.Printf("Missing secrets: %s\n", strings.Join(report.MissingSecrets, ", "))
+		}
+	}
+
+	if result.Error != "" {
+		fmt.Printf("Error: %s\n", result.Error)
+		os.Exit(1)
+	}
+	if importDryRun {
+		fmt.Println("Dry run: no flows were created")
+	}
+}
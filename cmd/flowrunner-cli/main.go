@@ -115,7 +115,7 @@ func main() {
 		Run:   deleteFlow,
 	}
 
-	flowCmd.AddCommand(flowListCmd, flowCreateCmd, flowGetCmd, flowUpdateCmd, flowDeleteCmd)
+	flowCmd.AddCommand(flowListCmd, flowCreateCmd, flowGetCmd, flowUpdateCmd, flowDeleteCmd, flowExportCmd, flowImportCmd)
 
 	// Secret commands
 	secretCmd := &cobra.Command{
@@ -153,7 +153,7 @@ func main() {
 	secretCmd.AddCommand(secretListCmd, secretGetCmd, secretSetCmd, secretDeleteCmd)
 
 	// Add commands to root
-	rootCmd.AddCommand(accountCmd, flowCmd, secretCmd)
+	rootCmd.AddCommand(accountCmd, flowCmd, secretCmd, promptCmd)
 
 	// Execute
 	if err := rootCmd.Execute(); err != nil {
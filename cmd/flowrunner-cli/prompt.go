@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// Prompt flags
+	promptFile         string
+	promptTemplate     string
+	promptTemplateFile string
+	promptRole         string
+	promptDescription  string
+	promptTags         []string
+)
+
+// promptCmd represents the prompt command
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Prompt template library management",
+}
+
+// promptListCmd represents the prompt list command
+var promptListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List prompts with their latest version",
+	Run:   listPrompts,
+}
+
+// promptVersionsCmd represents the prompt versions command
+var promptVersionsCmd = &cobra.Command{
+	Use:   "versions [name]",
+	Short: "List the versions of a prompt",
+	Args:  cobra.ExactArgs(1),
+	Run:   listPromptVersions,
+}
+
+// promptGetCmd represents the prompt get command
+var promptGetCmd = &cobra.Command{
+	Use:   "get [name[@version|@tag]]",
+	Short: "Get a prompt version (the latest if none is given)",
+	Args:  cobra.ExactArgs(1),
+	Run:   getPrompt,
+}
+
+// promptCreateCmd represents the prompt create command
+var promptCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a new version of a prompt",
+	Args:  cobra.ExactArgs(1),
+	Run:   createPrompt,
+}
+
+// promptTagCmd represents the prompt tag command
+var promptTagCmd = &cobra.Command{
+	Use:   "tag [name] [version] [tag]",
+	Short: "Tag a prompt version, moving the tag from the version it was on",
+	Args:  cobra.ExactArgs(3),
+	Run:   tagPrompt,
+}
+
+// promptDeleteCmd represents the prompt delete command
+var promptDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete a prompt with all its versions",
+	Args:  cobra.ExactArgs(1),
+	Run:   deletePrompt,
+}
+
+func init() {
+	promptCreateCmd.Flags().StringVarP(&promptFile, "file", "f", "", "YAML or JSON file with the messages, description and tags of the prompt")
+	promptCreateCmd.Flags().StringVar(&promptTemplate, "template", "", "Template of a single message prompt")
+	promptCreateCmd.Flags().StringVar(&promptTemplateFile, "template-file", "", "File holding the template of a single message prompt")
+	promptCreateCmd.Flags().StringVar(&promptRole, "role", "user", "Role of the single message prompt")
+	promptCreateCmd.Flags().StringVar(&promptDescription, "description", "", "Description of the version")
+	promptCreateCmd.Flags().StringArrayVar(&promptTags, "tag", nil, "Tag of the version (repeatable)")
+
+	promptCmd.AddCommand(promptListCmd, promptVersionsCmd, promptGetCmd, promptCreateCmd, promptTagCmd, promptDeleteCmd)
+}
+
+// promptRequest sends a request to the prompt API and returns the response
+// body, exiting unless the response has the expected status
+func promptRequest(method, path string, body []byte, expectedStatus int) []byte {
+	if serverURL == "" {
+		fmt.Println("Error: Server URL is required")
+		os.Exit(1)
+	}
+
+	// Create request
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/api/v1/prompts%s", serverURL, path), bytes.NewBuffer(body))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Add authentication
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	} else if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	} else {
+		fmt.Println("Error: Authentication required")
+		os.Exit(1)
+	}
+
+	// Send request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Check response status
+	if resp.StatusCode != expectedStatus {
+		fmt.Printf("Error: %s\n", respBody)
+		os.Exit(1)
+	}
+
+	return respBody
+}
+
+// printPromptVersions prints prompt versions as a table
+func printPromptVersions(body []byte) {
+	var prompts []map[string]interface{}
+	if err := json.Unmarshal(body, &prompts); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(prompts) == 0 {
+		fmt.Println("No prompts found")
+		return
+	}
+
+	fmt.Println("Name\t\tVersion\t\tTags\t\tCreated")
+	fmt.Println("----\t\t-------\t\t----\t\t-------")
+	for _, prompt := range prompts {
+		var tags []string
+		if list, ok := prompt["tags"].([]interface{}); ok {
+			for _, tag := range list {
+				tags = append(tags, fmt.Sprint(tag))
+			}
+		}
+		fmt.Printf("%s\t\t%v\t\t%s\t\t%s\n",
+			prompt["name"],
+			prompt["version"],
+			strings.Join(tags, ","),
+			prompt["created_at"],
+		)
+	}
+}
+
+// listPrompts lists the prompts of the account
+func listPrompts(cmd *cobra.Command, args []string) {
+	printPromptVersions(promptRequest(http.MethodGet, "", nil, http.StatusOK))
+}
+
+// listPromptVersions lists the versions of a prompt
+func listPromptVersions(cmd *cobra.Command, args []string) {
+	printPromptVersions(promptRequest(http.MethodGet, "/"+url.PathEscape(args[0]), nil, http.StatusOK))
+}
+
+// getPrompt prints a prompt version
+func getPrompt(cmd *cobra.Command, args []string) {
+	name, version := args[0], "latest"
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name, version = name[:i], name[i+1:]
+	}
+
+	body := promptRequest(http.MethodGet, "/"+url.PathEscape(name)+"/"+url.PathEscape(version), nil, http.StatusOK)
+
+	var prompt struct {
+		Name        string   `json:"name"`
+		Version     int      `json:"version"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+		Variables   []string `json:"variables"`
+		Messages    []struct {
+			Role     string `json:"role"`
+			Template string `json:"template"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &prompt); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Name: %s\n", prompt.Name)
+	fmt.Printf("Version: %d\n", prompt.Version)
+	if prompt.Description != "" {
+		fmt.Printf("Description: %s\n", prompt.Description)
+	}
+	if len(prompt.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(prompt.Tags, ", "))
+	}
+	if len(prompt.Variables) > 0 {
+		fmt.Printf("Variables: %s\n", strings.Join(prompt.Variables, ", "))
+	}
+	for _, message := range prompt.Messages {
+		fmt.Printf("\n[%s]\n%s\n", message.Role, message.Template)
+	}
+}
+
+// createPrompt creates a new version of a prompt
+func createPrompt(cmd *cobra.Command, args []string) {
+	prompt := map[string]interface{}{}
+
+	// The file holds the messages, description and tags
+	if promptFile != "" {
+		data, err := os.ReadFile(promptFile)
+		if err != nil {
+			fmt.Printf("Error: Failed to read file: %v\n", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(data, &prompt); err != nil {
+			fmt.Printf("Error: Failed to parse file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	template := promptTemplate
+	if promptTemplateFile != "" {
+		data, err := os.ReadFile(promptTemplateFile)
+		if err != nil {
+			fmt.Printf("Error: Failed to read template file: %v\n", err)
+			os.Exit(1)
+		}
+		template = string(data)
+	}
+	if template != "" {
+		prompt["template"] = template
+		prompt["role"] = promptRole
+	}
+
+	prompt["name"] = args[0]
+	if promptDescription != "" {
+		prompt["description"] = promptDescription
+	}
+	if len(promptTags) > 0 {
+		prompt["tags"] = promptTags
+	}
+
+	reqBody, err := json.Marshal(prompt)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	body := promptRequest(http.MethodPost, "", reqBody, http.StatusCreated)
+
+	var created map[string]interface{}
+	if err := json.Unmarshal(body, &created); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Prompt %s version %v created\n", created["name"], created["version"])
+}
+
+// tagPrompt tags a prompt version
+func tagPrompt(cmd *cobra.Command, args []string) {
+	reqBody, err := json.Marshal(map[string]string{"tag": args[2]})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	promptRequest(http.MethodPost, "/"+url.PathEscape(args[0])+"/"+url.PathEscape(args[1])+"/tags", reqBody, http.StatusOK)
+	fmt.Printf("Prompt %s version %s tagged %s\n", args[0], args[1], args[2])
+}
+
+// deletePrompt deletes a prompt with all its versions
+func deletePrompt(cmd *cobra.Command, args []string) {
+	promptRequest(http.MethodDelete, "/"+url.PathEscape(args[0]), nil, http.StatusNoContent)
+	fmt.Printf("Prompt %s deleted\n", args[0])
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -20,8 +22,10 @@ import (
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/config"
 	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
 	"github.com/tcmartin/flowrunner/pkg/plugins"
 	"github.com/tcmartin/flowrunner/pkg/registry"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
 	"github.com/tcmartin/flowrunner/pkg/services"
 	"github.com/tcmartin/flowrunner/pkg/storage"
 )
@@ -30,6 +34,7 @@ var (
 	// Command-line flags
 	configPath = flag.String("config", "", "Path to config file")
 	version    = flag.Bool("version", false, "Print version information")
+	mcpStdio   = flag.Bool("mcp-stdio", false, "Serve the Model Context Protocol on stdin/stdout as the account of FLOWRUNNER_MCP_TOKEN")
 )
 
 // Version information
@@ -63,6 +68,14 @@ func main() {
 		log.Fatalf("Failed to initialize application: %v", err)
 	}
 
+	// Serve MCP over stdio instead of HTTP; stdout carries protocol messages only
+	if *mcpStdio {
+		if err := app.ServeMCPStdio(os.Getenv("FLOWRUNNER_MCP_TOKEN")); err != nil {
+			log.Fatalf("MCP server failed: %v", err)
+		}
+		return
+	}
+
 	// Handle graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -126,7 +139,7 @@ func loadConfig() (*config.Config, error) {
 				return nil, fmt.Errorf("failed to save default config: %w", err)
 			}
 
-			fmt.Printf("Created default configuration at %s\n", defaultPath)
+			log.Printf("Created default configuration at %s", defaultPath)
 		}
 	}
 
@@ -203,6 +216,46 @@ func overrideConfigFromEnv(cfg *config.Config) {
 		cfg.Storage.Postgres.SSLMode = sslMode
 	}
 
+	// Git mirror configuration
+	if gitPath := os.Getenv("FLOWRUNNER_GIT_PATH"); gitPath != "" {
+		cfg.Storage.Git.Enabled = true
+		cfg.Storage.Git.Path = gitPath
+	}
+	if gitRemote := os.Getenv("FLOWRUNNER_GIT_REMOTE"); gitRemote != "" {
+		cfg.Storage.Git.Remote = gitRemote
+	}
+	if gitBranch := os.Getenv("FLOWRUNNER_GIT_BRANCH"); gitBranch != "" {
+		cfg.Storage.Git.Branch = gitBranch
+	}
+	if syncInterval := os.Getenv("FLOWRUNNER_GIT_SYNC_INTERVAL"); syncInterval != "" {
+		if interval, err := strconv.Atoi(syncInterval); err == nil {
+			cfg.Storage.Git.SyncInterval = interval
+		}
+	}
+
+	// Artifact storage configuration
+	if artifactsPath := os.Getenv("FLOWRUNNER_ARTIFACTS_PATH"); artifactsPath != "" {
+		cfg.Storage.Artifacts.Type = "filesystem"
+		cfg.Storage.Artifacts.Path = artifactsPath
+	}
+	if bucket := os.Getenv("FLOWRUNNER_ARTIFACTS_S3_BUCKET"); bucket != "" {
+		cfg.Storage.Artifacts.Type = "s3"
+		cfg.Storage.Artifacts.S3.Bucket = bucket
+	}
+	if region := os.Getenv("FLOWRUNNER_ARTIFACTS_S3_REGION"); region != "" {
+		cfg.Storage.Artifacts.S3.Region = region
+	}
+	if endpoint := os.Getenv("FLOWRUNNER_ARTIFACTS_S3_ENDPOINT"); endpoint != "" {
+		cfg.Storage.Artifacts.S3.Endpoint = endpoint
+		cfg.Storage.Artifacts.S3.PathStyle = true
+	}
+	if prefix := os.Getenv("FLOWRUNNER_ARTIFACTS_S3_PREFIX"); prefix != "" {
+		cfg.Storage.Artifacts.S3.Prefix = prefix
+	}
+	if downloadPath := os.Getenv("FLOWRUNNER_DOWNLOAD_PATH"); downloadPath != "" {
+		cfg.Storage.DownloadPath = downloadPath
+	}
+
 	// Auth configuration
 	if jwtSecret := os.Getenv("FLOWRUNNER_JWT_SECRET"); jwtSecret != "" {
 		cfg.Auth.JWTSecret = jwtSecret
@@ -215,6 +268,30 @@ func overrideConfigFromEnv(cfg *config.Config) {
 	if encryptionKey := os.Getenv("FLOWRUNNER_ENCRYPTION_KEY"); encryptionKey != "" {
 		cfg.Auth.EncryptionKey = encryptionKey
 	}
+	if admins := os.Getenv("FLOWRUNNER_ADMINS"); admins != "" {
+		cfg.Auth.Admins = strings.Split(admins, ",")
+	}
+	if refreshInterval := os.Getenv("FLOWRUNNER_OAUTH_REFRESH_INTERVAL"); refreshInterval != "" {
+		if interval, err := strconv.Atoi(refreshInterval); err == nil {
+			cfg.Auth.OAuthRefreshInterval = interval
+		}
+	}
+
+	// LLM configuration
+	if pricing := os.Getenv("FLOWRUNNER_LLM_PRICING"); pricing != "" {
+		var prices map[string]config.LLMPrice
+		if err := json.Unmarshal([]byte(pricing), &prices); err == nil {
+			cfg.LLM.Pricing = prices
+		} else {
+			log.Printf("Ignoring invalid FLOWRUNNER_LLM_PRICING: %v", err)
+		}
+	}
+	if mode := os.Getenv("FLOWRUNNER_LLM_CACHE_MODE"); mode != "" {
+		cfg.LLM.Cache.Mode = mode
+	}
+	if ttl := os.Getenv("FLOWRUNNER_LLM_CACHE_TTL"); ttl != "" {
+		cfg.LLM.Cache.TTL = ttl
+	}
 }
 
 // generateRandomKey generates a random key of the specified length
@@ -226,11 +303,36 @@ func generateRandomKey(length int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// newArtifactStore creates the artifact store of the configuration
+func newArtifactStore(cfg config.ArtifactsConfig) (runtime.ArtifactStore, error) {
+	switch cfg.Type {
+	case "filesystem":
+		return storage.NewFileArtifactStore(cfg.Path)
+	case "s3":
+		return storage.NewS3ArtifactStore(storage.S3ArtifactStoreConfig{
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			Region:    cfg.S3.Region,
+			Endpoint:  cfg.S3.Endpoint,
+			PathStyle: cfg.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported artifact storage type %q", cfg.Type)
+	}
+}
+
 // App represents the flowrunner application
 type App struct {
 	config          *config.Config
 	server          *api.Server
+	flowRegistry    registry.FlowRegistry
+	flowRuntime     runtime.FlowRuntime
+	accountService  auth.AccountService
 	storageProvider storage.StorageProvider
+	gitFlowStore    *storage.GitFlowStore
+	oauthRefresher  *services.OAuthRefresher
+	mailboxWatchers []*services.MailboxWatcher
+	stopSync        chan struct{}
 }
 
 // NewApp creates a new application instance
@@ -293,7 +395,7 @@ func NewApp(cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
-	// Create YAML loader with empty dependencies (stub implementation)
+	// Create YAML loader with the core node types
 	pluginRegistry := plugins.NewPluginRegistry()
 
 	// Register the mcp plugin
@@ -301,13 +403,34 @@ func NewApp(cfg *config.Config) (*App, error) {
 		log.Fatalf("Failed to register mcp plugin: %v", err)
 	}
 
-	nodeFactories := make(map[string]plugins.NodeFactory)
-	yamlLoader := loader.NewYAMLLoader(nodeFactories, pluginRegistry)
+	yamlLoader := loader.NewYAMLLoader(runtime.CoreNodeFactories(), pluginRegistry)
+
+	// Mirror flows into git if configured
+	flowStore := storageProvider.GetFlowStore()
+	var gitFlowStore *storage.GitFlowStore
+	if cfg.Storage.Git.Enabled {
+		gitFlowStore, err = storage.NewGitFlowStore(flowStore, storageProvider.GetAccountStore(), storage.GitFlowStoreConfig{
+			Path:     cfg.Storage.Git.Path,
+			Remote:   cfg.Storage.Git.Remote,
+			Branch:   cfg.Storage.Git.Branch,
+			AutoPush: cfg.Storage.Git.AutoPush,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize git flow store: %w", err)
+		}
+		flowStore = gitFlowStore
+		log.Printf("Mirroring flows to git repository at %s", cfg.Storage.Git.Path)
+	}
 
 	// Create flow registry
-	flowRegistry := registry.NewFlowRegistry(storageProvider.GetFlowStore(), registry.FlowRegistryOptions{
+	flowRegistry := registry.NewFlowRegistry(flowStore, registry.FlowRegistryOptions{
 		YAMLLoader: yamlLoader,
 	})
+	if gitFlowStore != nil {
+		if validator, ok := flowRegistry.(storage.GitFlowValidator); ok {
+			gitFlowStore.SetValidator(validator)
+		}
+	}
 
 	// Create account service with JWT support
 	accountService := services.NewAccountService(storageProvider.GetAccountStore())
@@ -319,9 +442,11 @@ func NewApp(cfg *config.Config) (*App, error) {
 
 	// Create secret vault service with encryption
 	var secretVault auth.ExtendedSecretVault
+	var encryptionKey []byte
 	if cfg.Auth.EncryptionKey != "" {
 		// Convert hex key to bytes
-		encryptionKey, err := services.EncryptionKeyFromHex(cfg.Auth.EncryptionKey)
+		var err error
+		encryptionKey, err = services.EncryptionKeyFromHex(cfg.Auth.EncryptionKey)
 		if err != nil {
 			return nil, fmt.Errorf("invalid encryption key: %w", err)
 		}
@@ -335,24 +460,212 @@ func NewApp(cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("encryption key is required for secret vault")
 	}
 
+	// Create the flow runtime executing flows for the API, WebSocket and MCP
+	// servers with the core node types; see CHANGELOG.md
+	flowRuntime := runtime.NewFlowRuntimeWithStoreAndSecrets(registry.NewRuntimeAdapter(flowRegistry), yamlLoader, storageProvider.GetExecutionStore(), secretVault)
+	if priced, ok := flowRuntime.(runtime.LLMPricedFlowRuntime); ok && len(cfg.LLM.Pricing) > 0 {
+		prices := make(runtime.LLMPriceTable, len(cfg.LLM.Pricing))
+		for model, price := range cfg.LLM.Pricing {
+			prices[model] = runtime.LLMPrice{Input: price.Input, Output: price.Output}
+		}
+		priced.SetLLMPrices(prices)
+	}
+	if limited, ok := flowRuntime.(runtime.QuotaFlowRuntime); ok {
+		limited.SetQuotaSource(accountService)
+	}
+	if remembering, ok := flowRuntime.(runtime.ConversationFlowRuntime); ok {
+		remembering.SetConversationStore(storageProvider.GetConversationStore())
+	}
+	if prompting, ok := flowRuntime.(runtime.PromptFlowRuntime); ok {
+		prompting.SetPromptStore(storageProvider.GetPromptStore())
+	}
+	if caching, ok := flowRuntime.(runtime.LLMCachedFlowRuntime); ok {
+		options := runtime.LLMCacheOptions{Mode: cfg.LLM.Cache.Mode}
+		if options.Mode != "" && !runtime.IsLLMCacheMode(options.Mode) {
+			log.Printf("Ignoring invalid LLM cache mode %q", options.Mode)
+			options.Mode = ""
+		}
+		if cfg.LLM.Cache.TTL != "" {
+			ttl, err := time.ParseDuration(cfg.LLM.Cache.TTL)
+			if err == nil {
+				options.TTL = ttl
+			} else {
+				log.Printf("Ignoring invalid LLM cache TTL: %v", err)
+			}
+		}
+		caching.SetLLMCache(storageProvider.GetLLMCacheStore(), options)
+	}
+
+	// Checkpoints hold unredacted inputs, so they are sealed with the key of the vault
+	if checkpointing, ok := flowRuntime.(runtime.CheckpointFlowRuntime); ok {
+		if err := checkpointing.SetCheckpointStore(storageProvider.GetCheckpointStore(), encryptionKey); err != nil {
+			return nil, fmt.Errorf("failed to set checkpoint store: %w", err)
+		}
+	}
+
+	// Keep the files produced and consumed by flows as artifacts if configured
+	if cfg.Storage.Artifacts.Type != "" {
+		artifactStore, err := newArtifactStore(cfg.Storage.Artifacts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize artifact storage: %w", err)
+		}
+		if storing, ok := flowRuntime.(runtime.ArtifactFlowRuntime); ok {
+			storing.SetArtifactStore(artifactStore)
+		}
+		log.Printf("Storing artifacts in %s storage", cfg.Storage.Artifacts.Type)
+	}
+
+	// Let flows download files to the download directory if configured
+	if cfg.Storage.DownloadPath != "" {
+		if downloading, ok := flowRuntime.(runtime.DownloadFlowRuntime); ok {
+			downloading.SetDownloadDir(cfg.Storage.DownloadPath)
+		}
+	}
+
+	// Create mailbox watchers starting flows on new mail
+	var mailboxWatchers []*services.MailboxWatcher
+	for _, watcher := range cfg.Email.Watchers {
+		if watcher.ID == "" || watcher.Account == "" || watcher.Flow == "" || watcher.Host == "" {
+			return nil, fmt.Errorf("mailbox watcher %q requires id, account, flow and host", watcher.ID)
+		}
+		mailboxWatchers = append(mailboxWatchers, services.NewMailboxWatcher(services.MailboxWatch{
+			ID:              watcher.ID,
+			Account:         watcher.Account,
+			FlowID:          watcher.Flow,
+			Host:            watcher.Host,
+			Port:            watcher.Port,
+			Security:        watcher.Security,
+			Username:        watcher.Username,
+			Password:        watcher.Password,
+			PasswordSecret:  watcher.PasswordSecret,
+			Folders:         watcher.Folders,
+			PollInterval:    time.Duration(watcher.PollInterval) * time.Second,
+			ProcessExisting: watcher.ProcessExisting,
+		}, accountService, secretVault, flowRuntime, storageProvider.GetMailboxStateStore()))
+	}
+
 	// Create API server
-	server := api.NewServer(cfg, flowRegistry, accountService, secretVault, pluginRegistry)
+	server := api.NewServerWithRuntime(cfg, flowRegistry, accountService, secretVault, flowRuntime, pluginRegistry)
 
 	return &App{
 		config:          cfg,
 		server:          server,
+		flowRegistry:    flowRegistry,
+		flowRuntime:     flowRuntime,
+		accountService:  accountService,
 		storageProvider: storageProvider,
+		gitFlowStore:    gitFlowStore,
+		oauthRefresher:  services.NewOAuthRefresher(accountService, secretVault, auth.DefaultOAuthRefreshLeeway),
+		mailboxWatchers: mailboxWatchers,
+		stopSync:        make(chan struct{}),
 	}, nil
 }
 
 // Start starts the application
 func (a *App) Start() error {
 	fmt.Printf("Starting %s version %s\n", AppName, AppVersion)
+	if a.gitFlowStore != nil && a.config.Storage.Git.SyncInterval > 0 {
+		go a.syncGitFlows(time.Duration(a.config.Storage.Git.SyncInterval) * time.Second)
+	}
+	if a.config.Auth.OAuthRefreshInterval >= 0 {
+		interval := time.Duration(a.config.Auth.OAuthRefreshInterval) * time.Second
+		if interval == 0 {
+			interval = time.Minute
+		}
+		go a.refreshOAuthTokens(interval)
+	}
+	for _, watcher := range a.mailboxWatchers {
+		go a.watchMailbox(watcher)
+	}
 	return a.server.Start()
 }
 
+// ServeMCPStdio serves the flows of the account the token belongs to over
+// the Model Context Protocol on stdin and stdout until stdin closes
+func (a *App) ServeMCPStdio(token string) error {
+	if token == "" {
+		return fmt.Errorf("FLOWRUNNER_MCP_TOKEN is required")
+	}
+	accountID, err := a.accountService.ValidateToken(token)
+	if err != nil {
+		return fmt.Errorf("invalid MCP token: %w", err)
+	}
+
+	// Stdout carries protocol messages only; anything else flows print goes
+	// to stderr
+	protocol := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = protocol }()
+
+	ctx := context.WithValue(context.Background(), middleware.AccountIDKey, accountID)
+	err = api.NewMCPServer(a.flowRegistry, a.flowRuntime).ServeStdio(ctx, os.Stdin, protocol)
+	if closeErr := a.storageProvider.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close storage: %w", closeErr)
+	}
+	return err
+}
+
+// syncGitFlows periodically imports flow changes from the git repository
+func (a *App) syncGitFlows(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopSync:
+			return
+		case <-ticker.C:
+			result, err := a.gitFlowStore.Sync()
+			if err != nil {
+				log.Printf("Git flow sync failed: %v", err)
+				continue
+			}
+			if len(result.Imported) > 0 {
+				log.Printf("Imported %d flow changes from git at %s", len(result.Imported), result.Commit)
+			}
+			for _, skipped := range result.Skipped {
+				log.Printf("Skipped invalid flow %s of account %s from git at %s: %s", skipped.FlowID, skipped.AccountID, result.Commit, skipped.Error)
+			}
+		}
+	}
+}
+
+// refreshOAuthTokens periodically renews the OAuth tokens about to expire
+func (a *App) refreshOAuthTokens(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopSync:
+			return
+		case <-ticker.C:
+			refreshed, err := a.oauthRefresher.RefreshDue(context.Background())
+			if err != nil {
+				log.Printf("OAuth token refresh failed: %v", err)
+				continue
+			}
+			if refreshed > 0 {
+				log.Printf("Refreshed %d OAuth tokens", refreshed)
+			}
+		}
+	}
+}
+
+// watchMailbox runs a mailbox watcher until the application stops
+func (a *App) watchMailbox(watcher *services.MailboxWatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-a.stopSync
+		cancel()
+	}()
+	watcher.Run(ctx)
+}
+
 // Stop stops the application gracefully
 func (a *App) Stop(ctx context.Context) error {
+	close(a.stopSync)
+
 	// Stop the server
 	if err := a.server.Stop(ctx); err != nil {
 		return err
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// artifactRuntime returns the flow runtime keeping artifacts, answering the
+// request when it has none
+func (s *Server) artifactRuntime(w http.ResponseWriter, r *http.Request) (runtime.ArtifactFlowRuntime, string, bool) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, "", false
+	}
+	artifacts, ok := s.flowRuntime.(runtime.ArtifactFlowRuntime)
+	if !ok {
+		http.Error(w, "Artifacts not supported", http.StatusNotImplemented)
+		return nil, "", false
+	}
+	return artifacts, accountID, true
+}
+
+// writeArtifactError answers a failed artifact request
+func writeArtifactError(w http.ResponseWriter, action string, err error) {
+	if errors.Is(err, runtime.ErrArtifactNotFound) {
+		http.Error(w, "Artifact not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to %s artifact: %v", action, err), http.StatusInternalServerError)
+}
+
+// handleListArtifacts handles GET /api/v1/executions/{id}/artifacts
+func (s *Server) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	artifacts, accountID, ok := s.artifactRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := artifacts.ListArtifacts(accountID, mux.Vars(r)["id"])
+	if err != nil {
+		writeArtifactError(w, "list", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleDownloadArtifact handles GET
+// /api/v1/executions/{id}/artifacts/{artifact_id}, answering with the
+// content of the artifact
+func (s *Server) handleDownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	artifacts, accountID, ok := s.artifactRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	artifact, content, err := artifacts.OpenArtifact(accountID, vars["id"], vars["artifact_id"])
+	if err != nil {
+		writeArtifactError(w, "get", err)
+		return
+	}
+	defer content.Close()
+
+	// Contents never change, so the digest is a strong validator
+	etag := `"` + strings.TrimPrefix(artifact.Digest, "sha256:") + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Contents come from flows, so they are always downloaded rather than
+	// rendered by the browser in the origin of the API
+	disposition := "attachment"
+	if artifact.Name != "" {
+		disposition = mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name})
+	}
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, content)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestArtifactAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	accountID, err := accountService.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	artifactStore, err := storage.NewFileArtifactStore(t.TempDir())
+	require.NoError(t, err)
+	mockFlowRegistry := new(MockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"base": &loader.BaseNodeFactory{}}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockFlowRegistry, yamlLoader, NewMockExecutionStore())
+	flowRuntime.(runtime.ArtifactFlowRuntime).SetArtifactStore(artifactStore)
+	cfg := &config.Config{Server: config.ServerConfig{Host: "localhost", Port: 8080}}
+	server := NewServerWithRuntime(cfg, mockFlowRegistry, accountService, vault, flowRuntime, plugins.NewPluginRegistry())
+
+	digest, size, err := artifactStore.PutBlob(strings.NewReader("id,total\n1,42\n"))
+	require.NoError(t, err)
+	report := runtime.Artifact{ID: "report", ExecutionID: "exec-1", AccountID: accountID, Name: "report.csv", ContentType: "text/csv", Size: size, Digest: digest, CreatedAt: time.Now().UTC()}
+	require.NoError(t, artifactStore.SaveArtifact(report))
+	require.NoError(t, artifactStore.SaveArtifact(runtime.Artifact{ID: "page", ExecutionID: "exec-1", AccountID: accountID, ContentType: "text/html", Size: size, Digest: digest, CreatedAt: report.CreatedAt.Add(time.Second)}))
+	require.NoError(t, artifactStore.SaveArtifact(runtime.Artifact{ID: "foreign", ExecutionID: "exec-1", AccountID: "other-account", ContentType: "text/csv", Size: size, Digest: digest, CreatedAt: time.Now().UTC()}))
+
+	t.Run("list", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/executions/exec-1/artifacts", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		// Artifacts of other accounts are not listed
+		var artifacts []runtime.Artifact
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&artifacts))
+		require.Len(t, artifacts, 2)
+		assert.Equal(t, "report", artifacts[0].ID)
+		assert.Equal(t, digest, artifacts[0].Digest)
+	})
+
+	t.Run("download", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/executions/exec-1/artifacts/report", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "id,total\n1,42\n", rr.Body.String())
+		assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=report.csv`, rr.Header().Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, `"`+strings.TrimPrefix(digest, "sha256:")+`"`, rr.Header().Get("ETag"))
+
+		// Unnamed artifacts are downloaded too, never rendered
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/executions/exec-1/artifacts/page", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "attachment", rr.Header().Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/executions/exec-1/artifacts/foreign", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/executions/exec-2/artifacts/report", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/registry"
+)
+
+// maxBundleSize limits the size of uploaded flow bundles
+const maxBundleSize = 32 << 20
+
+// ExportFlowsRequest represents a request to export several flows into one bundle
+type ExportFlowsRequest struct {
+	FlowIDs []string `json:"flow_ids"`
+	Format  string   `json:"format,omitempty"`
+}
+
+// handleExportFlow handles GET /api/v1/flows/{id}/export
+func (s *Server) handleExportFlow(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	s.writeBundle(w, accountID, []string{vars["id"]}, r.URL.Query().Get("format"))
+}
+
+// handleExportFlows handles POST /api/v1/flows/export. An empty flow_ids list exports every flow.
+func (s *Server) handleExportFlows(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req ExportFlowsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.writeBundle(w, accountID, req.FlowIDs, req.Format)
+}
+
+// writeBundle exports flows and writes the archive as the response
+func (s *Server) writeBundle(w http.ResponseWriter, accountID string, flowIDs []string, format string) {
+	if format == "" {
+		format = registry.BundleFormatTarGz
+	}
+
+	// Export into a buffer so failures can still be reported with a status code
+	var archive bytes.Buffer
+	if _, err := s.bundleService.Export(accountID, flowIDs, format, &archive); err != nil {
+		if errors.Is(err, registry.ErrFlowNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to export flows: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "application/gzip"
+	if format == registry.BundleFormatZip {
+		contentType = "application/zip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"flows.%s\"", format))
+	w.Write(archive.Bytes())
+}
+
+// handleImportFlows handles POST /api/v1/flows/import with a bundle archive as the body.
+// The dry_run and require_secrets query parameters control the import.
+func (s *Server) handleImportFlows(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	options := registry.BundleImportOptions{
+		DryRun:         query.Get("dry_run") == "true",
+		RequireSecrets: query.Get("require_secrets") == "true",
+	}
+
+	report, err := s.bundleService.Import(accountID, http.MaxBytesReader(w, r.Body, maxBundleSize), options)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err == nil:
+		if options.DryRun {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(report)
+	case errors.Is(err, registry.ErrMissingDependencies):
+		// Report what is missing so the target account can be prepared
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  err.Error(),
+			"report": report,
+		})
+	case errors.Is(err, registry.ErrInvalidBundle), errors.Is(err, registry.ErrInvalidYAML):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  err.Error(),
+			"report": report,
+		})
+	}
+}
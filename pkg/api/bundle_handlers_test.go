@@ -0,0 +1,159 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/registry"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// bundleRequest sends an authenticated request with a raw body
+func bundleRequest(server *Server, method, url string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	req.SetBasicAuth("testuser", "testpass")
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+	return rr
+}
+
+// tarGzBundle returns a tar.gz archive of files
+func tarGzBundle(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return archive.Bytes()
+}
+
+func TestBundleAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	accountID, err := accountService.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	pluginRegistry := plugins.NewPluginRegistry()
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"transform": &loader.BaseNodeFactory{}}, pluginRegistry)
+	flowRegistry := registry.NewFlowRegistry(storageProvider.GetFlowStore(), registry.FlowRegistryOptions{YAMLLoader: yamlLoader})
+	cfg := &config.Config{Server: config.ServerConfig{Host: "localhost", Port: 8080}}
+	server := NewServer(cfg, flowRegistry, accountService, vault, pluginRegistry)
+
+	flowID, err := flowRegistry.Create(accountID, "greeter", `
+metadata:
+  name: greeter
+nodes:
+  start:
+    type: transform
+    params:
+      credential: crm
+`)
+	require.NoError(t, err)
+
+	var archive []byte
+	t.Run("export", func(t *testing.T) {
+		body, _ := json.Marshal(ExportFlowsRequest{FlowIDs: []string{flowID}})
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/export", body)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "application/gzip", rr.Header().Get("Content-Type"))
+		archive = rr.Body.Bytes()
+
+		body, _ = json.Marshal(ExportFlowsRequest{Format: registry.BundleFormatZip})
+		rr = bundleRequest(server, http.MethodPost, "/api/v1/flows/export", body)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+		assert.True(t, bytes.HasPrefix(rr.Body.Bytes(), []byte("PK")))
+	})
+
+	t.Run("export unknown flow", func(t *testing.T) {
+		body, _ := json.Marshal(ExportFlowsRequest{FlowIDs: []string{"missing"}})
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/export", body)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/import?dry_run=true", archive)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var report registry.BundleImportReport
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{"crm"}, report.MissingSecrets)
+
+		flows, err := flowRegistry.List(accountID)
+		require.NoError(t, err)
+		assert.Len(t, flows, 1)
+	})
+
+	t.Run("missing secrets", func(t *testing.T) {
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/import?require_secrets=true", archive)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/import", archive)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var report registry.BundleImportReport
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		require.Len(t, report.Flows, 1)
+		assert.NotEmpty(t, report.IDMap[flowID])
+		assert.NotEqual(t, flowID, report.IDMap[flowID])
+
+		flows, err := flowRegistry.List(accountID)
+		require.NoError(t, err)
+		assert.Len(t, flows, 2)
+	})
+
+	t.Run("invalid bundle", func(t *testing.T) {
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/import", []byte("not an archive"))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("invalid flow imports nothing", func(t *testing.T) {
+		manifest, _ := json.Marshal(registry.BundleManifest{
+			FormatVersion: registry.BundleFormatVersion,
+			Flows: []registry.BundleFlow{
+				{ID: "valid", Name: "valid", Versions: []registry.BundleFlowVersion{{Version: "1", File: "flows/valid/001.yaml"}}},
+				{ID: "broken", Name: "broken", Versions: []registry.BundleFlowVersion{{Version: "1", File: "flows/broken/001.yaml"}}},
+			},
+		})
+		bundle := tarGzBundle(t, map[string]string{
+			"manifest.json":         string(manifest),
+			"flows/valid/001.yaml":  "metadata:\n  name: valid\nnodes:\n  start:\n    type: transform\n",
+			"flows/broken/001.yaml": "metadata:\n  name: broken\nnodes:\n  start:\n    type: transform\n    next:\n      default: nowhere\n",
+		})
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/import", bundle)
+		require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		assert.True(t, strings.Contains(rr.Body.String(), "flow broken"), rr.Body.String())
+
+		flows, err := flowRegistry.List(accountID)
+		require.NoError(t, err)
+		assert.Len(t, flows, 2)
+	})
+
+	t.Run("oversized bundle", func(t *testing.T) {
+		rr := bundleRequest(server, http.MethodPost, "/api/v1/flows/import", make([]byte, maxBundleSize+1))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "too large")
+	})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// ConversationSummary describes a conversation without its messages
+type ConversationSummary struct {
+	SessionID    string    `json:"session_id"`
+	MessageCount int       `json:"message_count"`
+	Summarized   bool      `json:"summarized"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// conversationRuntime returns the flow runtime holding conversation memory,
+// answering the request when it has none
+func (s *Server) conversationRuntime(w http.ResponseWriter, r *http.Request) (runtime.ConversationFlowRuntime, string, bool) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, "", false
+	}
+	conversations, ok := s.flowRuntime.(runtime.ConversationFlowRuntime)
+	if !ok {
+		http.Error(w, "Conversation memory not supported", http.StatusNotImplemented)
+		return nil, "", false
+	}
+	return conversations, accountID, true
+}
+
+// writeConversationError answers a failed conversation request
+func writeConversationError(w http.ResponseWriter, action string, err error) {
+	if errors.Is(err, runtime.ErrConversationNotFound) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to %s conversation: %v", action, err), http.StatusInternalServerError)
+}
+
+// handleListConversations handles GET /api/v1/conversations
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	conversations, accountID, ok := s.conversationRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := conversations.ListConversations(accountID)
+	if err != nil {
+		writeConversationError(w, "list", err)
+		return
+	}
+
+	// Most recently active first
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+	summaries := make([]ConversationSummary, 0, len(list))
+	for _, conversation := range list {
+		summaries = append(summaries, ConversationSummary{
+			SessionID:    conversation.SessionID,
+			MessageCount: len(conversation.Messages),
+			Summarized:   conversation.Summary != "",
+			CreatedAt:    conversation.CreatedAt,
+			UpdatedAt:    conversation.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// handleGetConversation handles GET /api/v1/conversations/{session_id}
+func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	conversations, accountID, ok := s.conversationRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, err := conversations.GetConversation(accountID, mux.Vars(r)["session_id"])
+	if err != nil {
+		writeConversationError(w, "get", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// handleDeleteConversation handles DELETE /api/v1/conversations/{session_id}
+func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	conversations, accountID, ok := s.conversationRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	if err := conversations.DeleteConversation(accountID, mux.Vars(r)["session_id"]); err != nil {
+		writeConversationError(w, "delete", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+func TestConversationAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	accountID, err := accountService.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	_, err = accountService.CreateAccount("otheruser", "otherpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	conversations := storageProvider.GetConversationStore()
+	start := time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, conversations.SaveConversation(runtime.Conversation{
+		AccountID: accountID,
+		SessionID: "support-1",
+		Messages: []utils.Message{
+			{Role: "user", Content: "My order is late"},
+			{Role: "assistant", Content: "Let me check order 42"},
+		},
+		Summary:   "The user ordered a lamp",
+		CreatedAt: start,
+		UpdatedAt: start.Add(time.Minute),
+	}))
+	require.NoError(t, conversations.SaveConversation(runtime.Conversation{
+		AccountID: accountID,
+		SessionID: "support-2",
+		Messages:  []utils.Message{{Role: "user", Content: "Hello"}},
+		CreatedAt: start,
+		UpdatedAt: start.Add(time.Hour),
+	}))
+
+	mockFlowRegistry := new(MockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"base": &loader.BaseNodeFactory{}}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockFlowRegistry, yamlLoader, NewMockExecutionStore())
+	flowRuntime.(runtime.ConversationFlowRuntime).SetConversationStore(conversations)
+	cfg := &config.Config{Server: config.ServerConfig{Host: "localhost", Port: 8080}}
+	server := NewServerWithRuntime(cfg, mockFlowRegistry, accountService, vault, flowRuntime, plugins.NewPluginRegistry())
+
+	t.Run("list conversations", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/conversations", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var summaries []ConversationSummary
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&summaries))
+		require.Len(t, summaries, 2)
+		assert.Equal(t, "support-2", summaries[0].SessionID)
+		assert.Equal(t, "support-1", summaries[1].SessionID)
+		assert.Equal(t, 2, summaries[1].MessageCount)
+		assert.True(t, summaries[1].Summarized)
+	})
+
+	t.Run("get conversation", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/conversations/support-1", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var conversation runtime.Conversation
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&conversation))
+		assert.Equal(t, "The user ordered a lamp", conversation.Summary)
+		require.Len(t, conversation.Messages, 2)
+		assert.Equal(t, "Let me check order 42", conversation.Messages[1].Content)
+	})
+
+	t.Run("conversations of other accounts are not visible", func(t *testing.T) {
+		asOther := func(method, url string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, url, nil)
+			req.SetBasicAuth("otheruser", "otherpass")
+			rr := httptest.NewRecorder()
+			server.router.ServeHTTP(rr, req)
+			return rr
+		}
+		assert.Equal(t, http.StatusNotFound, asOther(http.MethodGet, "/api/v1/conversations/support-1").Code)
+		assert.Equal(t, http.StatusNotFound, asOther(http.MethodDelete, "/api/v1/conversations/support-1").Code)
+
+		rr := asOther(http.MethodGet, "/api/v1/conversations")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, "[]", rr.Body.String())
+	})
+
+	t.Run("delete conversation", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "DELETE", "/api/v1/conversations/support-1", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/conversations/support-1", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = makeAuthenticatedRequest(server, accountID, "DELETE", "/api/v1/conversations/support-1", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
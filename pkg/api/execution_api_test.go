@@ -3,15 +3,17 @@ package api
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/config"
 	"github.com/tcmartin/flowrunner/pkg/loader"
 	"github.com/tcmartin/flowrunner/pkg/plugins"
@@ -139,7 +141,7 @@ func (m *MockExecutionStore) GetExecution(executionID string) (runtime.Execution
 	if exec, ok := m.executions[executionID]; ok {
 		return exec, nil
 	}
-	return runtime.ExecutionStatus{}, fmt.Errorf("execution not found")
+	return runtime.ExecutionStatus{}, runtime.ErrExecutionNotFound
 }
 
 func (m *MockExecutionStore) ListExecutions(accountID string) ([]runtime.ExecutionStatus, error) {
@@ -476,3 +478,54 @@ func TestFlowRuntimeWithoutExecution(t *testing.T) {
 		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
 	})
 }
+
+func TestRerunAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	userID, err := accountService.CreateAccount("user", "userpass")
+	require.NoError(t, err)
+	_, err = accountService.CreateAccount("other", "otherpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	mockFlowRegistry := new(MockFlowRegistry)
+	mockFlowRegistry.On("GetFlow", userID, "test-flow").Return(&runtime.Flow{
+		ID:   "test-flow",
+		YAML: "metadata:\n  name: test-flow\nnodes:\n  start:\n    type: base\n",
+	}, nil)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"base": &loader.BaseNodeFactory{}}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockFlowRegistry, yamlLoader, NewMockExecutionStore())
+	flowRuntime.(runtime.QuotaFlowRuntime).SetQuotaSource(accountService)
+	server := NewServerWithRuntime(&config.Config{}, mockFlowRegistry, accountService, vault, flowRuntime, plugins.NewPluginRegistry())
+
+	request := func(username, password, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request("user", "userpass", "/api/v1/flows/test-flow/run")
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var run map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&run))
+	executionID := run["execution_id"].(string)
+	rerunURL := "/api/v1/executions/" + executionID + "/rerun"
+
+	rr = request("user", "userpass", rerunURL)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	rr = request("other", "otherpass", rerunURL)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = request("user", "userpass", "/api/v1/executions/missing/rerun")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Reruns count against the account's quota
+	assert.NoError(t, accountService.SetQuota(userID, &auth.AccountQuota{MaxExecutionsPerHour: 2}))
+	rr = request("user", "userpass", rerunURL)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
@@ -0,0 +1,360 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/mcp"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/registry"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// executionURIPrefix prefixes the URIs of execution resources,
+// e.g. flowrunner://executions/{id}/logs
+const executionURIPrefix = "flowrunner://executions/"
+
+// maxExecutionResources bounds the executions listed as resources
+const maxExecutionResources = 50
+
+// executionPollInterval is how often a tool call checks its execution
+const executionPollInterval = 100 * time.Millisecond
+
+// invalidToolNameChars matches characters MCP clients reject in tool names
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// NewMCPServer returns an MCP server exposing the flows of the calling
+// account as tools and its executions as resources. The account is taken
+// from the request context as set by the auth middleware.
+func NewMCPServer(flowRegistry registry.FlowRegistry, flowRuntime runtime.FlowRuntime) *mcp.Server {
+	server := mcp.NewServer(mcp.Implementation{Name: "flowrunner", Version: "1.0.0"}, &flowMCPHandler{
+		flowRegistry: flowRegistry,
+		flowRuntime:  flowRuntime,
+	})
+	server.SetInstructions("Each tool runs a flowrunner flow with the arguments as flow input and returns the flow results. Execution logs and results are available as resources.")
+	return server
+}
+
+// flowMCPHandler serves flows as MCP tools
+type flowMCPHandler struct {
+	flowRegistry registry.FlowRegistry
+	flowRuntime  runtime.FlowRuntime
+}
+
+// flowTool is a flow exposed as a tool
+type flowTool struct {
+	tool   mcp.Tool
+	flowID string
+}
+
+func accountFromContext(ctx context.Context) (string, error) {
+	accountID, ok := ctx.Value(middleware.AccountIDKey).(string)
+	if !ok || accountID == "" {
+		return "", fmt.Errorf("authentication required")
+	}
+	return accountID, nil
+}
+
+// flowTools describes the flows of the account as tools. Tool names are the
+// flow names; names shared by several flows get the flow ID appended.
+func (h *flowMCPHandler) flowTools(accountID string) ([]flowTool, error) {
+	flows, err := h.flowRegistry.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	// Registry metadata may lack the name and description of the YAML
+	metadata := make([]loader.FlowMetadata, len(flows))
+	names := make([]string, len(flows))
+	nameCount := make(map[string]int)
+	for i, flow := range flows {
+		if yamlContent, err := h.flowRegistry.Get(accountID, flow.ID); err == nil {
+			var definition struct {
+				Metadata loader.FlowMetadata `yaml:"metadata"`
+			}
+			if yaml.Unmarshal([]byte(yamlContent), &definition) == nil {
+				metadata[i] = definition.Metadata
+			}
+		}
+		names[i] = flow.Name
+		if names[i] == "" {
+			names[i] = metadata[i].Name
+		}
+		if names[i] == "" {
+			names[i] = flow.ID
+		}
+		nameCount[toolName(names[i])]++
+	}
+
+	tools := make([]flowTool, 0, len(flows))
+	for i, flow := range flows {
+		name := toolName(names[i])
+		if name == "" || nameCount[name] > 1 {
+			name = strings.Trim(name+"_"+toolName(flow.ID), "_")
+		}
+
+		description := flow.Description
+		if description == "" {
+			description = metadata[i].Description
+		}
+		if description == "" {
+			description = fmt.Sprintf("Run the %s flow", names[i])
+		}
+
+		tools = append(tools, flowTool{
+			tool: mcp.Tool{
+				Name:        name,
+				Description: description,
+				InputSchema: inputSchema(metadata[i], flow),
+			},
+			flowID: flow.ID,
+		})
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].tool.Name < tools[j].tool.Name })
+	return tools, nil
+}
+
+// toolName turns a flow name into a valid tool name
+func toolName(name string) string {
+	name = strings.Trim(invalidToolNameChars.ReplaceAllString(name, "_"), "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// inputSchema returns the input schema from the flow's YAML metadata or its
+// registry metadata, or a schema accepting any object
+func inputSchema(metadata loader.FlowMetadata, flow registry.FlowInfo) map[string]interface{} {
+	if metadata.InputSchema != nil {
+		return metadata.InputSchema
+	}
+	if schema, ok := flow.Custom["input_schema"].(map[string]interface{}); ok {
+		return schema
+	}
+	return map[string]interface{}{"type": "object", "additionalProperties": true}
+}
+
+// ListTools implements mcp.Handler
+func (h *flowMCPHandler) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	accountID, err := accountFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flowTools, err := h.flowTools(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]mcp.Tool, len(flowTools))
+	for i, flowTool := range flowTools {
+		tools[i] = flowTool.tool
+	}
+	return tools, nil
+}
+
+// CallTool implements mcp.Handler by running the flow and waiting for it to
+// finish. Log messages are reported as progress.
+func (h *flowMCPHandler) CallTool(ctx context.Context, params mcp.CallToolParams, progress func(progress, total float64, message string)) (*mcp.CallToolResult, error) {
+	accountID, err := accountFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if h.flowRuntime == nil {
+		return nil, fmt.Errorf("flow runtime not available")
+	}
+
+	flowTools, err := h.flowTools(accountID)
+	if err != nil {
+		return nil, err
+	}
+	flowID := ""
+	for _, flowTool := range flowTools {
+		if flowTool.tool.Name == params.Name {
+			flowID = flowTool.flowID
+		}
+	}
+	if flowID == "" {
+		return nil, fmt.Errorf("tool %q %w", params.Name, mcp.ErrNotFound)
+	}
+
+	input := params.Arguments
+	if input == nil {
+		input = make(map[string]interface{})
+	}
+	executionID, err := h.flowRuntime.Execute(accountID, flowID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := h.waitForExecution(ctx, executionID, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsJSON, _ := json.Marshal(status.Results)
+	resourceText := fmt.Sprintf("Execution %s: logs at %s%s/logs", executionID, executionURIPrefix, executionID)
+	if status.Status != "completed" {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent(fmt.Sprintf("Flow %s: %s", status.Status, status.Error)),
+				mcp.TextContent(resourceText),
+			},
+			IsError: true,
+		}, nil
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent(string(resultsJSON)),
+			mcp.TextContent(resourceText),
+		},
+		StructuredContent: status.Results,
+	}, nil
+}
+
+// waitForExecution waits until the execution is neither queued nor running.
+// The execution is canceled when ctx ends first.
+func (h *flowMCPHandler) waitForExecution(ctx context.Context, executionID string, progress func(progress, total float64, message string)) (runtime.ExecutionStatus, error) {
+	logs, err := h.flowRuntime.SubscribeToLogs(executionID)
+	if err != nil {
+		logs = nil
+	}
+	// The runtime queues every entry for a subscriber until the execution
+	// ends, so the rest of the subscription is drained when returning early
+	defer func() {
+		if logs != nil {
+			go func(logs <-chan runtime.ExecutionLog) {
+				for range logs {
+				}
+			}(logs)
+		}
+	}()
+
+	ticker := time.NewTicker(executionPollInterval)
+	defer ticker.Stop()
+
+	logCount := 0
+	for {
+		select {
+		case <-ctx.Done():
+			h.flowRuntime.Cancel(executionID)
+			return runtime.ExecutionStatus{}, ctx.Err()
+		case entry, ok := <-logs:
+			if !ok {
+				logs = nil
+				continue
+			}
+			logCount++
+			progress(float64(logCount), 0, entry.Message)
+		case <-ticker.C:
+			status, err := h.flowRuntime.GetStatus(executionID)
+			if err != nil {
+				return runtime.ExecutionStatus{}, err
+			}
+			if status.Status != "running" && status.Status != "queued" {
+				return status, nil
+			}
+		}
+	}
+}
+
+// ListResources implements mcp.ResourceHandler with the logs and results of
+// the account's most recent executions
+func (h *flowMCPHandler) ListResources(ctx context.Context) ([]mcp.Resource, error) {
+	accountID, err := accountFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if h.flowRuntime == nil {
+		return nil, nil
+	}
+
+	executions, err := h.flowRuntime.ListExecutions(accountID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(executions, func(i, j int) bool { return executions[i].StartTime.After(executions[j].StartTime) })
+	if len(executions) > maxExecutionResources {
+		executions = executions[:maxExecutionResources]
+	}
+
+	resources := make([]mcp.Resource, 0, 2*len(executions))
+	for _, execution := range executions {
+		started := execution.StartTime.Format(time.RFC3339)
+		resources = append(resources,
+			mcp.Resource{
+				URI:         executionURIPrefix + execution.ID + "/result",
+				Name:        fmt.Sprintf("Result of %s (%s)", execution.FlowID, started),
+				Description: fmt.Sprintf("Status and results of execution %s (%s)", execution.ID, execution.Status),
+				MimeType:    "application/json",
+			},
+			mcp.Resource{
+				URI:         executionURIPrefix + execution.ID + "/logs",
+				Name:        fmt.Sprintf("Logs of %s (%s)", execution.FlowID, started),
+				Description: fmt.Sprintf("Logs of execution %s", execution.ID),
+				MimeType:    "application/json",
+			},
+		)
+	}
+	return resources, nil
+}
+
+// ReadResource implements mcp.ResourceHandler
+func (h *flowMCPHandler) ReadResource(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+	accountID, err := accountFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.TrimPrefix(uri, executionURIPrefix)
+	executionID, kind, found := strings.Cut(path, "/")
+	if path == uri || !found || h.flowRuntime == nil {
+		return nil, fmt.Errorf("resource %q %w", uri, mcp.ErrNotFound)
+	}
+
+	// Executions of other accounts are reported as missing
+	executions, err := h.flowRuntime.ListExecutions(accountID)
+	if err != nil {
+		return nil, err
+	}
+	var status *runtime.ExecutionStatus
+	for i := range executions {
+		if executions[i].ID == executionID {
+			status = &executions[i]
+		}
+	}
+	if status == nil {
+		return nil, fmt.Errorf("resource %q %w", uri, mcp.ErrNotFound)
+	}
+
+	var content interface{}
+	switch kind {
+	case "result":
+		if current, err := h.flowRuntime.GetStatus(executionID); err == nil {
+			status = &current
+		}
+		content = status
+	case "logs":
+		logs, err := h.flowRuntime.GetLogs(executionID)
+		if err != nil {
+			return nil, err
+		}
+		content = logs
+	default:
+		return nil, fmt.Errorf("resource %q %w", uri, mcp.ErrNotFound)
+	}
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []mcp.ResourceContents{
+		{URI: uri, MimeType: "application/json", Text: string(data)},
+	}}, nil
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/mcp"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/registry"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// mcpTestServer holds a server running the core node types, with an account
+// mcpuser/mcppass
+type mcpTestServer struct {
+	accountService *services.AccountService
+	flowRegistry   registry.FlowRegistry
+	flowRuntime    runtime.FlowRuntime
+	server         *httptest.Server
+	accountID      string
+}
+
+func newMCPTestServer(t *testing.T) *mcpTestServer {
+	t.Helper()
+	memoryProvider := storage.NewMemoryProvider()
+	accountService := services.NewAccountService(memoryProvider.GetAccountStore())
+	encKey, err := services.GenerateEncryptionKey()
+	require.NoError(t, err)
+	secretVault, err := services.NewExtendedSecretVaultService(memoryProvider.GetSecretStore(), encKey)
+	require.NoError(t, err)
+
+	nodeFactories := make(map[string]plugins.NodeFactory)
+	for nodeType, factory := range runtime.CoreNodeTypes() {
+		nodeFactories[nodeType] = &RuntimeNodeFactoryAdapter{factory: factory}
+	}
+	yamlLoader := loader.NewYAMLLoader(nodeFactories, plugins.NewPluginRegistry())
+	flowRegistry := registry.NewFlowRegistry(memoryProvider.GetFlowStore(), registry.FlowRegistryOptions{YAMLLoader: yamlLoader})
+	flowRuntime := runtime.NewFlowRuntimeWithStore(&FlowRegistryAdapter{registry: flowRegistry}, yamlLoader, memoryProvider.GetExecutionStore())
+
+	accountID, err := accountService.CreateAccount("mcpuser", "mcppass")
+	require.NoError(t, err)
+
+	server := NewServerWithRuntime(&config.Config{}, flowRegistry, accountService, secretVault, flowRuntime, plugins.NewPluginRegistry())
+	testServer := httptest.NewServer(server.router)
+	t.Cleanup(testServer.Close)
+
+	return &mcpTestServer{
+		accountService: accountService,
+		flowRegistry:   flowRegistry,
+		flowRuntime:    flowRuntime,
+		server:         testServer,
+		accountID:      accountID,
+	}
+}
+
+// client returns an initialized MCP client authenticated as the user
+func (m *mcpTestServer) client(t *testing.T, username, password string) *mcp.Client {
+	t.Helper()
+	headers := map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))}
+	client := mcp.NewClient(mcp.NewStreamableHTTPTransport(m.server.URL+"/api/v1/mcp", headers), mcp.Implementation{Name: "test", Version: "1.0.0"})
+	t.Cleanup(func() { client.Close() })
+	_, err := client.Initialize(context.Background())
+	require.NoError(t, err)
+	return client
+}
+
+func TestMCPEndpoint_FlowsAsTools(t *testing.T) {
+	m := newMCPTestServer(t)
+	_, err := m.accountService.CreateAccount("otheruser", "otherpass")
+	require.NoError(t, err)
+
+	_, err = m.flowRegistry.Create(m.accountID, "greeter", `
+metadata:
+  name: Greet Someone
+  description: Greets a person by name
+  input_schema:
+    type: object
+    properties:
+      data:
+        type: object
+        properties:
+          name: {type: string}
+    required: [data]
+nodes:
+  greet:
+    type: transform
+    params:
+      script: "return {greeting: 'Hello, ' + input.data.name};"
+`)
+	require.NoError(t, err)
+	_, err = m.flowRegistry.Create(m.accountID, "broken", `
+metadata:
+  name: broken
+nodes:
+  fail:
+    type: transform
+    params:
+      script: "throw new Error('boom');"
+`)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	client := m.client(t, "mcpuser", "mcppass")
+
+	tools, err := client.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	assert.Equal(t, "Greet_Someone", tools[0].Name)
+	assert.Equal(t, "Greets a person by name", tools[0].Description)
+	assert.Equal(t, []interface{}{"data"}, tools[0].InputSchema["required"])
+	assert.Equal(t, "broken", tools[1].Name)
+	assert.Equal(t, "object", tools[1].InputSchema["type"])
+
+	result, err := client.CallTool(ctx, "Greet_Someone", map[string]interface{}{
+		"data": map[string]interface{}{"name": "Ada"},
+	}, nil)
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content)
+	structured := result.StructuredContent.(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"greeting": "Hello, Ada"}, structured["result"])
+
+	result, err = client.CallTool(ctx, "broken", nil, nil)
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].Text, "failed")
+
+	_, err = client.CallTool(ctx, "missing", nil, nil)
+	assert.Error(t, err)
+
+	// Both executions are exposed as result and log resources
+	resources, err := client.ListResources(ctx)
+	require.NoError(t, err)
+	require.Len(t, resources, 4)
+
+	var resultURI string
+	for _, resource := range resources {
+		if len(resource.URI) > len("/result") && resource.URI[len(resource.URI)-len("/result"):] == "/result" {
+			resultURI = resource.URI
+		}
+	}
+	require.NotEmpty(t, resultURI)
+	contents, err := client.ReadResource(ctx, resultURI)
+	require.NoError(t, err)
+	assert.Contains(t, contents.Contents[0].Text, `"status"`)
+
+	// Other accounts see neither the flows nor the executions
+	other := m.client(t, "otheruser", "otherpass")
+	otherTools, err := other.ListTools(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, otherTools)
+	_, err = other.ReadResource(ctx, resultURI)
+	assert.Error(t, err)
+
+	// The endpoint requires authentication
+	resp, err := http.Post(m.server.URL+"/api/v1/mcp", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestMCPEndpoint_QueuedExecution(t *testing.T) {
+	m := newMCPTestServer(t)
+	m.flowRuntime.(runtime.QuotaFlowRuntime).SetQuotaSource(m.accountService)
+	require.NoError(t, m.accountService.SetQuota(m.accountID, &auth.AccountQuota{MaxConcurrentExecutions: 1, QueueExecutions: true}))
+
+	slowID, err := m.flowRegistry.Create(m.accountID, "slow", `
+metadata:
+  name: slow
+nodes:
+  pause:
+    type: delay
+    params:
+      duration: 500ms
+`)
+	require.NoError(t, err)
+	_, err = m.flowRegistry.Create(m.accountID, "greeter", `
+metadata:
+  name: greeter
+nodes:
+  greet:
+    type: transform
+    params:
+      script: "return {greeting: 'Hello'};"
+`)
+	require.NoError(t, err)
+
+	running, err := m.flowRuntime.Execute(m.accountID, slowID, nil)
+	require.NoError(t, err)
+
+	// The tool call waits for its execution to leave the queue and finish
+	client := m.client(t, "mcpuser", "mcppass")
+	result, err := client.CallTool(context.Background(), "greeter", nil, nil)
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content)
+	structured := result.StructuredContent.(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"greeting": "Hello"}, structured["result"])
+
+	status, err := m.flowRuntime.GetStatus(running)
+	require.NoError(t, err)
+	assert.Equal(t, "completed", status.Status)
+}
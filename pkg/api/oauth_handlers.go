@@ -0,0 +1,198 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+)
+
+// oauthFlowTTL is how long an authorization started with /oauth/start can
+// be completed
+const oauthFlowTTL = 10 * time.Minute
+
+// oauthFlow is an authorization-code flow waiting for its callback
+type oauthFlow struct {
+	accountID   string
+	secretKey   string
+	verifier    string
+	redirectURL string
+	expiresAt   time.Time
+}
+
+// oauthFlows holds the pending authorization-code flows by state
+type oauthFlows struct {
+	mu    sync.Mutex
+	flows map[string]oauthFlow
+}
+
+func newOAuthFlows() *oauthFlows {
+	return &oauthFlows{flows: make(map[string]oauthFlow)}
+}
+
+// add stores a pending flow, dropping the expired ones
+func (f *oauthFlows) add(state string, flow oauthFlow) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for key, pending := range f.flows {
+		if now.After(pending.expiresAt) {
+			delete(f.flows, key)
+		}
+	}
+	f.flows[state] = flow
+}
+
+// take removes and returns the pending flow of a state; a state is good for
+// a single callback
+func (f *oauthFlows) take(state string) (oauthFlow, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	flow, ok := f.flows[state]
+	delete(f.flows, state)
+	if !ok || time.Now().After(flow.expiresAt) {
+		return oauthFlow{}, false
+	}
+	return flow, true
+}
+
+// OAuthStartResponse is the response to a request starting an authorization
+type OAuthStartResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	RedirectURL      string    `json:"redirect_url"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// oauthCallbackURL returns the callback URL of this server as reached by the
+// request
+func oauthCallbackURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/api/v1/oauth/callback", scheme, r.Host)
+}
+
+// handleOAuthStart handles GET /api/v1/oauth/start?secret={key}
+//
+// It starts an authorization-code flow with PKCE for an OAuth secret of the
+// account and returns the URL to send the user to, or redirects there when
+// redirect=true.
+func (s *Server) handleOAuthStart(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	key := r.URL.Query().Get("secret")
+	if key == "" {
+		http.Error(w, "secret parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	oauth, _, err := auth.GetOAuth(s.secretVault, accountID, key)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load OAuth secret: %v", err), http.StatusNotFound)
+		return
+	}
+	if oauth.AuthURL == "" || oauth.TokenURL == "" {
+		http.Error(w, "OAuth secret requires auth_url and token_url", http.StatusBadRequest)
+		return
+	}
+
+	redirectURL := oauth.RedirectURL
+	if redirectURL == "" {
+		redirectURL = oauthCallbackURL(r)
+	}
+	verifier, err := auth.NewPKCEVerifier()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		http.Error(w, "Failed to generate state", http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	authorizationURL, err := oauth.AuthorizationURL(redirectURL, state, auth.PKCEChallenge(verifier))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(oauthFlowTTL)
+	s.oauthFlows.add(state, oauthFlow{
+		accountID:   accountID,
+		secretKey:   key,
+		verifier:    verifier,
+		redirectURL: redirectURL,
+		expiresAt:   expiresAt,
+	})
+
+	if r.URL.Query().Get("redirect") == "true" {
+		http.Redirect(w, r, authorizationURL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OAuthStartResponse{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+		RedirectURL:      redirectURL,
+		ExpiresAt:        expiresAt,
+	})
+}
+
+// handleOAuthCallback handles GET /api/v1/oauth/callback
+//
+// The authorization server redirects the user here. The state identifies
+// the pending flow, so the request needs no authentication; the code is
+// exchanged for tokens which are stored in the OAuth secret.
+func (s *Server) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	flow, ok := s.oauthFlows.take(query.Get("state"))
+	if !ok {
+		http.Error(w, "Unknown or expired authorization state", http.StatusBadRequest)
+		return
+	}
+	if errorCode := query.Get("error"); errorCode != "" {
+		http.Error(w, fmt.Sprintf("Authorization denied: %s %s", errorCode, query.Get("error_description")), http.StatusBadRequest)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, "code parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	oauth, metadata, err := auth.GetOAuth(s.secretVault, flow.accountID, flow.secretKey)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load OAuth secret: %v", err), http.StatusNotFound)
+		return
+	}
+	oauth, err = auth.ExchangeOAuthCode(r.Context(), oauth, code, flow.redirectURL, flow.verifier)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to exchange authorization code: %v", err), http.StatusBadGateway)
+		return
+	}
+	if err := s.secretVault.SetOAuth(flow.accountID, flow.secretKey, oauth, metadata); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store OAuth tokens: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html><body><p>Authorized %s. You can close this window.</p></body></html>", html.EscapeString(flow.secretKey))
+}
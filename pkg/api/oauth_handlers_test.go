@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestOAuthAPI(t *testing.T) {
+	// The token endpoint checks the code and the PKCE verifier
+	var challenge string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("code") != "code-1" || auth.PKCEChallenge(r.PostForm.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		assert.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "http://example.com/api/v1/oauth/callback", r.PostForm.Get("redirect_uri"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-1",
+			"refresh_token": "refresh-1",
+			"expires_in":    3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	accountID, err := accountService.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+	require.NoError(t, vault.SetOAuth(accountID, "github", auth.OAuthSecret{
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		AuthURL:      "https://auth.example.com/authorize",
+		TokenURL:     tokenServer.URL,
+		Scopes:       []string{"repo", "user"},
+	}, auth.SecretMetadata{}))
+
+	cfg := &config.Config{Server: config.ServerConfig{Host: "localhost", Port: 8080}}
+	server := NewServer(cfg, new(MockFlowRegistry), accountService, vault, plugins.NewPluginRegistry())
+
+	callback := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/oauth/callback?"+query, nil))
+		return rr
+	}
+
+	rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/oauth/start?secret=github", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var start OAuthStartResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&start))
+	assert.Equal(t, "http://example.com/api/v1/oauth/callback", start.RedirectURL)
+
+	authorizationURL, err := url.Parse(start.AuthorizationURL)
+	require.NoError(t, err)
+	query := authorizationURL.Query()
+	assert.Equal(t, "auth.example.com", authorizationURL.Host)
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "client-1", query.Get("client_id"))
+	assert.Equal(t, "repo user", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, start.State, query.Get("state"))
+	challenge = query.Get("code_challenge")
+
+	// Unknown states are rejected
+	rr = callback("state=unknown&code=code-1")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = callback(url.Values{"state": {start.State}, "code": {"code-1"}}.Encode())
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	oauth, _, err := auth.GetOAuth(vault, accountID, "github")
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", oauth.AccessToken)
+	assert.Equal(t, "refresh-1", oauth.RefreshToken)
+	assert.NotNil(t, oauth.ExpiresAt)
+
+	// A state completes a single authorization
+	rr = callback(url.Values{"state": {start.State}, "code": {"code-1"}}.Encode())
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Secrets need an authorization endpoint
+	require.NoError(t, vault.SetOAuth(accountID, "static", auth.OAuthSecret{ClientID: "c", ClientSecret: "s"}, auth.SecretMetadata{}))
+	rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/oauth/start?secret=static", nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/oauth/start?secret=missing", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
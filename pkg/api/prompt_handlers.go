@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// CreatePromptRequest is the body of a request creating a prompt version.
+// A single template may be given instead of messages; it becomes a message
+// of the given role, user by default.
+type CreatePromptRequest struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	Messages    []runtime.PromptMessage `json:"messages,omitempty"`
+	Template    string                  `json:"template,omitempty"`
+	Role        string                  `json:"role,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+}
+
+// TagPromptRequest is the body of a request tagging a prompt version
+type TagPromptRequest struct {
+	Tag string `json:"tag"`
+}
+
+// promptRuntime returns the flow runtime holding the prompt library,
+// answering the request when it has none
+func (s *Server) promptRuntime(w http.ResponseWriter, r *http.Request) (runtime.PromptFlowRuntime, string, bool) {
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, "", false
+	}
+	prompts, ok := s.flowRuntime.(runtime.PromptFlowRuntime)
+	if !ok {
+		http.Error(w, "Prompt library not supported", http.StatusNotImplemented)
+		return nil, "", false
+	}
+	return prompts, accountID, true
+}
+
+// writePromptError answers a failed prompt request
+func writePromptError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, runtime.ErrPromptNotFound):
+		http.Error(w, "Prompt not found", http.StatusNotFound)
+	case errors.Is(err, runtime.ErrInvalidPrompt):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to %s prompt: %v", action, err), http.StatusInternalServerError)
+	}
+}
+
+// handleListPrompts handles GET /api/v1/prompts
+func (s *Server) handleListPrompts(w http.ResponseWriter, r *http.Request) {
+	prompts, accountID, ok := s.promptRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := prompts.ListPrompts(accountID)
+	if err != nil {
+		writePromptError(w, "list", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleCreatePrompt handles POST /api/v1/prompts
+func (s *Server) handleCreatePrompt(w http.ResponseWriter, r *http.Request) {
+	prompts, accountID, ok := s.promptRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreatePromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Template != "" {
+		if len(req.Messages) > 0 {
+			http.Error(w, "Either messages or template may be given, not both", http.StatusBadRequest)
+			return
+		}
+		role := req.Role
+		if role == "" {
+			role = "user"
+		}
+		req.Messages = []runtime.PromptMessage{{Role: role, Template: req.Template}}
+	}
+
+	prompt, err := prompts.CreatePrompt(accountID, runtime.Prompt{
+		Name:        req.Name,
+		Description: req.Description,
+		Messages:    req.Messages,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		writePromptError(w, "create", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(prompt)
+}
+
+// handleListPromptVersions handles GET /api/v1/prompts/{name}
+func (s *Server) handleListPromptVersions(w http.ResponseWriter, r *http.Request) {
+	prompts, accountID, ok := s.promptRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := prompts.ListPromptVersions(accountID, mux.Vars(r)["name"])
+	if err != nil {
+		writePromptError(w, "list versions of", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// handleGetPrompt handles GET /api/v1/prompts/{name}/{version}, where the
+// version may also be a tag or "latest"
+func (s *Server) handleGetPrompt(w http.ResponseWriter, r *http.Request) {
+	prompts, accountID, ok := s.promptRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	prompt, err := prompts.GetPrompt(accountID, vars["name"]+"@"+vars["version"])
+	if err != nil {
+		writePromptError(w, "get", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompt)
+}
+
+// handleTagPrompt handles POST /api/v1/prompts/{name}/{version}/tags
+func (s *Server) handleTagPrompt(w http.ResponseWriter, r *http.Request) {
+	prompts, accountID, ok := s.promptRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "Version must be a number", http.StatusBadRequest)
+		return
+	}
+	var req TagPromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	prompt, err := prompts.TagPrompt(accountID, vars["name"], version, req.Tag)
+	if err != nil {
+		writePromptError(w, "tag", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompt)
+}
+
+// handleDeletePrompt handles DELETE /api/v1/prompts/{name}
+func (s *Server) handleDeletePrompt(w http.ResponseWriter, r *http.Request) {
+	prompts, accountID, ok := s.promptRuntime(w, r)
+	if !ok {
+		return
+	}
+
+	if err := prompts.DeletePrompt(accountID, mux.Vars(r)["name"]); err != nil {
+		writePromptError(w, "delete", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestPromptAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	accountID, err := accountService.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	mockFlowRegistry := new(MockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"base": &loader.BaseNodeFactory{}}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockFlowRegistry, yamlLoader, NewMockExecutionStore())
+	flowRuntime.(runtime.PromptFlowRuntime).SetPromptStore(storageProvider.GetPromptStore())
+	cfg := &config.Config{Server: config.ServerConfig{Host: "localhost", Port: 8080}}
+	server := NewServerWithRuntime(cfg, mockFlowRegistry, accountService, vault, flowRuntime, plugins.NewPluginRegistry())
+
+	t.Run("create versions", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "POST", "/api/v1/prompts", CreatePromptRequest{
+			Name:     "summarize",
+			Template: "Summarize {{.text}}",
+			Tags:     []string{"production"},
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var prompt runtime.Prompt
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&prompt))
+		assert.Equal(t, 1, prompt.Version)
+		assert.Equal(t, []runtime.PromptMessage{{Role: "user", Template: "Summarize {{.text}}"}}, prompt.Messages)
+		assert.Equal(t, []string{"text"}, prompt.Variables)
+
+		rr = makeAuthenticatedRequest(server, accountID, "POST", "/api/v1/prompts", CreatePromptRequest{
+			Name:        "summarize",
+			Description: "Shorter summaries",
+			Messages: []runtime.PromptMessage{
+				{Role: "system", Template: "Answer in one sentence."},
+				{Role: "user", Template: "Summarize {{.text}}"},
+			},
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&prompt))
+		assert.Equal(t, 2, prompt.Version)
+	})
+
+	t.Run("invalid prompts are rejected", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "POST", "/api/v1/prompts", CreatePromptRequest{
+			Name:     "broken",
+			Template: "{{.text",
+		})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("list and get", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/prompts", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var prompts []runtime.Prompt
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&prompts))
+		require.Len(t, prompts, 1)
+		assert.Equal(t, 2, prompts[0].Version)
+
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/prompts/summarize", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&prompts))
+		assert.Len(t, prompts, 2)
+
+		var prompt runtime.Prompt
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/prompts/summarize/production", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&prompt))
+		assert.Equal(t, 1, prompt.Version)
+
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/prompts/summarize/7", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("tag moves between versions", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "POST", "/api/v1/prompts/summarize/2/tags", TagPromptRequest{Tag: "production"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var prompt runtime.Prompt
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/prompts/summarize/production", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&prompt))
+		assert.Equal(t, 2, prompt.Version)
+
+		rr = makeAuthenticatedRequest(server, accountID, "POST", "/api/v1/prompts/summarize/2/tags", TagPromptRequest{Tag: "latest"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("delete prompt", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "DELETE", "/api/v1/prompts/summarize", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/prompts/summarize", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// QuotaResponse is the quota of an account and its usage counted against it
+type QuotaResponse struct {
+	AccountID string              `json:"account_id"`
+	Quota     *auth.AccountQuota  `json:"quota"`
+	Usage     *runtime.QuotaUsage `json:"usage,omitempty"`
+}
+
+// isAdmin reports whether an account belongs to one of the configured admins
+func (s *Server) isAdmin(accountID string) bool {
+	if s.config == nil || len(s.config.Auth.Admins) == 0 {
+		return false
+	}
+	account, err := s.accountService.GetAccount(accountID)
+	if err != nil {
+		return false
+	}
+	for _, admin := range s.config.Auth.Admins {
+		if admin == account.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaManager returns the account service as quota manager, answering the
+// request when quotas are not supported
+func (s *Server) quotaManager(w http.ResponseWriter) (auth.QuotaManager, bool) {
+	manager, ok := s.accountService.(auth.QuotaManager)
+	if !ok {
+		http.Error(w, "Account quotas not supported", http.StatusNotImplemented)
+	}
+	return manager, ok
+}
+
+// handleGetQuota handles GET /api/v1/accounts/{id}/quota
+// Accounts can read their own quota; admins can read any
+func (s *Server) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["id"]
+
+	authAccountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if accountID != authAccountID && !s.isAdmin(authAccountID) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	manager, ok := s.quotaManager(w)
+	if !ok {
+		return
+	}
+	quota, err := manager.GetQuota(accountID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get quota: %v", err), http.StatusNotFound)
+		return
+	}
+
+	response := QuotaResponse{AccountID: accountID, Quota: quota}
+	if tracked, ok := s.flowRuntime.(runtime.QuotaFlowRuntime); ok {
+		usage := tracked.QuotaUsage(accountID)
+		response.Usage = &usage
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleSetQuota handles PUT /api/v1/accounts/{id}/quota
+// This is an admin-only endpoint
+func (s *Server) handleSetQuota(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["id"]
+
+	authAccountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !s.isAdmin(authAccountID) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	manager, ok := s.quotaManager(w)
+	if !ok {
+		return
+	}
+
+	var quota auth.AccountQuota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := manager.SetQuota(accountID, &quota); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to set quota: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QuotaResponse{AccountID: accountID, Quota: &quota})
+}
+
+// handleDeleteQuota handles DELETE /api/v1/accounts/{id}/quota
+// This is an admin-only endpoint
+func (s *Server) handleDeleteQuota(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["id"]
+
+	authAccountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !s.isAdmin(authAccountID) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	manager, ok := s.quotaManager(w)
+	if !ok {
+		return
+	}
+	if err := manager.SetQuota(accountID, nil); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to remove quota: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeQuotaError answers a request rejected because the account is over
+// quota with 429 and the code of the exceeded quota. It reports whether err
+// was a quota error.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *runtime.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	if quotaErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+		"code":  quotaErr.Code,
+		"limit": quotaErr.Limit,
+		"used":  quotaErr.Used,
+	})
+	return true
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestQuotaAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	_, err := accountService.CreateAccount("admin", "adminpass")
+	require.NoError(t, err)
+	userID, err := accountService.CreateAccount("user", "userpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	mockFlowRegistry := new(MockFlowRegistry)
+	mockFlowRegistry.On("GetFlow", userID, "test-flow").Return(&runtime.Flow{
+		ID:   "test-flow",
+		YAML: "metadata:\n  name: test-flow\nnodes:\n  start:\n    type: base\n",
+	}, nil)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"base": &loader.BaseNodeFactory{}}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockFlowRegistry, yamlLoader, NewMockExecutionStore())
+	flowRuntime.(runtime.QuotaFlowRuntime).SetQuotaSource(accountService)
+
+	cfg := &config.Config{Auth: config.AuthConfig{Admins: []string{"admin"}}}
+	server := NewServerWithRuntime(cfg, mockFlowRegistry, accountService, vault, flowRuntime, plugins.NewPluginRegistry())
+
+	request := func(username, password, method, url string, body interface{}) *httptest.ResponseRecorder {
+		var reqBody bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&reqBody).Encode(body)
+		}
+		req := httptest.NewRequest(method, url, &reqBody)
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+		return rr
+	}
+	quotaURL := "/api/v1/accounts/" + userID + "/quota"
+
+	t.Run("only admins set quotas", func(t *testing.T) {
+		rr := request("user", "userpass", http.MethodPut, quotaURL, auth.AccountQuota{MaxExecutionsPerHour: 100})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = request("admin", "adminpass", http.MethodPut, quotaURL, auth.AccountQuota{MaxExecutionsPerHour: 1})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = request("admin", "adminpass", http.MethodPut, quotaURL, map[string]interface{}{"max_executions_per_hour": -1})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("executions over quota are rejected", func(t *testing.T) {
+		rr := request("user", "userpass", http.MethodPost, "/api/v1/flows/test-flow/run", map[string]interface{}{})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		rr = request("user", "userpass", http.MethodPost, "/api/v1/flows/test-flow/run", map[string]interface{}{})
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.Equal(t, runtime.QuotaExecutionsPerHour, body["code"])
+	})
+
+	t.Run("accounts read their own quota and usage", func(t *testing.T) {
+		rr := request("user", "userpass", http.MethodGet, quotaURL, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var response QuotaResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, userID, response.AccountID)
+		assert.Equal(t, 1, response.Quota.MaxExecutionsPerHour)
+		require.NotNil(t, response.Usage)
+		assert.Equal(t, 1, response.Usage.ExecutionsLastHour)
+
+		adminAccountID, err := accountService.Authenticate("admin", "adminpass")
+		require.NoError(t, err)
+		rr = request("user", "userpass", http.MethodGet, "/api/v1/accounts/"+adminAccountID+"/quota", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("admins remove quotas", func(t *testing.T) {
+		rr := request("user", "userpass", http.MethodDelete, quotaURL, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = request("admin", "adminpass", http.MethodDelete, quotaURL, nil)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = request("user", "userpass", http.MethodPost, "/api/v1/flows/test-flow/run", map[string]interface{}{})
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+}
@@ -3,7 +3,9 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -11,6 +13,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/mcp"
 	"github.com/tcmartin/flowrunner/pkg/middleware"
 	"github.com/tcmartin/flowrunner/pkg/plugins"
 	"github.com/tcmartin/flowrunner/pkg/registry"
@@ -27,7 +30,10 @@ type Server struct {
 	secretVault    auth.ExtendedSecretVault
 	flowRuntime    runtime.FlowRuntime
 	pluginRegistry plugins.PluginRegistry
+	bundleService  *registry.BundleService
 	wsManager      *WebSocketManager
+	mcpServer      *mcp.Server
+	oauthFlows     *oauthFlows
 }
 
 // NewServer creates a new API server
@@ -39,7 +45,10 @@ func NewServer(cfg *config.Config, flowRegistry registry.FlowRegistry, accountSe
 		accountService: accountService,
 		secretVault:    secretVault,
 		pluginRegistry: pluginRegistry,
+		bundleService:  registry.NewBundleService(flowRegistry, secretVault, pluginRegistry),
 		wsManager:      NewWebSocketManager(nil), // No flow runtime in basic constructor
+		mcpServer:      NewMCPServer(flowRegistry, nil),
+		oauthFlows:     newOAuthFlows(),
 	}
 
 	s.setupRoutes()
@@ -56,7 +65,10 @@ func NewServerWithRuntime(cfg *config.Config, flowRegistry registry.FlowRegistry
 		secretVault:    secretVault,
 		flowRuntime:    flowRuntime,
 		pluginRegistry: pluginRegistry,
+		bundleService:  registry.NewBundleService(flowRegistry, secretVault, pluginRegistry),
 		wsManager:      NewWebSocketManager(flowRuntime),
+		mcpServer:      NewMCPServer(flowRegistry, flowRuntime),
+		oauthFlows:     newOAuthFlows(),
 	}
 
 	s.setupRoutes()
@@ -114,6 +126,9 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/health", s.handleHealth).Methods(http.MethodGet, http.MethodOptions)
 	api.HandleFunc("/login", s.handleLogin).Methods(http.MethodPost, http.MethodOptions)
 
+	// The authorization server redirects users here; the state identifies them
+	api.HandleFunc("/oauth/callback", s.handleOAuthCallback).Methods(http.MethodGet, http.MethodOptions)
+
 	// Account routes
 	accounts := api.PathPrefix("/accounts").Subrouter()
 	accounts.HandleFunc("", s.handleCreateAccount).Methods(http.MethodPost, http.MethodOptions)
@@ -128,6 +143,9 @@ func (s *Server) setupRoutes() {
 	accountsMgmt.HandleFunc("/{id}", s.handleGetAccount).Methods(http.MethodGet, http.MethodOptions)
 	accountsMgmt.HandleFunc("/{id}", s.handleDeleteAccount).Methods(http.MethodDelete, http.MethodOptions)
 	accountsMgmt.HandleFunc("/{id}", s.handleUpdateAccount).Methods(http.MethodPut, http.MethodOptions)
+	accountsMgmt.HandleFunc("/{id}/quota", s.handleGetQuota).Methods(http.MethodGet, http.MethodOptions)
+	accountsMgmt.HandleFunc("/{id}/quota", s.handleSetQuota).Methods(http.MethodPut, http.MethodOptions)
+	accountsMgmt.HandleFunc("/{id}/quota", s.handleDeleteQuota).Methods(http.MethodDelete, http.MethodOptions)
 
 	// Flow routes
 	flows := authenticated.PathPrefix("/flows").Subrouter()
@@ -139,6 +157,11 @@ func (s *Server) setupRoutes() {
 	flows.HandleFunc("/{id}/metadata", s.handleUpdateFlowMetadata).Methods(http.MethodPatch, http.MethodOptions)
 	flows.HandleFunc("/search", s.handleSearchFlows).Methods(http.MethodPost, http.MethodOptions)
 
+	// Flow bundle routes
+	flows.HandleFunc("/export", s.handleExportFlows).Methods(http.MethodPost, http.MethodOptions)
+	flows.HandleFunc("/import", s.handleImportFlows).Methods(http.MethodPost, http.MethodOptions)
+	flows.HandleFunc("/{id}/export", s.handleExportFlow).Methods(http.MethodGet, http.MethodOptions)
+
 	// Flow execution routes
 	flows.HandleFunc("/{id}/run", s.handleRunFlow).Methods(http.MethodPost, http.MethodOptions)
 
@@ -147,10 +170,37 @@ func (s *Server) setupRoutes() {
 	executions.HandleFunc("/{id}", s.handleGetExecution).Methods(http.MethodGet, http.MethodOptions)
 	executions.HandleFunc("/{id}/logs", s.handleGetExecutionLogs).Methods(http.MethodGet, http.MethodOptions)
 	executions.HandleFunc("/{id}", s.handleCancelExecution).Methods(http.MethodDelete, http.MethodOptions)
+	executions.HandleFunc("/{id}/rerun", s.handleRerunExecution).Methods(http.MethodPost, http.MethodOptions)
+
+	// Files produced and consumed by executions
+	executions.HandleFunc("/{id}/artifacts", s.handleListArtifacts).Methods(http.MethodGet, http.MethodOptions)
+	executions.HandleFunc("/{id}/artifacts/{artifact_id}", s.handleDownloadArtifact).Methods(http.MethodGet, http.MethodOptions)
+
+	// LLM usage and cost of the account's executions
+	authenticated.HandleFunc("/usage", s.handleGetUsage).Methods(http.MethodGet, http.MethodOptions)
+
+	// Conversation memory of llm and agent nodes
+	conversations := authenticated.PathPrefix("/conversations").Subrouter()
+	conversations.HandleFunc("", s.handleListConversations).Methods(http.MethodGet, http.MethodOptions)
+	conversations.HandleFunc("/{session_id}", s.handleGetConversation).Methods(http.MethodGet, http.MethodOptions)
+	conversations.HandleFunc("/{session_id}", s.handleDeleteConversation).Methods(http.MethodDelete, http.MethodOptions)
+
+	// Versioned prompt templates, referenced by llm nodes with template_ref
+	prompts := authenticated.PathPrefix("/prompts").Subrouter()
+	prompts.HandleFunc("", s.handleListPrompts).Methods(http.MethodGet, http.MethodOptions)
+	prompts.HandleFunc("", s.handleCreatePrompt).Methods(http.MethodPost, http.MethodOptions)
+	prompts.HandleFunc("/{name}", s.handleListPromptVersions).Methods(http.MethodGet, http.MethodOptions)
+	prompts.HandleFunc("/{name}", s.handleDeletePrompt).Methods(http.MethodDelete, http.MethodOptions)
+	prompts.HandleFunc("/{name}/{version}", s.handleGetPrompt).Methods(http.MethodGet, http.MethodOptions)
+	prompts.HandleFunc("/{name}/{version}/tags", s.handleTagPrompt).Methods(http.MethodPost, http.MethodOptions)
 
 	// WebSocket route for real-time execution updates (authenticated)
 	authenticated.HandleFunc("/ws", s.handleWebSocket).Methods(http.MethodGet)
 
+	// Model Context Protocol endpoint: streamable HTTP at /mcp, HTTP+SSE at
+	// /mcp/sse and /mcp/message
+	authenticated.PathPrefix("/mcp").Handler(s.mcpServer)
+
 	// Account management routes (authenticated)
 	accountsMgmt.HandleFunc("/me", s.handleGetCurrentAccount).Methods(http.MethodGet, http.MethodOptions)
 	accountsMgmt.HandleFunc("/refresh-token", s.handleRefreshToken).Methods(http.MethodPost, http.MethodOptions)
@@ -192,6 +242,9 @@ func (s *Server) setupRoutes() {
 	jwtSecrets.HandleFunc("/{key}", s.handleCreateJWTSecret).Methods(http.MethodPost, http.MethodOptions)
 	jwtSecrets.HandleFunc("/{key}", s.handleGetJWTSecret).Methods(http.MethodGet, http.MethodOptions)
 
+	// OAuth authorization-code flow filling OAuth secrets
+	authenticated.HandleFunc("/oauth/start", s.handleOAuthStart).Methods(http.MethodGet, http.MethodOptions)
+
 	// Plugin management routes (authenticated)
 	plugins := authenticated.PathPrefix("/plugins").Subrouter()
 	plugins.HandleFunc("", s.handleListPlugins).Methods(http.MethodGet, http.MethodOptions)
@@ -453,7 +506,8 @@ func (s *Server) handleRunFlow(w http.ResponseWriter, r *http.Request) {
 	flowID := vars["id"]
 
 	var req struct {
-		Input map[string]interface{} `json:"input,omitempty"`
+		Input      map[string]interface{} `json:"input,omitempty"`
+		Entrypoint string                 `json:"entrypoint,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -466,15 +520,33 @@ func (s *Server) handleRunFlow(w http.ResponseWriter, r *http.Request) {
 		req.Input = make(map[string]interface{})
 	}
 
-	executionID, err := s.flowRuntime.Execute(accountID, flowID, req.Input)
+	// The entry point may also be given as a query parameter
+	if req.Entrypoint == "" {
+		req.Entrypoint = r.URL.Query().Get("entrypoint")
+	}
+
+	var executionID string
+	var err error
+	if req.Entrypoint != "" {
+		entering, ok := s.flowRuntime.(runtime.EntrypointFlowRuntime)
+		if !ok {
+			http.Error(w, "Entry points not supported", http.StatusNotImplemented)
+			return
+		}
+		executionID, err = entering.ExecuteWithOptions(accountID, flowID, req.Input, runtime.ExecuteOptions{Entrypoint: req.Entrypoint})
+	} else {
+		executionID, err = s.flowRuntime.Execute(accountID, flowID, req.Input)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if !writeQuotaError(w, err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 		return
 	}
 
 	response := map[string]interface{}{
 		"execution_id": executionID,
-		"status":       "running",
+		"status":       s.executionStatus(executionID),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -541,6 +613,80 @@ func (s *Server) handleCancelExecution(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleRerunExecution handles starting a new execution from a previous execution's input
+func (s *Server) handleRerunExecution(w http.ResponseWriter, r *http.Request) {
+	if s.flowRuntime == nil {
+		http.Error(w, "Flow runtime not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	rerunning, ok := s.flowRuntime.(runtime.RerunFlowRuntime)
+	if !ok {
+		http.Error(w, "Reruns not supported", http.StatusNotImplemented)
+		return
+	}
+
+	vars := mux.Vars(r)
+	executionID := vars["id"]
+
+	// An empty body reruns on the same flow version from the start
+	var options runtime.RerunOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	newExecutionID, err := rerunning.Rerun(accountID, executionID, options)
+	switch {
+	case err == nil:
+	case errors.Is(err, runtime.ErrExecutionNotFound):
+		http.Error(w, "Execution not found", http.StatusNotFound)
+		return
+	case errors.Is(err, runtime.ErrExecutionForbidden):
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	default:
+		if !writeQuotaError(w, err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"execution_id": newExecutionID,
+		"status":       s.executionStatus(newExecutionID),
+		"rerun_of":     executionID,
+	}
+
+	// Reruns queued by the account's concurrency limit have not started yet
+	code := http.StatusCreated
+	if response["status"] == "queued" {
+		code = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// executionStatus returns the status of a just started execution, which is
+// queued when its account is at its concurrency limit
+func (s *Server) executionStatus(executionID string) string {
+	status, err := s.flowRuntime.GetStatus(executionID)
+	if err != nil {
+		return "running"
+	}
+	return status.Status
+}
+
 // handleWebSocket handles WebSocket connections for real-time execution updates
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Extract account ID from request context (set by auth middleware)
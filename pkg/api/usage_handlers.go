@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/middleware"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// UsageResponse is the LLM usage of an account's executions
+type UsageResponse struct {
+	AccountID string     `json:"account_id"`
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+	FlowID    string     `json:"flow_id,omitempty"`
+	runtime.UsageReport
+}
+
+// handleGetUsage handles GET /api/v1/usage?from=&to=&flow_id=&bucket=
+func (s *Server) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	if s.flowRuntime == nil {
+		http.Error(w, "Flow runtime not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	accountID, ok := middleware.GetAccountID(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	query := runtime.UsageQuery{FlowID: params.Get("flow_id"), Bucket: params.Get("bucket")}
+	if query.Bucket != "" && !runtime.IsUsageBucket(query.Bucket) {
+		http.Error(w, fmt.Sprintf("Invalid bucket %q: use hour, day, week or month", query.Bucket), http.StatusBadRequest)
+		return
+	}
+	var err error
+	if query.From, err = parseUsageTime(params.Get("from")); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	if query.To, err = parseUsageTime(params.Get("to")); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid to: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	executions, err := s.flowRuntime.ListExecutions(accountID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list executions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := UsageResponse{
+		AccountID:   accountID,
+		FlowID:      query.FlowID,
+		UsageReport: runtime.AggregateUsage(executions, query),
+	}
+	if !query.From.IsZero() {
+		response.From = &query.From
+	}
+	if !query.To.IsZero() {
+		response.To = &query.To
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseUsageTime parses an RFC 3339 time or a date; an empty value is zero
+func parseUsageTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/config"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestUsageAPI(t *testing.T) {
+	storageProvider := storage.NewMemoryProvider()
+	storageProvider.Initialize()
+	accountService := services.NewAccountService(storageProvider.GetAccountStore())
+	accountID, err := accountService.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(storageProvider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	day := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+	usage := func(tokens int, cost float64) *runtime.ExecutionUsage {
+		total := runtime.TokenUsage{Requests: 1, TotalTokens: tokens, Cost: cost}
+		return &runtime.ExecutionUsage{Total: total, Models: map[string]runtime.TokenUsage{"openai/gpt-4o": total}}
+	}
+	store := NewMockExecutionStore()
+	store.SaveExecution(runtime.ExecutionStatus{ID: "e1", FlowID: "summarize", StartTime: day.Add(time.Hour), Usage: usage(100, 0.5)})
+	store.SaveExecution(runtime.ExecutionStatus{ID: "e2", FlowID: "translate", StartTime: day.Add(2 * time.Hour), Usage: usage(200, 1)})
+	store.SaveExecution(runtime.ExecutionStatus{ID: "e3", FlowID: "summarize", StartTime: day.AddDate(0, 0, 1), Usage: usage(300, 1.5)})
+
+	mockFlowRegistry := new(MockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{"base": &loader.BaseNodeFactory{}}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockFlowRegistry, yamlLoader, store)
+	cfg := &config.Config{Server: config.ServerConfig{Host: "localhost", Port: 8080}}
+	server := NewServerWithRuntime(cfg, mockFlowRegistry, accountService, vault, flowRuntime, plugins.NewPluginRegistry())
+
+	t.Run("daily usage of the account", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/usage", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var response UsageResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, accountID, response.AccountID)
+		assert.Equal(t, "day", response.Bucket)
+		assert.Equal(t, 3, response.Executions)
+		assert.Equal(t, 600, response.Total.TotalTokens)
+		assert.InDelta(t, 3.0, response.Total.Cost, 1e-9)
+		assert.Equal(t, 400, response.Flows["summarize"].TotalTokens)
+		assert.Equal(t, 3, response.Models["openai/gpt-4o"].Requests)
+		require.Len(t, response.Buckets, 2)
+		assert.Equal(t, 300, response.Buckets[0].Total.TotalTokens)
+	})
+
+	t.Run("filtered by flow and time range", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/usage?flow_id=summarize&from=2025-03-05&to=2025-03-05T12:00:00Z&bucket=hour", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var response UsageResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		assert.Equal(t, "summarize", response.FlowID)
+		assert.Equal(t, 1, response.Executions)
+		require.Len(t, response.Buckets, 1)
+		assert.Equal(t, day.Add(time.Hour), response.Buckets[0].Start)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		rr := makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/usage?bucket=year", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = makeAuthenticatedRequest(server, accountID, "GET", "/api/v1/usage?from=yesterday", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
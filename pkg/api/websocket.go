@@ -38,7 +38,7 @@ type ConnectionMetadata struct {
 
 // ExecutionUpdate represents a real-time update for a flow execution
 type ExecutionUpdate struct {
-	Type        string                 `json:"type"`        // "log", "status", "complete", "error"
+	Type        string                 `json:"type"`        // "log", "delta", "status", "complete", "error"
 	ExecutionID string                 `json:"execution_id"`
 	Timestamp   time.Time              `json:"timestamp"`
 	NodeID      string                 `json:"node_id,omitempty"`
@@ -252,6 +252,15 @@ func (wsm *WebSocketManager) monitorExecution(executionID string) {
 			Message:     log.Message,
 			Log:         &log,
 		}
+		// Token deltas of streamed LLM responses are sent as compact updates
+		// carrying just the new text
+		if event, _ := log.Data["event"].(string); event == runtime.LLMDeltaEvent {
+			delta, _ := log.Data["delta"].(string)
+			update.Type = "delta"
+			update.Message = delta
+			update.Data = log.Data
+			update.Log = nil
+		}
 		wsm.broadcastToExecution(executionID, update)
 	}
 
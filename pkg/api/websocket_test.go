@@ -296,3 +296,49 @@ func TestWebSocketManager_ExecutionNotFound(t *testing.T) {
 	
 	mockRuntime.AssertExpectations(t)
 }
+
+func TestWebSocketManager_LLMDeltaUpdates(t *testing.T) {
+	mockRuntime := &MockFlowRuntimeForWebSocket{}
+	wsManager := NewWebSocketManager(mockRuntime)
+
+	testStatus := runtime.ExecutionStatus{ID: "test-execution", Status: "running"}
+	logChan := make(chan runtime.ExecutionLog, 2)
+	mockRuntime.On("GetStatus", "test-execution").Return(testStatus, nil)
+	mockRuntime.On("SubscribeToLogs", "test-execution").Return((<-chan runtime.ExecutionLog)(logChan), nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsManager.HandleWebSocket(w, r, "test-account")
+	}))
+	defer server.Close()
+
+	u := "ws" + strings.TrimPrefix(server.URL, "http") + "/"
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	err = ws.WriteJSON(WebSocketMessage{Type: "subscribe", ExecutionID: "test-execution"})
+	assert.NoError(t, err)
+
+	var update ExecutionUpdate
+	assert.NoError(t, ws.ReadJSON(&update))
+	assert.Equal(t, "status", update.Type)
+
+	// Token deltas are sent as delta updates, other logs as log updates
+	logChan <- runtime.ExecutionLog{Level: "debug", Message: "LLM token delta", Data: map[string]interface{}{
+		"event": runtime.LLMDeltaEvent,
+		"delta": "Hel",
+		"index": 0,
+	}}
+	logChan <- runtime.ExecutionLog{Level: "info", Message: "LLM response received"}
+
+	assert.NoError(t, ws.ReadJSON(&update))
+	assert.Equal(t, "delta", update.Type)
+	assert.Equal(t, "Hel", update.Message)
+	assert.Equal(t, float64(0), update.Data["index"])
+	assert.Nil(t, update.Log)
+
+	assert.NoError(t, ws.ReadJSON(&update))
+	assert.Equal(t, "log", update.Type)
+	assert.Equal(t, "LLM response received", update.Message)
+	close(logChan)
+}
@@ -45,6 +45,40 @@ type Account struct {
 
 	// UpdatedAt is when the account was last updated
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Quota limits the work of the account; nil means unlimited
+	Quota *AccountQuota `json:"quota,omitempty"`
+}
+
+// AccountQuota limits the executions and LLM spend of an account. A zero
+// limit is unlimited.
+type AccountQuota struct {
+	// MaxExecutionsPerHour limits the executions started in any hour
+	MaxExecutionsPerHour int `json:"max_executions_per_hour,omitempty"`
+
+	// MaxConcurrentExecutions limits the executions running at once
+	MaxConcurrentExecutions int `json:"max_concurrent_executions,omitempty"`
+
+	// MaxDailyLLMSpend limits the cost of LLM requests per UTC day, in the
+	// currency of the configured LLM prices
+	MaxDailyLLMSpend float64 `json:"max_daily_llm_spend,omitempty"`
+
+	// SoftLimitPercent logs a warning once usage reaches this percentage of a
+	// limit, before work is rejected (0 disables warnings)
+	SoftLimitPercent float64 `json:"soft_limit_percent,omitempty"`
+
+	// QueueExecutions queues executions over the concurrency limit until a
+	// running execution finishes instead of rejecting them
+	QueueExecutions bool `json:"queue_executions,omitempty"`
+}
+
+// QuotaManager reads and sets account quotas; account services may implement it
+type QuotaManager interface {
+	// GetQuota returns the quota of an account, or nil when it has none
+	GetQuota(accountID string) (*AccountQuota, error)
+
+	// SetQuota replaces the quota of an account; nil removes it
+	SetQuota(accountID string, quota *AccountQuota) error
 }
 
 // SecretVault manages per-account secrets
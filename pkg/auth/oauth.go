@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOAuthNotAuthorized is returned for OAuth secrets without an access token
+// that can be used or renewed
+var ErrOAuthNotAuthorized = errors.New("oauth secret is not authorized")
+
+// DefaultOAuthRefreshLeeway is how long before their expiry access tokens
+// are renewed
+const DefaultOAuthRefreshLeeway = 5 * time.Minute
+
+// OAuthHTTPClient sends the requests to token endpoints
+var OAuthHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// oauthLocks serializes the renewals of each secret, so that a rotated
+// refresh token is never used twice
+var oauthLocks sync.Map // accountID + "/" + key -> *sync.Mutex
+
+// NeedsRefresh reports whether the access token is missing or expires
+// within leeway
+func (o OAuthSecret) NeedsRefresh(leeway time.Duration) bool {
+	if o.AccessToken == "" {
+		return true
+	}
+	return o.ExpiresAt != nil && time.Now().Add(leeway).After(*o.ExpiresAt)
+}
+
+// NewPKCEVerifier returns a random PKCE code verifier
+func NewPKCEVerifier() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// PKCEChallenge returns the S256 code challenge of a code verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL returns the URL of the authorization endpoint starting an
+// authorization-code flow with PKCE
+func (o OAuthSecret) AuthorizationURL(redirectURL, state, challenge string) (string, error) {
+	if o.AuthURL == "" {
+		return "", fmt.Errorf("oauth secret has no auth_url")
+	}
+	authURL, err := url.Parse(o.AuthURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid auth_url: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", o.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("state", state)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	if len(o.Scopes) > 0 {
+		query.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// ExchangeOAuthCode trades an authorization code for tokens, returning the
+// secret with them
+func ExchangeOAuthCode(ctx context.Context, oauth OAuthSecret, code, redirectURL, verifier string) (OAuthSecret, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+	return requestOAuthToken(ctx, oauth, form)
+}
+
+// RefreshOAuthToken renews the access token with the refresh token,
+// returning the secret with the new tokens
+func RefreshOAuthToken(ctx context.Context, oauth OAuthSecret) (OAuthSecret, error) {
+	if oauth.RefreshToken == "" {
+		return oauth, fmt.Errorf("%w: no refresh token", ErrOAuthNotAuthorized)
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {oauth.RefreshToken},
+	}
+	if len(oauth.Scopes) > 0 {
+		form.Set("scope", strings.Join(oauth.Scopes, " "))
+	}
+	return requestOAuthToken(ctx, oauth, form)
+}
+
+// requestOAuthToken posts a token request with the client credentials and
+// applies the response to the secret
+func requestOAuthToken(ctx context.Context, oauth OAuthSecret, form url.Values) (OAuthSecret, error) {
+	if oauth.TokenURL == "" {
+		return oauth, fmt.Errorf("oauth secret has no token_url")
+	}
+	form.Set("client_id", oauth.ClientID)
+	if oauth.ClientSecret != "" {
+		form.Set("client_secret", oauth.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oauth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oauth, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := OAuthHTTPClient.Do(req)
+	if err != nil {
+		return oauth, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return oauth, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	// Some providers answer with a form encoded body
+	values := map[string]interface{}{}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" || mediaType == "text/plain" {
+		parsed, _ := url.ParseQuery(string(body))
+		for key := range parsed {
+			values[key] = parsed.Get(key)
+		}
+	} else if err := json.Unmarshal(body, &values); err != nil {
+		return oauth, fmt.Errorf("invalid token response (status %d): %s", resp.StatusCode, body)
+	}
+
+	if errorCode, _ := values["error"].(string); errorCode != "" || resp.StatusCode >= 300 {
+		description, _ := values["error_description"].(string)
+		return oauth, fmt.Errorf("token endpoint error (status %d): %s %s", resp.StatusCode, errorCode, description)
+	}
+	accessToken, _ := values["access_token"].(string)
+	if accessToken == "" {
+		return oauth, fmt.Errorf("token response has no access_token")
+	}
+
+	oauth.AccessToken = accessToken
+	// Refresh tokens are kept unless the provider rotates them
+	if refreshToken, _ := values["refresh_token"].(string); refreshToken != "" {
+		oauth.RefreshToken = refreshToken
+	}
+	oauth.ExpiresAt = nil
+	var expiresIn float64
+	switch v := values["expires_in"].(type) {
+	case float64:
+		expiresIn = v
+	case string:
+		expiresIn, _ = strconv.ParseFloat(v, 64)
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second)
+		oauth.ExpiresAt = &expiresAt
+	}
+	return oauth, nil
+}
+
+// GetOAuth returns the OAuth credentials of a secret with its metadata
+func GetOAuth(vault ExtendedSecretVault, accountID, key string) (OAuthSecret, SecretMetadata, error) {
+	secret, err := vault.GetStructured(accountID, key)
+	if err != nil {
+		return OAuthSecret{}, SecretMetadata{}, err
+	}
+	if secret.Metadata.Type != SecretTypeOAuth {
+		return OAuthSecret{}, SecretMetadata{}, fmt.Errorf("secret %q is not an OAuth secret", key)
+	}
+	var oauth OAuthSecret
+	if err := json.Unmarshal([]byte(secret.Value), &oauth); err != nil {
+		return OAuthSecret{}, SecretMetadata{}, fmt.Errorf("failed to parse OAuth secret %q: %w", key, err)
+	}
+	return oauth, secret.Metadata, nil
+}
+
+// ValidOAuthToken returns the OAuth credentials of a secret with an access
+// token valid for at least leeway, renewing and storing the token first when
+// needed
+func ValidOAuthToken(ctx context.Context, vault ExtendedSecretVault, accountID, key string, leeway time.Duration) (OAuthSecret, error) {
+	lock, _ := oauthLocks.LoadOrStore(accountID+"/"+key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	// The secret is read under the lock, as another renewal may have stored
+	// new tokens meanwhile
+	oauth, metadata, err := GetOAuth(vault, accountID, key)
+	if err != nil {
+		return OAuthSecret{}, err
+	}
+	if !oauth.NeedsRefresh(leeway) {
+		return oauth, nil
+	}
+	if oauth.RefreshToken == "" {
+		if oauth.AccessToken == "" {
+			return OAuthSecret{}, fmt.Errorf("%w: %q has no access token", ErrOAuthNotAuthorized, key)
+		}
+		// Tokens that cannot be renewed are used until they expire
+		if time.Now().Before(*oauth.ExpiresAt) {
+			return oauth, nil
+		}
+		return OAuthSecret{}, fmt.Errorf("%w: the access token of %q expired", ErrOAuthNotAuthorized, key)
+	}
+
+	refreshed, err := RefreshOAuthToken(ctx, oauth)
+	if err != nil {
+		return OAuthSecret{}, fmt.Errorf("failed to refresh OAuth token %q: %w", key, err)
+	}
+	if err := vault.SetOAuth(accountID, key, refreshed, metadata); err != nil {
+		return OAuthSecret{}, fmt.Errorf("failed to store refreshed OAuth token %q: %w", key, err)
+	}
+	return refreshed, nil
+}
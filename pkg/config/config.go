@@ -24,6 +24,12 @@ type Config struct {
 
 	// Logging configuration
 	Logging LoggingConfig `json:"logging"`
+
+	// LLM configuration
+	LLM LLMConfig `json:"llm"`
+
+	// Email configuration
+	Email EmailConfig `json:"email"`
 }
 
 // ServerConfig contains HTTP server settings
@@ -60,6 +66,68 @@ type StorageConfig struct {
 
 	// PostgreSQL configuration
 	Postgres PostgresConfig `json:"postgres"`
+
+	// Git mirror configuration for flow definitions
+	Git GitConfig `json:"git"`
+
+	// Artifact storage for files produced and consumed by flows
+	Artifacts ArtifactsConfig `json:"artifacts"`
+
+	// DownloadPath is the directory http.request nodes download files to,
+	// in a subdirectory per account; empty disables path downloads
+	DownloadPath string `json:"download_path"`
+}
+
+// ArtifactsConfig contains settings for storing artifacts
+type ArtifactsConfig struct {
+	// Type of artifact storage; empty disables artifacts
+	Type string `json:"type"` // "filesystem", "s3"
+
+	// Path is the directory of filesystem storage
+	Path string `json:"path"`
+
+	// S3 configuration
+	S3 S3Config `json:"s3"`
+}
+
+// S3Config contains settings for S3 or S3-compatible storage
+type S3Config struct {
+	// Bucket holds the artifacts
+	Bucket string `json:"bucket"`
+
+	// Prefix is prepended to all keys
+	Prefix string `json:"prefix"`
+
+	// Region is the AWS region
+	Region string `json:"region"`
+
+	// Endpoint is the URL of an S3-compatible store
+	Endpoint string `json:"endpoint"`
+
+	// PathStyle addresses the bucket in the URL path, as most
+	// S3-compatible stores expect
+	PathStyle bool `json:"path_style"`
+}
+
+// GitConfig contains settings for mirroring flows into a git repository
+type GitConfig struct {
+	// Enabled indicates whether flows are mirrored to git
+	Enabled bool `json:"enabled"`
+
+	// Path is the local working copy
+	Path string `json:"path"`
+
+	// Remote is the repository to pull from and push to (optional)
+	Remote string `json:"remote"`
+
+	// Branch to commit to
+	Branch string `json:"branch"`
+
+	// AutoPush pushes after every commit
+	AutoPush bool `json:"auto_push"`
+
+	// SyncInterval is the interval in seconds for importing changes from the repository (0 disables)
+	SyncInterval int `json:"sync_interval"`
 }
 
 // DynamoDBConfig contains DynamoDB settings
@@ -105,6 +173,13 @@ type AuthConfig struct {
 
 	// EncryptionKey is the key for encrypting secrets
 	EncryptionKey string `json:"encryption_key"`
+
+	// Admins lists the usernames of accounts allowed to manage other accounts
+	Admins []string `json:"admins"`
+
+	// OAuthRefreshInterval is the interval in seconds for renewing OAuth
+	// tokens before they expire (0 uses 60, a negative value disables)
+	OAuthRefreshInterval int `json:"oauth_refresh_interval"`
 }
 
 // PluginsConfig contains plugin settings
@@ -131,6 +206,83 @@ type LoggingConfig struct {
 	FilePath string `json:"file_path"`
 }
 
+// LLMConfig contains settings for LLM nodes
+type LLMConfig struct {
+	// Pricing maps models to their price, used to cost token usage. Keys are
+	// "provider/model" or a model name; a trailing "*" matches by prefix.
+	Pricing map[string]LLMPrice `json:"pricing"`
+
+	// Cache configures the cache of LLM responses
+	Cache LLMCacheConfig `json:"cache"`
+}
+
+// LLMCacheConfig contains settings for the cache of LLM responses
+type LLMCacheConfig struct {
+	// Mode applies to llm nodes that do not set their own cache; "record"
+	// and "replay" apply to all of them
+	Mode string `json:"mode"` // "off", "read_write", "record", "replay"
+
+	// TTL is how long cached responses stay fresh, e.g. "24h"
+	TTL string `json:"ttl"`
+}
+
+// EmailConfig contains settings for email triggers
+type EmailConfig struct {
+	// Watchers start a flow for each new message of IMAP folders
+	Watchers []MailboxWatcherConfig `json:"watchers"`
+}
+
+// MailboxWatcherConfig contains the settings of a mailbox watcher
+type MailboxWatcherConfig struct {
+	// ID identifies the watcher; the messages it processed are recorded
+	// under it
+	ID string `json:"id"`
+
+	// Account is the username or ID of the account running the flow
+	Account string `json:"account"`
+
+	// Flow is the ID of the flow started for each new message
+	Flow string `json:"flow"`
+
+	// Host is the IMAP server host
+	Host string `json:"host"`
+
+	// Port is the IMAP server port (default 993, or 143 without TLS)
+	Port int `json:"port"`
+
+	// Security is how the connection is secured
+	Security string `json:"security"` // "tls", "starttls", "none"
+
+	// Username is the IMAP login
+	Username string `json:"username"`
+
+	// Password is the IMAP password
+	Password string `json:"password"`
+
+	// PasswordSecret names a secret of the account holding the password
+	PasswordSecret string `json:"password_secret"`
+
+	// Folders are the folders to watch (default INBOX)
+	Folders []string `json:"folders"`
+
+	// PollInterval is the interval in seconds for checking the folders
+	// besides IDLE notifications (0 uses 60)
+	PollInterval int `json:"poll_interval"`
+
+	// ProcessExisting starts flows for the messages already in a folder
+	// when it is first watched
+	ProcessExisting bool `json:"process_existing"`
+}
+
+// LLMPrice is the price of a model in any currency per million tokens
+type LLMPrice struct {
+	// Input is the price of prompt tokens
+	Input float64 `json:"input"`
+
+	// Output is the price of completion tokens
+	Output float64 `json:"output"`
+}
+
 // LoadConfig loads the configuration from a file
 func LoadConfig(path string) (*Config, error) {
 	// Read the file
@@ -0,0 +1,363 @@
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"gopkg.in/yaml.v3"
+)
+
+// mainSource names the document passed to Parse or Validate in error messages
+const mainSource = "flow"
+
+// maxImportDepth bounds nested imports
+const maxImportDepth = 16
+
+// FlowError is a flow definition error annotated with where it originated
+type FlowError struct {
+	// Source is the flow document the error comes from ("flow" for the document
+	// being parsed, otherwise the source reported by the ImportResolver)
+	Source string
+
+	// Line and Column are 1-based; zero when unknown
+	Line   int
+	Column int
+
+	// Message describes the problem
+	Message string
+}
+
+// Error implements the error interface
+func (e *FlowError) Error() string {
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.Source, e.Line, e.Column, e.Message)
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.Source, e.Line, e.Message)
+	default:
+		return fmt.Sprintf("%s: %s", e.Source, e.Message)
+	}
+}
+
+// ImportResolver loads the documents named in a flow's imports list
+type ImportResolver interface {
+	// ResolveImport returns the YAML of the named flow or fragment and a source
+	// name used when reporting errors in it
+	ResolveImport(name string) (content string, source string, err error)
+}
+
+// ImportResolverFunc adapts a function to the ImportResolver interface
+type ImportResolverFunc func(name string) (string, string, error)
+
+// ResolveImport calls f(name)
+func (f ImportResolverFunc) ResolveImport(name string) (string, string, error) {
+	return f(name)
+}
+
+// ResolvingLoader is implemented by loaders that support imports
+type ResolvingLoader interface {
+	// WithResolver returns a loader that resolves imports with resolver
+	WithResolver(resolver ImportResolver) YAMLLoader
+}
+
+// flowDocument is the raw form of a flow YAML document
+type flowDocument struct {
+	Metadata      FlowMetadata         `yaml:"metadata"`
+	Imports       []string             `yaml:"imports"`
+	NodeTemplates map[string]yaml.Node `yaml:"node_templates"`
+	Nodes         map[string]yaml.Node `yaml:"nodes"`
+	Entrypoints   map[string]string    `yaml:"entrypoints"`
+}
+
+// nodeSpec is a node or node template as written, before templates are applied
+type nodeSpec struct {
+	plugins.NodeDefinition `yaml:",inline"`
+
+	// Template names a node template whose fields this node extends
+	Template string `yaml:"template"`
+}
+
+// sourcedNode is a node spec together with where it was defined
+type sourcedNode struct {
+	spec   nodeSpec
+	source string
+	line   int
+	column int
+}
+
+func (n sourcedNode) errorf(format string, args ...interface{}) *FlowError {
+	return &FlowError{Source: n.source, Line: n.line, Column: n.column, Message: fmt.Sprintf(format, args...)}
+}
+
+// resolvedFlow is a flow definition with imports and templates applied
+type resolvedFlow struct {
+	definition FlowDefinition
+	nodes      map[string]sourcedNode
+}
+
+// resolveFlow parses a flow document, merges its imports and applies node templates
+func resolveFlow(content string, resolver ImportResolver) (*resolvedFlow, error) {
+	r := &flowResolver{
+		resolver:  resolver,
+		nodes:     make(map[string]sourcedNode),
+		templates: make(map[string]sourcedNode),
+		loaded:    make(map[string]bool),
+	}
+
+	doc, err := r.load(content, mainSource, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &resolvedFlow{
+		definition: FlowDefinition{
+			Metadata:    doc.Metadata,
+			Nodes:       make(map[string]plugins.NodeDefinition, len(r.nodes)),
+			Entrypoints: doc.Entrypoints,
+		},
+		nodes: r.nodes,
+	}
+
+	for _, name := range sortedNodeNames(r.nodes) {
+		node := r.nodes[name]
+		definition, err := r.applyTemplate(node, nil)
+		if err != nil {
+			return nil, err
+		}
+		if definition.Type == "" {
+			return nil, node.errorf("node '%s' has no type", name)
+		}
+		resolved.definition.Nodes[name] = definition
+	}
+
+	return resolved, nil
+}
+
+// flowResolver accumulates the nodes and templates of a document and its imports
+type flowResolver struct {
+	resolver  ImportResolver
+	nodes     map[string]sourcedNode
+	templates map[string]sourcedNode
+	loaded    map[string]bool
+}
+
+// load parses one document and merges it and its imports into the resolver.
+// chain holds the import path leading to this document for cycle detection.
+func (r *flowResolver) load(content, source string, chain []string, depth int) (*flowDocument, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return nil, yamlError(source, err)
+	}
+
+	var doc flowDocument
+	if len(root.Content) > 0 {
+		if err := root.Decode(&doc); err != nil {
+			return nil, yamlError(source, err)
+		}
+	}
+
+	chain = append(chain, source)
+	for i, name := range doc.Imports {
+		line, column := importLocation(&root, i)
+		importErr := func(format string, args ...interface{}) error {
+			return &FlowError{Source: source, Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+		}
+
+		if r.resolver == nil {
+			return nil, importErr("cannot import '%s': imports are not available here", name)
+		}
+		if depth >= maxImportDepth {
+			return nil, importErr("cannot import '%s': imports nested deeper than %d levels", name, maxImportDepth)
+		}
+
+		imported, importSource, err := r.resolver.ResolveImport(name)
+		if err != nil {
+			return nil, importErr("cannot import '%s': %v", name, err)
+		}
+		if importSource == "" {
+			importSource = name
+		}
+		for _, ancestor := range chain {
+			if ancestor == importSource {
+				return nil, importErr("import cycle: %s -> %s", strings.Join(chain, " -> "), importSource)
+			}
+		}
+		// Diamond imports are merged once
+		if r.loaded[importSource] {
+			continue
+		}
+		r.loaded[importSource] = true
+
+		if _, err := r.load(imported, importSource, chain, depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	// Templates defined here override imported ones; the importing document wins
+	for _, name := range sortedYAMLNames(doc.NodeTemplates) {
+		node, err := decodeNode(doc.NodeTemplates[name], source)
+		if err != nil {
+			return nil, err
+		}
+		r.templates[name] = node
+	}
+
+	for _, name := range sortedYAMLNames(doc.Nodes) {
+		node, err := decodeNode(doc.Nodes[name], source)
+		if err != nil {
+			return nil, err
+		}
+		if existing, exists := r.nodes[name]; exists {
+			return nil, node.errorf("node '%s' is already defined at %s:%d", name, existing.source, existing.line)
+		}
+		r.nodes[name] = node
+	}
+
+	return &doc, nil
+}
+
+// applyTemplate returns the node definition with its template chain applied
+func (r *flowResolver) applyTemplate(node sourcedNode, seen []string) (plugins.NodeDefinition, error) {
+	definition := node.spec.NodeDefinition
+	if node.spec.Template == "" {
+		return definition, nil
+	}
+
+	for _, name := range seen {
+		if name == node.spec.Template {
+			return definition, node.errorf("node template cycle: %s -> %s", strings.Join(seen, " -> "), name)
+		}
+	}
+
+	template, exists := r.templates[node.spec.Template]
+	if !exists {
+		return definition, node.errorf("unknown node template '%s'", node.spec.Template)
+	}
+
+	base, err := r.applyTemplate(template, append(seen, node.spec.Template))
+	if err != nil {
+		return definition, err
+	}
+	return mergeNodeDefinitions(base, definition), nil
+}
+
+// mergeNodeDefinitions overlays the fields set in override onto base. Params
+// are merged recursively and next actions are merged by action name.
+func mergeNodeDefinitions(base, override plugins.NodeDefinition) plugins.NodeDefinition {
+	merged := base
+	if override.Type != "" {
+		merged.Type = override.Type
+	}
+	if override.Params != nil {
+		merged.Params = mergeParams(base.Params, override.Params)
+	}
+	if override.Next != nil {
+		next := make(map[string]string, len(base.Next)+len(override.Next))
+		for action, target := range base.Next {
+			next[action] = target
+		}
+		for action, target := range override.Next {
+			next[action] = target
+		}
+		merged.Next = next
+	}
+	if override.Batch != (plugins.BatchDefinition{}) {
+		merged.Batch = override.Batch
+	}
+	if override.Retry != (plugins.RetryDefinition{}) {
+		merged.Retry = override.Retry
+	}
+	if override.Hooks != (plugins.NodeHooks{}) {
+		merged.Hooks = override.Hooks
+	}
+	return merged
+}
+
+func mergeParams(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeParams(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// decodeNode decodes a node or template, resolving anchors and merge keys
+func decodeNode(node yaml.Node, source string) (sourcedNode, error) {
+	target := &node
+	if target.Kind == yaml.AliasNode && target.Alias != nil {
+		target = target.Alias
+	}
+
+	decoded := sourcedNode{source: source, line: node.Line, column: node.Column}
+	if err := node.Decode(&decoded.spec); err != nil {
+		return decoded, yamlError(source, err)
+	}
+	if decoded.line == 0 {
+		decoded.line, decoded.column = target.Line, target.Column
+	}
+	return decoded, nil
+}
+
+// importLocation returns the position of the i-th entry of the imports list
+func importLocation(root *yaml.Node, i int) (int, int) {
+	if len(root.Content) == 0 {
+		return 0, 0
+	}
+	mapping := root.Content[0]
+	for k := 0; k+1 < len(mapping.Content); k += 2 {
+		if mapping.Content[k].Value == "imports" {
+			list := mapping.Content[k+1]
+			if i < len(list.Content) {
+				return list.Content[i].Line, list.Content[i].Column
+			}
+			return list.Line, list.Column
+		}
+	}
+	return 0, 0
+}
+
+// yamlError converts a YAML error into a FlowError for source
+func yamlError(source string, err error) error {
+	message := err.Error()
+	line := 0
+	// yaml.v3 errors look like "yaml: line 3: ..." or "yaml: unmarshal errors:\n  line 3: ..."
+	for _, part := range strings.Split(message, "\n") {
+		part = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part), "yaml:"))
+		if strings.HasPrefix(part, "line ") {
+			if _, scanErr := fmt.Sscanf(part, "line %d:", &line); scanErr == nil {
+				message = strings.TrimSpace(part[strings.Index(part, ":")+1:])
+				break
+			}
+		}
+	}
+	return &FlowError{Source: source, Line: line, Message: "invalid YAML: " + message}
+}
+
+func sortedYAMLNames(nodes map[string]yaml.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedNodeNames(nodes map[string]sourcedNode) []string {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
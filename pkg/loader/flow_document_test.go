@@ -0,0 +1,234 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+)
+
+// recordingNodeFactory creates base nodes and remembers the definitions it was given
+type recordingNodeFactory struct {
+	definitions map[string]plugins.NodeDefinition
+}
+
+func (f *recordingNodeFactory) CreateNode(nodeDef plugins.NodeDefinition) (flowlib.Node, error) {
+	f.definitions[fmt.Sprint(nodeDef.Params["id"])] = nodeDef
+	return (&BaseNodeFactory{}).CreateNode(nodeDef)
+}
+
+func newIncludeLoader(t *testing.T, documents map[string]string) (YAMLLoader, *recordingNodeFactory) {
+	t.Helper()
+	factory := &recordingNodeFactory{definitions: make(map[string]plugins.NodeDefinition)}
+	base := NewYAMLLoader(map[string]plugins.NodeFactory{
+		"test":         factory,
+		"http.request": factory,
+	}, plugins.NewPluginRegistry())
+
+	resolver := ImportResolverFunc(func(name string) (string, string, error) {
+		content, ok := documents[name]
+		if !ok {
+			return "", "", errors.New("flow not found")
+		}
+		return content, name + ".yaml", nil
+	})
+	return base.(ResolvingLoader).WithResolver(resolver), factory
+}
+
+func TestYAMLLoader_ImportsAndTemplates(t *testing.T) {
+	yamlLoader, factory := newIncludeLoader(t, map[string]string{
+		"notify-slack": `
+metadata:
+  name: notify-slack
+node_templates:
+  slack:
+    type: http.request
+    params:
+      method: POST
+      url: https://hooks.slack.example/services/T000
+      headers:
+        Content-Type: application/json
+nodes:
+  notify_slack:
+    template: slack
+    params:
+      id: notify_slack
+      body: "flow failed"
+`,
+	})
+
+	graph, err := yamlLoader.(GraphLoader).ParseGraph(`
+metadata:
+  name: orders
+imports:
+  - notify-slack
+defaults: &defaults
+  retry:
+    max_retries: 2
+    wait: 1s
+nodes:
+  fetch:
+    <<: *defaults
+    type: test
+    params:
+      id: fetch
+    next:
+      error: notify_slack
+      default: alert
+  alert:
+    template: slack
+    params:
+      id: alert
+      url: https://hooks.slack.example/services/T999
+      headers:
+        X-Team: orders
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "fetch", graph.StartNode)
+	assert.Len(t, graph.Nodes, 3)
+
+	// Merge keys are resolved
+	assert.Equal(t, 2, factory.definitions["fetch"].Retry.MaxRetries)
+
+	// Imported nodes are part of the flow
+	assert.Equal(t, "http.request", factory.definitions["notify_slack"].Type)
+	assert.Equal(t, "flow failed", factory.definitions["notify_slack"].Params["body"])
+
+	// Template parameters are merged with overrides
+	alert := factory.definitions["alert"]
+	assert.Equal(t, "http.request", alert.Type)
+	assert.Equal(t, "POST", alert.Params["method"])
+	assert.Equal(t, "https://hooks.slack.example/services/T999", alert.Params["url"])
+	assert.Equal(t, map[string]interface{}{
+		"Content-Type": "application/json",
+		"X-Team":       "orders",
+	}, alert.Params["headers"])
+}
+
+func TestYAMLLoader_ErrorLocations(t *testing.T) {
+	yamlLoader, _ := newIncludeLoader(t, map[string]string{
+		"broken": `metadata:
+  name: broken
+nodes:
+  bad:
+    type: missing
+`,
+		"loop-a": "metadata:\n  name: a\nimports:\n  - loop-b\n",
+		"loop-b": "metadata:\n  name: b\nimports:\n  - loop-a\n",
+	})
+
+	tests := []struct {
+		name   string
+		yaml   string
+		source string
+		line   int
+	}{
+		{
+			name: "unknown type in imported flow",
+			yaml: `metadata:
+  name: main
+imports:
+  - broken
+nodes:
+  start:
+    type: test
+    next:
+      default: bad
+`,
+			source: "broken.yaml",
+			line:   5,
+		},
+		{
+			name: "unknown template",
+			yaml: `metadata:
+  name: main
+nodes:
+  start:
+    template: nothing
+`,
+			source: "flow",
+			line:   5,
+		},
+		{
+			name: "missing import",
+			yaml: `metadata:
+  name: main
+imports:
+  - nowhere
+nodes:
+  start:
+    type: test
+`,
+			source: "flow",
+			line:   4,
+		},
+		{
+			name: "import cycle",
+			yaml: `metadata:
+  name: main
+imports:
+  - loop-a
+nodes:
+  start:
+    type: test
+`,
+			source: "loop-b.yaml",
+			line:   4,
+		},
+		{
+			name: "invalid reference",
+			yaml: `metadata:
+  name: main
+nodes:
+  start:
+    type: test
+    next:
+      default: nowhere
+`,
+			source: "flow",
+			line:   5,
+		},
+		{
+			name:   "syntax error",
+			yaml:   "metadata:\n  name: main\nnodes:\n  start: [\n",
+			source: "flow",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, err := range []error{yamlLoader.Validate(tt.yaml), parseError(yamlLoader, tt.yaml)} {
+				var flowErr *FlowError
+				require.True(t, errors.As(err, &flowErr), "expected FlowError, got %v", err)
+				assert.Equal(t, tt.source, flowErr.Source)
+				if tt.line > 0 {
+					assert.Equal(t, tt.line, flowErr.Line, flowErr.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestYAMLLoader_ImportsRequireResolver(t *testing.T) {
+	yamlLoader := NewYAMLLoader(map[string]plugins.NodeFactory{"test": &BaseNodeFactory{}}, plugins.NewPluginRegistry())
+
+	err := yamlLoader.Validate(`
+metadata:
+  name: main
+imports:
+  - shared
+nodes:
+  start:
+    type: test
+`)
+	assert.ErrorContains(t, err, "cannot import 'shared'")
+}
+
+func parseError(yamlLoader YAMLLoader, content string) error {
+	_, err := yamlLoader.Parse(content)
+	return err
+}
@@ -25,6 +25,31 @@ type YAMLLoader interface {
 	Validate(yamlContent string) error
 }
 
+// GraphLoader is implemented by loaders that can expose the named nodes of a parsed flow
+type GraphLoader interface {
+	// ParseGraph converts a YAML string into a Flowlib graph with its nodes addressable by name
+	ParseGraph(yamlContent string) (*FlowGraph, error)
+}
+
+// FlowGraph is a parsed flow together with the nodes it was built from
+type FlowGraph struct {
+	// Flow is the executable Flowlib graph
+	Flow *flowlib.Flow
+
+	// Nodes maps node names from the flow definition to their instances
+	Nodes map[string]flowlib.Node
+
+	// StartNode is the name of the node the flow starts at. It is empty when
+	// the flow only has named entry points and none of them is the default.
+	StartNode string
+
+	// Entrypoints maps entry point names to the nodes they start at
+	Entrypoints map[string]string
+
+	// Metadata is the metadata of the flow definition
+	Metadata FlowMetadata
+}
+
 // FlowDefinition represents a parsed flow definition from YAML
 type FlowDefinition struct {
 	// Metadata about the flow
@@ -32,6 +57,10 @@ type FlowDefinition struct {
 
 	// Nodes in the flow
 	Nodes map[string]plugins.NodeDefinition `yaml:"nodes" json:"nodes"`
+
+	// Entrypoints maps entry point names (e.g. "on_email", "on_http") to the
+	// node execution starts at when the flow is triggered through them
+	Entrypoints map[string]string `yaml:"entrypoints" json:"entrypoints,omitempty"`
 }
 
 // FlowMetadata contains information about the flow
@@ -44,4 +73,17 @@ type FlowMetadata struct {
 
 	// Version of the flow
 	Version string `yaml:"version" json:"version"`
+
+	// Start names the node execution starts at when no entry point is given.
+	// Without it the start is the single node no other node links to.
+	Start string `yaml:"start" json:"start,omitempty"`
+
+	// InputSchema is a JSON schema describing the input the flow expects.
+	// It is advertised to MCP clients calling the flow as a tool.
+	InputSchema map[string]interface{} `yaml:"input_schema" json:"input_schema,omitempty"`
+
+	// LLMCache is the response cache setting of the flow's llm nodes: true,
+	// false, or a map with enabled, mode and ttl. The cache param of a node
+	// takes precedence.
+	LLMCache interface{} `yaml:"llm_cache" json:"llm_cache,omitempty"`
 }
@@ -20,6 +20,12 @@ const FlowSchema = `
         },
         "version": {
           "type": "string"
+        },
+        "input_schema": {
+          "type": "object"
+        },
+        "llm_cache": {
+          "type": ["boolean", "object"]
         }
       }
     },
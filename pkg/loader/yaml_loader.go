@@ -2,61 +2,82 @@ package loader
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/tcmartin/flowlib"
 	"github.com/tcmartin/flowrunner/pkg/plugins"
-	"gopkg.in/yaml.v2"
 )
 
 // DefaultYAMLLoader implements the YAMLLoader interface
 type DefaultYAMLLoader struct {
-	nodeFactories    map[string]plugins.NodeFactory
+	nodeFactories  map[string]plugins.NodeFactory
 	pluginRegistry plugins.PluginRegistry
+	importResolver ImportResolver
 }
 
 // NewYAMLLoader creates a new YAML loader
 func NewYAMLLoader(nodeFactories map[string]plugins.NodeFactory, pluginRegistry plugins.PluginRegistry) YAMLLoader {
 	return &DefaultYAMLLoader{
-		nodeFactories:    nodeFactories,
+		nodeFactories:  nodeFactories,
 		pluginRegistry: pluginRegistry,
 	}
 }
 
+// WithResolver returns a copy of the loader that resolves imports with resolver
+func (l *DefaultYAMLLoader) WithResolver(resolver ImportResolver) YAMLLoader {
+	return &DefaultYAMLLoader{
+		nodeFactories:  l.nodeFactories,
+		pluginRegistry: l.pluginRegistry,
+		importResolver: resolver,
+	}
+}
+
 // Parse converts a YAML string into a Flowlib graph
 func (l *DefaultYAMLLoader) Parse(yamlContent string) (*flowlib.Flow, error) {
-	// First validate the YAML
-	if err := l.Validate(yamlContent); err != nil {
+	graph, err := l.ParseGraph(yamlContent)
+	if err != nil {
 		return nil, err
 	}
+	if graph.Flow == nil {
+		return nil, fmt.Errorf("flow has no default start node; it must be run through one of its entry points: %s", strings.Join(entrypointNames(graph.Entrypoints), ", "))
+	}
+	return graph.Flow, nil
+}
 
-	var flowDef FlowDefinition
-	if err := yaml.Unmarshal([]byte(yamlContent), &flowDef); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+// ParseGraph converts a YAML string into a Flowlib graph and keeps the node names
+func (l *DefaultYAMLLoader) ParseGraph(yamlContent string) (*FlowGraph, error) {
+	// First resolve and validate the YAML
+	resolved, err := l.resolve(yamlContent)
+	if err != nil {
+		return nil, err
 	}
+	flowDef := resolved.definition
 
 	// Create all the nodes
 	nodes := make(map[string]flowlib.Node)
 	for nodeName, nodeDef := range flowDef.Nodes {
+		location := resolved.nodes[nodeName]
 		factory, exists := l.nodeFactories[nodeDef.Type]
 		if !exists {
 			// If the node type is not in the built-in factories, try the plugin registry
 			plugin, err := l.pluginRegistry.Get(nodeDef.Type)
 			if err != nil {
-				return nil, fmt.Errorf("unknown node type '%s' in node '%s'", nodeDef.Type, nodeName)
+				return nil, location.errorf("unknown node type '%s' in node '%s'", nodeDef.Type, nodeName)
 			}
 			nodePlugin, ok := plugin.(plugins.NodePlugin)
 			if !ok {
-				return nil, fmt.Errorf("plugin '%s' is not a valid NodePlugin", nodeDef.Type)
+				return nil, location.errorf("plugin '%s' is not a valid NodePlugin", nodeDef.Type)
 			}
 			node, err := nodePlugin.CreateNode(nodeDef.Params)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create node '%s' from plugin: %w", nodeName, err)
+				return nil, location.errorf("failed to create node '%s' from plugin: %v", nodeName, err)
 			}
 			nodes[nodeName] = node
 		} else {
 			node, err := factory.CreateNode(nodeDef)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create node '%s': %w", nodeName, err)
+				return nil, location.errorf("failed to create node '%s': %v", nodeName, err)
 			}
 			nodes[nodeName] = node
 		}
@@ -74,54 +95,99 @@ func (l *DefaultYAMLLoader) Parse(yamlContent string) (*flowlib.Flow, error) {
 		}
 	}
 
-	// Find the start node (the one not referenced by any other node)
-	startNode, err := findStartNode(flowDef, nodes)
+	// Find the start node (explicit, default entry point, or the one not referenced by any other node)
+	startNodeName, err := findStartNode(flowDef)
 	if err != nil {
 		return nil, err
 	}
 
-	return flowlib.NewFlow(startNode), nil
+	graph := &FlowGraph{
+		Nodes:       nodes,
+		StartNode:   startNodeName,
+		Entrypoints: flowDef.Entrypoints,
+		Metadata:    flowDef.Metadata,
+	}
+	if startNodeName != "" {
+		graph.Flow = flowlib.NewFlow(nodes[startNodeName])
+	}
+	return graph, nil
 }
 
 // Validate checks if a YAML string conforms to the schema
 func (l *DefaultYAMLLoader) Validate(yamlContent string) error {
-	// Basic YAML validation
-	var flowDef FlowDefinition
-	if err := yaml.Unmarshal([]byte(yamlContent), &flowDef); err != nil {
-		return fmt.Errorf("invalid YAML: %w", err)
+	_, err := l.resolve(yamlContent)
+	return err
+}
+
+// resolve applies imports and node templates and validates the resulting flow
+func (l *DefaultYAMLLoader) resolve(yamlContent string) (*resolvedFlow, error) {
+	resolved, err := resolveFlow(yamlContent, l.importResolver)
+	if err != nil {
+		return nil, err
 	}
+	flowDef := resolved.definition
 
 	// Basic validation checks
 	if flowDef.Metadata.Name == "" {
-		return fmt.Errorf("flow name is required")
+		return nil, &FlowError{Source: mainSource, Message: "flow name is required"}
 	}
 
 	if len(flowDef.Nodes) == 0 {
-		return fmt.Errorf("flow must have at least one node")
+		return nil, &FlowError{Source: mainSource, Message: "flow must have at least one node"}
 	}
 
 	// Validate node types exist in factories or plugin registry
-	for nodeName, nodeDef := range flowDef.Nodes {
+	for _, nodeName := range sortedNodeNames(resolved.nodes) {
+		nodeDef := flowDef.Nodes[nodeName]
 		if _, exists := l.nodeFactories[nodeDef.Type]; !exists {
 			if _, err := l.pluginRegistry.Get(nodeDef.Type); err != nil {
-				return fmt.Errorf("unknown node type '%s' in node '%s'", nodeDef.Type, nodeName)
+				return nil, resolved.nodes[nodeName].errorf("unknown node type '%s' in node '%s'", nodeDef.Type, nodeName)
 			}
 		}
 	}
 
 	// Validate node references
-	for nodeName, nodeDef := range flowDef.Nodes {
-		for action, nextNode := range nodeDef.Next {
+	for _, nodeName := range sortedNodeNames(resolved.nodes) {
+		for action, nextNode := range flowDef.Nodes[nodeName].Next {
 			if _, exists := flowDef.Nodes[nextNode]; !exists {
-				return fmt.Errorf("node '%s' references non-existent node '%s' for action '%s'", nodeName, nextNode, action)
+				return nil, resolved.nodes[nodeName].errorf("node '%s' references non-existent node '%s' for action '%s'", nodeName, nextNode, action)
 			}
 		}
 	}
 
-	return nil
+	// Validate the explicit start node and entry points
+	if start := flowDef.Metadata.Start; start != "" {
+		if _, exists := flowDef.Nodes[start]; !exists {
+			return nil, &FlowError{Source: mainSource, Message: fmt.Sprintf("start node '%s' does not exist", start)}
+		}
+	}
+	for _, name := range entrypointNames(flowDef.Entrypoints) {
+		if _, exists := flowDef.Nodes[flowDef.Entrypoints[name]]; !exists {
+			return nil, &FlowError{Source: mainSource, Message: fmt.Sprintf("entry point '%s' references non-existent node '%s'", name, flowDef.Entrypoints[name])}
+		}
+	}
+
+	return resolved, nil
 }
 
-func findStartNode(flowDef FlowDefinition, nodes map[string]flowlib.Node) (flowlib.Node, error) {
+// findStartNode returns the node a flow starts at when no entry point is
+// given. It is empty for flows with several entry points and no default.
+func findStartNode(flowDef FlowDefinition) (string, error) {
+	if flowDef.Metadata.Start != "" {
+		return flowDef.Metadata.Start, nil
+	}
+	if start, ok := flowDef.Entrypoints["default"]; ok {
+		return start, nil
+	}
+	if len(flowDef.Entrypoints) == 1 {
+		for _, start := range flowDef.Entrypoints {
+			return start, nil
+		}
+	}
+	if len(flowDef.Entrypoints) > 1 {
+		return "", nil
+	}
+
 	referencedNodes := make(map[string]bool)
 	for _, nodeDef := range flowDef.Nodes {
 		for _, nextNodeName := range nodeDef.Next {
@@ -133,15 +199,25 @@ func findStartNode(flowDef FlowDefinition, nodes map[string]flowlib.Node) (flowl
 	for nodeName := range flowDef.Nodes {
 		if !referencedNodes[nodeName] {
 			if startNodeName != "" {
-				return nil, fmt.Errorf("multiple start nodes found: '%s' and '%s'", startNodeName, nodeName)
+				return "", fmt.Errorf("multiple start nodes found: '%s' and '%s'", startNodeName, nodeName)
 			}
 			startNodeName = nodeName
 		}
 	}
 
 	if startNodeName == "" {
-		return nil, fmt.Errorf("no start node found")
+		return "", fmt.Errorf("no start node found")
 	}
 
-	return nodes[startNodeName], nil
+	return startNodeName, nil
+}
+
+// entrypointNames returns the sorted names of a flow's entry points
+func entrypointNames(entrypoints map[string]string) []string {
+	names := make([]string, 0, len(entrypoints))
+	for name := range entrypoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
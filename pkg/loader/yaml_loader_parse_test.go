@@ -178,4 +178,100 @@ nodes:
 	assert.Error(t, err)
 	assert.Nil(t, flow)
 	assert.Contains(t, err.Error(), "multiple start nodes found")
-}
\ No newline at end of file
+}
+func TestYAMLLoader_Parse_ExplicitStartNode(t *testing.T) {
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{
+		"base": &loader.BaseNodeFactory{},
+	}, plugins.NewPluginRegistry())
+
+	// The last node loops back to the first, so no start can be inferred
+	graph, err := yamlLoader.(loader.GraphLoader).ParseGraph(`
+metadata:
+  name: loop
+  start: poll
+nodes:
+  poll:
+    type: base
+    next:
+      default: wait
+  wait:
+    type: base
+    next:
+      default: poll
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, "poll", graph.StartNode)
+	assert.NotNil(t, graph.Flow)
+
+	err = yamlLoader.Validate(`
+metadata:
+  name: loop
+  start: missing
+nodes:
+  poll:
+    type: base
+`)
+	assert.ErrorContains(t, err, "start node 'missing' does not exist")
+}
+
+func TestYAMLLoader_Parse_Entrypoints(t *testing.T) {
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{
+		"base": &loader.BaseNodeFactory{},
+	}, plugins.NewPluginRegistry())
+
+	yamlContent := `
+metadata:
+  name: triggers
+entrypoints:
+  on_email: parse_email
+  on_http: parse_request
+nodes:
+  parse_email:
+    type: base
+    next:
+      default: handle
+  parse_request:
+    type: base
+    next:
+      default: handle
+  handle:
+    type: base
+`
+
+	graph, err := yamlLoader.(loader.GraphLoader).ParseGraph(yamlContent)
+	assert.NoError(t, err)
+	assert.Empty(t, graph.StartNode)
+	assert.Nil(t, graph.Flow)
+	assert.Equal(t, map[string]string{"on_email": "parse_email", "on_http": "parse_request"}, graph.Entrypoints)
+
+	// Without a default entry point the flow cannot be run as a whole
+	_, err = yamlLoader.Parse(yamlContent)
+	assert.ErrorContains(t, err, "on_email, on_http")
+
+	// A default entry point is used as the start node
+	graph, err = yamlLoader.(loader.GraphLoader).ParseGraph(`
+metadata:
+  name: triggers
+entrypoints:
+  default: parse_request
+  on_email: parse_email
+nodes:
+  parse_email:
+    type: base
+  parse_request:
+    type: base
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, "parse_request", graph.StartNode)
+
+	err = yamlLoader.Validate(`
+metadata:
+  name: triggers
+entrypoints:
+  on_email: nowhere
+nodes:
+  parse_email:
+    type: base
+`)
+	assert.ErrorContains(t, err, "entry point 'on_email' references non-existent node 'nowhere'")
+}
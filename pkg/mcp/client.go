@@ -0,0 +1,355 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// NotificationHandler receives notifications the server sends
+type NotificationHandler func(method string, params json.RawMessage)
+
+// Client is an MCP client session over a transport
+type Client struct {
+	transport Transport
+	info      Implementation
+	nextID    atomic.Int64
+
+	mu       sync.Mutex
+	pending  map[string]chan *Message
+	progress map[string]ProgressHandler
+	handlers []NotificationHandler
+	server   *InitializeResult
+
+	// Cached list results; nil when not fetched or invalidated. The
+	// generations count change notifications.
+	cacheMu      sync.Mutex
+	tools        []Tool
+	toolsGen     int
+	resources    []Resource
+	resourcesGen int
+	prompts      []Prompt
+	promptsGen   int
+
+	done chan struct{}
+}
+
+// NewClient starts a client session over transport. Call Initialize before
+// using it.
+func NewClient(transport Transport, info Implementation) *Client {
+	c := &Client{
+		transport: transport,
+		info:      info,
+		pending:   make(map[string]chan *Message),
+		progress:  make(map[string]ProgressHandler),
+		done:      make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Initialize performs the initialize handshake and negotiates the protocol version
+func (c *Client) Initialize(ctx context.Context) (*InitializeResult, error) {
+	var result InitializeResult
+	err := c.call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      c.info,
+	}, &result, nil)
+	if err != nil {
+		return nil, fmt.Errorf("MCP initialize failed: %w", err)
+	}
+
+	supported := false
+	for _, version := range supportedProtocolVersions {
+		if result.ProtocolVersion == version {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("MCP server speaks unsupported protocol version %q", result.ProtocolVersion)
+	}
+
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.server = &result
+	c.mu.Unlock()
+	return &result, nil
+}
+
+// ServerInfo returns the server's handshake result, or nil before Initialize
+func (c *Client) ServerInfo() *InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// OnNotification registers a handler for server notifications
+func (c *Client) OnNotification(handler NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// Done is closed when the connection to the server ends
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Closed reports whether the connection to the server has ended
+func (c *Client) Closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close ends the session
+func (c *Client) Close() error {
+	err := c.transport.Close()
+	<-c.done
+	return err
+}
+
+// Ping checks that the server is responsive
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, "ping", nil, nil, nil)
+}
+
+// ListTools returns the server's tools, cached until the server reports a change
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	return cachedList(ctx, c, &c.tools, &c.toolsGen, "tools/list", func(page *listToolsResult) ([]Tool, string) {
+		return page.Tools, page.NextCursor
+	})
+}
+
+// ListResources returns the server's resources, cached until the server reports a change
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	return cachedList(ctx, c, &c.resources, &c.resourcesGen, "resources/list", func(page *listResourcesResult) ([]Resource, string) {
+		return page.Resources, page.NextCursor
+	})
+}
+
+// ListPrompts returns the server's prompts, cached until the server reports a change
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	return cachedList(ctx, c, &c.prompts, &c.promptsGen, "prompts/list", func(page *listPromptsResult) ([]Prompt, string) {
+		return page.Prompts, page.NextCursor
+	})
+}
+
+// cachedList returns the cached list in slot or fetches all its pages. The
+// result is only cached when no change notification arrived meanwhile.
+func cachedList[T any, P any](ctx context.Context, c *Client, slot *[]T, generation *int, method string, items func(*P) ([]T, string)) ([]T, error) {
+	c.cacheMu.Lock()
+	cached, gen := *slot, *generation
+	c.cacheMu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	all := []T{}
+	cursor := ""
+	for {
+		var page P
+		if err := c.call(ctx, method, paginatedParams{Cursor: cursor}, &page, nil); err != nil {
+			return nil, err
+		}
+		pageItems, next := items(&page)
+		all = append(all, pageItems...)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+
+	c.cacheMu.Lock()
+	if *generation == gen {
+		*slot = all
+	}
+	c.cacheMu.Unlock()
+	return all, nil
+}
+
+// CallTool invokes a tool. onProgress, when set, receives progress
+// notifications for the call.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}, onProgress ProgressHandler) (*CallToolResult, error) {
+	var result CallToolResult
+	params := CallToolParams{Name: name, Arguments: arguments}
+	if err := c.call(ctx, "tools/call", &params, &result, onProgress); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ReadResource returns the contents of a resource
+func (c *Client) ReadResource(ctx context.Context, uri string) (*ReadResourceResult, error) {
+	var result ReadResourceResult
+	if err := c.call(ctx, "resources/read", ReadResourceParams{URI: uri}, &result, nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetPrompt renders a prompt with the given arguments
+func (c *Client) GetPrompt(ctx context.Context, name string, arguments map[string]string) (*GetPromptResult, error) {
+	var result GetPromptResult
+	if err := c.call(ctx, "prompts/get", GetPromptParams{Name: name, Arguments: arguments}, &result, nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// call sends a request and decodes its result. Progress notifications for the
+// request are passed to onProgress.
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}, onProgress ProgressHandler) error {
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	rawID := json.RawMessage(id)
+
+	if onProgress != nil {
+		if callParams, ok := params.(*CallToolParams); ok {
+			callParams.Meta = &RequestMeta{ProgressToken: id}
+		}
+	}
+
+	msg, err := newRequest(rawID, method, params)
+	if err != nil {
+		return err
+	}
+
+	response := make(chan *Message, 1)
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	c.pending[id] = response
+	if onProgress != nil {
+		c.progress[id] = onProgress
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		delete(c.progress, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.transport.Send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case reply := <-response:
+		if reply == nil {
+			return ErrClosed
+		}
+		if reply.Error != nil {
+			return reply.Error
+		}
+		if result != nil && len(reply.Result) > 0 {
+			if err := json.Unmarshal(reply.Result, result); err != nil {
+				return fmt.Errorf("failed to decode %s result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		// Let the server stop working on the abandoned request
+		c.notify(context.Background(), "notifications/cancelled", cancelledParams{RequestID: rawID, Reason: ctx.Err().Error()})
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	msg, err := newRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return c.transport.Send(ctx, msg)
+}
+
+// readLoop dispatches messages from the server until the transport closes
+func (c *Client) readLoop() {
+	defer func() {
+		c.mu.Lock()
+		close(c.done)
+		for id, response := range c.pending {
+			close(response)
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	for msg := range c.transport.Messages() {
+		switch {
+		case msg.IsResponse():
+			c.mu.Lock()
+			response, ok := c.pending[strings.Trim(string(msg.ID), `"`)]
+			c.mu.Unlock()
+			if ok {
+				response <- msg
+			}
+		case msg.IsNotification():
+			c.handleNotification(msg)
+		case msg.IsRequest():
+			go c.handleRequest(msg)
+		}
+	}
+}
+
+func (c *Client) handleNotification(msg *Message) {
+	switch msg.Method {
+	case "notifications/progress":
+		var progress ProgressParams
+		if err := json.Unmarshal(msg.Params, &progress); err == nil {
+			c.mu.Lock()
+			handler := c.progress[fmt.Sprint(progress.ProgressToken)]
+			c.mu.Unlock()
+			if handler != nil {
+				handler(progress)
+			}
+		}
+	case "notifications/tools/list_changed":
+		c.cacheMu.Lock()
+		c.tools, c.toolsGen = nil, c.toolsGen+1
+		c.cacheMu.Unlock()
+	case "notifications/resources/list_changed":
+		c.cacheMu.Lock()
+		c.resources, c.resourcesGen = nil, c.resourcesGen+1
+		c.cacheMu.Unlock()
+	case "notifications/prompts/list_changed":
+		c.cacheMu.Lock()
+		c.prompts, c.promptsGen = nil, c.promptsGen+1
+		c.cacheMu.Unlock()
+	}
+
+	c.mu.Lock()
+	handlers := append([]NotificationHandler(nil), c.handlers...)
+	c.mu.Unlock()
+	for _, handler := range handlers {
+		handler(msg.Method, msg.Params)
+	}
+}
+
+// handleRequest answers requests the server sends to the client
+func (c *Client) handleRequest(msg *Message) {
+	var reply *Message
+	switch msg.Method {
+	case "ping":
+		reply = newResult(msg.ID, struct{}{})
+	default:
+		reply = newError(msg.ID, CodeMethodNotFound, "method not supported by client: "+msg.Method)
+	}
+	c.transport.Send(context.Background(), reply)
+}
@@ -0,0 +1,300 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tcmartin/flowrunner/pkg/mcp"
+	"github.com/tcmartin/flowrunner/pkg/mcp/mcptest"
+)
+
+var clientInfo = mcp.Implementation{Name: "test-client", Version: "1.0.0"}
+
+// pipeTransport connects a client to a server in the same process. Tests can
+// inject server messages with push.
+type pipeTransport struct {
+	w        io.WriteCloser
+	messages chan *mcp.Message
+	mu       sync.Mutex
+}
+
+func newPipeTransport(server *mcp.Server) *pipeTransport {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go func() {
+		server.ServeStdio(context.Background(), serverR, serverW)
+		serverW.Close()
+	}()
+
+	transport := &pipeTransport{w: clientW, messages: make(chan *mcp.Message, 16)}
+	go func() {
+		defer close(transport.messages)
+		scanner := bufio.NewScanner(clientR)
+		for scanner.Scan() {
+			var msg mcp.Message
+			if json.Unmarshal(scanner.Bytes(), &msg) == nil {
+				transport.messages <- &msg
+			}
+		}
+	}()
+	return transport
+}
+
+func (p *pipeTransport) Send(ctx context.Context, msg *mcp.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(append(data, '\n'))
+	return err
+}
+
+func (p *pipeTransport) Messages() <-chan *mcp.Message { return p.messages }
+
+func (p *pipeTransport) Close() error { return p.w.Close() }
+
+func (p *pipeTransport) push(method string) {
+	p.messages <- &mcp.Message{JSONRPC: "2.0", Method: method}
+}
+
+// countingHandler counts the JSON-RPC methods POSTed to an HTTP server
+type countingHandler struct {
+	next  http.Handler
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, _ := io.ReadAll(r.Body)
+		var msg mcp.Message
+		if json.Unmarshal(body, &msg) == nil {
+			h.mu.Lock()
+			h.calls[msg.Method]++
+			h.mu.Unlock()
+		}
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+func (h *countingHandler) count(method string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls[method]
+}
+
+func TestClient_StreamableHTTP(t *testing.T) {
+	counter := &countingHandler{next: mcptest.NewServer(), calls: map[string]int{}}
+	server := httptest.NewServer(counter)
+	defer server.Close()
+
+	client := mcp.NewClient(mcp.NewStreamableHTTPTransport(server.URL, nil), clientInfo)
+	defer client.Close()
+
+	ctx := context.Background()
+	result, err := client.Initialize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, mcp.ProtocolVersion, result.ProtocolVersion)
+	assert.Equal(t, "fake-mcp-server", result.ServerInfo.Name)
+	assert.NotNil(t, result.Capabilities.Resources)
+	assert.NotNil(t, result.Capabilities.Prompts)
+	assert.Equal(t, 1, counter.count("notifications/initialized"))
+
+	// Lists are fetched once and then served from the cache
+	for i := 0; i < 3; i++ {
+		tools, err := client.ListTools(ctx)
+		require.NoError(t, err)
+		assert.Len(t, tools, 5)
+	}
+	assert.Equal(t, 1, counter.count("tools/list"))
+
+	call, err := client.CallTool(ctx, "add", map[string]interface{}{"a": 1, "b": 2}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"sum": float64(3)}, call.StructuredContent)
+
+	var progress []mcp.ProgressParams
+	call, err = client.CallTool(ctx, "slow", map[string]interface{}{"steps": 3}, func(p mcp.ProgressParams) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+	require.Len(t, progress, 3)
+	assert.Equal(t, float64(3), progress[2].Progress)
+	assert.Equal(t, float64(3), progress[2].Total)
+	assert.Equal(t, "step 3", progress[2].Message)
+
+	call, err = client.CallTool(ctx, "fail", nil, nil)
+	require.NoError(t, err)
+	assert.True(t, call.IsError)
+	assert.Equal(t, "tool failed on purpose", call.Content[0].Text)
+
+	_, err = client.CallTool(ctx, "missing", nil, nil)
+	var rpcErr *mcp.Error
+	require.True(t, errors.As(err, &rpcErr), "%v", err)
+	assert.Equal(t, mcp.CodeInvalidParams, rpcErr.Code)
+
+	require.NoError(t, client.Ping(ctx))
+}
+
+func TestClient_SSE(t *testing.T) {
+	server := httptest.NewServer(mcptest.NewServer())
+	defer server.Close()
+
+	ctx := context.Background()
+	transport, err := mcp.NewSSETransport(ctx, server.URL+"/sse", nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(transport, clientInfo)
+
+	_, err = client.Initialize(ctx)
+	require.NoError(t, err)
+
+	resource, err := client.ReadResource(ctx, "fake://greeting")
+	require.NoError(t, err)
+	assert.Equal(t, "hello from the fake server", resource.Contents[0].Text)
+
+	prompt, err := client.GetPrompt(ctx, "greet", map[string]string{"name": "Ada"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, Ada!", prompt.Messages[0].Content.Text)
+
+	var progressCalls atomic.Int32
+	_, err = client.CallTool(ctx, "slow", map[string]interface{}{"steps": 2}, func(mcp.ProgressParams) {
+		progressCalls.Add(1)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), progressCalls.Load())
+
+	require.NoError(t, client.Close())
+	assert.True(t, client.Closed())
+	assert.ErrorIs(t, client.Ping(ctx), mcp.ErrClosed)
+}
+
+func TestClient_ListChangedInvalidatesCache(t *testing.T) {
+	transport := newPipeTransport(mcptest.NewServer())
+	client := mcp.NewClient(transport, clientInfo)
+	defer client.Close()
+
+	ctx := context.Background()
+	_, err := client.Initialize(ctx)
+	require.NoError(t, err)
+
+	notified := make(chan string, 1)
+	client.OnNotification(func(method string, params json.RawMessage) {
+		notified <- method
+	})
+
+	first, err := client.ListPrompts(ctx)
+	require.NoError(t, err)
+	cached, err := client.ListPrompts(ctx)
+	require.NoError(t, err)
+	assert.Same(t, &first[0], &cached[0])
+
+	transport.push("notifications/prompts/list_changed")
+	select {
+	case method := <-notified:
+		assert.Equal(t, "notifications/prompts/list_changed", method)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not delivered")
+	}
+
+	refreshed, err := client.ListPrompts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first, refreshed)
+	assert.NotSame(t, &first[0], &refreshed[0])
+}
+
+func TestClient_CancelledCallKeepsSession(t *testing.T) {
+	transport := newPipeTransport(mcptest.NewServer())
+	client := mcp.NewClient(transport, clientInfo)
+	defer client.Close()
+
+	_, err := client.Initialize(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+	_, err = client.CallTool(ctx, "slow", map[string]interface{}{"steps": 1000}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The session stays usable after the cancellation
+	require.NoError(t, client.Ping(context.Background()))
+}
+
+func TestManager_PoolsStdioSessions(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "fake-mcp-server")
+	output, err := exec.Command("go", "build", "-o", binary, "github.com/tcmartin/flowrunner/cmd/fake-mcp-server").CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	manager := mcp.NewManager(mcp.ManagerConfig{ClientInfo: clientInfo})
+	defer manager.Close()
+
+	ctx := context.Background()
+	config := mcp.ServerConfig{Transport: mcp.TransportStdio, Command: binary}
+
+	whoami := func(client *mcp.Client) map[string]interface{} {
+		result, err := client.CallTool(ctx, "whoami", nil, nil)
+		require.NoError(t, err)
+		return result.StructuredContent.(map[string]interface{})
+	}
+
+	// Concurrent callers share one dial
+	clients := make([]*mcp.Client, 4)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := manager.Get(ctx, config)
+			assert.NoError(t, err)
+			clients[i] = client
+		}(i)
+	}
+	wg.Wait()
+	for _, client := range clients {
+		assert.Same(t, clients[0], client)
+	}
+
+	first := whoami(clients[0])
+	again, err := manager.Get(ctx, config)
+	require.NoError(t, err)
+	second := whoami(again)
+	assert.Equal(t, first["pid"], second["pid"])
+	assert.Equal(t, float64(2), second["calls"])
+
+	// A dead session is replaced by a new server process
+	require.NoError(t, again.Close())
+	fresh, err := manager.Get(ctx, config)
+	require.NoError(t, err)
+	assert.NotSame(t, again, fresh)
+	third := whoami(fresh)
+	assert.NotEqual(t, first["pid"], third["pid"])
+	assert.Equal(t, float64(1), third["calls"])
+}
+
+func TestManager_ReportsDialErrors(t *testing.T) {
+	manager := mcp.NewManager(mcp.ManagerConfig{})
+	defer manager.Close()
+
+	_, err := manager.Get(context.Background(), mcp.ServerConfig{Transport: "carrier-pigeon", URL: "http://example.com"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported transport")
+
+	_, err = manager.Get(context.Background(), mcp.ServerConfig{Transport: mcp.TransportStdio, Command: "/nonexistent/mcp-server"})
+	require.Error(t, err)
+}
@@ -0,0 +1,225 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Transport names accepted in ServerConfig
+const (
+	TransportStdio = "stdio"
+	TransportSSE   = "sse"
+	TransportHTTP  = "http"
+)
+
+// ServerConfig identifies an MCP server. Sessions are pooled per distinct config.
+type ServerConfig struct {
+	// Transport is stdio, sse (HTTP+SSE) or http (streamable HTTP)
+	Transport string `json:"transport"`
+
+	// Command, Args and Env start a stdio server
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Env     []string `json:"env,omitempty"`
+
+	// URL and Headers reach an HTTP server
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// key identifies the config in the pool
+func (c ServerConfig) key() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// ManagerConfig configures a Manager
+type ManagerConfig struct {
+	// ClientInfo is sent to servers during the handshake
+	ClientInfo Implementation
+
+	// IdleTimeout closes sessions unused for this long; zero keeps them open
+	IdleTimeout time.Duration
+}
+
+// Manager keeps MCP client sessions alive across executions
+type Manager struct {
+	config ManagerConfig
+
+	mu       sync.Mutex
+	sessions map[string]*pooledSession
+	closed   bool
+}
+
+// pooledSession is a session being dialed or ready. ready is closed once
+// client or err is set.
+type pooledSession struct {
+	ready    chan struct{}
+	client   *Client
+	err      error
+	lastUsed time.Time
+}
+
+// NewManager creates a session pool
+func NewManager(config ManagerConfig) *Manager {
+	if config.ClientInfo.Name == "" {
+		config.ClientInfo = Implementation{Name: "flowrunner", Version: "1.0.0"}
+	}
+	return &Manager{
+		config:   config,
+		sessions: make(map[string]*pooledSession),
+	}
+}
+
+var (
+	defaultManager     *Manager
+	defaultManagerOnce sync.Once
+)
+
+// DefaultManager returns the process-wide session pool
+func DefaultManager() *Manager {
+	defaultManagerOnce.Do(func() {
+		defaultManager = NewManager(ManagerConfig{IdleTimeout: 10 * time.Minute})
+	})
+	return defaultManager
+}
+
+// Get returns an initialized session for the server, reusing a live one when
+// possible. Concurrent calls for the same server share a single dial.
+func (m *Manager) Get(ctx context.Context, config ServerConfig) (*Client, error) {
+	key := config.key()
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClosed
+	}
+	m.pruneLocked()
+
+	session, ok := m.sessions[key]
+	if ok {
+		select {
+		case <-session.ready:
+			if session.err != nil || session.client.Closed() {
+				// Dead or failed sessions are dialed again
+				delete(m.sessions, key)
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		session = &pooledSession{ready: make(chan struct{})}
+		m.sessions[key] = session
+		go m.dial(key, session, config)
+	}
+	session.lastUsed = time.Now()
+	m.mu.Unlock()
+
+	select {
+	case <-session.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if session.err != nil {
+		return nil, session.err
+	}
+	return session.client, nil
+}
+
+// dial connects and initializes a session. It is not bound to the context of
+// the caller that triggered it since the session outlives that call.
+func (m *Manager) dial(key string, session *pooledSession, config ServerConfig) {
+	defer close(session.ready)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	transport, err := m.connect(ctx, config)
+	if err != nil {
+		session.err = err
+		m.forget(key, session)
+		return
+	}
+
+	client := NewClient(transport, m.config.ClientInfo)
+	if _, err := client.Initialize(ctx); err != nil {
+		client.Close()
+		session.err = err
+		m.forget(key, session)
+		return
+	}
+	session.client = client
+}
+
+func (m *Manager) connect(ctx context.Context, config ServerConfig) (Transport, error) {
+	switch config.Transport {
+	case TransportStdio, "":
+		if config.Command == "" {
+			return nil, fmt.Errorf("mcp: command is required for stdio servers")
+		}
+		return NewStdioTransport(config.Command, config.Args, config.Env)
+	case TransportSSE:
+		if config.URL == "" {
+			return nil, fmt.Errorf("mcp: url is required for SSE servers")
+		}
+		return NewSSETransport(ctx, config.URL, config.Headers)
+	case TransportHTTP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("mcp: url is required for HTTP servers")
+		}
+		return NewStreamableHTTPTransport(config.URL, config.Headers), nil
+	default:
+		return nil, fmt.Errorf("mcp: unsupported transport: %s", config.Transport)
+	}
+}
+
+// forget drops a failed session so the next Get dials again
+func (m *Manager) forget(key string, session *pooledSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[key] == session {
+		delete(m.sessions, key)
+	}
+}
+
+// pruneLocked closes sessions idle for longer than the idle timeout
+func (m *Manager) pruneLocked() {
+	if m.config.IdleTimeout <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-m.config.IdleTimeout)
+	for key, session := range m.sessions {
+		if !session.lastUsed.Before(cutoff) {
+			continue
+		}
+		select {
+		case <-session.ready:
+			delete(m.sessions, key)
+			if session.client != nil {
+				go session.client.Close()
+			}
+		default:
+		}
+	}
+}
+
+// Close ends all sessions
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	sessions := m.sessions
+	m.sessions = make(map[string]*pooledSession)
+	m.mu.Unlock()
+
+	for _, session := range sessions {
+		<-session.ready
+		if session.client != nil {
+			session.client.Close()
+		}
+	}
+	return nil
+}
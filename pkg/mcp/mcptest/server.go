@@ -0,0 +1,135 @@
+// Package mcptest provides a fake MCP server for tests
+package mcptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/mcp"
+)
+
+// Handler is a fake MCP server handler with a fixed set of tools, resources
+// and prompts:
+//
+//   - echo returns its arguments as structured content
+//   - add sums the numbers a and b
+//   - slow reports progress for the given number of steps
+//   - fail always fails
+//   - whoami reports the server process and how many tool calls it served,
+//     which lets tests tell pooled sessions from fresh ones
+type Handler struct {
+	calls atomic.Int64
+}
+
+// NewServer returns an MCP server backed by a fake Handler
+func NewServer() *mcp.Server {
+	return mcp.NewServer(mcp.Implementation{Name: "fake-mcp-server", Version: "1.0.0"}, &Handler{})
+}
+
+// ListTools implements mcp.Handler
+func (h *Handler) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	object := func(properties map[string]interface{}, required ...string) map[string]interface{} {
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	number := map[string]interface{}{"type": "number"}
+
+	return []mcp.Tool{
+		{Name: "echo", Description: "Returns its arguments", InputSchema: object(map[string]interface{}{})},
+		{Name: "add", Description: "Adds two numbers", InputSchema: object(map[string]interface{}{"a": number, "b": number}, "a", "b")},
+		{Name: "slow", Description: "Reports progress for a number of steps", InputSchema: object(map[string]interface{}{"steps": number})},
+		{Name: "fail", Description: "Always fails", InputSchema: object(map[string]interface{}{})},
+		{Name: "whoami", Description: "Reports the server process and call count", InputSchema: object(map[string]interface{}{})},
+	}, nil
+}
+
+// CallTool implements mcp.Handler
+func (h *Handler) CallTool(ctx context.Context, params mcp.CallToolParams, progress func(progress, total float64, message string)) (*mcp.CallToolResult, error) {
+	calls := h.calls.Add(1)
+
+	switch params.Name {
+	case "echo":
+		return structured(params.Arguments)
+
+	case "add":
+		a, _ := params.Arguments["a"].(float64)
+		b, _ := params.Arguments["b"].(float64)
+		return structured(map[string]interface{}{"sum": a + b})
+
+	case "slow":
+		steps := 3
+		if n, ok := params.Arguments["steps"].(float64); ok {
+			steps = int(n)
+		}
+		for i := 1; i <= steps; i++ {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			progress(float64(i), float64(steps), fmt.Sprintf("step %d", i))
+		}
+		return structured(map[string]interface{}{"steps": steps})
+
+	case "fail":
+		return nil, fmt.Errorf("tool failed on purpose")
+
+	case "whoami":
+		return structured(map[string]interface{}{"pid": os.Getpid(), "calls": calls})
+	}
+
+	return nil, fmt.Errorf("tool %q %w", params.Name, mcp.ErrNotFound)
+}
+
+// ListResources implements mcp.ResourceHandler
+func (h *Handler) ListResources(ctx context.Context) ([]mcp.Resource, error) {
+	return []mcp.Resource{
+		{URI: "fake://greeting", Name: "greeting", MimeType: "text/plain"},
+	}, nil
+}
+
+// ReadResource implements mcp.ResourceHandler
+func (h *Handler) ReadResource(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+	if uri != "fake://greeting" {
+		return nil, fmt.Errorf("resource %q %w", uri, mcp.ErrNotFound)
+	}
+	return &mcp.ReadResourceResult{Contents: []mcp.ResourceContents{
+		{URI: uri, MimeType: "text/plain", Text: "hello from the fake server"},
+	}}, nil
+}
+
+// ListPrompts implements mcp.PromptHandler
+func (h *Handler) ListPrompts(ctx context.Context) ([]mcp.Prompt, error) {
+	return []mcp.Prompt{
+		{Name: "greet", Description: "Greets someone", Arguments: []mcp.PromptArgument{{Name: "name", Required: true}}},
+	}, nil
+}
+
+// GetPrompt implements mcp.PromptHandler
+func (h *Handler) GetPrompt(ctx context.Context, name string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	if name != "greet" {
+		return nil, fmt.Errorf("prompt %q %w", name, mcp.ErrNotFound)
+	}
+	return &mcp.GetPromptResult{Messages: []mcp.PromptMessage{
+		{Role: "user", Content: mcp.TextContent("Hello, " + arguments["name"] + "!")},
+	}}, nil
+}
+
+// structured returns value as both text and structured content
+func structured(value interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{mcp.TextContent(string(data))},
+		StructuredContent: value,
+	}, nil
+}
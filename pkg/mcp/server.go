@@ -0,0 +1,337 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Handler serves the tools of an MCP server
+type Handler interface {
+	// ListTools returns the available tools
+	ListTools(ctx context.Context) ([]Tool, error)
+
+	// CallTool runs a tool. Errors wrapping ErrNotFound are reported as
+	// protocol errors, other errors as failed tool results. progress may be
+	// called to report progress to the client.
+	CallTool(ctx context.Context, params CallToolParams, progress func(progress, total float64, message string)) (*CallToolResult, error)
+}
+
+// ResourceHandler is implemented by handlers that serve resources
+type ResourceHandler interface {
+	ListResources(ctx context.Context) ([]Resource, error)
+	ReadResource(ctx context.Context, uri string) (*ReadResourceResult, error)
+}
+
+// PromptHandler is implemented by handlers that serve prompts
+type PromptHandler interface {
+	ListPrompts(ctx context.Context) ([]Prompt, error)
+	GetPrompt(ctx context.Context, name string, arguments map[string]string) (*GetPromptResult, error)
+}
+
+// Server serves the Model Context Protocol over stdio or HTTP
+type Server struct {
+	info         Implementation
+	handler      Handler
+	instructions string
+
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+}
+
+// NewServer returns a server answering with handler
+func NewServer(info Implementation, handler Handler) *Server {
+	return &Server{
+		info:     info,
+		handler:  handler,
+		sessions: make(map[string]*serverSession),
+	}
+}
+
+// SetInstructions sets the usage instructions sent to clients during the handshake
+func (s *Server) SetInstructions(instructions string) {
+	s.instructions = instructions
+}
+
+// serverSession is the state of one client connection
+type serverSession struct {
+	server  *Server
+	handler Handler
+
+	mu          sync.Mutex
+	initialized bool
+	inflight    map[string]context.CancelFunc
+
+	// outbox carries messages to the event stream of legacy SSE sessions,
+	// which lives as long as streamCtx
+	outbox    chan *Message
+	streamCtx context.Context
+}
+
+func (s *Server) newSession(handler Handler) *serverSession {
+	return &serverSession{
+		server:   s,
+		handler:  handler,
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// handle processes one message from the client. It returns the response for
+// requests and nil for notifications and responses. notify sends
+// notifications related to the request, such as progress.
+func (ss *serverSession) handle(ctx context.Context, msg *Message, notify func(*Message)) *Message {
+	if msg.JSONRPC != jsonrpcVersion {
+		if len(msg.ID) > 0 {
+			return newError(msg.ID, CodeInvalidRequest, "jsonrpc must be \"2.0\"")
+		}
+		return nil
+	}
+
+	if msg.IsNotification() {
+		ss.handleNotification(msg)
+		return nil
+	}
+	if !msg.IsRequest() {
+		// Responses to server requests are not expected
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	id := strings.Trim(string(msg.ID), `"`)
+	ss.mu.Lock()
+	ss.inflight[id] = cancel
+	ss.mu.Unlock()
+	defer func() {
+		ss.mu.Lock()
+		delete(ss.inflight, id)
+		ss.mu.Unlock()
+		cancel()
+	}()
+
+	result, err := ss.dispatch(ctx, msg, notify)
+	if err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			return &Message{JSONRPC: jsonrpcVersion, ID: msg.ID, Error: rpcErr}
+		}
+		if errors.Is(err, ErrNotFound) {
+			return newError(msg.ID, CodeInvalidParams, err.Error())
+		}
+		return newError(msg.ID, CodeInternalError, err.Error())
+	}
+	return newResult(msg.ID, result)
+}
+
+func (ss *serverSession) handleNotification(msg *Message) {
+	switch msg.Method {
+	case "notifications/initialized":
+		ss.mu.Lock()
+		ss.initialized = true
+		ss.mu.Unlock()
+	case "notifications/cancelled":
+		var params cancelledParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			ss.mu.Lock()
+			cancel := ss.inflight[strings.Trim(string(params.RequestID), `"`)]
+			ss.mu.Unlock()
+			if cancel != nil {
+				cancel()
+			}
+		}
+	}
+}
+
+func (ss *serverSession) dispatch(ctx context.Context, msg *Message, notify func(*Message)) (interface{}, error) {
+	resources, hasResources := ss.handler.(ResourceHandler)
+	prompts, hasPrompts := ss.handler.(PromptHandler)
+
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return ss.initialize(params), nil
+
+	case "ping":
+		return struct{}{}, nil
+
+	case "tools/list":
+		tools, err := ss.handler.ListTools(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return listToolsResult{Tools: nonNil(tools)}, nil
+
+	case "tools/call":
+		var params CallToolParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		progress := func(progress, total float64, message string) {
+			if params.Meta == nil || params.Meta.ProgressToken == nil || notify == nil {
+				return
+			}
+			if notification, err := newRequest(nil, "notifications/progress", ProgressParams{
+				ProgressToken: params.Meta.ProgressToken,
+				Progress:      progress,
+				Total:         total,
+				Message:       message,
+			}); err == nil {
+				notify(notification)
+			}
+		}
+		result, err := ss.handler.CallTool(ctx, params, progress)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			return &CallToolResult{Content: []Content{TextContent(err.Error())}, IsError: true}, nil
+		}
+		return result, nil
+
+	case "resources/list":
+		if !hasResources {
+			return listResourcesResult{Resources: []Resource{}}, nil
+		}
+		list, err := resources.ListResources(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return listResourcesResult{Resources: nonNil(list)}, nil
+
+	case "resources/read":
+		if !hasResources {
+			return nil, fmt.Errorf("resource %w", ErrNotFound)
+		}
+		var params ReadResourceParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return resources.ReadResource(ctx, params.URI)
+
+	case "prompts/list":
+		if !hasPrompts {
+			return listPromptsResult{Prompts: []Prompt{}}, nil
+		}
+		list, err := prompts.ListPrompts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return listPromptsResult{Prompts: nonNil(list)}, nil
+
+	case "prompts/get":
+		if !hasPrompts {
+			return nil, fmt.Errorf("prompt %w", ErrNotFound)
+		}
+		var params GetPromptParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return prompts.GetPrompt(ctx, params.Name, params.Arguments)
+	}
+
+	return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+// initialize negotiates the protocol version and advertises capabilities
+func (ss *serverSession) initialize(params InitializeParams) InitializeResult {
+	version := ProtocolVersion
+	for _, supported := range supportedProtocolVersions {
+		if params.ProtocolVersion == supported {
+			version = supported
+		}
+	}
+
+	capabilities := ServerCapabilities{Tools: &ListChangedCapability{}}
+	if _, ok := ss.handler.(ResourceHandler); ok {
+		capabilities.Resources = &ResourcesCapability{}
+	}
+	if _, ok := ss.handler.(PromptHandler); ok {
+		capabilities.Prompts = &ListChangedCapability{}
+	}
+
+	return InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    capabilities,
+		ServerInfo:      ss.server.info,
+		Instructions:    ss.server.instructions,
+	}
+}
+
+// ServeStdio serves one session over newline-delimited messages on r and w
+// until r is exhausted or ctx ends
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	session := s.newSession(s.handler)
+
+	var writeMu sync.Mutex
+	write := func(msg *Message) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var requests sync.WaitGroup
+	defer requests.Wait()
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var msg Message
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+				write(newError(json.RawMessage("null"), CodeParseError, "invalid JSON"))
+			} else if msg.IsRequest() {
+				// Requests run concurrently so cancellations can reach them
+				requests.Add(1)
+				go func() {
+					defer requests.Done()
+					write(session.handle(ctx, &msg, write))
+				}()
+			} else {
+				session.handle(ctx, &msg, write)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// decodeParams decodes request params, reporting failures as invalid params
+func decodeParams(msg *Message, params interface{}) error {
+	if len(msg.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// nonNil returns an empty slice for nil so lists encode as []
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,251 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// maxMessageSize bounds the body of a client message
+const maxMessageSize = 4 << 20
+
+// ServeHTTP serves the streamable HTTP transport. Paths ending in /sse and
+// /message serve the HTTP+SSE transport of protocol revision 2024-11-05.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/sse") && r.Method == http.MethodGet:
+		s.serveSSEStream(w, r)
+	case strings.HasSuffix(r.URL.Path, "/message") && r.Method == http.MethodPost:
+		s.serveSSEMessage(w, r)
+	case r.Method == http.MethodPost:
+		s.serveStreamablePost(w, r)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, r.Header.Get("Mcp-Session-Id"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveStreamablePost answers one POSTed message or batch. Requests are
+// answered with an event stream when the client accepts one, so progress
+// notifications can be sent ahead of the response.
+func (s *Server) serveStreamablePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	messages, batch, err := decodeMessages(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, newError(json.RawMessage("null"), CodeParseError, err.Error()))
+		return
+	}
+
+	var session *serverSession
+	if len(messages) == 1 && messages[0].Method == "initialize" {
+		session = s.newSession(s.handler)
+		sessionID := uuid.New().String()
+		s.mu.Lock()
+		s.sessions[sessionID] = session
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", sessionID)
+	} else {
+		sessionID := r.Header.Get("Mcp-Session-Id")
+		if sessionID == "" {
+			http.Error(w, "Mcp-Session-Id header is required", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		session = s.sessions[sessionID]
+		s.mu.Unlock()
+		if session == nil {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	hasRequests := false
+	for _, msg := range messages {
+		if msg.IsRequest() {
+			hasRequests = true
+		}
+	}
+	if !hasRequests {
+		for _, msg := range messages {
+			session.handle(r.Context(), msg, nil)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		stream, ok := newEventStream(w)
+		if ok {
+			for _, msg := range messages {
+				if response := session.handle(r.Context(), msg, stream.send); response != nil {
+					stream.send(response)
+				}
+			}
+			return
+		}
+	}
+
+	var responses []*Message
+	for _, msg := range messages {
+		if response := session.handle(r.Context(), msg, nil); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if batch {
+		writeJSON(w, http.StatusOK, responses)
+		return
+	}
+	writeJSON(w, http.StatusOK, responses[0])
+}
+
+// serveSSEStream opens a legacy SSE session and relays its messages
+func (s *Server) serveSSEStream(w http.ResponseWriter, r *http.Request) {
+	stream, ok := newEventStream(w)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	session := s.newSession(s.handler)
+	session.outbox = make(chan *Message, 64)
+	session.streamCtx = r.Context()
+	sessionID := uuid.New().String()
+	s.mu.Lock()
+	s.sessions[sessionID] = session
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sessionID)
+		s.mu.Unlock()
+	}()
+
+	endpoint := strings.TrimSuffix(r.URL.Path, "/sse") + "/message?sessionId=" + sessionID
+	stream.event("endpoint", endpoint)
+
+	for {
+		select {
+		case msg := <-session.outbox:
+			stream.send(msg)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveSSEMessage accepts a message for a legacy SSE session; responses are
+// delivered on the session's event stream
+func (s *Server) serveSSEMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	session := s.sessions[r.URL.Query().Get("sessionId")]
+	s.mu.Unlock()
+	if session == nil || session.outbox == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	messages, _, err := decodeMessages(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Requests outlive this POST; they end with the event stream
+	send := func(msg *Message) {
+		select {
+		case session.outbox <- msg:
+		case <-session.streamCtx.Done():
+		}
+	}
+	for _, msg := range messages {
+		if msg.IsRequest() {
+			go func(msg *Message) {
+				send(session.handle(session.streamCtx, msg, send))
+			}(msg)
+		} else {
+			session.handle(session.streamCtx, msg, nil)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// eventStream writes messages as server-sent events
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mu      sync.Mutex
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventStream{w: w, flusher: flusher}, true
+}
+
+func (e *eventStream) event(name, data string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", name, data)
+	e.flusher.Flush()
+}
+
+func (e *eventStream) send(msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	e.event("message", string(data))
+}
+
+// decodeMessages decodes a message or a batch of messages
+func decodeMessages(body []byte) ([]*Message, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var messages []*Message
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return nil, true, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil, true, fmt.Errorf("empty batch")
+		}
+		return messages, true, nil
+	}
+
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, false, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return []*Message{&msg}, false, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
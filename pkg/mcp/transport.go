@@ -0,0 +1,508 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport carries JSON-RPC messages between a client and a server
+type Transport interface {
+	// Send delivers a message to the server
+	Send(ctx context.Context, msg *Message) error
+
+	// Messages returns the messages received from the server. The channel
+	// is closed when the connection ends.
+	Messages() <-chan *Message
+
+	// Close ends the connection
+	Close() error
+}
+
+// stdioTransport talks to a server process over its stdin and stdout
+type stdioTransport struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	writeMu  sync.Mutex
+	messages chan *Message
+	exited   chan struct{}
+	once     sync.Once
+}
+
+// NewStdioTransport starts command and exchanges newline-delimited messages with it
+func NewStdioTransport(command string, args []string, env []string) (Transport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = &stderrLogger{prefix: "MCP server " + command}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server: %w", err)
+	}
+
+	t := &stdioTransport{
+		cmd:      cmd,
+		stdin:    stdin,
+		messages: make(chan *Message, 64),
+		exited:   make(chan struct{}),
+	}
+	go t.read(stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) read(stdout io.Reader) {
+	defer close(t.messages)
+
+	reader := bufio.NewReaderSize(stdout, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var msg Message
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr == nil {
+				t.messages <- &msg
+			} else {
+				log.Printf("MCP server %s wrote invalid message: %s", t.cmd.Path, line)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	t.cmd.Wait()
+	close(t.exited)
+}
+
+func (t *stdioTransport) Send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to MCP server: %w", err)
+	}
+	return nil
+}
+
+func (t *stdioTransport) Messages() <-chan *Message {
+	return t.messages
+}
+
+// Close closes stdin and gives the server a moment to exit before killing it
+func (t *stdioTransport) Close() error {
+	t.once.Do(func() {
+		t.stdin.Close()
+		select {
+		case <-t.exited:
+		case <-time.After(2 * time.Second):
+			t.cmd.Process.Kill()
+			<-t.exited
+		}
+	})
+	return nil
+}
+
+// stderrLogger forwards server stderr lines to the process log
+type stderrLogger struct {
+	prefix string
+}
+
+func (l *stderrLogger) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		log.Printf("%s: %s", l.prefix, line)
+	}
+	return len(p), nil
+}
+
+// streamableHTTPTransport implements the streamable HTTP transport: each
+// message is POSTed and answered with JSON or an SSE stream
+type streamableHTTPTransport struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	messages chan *Message
+	ctx      context.Context
+	cancel   context.CancelFunc
+	streams  sync.WaitGroup
+
+	mu        sync.Mutex
+	sessionID string
+	closed    bool
+}
+
+// NewStreamableHTTPTransport returns a transport for the server endpoint at endpointURL
+func NewStreamableHTTPTransport(endpointURL string, headers map[string]string) Transport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &streamableHTTPTransport{
+		url:      endpointURL,
+		headers:  headers,
+		client:   &http.Client{},
+		messages: make(chan *Message, 64),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (t *streamableHTTPTransport) Send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// Close waits for in-flight requests before closing the message channel
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrClosed
+	}
+	t.streams.Add(1)
+	t.mu.Unlock()
+	streaming := false
+	defer func() {
+		if !streaming {
+			t.streams.Done()
+		}
+	}()
+
+	// Responses may stream for as long as the request runs, so the body is
+	// read under the transport's context rather than the caller's
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := doWithContext(ctx, t.client, req)
+	if err != nil {
+		return fmt.Errorf("MCP request failed: %w", err)
+	}
+
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.mu.Lock()
+		t.sessionID = sessionID
+		t.mu.Unlock()
+	}
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		resp.Body.Close()
+		return nil
+	case resp.StatusCode == http.StatusNotFound && t.hasSession():
+		resp.Body.Close()
+		return fmt.Errorf("MCP session expired: %w", ErrClosed)
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return fmt.Errorf("MCP server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		streaming = true
+		go func() {
+			defer t.streams.Done()
+			defer resp.Body.Close()
+			readSSE(resp.Body, func(event, data string) {
+				t.deliver([]byte(data))
+			})
+		}()
+		return nil
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read MCP response: %w", err)
+	}
+	t.deliver(body)
+	return nil
+}
+
+// deliver queues a message or batch received from the server
+func (t *streamableHTTPTransport) deliver(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+
+	var batch []*Message
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return
+		}
+	} else {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return
+		}
+		batch = []*Message{&msg}
+	}
+
+	for _, msg := range batch {
+		select {
+		case t.messages <- msg:
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *streamableHTTPTransport) setHeaders(req *http.Request) {
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+}
+
+func (t *streamableHTTPTransport) hasSession() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID != ""
+}
+
+func (t *streamableHTTPTransport) Messages() <-chan *Message {
+	return t.messages
+}
+
+// Close ends the session on the server and stops all open streams
+func (t *streamableHTTPTransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	if sessionID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil); err == nil {
+			t.setHeaders(req)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+
+	t.cancel()
+	t.streams.Wait()
+	close(t.messages)
+	return nil
+}
+
+// sseTransport implements the HTTP+SSE transport of protocol revision
+// 2024-11-05: server messages arrive on an event stream and client messages
+// are POSTed to the endpoint the stream announces
+type sseTransport struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	messages chan *Message
+	endpoint chan string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	once     sync.Once
+
+	postURL string
+}
+
+// NewSSETransport connects to the event stream at streamURL
+func NewSSETransport(ctx context.Context, streamURL string, headers map[string]string) (Transport, error) {
+	base, err := url.Parse(streamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSE URL: %w", err)
+	}
+
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{}
+	resp, err := doWithContext(ctx, client, req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open SSE stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("SSE stream returned status %d", resp.StatusCode)
+	}
+
+	t := &sseTransport{
+		url:      streamURL,
+		headers:  headers,
+		client:   client,
+		messages: make(chan *Message, 64),
+		endpoint: make(chan string, 1),
+		ctx:      streamCtx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(t.done)
+		defer close(t.messages)
+		defer resp.Body.Close()
+		readSSE(resp.Body, func(event, data string) {
+			switch event {
+			case "endpoint":
+				if endpoint, err := base.Parse(strings.TrimSpace(data)); err == nil {
+					select {
+					case t.endpoint <- endpoint.String():
+					default:
+					}
+				}
+			case "", "message":
+				var msg Message
+				if err := json.Unmarshal([]byte(data), &msg); err == nil {
+					select {
+					case t.messages <- &msg:
+					case <-streamCtx.Done():
+					}
+				}
+			}
+		})
+	}()
+
+	// The first event names the endpoint for client messages
+	select {
+	case t.postURL = <-t.endpoint:
+	case <-t.done:
+		cancel()
+		return nil, fmt.Errorf("SSE stream closed before announcing its endpoint")
+	case <-ctx.Done():
+		t.Close()
+		return nil, ctx.Err()
+	}
+	return t, nil
+}
+
+func (t *sseTransport) Send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.postURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("MCP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("MCP server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (t *sseTransport) Messages() <-chan *Message {
+	return t.messages
+}
+
+func (t *sseTransport) Close() error {
+	t.once.Do(func() {
+		t.cancel()
+		<-t.done
+	})
+	return nil
+}
+
+// doWithContext sends req, giving up when ctx ends before the response
+// headers arrive without tying the response body to ctx
+func doWithContext(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := client.Do(req)
+		results <- result{resp, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.resp, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-results; r.resp != nil {
+				r.resp.Body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// readSSE calls fn for every event of a server-sent event stream until it ends
+func readSSE(r io.Reader, fn func(event, data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				fn(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+	return scanner.Err()
+}
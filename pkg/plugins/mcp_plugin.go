@@ -1,23 +1,21 @@
 package plugins
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"os/exec"
 	"strings"
 	"time"
 
-	"github.com/r3labs/sse/v2"
 	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/mcp"
 )
 
 // MCPPlugin is a custom node plugin for interacting with an MCP server.
-type MCPPlugin struct{}
+type MCPPlugin struct {
+	// Manager pools the server sessions; nil uses mcp.DefaultManager
+	Manager *mcp.Manager
+}
 
 // Name returns the name of the plugin.
 func (p *MCPPlugin) Name() string {
@@ -50,267 +48,234 @@ func getStringParam(params map[string]interface{}, name string, required bool) (
 	return strVal, nil
 }
 
-// executeCMD runs the command with the given input and returns the output.
-func executeCMD(command string, args []string, env []string, inputPayload []byte) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second) // 60 second timeout for the command
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, command, args...)
-	cmd.Env = append(os.Environ(), env...)
-
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
-	}
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start command: %w", err)
-	}
-
-	_, err = stdin.Write(inputPayload)
-	if err != nil {
-		// It's possible the process exited before we could write.
-		// Check if there's already an error from the command.
-		cmd.Wait()
-		return nil, fmt.Errorf("failed to write to stdin: %w, stderr: %s", err, stderr.String())
+// CreateNode creates a new instance of the MCP node.
+func (p *MCPPlugin) CreateNode(params map[string]interface{}) (flowlib.Node, error) {
+	if _, err := getStringParam(params, "operation", true); err != nil {
+		return nil, err
 	}
-	stdin.Close()
 
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("command failed: %w, stderr: %s", err, stderr.String())
-	}
+	node := flowlib.NewNode(0, 0)
 
-	if stderr.Len() > 0 {
-		// Log stderr but don't necessarily fail, as some tools use it for progress
-		fmt.Printf("MCP command stderr: %s", stderr.String())
-	}
+	node.SetExecFn(func(input interface{}) (interface{}, error) {
+		return p.Execute(params, input)
+	})
 
-	return stdout.Bytes(), nil
+	return node, nil
 }
 
-// executeHTTP sends a request to the given URL and returns the response.
-func executeHTTP(url string, headers map[string]string, timeout time.Duration, inputPayload []byte) ([]byte, error) {
-	client := &http.Client{
-		Timeout: timeout,
+// Execute performs the operation described by params against the MCP server.
+// For executeTool without toolParameters, input is sent as the tool arguments.
+// Sessions are pooled, so consecutive executions reuse the server connection.
+func (p *MCPPlugin) Execute(params map[string]interface{}, input interface{}) (interface{}, error) {
+	operation, err := getStringParam(params, "operation", true)
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(inputPayload))
+	server, err := serverConfig(params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create http request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	timeout := 60 * time.Second
+	if t, ok := params["timeout"].(float64); ok { // JSON numbers are float64
+		timeout = time.Duration(t) * time.Millisecond
+	} else if t, ok := params["timeout"].(int); ok {
+		timeout = time.Duration(t) * time.Millisecond
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
+	manager := p.Manager
+	if manager == nil {
+		manager = mcp.DefaultManager()
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("http request returned non-200 status: %d, body: %s", resp.StatusCode, string(body))
+	client, err := manager.Get(ctx, server)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: failed to connect: %w", err)
 	}
 
-	return io.ReadAll(resp.Body)
-}
-
-// executeSSE sends a request and listens for an SSE event.
-func executeSSE(url, postEndpoint string, headers map[string]string, timeout time.Duration, inputPayload []byte) ([]byte, error) {
-	// If there's a separate post endpoint, send the request there first.
-	if postEndpoint != "" {
-		postHeaders := make(map[string]string)
-		for k, v := range headers {
-			postHeaders[k] = v
-		}
-		postHeaders["Content-Type"] = "application/json"
-
-		// This is a fire-and-forget post.
-		_, err := executeHTTP(postEndpoint, postHeaders, timeout, inputPayload)
-		if err != nil {
-			return nil, fmt.Errorf("sse post to messages endpoint failed: %w", err)
+	var resultData interface{}
+	switch operation {
+	case "listTools":
+		resultData, err = client.ListTools(ctx)
+	case "listResources":
+		resultData, err = client.ListResources(ctx)
+	case "listPrompts":
+		resultData, err = client.ListPrompts(ctx)
+	case "readResource":
+		resourceUri, _ := getStringParam(params, "resourceUri", false)
+		var result *mcp.ReadResourceResult
+		if result, err = client.ReadResource(ctx, resourceUri); err == nil {
+			resultData = result.Contents
 		}
-	}
-
-	client := sse.NewClient(url)
-	// TODO: This library doesn't easily support custom headers on the initial connection.
-	// This is a limitation for SSE connections that require authentication headers.
-
-	var eventData []byte
-	errChan := make(chan error, 1)
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	go func() {
-		// The library will attempt to reconnect on its own, so we use a context to control it.
-		err := client.SubscribeWithContext(ctx, "message", func(msg *sse.Event) {
-			if len(msg.Data) > 0 {
-				eventData = msg.Data
-				cancel() // Got the message, stop subscribing.
-			}
-		})
-		if err != nil && ctx.Err() == nil {
-			errChan <- err
+	case "getPrompt":
+		promptName, _ := getStringParam(params, "promptName", false)
+		var result *mcp.GetPromptResult
+		if result, err = client.GetPrompt(ctx, promptName, promptArguments(params["promptArguments"])); err == nil {
+			resultData = result
 		}
-	}()
-
-	select {
-	case <-ctx.Done():
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("sse request timed out after %v", timeout)
+	case "executeTool":
+		toolName, _ := getStringParam(params, "toolName", false)
+		arguments, argErr := toolArguments(params, input)
+		if argErr != nil {
+			return nil, argErr
 		}
-		// Context was canceled, likely because we received our message.
-		if eventData == nil {
-			return nil, fmt.Errorf("sse connection closed without receiving a message")
+		var result *mcp.CallToolResult
+		if result, err = client.CallTool(ctx, toolName, arguments, nil); err == nil {
+			if result.IsError {
+				return nil, fmt.Errorf("mcp: tool %s failed: %s", toolName, contentText(result.Content))
+			}
+			resultData = toolResult(result)
 		}
-		return eventData, nil
-	case err := <-errChan:
-		return nil, fmt.Errorf("sse subscription failed: %w", err)
+	default:
+		return nil, fmt.Errorf("mcp: unsupported operation: '%s'", operation)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mcp: %s failed: %w", operation, err)
 	}
+
+	return map[string]interface{}{"result": resultData}, nil
 }
 
-// CreateNode creates a new instance of the MCP node.
-func (p *MCPPlugin) CreateNode(params map[string]interface{}) (flowlib.Node, error) {
+// serverConfig builds the pooled session key from the connection params
+func serverConfig(params map[string]interface{}) (mcp.ServerConfig, error) {
 	connectionType, _ := getStringParam(params, "connectionType", false)
 	if connectionType == "" {
 		connectionType = "cmd" // Default connection type
 	}
 
-	operation, err := getStringParam(params, "operation", true)
-	if err != nil {
-		return nil, err
-	}
-
-	node := flowlib.NewNode(0, 0)
-
-	node.SetExecFn(func(input interface{}) (interface{}, error) {
-		// Extract parameters within the execution function to allow dynamic inputs
-		// CMD/STDIO params
+	switch connectionType {
+	case "cmd":
 		command, _ := getStringParam(params, "command", false)
-		argsStr, _ := getStringParam(params, "args", false)
-		envStr, _ := getStringParam(params, "env", false)
-		var env []string
-		if envStr != "" {
-			if err := json.Unmarshal([]byte(envStr), &env); err == nil {
-				// Fallback to splitting by newline for backward compatibility
-				env = strings.Split(envStr, "\n")
-			}
+		if command == "" {
+			return mcp.ServerConfig{}, fmt.Errorf("mcp: 'command' parameter is required for 'cmd' connection type")
 		}
-
-		// HTTP/SSE params
+		return mcp.ServerConfig{
+			Transport: mcp.TransportStdio,
+			Command:   command,
+			Args:      stringList(params["args"], strings.Fields),
+			Env:       stringList(params["env"], func(s string) []string { return strings.Split(s, "\n") }),
+		}, nil
+	case "http", "sse":
 		url, _ := getStringParam(params, "url", false)
-		messagesPostEndpoint, _ := getStringParam(params, "messagesPostEndpoint", false)
-		var headers map[string]string
-		if h, ok := params["headers"]; ok {
-			if headerMap, ok := h.(map[string]string); ok {
-				headers = headerMap
-			} else if headerMap, ok := h.(map[interface{}]interface{}); ok {
-				headers = make(map[string]string)
-				for k, v := range headerMap {
-					headers[fmt.Sprintf("%v", k)] = fmt.Sprintf("%v", v)
-				}
-			}
+		if url == "" {
+			return mcp.ServerConfig{}, fmt.Errorf("mcp: 'url' parameter is required for '%s' connection type", connectionType)
 		}
-		var timeoutVal int
-		if t, ok := params["timeout"].(float64); ok { // JSON numbers are float64
-			timeoutVal = int(t)
-		} else {
-			timeoutVal = 60000 // default 60s
+		transport := mcp.TransportHTTP
+		if connectionType == "sse" {
+			transport = mcp.TransportSSE
 		}
-		timeout := time.Duration(timeoutVal) * time.Millisecond
-
-		// Operation-specific params
-		resourceUri, _ := getStringParam(params, "resourceUri", false)
-		toolName, _ := getStringParam(params, "toolName", false)
-		toolParamsStr, _ := getStringParam(params, "toolParameters", false)
-		promptName, _ := getStringParam(params, "promptName", false)
+		return mcp.ServerConfig{Transport: transport, URL: url, Headers: stringMap(params["headers"])}, nil
+	default:
+		return mcp.ServerConfig{}, fmt.Errorf("unsupported connection type: '%s'", connectionType)
+	}
+}
 
-		// Construct the request payload based on the operation
-		requestPayload := map[string]interface{}{
-			"method": operation,
-			"params": map[string]interface{}{},
-		}
-		opParams := requestPayload["params"].(map[string]interface{})
-		switch operation {
-		case "readResource":
-			opParams["uri"] = resourceUri
-		case "executeTool":
-			opParams["name"] = toolName
-			var toolArgs interface{}
-			// The tool parameters can be a JSON string or an object from a previous node
-			if toolParamsStr != "" {
-				if err := json.Unmarshal([]byte(toolParamsStr), &toolArgs); err == nil {
-					opParams["arguments"] = toolArgs
-				} else {
-					opParams["arguments"] = toolParamsStr // Pass as string if not valid JSON
-				}
-			} else if input != nil {
-				// If toolParameters is empty, use the input from the previous node
-				opParams["arguments"] = input
-			}
-		case "getPrompt":
-			opParams["name"] = promptName
+// toolArguments returns the tool arguments from toolParameters, which can be
+// a JSON string or an object, or from the input of the previous node
+func toolArguments(params map[string]interface{}, input interface{}) (map[string]interface{}, error) {
+	value := params["toolParameters"]
+	if s, ok := value.(string); ok {
+		if s == "" {
+			value = nil
+		} else if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return nil, fmt.Errorf("mcp: 'toolParameters' must be a JSON object: %w", err)
 		}
+	}
+	if value == nil {
+		value = input
+	}
 
-		var resultData interface{}
-		var execErr error
+	switch v := value.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return v, nil
+	default:
+		// Tools take an object, so other values are wrapped
+		return map[string]interface{}{"input": v}, nil
+	}
+}
 
-		reqBytes, err := json.Marshal(requestPayload)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request payload: %w", err)
+// toolResult prefers structured content, then JSON or plain text content
+func toolResult(result *mcp.CallToolResult) interface{} {
+	if result.StructuredContent != nil {
+		return result.StructuredContent
+	}
+	if len(result.Content) == 1 && result.Content[0].Type == "text" {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(result.Content[0].Text), &decoded); err == nil {
+			return decoded
 		}
+		return result.Content[0].Text
+	}
+	return result.Content
+}
 
-		switch connectionType {
-		case "cmd":
-			if command == "" {
-				return nil, fmt.Errorf("mcp: 'command' parameter is required for 'cmd' connection type")
-			}
-			args := strings.Fields(argsStr)
-
-			outputBytes, err := executeCMD(command, args, env, reqBytes)
-			if err != nil {
-				execErr = fmt.Errorf("cmd execution failed: %w", err)
-			} else if err := json.Unmarshal(outputBytes, &resultData); err != nil {
-				resultData = string(outputBytes) // Return as raw string if not JSON
-			}
-		case "http":
-			if url == "" {
-				return nil, fmt.Errorf("mcp: 'url' parameter is required for 'http' connection type")
-			}
-			outputBytes, err := executeHTTP(url, headers, timeout, reqBytes)
-			if err != nil {
-				execErr = fmt.Errorf("http execution failed: %w", err)
-			} else if err := json.Unmarshal(outputBytes, &resultData); err != nil {
-				resultData = string(outputBytes)
-			}
-		case "sse":
-			if url == "" {
-				return nil, fmt.Errorf("mcp: 'url' parameter is required for 'sse' connection type")
-			}
-			outputBytes, err := executeSSE(url, messagesPostEndpoint, headers, timeout, reqBytes)
-			if err != nil {
-				execErr = fmt.Errorf("sse execution failed: %w", err)
-			} else if err := json.Unmarshal(outputBytes, &resultData); err != nil {
-				resultData = string(outputBytes)
-			}
-		default:
-			execErr = fmt.Errorf("unsupported connection type: '%s'", connectionType)
+// contentText joins the text items of tool output
+func contentText(content []mcp.Content) string {
+	var texts []string
+	for _, item := range content {
+		if item.Type == "text" {
+			texts = append(texts, item.Text)
 		}
+	}
+	return strings.Join(texts, "\n")
+}
 
-		if execErr != nil {
-			return nil, execErr
+// stringList accepts a list or a string split with split
+func stringList(value interface{}, split func(string) []string) []string {
+	switch v := value.(type) {
+	case string:
+		var list []string
+		if err := json.Unmarshal([]byte(v), &list); err == nil {
+			return list
+		}
+		if v == "" {
+			return nil
 		}
+		return split(v)
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprintf("%v", item))
+		}
+		return list
+	}
+	return nil
+}
 
-		return map[string]interface{}{"result": resultData}, nil
-	})
+// stringMap converts header maps from YAML or JSON
+func stringMap(value interface{}) map[string]string {
+	switch v := value.(type) {
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		headers := make(map[string]string, len(v))
+		for k, val := range v {
+			headers[k] = fmt.Sprintf("%v", val)
+		}
+		return headers
+	case map[interface{}]interface{}:
+		headers := make(map[string]string, len(v))
+		for k, val := range v {
+			headers[fmt.Sprintf("%v", k)] = fmt.Sprintf("%v", val)
+		}
+		return headers
+	}
+	return nil
+}
 
-	return node, nil
-}
\ No newline at end of file
+// promptArguments converts prompt arguments to strings
+func promptArguments(value interface{}) map[string]string {
+	if s, ok := value.(string); ok && s != "" {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+			value = decoded
+		}
+	}
+	return stringMap(value)
+}
@@ -1,13 +1,15 @@
 package plugins
 
 import (
-	"fmt"
-	"net/http"
 	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/mcp"
+	"github.com/tcmartin/flowrunner/pkg/mcp/mcptest"
 )
 
 func TestMCPPlugin_CreateNode_Success(t *testing.T) {
@@ -37,42 +39,65 @@ func TestMCPPlugin_CreateNode_MissingOperation(t *testing.T) {
 	assert.Equal(t, "mcp: 'operation' parameter is required", err.Error())
 }
 
+// buildFakeMCPServer compiles cmd/fake-mcp-server for stdio tests
+func buildFakeMCPServer(t *testing.T) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "fake-mcp-server")
+	cmd := exec.Command("go", "build", "-o", binary, "github.com/tcmartin/flowrunner/cmd/fake-mcp-server")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return binary
+}
+
+func newTestMCPPlugin(t *testing.T) *MCPPlugin {
+	manager := mcp.NewManager(mcp.ManagerConfig{})
+	t.Cleanup(func() { manager.Close() })
+	return &MCPPlugin{Manager: manager}
+}
+
 func TestMCPPlugin_ExecuteTool_CMD_Success(t *testing.T) {
-	plugin := &MCPPlugin{}
+	plugin := newTestMCPPlugin(t)
 	params := map[string]interface{}{
 		"connectionType": "cmd",
 		"operation":      "executeTool",
-		"command":        "echo",
-		"args":           `{"name": "test"}`,
-		"toolName":       "testTool",
+		"command":        buildFakeMCPServer(t),
+		"toolName":       "whoami",
 	}
 
 	node, err := plugin.CreateNode(params)
 	require.NoError(t, err)
 
-	// The Run method in the provided flowlib returns (flowlib.Action, error)
-	// The first return value is an Action, which is a string.
-	// The result of the execution is embedded in the node itself or handled by post-execution logic,
-	// which is not fully implemented in the provided plugin stub.
-	// For this test, we will just check if the node runs without error.
 	_, err = node.Run(nil)
 	require.NoError(t, err)
+
+	// The session started by the node is reused by later executions
+	result, err := plugin.Execute(params, nil)
+	require.NoError(t, err)
+	whoami := result.(map[string]interface{})["result"].(map[string]interface{})
+	assert.Equal(t, float64(2), whoami["calls"])
+
+	result, err = plugin.Execute(map[string]interface{}{
+		"connectionType": "cmd",
+		"operation":      "executeTool",
+		"command":        params["command"],
+		"toolName":       "add",
+		"toolParameters": `{"a": 2, "b": 3}`,
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"sum": float64(5)}, result.(map[string]interface{})["result"])
 }
 
 func TestMCPPlugin_ExecuteTool_HTTP_Success(t *testing.T) {
-	// Create a mock HTTP server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, `{"result": "success"}`)
-	}))
-	defer server.Close()
+	server := httptest.NewServer(mcptest.NewServer())
+	// Registered first so pooled sessions are closed before the server
+	t.Cleanup(server.Close)
 
-	plugin := &MCPPlugin{}
+	plugin := newTestMCPPlugin(t)
 	params := map[string]interface{}{
 		"connectionType": "http",
 		"operation":      "executeTool",
 		"url":            server.URL,
-		"toolName":       "testTool",
+		"toolName":       "echo",
 	}
 
 	node, err := plugin.CreateNode(params)
@@ -80,4 +105,45 @@ func TestMCPPlugin_ExecuteTool_HTTP_Success(t *testing.T) {
 
 	_, err = node.Run(nil)
 	require.NoError(t, err)
+
+	// Without toolParameters the input is sent as arguments
+	result, err := plugin.Execute(params, map[string]interface{}{"greeting": "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"greeting": "hi"}, result.(map[string]interface{})["result"])
+}
+
+func TestMCPPlugin_SSEOperations(t *testing.T) {
+	server := httptest.NewServer(mcptest.NewServer())
+	t.Cleanup(server.Close)
+
+	plugin := newTestMCPPlugin(t)
+	execute := func(params map[string]interface{}) (interface{}, error) {
+		params["connectionType"] = "sse"
+		params["url"] = server.URL + "/sse"
+		result, err := plugin.Execute(params, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result.(map[string]interface{})["result"], nil
+	}
+
+	tools, err := execute(map[string]interface{}{"operation": "listTools"})
+	require.NoError(t, err)
+	assert.Len(t, tools, 5)
+
+	contents, err := execute(map[string]interface{}{"operation": "readResource", "resourceUri": "fake://greeting"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello from the fake server", contents.([]mcp.ResourceContents)[0].Text)
+
+	prompt, err := execute(map[string]interface{}{
+		"operation":       "getPrompt",
+		"promptName":      "greet",
+		"promptArguments": map[string]interface{}{"name": "Ada"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, Ada!", prompt.(*mcp.GetPromptResult).Messages[0].Content.Text)
+
+	_, err = execute(map[string]interface{}{"operation": "executeTool", "toolName": "fail"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tool failed on purpose")
 }
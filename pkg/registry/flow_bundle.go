@@ -0,0 +1,713 @@
+package registry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// BundleFormatVersion is the manifest format written by Export
+const BundleFormatVersion = "1"
+
+// Bundle archive formats
+const (
+	BundleFormatTarGz = "tar.gz"
+	BundleFormatZip   = "zip"
+)
+
+// bundleManifestFile is the manifest's path inside a bundle archive
+const bundleManifestFile = "manifest.json"
+
+// maxBundleContentSize limits the size of a bundle archive and the total
+// size of the files extracted from it
+const maxBundleContentSize = 64 << 20
+
+// Errors returned by bundle import
+var (
+	ErrInvalidBundle       = errors.New("invalid flow bundle")
+	ErrMissingDependencies = errors.New("flow bundle has unmet dependencies")
+)
+
+// secretReferencePatterns match secret references in flow YAML: secrets
+// used in expressions, and the params naming a secret
+var secretReferencePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`secrets\.([A-Za-z_][A-Za-z0-9_]*)`),
+	regexp.MustCompile(`secrets\[\s*["']([^"']+)["']\s*\]`),
+	regexp.MustCompile(`\b(?:credential|oauth_secret|provider_secret|key_secret)["']?\s*:\s*["']?([A-Za-z0-9_][A-Za-z0-9_.-]*)`),
+}
+
+// BundleManifest describes the contents of a flow bundle
+type BundleManifest struct {
+	FormatVersion string       `json:"format_version"`
+	ExportedAt    time.Time    `json:"exported_at"`
+	SourceAccount string       `json:"source_account,omitempty"`
+	Flows         []BundleFlow `json:"flows"`
+	Secrets       []string     `json:"secrets"`
+	Plugins       []string     `json:"plugins"`
+}
+
+// BundleFlow describes one flow in a bundle
+type BundleFlow struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Category    string                 `json:"category,omitempty"`
+	Status      string                 `json:"status,omitempty"`
+	Custom      map[string]interface{} `json:"custom,omitempty"`
+
+	// Versions are ordered oldest first; the last entry is the current version
+	Versions []BundleFlowVersion `json:"versions"`
+
+	// Secrets and Plugins referenced by any version of this flow
+	Secrets []string `json:"secrets,omitempty"`
+	Plugins []string `json:"plugins,omitempty"`
+}
+
+// BundleFlowVersion points at one stored version inside the archive
+type BundleFlowVersion struct {
+	Version string `json:"version"`
+	File    string `json:"file"`
+}
+
+// BundleImportOptions controls how a bundle is imported
+type BundleImportOptions struct {
+	// DryRun validates the bundle and reports what would happen without creating flows
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// RequireSecrets fails the import when referenced secrets are missing in the target account
+	RequireSecrets bool `json:"require_secrets,omitempty"`
+}
+
+// BundleImportReport describes the result of an import
+type BundleImportReport struct {
+	DryRun         bool                 `json:"dry_run"`
+	Flows          []BundleImportedFlow `json:"flows"`
+	IDMap          map[string]string    `json:"id_map"`
+	MissingSecrets []string             `json:"missing_secrets"`
+	MissingPlugins []string             `json:"missing_plugins"`
+}
+
+// BundleImportedFlow describes one imported flow
+type BundleImportedFlow struct {
+	SourceID string `json:"source_id"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Versions int    `json:"versions"`
+}
+
+// flowValidator is implemented by registries that validate flow definitions
+// whose imports may name flows not stored yet
+type flowValidator interface {
+	// ValidateWithFlows validates a flow definition, resolving its imports
+	// against the given flows, by ID, before the flows of the account
+	ValidateWithFlows(accountID, yamlContent string, flows map[string]string) error
+}
+
+// BundleService exports flows into portable archives and imports them into accounts
+type BundleService struct {
+	registry       FlowRegistry
+	secretVault    auth.SecretVault
+	pluginRegistry plugins.PluginRegistry
+}
+
+// NewBundleService creates a new bundle service. secretVault and pluginRegistry
+// may be nil, in which case the corresponding dependency checks are skipped.
+func NewBundleService(registry FlowRegistry, secretVault auth.SecretVault, pluginRegistry plugins.PluginRegistry) *BundleService {
+	return &BundleService{
+		registry:       registry,
+		secretVault:    secretVault,
+		pluginRegistry: pluginRegistry,
+	}
+}
+
+// Export writes the given flows with all their versions to w. An empty flowIDs
+// exports every flow of the account.
+func (b *BundleService) Export(accountID string, flowIDs []string, format string, w io.Writer) (*BundleManifest, error) {
+	flows, err := b.registry.List(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flows: %w", err)
+	}
+
+	infoByID := make(map[string]FlowInfo, len(flows))
+	for _, info := range flows {
+		infoByID[info.ID] = info
+	}
+	if len(flowIDs) == 0 {
+		for _, info := range flows {
+			flowIDs = append(flowIDs, info.ID)
+		}
+		sort.Strings(flowIDs)
+	}
+
+	manifest := &BundleManifest{
+		FormatVersion: BundleFormatVersion,
+		ExportedAt:    time.Now().UTC(),
+		SourceAccount: accountID,
+	}
+	files := make(map[string][]byte)
+	allSecrets := make(map[string]bool)
+	allPlugins := make(map[string]bool)
+
+	for _, flowID := range flowIDs {
+		info, ok := infoByID[flowID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrFlowNotFound, flowID)
+		}
+
+		contents, versions, err := b.flowVersions(accountID, info)
+		if err != nil {
+			return nil, err
+		}
+
+		bundleFlow := BundleFlow{
+			ID:          info.ID,
+			Name:        info.Name,
+			Description: info.Description,
+			Tags:        info.Tags,
+			Category:    info.Category,
+			Status:      info.Status,
+			Custom:      info.Custom,
+		}
+
+		flowSecrets := make(map[string]bool)
+		flowPlugins := make(map[string]bool)
+		for i, version := range versions {
+			file := path.Join("flows", flowID, fmt.Sprintf("%03d.yaml", i+1))
+			files[file] = []byte(contents[i])
+			bundleFlow.Versions = append(bundleFlow.Versions, BundleFlowVersion{Version: version, File: file})
+
+			for _, key := range findSecretReferences(contents[i]) {
+				flowSecrets[key] = true
+				allSecrets[key] = true
+			}
+			for _, nodeType := range findPluginNodeTypes(contents[i]) {
+				flowPlugins[nodeType] = true
+				allPlugins[nodeType] = true
+			}
+		}
+		bundleFlow.Secrets = sortedKeys(flowSecrets)
+		bundleFlow.Plugins = sortedKeys(flowPlugins)
+		if bundleFlow.Name == "" {
+			bundleFlow.Name = flowNameFromYAML(contents[len(contents)-1], flowID)
+		}
+
+		manifest.Flows = append(manifest.Flows, bundleFlow)
+	}
+
+	manifest.Secrets = sortedKeys(allSecrets)
+	manifest.Plugins = sortedKeys(allPlugins)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle manifest: %w", err)
+	}
+	files[bundleManifestFile] = manifestJSON
+
+	if err := writeBundleArchive(w, format, files); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Import reads a bundle from r and recreates its flows in the account. Flows
+// get new IDs; references between flows in the bundle are rewritten to match.
+func (b *BundleService) Import(accountID string, r io.Reader, options BundleImportOptions) (*BundleImportReport, error) {
+	files, err := readBundleArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestJSON, ok := files[bundleManifestFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBundle, bundleManifestFile)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if manifest.FormatVersion != BundleFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %q", ErrInvalidBundle, manifest.FormatVersion)
+	}
+
+	for _, flow := range manifest.Flows {
+		if len(flow.Versions) == 0 {
+			return nil, fmt.Errorf("%w: flow %s has no versions", ErrInvalidBundle, flow.ID)
+		}
+		for _, version := range flow.Versions {
+			if _, ok := files[version.File]; !ok {
+				return nil, fmt.Errorf("%w: missing file %s", ErrInvalidBundle, version.File)
+			}
+		}
+	}
+
+	report := &BundleImportReport{
+		DryRun:         options.DryRun,
+		IDMap:          make(map[string]string),
+		MissingSecrets: b.missingSecrets(accountID, manifest.Secrets),
+		MissingPlugins: b.missingPlugins(manifest.Plugins),
+	}
+	for _, flow := range manifest.Flows {
+		report.Flows = append(report.Flows, BundleImportedFlow{
+			SourceID: flow.ID,
+			Name:     flow.Name,
+			Versions: len(flow.Versions),
+		})
+	}
+
+	if len(report.MissingPlugins) > 0 {
+		return report, fmt.Errorf("%w: missing plugins %s", ErrMissingDependencies, strings.Join(report.MissingPlugins, ", "))
+	}
+	if options.RequireSecrets && len(report.MissingSecrets) > 0 {
+		return report, fmt.Errorf("%w: missing secrets %s", ErrMissingDependencies, strings.Join(report.MissingSecrets, ", "))
+	}
+
+	// Every version is validated before any flow is written
+	if err := b.validateFlows(accountID, manifest, files); err != nil {
+		return report, err
+	}
+	if options.DryRun {
+		return report, nil
+	}
+
+	// Flows created by a failing import are removed again
+	if err := b.writeFlows(accountID, manifest, files, report); err != nil {
+		for sourceID, newID := range report.IDMap {
+			b.registry.Delete(accountID, newID)
+			delete(report.IDMap, sourceID)
+		}
+		for i := range report.Flows {
+			report.Flows[i].ID = ""
+		}
+		return report, err
+	}
+	return report, nil
+}
+
+// validateFlows validates every version of the flows of a bundle, when the
+// registry can. Imports may name other flows of the bundle by their source
+// ID or metadata name.
+func (b *BundleService) validateFlows(accountID string, manifest BundleManifest, files map[string][]byte) error {
+	validator, ok := b.registry.(flowValidator)
+	if !ok {
+		return nil
+	}
+
+	bundleFlows := make(map[string]string, len(manifest.Flows))
+	for _, flow := range manifest.Flows {
+		bundleFlows[flow.ID] = string(files[flow.Versions[len(flow.Versions)-1].File])
+	}
+	for _, flow := range manifest.Flows {
+		for _, version := range flow.Versions {
+			if err := validator.ValidateWithFlows(accountID, string(files[version.File]), bundleFlows); err != nil {
+				return fmt.Errorf("version %s of flow %s: %w", version.Version, flow.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeFlows creates the flows of a bundle with all their versions and
+// records their new IDs in the report
+func (b *BundleService) writeFlows(accountID string, manifest BundleManifest, files map[string][]byte, report *BundleImportReport) error {
+	// Create every flow from its oldest version first so all new IDs are known
+	// before the remaining versions are written with rewritten references.
+	created := make([]string, len(manifest.Flows))
+	for i, flow := range manifest.Flows {
+		created[i] = remapFlowIDs(string(files[flow.Versions[0].File]), report.IDMap)
+		newID, err := b.registry.Create(accountID, flow.Name, created[i])
+		if err != nil {
+			return fmt.Errorf("failed to import flow %s: %w", flow.ID, err)
+		}
+		report.IDMap[flow.ID] = newID
+		report.Flows[i].ID = newID
+	}
+
+	for i, flow := range manifest.Flows {
+		newID := report.IDMap[flow.ID]
+
+		if len(flow.Versions) == 1 {
+			// Rewrite the only version if it references flows created after it
+			if remapped := remapFlowIDs(string(files[flow.Versions[0].File]), report.IDMap); remapped != created[i] {
+				if err := b.registry.Update(accountID, newID, remapped); err != nil {
+					return fmt.Errorf("failed to import flow %s: %w", flow.ID, err)
+				}
+			}
+		}
+		for _, version := range flow.Versions[1:] {
+			content := remapFlowIDs(string(files[version.File]), report.IDMap)
+			if err := b.registry.Update(accountID, newID, content); err != nil {
+				return fmt.Errorf("failed to import version %s of flow %s: %w", version.Version, flow.ID, err)
+			}
+		}
+
+		metadata := FlowMetadata{
+			Tags:     flow.Tags,
+			Category: flow.Category,
+			Status:   flow.Status,
+			Custom:   flow.Custom,
+		}
+		if metadata.Tags != nil || metadata.Category != "" || metadata.Status != "" || metadata.Custom != nil {
+			if err := b.registry.UpdateMetadata(accountID, newID, metadata); err != nil {
+				return fmt.Errorf("failed to import metadata of flow %s: %w", flow.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// flowVersions returns the contents and names of every version of a flow, oldest first
+func (b *BundleService) flowVersions(accountID string, info FlowInfo) ([]string, []string, error) {
+	versionInfos, err := b.registry.ListVersions(accountID, info.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list versions of flow %s: %w", info.ID, err)
+	}
+
+	var versions []string
+	for _, versionInfo := range versionInfos {
+		if versionInfo.Version != info.Version {
+			versions = append(versions, versionInfo.Version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+
+	var contents []string
+	for _, version := range versions {
+		content, err := b.registry.GetVersion(accountID, info.ID, version)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get version %s of flow %s: %w", version, info.ID, err)
+		}
+		contents = append(contents, content)
+	}
+
+	// The current definition always comes last
+	current, err := b.registry.Get(accountID, info.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get flow %s: %w", info.ID, err)
+	}
+	contents = append(contents, current)
+	versions = append(versions, info.Version)
+
+	return contents, versions, nil
+}
+
+// compareVersions orders version names like semantic versions: runs of
+// digits compare as numbers, so that 1.9.0 comes before 1.10.0 and
+// generated "v<timestamp>" versions sort by creation
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		aPart, aRest := splitVersionPart(a)
+		bPart, bRest := splitVersionPart(b)
+		if c := compareVersionParts(aPart, bPart); c != 0 {
+			return c
+		}
+		a, b = aRest, bRest
+	}
+	return len(a) - len(b)
+}
+
+// splitVersionPart splits the leading run of digits or non-digits off a
+// version name
+func splitVersionPart(version string) (string, string) {
+	digits := isDigit(version[0])
+	end := 1
+	for end < len(version) && isDigit(version[end]) == digits {
+		end++
+	}
+	return version[:end], version[end:]
+}
+
+// compareVersionParts compares runs of digits as numbers and other runs as
+// strings
+func compareVersionParts(a, b string) int {
+	if isDigit(a[0]) && isDigit(b[0]) {
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// missingSecrets returns the keys not present in the account's vault
+func (b *BundleService) missingSecrets(accountID string, keys []string) []string {
+	missing := []string{}
+	if b.secretVault == nil || len(keys) == 0 {
+		return missing
+	}
+
+	existing := make(map[string]bool)
+	if stored, err := b.secretVault.List(accountID); err == nil {
+		for _, key := range stored {
+			existing[key] = true
+		}
+	}
+	for _, key := range keys {
+		if !existing[key] {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// missingPlugins returns the node types that are neither core nodes nor registered plugins
+func (b *BundleService) missingPlugins(nodeTypes []string) []string {
+	missing := []string{}
+	for _, nodeType := range nodeTypes {
+		if b.pluginRegistry != nil {
+			if _, err := b.pluginRegistry.Get(nodeType); err == nil {
+				continue
+			}
+		}
+		missing = append(missing, nodeType)
+	}
+	return missing
+}
+
+// findSecretReferences returns the secret keys referenced in a flow definition
+func findSecretReferences(content string) []string {
+	keys := make(map[string]bool)
+	for _, pattern := range secretReferencePatterns {
+		for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+			keys[match[1]] = true
+		}
+	}
+	return sortedKeys(keys)
+}
+
+// findPluginNodeTypes returns the node types of a flow definition that are not core nodes
+func findPluginNodeTypes(content string) []string {
+	flowDef := &loader.FlowDefinition{}
+	if err := yaml.Unmarshal([]byte(content), flowDef); err != nil {
+		return nil
+	}
+
+	coreTypes := runtime.CoreNodeTypes()
+	types := make(map[string]bool)
+	for _, node := range flowDef.Nodes {
+		if _, isCore := coreTypes[node.Type]; !isCore && node.Type != "" {
+			types[node.Type] = true
+		}
+	}
+	return sortedKeys(types)
+}
+
+// flowNameFromYAML returns the metadata name of a flow definition or fallback
+func flowNameFromYAML(content string, fallback string) string {
+	flowDef := &loader.FlowDefinition{}
+	if err := yaml.Unmarshal([]byte(content), flowDef); err == nil && flowDef.Metadata.Name != "" {
+		return flowDef.Metadata.Name
+	}
+	return fallback
+}
+
+// remapFlowIDs replaces whole-word occurrences of source flow IDs with their new IDs
+func remapFlowIDs(content string, idMap map[string]string) string {
+	if len(idMap) == 0 {
+		return content
+	}
+
+	// Replace longer IDs first so one ID that prefixes another is not split
+	sourceIDs := make([]string, 0, len(idMap))
+	for id := range idMap {
+		sourceIDs = append(sourceIDs, id)
+	}
+	sort.Slice(sourceIDs, func(i, j int) bool { return len(sourceIDs[i]) > len(sourceIDs[j]) })
+
+	quoted := make([]string, len(sourceIDs))
+	for i, id := range sourceIDs {
+		quoted[i] = regexp.QuoteMeta(id)
+	}
+	pattern := regexp.MustCompile(strings.Join(quoted, "|"))
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		// Only replace whole IDs, not parts of longer identifiers
+		if (start > 0 && isFlowIDChar(content[start-1])) || (end < len(content) && isFlowIDChar(content[end])) {
+			continue
+		}
+		out.WriteString(content[last:start])
+		out.WriteString(idMap[content[start:end]])
+		last = end
+	}
+	out.WriteString(content[last:])
+	return out.String()
+}
+
+func isFlowIDChar(c byte) bool {
+	return c == '-' || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// writeBundleArchive writes files to w in the given archive format
+func writeBundleArchive(w io.Writer, format string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	// The manifest is written first so readers can stream it
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == bundleManifestFile || names[j] == bundleManifestFile {
+			return names[i] == bundleManifestFile
+		}
+		return names[i] < names[j]
+	})
+
+	switch format {
+	case "", BundleFormatTarGz:
+		gzipWriter := gzip.NewWriter(w)
+		tarWriter := tar.NewWriter(gzipWriter)
+		for _, name := range names {
+			header := &tar.Header{
+				Name:    name,
+				Mode:    0644,
+				Size:    int64(len(files[name])),
+				ModTime: time.Now(),
+			}
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+			if _, err := tarWriter.Write(files[name]); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+		}
+		if err := tarWriter.Close(); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		return gzipWriter.Close()
+
+	case BundleFormatZip:
+		zipWriter := zip.NewWriter(w)
+		for _, name := range names {
+			fileWriter, err := zipWriter.Create(name)
+			if err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+			if _, err := fileWriter.Write(files[name]); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+		}
+		return zipWriter.Close()
+
+	default:
+		return fmt.Errorf("unsupported bundle format: %s", format)
+	}
+}
+
+// readBundleArchive reads all files from a tar.gz, tar or zip archive. The
+// archive and the files extracted from it are each limited to
+// maxBundleContentSize in total.
+func readBundleArchive(r io.Reader) (map[string][]byte, error) {
+	data, err := (&bundleBudget{remaining: maxBundleContentSize}).read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	budget := &bundleBudget{remaining: maxBundleContentSize}
+
+	// Zip archives start with a local file header
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		for _, file := range zipReader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+			}
+			content, err := budget.read(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[path.Clean(file.Name)] = content
+		}
+		return files, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(data)
+	// Gzip streams start with 0x1f 0x8b; anything else is treated as a plain tar
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		defer gzipReader.Close()
+		reader = bufio.NewReader(gzipReader)
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := budget.read(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(header.Name)] = content
+	}
+	return files, nil
+}
+
+// bundleBudget bounds the bytes read from a bundle, so that a small archive
+// cannot expand into unbounded memory
+type bundleBudget struct {
+	remaining int64
+}
+
+// read reads r to the end, failing once the budget is used up
+func (b *bundleBudget) read(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, b.remaining+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if int64(len(content)) > b.remaining {
+		return nil, fmt.Errorf("%w: contents exceed %d bytes", ErrInvalidBundle, maxBundleContentSize)
+	}
+	b.remaining -= int64(len(content))
+	return content, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
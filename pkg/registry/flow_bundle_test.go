@@ -0,0 +1,349 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestBundleExportImport(t *testing.T) {
+	for _, format := range []string{BundleFormatTarGz, BundleFormatZip} {
+		t.Run(format, func(t *testing.T) {
+			registry := NewFlowRegistry(NewMockFlowStore(), FlowRegistryOptions{
+				YAMLLoader: &MockYAMLLoader{},
+			})
+
+			secretStore := storage.NewMemoryProvider().GetSecretStore()
+			vault, err := services.NewSecretVaultService(secretStore, []byte("0123456789abcdef0123456789abcdef"))
+			if err != nil {
+				t.Fatalf("Failed to create secret vault: %v", err)
+			}
+			if err := vault.Set("production", "API_TOKEN", "token-value"); err != nil {
+				t.Fatalf("Failed to set secret: %v", err)
+			}
+
+			childID, err := registry.Create("staging", "child", `
+metadata:
+  name: Child
+  version: 1.0.0
+nodes:
+  start:
+    type: transform
+    params:
+      script: "return {auth: secrets.API_TOKEN};"
+`)
+			if err != nil {
+				t.Fatalf("Failed to create flow: %v", err)
+			}
+			if err := registry.Update("staging", childID, `
+metadata:
+  name: Child
+  version: 1.1.0
+nodes:
+  start:
+    type: transform
+    params:
+      script: "return {auth: secrets.API_TOKEN, db: secrets['DB_URL']};"
+`); err != nil {
+				t.Fatalf("Failed to update flow: %v", err)
+			}
+			if err := registry.UpdateMetadata("staging", childID, FlowMetadata{
+				Tags:     []string{"billing"},
+				Category: "finance",
+			}); err != nil {
+				t.Fatalf("Failed to update metadata: %v", err)
+			}
+
+			parentID, err := registry.Create("staging", "parent", `
+metadata:
+  name: Parent
+nodes:
+  start:
+    type: cron
+    params:
+      flow_id: `+childID+`
+`)
+			if err != nil {
+				t.Fatalf("Failed to create flow: %v", err)
+			}
+
+			bundles := NewBundleService(registry, vault, plugins.NewPluginRegistry())
+
+			var archive bytes.Buffer
+			manifest, err := bundles.Export("staging", nil, format, &archive)
+			if err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+			if len(manifest.Flows) != 2 {
+				t.Fatalf("Expected 2 flows in manifest, got %d", len(manifest.Flows))
+			}
+			if !reflect.DeepEqual(manifest.Secrets, []string{"API_TOKEN", "DB_URL"}) {
+				t.Errorf("Expected secret keys in manifest, got %v", manifest.Secrets)
+			}
+			if len(manifest.Plugins) != 0 {
+				t.Errorf("Expected no plugins for core nodes, got %v", manifest.Plugins)
+			}
+
+			// A dry run reports missing secrets without creating flows
+			report, err := bundles.Import("production", bytes.NewReader(archive.Bytes()), BundleImportOptions{DryRun: true})
+			if err != nil {
+				t.Fatalf("Failed dry run: %v", err)
+			}
+			if !reflect.DeepEqual(report.MissingSecrets, []string{"DB_URL"}) {
+				t.Errorf("Expected DB_URL to be missing, got %v", report.MissingSecrets)
+			}
+			if flows, _ := registry.List("production"); len(flows) != 0 {
+				t.Errorf("Expected dry run to create no flows, got %d", len(flows))
+			}
+
+			_, err = bundles.Import("production", bytes.NewReader(archive.Bytes()), BundleImportOptions{RequireSecrets: true})
+			if !errors.Is(err, ErrMissingDependencies) {
+				t.Errorf("Expected missing dependency error, got %v", err)
+			}
+
+			report, err = bundles.Import("production", bytes.NewReader(archive.Bytes()), BundleImportOptions{})
+			if err != nil {
+				t.Fatalf("Failed to import: %v", err)
+			}
+
+			newChildID := report.IDMap[childID]
+			newParentID := report.IDMap[parentID]
+			if newChildID == "" || newChildID == childID || newParentID == "" {
+				t.Fatalf("Expected remapped IDs, got %v", report.IDMap)
+			}
+
+			versions, err := registry.ListVersions("production", newChildID)
+			if err != nil {
+				t.Fatalf("Failed to list versions: %v", err)
+			}
+			if len(versions) != 2 {
+				t.Errorf("Expected 2 imported versions, got %d", len(versions))
+			}
+
+			child, _ := registry.Get("production", newChildID)
+			if !strings.Contains(child, "DB_URL") {
+				t.Errorf("Expected latest child version to be current")
+			}
+
+			parent, _ := registry.Get("production", newParentID)
+			if !strings.Contains(parent, "flow_id: "+newChildID) {
+				t.Errorf("Expected parent to reference the imported child, got %s", parent)
+			}
+
+			infos, _ := registry.List("production")
+			for _, info := range infos {
+				if info.ID == newChildID && (info.Category != "finance" || !reflect.DeepEqual(info.Tags, []string{"billing"})) {
+					t.Errorf("Expected metadata to be imported, got %+v", info)
+				}
+			}
+		})
+	}
+}
+
+func TestBundleImportMissingPlugin(t *testing.T) {
+	registry := NewFlowRegistry(NewMockFlowStore(), FlowRegistryOptions{
+		YAMLLoader: &MockYAMLLoader{},
+	})
+	if _, err := registry.Create("staging", "custom", `
+metadata:
+  name: Custom
+nodes:
+  start:
+    type: acme.widget
+`); err != nil {
+		t.Fatalf("Failed to create flow: %v", err)
+	}
+
+	bundles := NewBundleService(registry, nil, plugins.NewPluginRegistry())
+
+	var archive bytes.Buffer
+	manifest, err := bundles.Export("staging", nil, "", &archive)
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if !reflect.DeepEqual(manifest.Plugins, []string{"acme.widget"}) {
+		t.Errorf("Expected plugin dependency, got %v", manifest.Plugins)
+	}
+
+	report, err := bundles.Import("production", &archive, BundleImportOptions{})
+	if !errors.Is(err, ErrMissingDependencies) {
+		t.Fatalf("Expected missing dependency error, got %v", err)
+	}
+	if !reflect.DeepEqual(report.MissingPlugins, []string{"acme.widget"}) {
+		t.Errorf("Expected missing plugin in report, got %v", report.MissingPlugins)
+	}
+}
+
+func TestBundleExportOrdersVersions(t *testing.T) {
+	registry := NewFlowRegistry(NewMockFlowStore(), FlowRegistryOptions{
+		YAMLLoader: &MockYAMLLoader{},
+	})
+	definition := func(version string) string {
+		return "metadata:\n  name: Versioned\n  version: " + version + "\nnodes:\n  start:\n    type: transform\n"
+	}
+	flowID, err := registry.Create("staging", "versioned", definition("1.2.0"))
+	if err != nil {
+		t.Fatalf("Failed to create flow: %v", err)
+	}
+	for _, version := range []string{"1.9.0", "1.10.0", "2.0.0"} {
+		if err := registry.Update("staging", flowID, definition(version)); err != nil {
+			t.Fatalf("Failed to update flow: %v", err)
+		}
+	}
+
+	manifest, err := NewBundleService(registry, nil, nil).Export("staging", nil, "", &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	var versions []string
+	for _, version := range manifest.Flows[0].Versions {
+		versions = append(versions, version.Version)
+	}
+	if !reflect.DeepEqual(versions, []string{"1.2.0", "1.9.0", "1.10.0", "2.0.0"}) {
+		t.Errorf("Expected versions oldest first, got %v", versions)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"1.9.0", "1.10.0", true},
+		{"1.10.0", "1.9.0", false},
+		{"1.2", "1.2.1", true},
+		{"v9", "v10", true},
+		{"v1700000000000000000", "v1700000000000000001", true},
+		{"1.02", "1.1", false},
+	}
+	for _, test := range tests {
+		if less := compareVersions(test.a, test.b) < 0; less != test.less {
+			t.Errorf("Expected %s < %s to be %v", test.a, test.b, test.less)
+		}
+	}
+}
+
+func TestFindSecretReferences(t *testing.T) {
+	keys := findSecretReferences(`
+nodes:
+  call:
+    type: http.request
+    params:
+      credential: "crm"
+      auth: {oauth_secret: github}
+  ask:
+    type: llm
+    params:
+      provider_secret: 'azure-gpt'
+  notify:
+    type: email.send
+    params:
+      dkim: {domain: example.com, key_secret: DKIM_KEY}
+      body: "${secrets.SMTP_PASSWORD}"
+`)
+	if !reflect.DeepEqual(keys, []string{"DKIM_KEY", "SMTP_PASSWORD", "azure-gpt", "crm", "github"}) {
+		t.Errorf("Expected every referenced secret, got %v", keys)
+	}
+}
+
+func TestBundleImportValidatesBeforeWriting(t *testing.T) {
+	yamlLoader := &MockYAMLLoader{}
+	registry := NewFlowRegistry(NewMockFlowStore(), FlowRegistryOptions{YAMLLoader: yamlLoader})
+	for _, name := range []string{"first", "second"} {
+		if _, err := registry.Create("staging", name, "metadata:\n  name: "+name+"\nnodes:\n  start:\n    type: transform\n"); err != nil {
+			t.Fatalf("Failed to create flow: %v", err)
+		}
+	}
+	var archive bytes.Buffer
+	if _, err := NewBundleService(registry, nil, nil).Export("staging", nil, "", &archive); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	// The second flow is invalid in the target, so neither is imported
+	yamlLoader.validateFunc = func(content string) error {
+		if strings.Contains(content, "name: second") {
+			return errors.New("unknown node type")
+		}
+		return nil
+	}
+	_, err := NewBundleService(registry, nil, nil).Import("production", bytes.NewReader(archive.Bytes()), BundleImportOptions{})
+	if !errors.Is(err, ErrInvalidYAML) {
+		t.Fatalf("Expected invalid YAML error, got %v", err)
+	}
+	if flows, _ := registry.List("production"); len(flows) != 0 {
+		t.Errorf("Expected no flows to be imported, got %d", len(flows))
+	}
+}
+
+// failingMetadataRegistry fails to update the metadata of flows
+type failingMetadataRegistry struct {
+	FlowRegistry
+}
+
+func (r failingMetadataRegistry) UpdateMetadata(accountID string, id string, metadata FlowMetadata) error {
+	return errors.New("metadata store unavailable")
+}
+
+func TestBundleImportRemovesFlowsOnFailure(t *testing.T) {
+	registry := NewFlowRegistry(NewMockFlowStore(), FlowRegistryOptions{YAMLLoader: &MockYAMLLoader{}})
+	flowID, err := registry.Create("staging", "tagged", "metadata:\n  name: Tagged\nnodes:\n  start:\n    type: transform\n")
+	if err != nil {
+		t.Fatalf("Failed to create flow: %v", err)
+	}
+	if err := registry.UpdateMetadata("staging", flowID, FlowMetadata{Tags: []string{"billing"}}); err != nil {
+		t.Fatalf("Failed to update metadata: %v", err)
+	}
+	var archive bytes.Buffer
+	if _, err := NewBundleService(registry, nil, nil).Export("staging", nil, "", &archive); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	report, err := NewBundleService(failingMetadataRegistry{registry}, nil, nil).Import("production", &archive, BundleImportOptions{})
+	if err == nil {
+		t.Fatal("Expected import to fail")
+	}
+	if flows, _ := registry.List("production"); len(flows) != 0 {
+		t.Errorf("Expected the created flow to be removed, got %d flows", len(flows))
+	}
+	if len(report.IDMap) != 0 || report.Flows[0].ID != "" {
+		t.Errorf("Expected no imported flows in the report, got %+v", report)
+	}
+}
+
+func TestReadBundleArchiveLimitsContents(t *testing.T) {
+	// A small archive expanding beyond the limit is rejected
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	size := int64(maxBundleContentSize + 1)
+	if err := tarWriter.WriteHeader(&tar.Header{Name: "flows/large.yaml", Mode: 0644, Size: size}); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	if _, err := io.CopyN(tarWriter, zeroReader{}, size); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	_, err := readBundleArchive(&archive)
+	if !errors.Is(err, ErrInvalidBundle) || !strings.Contains(err.Error(), "contents exceed") {
+		t.Errorf("Expected contents limit error, got %v", err)
+	}
+}
+
+// zeroReader reads an endless stream of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"gopkg.in/yaml.v3"
+)
+
+// flowReader is the part of storage.FlowStore needed to resolve flow references
+type flowReader interface {
+	GetFlow(accountID, flowID string) ([]byte, error)
+	ListFlows(accountID string) ([]string, error)
+}
+
+// registryReader adapts a FlowRegistry to flowReader
+type registryReader struct {
+	registry FlowRegistry
+}
+
+func (r registryReader) GetFlow(accountID, flowID string) ([]byte, error) {
+	content, err := r.registry.Get(accountID, flowID)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+func (r registryReader) ListFlows(accountID string) ([]string, error) {
+	flows, err := r.registry.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	flowIDs := make([]string, len(flows))
+	for i, flow := range flows {
+		flowIDs[i] = flow.ID
+	}
+	return flowIDs, nil
+}
+
+// overlayFlowReader reads flows from a set of flows not stored yet before
+// reading them from an underlying reader
+type overlayFlowReader struct {
+	flows map[string]string
+	base  flowReader
+}
+
+func (r overlayFlowReader) GetFlow(accountID, flowID string) ([]byte, error) {
+	if content, ok := r.flows[flowID]; ok {
+		return []byte(content), nil
+	}
+	return r.base.GetFlow(accountID, flowID)
+}
+
+func (r overlayFlowReader) ListFlows(accountID string) ([]string, error) {
+	stored, err := r.base.ListFlows(accountID)
+	if err != nil {
+		return nil, err
+	}
+	flowIDs := make([]string, 0, len(r.flows)+len(stored))
+	for flowID := range r.flows {
+		flowIDs = append(flowIDs, flowID)
+	}
+	sort.Strings(flowIDs)
+	for _, flowID := range stored {
+		if _, ok := r.flows[flowID]; !ok {
+			flowIDs = append(flowIDs, flowID)
+		}
+	}
+	return flowIDs, nil
+}
+
+// flowImportResolver resolves the imports of a flow to other flows of the same account
+type flowImportResolver struct {
+	flowStore flowReader
+	accountID string
+}
+
+// NewFlowImportResolver returns a resolver for imports in flows of an account.
+// Imports name another flow by ID or by metadata name.
+func NewFlowImportResolver(flowRegistry FlowRegistry, accountID string) loader.ImportResolver {
+	return &flowImportResolver{flowStore: registryReader{registry: flowRegistry}, accountID: accountID}
+}
+
+// ResolveImport returns the YAML of the referenced flow
+func (r *flowImportResolver) ResolveImport(name string) (string, string, error) {
+	flowID, content, err := findFlowReference(r.flowStore, r.accountID, name)
+	if err != nil {
+		return "", "", err
+	}
+	return string(content), "flow:" + flowID, nil
+}
+
+// findFlowReference looks a flow up by ID, falling back to its metadata name
+func findFlowReference(flowStore flowReader, accountID, reference string) (string, []byte, error) {
+	if content, err := flowStore.GetFlow(accountID, reference); err == nil {
+		return reference, content, nil
+	}
+
+	flowIDs, err := flowStore.ListFlows(accountID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list flows: %w", err)
+	}
+	for _, flowID := range flowIDs {
+		content, err := flowStore.GetFlow(accountID, flowID)
+		if err != nil {
+			continue
+		}
+		flowDef := &loader.FlowDefinition{}
+		if err := yaml.Unmarshal(content, flowDef); err != nil {
+			continue
+		}
+		if flowDef.Metadata.Name == reference {
+			return flowID, content, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("%w: %s", ErrFlowNotFound, reference)
+}
+
+// loaderFor returns the YAML loader for flows of an account, with imports
+// resolved against the account's flows when the loader supports them
+func (r *FlowRegistryService) loaderFor(accountID string) loader.YAMLLoader {
+	if resolving, ok := r.yamlLoader.(loader.ResolvingLoader); ok {
+		return resolving.WithResolver(&flowImportResolver{flowStore: r.flowStore, accountID: accountID})
+	}
+	return r.yamlLoader
+}
+
+// ValidateWithFlows validates a flow definition whose imports may name, by ID
+// or metadata name, the given flows as well as the flows of the account
+func (r *FlowRegistryService) ValidateWithFlows(accountID, yamlContent string, flows map[string]string) error {
+	yamlLoader := r.yamlLoader
+	if resolving, ok := yamlLoader.(loader.ResolvingLoader); ok {
+		reader := overlayFlowReader{flows: flows, base: r.flowStore}
+		yamlLoader = resolving.WithResolver(&flowImportResolver{flowStore: reader, accountID: accountID})
+	}
+	if err := yamlLoader.Validate(yamlContent); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidYAML, err)
+	}
+	return nil
+}
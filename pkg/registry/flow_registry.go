@@ -36,7 +36,7 @@ func NewFlowRegistry(flowStore storage.FlowStore, options FlowRegistryOptions) F
 // Create stores a new flow definition
 func (r *FlowRegistryService) Create(accountID string, name string, yamlContent string) (string, error) {
 	// Validate the YAML content
-	if err := r.yamlLoader.Validate(yamlContent); err != nil {
+	if err := r.loaderFor(accountID).Validate(yamlContent); err != nil {
 		return "", fmt.Errorf("%w: %v", ErrInvalidYAML, err)
 	}
 
@@ -110,7 +110,7 @@ func (r *FlowRegistryService) Update(accountID string, id string, yamlContent st
 	}
 
 	// Validate the YAML content
-	if err := r.yamlLoader.Validate(yamlContent); err != nil {
+	if err := r.loaderFor(accountID).Validate(yamlContent); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidYAML, err)
 	}
 
@@ -389,3 +389,82 @@ nodes:
 		t.Error("Expected error for unauthorized access, got nil")
 	}
 }
+
+func TestRuntimeAdapter(t *testing.T) {
+	mockStore := NewMockFlowStore()
+	registry := NewFlowRegistry(mockStore, FlowRegistryOptions{
+		YAMLLoader: &MockYAMLLoader{},
+	})
+
+	yamlContent := `
+metadata:
+  name: Test Flow
+  version: 1.0.0
+nodes:
+  start:
+    type: test
+`
+	flowID, _ := registry.Create("account1", "test-flow", yamlContent)
+	updatedYAML := `
+metadata:
+  name: Test Flow
+  version: 1.1.0
+nodes:
+  start:
+    type: test
+`
+	if err := registry.Update("account1", flowID, updatedYAML); err != nil {
+		t.Fatalf("Expected no error on update, got %v", err)
+	}
+
+	adapter := NewRuntimeAdapter(registry)
+
+	latest, err := adapter.GetFlow("account1", flowID)
+	if err != nil {
+		t.Fatalf("Expected no error getting flow, got %v", err)
+	}
+	if latest.YAML != updatedYAML || latest.Version != "1.1.0" {
+		t.Errorf("Expected latest version 1.1.0, got %q", latest.Version)
+	}
+
+	original, err := adapter.GetFlowVersion("account1", flowID, "1.0.0")
+	if err != nil {
+		t.Fatalf("Expected no error getting version 1.0.0, got %v", err)
+	}
+	if original.YAML != yamlContent {
+		t.Errorf("Expected original content for version 1.0.0")
+	}
+}
+
+func TestFlowImportResolver(t *testing.T) {
+	registry := NewFlowRegistry(NewMockFlowStore(), FlowRegistryOptions{
+		YAMLLoader: &MockYAMLLoader{},
+	})
+
+	shared := `
+metadata:
+  name: notify-slack
+nodes:
+  notify:
+    type: test
+`
+	flowID, err := registry.Create("account1", "notify-slack", shared)
+	if err != nil {
+		t.Fatalf("Expected no error creating flow, got %v", err)
+	}
+
+	resolver := NewRuntimeAdapter(registry).ImportResolver("account1")
+	for _, reference := range []string{flowID, "notify-slack"} {
+		content, source, err := resolver.ResolveImport(reference)
+		if err != nil {
+			t.Fatalf("Expected %s to resolve, got %v", reference, err)
+		}
+		if content != shared || source != "flow:"+flowID {
+			t.Errorf("Unexpected resolution of %s: %s", reference, source)
+		}
+	}
+
+	if _, _, err := NewFlowImportResolver(registry, "account2").ResolveImport("notify-slack"); err == nil {
+		t.Errorf("Expected flows of other accounts not to resolve")
+	}
+}
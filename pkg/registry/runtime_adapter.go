@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// RuntimeAdapter exposes a FlowRegistry to the flow runtime, including
+// versioned lookups used when re-running executions
+type RuntimeAdapter struct {
+	registry FlowRegistry
+}
+
+// NewRuntimeAdapter creates a runtime.VersionedFlowRegistry backed by a FlowRegistry
+func NewRuntimeAdapter(registry FlowRegistry) *RuntimeAdapter {
+	return &RuntimeAdapter{registry: registry}
+}
+
+// GetFlow retrieves the latest version of a flow
+func (a *RuntimeAdapter) GetFlow(accountID, flowID string) (*runtime.Flow, error) {
+	content, err := a.registry.Get(accountID, flowID)
+	if err != nil {
+		return nil, err
+	}
+
+	flow := &runtime.Flow{
+		ID:   flowID,
+		YAML: content,
+	}
+
+	// Record the version so executions can be re-run against it later
+	if flows, err := a.registry.List(accountID); err == nil {
+		for _, info := range flows {
+			if info.ID == flowID {
+				flow.Version = info.Version
+				break
+			}
+		}
+	}
+
+	return flow, nil
+}
+
+// GetFlowVersion retrieves a specific version of a flow
+func (a *RuntimeAdapter) GetFlowVersion(accountID, flowID, version string) (*runtime.Flow, error) {
+	content, err := a.registry.GetVersion(accountID, flowID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtime.Flow{
+		ID:      flowID,
+		YAML:    content,
+		Version: version,
+	}, nil
+}
+
+// ImportResolver resolves flow imports against the account's flows
+func (a *RuntimeAdapter) ImportResolver(accountID string) loader.ImportResolver {
+	return NewFlowImportResolver(a.registry, accountID)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/tcmartin/flowlib"
@@ -35,6 +36,10 @@ type AgentState struct {
 	CurrentStep         int
 	Thinking            string
 	IntermediateResults []map[string]interface{}
+
+	// Usage totals the tokens of all LLM requests of the run
+	Usage    utils.Usage
+	Requests int
 }
 
 // CreateAgentNode creates a new AI agent node wrapper
@@ -66,31 +71,21 @@ func NewAgentNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				return nil, fmt.Errorf("expected map[string]interface{}, got %T", input)
 			}
 
-			// Extract provider
-			providerStr, ok := params["provider"].(string)
-			if !ok {
-				providerStr = "openai" // Default to OpenAI
+			// Create LLM client for the provider settings
+			client, err := newLLMClient(params, input)
+			if err != nil {
+				return nil, err
 			}
-
-			var provider utils.LLMProvider
-			switch providerStr {
-			case "openai":
-				provider = utils.OpenAI
-			case "anthropic":
-				provider = utils.Anthropic
-			default:
-				provider = utils.Generic
+			if !client.Capabilities().Tools {
+				return nil, fmt.Errorf("provider %s does not support tools", client.Provider())
 			}
 
-			// Extract API key
-			apiKey, ok := params["api_key"].(string)
-			if !ok {
-				return nil, fmt.Errorf("api_key parameter is required")
+			// Extract model, unless the provider settings name a default
+			model, _ := params["model"].(string)
+			if model == "" {
+				model = client.DefaultModel()
 			}
-
-			// Extract model
-			model, ok := params["model"].(string)
-			if !ok {
+			if model == "" {
 				return nil, fmt.Errorf("model parameter is required")
 			}
 
@@ -112,6 +107,9 @@ func NewAgentNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				temperature = tempParam
 			}
 
+			// Tools bound to nodes and flows call back into the running execution
+			env := toolEnvironmentFrom(input)
+
 			// Extract tools
 			tools := []utils.ToolDefinition{}
 			toolHandlers := make(map[string]func(params map[string]interface{}) (interface{}, error))
@@ -138,10 +136,18 @@ func NewAgentNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 								},
 							})
 
-							// Add default handler that returns an error
-							toolHandlers[name] = func(params map[string]interface{}) (interface{}, error) {
-								return nil, fmt.Errorf("no handler defined for tool: %s", name)
+							// Bind the tool to the node, request, script, flow or MCP tool it declares
+							handler, err := newToolHandler(name, toolMap, env)
+							if err != nil {
+								return nil, err
 							}
+							if handler == nil {
+								// Add default handler that returns an error
+								handler = func(params map[string]interface{}) (interface{}, error) {
+									return nil, fmt.Errorf("no handler defined for tool: %s", name)
+								}
+							}
+							toolHandlers[name] = handler
 						}
 					}
 				}
@@ -184,9 +190,6 @@ func NewAgentNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				}
 			}
 
-			// Create LLM client
-			client := utils.NewLLMClient(provider, apiKey, nil)
-
 			// Initialize agent state
 			state := &AgentState{
 				Messages: []utils.Message{
@@ -206,20 +209,63 @@ func NewAgentNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				IntermediateResults: []map[string]interface{}{},
 			}
 
+			// Continue the conversation of the node's memory session
+			memory, err := newConversationMemory(params, env)
+			if err != nil {
+				return nil, err
+			}
+			var conversation *Conversation
+			if memory != nil {
+				if conversation, err = env.loadConversation(memory); err != nil {
+					return nil, err
+				}
+				state.Messages = conversation.withHistory(state.Messages)
+			}
+
 			// Run the agent
-			finalResponse, err := runAgent(client, model, state, temperature)
+			finalResponse, err := runAgent(env, client, model, state, temperature)
 			if err != nil {
 				return nil, fmt.Errorf("agent execution failed: %w", err)
 			}
 
+			// Remember the prompt and the final answer; the tool calls in
+			// between are not kept
+			if conversation != nil {
+				turn := []utils.Message{{Role: "user", Content: prompt}, {Role: "assistant", Content: finalResponse}}
+				summarize := func(summary string, dropped []utils.Message) (string, error) {
+					if err := env.checkLLMBudget(); err != nil {
+						return "", err
+					}
+					request := summaryRequest(summary, dropped)
+					request.Model = model
+					resp, err := client.Complete(context.Background(), request)
+					if err != nil {
+						return "", err
+					}
+					env.recordLLMUsage(string(client.Provider()), model, resp.Usage, 1)
+					if len(resp.Choices) == 0 {
+						return "", fmt.Errorf("no choices returned from LLM")
+					}
+					return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+				}
+				if err := env.rememberTurn(memory, conversation, turn, summarize, env.log); err != nil {
+					return nil, err
+				}
+			}
+
 			// Return the final response
-			return map[string]interface{}{
+			result := map[string]interface{}{
 				"response":             finalResponse,
 				"steps":                state.CurrentStep,
 				"thinking":             state.Thinking,
 				"intermediate_results": state.IntermediateResults,
 				"conversation":         state.Messages,
-			}, nil
+				"usage":                state.Usage,
+			}
+			if memory != nil {
+				result["session_id"] = memory.sessionID
+			}
+			return result, nil
 		},
 	}
 
@@ -229,11 +275,16 @@ func NewAgentNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 	return wrapper, nil
 }
 
-// runAgent runs the agent until it reaches a conclusion or exceeds max steps
-func runAgent(client *utils.LLMClient, model string, state *AgentState, temperature float64) (string, error) {
+// runAgent runs the agent until it reaches a conclusion or exceeds max steps.
+// The usage of every step is recorded on the execution as it happens, so that
+// the account's LLM budget is checked before each step.
+func runAgent(env *toolEnvironment, client *utils.LLMClient, model string, state *AgentState, temperature float64) (string, error) {
 	ctx := context.Background()
 
 	for state.CurrentStep < state.MaxSteps {
+		if err := env.checkLLMBudget(); err != nil {
+			return "", err
+		}
 		state.CurrentStep++
 
 		// Create LLM request
@@ -249,6 +300,11 @@ func runAgent(client *utils.LLMClient, model string, state *AgentState, temperat
 		if err != nil {
 			return "", fmt.Errorf("LLM request failed: %w", err)
 		}
+		state.Requests++
+		state.Usage.PromptTokens += resp.Usage.PromptTokens
+		state.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		state.Usage.TotalTokens += resp.Usage.TotalTokens
+		env.recordLLMUsage(string(client.Provider()), model, resp.Usage, 1)
 
 		// Check for errors
 		if resp.Error != nil {
@@ -266,132 +322,57 @@ func runAgent(client *utils.LLMClient, model string, state *AgentState, temperat
 		// Add the assistant's message to the conversation
 		state.Messages = append(state.Messages, assistantMessage)
 
-		// Check if the assistant wants to use a tool by examining the raw response
-		if resp.RawResponse != nil {
-			// Try to extract tool calls from the raw response
-			var toolCalls []ToolCall
-
-			// Check if there are tool calls in the raw response
-			if choices, ok := resp.RawResponse["choices"].([]interface{}); ok && len(choices) > 0 {
-				if choice, ok := choices[0].(map[string]interface{}); ok {
-					if message, ok := choice["message"].(map[string]interface{}); ok {
-						if toolCallsRaw, ok := message["tool_calls"].([]interface{}); ok {
-							// Parse tool calls
-							for _, tc := range toolCallsRaw {
-								if tcMap, ok := tc.(map[string]interface{}); ok {
-									var toolCall ToolCall
-
-									// Extract ID
-									if id, ok := tcMap["id"].(string); ok {
-										toolCall.ID = id
-									}
-
-									// Extract type
-									if typ, ok := tcMap["type"].(string); ok {
-										toolCall.Type = typ
-									}
-
-									// Extract function
-									if function, ok := tcMap["function"].(map[string]interface{}); ok {
-										if name, ok := function["name"].(string); ok {
-											toolCall.Function.Name = name
-										}
-										if args, ok := function["arguments"].(string); ok {
-											toolCall.Function.Arguments = args
-										}
-									}
-
-									toolCalls = append(toolCalls, toolCall)
-								}
-							}
-						}
-					}
+		// Check if the assistant wants to use a tool. Providers normalize
+		// their tool calls into the message.
+		if toolCalls := assistantMessage.ToolCalls; len(toolCalls) > 0 {
+			// Process each tool call
+			for _, toolCall := range toolCalls {
+				// Parse the tool call arguments
+				var args map[string]interface{}
+				if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+					return "", fmt.Errorf("failed to parse tool arguments: %w", err)
 				}
-			}
 
-			// Process tool calls if any
-			if len(toolCalls) > 0 {
-				// Process each tool call
-				for _, toolCall := range toolCalls {
-					// Parse the tool call arguments
-					var args map[string]interface{}
-					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-						return "", fmt.Errorf("failed to parse tool arguments: %w", err)
+				// Get the tool handler
+				handler, ok := state.ToolHandlers[toolCall.Function.Name]
+				if !ok {
+					// If no handler is found, return an error message
+					toolResult := map[string]interface{}{
+						"error": fmt.Sprintf("Tool not found: %s", toolCall.Function.Name),
 					}
 
-					// Get the tool handler
-					handler, ok := state.ToolHandlers[toolCall.Function.Name]
-					if !ok {
-						// If no handler is found, return an error message
-						toolResult := map[string]interface{}{
-							"error": fmt.Sprintf("Tool not found: %s", toolCall.Function.Name),
-						}
-
-						// Add the tool result to the conversation
-						state.Messages = append(state.Messages, utils.Message{
-							Role:    "tool",
-							Content: fmt.Sprintf("%v", toolResult),
-						})
-
-						// Add to intermediate results
-						state.IntermediateResults = append(state.IntermediateResults, map[string]interface{}{
-							"step":      state.CurrentStep,
-							"tool":      toolCall.Function.Name,
-							"arguments": args,
-							"result":    toolResult,
-							"error":     true,
-						})
-
-						continue
-					}
+					// Add the tool result to the conversation
+					state.Messages = append(state.Messages, utils.Message{
+						Role:       "tool",
+						Content:    fmt.Sprintf("%v", toolResult),
+						ToolCallID: toolCall.ID,
+					})
 
-					// Execute the tool
-					result, err := handler(args)
-					if err != nil {
-						// If the tool execution fails, return an error message
-						toolResult := map[string]interface{}{
-							"error": fmt.Sprintf("Tool execution failed: %s", err.Error()),
-						}
+					// Add to intermediate results
+					state.IntermediateResults = append(state.IntermediateResults, map[string]interface{}{
+						"step":      state.CurrentStep,
+						"tool":      toolCall.Function.Name,
+						"arguments": args,
+						"result":    toolResult,
+						"error":     true,
+					})
 
-						// Add the tool result to the conversation
-						state.Messages = append(state.Messages, utils.Message{
-							Role:    "tool",
-							Content: fmt.Sprintf("%v", toolResult),
-						})
-
-						// Add to intermediate results
-						state.IntermediateResults = append(state.IntermediateResults, map[string]interface{}{
-							"step":      state.CurrentStep,
-							"tool":      toolCall.Function.Name,
-							"arguments": args,
-							"result":    toolResult,
-							"error":     true,
-						})
-
-						continue
-					}
+					continue
+				}
 
-					// Convert the result to a string
-					var resultStr string
-					switch r := result.(type) {
-					case string:
-						resultStr = r
-					case []byte:
-						resultStr = string(r)
-					default:
-						// Try to marshal the result to JSON
-						resultBytes, err := json.Marshal(result)
-						if err != nil {
-							resultStr = fmt.Sprintf("%v", result)
-						} else {
-							resultStr = string(resultBytes)
-						}
+				// Execute the tool
+				result, err := handler(args)
+				if err != nil {
+					// If the tool execution fails, return an error message
+					toolResult := map[string]interface{}{
+						"error": fmt.Sprintf("Tool execution failed: %s", err.Error()),
 					}
 
 					// Add the tool result to the conversation
 					state.Messages = append(state.Messages, utils.Message{
-						Role:    "tool",
-						Content: resultStr,
+						Role:       "tool",
+						Content:    fmt.Sprintf("%v", toolResult),
+						ToolCallID: toolCall.ID,
 					})
 
 					// Add to intermediate results
@@ -399,14 +380,49 @@ func runAgent(client *utils.LLMClient, model string, state *AgentState, temperat
 						"step":      state.CurrentStep,
 						"tool":      toolCall.Function.Name,
 						"arguments": args,
-						"result":    result,
-						"error":     false,
+						"result":    toolResult,
+						"error":     true,
 					})
+
+					continue
+				}
+
+				// Convert the result to a string
+				var resultStr string
+				switch r := result.(type) {
+				case string:
+					resultStr = r
+				case []byte:
+					resultStr = string(r)
+				default:
+					// Try to marshal the result to JSON
+					resultBytes, err := json.Marshal(result)
+					if err != nil {
+						resultStr = fmt.Sprintf("%v", result)
+					} else {
+						resultStr = string(resultBytes)
+					}
 				}
 
-				// Continue to the next step
-				continue
+				// Add the tool result to the conversation
+				state.Messages = append(state.Messages, utils.Message{
+					Role:       "tool",
+					Content:    resultStr,
+					ToolCallID: toolCall.ID,
+				})
+
+				// Add to intermediate results
+				state.IntermediateResults = append(state.IntermediateResults, map[string]interface{}{
+					"step":      state.CurrentStep,
+					"tool":      toolCall.Function.Name,
+					"arguments": args,
+					"result":    result,
+					"error":     false,
+				})
 			}
+
+			// Continue to the next step
+			continue
 		}
 
 		// If we reach here, the assistant provided a final answer
@@ -0,0 +1,284 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/robertkrimen/otto"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+)
+
+// toolEnvironmentKey is the shared context key holding the tool environment
+const toolEnvironmentKey = "_tool_environment"
+
+// maxToolFlowDepth bounds flows invoking other flows through agent tools
+const maxToolFlowDepth = 8
+
+// toolBindings are the keys a tool declaration uses to name what it calls
+var toolBindings = []string{"node", "http", "script", "flow", "mcp"}
+
+// toolEnvironment lets agent tools call back into the execution they run in
+type toolEnvironment struct {
+	runtime *flowRuntime
+	execCtx *executionContext
+	ctx     context.Context
+	shared  map[string]interface{}
+}
+
+// toolEnvironmentFrom extracts the tool environment from a node's combined input
+func toolEnvironmentFrom(input interface{}) *toolEnvironment {
+	combinedInput, ok := input.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if env, ok := combinedInput[toolEnvironmentKey].(*toolEnvironment); ok {
+		return env
+	}
+	if flowInput, ok := combinedInput["input"].(map[string]interface{}); ok {
+		if env, ok := flowInput[toolEnvironmentKey].(*toolEnvironment); ok {
+			return env
+		}
+	}
+	return nil
+}
+
+// newToolHandler returns the handler for a tool declared in YAML. A tool binds
+// to exactly one of:
+//
+//	node:   name of a node in the same flow
+//	http:   an http.request spec; ${input.x} expressions see the call arguments
+//	script: a JavaScript snippet with the arguments in `args`
+//	flow:   a registered flow ID, or {id, entrypoint}
+//	mcp:    an MCP server spec with the tool name in `tool`
+//
+// It returns nil when the declaration has no binding.
+func newToolHandler(name string, tool map[string]interface{}, env *toolEnvironment) (func(params map[string]interface{}) (interface{}, error), error) {
+	binding := ""
+	for _, key := range toolBindings {
+		if _, ok := tool[key]; ok {
+			if binding != "" {
+				return nil, fmt.Errorf("tool %s binds to both %s and %s", name, binding, key)
+			}
+			binding = key
+		}
+	}
+
+	switch binding {
+	case "":
+		return nil, nil
+
+	case "node":
+		nodeName, ok := tool["node"].(string)
+		if !ok || nodeName == "" {
+			return nil, fmt.Errorf("tool %s: node must be a node name", name)
+		}
+		return func(args map[string]interface{}) (interface{}, error) {
+			return env.callNode(nodeName, args)
+		}, nil
+
+	case "http":
+		spec, ok := tool["http"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tool %s: http must be an http.request spec", name)
+		}
+		return func(args map[string]interface{}) (interface{}, error) {
+			return env.callHTTP(spec, args)
+		}, nil
+
+	case "script":
+		script, ok := tool["script"].(string)
+		if !ok || script == "" {
+			return nil, fmt.Errorf("tool %s: script must be a JavaScript snippet", name)
+		}
+		return func(args map[string]interface{}) (interface{}, error) {
+			return runToolScript(script, args)
+		}, nil
+
+	case "flow":
+		var flowID, entrypoint string
+		switch flow := tool["flow"].(type) {
+		case string:
+			flowID = flow
+		case map[string]interface{}:
+			flowID, _ = flow["id"].(string)
+			entrypoint, _ = flow["entrypoint"].(string)
+		}
+		if flowID == "" {
+			return nil, fmt.Errorf("tool %s: flow must be a flow ID or {id, entrypoint}", name)
+		}
+		return func(args map[string]interface{}) (interface{}, error) {
+			return env.callFlow(flowID, entrypoint, args)
+		}, nil
+
+	case "mcp":
+		spec, ok := tool["mcp"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tool %s: mcp must be an MCP server spec", name)
+		}
+		toolName, _ := spec["tool"].(string)
+		if toolName == "" {
+			toolName = name
+		}
+		return func(args map[string]interface{}) (interface{}, error) {
+			return callMCPTool(spec, toolName, args)
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// callNode runs a single node of the flow with the call arguments as its
+// shared context and returns the result the node stored
+func (env *toolEnvironment) callNode(nodeName string, args map[string]interface{}) (interface{}, error) {
+	if env == nil || env.execCtx.graph == nil {
+		return nil, fmt.Errorf("node %s can only be called while its flow is executing", nodeName)
+	}
+	node, ok := env.execCtx.graph.Nodes[nodeName]
+	if !ok {
+		return nil, fmt.Errorf("node %s not found in flow %s", nodeName, env.execCtx.flowID)
+	}
+
+	// Internal keys carry the execution handle, flow context and secret vault
+	shared := make(map[string]interface{}, len(args)+len(env.shared))
+	for key, value := range env.shared {
+		if isReservedSharedKey(key) {
+			shared[key] = value
+		}
+	}
+	for key, value := range args {
+		shared[key] = value
+	}
+	shared["input"] = args
+
+	action, err := node.Run(shared)
+	if err != nil {
+		return nil, err
+	}
+	if result, ok := shared["result"]; ok {
+		return result, nil
+	}
+	return map[string]interface{}{"action": action}, nil
+}
+
+// callHTTP sends the request described by an http.request spec. Arguments the
+// spec does not place itself are sent as query parameters for GET requests
+// and as the JSON body otherwise.
+func (env *toolEnvironment) callHTTP(spec map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+	flowContext := NewFlowContext("", "", "", nil)
+	if env != nil {
+		flowContext = NewFlowContext(env.execCtx.status.ID, env.execCtx.flowID, env.execCtx.accountID, env.runtime.secretVault)
+	}
+	for key, value := range args {
+		flowContext.SetSharedData(key, value)
+	}
+
+	params, err := flowContext.ProcessNodeParams(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate http spec: %w", err)
+	}
+
+	if _, hasBody := params["body"]; !hasBody && len(args) > 0 {
+		method, _ := params["method"].(string)
+		if method == "" || strings.EqualFold(method, "GET") {
+			requestURL, _ := params["url"].(string)
+			params["url"] = withQueryArgs(requestURL, args)
+		} else {
+			params["body"] = args
+		}
+	}
+
+	node, err := NewHTTPRequestNodeWrapper(params)
+	if err != nil {
+		return nil, err
+	}
+	return node.(*NodeWrapper).exec(map[string]interface{}{"params": params, toolEnvironmentKey: env})
+}
+
+// withQueryArgs appends args to the query string of requestURL
+func withQueryArgs(requestURL string, args map[string]interface{}) string {
+	parsed, err := url.Parse(requestURL)
+	if err != nil {
+		return requestURL
+	}
+	query := parsed.Query()
+	for key, value := range args {
+		query.Set(key, fmt.Sprint(value))
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// runToolScript runs a JavaScript tool with the call arguments in `args`
+func runToolScript(script string, args map[string]interface{}) (interface{}, error) {
+	vm := otto.New()
+	vm.Set("args", args)
+	vm.Set("input", args)
+
+	result, err := vm.Run("(function() {\n" + script + "\n})()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute tool script: %w", err)
+	}
+	return result.Export()
+}
+
+// callFlow executes a registered flow of the same account with the call
+// arguments as its input and waits for its results
+func (env *toolEnvironment) callFlow(flowID, entrypoint string, args map[string]interface{}) (interface{}, error) {
+	if env == nil {
+		return nil, fmt.Errorf("flow %s can only be called during a flow execution", flowID)
+	}
+
+	depth, _ := strconv.Atoi(env.execCtx.status.Metadata["tool_depth"])
+	if depth >= maxToolFlowDepth {
+		return nil, fmt.Errorf("flow %s: agent tools nested deeper than %d flows", flowID, maxToolFlowDepth)
+	}
+
+	accountID := env.execCtx.accountID
+	flowDef, err := env.runtime.registry.GetFlow(accountID, flowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow: %w", err)
+	}
+
+	child, err := env.runtime.launchExecution(accountID, flowID, flowDef, args, executionStart{
+		entrypoint: entrypoint,
+		metadata: map[string]string{
+			"parent_execution": env.execCtx.status.ID,
+			"tool_depth":       strconv.Itoa(depth + 1),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-child.done:
+	case <-env.ctx.Done():
+		env.runtime.Cancel(child.status.ID)
+		return nil, env.ctx.Err()
+	}
+
+	child.mu.RLock()
+	status := child.status
+	child.mu.RUnlock()
+
+	if status.Status != "completed" {
+		return nil, fmt.Errorf("flow %s %s: %s", flowID, status.Status, status.Error)
+	}
+	return status.Results, nil
+}
+
+// callMCPTool calls a tool on the MCP server described by spec
+func callMCPTool(spec map[string]interface{}, toolName string, args map[string]interface{}) (interface{}, error) {
+	params := make(map[string]interface{}, len(spec)+2)
+	for key, value := range spec {
+		params[key] = value
+	}
+	params["operation"] = "executeTool"
+	params["toolName"] = toolName
+	delete(params, "toolParameters")
+
+	return (&plugins.MCPPlugin{}).Execute(params, args)
+}
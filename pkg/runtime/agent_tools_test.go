@@ -0,0 +1,197 @@
+package runtime_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/mcp/mcptest"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// newToolCallingLLM returns a chat completions server that calls every tool
+// once with the given arguments and then answers with the tool results
+func newToolCallingLLM(t *testing.T, calls map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Messages []struct {
+				Role       string `json:"role"`
+				Content    string `json:"content"`
+				ToolCallID string `json:"tool_call_id"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		var message map[string]interface{}
+		if last := request.Messages[len(request.Messages)-1]; last.Role == "tool" {
+			results := map[string]string{}
+			for _, m := range request.Messages {
+				if m.Role == "tool" {
+					results[m.ToolCallID] = m.Content
+				}
+			}
+			answer, _ := json.Marshal(results)
+			message = map[string]interface{}{"role": "assistant", "content": string(answer)}
+		} else {
+			var toolCalls []interface{}
+			for name, arguments := range calls {
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":       name,
+					"type":     "function",
+					"function": map[string]interface{}{"name": name, "arguments": arguments},
+				})
+			}
+			message = map[string]interface{}{"role": "assistant", "tool_calls": toolCalls}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"index": 0, "message": message}},
+		})
+	}))
+}
+
+func TestAgentNode_ToolBindings(t *testing.T) {
+	llm := newToolCallingLLM(t, map[string]string{
+		"lookup_customer": `{"id": "c-42"}`,
+		"get_weather":     `{"city": "Oslo"}`,
+		"double":          `{"value": 21}`,
+		"refund":          `{"data": {"amount": 5}}`,
+		"search_docs":     `{"query": "refunds"}`,
+	})
+	defer llm.Close()
+
+	weather := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"city": %q, "forecast": "rain"}`, r.URL.Query().Get("city"))
+	}))
+	defer weather.Close()
+
+	mcpServer := httptest.NewServer(mcptest.NewServer())
+	defer mcpServer.Close()
+
+	mockRegistry := new(IntegrationMockFlowRegistry)
+	nodeFactories := map[string]plugins.NodeFactory{}
+	for nodeType, factory := range runtime.CoreNodeTypes() {
+		nodeFactories[nodeType] = &replayNodeFactory{factory: factory}
+	}
+	yamlLoader := loader.NewYAMLLoader(nodeFactories, plugins.NewPluginRegistry())
+
+	mockRegistry.On("GetFlow", "test-account", "support").Return(&runtime.Flow{
+		ID: "support",
+		YAML: fmt.Sprintf(`
+metadata:
+  name: support
+  start: assistant
+nodes:
+  assistant:
+    type: agent
+    params:
+      provider: generic
+      api_key: test-key
+      model: test-model
+      prompt: Help the customer
+      options:
+        base_url: %s
+      tools:
+        - function:
+            name: lookup_customer
+            parameters: {type: object}
+          node: lookup
+        - function:
+            name: get_weather
+            parameters: {type: object}
+          http:
+            url: %s/weather
+        - function:
+            name: double
+            parameters: {type: object}
+          script: "return {doubled: args.value * 2};"
+        - function:
+            name: refund
+            parameters: {type: object}
+          flow: refund-flow
+        - function:
+            name: search_docs
+            parameters: {type: object}
+          mcp:
+            connectionType: http
+            url: %s
+            tool: echo
+  lookup:
+    type: transform
+    params:
+      script: "return {customer: input.id, tier: 'gold'};"
+`, llm.URL, weather.URL, mcpServer.URL),
+	}, nil)
+	mockRegistry.On("GetFlow", "test-account", "refund-flow").Return(&runtime.Flow{
+		ID: "refund-flow",
+		YAML: `
+metadata:
+  name: refund-flow
+nodes:
+  refund:
+    type: transform
+    params:
+      script: "return {refunded: input.data.amount};"
+`,
+	}, nil)
+
+	store := newReplayExecutionStore()
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockRegistry, yamlLoader, store)
+
+	executionID, err := flowRuntime.Execute("test-account", "support", map[string]interface{}{
+		"data": map[string]interface{}{"ticket": 7},
+	})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	agentResult := status.Results["result"].(map[string]interface{})
+	var answers map[string]string
+	require.NoError(t, json.Unmarshal([]byte(agentResult["response"].(string)), &answers))
+
+	decode := func(tool string) map[string]interface{} {
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(answers[tool]), &decoded), answers[tool])
+		return decoded
+	}
+
+	assert.Equal(t, map[string]interface{}{"customer": "c-42", "tier": "gold"}, decode("lookup_customer"))
+	assert.Equal(t, map[string]interface{}{"doubled": float64(42)}, decode("double"))
+	assert.Equal(t, "rain", decode("get_weather")["body"].(map[string]interface{})["forecast"])
+	assert.Equal(t, "Oslo", decode("get_weather")["body"].(map[string]interface{})["city"])
+	assert.Equal(t, map[string]interface{}{"refunded": float64(5)}, decode("refund")["result"])
+	assert.Equal(t, map[string]interface{}{"query": "refunds"}, decode("search_docs")["result"])
+}
+
+func TestAgentNode_UnboundToolReportsError(t *testing.T) {
+	llm := newToolCallingLLM(t, map[string]string{"mystery": `{}`})
+	defer llm.Close()
+
+	node, err := runtime.NewAgentNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(map[string]interface{}{
+		"provider": "generic",
+		"api_key":  "test-key",
+		"model":    "test-model",
+		"prompt":   "Do something",
+		"options":  map[string]interface{}{"base_url": llm.URL},
+		"tools": []interface{}{
+			map[string]interface{}{"function": map[string]interface{}{"name": "mystery"}},
+		},
+	})
+
+	shared := map[string]interface{}{}
+	_, err = node.Run(shared)
+	require.NoError(t, err)
+	assert.Contains(t, shared["result"].(map[string]interface{})["response"], "no handler defined for tool: mystery")
+}
@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/tcmartin/flowlib"
+)
+
+// NewArtifactNodeWrapper creates a new artifact node wrapper, storing
+// content as an artifact of the execution (put) or reading the content of
+// an artifact reference (get)
+func NewArtifactNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
+	// Create the base node
+	baseNode := flowlib.NewNode(1, 0)
+
+	// Create the wrapper
+	wrapper := &NodeWrapper{
+		node: baseNode,
+		exec: func(input interface{}) (interface{}, error) {
+			params, err := combinedParams(input)
+			if err != nil {
+				return nil, err
+			}
+
+			env := toolEnvironmentFrom(input)
+			if env.artifactStore() == nil {
+				return nil, fmt.Errorf("artifact storage is not configured")
+			}
+
+			operation := stringParamOr(params["operation"], "put")
+			switch operation {
+			case "put":
+				var content []byte
+				switch v := params["content"].(type) {
+				case string:
+					content = []byte(v)
+					if encoding, _ := params["encoding"].(string); encoding == "base64" {
+						decoded, err := base64.StdEncoding.DecodeString(v)
+						if err != nil {
+							return nil, fmt.Errorf("content is not valid base64: %w", err)
+						}
+						content = decoded
+					}
+				case []byte:
+					content = v
+				case nil:
+					return nil, fmt.Errorf("content parameter is required")
+				default:
+					return nil, fmt.Errorf("content must be a string, got %T", v)
+				}
+
+				name, _ := params["name"].(string)
+				contentType, _ := params["content_type"].(string)
+				artifact, err := env.createArtifact(name, contentType, bytes.NewReader(content))
+				if err != nil {
+					return nil, err
+				}
+				return artifact.Ref(), nil
+
+			case "get":
+				ref, ok := params["artifact"]
+				if !ok {
+					return nil, fmt.Errorf("artifact parameter is required")
+				}
+				artifact, content, err := env.readArtifact(ref)
+				if err != nil {
+					return nil, err
+				}
+
+				// Content is returned as text unless asked for base64, as
+				// bytes would be stored as an artifact again
+				result := artifact.Ref()
+				switch encoding := stringParamOr(params["encoding"], "text"); encoding {
+				case "text":
+					result["content"] = string(content)
+				case "base64":
+					result["content"] = base64.StdEncoding.EncodeToString(content)
+				default:
+					return nil, fmt.Errorf("unsupported encoding %q", encoding)
+				}
+				return result, nil
+
+			default:
+				return nil, fmt.Errorf("unsupported artifact operation %q", operation)
+			}
+		},
+	}
+
+	// Set the parameters
+	wrapper.SetParams(params)
+
+	return wrapper, nil
+}
@@ -0,0 +1,364 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// ErrArtifactNotFound is returned for artifacts and blobs that are not
+// stored, or that belong to another account
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// artifactScheme prefixes the URIs of artifact references
+const artifactScheme = "artifact://"
+
+// Artifact is a file produced or consumed by an execution. Its content is a
+// blob addressed by its digest, so that identical files are stored once.
+type Artifact struct {
+	ID          string `json:"id"`
+	ExecutionID string `json:"execution_id"`
+	AccountID   string `json:"account_id"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+
+	// Digest is the SHA-256 of the content, as "sha256:<hex>"
+	Digest string `json:"digest"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// URI returns the URI referencing the artifact
+func (a Artifact) URI() string {
+	return artifactScheme + a.ExecutionID + "/" + a.ID
+}
+
+// Ref returns the reference to the artifact that flows carry in their
+// shared context instead of its content
+func (a Artifact) Ref() map[string]interface{} {
+	ref := map[string]interface{}{
+		"artifact":     a.URI(),
+		"content_type": a.ContentType,
+		"size":         a.Size,
+		"digest":       a.Digest,
+	}
+	if a.Name != "" {
+		ref["name"] = a.Name
+	}
+	return ref
+}
+
+// ParseArtifactURI splits an artifact URI into the execution and artifact
+// IDs
+func ParseArtifactURI(uri string) (executionID, artifactID string, ok bool) {
+	rest, found := strings.CutPrefix(uri, artifactScheme)
+	if !found {
+		return "", "", false
+	}
+	executionID, artifactID, found = strings.Cut(rest, "/")
+	if !found || executionID == "" || artifactID == "" {
+		return "", "", false
+	}
+	return executionID, artifactID, true
+}
+
+// ArtifactStore keeps the content of artifacts as blobs addressed by their
+// digest, and the artifacts of each execution
+type ArtifactStore interface {
+	// PutBlob stores the content read from r and returns its digest and
+	// size
+	PutBlob(r io.Reader) (digest string, size int64, err error)
+
+	// OpenBlob opens the content of a blob
+	OpenBlob(digest string) (io.ReadCloser, error)
+
+	SaveArtifact(artifact Artifact) error
+	GetArtifact(executionID, artifactID string) (Artifact, error)
+	ListArtifacts(executionID string) ([]Artifact, error)
+}
+
+// SetArtifactStore sets where the runtime keeps artifacts. With a store,
+// byte contents of execution inputs and node results are stored as
+// artifacts and replaced by references.
+func (r *flowRuntime) SetArtifactStore(store ArtifactStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.artifactStore = store
+}
+
+func (r *flowRuntime) artifacts() (ArtifactStore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.artifactStore == nil {
+		return nil, fmt.Errorf("artifact storage is not configured")
+	}
+	return r.artifactStore, nil
+}
+
+// ListArtifacts returns the artifacts of an execution of an account
+func (r *flowRuntime) ListArtifacts(accountID, executionID string) ([]Artifact, error) {
+	store, err := r.artifacts()
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := store.ListArtifacts(executionID)
+	if err != nil {
+		return nil, err
+	}
+	owned := make([]Artifact, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		if artifact.AccountID == accountID {
+			owned = append(owned, artifact)
+		}
+	}
+	return owned, nil
+}
+
+// OpenArtifact returns an artifact of an account and opens its content
+func (r *flowRuntime) OpenArtifact(accountID, executionID, artifactID string) (Artifact, io.ReadCloser, error) {
+	store, err := r.artifacts()
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+	artifact, err := store.GetArtifact(executionID, artifactID)
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+	if artifact.AccountID != accountID {
+		return Artifact{}, nil, ErrArtifactNotFound
+	}
+	content, err := store.OpenBlob(artifact.Digest)
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+	return artifact, content, nil
+}
+
+// createArtifact stores content as an artifact of an execution. The
+// content type is sniffed from the content when not given.
+func createArtifact(store ArtifactStore, accountID, executionID, name, contentType string, content io.Reader) (Artifact, error) {
+	if contentType == "" {
+		var head [512]byte
+		n, err := io.ReadFull(content, head[:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return Artifact{}, fmt.Errorf("failed to read artifact content: %w", err)
+		}
+		contentType = http.DetectContentType(head[:n])
+		content = io.MultiReader(bytes.NewReader(head[:n]), content)
+	}
+
+	digest, size, err := store.PutBlob(content)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact content: %w", err)
+	}
+	artifact := Artifact{
+		ID:          uuid.New().String(),
+		ExecutionID: executionID,
+		AccountID:   accountID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		Digest:      digest,
+		CreatedAt:   time.Now(),
+	}
+	if err := store.SaveArtifact(artifact); err != nil {
+		return Artifact{}, fmt.Errorf("failed to save artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// artifactStore returns the artifact store of the execution, or nil when
+// the runtime keeps no artifacts
+func (env *toolEnvironment) artifactStore() ArtifactStore {
+	if env == nil || env.runtime == nil || env.execCtx == nil {
+		return nil
+	}
+	env.runtime.mu.RLock()
+	defer env.runtime.mu.RUnlock()
+	return env.runtime.artifactStore
+}
+
+// createArtifact stores content as an artifact of the execution
+func (env *toolEnvironment) createArtifact(name, contentType string, content io.Reader) (Artifact, error) {
+	store := env.artifactStore()
+	if store == nil {
+		return Artifact{}, fmt.Errorf("artifact storage is not configured")
+	}
+	return createArtifact(store, env.execCtx.accountID, env.execCtx.status.ID, name, contentType, content)
+}
+
+// openArtifact resolves a reference, given as its URI or as the map of
+// Artifact.Ref, to an artifact of the execution's account and opens its
+// content
+func (env *toolEnvironment) openArtifact(ref interface{}) (Artifact, io.ReadCloser, error) {
+	uri, ok := ref.(string)
+	if !ok {
+		uri, _ = mapParam(ref)["artifact"].(string)
+	}
+	executionID, artifactID, ok := ParseArtifactURI(uri)
+	if !ok {
+		return Artifact{}, nil, fmt.Errorf("invalid artifact reference %v", ref)
+	}
+	if env.artifactStore() == nil {
+		return Artifact{}, nil, fmt.Errorf("artifact storage is not configured")
+	}
+	artifact, content, err := env.runtime.OpenArtifact(env.execCtx.accountID, executionID, artifactID)
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("failed to open artifact %s: %w", uri, err)
+	}
+	return artifact, content, nil
+}
+
+// readArtifact resolves a reference like openArtifact and reads the content
+func (env *toolEnvironment) readArtifact(ref interface{}) (Artifact, []byte, error) {
+	artifact, content, err := env.openArtifact(ref)
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("failed to read artifact %s: %w", artifact.URI(), err)
+	}
+	return artifact, data, nil
+}
+
+// isArtifactRef reports whether a value is a reference to an artifact
+func isArtifactRef(value interface{}) bool {
+	uri, ok := value.(string)
+	if !ok {
+		uri, _ = mapParam(value)["artifact"].(string)
+	}
+	_, _, ok = ParseArtifactURI(uri)
+	return ok
+}
+
+// artifactAttachmentRef returns the artifact reference of an attachment,
+// given in place of the attachment or of its content, or nil when there is
+// none
+func artifactAttachmentRef(attachment map[string]interface{}) interface{} {
+	if isArtifactRef(attachment) {
+		return attachment
+	}
+	if content, ok := attachment["content"].(map[string]interface{}); ok && isArtifactRef(content) {
+		return content
+	}
+	return nil
+}
+
+// artifactExternalizer replaces the byte contents of values with references
+// to artifacts of an execution
+type artifactExternalizer struct {
+	store       ArtifactStore
+	accountID   string
+	executionID string
+}
+
+// externalize returns value with byte slices and email attachments
+// replaced by artifact references, and whether it replaced any. Maps and
+// slices holding them are copied rather than modified.
+func (x artifactExternalizer) externalize(value interface{}) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case []byte:
+		artifact, err := createArtifact(x.store, x.accountID, x.executionID, "", "", bytes.NewReader(v))
+		if err != nil {
+			return nil, false, err
+		}
+		return artifact.Ref(), true, nil
+	case utils.EmailAttachment:
+		ref, err := x.attachment(v)
+		return ref, err == nil, err
+	case []utils.EmailAttachment:
+		attachments := make([]interface{}, len(v))
+		for i, attachment := range v {
+			ref, err := x.attachment(attachment)
+			if err != nil {
+				return nil, false, err
+			}
+			attachments[i] = ref
+		}
+		return attachments, true, nil
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		replaced := false
+		for key, item := range v {
+			externalized, changed, err := x.externalize(item)
+			if err != nil {
+				return nil, false, err
+			}
+			copied[key] = externalized
+			replaced = replaced || changed
+		}
+		if !replaced {
+			return v, false, nil
+		}
+		return copied, true, nil
+	case []map[string]interface{}:
+		copied := make([]map[string]interface{}, len(v))
+		replaced := false
+		for i, item := range v {
+			externalized, changed, err := x.externalize(item)
+			if err != nil {
+				return nil, false, err
+			}
+			copied[i] = externalized.(map[string]interface{})
+			replaced = replaced || changed
+		}
+		if !replaced {
+			return v, false, nil
+		}
+		return copied, true, nil
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		replaced := false
+		for i, item := range v {
+			externalized, changed, err := x.externalize(item)
+			if err != nil {
+				return nil, false, err
+			}
+			copied[i] = externalized
+			replaced = replaced || changed
+		}
+		if !replaced {
+			return v, false, nil
+		}
+		return copied, true, nil
+	}
+	return value, false, nil
+}
+
+// attachment returns the reference to an email attachment stored as an
+// artifact, keeping its filename and content ID
+func (x artifactExternalizer) attachment(attachment utils.EmailAttachment) (map[string]interface{}, error) {
+	artifact, err := createArtifact(x.store, x.accountID, x.executionID, attachment.Filename, attachment.ContentType, bytes.NewReader(attachment.Content))
+	if err != nil {
+		return nil, err
+	}
+	ref := artifact.Ref()
+	ref["filename"] = attachment.Filename
+	if attachment.ContentID != "" {
+		ref["content_id"] = attachment.ContentID
+	}
+	return ref, nil
+}
+
+// externalizeArtifacts replaces the byte contents of the result of a node
+// with references to artifacts of the execution, when the runtime keeps
+// artifacts
+func externalizeArtifacts(env *toolEnvironment, result interface{}) (interface{}, error) {
+	store := env.artifactStore()
+	if store == nil {
+		return result, nil
+	}
+	x := artifactExternalizer{store: store, accountID: env.execCtx.accountID, executionID: env.execCtx.status.ID}
+	externalized, _, err := x.externalize(result)
+	return externalized, err
+}
@@ -0,0 +1,235 @@
+package runtime_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// newArtifactRuntime returns a runtime keeping artifacts in a temporary
+// directory, running a flow "call" of a single node of the given type
+func newArtifactRuntime(t *testing.T, nodeType string, params map[string]interface{}) runtime.ArtifactFlowRuntime {
+	t.Helper()
+	flowRuntime, _ := newNodeAuthRuntime(t, nodeType, params)
+	store, err := storage.NewFileArtifactStore(t.TempDir())
+	require.NoError(t, err)
+	artifacts := flowRuntime.(runtime.ArtifactFlowRuntime)
+	artifacts.SetArtifactStore(store)
+	return artifacts
+}
+
+// readArtifact returns the content of an artifact reference
+func readArtifact(t *testing.T, flowRuntime runtime.ArtifactFlowRuntime, ref interface{}) (runtime.Artifact, string) {
+	t.Helper()
+	uri, _ := ref.(map[string]interface{})["artifact"].(string)
+	executionID, artifactID, ok := runtime.ParseArtifactURI(uri)
+	require.True(t, ok, "not an artifact reference: %v", ref)
+	artifact, content, err := flowRuntime.OpenArtifact("test-account", executionID, artifactID)
+	require.NoError(t, err)
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	return artifact, string(data)
+}
+
+func TestArtifacts_InputBytesAreReferenced(t *testing.T) {
+	flowRuntime := newArtifactRuntime(t, "artifact", map[string]interface{}{
+		"operation": "get",
+		"artifact":  "${input.report.artifact}",
+	})
+
+	input := map[string]interface{}{"report": []byte("id,total\n1,42\n")}
+	executionID, err := flowRuntime.Execute("test-account", "call", input)
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	// The input holds a reference, and the caller's map is left as is
+	assert.Equal(t, []byte("id,total\n1,42\n"), input["report"])
+	ref := status.Input["report"].(map[string]interface{})
+	artifact, content := readArtifact(t, flowRuntime, ref)
+	assert.Equal(t, "id,total\n1,42\n", content)
+	assert.Equal(t, executionID, artifact.ExecutionID)
+	assert.Equal(t, "text/plain; charset=utf-8", artifact.ContentType)
+
+	result := status.Results["result"].(map[string]interface{})
+	assert.Equal(t, "id,total\n1,42\n", result["content"])
+	assert.Equal(t, ref["artifact"], result["artifact"])
+
+	artifacts, err := flowRuntime.ListArtifacts("test-account", executionID)
+	require.NoError(t, err)
+	assert.Equal(t, []runtime.Artifact{artifact}, artifacts)
+	artifacts, err = flowRuntime.ListArtifacts("other-account", executionID)
+	require.NoError(t, err)
+	assert.Empty(t, artifacts)
+}
+
+func TestArtifacts_ReceivedAttachmentsAreReferenced(t *testing.T) {
+	flowRuntime := newArtifactRuntime(t, "artifact", map[string]interface{}{"content": "report"})
+
+	// Received emails are a list of maps holding their attachments
+	input := map[string]interface{}{"emails": []map[string]interface{}{{
+		"subject": "Invoice",
+		"attachments": []interface{}{map[string]interface{}{
+			"filename":     "invoice.pdf",
+			"content_type": "application/pdf",
+			"content":      []byte("%PDF-1.4 invoice"),
+		}},
+	}}}
+	executionID, err := flowRuntime.Execute("test-account", "call", input)
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	emails := status.Input["emails"].([]map[string]interface{})
+	require.Len(t, emails, 1)
+	assert.Equal(t, "Invoice", emails[0]["subject"])
+	attachments := emails[0]["attachments"].([]interface{})
+	require.Len(t, attachments, 1)
+	attachment := attachments[0].(map[string]interface{})
+	assert.Equal(t, "invoice.pdf", attachment["filename"])
+	artifact, content := readArtifact(t, flowRuntime, attachment["content"])
+	assert.Equal(t, "%PDF-1.4 invoice", content)
+	assert.Equal(t, "application/pdf", artifact.ContentType)
+}
+
+func TestArtifacts_PutStoresContent(t *testing.T) {
+	flowRuntime := newArtifactRuntime(t, "artifact", map[string]interface{}{
+		"operation": "put",
+		"name":      "logo.png",
+		"content":   "iVBORw0KGgo=",
+		"encoding":  "base64",
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	result := status.Results["result"].(map[string]interface{})
+	assert.Equal(t, "logo.png", result["name"])
+	artifact, content := readArtifact(t, flowRuntime, result)
+	assert.Equal(t, "\x89PNG\r\n\x1a\n", content)
+	assert.Equal(t, "image/png", artifact.ContentType)
+	assert.Equal(t, int64(8), artifact.Size)
+}
+
+func TestArtifacts_WithoutStore(t *testing.T) {
+	flowRuntime, _ := newNodeAuthRuntime(t, "artifact", map[string]interface{}{"content": "report"})
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "artifact storage is not configured")
+}
+
+func TestHTTPRequest_DownloadToArtifact(t *testing.T) {
+	pdf := []byte("%PDF-1.4 report")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(pdf)
+	}))
+	defer server.Close()
+
+	flowRuntime := newArtifactRuntime(t, "http.request", map[string]interface{}{
+		"url":      server.URL + "/exports/report.pdf",
+		"download": map[string]interface{}{"artifact": true},
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	download := status.Results["result"].(map[string]interface{})["download"].(map[string]interface{})
+	assert.Equal(t, "report.pdf", download["name"])
+	assert.EqualValues(t, len(pdf), download["bytes"])
+	artifact, content := readArtifact(t, flowRuntime, download)
+	assert.Equal(t, string(pdf), content)
+	assert.Equal(t, "application/pdf", artifact.ContentType)
+}
+
+func TestEmailSend_AttachmentFromArtifact(t *testing.T) {
+	capture := newSMTPCapture(t)
+	flowRuntime := newArtifactRuntime(t, "email.send", map[string]interface{}{
+		"smtp_host": "127.0.0.1",
+		"smtp_port": capture.port(),
+		"username":  "billing@example.com",
+		"password":  "secret",
+		"to":        "ada@example.com",
+		"subject":   "Your invoice",
+		"body":      "Please find your invoice attached.",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"artifact": "${input.invoice.artifact}",
+				"filename": "invoice.pdf",
+			},
+			map[string]interface{}{
+				"content":  "${input.invoice}",
+				"filename": "copy.pdf",
+			},
+		},
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{"invoice": []byte("%PDF-1.4 invoice")})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	_, _, data := capture.message()
+	email, err := utils.ParseEmailMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, email.Attachments, 2)
+	assert.Equal(t, "invoice.pdf", email.Attachments[0].Filename)
+	assert.Equal(t, "application/pdf", email.Attachments[0].ContentType)
+	assert.Equal(t, "%PDF-1.4 invoice", string(email.Attachments[0].Content))
+
+	// A reference in place of the content, as the mailbox watcher gives it
+	assert.Equal(t, "copy.pdf", email.Attachments[1].Filename)
+	assert.Equal(t, "%PDF-1.4 invoice", string(email.Attachments[1].Content))
+}
+
+func TestGRPC_DescriptorSetFromArtifact(t *testing.T) {
+	// The server has no reflection service to describe itself
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	data, err := proto.Marshal(set)
+	require.NoError(t, err)
+
+	// The uploaded descriptor set is stored as an artifact of the execution
+	flowRuntime := newArtifactRuntime(t, "grpc", map[string]interface{}{
+		"address":        listener.Addr().String(),
+		"plaintext":      true,
+		"method":         "grpc.health.v1.Health/Check",
+		"descriptor_set": "${input.descriptors.artifact}",
+	})
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{"descriptors": data})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, map[string]interface{}{"status": "SERVING"}, status.Results["result"].(map[string]interface{})["response"])
+}
@@ -0,0 +1,381 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// ErrConversationNotFound is returned for sessions without a stored
+// conversation
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ErrConversationConflict is returned when saving a conversation that was
+// changed since it was loaded
+var ErrConversationConflict = errors.New("conversation changed since it was loaded")
+
+// Conversation is the memory of a multi-turn conversation of llm and agent
+// nodes, keyed by session
+type Conversation struct {
+	AccountID string `json:"account_id"`
+	SessionID string `json:"session_id"`
+
+	// Messages are the turns kept in memory, oldest first
+	Messages []utils.Message `json:"messages"`
+
+	// Summary summarizes the turns dropped from Messages by the summarize
+	// strategy
+	Summary string `json:"summary,omitempty"`
+
+	// Version counts the saves of the conversation; it is 0 for
+	// conversations that were never saved
+	Version int64 `json:"version"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConversationStore persists conversation memory
+type ConversationStore interface {
+	// SaveConversation stores a conversation when the stored one is still
+	// at its Version, or none is stored for Version 0, and increments the
+	// stored Version. Otherwise it returns ErrConversationConflict.
+	SaveConversation(conversation Conversation) error
+	GetConversation(accountID, sessionID string) (Conversation, error)
+	ListConversations(accountID string) ([]Conversation, error)
+	DeleteConversation(accountID, sessionID string) error
+}
+
+// Strategies keeping a conversation under its memory budget
+const (
+	// MemoryWindow drops the oldest turns
+	MemoryWindow = "window"
+
+	// MemorySummarize replaces the oldest turns with a summary written by
+	// the node's model
+	MemorySummarize = "summarize"
+)
+
+const (
+	defaultMemoryMaxMessages = 20
+	defaultMemoryMaxTokens   = 4000
+
+	// maxConversationSaves bounds the attempts to save a turn of a
+	// conversation that other executions keep changing
+	maxConversationSaves = 5
+)
+
+// conversationMemory is the memory configuration of a node
+type conversationMemory struct {
+	sessionID   string
+	strategy    string
+	maxMessages int
+	maxTokens   int
+}
+
+// newConversationMemory returns the memory configuration of a node, or nil
+// when it has none. The session defaults to the session_id of the shared
+// context.
+func newConversationMemory(params map[string]interface{}, env *toolEnvironment) (*conversationMemory, error) {
+	config := mapParam(params["memory"])
+	if config == nil {
+		return nil, nil
+	}
+
+	memory := &conversationMemory{
+		strategy:    MemoryWindow,
+		maxMessages: intParam(config["max_messages"], defaultMemoryMaxMessages),
+		maxTokens:   intParam(config["max_tokens"], defaultMemoryMaxTokens),
+	}
+	memory.sessionID, _ = config["session_id"].(string)
+	if memory.sessionID == "" && env != nil {
+		memory.sessionID, _ = env.shared["session_id"].(string)
+	}
+	if memory.sessionID == "" {
+		return nil, fmt.Errorf("memory requires a session_id")
+	}
+
+	if strategy, ok := config["strategy"].(string); ok && strategy != "" {
+		if strategy != MemoryWindow && strategy != MemorySummarize {
+			return nil, fmt.Errorf("unknown memory strategy %q", strategy)
+		}
+		memory.strategy = strategy
+	}
+	return memory, nil
+}
+
+// withHistory inserts the remembered conversation between the system
+// messages of a request and its new turn
+func (c *Conversation) withHistory(messages []utils.Message) []utils.Message {
+	var system, turn []utils.Message
+	for _, message := range messages {
+		if message.Role == "system" {
+			system = append(system, message)
+		} else {
+			turn = append(turn, message)
+		}
+	}
+
+	history := make([]utils.Message, 0, len(messages)+len(c.Messages)+1)
+	history = append(history, system...)
+	if c.Summary != "" {
+		history = append(history, utils.Message{Role: "system", Content: "Summary of the earlier conversation:\n" + c.Summary})
+	}
+	history = append(history, c.Messages...)
+	return append(history, turn...)
+}
+
+// newTurn returns the messages of a request a conversation remembers: the
+// turn after its system messages
+func newTurn(messages []utils.Message) []utils.Message {
+	var turn []utils.Message
+	for _, message := range messages {
+		if message.Role != "system" {
+			turn = append(turn, message)
+		}
+	}
+	return turn
+}
+
+// overBudget reports whether messages and a summary exceed the limits scaled
+// by fraction
+func (m *conversationMemory) overBudget(messages []utils.Message, summary string, fraction float64) bool {
+	if m.maxMessages > 0 && float64(len(messages)) > float64(m.maxMessages)*fraction {
+		return true
+	}
+	return m.maxTokens > 0 && float64(estimateTokens(messages, summary)) > float64(m.maxTokens)*fraction
+}
+
+// remember appends a turn to the conversation and brings it back under the
+// memory budget. With the summarize strategy the dropped turns are folded
+// into the summary by summarize; the window strategy, or a failed summary,
+// simply drops them.
+func (m *conversationMemory) remember(conversation *Conversation, turn []utils.Message,
+	summarize func(summary string, dropped []utils.Message) (string, error),
+	logf func(level, message string, data map[string]interface{})) {
+
+	for _, message := range turn {
+		// Tool calls are not remembered, as the requests they were answered
+		// in are gone
+		if message.Role == "tool" || (message.Content == "" && len(message.ToolCalls) > 0) {
+			continue
+		}
+		message.ToolCalls = nil
+		conversation.Messages = append(conversation.Messages, message)
+	}
+	conversation.UpdatedAt = time.Now()
+	if conversation.CreatedAt.IsZero() {
+		conversation.CreatedAt = conversation.UpdatedAt
+	}
+
+	messages := conversation.Messages
+	if !m.overBudget(messages, conversation.Summary, 1) {
+		return
+	}
+
+	// Summaries are written for half the budget, so that the model is not
+	// asked for one on every turn
+	fraction := 1.0
+	if m.strategy == MemorySummarize {
+		fraction = 0.5
+	}
+	drop := 0
+	for drop < len(messages) && m.overBudget(messages[drop:], conversation.Summary, fraction) {
+		drop++
+	}
+	// The remembered conversation starts with a user turn
+	for drop < len(messages) && messages[drop].Role != "user" {
+		drop++
+	}
+	dropped := messages[:drop]
+	conversation.Messages = append([]utils.Message(nil), messages[drop:]...)
+
+	if m.strategy != MemorySummarize || len(dropped) == 0 {
+		return
+	}
+	summary, err := summarize(conversation.Summary, dropped)
+	if err != nil {
+		logf("warn", "Failed to summarize conversation, dropping the oldest turns", map[string]interface{}{
+			"session_id": m.sessionID,
+			"error":      err.Error(),
+		})
+		return
+	}
+	conversation.Summary = summary
+	logf("info", "Summarized conversation", map[string]interface{}{
+		"session_id": m.sessionID,
+		"summarized": len(dropped),
+	})
+}
+
+// summaryRequest returns the request asking a model to fold turns into the
+// summary of a conversation
+func summaryRequest(summary string, dropped []utils.Message) utils.LLMRequest {
+	var transcript strings.Builder
+	if summary != "" {
+		transcript.WriteString("Summary so far:\n" + summary + "\n\n")
+	}
+	transcript.WriteString("Conversation:\n")
+	for _, message := range dropped {
+		fmt.Fprintf(&transcript, "%s: %s\n", message.Role, message.Content)
+	}
+
+	return utils.LLMRequest{
+		Messages: []utils.Message{
+			{
+				Role: "system",
+				Content: "Summarize the conversation below for your own memory. Keep facts, names, " +
+					"preferences, decisions and open questions. Reply with the summary only.",
+			},
+			{Role: "user", Content: transcript.String()},
+		},
+		Temperature: 0,
+	}
+}
+
+// estimateTokens estimates the tokens of messages and a summary at about
+// four characters a token
+func estimateTokens(messages []utils.Message, summary string) int {
+	chars := len(summary)
+	for _, message := range messages {
+		// Each message costs a few tokens of framing
+		chars += len(message.Content) + 16
+	}
+	return chars / 4
+}
+
+// SetConversationStore sets where the runtime keeps conversation memory
+func (r *flowRuntime) SetConversationStore(store ConversationStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conversationStore = store
+}
+
+func (r *flowRuntime) conversations() (ConversationStore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.conversationStore == nil {
+		return nil, fmt.Errorf("conversation memory is not configured")
+	}
+	return r.conversationStore, nil
+}
+
+// GetConversation returns the conversation of a session
+func (r *flowRuntime) GetConversation(accountID, sessionID string) (Conversation, error) {
+	store, err := r.conversations()
+	if err != nil {
+		return Conversation{}, err
+	}
+	return store.GetConversation(accountID, sessionID)
+}
+
+// ListConversations returns the conversations of an account
+func (r *flowRuntime) ListConversations(accountID string) ([]Conversation, error) {
+	store, err := r.conversations()
+	if err != nil {
+		return nil, err
+	}
+	return store.ListConversations(accountID)
+}
+
+// DeleteConversation forgets the conversation of a session
+func (r *flowRuntime) DeleteConversation(accountID, sessionID string) error {
+	store, err := r.conversations()
+	if err != nil {
+		return err
+	}
+	return store.DeleteConversation(accountID, sessionID)
+}
+
+// loadConversation returns the conversation of the memory's session in the
+// account of the running execution, or a new one
+func (e *toolEnvironment) loadConversation(memory *conversationMemory) (*Conversation, error) {
+	if e == nil || e.runtime == nil || e.execCtx == nil {
+		return nil, fmt.Errorf("conversation memory requires a flow execution")
+	}
+	store, err := e.runtime.conversations()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, err := store.GetConversation(e.execCtx.accountID, memory.sessionID)
+	if errors.Is(err, ErrConversationNotFound) {
+		return &Conversation{AccountID: e.execCtx.accountID, SessionID: memory.sessionID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation %s: %w", memory.sessionID, err)
+	}
+	return &conversation, nil
+}
+
+// log writes to the log of the running execution
+func (e *toolEnvironment) log(level, message string, data map[string]interface{}) {
+	if e == nil || e.runtime == nil || e.execCtx == nil {
+		return
+	}
+	e.runtime.logExecution(e.execCtx.status.ID, level, message, data)
+}
+
+// rememberTurn appends a turn to a conversation of the running execution's
+// account, like conversationMemory.remember, and stores it. When another
+// execution saved the session since it was loaded, the turn is appended to
+// the stored conversation instead.
+func (e *toolEnvironment) rememberTurn(memory *conversationMemory, conversation *Conversation, turn []utils.Message,
+	summarize func(summary string, dropped []utils.Message) (string, error),
+	logf func(level, message string, data map[string]interface{})) error {
+
+	store, err := e.runtime.conversations()
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		memory.remember(conversation, turn, summarize, logf)
+		err := store.SaveConversation(*conversation)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrConversationConflict) || attempt == maxConversationSaves {
+			return fmt.Errorf("failed to save conversation %s: %w", conversation.SessionID, err)
+		}
+		if conversation, err = e.loadConversation(memory); err != nil {
+			return err
+		}
+	}
+}
+
+// llmSummarizer returns a summarize function asking an llm node's models
+// for the summary of a conversation
+func llmSummarizer(ctx context.Context, params map[string]interface{}, input interface{},
+	logf func(level, message string, data map[string]interface{})) func(summary string, dropped []utils.Message) (string, error) {
+
+	// The summary is plain text, whatever the node asks for
+	summaryParams := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if key != "output_schema" && key != "response_format" {
+			summaryParams[key] = value
+		}
+	}
+	send := func(client *utils.LLMClient, request utils.LLMRequest) (*utils.LLMResponse, error) {
+		return client.Complete(ctx, request)
+	}
+
+	return func(summary string, dropped []utils.Message) (string, error) {
+		env := toolEnvironmentFrom(input)
+		if err := env.checkLLMBudget(); err != nil {
+			return "", err
+		}
+		resp, answer, err := completeWithFallbacks(ctx, summaryParams, input, summaryRequest(summary, dropped), send, logf)
+		if err != nil {
+			return "", err
+		}
+		env.recordLLMUsage(answer.Provider, answer.Model, resp.Usage, 1)
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("no choices returned from LLM")
+		}
+		return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+	}
+}
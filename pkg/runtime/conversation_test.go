@@ -0,0 +1,221 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// newConversationRuntime returns a runtime running an llm flow "chat" with
+// the given memory config, remembering conversations in store
+func newConversationRuntime(t *testing.T, baseURL string, memory map[string]interface{}, store runtime.ConversationStore) runtime.ConversationFlowRuntime {
+	t.Helper()
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{"chat": nodeFlow("llm", map[string]interface{}{
+		"provider": "ollama",
+		"model":    "llama3",
+		"memory":   memory,
+		"options":  map[string]interface{}{"base_url": baseURL},
+	})})
+	remembering, ok := flowRuntime.(runtime.ConversationFlowRuntime)
+	require.True(t, ok)
+	remembering.SetConversationStore(store)
+	return remembering
+}
+
+// chatTurn runs the chat flow with a question and returns its status
+func chatTurn(t *testing.T, flowRuntime runtime.ConversationFlowRuntime, sessionID, question string) runtime.ExecutionStatus {
+	t.Helper()
+	executionID, err := flowRuntime.Execute("test-account", "chat", map[string]interface{}{
+		"session_id": sessionID,
+		"question":   question,
+	})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	return status
+}
+
+// requestContents returns the role and content of the messages of a request
+func requestContents(request recordedRequest) []string {
+	var contents []string
+	for _, message := range request.body["messages"].([]interface{}) {
+		message := message.(map[string]interface{})
+		contents = append(contents, message["role"].(string)+": "+message["content"].(string))
+	}
+	return contents
+}
+
+func TestLLMNode_ConversationMemoryWindow(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		completionWith(`"Hi Ada"`),
+		completionWith(`"Blue it is"`),
+		completionWith(`"You like blue"`),
+	)
+	store := storage.NewMemoryConversationStore()
+	flowRuntime := newConversationRuntime(t, server.URL, map[string]interface{}{"max_messages": 4}, store)
+
+	chatTurn(t, flowRuntime, "s1", "I am Ada")
+	chatTurn(t, flowRuntime, "s1", "My favourite colour is blue")
+	status := chatTurn(t, flowRuntime, "s1", "What do I like?")
+	assert.Equal(t, "s1", status.Results["result"].(map[string]interface{})["session_id"])
+
+	// Each turn continues the conversation after the system prompt
+	require.Len(t, *requests, 3)
+	assert.Equal(t, []string{
+		"system: You are a helpful assistant. Keep your answers brief.",
+		"user: I am Ada",
+		"assistant: Hi Ada",
+		"user: My favourite colour is blue",
+		"assistant: Blue it is",
+		"user: What do I like?",
+	}, requestContents((*requests)[2]))
+
+	// Only the last two turns fit the window
+	conversation, err := flowRuntime.GetConversation("test-account", "s1")
+	require.NoError(t, err)
+	require.Len(t, conversation.Messages, 4)
+	assert.Equal(t, "My favourite colour is blue", conversation.Messages[0].Content)
+	assert.Equal(t, "You like blue", conversation.Messages[3].Content)
+	assert.Empty(t, conversation.Summary)
+
+	// Sessions are separate, and forgetting one starts it afresh
+	chatTurn(t, flowRuntime, "s2", "Hello")
+	assert.Len(t, requestContents((*requests)[3]), 2)
+	require.NoError(t, flowRuntime.DeleteConversation("test-account", "s1"))
+	_, err = flowRuntime.GetConversation("test-account", "s1")
+	assert.ErrorIs(t, err, runtime.ErrConversationNotFound)
+}
+
+func TestLLMNode_ConversationMemorySummarize(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		completionWith(`"Hi Ada"`),
+		completionWith(`"Blue it is"`),
+		completionWith(`"Noted"`),
+		completionWith(`"Ada likes blue"`),
+		completionWith(`"You like blue, Ada"`),
+	)
+	store := storage.NewMemoryConversationStore()
+	flowRuntime := newConversationRuntime(t, server.URL, map[string]interface{}{"strategy": "summarize", "max_messages": 4}, store)
+
+	chatTurn(t, flowRuntime, "s1", "I am Ada")
+	chatTurn(t, flowRuntime, "s1", "My favourite colour is blue")
+	chatTurn(t, flowRuntime, "s1", "I live in London")
+
+	// The third turn overflows the memory, and the oldest turns are folded
+	// into a summary down to half the budget
+	require.Len(t, *requests, 4)
+	summaryRequest := requestContents((*requests)[3])
+	require.Len(t, summaryRequest, 2)
+	assert.Contains(t, summaryRequest[1], "user: I am Ada")
+	assert.Contains(t, summaryRequest[1], "assistant: Blue it is")
+	assert.NotContains(t, summaryRequest[1], "London")
+
+	conversation, err := flowRuntime.GetConversation("test-account", "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "Ada likes blue", conversation.Summary)
+	require.Len(t, conversation.Messages, 2)
+	assert.Equal(t, "I live in London", conversation.Messages[0].Content)
+
+	// The summary is given to the model with the remaining turns
+	chatTurn(t, flowRuntime, "s1", "What do I like?")
+	assert.Equal(t, []string{
+		"system: You are a helpful assistant. Keep your answers brief.",
+		"system: Summary of the earlier conversation:\nAda likes blue",
+		"user: I live in London",
+		"assistant: Noted",
+		"user: What do I like?",
+	}, requestContents((*requests)[4]))
+}
+
+// racingConversationStore saves a turn of another execution before the
+// first save of a session
+type racingConversationStore struct {
+	runtime.ConversationStore
+	raced bool
+}
+
+func (s *racingConversationStore) SaveConversation(conversation runtime.Conversation) error {
+	if !s.raced {
+		s.raced = true
+		other := runtime.Conversation{AccountID: conversation.AccountID, SessionID: conversation.SessionID}
+		if stored, err := s.ConversationStore.GetConversation(conversation.AccountID, conversation.SessionID); err == nil {
+			other = stored
+		}
+		other.Messages = append(other.Messages, utils.Message{Role: "user", Content: "Meanwhile"}, utils.Message{Role: "assistant", Content: "Elsewhere"})
+		if err := s.ConversationStore.SaveConversation(other); err != nil {
+			return err
+		}
+	}
+	return s.ConversationStore.SaveConversation(conversation)
+}
+
+func TestLLMNode_ConversationMemoryConcurrentTurns(t *testing.T) {
+	server, _ := newFakeProvider(t, completionWith(`"Hi Ada"`))
+	store := &racingConversationStore{ConversationStore: storage.NewMemoryConversationStore()}
+	flowRuntime := newConversationRuntime(t, server.URL, map[string]interface{}{"max_messages": 10}, store)
+
+	chatTurn(t, flowRuntime, "s1", "I am Ada")
+
+	// The turn is added to the one saved meanwhile rather than replacing it
+	conversation, err := flowRuntime.GetConversation("test-account", "s1")
+	require.NoError(t, err)
+	var contents []string
+	for _, message := range conversation.Messages {
+		contents = append(contents, message.Content)
+	}
+	assert.Equal(t, []string{"Meanwhile", "Elsewhere", "I am Ada", "Hi Ada"}, contents)
+	assert.Equal(t, int64(2), conversation.Version)
+}
+
+func TestLLMNode_ConversationMemoryRequiresSession(t *testing.T) {
+	server, _ := newFakeProvider(t, completionWith(`"Hi"`))
+	flowRuntime := newConversationRuntime(t, server.URL, map[string]interface{}{"max_messages": 4}, storage.NewMemoryConversationStore())
+
+	executionID, err := flowRuntime.Execute("test-account", "chat", map[string]interface{}{"question": "Hello"})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "memory requires a session_id")
+}
+
+func TestAgentNode_ConversationMemory(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		completionWith(`"Your order ships today"`),
+		completionWith(`"It was order 42"`),
+	)
+	agentFlow := func(prompt string) testFlow {
+		return nodeFlow("agent", map[string]interface{}{
+			"provider": "generic",
+			"api_key":  "test-key",
+			"model":    "test-model",
+			"prompt":   prompt,
+			"memory":   map[string]interface{}{"session_id": "customer-7"},
+			"options":  map[string]interface{}{"base_url": server.URL},
+		})
+	}
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{
+		"first":  agentFlow("Where is order 42?"),
+		"second": agentFlow("Which order did I ask about?"),
+	})
+	flowRuntime.(runtime.ConversationFlowRuntime).SetConversationStore(storage.NewMemoryConversationStore())
+
+	for _, flowID := range []string{"first", "second"} {
+		executionID, err := flowRuntime.Execute("test-account", flowID, map[string]interface{}{})
+		require.NoError(t, err)
+		status := waitForCompletion(t, flowRuntime, executionID)
+		require.Equal(t, "completed", status.Status, status.Error)
+	}
+
+	// The second run of the session continues the first
+	require.Len(t, *requests, 2)
+	contents := requestContents((*requests)[1])
+	assert.Equal(t, []string{
+		"user: Where is order 42?",
+		"assistant: Your order ships today",
+		"user: Which order did I ask about?",
+	}, contents[len(contents)-3:])
+}
@@ -2,11 +2,13 @@
 package runtime
 
 import (
+	"encoding/base64"
 	"fmt"
 	"time"
 
 	"github.com/robertkrimen/otto"
 	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
 	"github.com/tcmartin/flowrunner/pkg/utils"
 )
 
@@ -27,12 +29,36 @@ func CoreNodeTypes() map[string]NodeFactory {
 		"webhook":       NewWebhookNodeWrapper,
 		"dynamodb":      NewDynamoDBNodeWrapper,
 		"postgres":      NewPostgresNodeWrapper,
+		"embed":         NewEmbedNodeWrapper,
+		"vector":        NewVectorNodeWrapper,
+		"graphql":       NewGraphQLNodeWrapper,
+		"grpc":          NewGRPCNodeWrapper,
+		"artifact":      NewArtifactNodeWrapper,
 	}
 }
 
 // NodeFactory is a function that creates a node
 type NodeFactory func(params map[string]interface{}) (flowlib.Node, error)
 
+// CreateNode implements plugins.NodeFactory so core node types can be given
+// to the YAML loader
+func (f NodeFactory) CreateNode(nodeDef plugins.NodeDefinition) (flowlib.Node, error) {
+	params := nodeDef.Params
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	return f(params)
+}
+
+// CoreNodeFactories returns the core node types as YAML loader node factories
+func CoreNodeFactories() map[string]plugins.NodeFactory {
+	factories := make(map[string]plugins.NodeFactory)
+	for nodeType, factory := range CoreNodeTypes() {
+		factories[nodeType] = factory
+	}
+	return factories
+}
+
 // NewTransformNodeWrapper creates a new transform node wrapper
 func NewTransformNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 	// Create the base node
@@ -154,10 +180,7 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				return nil, fmt.Errorf("smtp_host parameter is required")
 			}
 
-			smtpPort := 587 // Default SMTP port
-			if portParam, ok := params["smtp_port"].(int); ok {
-				smtpPort = portParam
-			}
+			smtpPort := intParam(params["smtp_port"], 587) // Default SMTP port
 
 			// Extract IMAP server parameters (for connection sharing)
 			imapHost := smtpHost // Default to same as SMTP
@@ -165,10 +188,7 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				imapHost = hostParam
 			}
 
-			imapPort := 993 // Default IMAP port
-			if portParam, ok := params["imap_port"].(int); ok {
-				imapPort = portParam
-			}
+			imapPort := intParam(params["imap_port"], 993) // Default IMAP port
 
 			// Extract authentication parameters
 			username, ok := params["username"].(string)
@@ -187,6 +207,13 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				from = username // Default to username
 			}
 
+			// Replies are threaded and default to the sender and subject
+			// of the message replied to
+			reply, err := parseEmailReply(params["in_reply_to"])
+			if err != nil {
+				return nil, err
+			}
+
 			var to []string
 			if toParam, ok := params["to"].(string); ok {
 				to = []string{toParam}
@@ -196,14 +223,13 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 						to = append(to, recipientStr)
 					}
 				}
+			} else if reply != nil && reply.replyTo != "" {
+				to = []string{reply.replyTo}
 			} else {
 				return nil, fmt.Errorf("to parameter is required")
 			}
 
-			subject, ok := params["subject"].(string)
-			if !ok {
-				return nil, fmt.Errorf("subject parameter is required")
-			}
+			subject, _ := params["subject"].(string)
 
 			var body string
 			if bodyParam, ok := params["body"].(string); ok {
@@ -215,6 +241,40 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				html = htmlParam
 			}
 
+			// Templates render with the shared context and variables,
+			// taking precedence over the plain params
+			if templateParam := mapParam(params["template"]); templateParam != nil {
+				tmpl := emailTemplate{}
+				tmpl.subject, _ = templateParam["subject"].(string)
+				tmpl.body, _ = templateParam["body"].(string)
+				tmpl.html, _ = templateParam["html"].(string)
+
+				variables := sharedTemplateVariables(input)
+				for key, value := range mapParam(params["variables"]) {
+					variables[key] = value
+				}
+				renderedSubject, renderedBody, renderedHTML, err := tmpl.render(variables)
+				if err != nil {
+					return nil, err
+				}
+				if tmpl.subject != "" {
+					subject = renderedSubject
+				}
+				if tmpl.body != "" {
+					body = renderedBody
+				}
+				if tmpl.html != "" {
+					html = renderedHTML
+				}
+			}
+
+			if subject == "" && reply != nil {
+				subject = reply.replySubject()
+			}
+			if subject == "" {
+				return nil, fmt.Errorf("subject parameter is required")
+			}
+
 			// Extract CC and BCC recipients
 			var cc []string
 			if ccParam, ok := params["cc"].(string); ok {
@@ -246,18 +306,42 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 						filename, _ := attachmentMap["filename"].(string)
 						contentType, _ := attachmentMap["content_type"].(string)
 
+						contentID, _ := attachmentMap["content_id"].(string)
+
 						var content []byte
 						if contentStr, ok := attachmentMap["content"].(string); ok {
 							content = []byte(contentStr)
+							if encoding, _ := attachmentMap["encoding"].(string); encoding == "base64" {
+								decoded, err := base64.StdEncoding.DecodeString(contentStr)
+								if err != nil {
+									return nil, fmt.Errorf("attachment %s is not valid base64: %w", filename, err)
+								}
+								content = decoded
+							}
 						} else if contentBytes, ok := attachmentMap["content"].([]byte); ok {
 							content = contentBytes
+						} else if ref := artifactAttachmentRef(attachmentMap); ref != nil {
+							// Artifact references name their own content
+							artifact, data, err := toolEnvironmentFrom(input).readArtifact(ref)
+							if err != nil {
+								return nil, err
+							}
+							content = data
+							if filename == "" && contentID == "" {
+								filename = artifact.Name
+							}
+							if contentType == "" {
+								contentType = artifact.ContentType
+							}
 						}
 
-						if filename != "" && len(content) > 0 {
+						// Inline parts are named by their content ID
+						if (filename != "" || contentID != "") && len(content) > 0 {
 							attachments = append(attachments, utils.EmailAttachment{
 								Filename:    filename,
 								ContentType: contentType,
 								Content:     content,
+								ContentID:   contentID,
 							})
 						}
 					}
@@ -274,14 +358,14 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				}
 			}
 
-			// Create email client
-			client := utils.NewEmailClient(smtpHost, smtpPort, imapHost, imapPort, username, password)
-
-			// Connect to the server
-			if err := client.Connect(); err != nil {
-				return nil, fmt.Errorf("failed to connect to email server: %w", err)
+			dkim, err := emailDKIMOptions(params["dkim"], toolEnvironmentFrom(input))
+			if err != nil {
+				return nil, err
 			}
-			defer client.Close()
+
+			// Create email client; sending only uses SMTP
+			client := utils.NewEmailClient(smtpHost, smtpPort, imapHost, imapPort, username, password)
+			client.SetDKIM(dkim)
 
 			// Create email message
 			message := utils.EmailMessage{
@@ -294,6 +378,11 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 				HTML:        html,
 				Attachments: attachments,
 				Headers:     headers,
+				MessageID:   utils.GenerateMessageID(from),
+				References:  stringListParam(params["references"]),
+			}
+			if reply != nil {
+				message.InReplyTo, message.References = reply.thread(message.References)
 			}
 
 			// Send the email
@@ -302,14 +391,22 @@ func NewSMTPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 			}
 
 			// Return success
-			return map[string]interface{}{
-				"status":  "sent",
-				"from":    from,
-				"to":      to,
-				"cc":      cc,
-				"bcc":     bcc,
-				"subject": subject,
-			}, nil
+			result := map[string]interface{}{
+				"status":     "sent",
+				"from":       from,
+				"to":         to,
+				"cc":         cc,
+				"bcc":        bcc,
+				"subject":    subject,
+				"message_id": message.MessageID,
+			}
+			if message.InReplyTo != "" {
+				result["in_reply_to"] = message.InReplyTo
+			}
+			if dkim != nil {
+				result["dkim_domain"] = dkim.Domain
+			}
+			return result, nil
 		},
 	}
 
@@ -462,17 +559,34 @@ func NewIMAPNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 			// Convert emails to map
 			result := make([]map[string]interface{}, len(emails))
 			for i, email := range emails {
+				// Attachments keep their content as bytes, like those of
+				// mailbox watchers, so that runtimes keeping artifacts
+				// store them as artifacts
+				attachments := make([]interface{}, len(email.Attachments))
+				for j, attachment := range email.Attachments {
+					attachmentMap := map[string]interface{}{
+						"filename":     attachment.Filename,
+						"content_type": attachment.ContentType,
+						"content":      attachment.Content,
+					}
+					if attachment.ContentID != "" {
+						attachmentMap["content_id"] = attachment.ContentID
+					}
+					attachments[j] = attachmentMap
+				}
+
 				emailMap := map[string]interface{}{
-					"subject":   email.Subject,
-					"from":      email.From,
-					"to":        email.To,
-					"cc":        email.Cc,
-					"date":      email.Date,
-					"body":      email.Body,
-					"html":      email.HTML,
-					"headers":   email.Headers,
-					"messageId": email.MessageID,
-					"metadata":  email.Metadata,
+					"subject":     email.Subject,
+					"from":        email.From,
+					"to":          email.To,
+					"cc":          email.Cc,
+					"date":        email.Date,
+					"body":        email.Body,
+					"html":        email.HTML,
+					"headers":     email.Headers,
+					"messageId":   email.MessageID,
+					"metadata":    email.Metadata,
+					"attachments": attachments,
 				}
 				result[i] = emailMap
 			}
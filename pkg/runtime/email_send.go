@@ -0,0 +1,189 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// emailTemplate is the template param of an email.send node: Go templates
+// of the subject, text body and HTML body. The HTML template escapes the
+// values it inserts.
+type emailTemplate struct {
+	subject string
+	body    string
+	html    string
+}
+
+// render renders the templates present with the variables
+func (t emailTemplate) render(variables map[string]interface{}) (subject, body, html string, err error) {
+	if subject, err = renderTextTemplate("subject", t.subject, variables); err != nil {
+		return "", "", "", err
+	}
+	if body, err = renderTextTemplate("body", t.body, variables); err != nil {
+		return "", "", "", err
+	}
+	if t.html != "" {
+		tmpl, err := htmltemplate.New("html").Parse(t.html)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to parse html template: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, variables); err != nil {
+			return "", "", "", fmt.Errorf("failed to render html template: %w", err)
+		}
+		html = buf.String()
+	}
+	return subject, body, html, nil
+}
+
+// renderTextTemplate renders a text template, or returns "" for an empty
+// one
+func renderTextTemplate(name, text string, variables map[string]interface{}) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, variables); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// emailReply is the message an email.send node replies to
+type emailReply struct {
+	messageID  string
+	references []string
+	subject    string
+	replyTo    string
+}
+
+// parseEmailReply reads the in_reply_to param of an email.send node: the
+// Message-ID of the message replied to, or the message itself as received
+// by email.receive or a mailbox watcher
+func parseEmailReply(value interface{}) (*emailReply, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return &emailReply{messageID: v}, nil
+	case map[string]interface{}:
+		reply := &emailReply{}
+		reply.messageID, _ = v["message_id"].(string)
+		if reply.messageID == "" {
+			// email.receive results name it messageId
+			reply.messageID, _ = v["messageId"].(string)
+		}
+		if reply.messageID == "" {
+			return nil, fmt.Errorf("in_reply_to message has no message_id")
+		}
+		reply.references = stringListParam(v["references"])
+		reply.subject, _ = v["subject"].(string)
+		reply.replyTo, _ = v["from"].(string)
+		// email.receive results hold the headers as strings
+		headers := mapParam(v["headers"])
+		if stringHeaders, ok := v["headers"].(map[string]string); ok {
+			headers = make(map[string]interface{}, len(stringHeaders))
+			for key, header := range stringHeaders {
+				headers[key] = header
+			}
+		}
+		for key, header := range headers {
+			if strings.EqualFold(key, "Reply-To") {
+				if address, ok := header.(string); ok && address != "" {
+					reply.replyTo = address
+				}
+			}
+		}
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("in_reply_to must be a message ID or a message, got %T", value)
+	}
+}
+
+// thread returns the In-Reply-To and References headers of a reply,
+// adding the message replied to after its own references
+func (r *emailReply) thread(references []string) (string, []string) {
+	threaded := append([]string{}, r.references...)
+	threaded = append(threaded, references...)
+	threaded = append(threaded, r.messageID)
+
+	seen := make(map[string]bool, len(threaded))
+	unique := threaded[:0]
+	for _, reference := range threaded {
+		if !seen[reference] {
+			seen[reference] = true
+			unique = append(unique, reference)
+		}
+	}
+	return r.messageID, unique
+}
+
+// replySubject returns the subject of a reply to the message
+func (r *emailReply) replySubject() string {
+	if r.subject == "" || strings.HasPrefix(strings.ToLower(r.subject), "re:") {
+		return r.subject
+	}
+	return "Re: " + r.subject
+}
+
+// stringListParam reads a param given as a string or a list of strings
+func stringListParam(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// emailDKIMOptions reads the dkim param of an email.send node, loading
+// the PEM private key from the secret vault of the execution's account
+func emailDKIMOptions(value interface{}, env *toolEnvironment) (*utils.DKIMOptions, error) {
+	params := mapParam(value)
+	if params == nil {
+		return nil, nil
+	}
+	domain, _ := params["domain"].(string)
+	selector, _ := params["selector"].(string)
+	keySecret, _ := params["key_secret"].(string)
+	if domain == "" || selector == "" || keySecret == "" {
+		return nil, fmt.Errorf("dkim requires domain, selector and key_secret")
+	}
+
+	if env == nil || env.runtime == nil || env.runtime.secretVault == nil || env.execCtx == nil {
+		return nil, fmt.Errorf("dkim key_secret %q requires a flow execution with a secret vault", keySecret)
+	}
+	key, err := env.runtime.secretVault.Get(env.execCtx.accountID, keySecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load DKIM key %q: %w", keySecret, err)
+	}
+	signer, err := utils.ParseDKIMPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.DKIMOptions{Domain: domain, Selector: selector, Signer: signer}, nil
+}
@@ -0,0 +1,245 @@
+package runtime_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// smtpCapture is an SMTP server accepting any login and recording the
+// envelope and data of the messages it receives
+type smtpCapture struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	from       string
+	recipients []string
+	data       []byte
+}
+
+func newSMTPCapture(t *testing.T) *smtpCapture {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	capture := &smtpCapture{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go capture.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return capture
+}
+
+func (s *smtpCapture) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpCapture) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH"):
+			reply("235 Authenticated")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = line[len("MAIL FROM:"):]
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.mu.Lock()
+			s.recipients = append(s.recipients, line[len("RCPT TO:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 Go ahead")
+			var data bytes.Buffer
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			s.mu.Lock()
+			s.data = data.Bytes()
+			s.mu.Unlock()
+			reply("250 Queued")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpCapture) message() (string, []string, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.from, s.recipients, s.data
+}
+
+func TestEmailSend_TemplateInlineImageAndReply(t *testing.T) {
+	capture := newSMTPCapture(t)
+	flowRuntime, _ := newNodeAuthRuntime(t, "email.send", map[string]interface{}{
+		"smtp_host": "127.0.0.1",
+		"smtp_port": capture.port(),
+		"username":  "support@example.com",
+		"password":  "secret",
+		"from":      "Support <support@example.com>",
+		"in_reply_to": map[string]interface{}{
+			"message_id": "<question-2@example.com>",
+			"references": "<question-1@example.com>",
+			"subject":    "Where is my order?",
+			"from":       "Ada Lovelace <ada@example.com>",
+			"headers":    map[string]interface{}{"Reply-To": "orders@example.com"},
+		},
+		"template": map[string]interface{}{
+			"body": "Hello {{.customer}}, order {{.order}} has shipped.",
+			"html": "<p>Hello {{.customer}}</p><img src=\"cid:logo\">",
+		},
+		"variables": map[string]interface{}{"order": "#42"},
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"content_id":   "logo",
+				"content_type": "image/png",
+				"content":      "iVBORw0KGgo=",
+				"encoding":     "base64",
+			},
+			map[string]interface{}{
+				"filename": "receipt.txt",
+				"content":  "Paid in full",
+			},
+		},
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{"customer": "Ada <3"})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	// Replies go to the Reply-To address with bare envelope addresses
+	from, recipients, data := capture.message()
+	assert.Equal(t, "<support@example.com>", from)
+	assert.Equal(t, []string{"<orders@example.com>"}, recipients)
+
+	email, err := utils.ParseEmailMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "Re: Where is my order?", email.Subject)
+	assert.Equal(t, "<question-2@example.com>", email.InReplyTo)
+	assert.Equal(t, []string{"<question-1@example.com>", "<question-2@example.com>"}, email.References)
+	assert.Contains(t, email.MessageID, "@example.com>")
+	assert.Equal(t, "Hello Ada <3, order #42 has shipped.", email.Body)
+	assert.Equal(t, `<p>Hello Ada &lt;3</p><img src="cid:logo">`, email.HTML)
+
+	require.Len(t, email.Attachments, 2)
+	assert.Equal(t, "logo", email.Attachments[0].ContentID)
+	assert.Equal(t, "image/png", email.Attachments[0].ContentType)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n"), email.Attachments[0].Content)
+	assert.Equal(t, "receipt.txt", email.Attachments[1].Filename)
+	assert.Equal(t, "Paid in full", string(email.Attachments[1].Content))
+}
+
+func TestEmailSend_DKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	capture := newSMTPCapture(t)
+	flowRuntime, vault := newNodeAuthRuntime(t, "email.send", map[string]interface{}{
+		"smtp_host": "127.0.0.1",
+		"smtp_port": capture.port(),
+		"username":  "support@example.com",
+		"password":  "secret",
+		"to":        "ada@example.com",
+		"subject":   "Signed",
+		"body":      "Hello",
+		"dkim": map[string]interface{}{
+			"domain":     "example.com",
+			"selector":   "mail",
+			"key_secret": "dkim_key",
+		},
+	})
+	require.NoError(t, vault.Set("test-account", "dkim_key", string(keyPEM)))
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	_, _, data := capture.message()
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(data), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			assert.Equal(t, "mail._domainkey.example.com", domain)
+			return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(publicKey)}, nil
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, verifications, 1)
+	assert.NoError(t, verifications[0].Err)
+	assert.Equal(t, "example.com", verifications[0].Domain)
+}
+
+func TestEmailSend_DKIMKeyMissing(t *testing.T) {
+	capture := newSMTPCapture(t)
+	flowRuntime, _ := newNodeAuthRuntime(t, "email.send", map[string]interface{}{
+		"smtp_host": "127.0.0.1",
+		"smtp_port": capture.port(),
+		"username":  "support@example.com",
+		"password":  "secret",
+		"to":        "ada@example.com",
+		"subject":   "Signed",
+		"body":      "Hello",
+		"dkim": map[string]interface{}{
+			"domain":     "example.com",
+			"selector":   "mail",
+			"key_secret": "dkim_key",
+		},
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "dkim_key")
+
+	_, _, data := capture.message()
+	assert.Empty(t, data)
+}
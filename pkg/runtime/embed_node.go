@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// embedTexts returns the embeddings of texts from the model named in params,
+// which hold provider settings as for llm nodes. The request counts against
+// the account's LLM budget and usage.
+func embedTexts(params map[string]interface{}, input interface{}, texts []string) (*utils.EmbeddingResponse, utils.LLMProvider, error) {
+	client, err := newLLMClient(params, input)
+	if err != nil {
+		return nil, "", err
+	}
+	if !client.Capabilities().Embeddings {
+		return nil, "", fmt.Errorf("provider %s does not support embeddings", client.Provider())
+	}
+	model, _ := params["model"].(string)
+	if model == "" {
+		model = client.DefaultModel()
+	}
+	if model == "" {
+		return nil, "", fmt.Errorf("model parameter is required")
+	}
+
+	env := toolEnvironmentFrom(input)
+	if err := env.checkLLMBudget(); err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Embed(context.Background(), utils.EmbeddingRequest{
+		Model:      model,
+		Input:      texts,
+		Dimensions: intParam(params["dimensions"], 0),
+		Options:    mapParam(params["options"]),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("embedding request failed: %w", err)
+	}
+	env.recordLLMUsage(string(client.Provider()), model, resp.Usage, 1)
+	return resp, client.Provider(), nil
+}
+
+// stringsParam returns a param holding a string or a list of strings
+func stringsParam(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return v, true
+	case []interface{}:
+		texts := make([]string, len(v))
+		for i, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			texts[i] = text
+		}
+		return texts, true
+	}
+	return nil, false
+}
+
+// NewEmbedNodeWrapper creates a new embed node wrapper, computing embeddings
+// of texts through the LLM provider layer
+func NewEmbedNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
+	// Create the base node
+	baseNode := flowlib.NewNode(1, 0)
+
+	// Create the wrapper
+	wrapper := &NodeWrapper{
+		node: baseNode,
+		exec: func(input interface{}) (interface{}, error) {
+			params, err := combinedParams(input)
+			if err != nil {
+				return nil, err
+			}
+
+			// Get the texts; a single string gives a single embedding
+			texts, ok := stringsParam(params["input"])
+			if !ok {
+				return nil, fmt.Errorf("input parameter is required and must be a string or a list of strings")
+			}
+
+			start := time.Now()
+			resp, provider, err := embedTexts(params, input, texts)
+			if err != nil {
+				return nil, err
+			}
+
+			result := map[string]interface{}{
+				"embeddings": resp.Embeddings,
+				"model":      resp.Model,
+				"provider":   string(provider),
+				"usage":      resp.Usage,
+				"count":      len(resp.Embeddings),
+				"duration":   time.Since(start).String(),
+			}
+			if len(resp.Embeddings) > 0 {
+				result["dimensions"] = len(resp.Embeddings[0])
+			}
+			if _, single := params["input"].(string); single && len(resp.Embeddings) == 1 {
+				result["embedding"] = resp.Embeddings[0]
+			}
+			return result, nil
+		},
+	}
+
+	// Set the parameters
+	wrapper.SetParams(params)
+
+	return wrapper, nil
+}
@@ -0,0 +1,108 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+func TestEmbedNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		response string
+		path     string
+		query    string
+		check    func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			name:     "openai compatible",
+			params:   map[string]interface{}{"provider": "ollama", "model": "nomic-embed-text", "dimensions": 2},
+			response: `{"model": "nomic-embed-text", "data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}], "usage": {"prompt_tokens": 6, "total_tokens": 6}}`,
+			path:     "/embeddings",
+			check: func(t *testing.T, body map[string]interface{}) {
+				assert.Equal(t, "nomic-embed-text", body["model"])
+				assert.Equal(t, []interface{}{"first text", "second text"}, body["input"])
+				assert.Equal(t, 2.0, body["dimensions"])
+			},
+		},
+		{
+			name:     "azure deployment",
+			params:   map[string]interface{}{"provider": "azure", "api_key": "test-key", "model": "text-embedding-3-small"},
+			response: `{"data": [{"index": 0, "embedding": [1, 0]}, {"index": 1, "embedding": [0, 1]}]}`,
+			path:     "/openai/deployments/text-embedding-3-small/embeddings",
+			query:    "api-version=2024-10-21",
+		},
+		{
+			name:     "gemini batch",
+			params:   map[string]interface{}{"provider": "gemini", "api_key": "test-key", "model": "text-embedding-004"},
+			response: `{"embeddings": [{"values": [1, 0]}, {"values": [0, 1]}]}`,
+			path:     "/models/text-embedding-004:batchEmbedContents",
+			check: func(t *testing.T, body map[string]interface{}) {
+				requests := body["requests"].([]interface{})
+				require.Len(t, requests, 2)
+				first := requests[0].(map[string]interface{})
+				assert.Equal(t, "models/text-embedding-004", first["model"])
+				assert.Equal(t, "first text", first["content"].(map[string]interface{})["parts"].([]interface{})[0].(map[string]interface{})["text"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newFakeProvider(t, tt.response)
+			params := map[string]interface{}{"input": []interface{}{"first text", "second text"}, "options": map[string]interface{}{"base_url": server.URL}}
+			for key, value := range tt.params {
+				params[key] = value
+			}
+
+			node, err := runtime.NewEmbedNodeWrapper(params)
+			require.NoError(t, err)
+			shared := map[string]interface{}{}
+			_, err = node.Run(shared)
+			require.NoError(t, err)
+
+			result := shared["result"].(map[string]interface{})
+			assert.Equal(t, [][]float64{{1, 0}, {0, 1}}, result["embeddings"])
+			assert.Equal(t, 2, result["count"])
+			assert.Equal(t, 2, result["dimensions"])
+			assert.Nil(t, result["embedding"])
+
+			require.Len(t, *requests, 1)
+			assert.Equal(t, tt.path, (*requests)[0].path)
+			assert.Equal(t, tt.query, (*requests)[0].query)
+			if tt.check != nil {
+				tt.check(t, (*requests)[0].body)
+			}
+		})
+	}
+
+	t.Run("single input", func(t *testing.T) {
+		server, _ := newFakeProvider(t, `{"data": [{"index": 0, "embedding": [0.5, 0.5]}]}`)
+		node, err := runtime.NewEmbedNodeWrapper(map[string]interface{}{
+			"provider": "ollama",
+			"model":    "nomic-embed-text",
+			"input":    "only text",
+			"options":  map[string]interface{}{"base_url": server.URL},
+		})
+		require.NoError(t, err)
+		shared := map[string]interface{}{}
+		_, err = node.Run(shared)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{0.5, 0.5}, shared["result"].(map[string]interface{})["embedding"])
+	})
+
+	t.Run("provider without embeddings", func(t *testing.T) {
+		node, err := runtime.NewEmbedNodeWrapper(map[string]interface{}{
+			"provider": "anthropic",
+			"api_key":  "test-key",
+			"model":    "claude-test",
+			"input":    "text",
+		})
+		require.NoError(t, err)
+		_, err = node.Run(map[string]interface{}{})
+		assert.EqualError(t, err, "provider anthropic does not support embeddings")
+	})
+}
@@ -0,0 +1,387 @@
+package runtime
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrExecutionNotFound is returned, also by execution stores, for
+	// executions that do not exist
+	ErrExecutionNotFound = errors.New("execution not found")
+
+	// ErrExecutionForbidden is returned for executions of other accounts
+	ErrExecutionForbidden = errors.New("execution belongs to another account")
+
+	// ErrCheckpointNotFound is returned by checkpoint stores for checkpoints
+	// that were not recorded
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+)
+
+// inputCheckpoint is the node ID of the checkpoint holding the input of an
+// execution, which cannot clash with node names
+const inputCheckpoint = "$input"
+
+// Checkpoint is the shared context of an execution as it was before a node
+// ran. Data holds the context as JSON, sealed when the runtime has a
+// checkpoint key. Unlike stored inputs, checkpoints are not redacted, so
+// that replays see the original values.
+type Checkpoint struct {
+	ExecutionID string    `json:"execution_id"`
+	NodeID      string    `json:"node_id"`
+	Data        []byte    `json:"data"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CheckpointStore persists checkpoints, keeping the last one of each node
+type CheckpointStore interface {
+	// SaveCheckpoint persists a checkpoint, replacing the one of the same
+	// execution and node
+	SaveCheckpoint(checkpoint Checkpoint) error
+
+	// GetCheckpoint returns the checkpoint of a node, or
+	// ErrCheckpointNotFound
+	GetCheckpoint(executionID, nodeID string) (Checkpoint, error)
+}
+
+// redactedValue replaces secret values in stored inputs. Checkpoints are not
+// redacted; see Checkpoint.
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeySuffixes are key name endings whose values are always redacted
+var sensitiveKeySuffixes = []string{
+	"password",
+	"passwd",
+	"secret",
+	"secret_key",
+	"client_secret",
+	"token",
+	"api_key",
+	"apikey",
+	"access_key",
+	"private_key",
+	"authorization",
+}
+
+// SetCheckpointStore sets the store of checkpoints. A key of 16, 24 or 32
+// bytes seals checkpoints with AES-GCM; without one they are stored as is.
+func (r *flowRuntime) SetCheckpointStore(store CheckpointStore, key []byte) error {
+	var aead cipher.AEAD
+	if key != nil {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("invalid checkpoint key: %w", err)
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return fmt.Errorf("invalid checkpoint key: %w", err)
+		}
+	}
+
+	r.checkpointsMu.Lock()
+	defer r.checkpointsMu.Unlock()
+	r.checkpointStore = store
+	r.checkpointCipher = aead
+	return nil
+}
+
+// checkpoints returns the checkpoint store and cipher
+func (r *flowRuntime) checkpoints() (CheckpointStore, cipher.AEAD) {
+	r.checkpointsMu.RLock()
+	defer r.checkpointsMu.RUnlock()
+	return r.checkpointStore, r.checkpointCipher
+}
+
+// Rerun starts a new execution from the input of a previous one.
+// With options.FromNode set, the shared context checkpointed before that node
+// is restored and execution resumes there.
+func (r *flowRuntime) Rerun(accountID string, executionID string, options RerunOptions) (string, error) {
+	original, err := r.GetStatus(executionID)
+	if errors.Is(err, ErrExecutionNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrExecutionNotFound, executionID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get execution %s: %w", executionID, err)
+	}
+	if err := r.checkExecutionOwner(accountID, original); err != nil {
+		return "", err
+	}
+
+	input, err := r.replayInput(original)
+	if err != nil {
+		return "", err
+	}
+
+	flowDef, err := r.flowForRerun(accountID, original, options.UseLatestVersion)
+	if err != nil {
+		return "", err
+	}
+
+	root := original.Metadata["rerun_root"]
+	if root == "" {
+		root = executionID
+	}
+
+	start := executionStart{
+		entrypoint: original.Metadata["entrypoint"],
+		metadata: map[string]string{
+			"rerun_of":   executionID,
+			"rerun_root": root,
+			"rerun_mode": "rerun",
+		},
+	}
+
+	if options.FromNode != "" {
+		shared, err := r.findCheckpoint(executionID, options.FromNode)
+		if err != nil {
+			return "", err
+		}
+		start.startNode = options.FromNode
+		start.shared = shared
+		start.metadata["rerun_mode"] = "replay"
+		start.metadata["replay_from_node"] = options.FromNode
+	}
+
+	return r.startExecution(accountID, original.FlowID, flowDef, input, start)
+}
+
+// checkExecutionOwner fails unless an execution belongs to the account.
+// Executions stored before their account was recorded in their metadata are
+// looked up among the executions of the account.
+func (r *flowRuntime) checkExecutionOwner(accountID string, execution ExecutionStatus) error {
+	if owner := execution.Metadata["account_id"]; owner != "" {
+		if owner != accountID {
+			return fmt.Errorf("%w: %s", ErrExecutionForbidden, execution.ID)
+		}
+		return nil
+	}
+
+	executions, err := r.ListExecutions(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to list executions: %w", err)
+	}
+	for _, owned := range executions {
+		if owned.ID == execution.ID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrExecutionForbidden, execution.ID)
+}
+
+// replayInput returns the input an execution received. It is read from the
+// input checkpoint, since the stored input is redacted; executions without
+// one are rerun from their stored input unless values were redacted from it.
+func (r *flowRuntime) replayInput(execution ExecutionStatus) (map[string]interface{}, error) {
+	input, err := r.loadCheckpoint(execution.ID, inputCheckpoint)
+	if err == nil {
+		return input, nil
+	}
+	if !errors.Is(err, ErrCheckpointNotFound) {
+		return nil, err
+	}
+
+	if containsRedacted(execution.Input) {
+		return nil, fmt.Errorf("input of execution %s was redacted and cannot be replayed", execution.ID)
+	}
+	return execution.Input, nil
+}
+
+// containsRedacted reports whether secret values were redacted from a value
+func containsRedacted(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			if containsRedacted(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if containsRedacted(item) {
+				return true
+			}
+		}
+	case string:
+		return strings.Contains(v, redactedValue)
+	}
+	return false
+}
+
+// flowForRerun loads the flow version a rerun should execute
+func (r *flowRuntime) flowForRerun(accountID string, original ExecutionStatus, useLatest bool) (*Flow, error) {
+	version := original.Metadata["flow_version"]
+	if useLatest || version == "" {
+		flowDef, err := r.registry.GetFlow(accountID, original.FlowID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get flow: %w", err)
+		}
+		return flowDef, nil
+	}
+
+	versioned, ok := r.registry.(VersionedFlowRegistry)
+	if !ok {
+		return nil, fmt.Errorf("cannot load version %s of flow %s: registry does not support versions", version, original.FlowID)
+	}
+
+	flowDef, err := versioned.GetFlowVersion(accountID, original.FlowID, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow version %s: %w", version, err)
+	}
+	return flowDef, nil
+}
+
+// findCheckpoint returns the shared context recorded before nodeID last ran in an execution
+func (r *flowRuntime) findCheckpoint(executionID, nodeID string) (map[string]interface{}, error) {
+	shared, err := r.loadCheckpoint(executionID, nodeID)
+	if errors.Is(err, ErrCheckpointNotFound) {
+		return nil, fmt.Errorf("no checkpoint recorded for node '%s' in execution %s", nodeID, executionID)
+	}
+	return shared, err
+}
+
+// loadCheckpoint reads and opens a checkpoint
+func (r *flowRuntime) loadCheckpoint(executionID, nodeID string) (map[string]interface{}, error) {
+	store, aead := r.checkpoints()
+	if store == nil {
+		return nil, ErrCheckpointNotFound
+	}
+
+	checkpoint, err := store.GetCheckpoint(executionID, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := checkpoint.Data
+	if aead != nil {
+		if len(data) < aead.NonceSize() {
+			return nil, fmt.Errorf("checkpoint of node '%s' is not sealed", nodeID)
+		}
+		nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+		if data, err = aead.Open(nil, nonce, sealed, nil); err != nil {
+			return nil, fmt.Errorf("failed to open checkpoint of node '%s': %w", nodeID, err)
+		}
+	}
+
+	var shared map[string]interface{}
+	if err := json.Unmarshal(data, &shared); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint of node '%s': %w", nodeID, err)
+	}
+	return shared, nil
+}
+
+// checkpoint records the shared context as it was before a node ran
+func (r *flowRuntime) checkpoint(executionID, nodeID string, shared map[string]interface{}) {
+	store, aead := r.checkpoints()
+	if store == nil {
+		return
+	}
+
+	data, err := json.Marshal(snapshotSharedContext(shared))
+	if err == nil && aead != nil {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err = io.ReadFull(rand.Reader, nonce); err == nil {
+			data = aead.Seal(nonce, nonce, data, nil)
+		}
+	}
+	if err == nil {
+		err = store.SaveCheckpoint(Checkpoint{ExecutionID: executionID, NodeID: nodeID, Data: data, CreatedAt: time.Now()})
+	}
+	if err != nil {
+		r.logExecution(executionID, "error", "Failed to save checkpoint", map[string]interface{}{"node_id": nodeID, "error": err.Error()})
+	}
+}
+
+// snapshotSharedContext copies the serializable, user-visible part of the shared context
+func snapshotSharedContext(shared map[string]interface{}) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(shared))
+	for key, value := range shared {
+		// Internal keys (execution handle, flow context, secret vault) are rebuilt on resume
+		if isReservedSharedKey(key) {
+			continue
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		var copied interface{}
+		if err := json.Unmarshal(data, &copied); err != nil {
+			continue
+		}
+		snapshot[key] = copied
+	}
+	return snapshot
+}
+
+// redactSecrets returns a copy of data with secret values replaced. Values are
+// redacted when their key looks sensitive or when they match a secret stored
+// in the account's vault.
+func (r *flowRuntime) redactSecrets(accountID string, data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	secretValues := make(map[string]bool)
+	if r.secretVault != nil && accountID != "" {
+		if keys, err := r.secretVault.List(accountID); err == nil {
+			for _, key := range keys {
+				// Very short values would redact unrelated data
+				if value, err := r.secretVault.Get(accountID, key); err == nil && len(value) >= 4 {
+					secretValues[value] = true
+				}
+			}
+		}
+	}
+
+	redacted, _ := redactValue(data, secretValues).(map[string]interface{})
+	return redacted
+}
+
+func redactValue(value interface{}, secretValues map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if isSensitiveKey(key) {
+				out[key] = redactedValue
+				continue
+			}
+			out[key] = redactValue(item, secretValues)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = redactValue(item, secretValues)
+		}
+		return out
+	case string:
+		if secretValues[v] {
+			return redactedValue
+		}
+		for secret := range secretValues {
+			if strings.Contains(v, secret) {
+				v = strings.ReplaceAll(v, secret, redactedValue)
+			}
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	normalized := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return true
+		}
+	}
+	return false
+}
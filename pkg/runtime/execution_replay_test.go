@@ -0,0 +1,372 @@
+package runtime_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowlib"
+
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// replayExecutionStore is a minimal in-memory execution store for replay tests
+type replayExecutionStore struct {
+	mu         sync.Mutex
+	executions map[string]runtime.ExecutionStatus
+	accounts   map[string]string
+	logs       map[string][]runtime.ExecutionLog
+}
+
+func newReplayExecutionStore() *replayExecutionStore {
+	return &replayExecutionStore{
+		executions: make(map[string]runtime.ExecutionStatus),
+		accounts:   make(map[string]string),
+		logs:       make(map[string][]runtime.ExecutionLog),
+	}
+}
+
+func (s *replayExecutionStore) SetExecutionAccountID(executionID, accountID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[executionID] = accountID
+	return nil
+}
+
+func (s *replayExecutionStore) SaveExecution(execution runtime.ExecutionStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executions[execution.ID] = execution
+	return nil
+}
+
+func (s *replayExecutionStore) GetExecution(executionID string) (runtime.ExecutionStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	execution, ok := s.executions[executionID]
+	if !ok {
+		return runtime.ExecutionStatus{}, fmt.Errorf("%w: %s", runtime.ErrExecutionNotFound, executionID)
+	}
+	return execution, nil
+}
+
+func (s *replayExecutionStore) ListExecutions(accountID string) ([]runtime.ExecutionStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var executions []runtime.ExecutionStatus
+	for id, execution := range s.executions {
+		if s.accounts[id] == accountID {
+			executions = append(executions, execution)
+		}
+	}
+	return executions, nil
+}
+
+func (s *replayExecutionStore) SaveExecutionLog(executionID string, log runtime.ExecutionLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[executionID] = append(s.logs[executionID], log)
+	return nil
+}
+
+func (s *replayExecutionStore) GetExecutionLogs(executionID string) ([]runtime.ExecutionLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]runtime.ExecutionLog(nil), s.logs[executionID]...), nil
+}
+
+type replayNodeFactory struct {
+	factory runtime.NodeFactory
+}
+
+func (f *replayNodeFactory) CreateNode(nodeDef plugins.NodeDefinition) (flowlib.Node, error) {
+	return f.factory(nodeDef.Params)
+}
+
+func waitForCompletion(t *testing.T, flowRuntime runtime.FlowRuntime, executionID string) runtime.ExecutionStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := flowRuntime.GetStatus(executionID)
+		require.NoError(t, err)
+		if status.Status != "running" {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("execution %s did not finish", executionID)
+	return runtime.ExecutionStatus{}
+}
+
+// newReplayRuntime returns a runtime of the replay flows keeping sealed
+// checkpoints in memory
+func newReplayRuntime(t *testing.T) (runtime.RerunFlowRuntime, *replayExecutionStore, *storage.MemoryCheckpointStore) {
+	t.Helper()
+	mockRegistry := new(IntegrationMockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{
+		"transform": &replayNodeFactory{factory: runtime.NewTransformNodeWrapper},
+	}, plugins.NewPluginRegistry())
+
+	flowDef := &runtime.Flow{
+		ID: "replay-flow",
+		YAML: `
+metadata:
+  name: replay-flow
+nodes:
+  first:
+    type: transform
+    params:
+      script: "return {doubled: input.data.value * 2};"
+    next:
+      default: second
+  second:
+    type: transform
+    params:
+      script: "return {seen: input.result.doubled};"
+`,
+	}
+	mockRegistry.On("GetFlow", "test-account", "replay-flow").Return(flowDef, nil)
+	mockRegistry.On("GetFlow", "test-account", "echo-flow").Return(&runtime.Flow{
+		ID: "echo-flow",
+		YAML: `
+metadata:
+  name: echo-flow
+nodes:
+  echo:
+    type: transform
+    params:
+      script: "return {token: input.api_token};"
+`,
+	}, nil)
+
+	store := newReplayExecutionStore()
+	checkpoints := storage.NewMemoryCheckpointStore()
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockRegistry, yamlLoader, store)
+	require.NoError(t, flowRuntime.(runtime.CheckpointFlowRuntime).SetCheckpointStore(checkpoints, []byte("test-encryption-key-32-bytes-123")))
+	return flowRuntime.(runtime.RerunFlowRuntime), store, checkpoints
+}
+
+// checkpointedNodes returns which of the nodes were checkpointed in an execution
+func checkpointedNodes(t *testing.T, checkpoints runtime.CheckpointStore, executionID string, nodes ...string) []string {
+	t.Helper()
+	var found []string
+	for _, node := range nodes {
+		_, err := checkpoints.GetCheckpoint(executionID, node)
+		if err == nil {
+			found = append(found, node)
+		} else {
+			require.ErrorIs(t, err, runtime.ErrCheckpointNotFound)
+		}
+	}
+	return found
+}
+
+func TestFlowRuntime_StoresRedactedInput(t *testing.T) {
+	flowRuntime, _, _ := newReplayRuntime(t)
+
+	executionID, err := flowRuntime.Execute("test-account", "replay-flow", map[string]interface{}{
+		"data":      map[string]interface{}{"value": 21},
+		"api_token": "super-secret",
+	})
+	require.NoError(t, err)
+
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "completed", status.Status)
+	assert.Equal(t, "[REDACTED]", status.Input["api_token"])
+	assert.Equal(t, map[string]interface{}{"value": 21}, status.Input["data"])
+	assert.Equal(t, "test-account", status.Metadata["account_id"])
+}
+
+func TestFlowRuntime_Rerun(t *testing.T) {
+	flowRuntime, store, _ := newReplayRuntime(t)
+
+	originalID, err := flowRuntime.Execute("test-account", "replay-flow", map[string]interface{}{
+		"data": map[string]interface{}{"value": 21},
+	})
+	require.NoError(t, err)
+	waitForCompletion(t, flowRuntime, originalID)
+
+	rerunID, err := flowRuntime.Rerun("test-account", originalID, runtime.RerunOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, originalID, rerunID)
+
+	status := waitForCompletion(t, flowRuntime, rerunID)
+	assert.Equal(t, "completed", status.Status)
+	assert.Equal(t, originalID, status.Metadata["rerun_of"])
+	assert.Equal(t, originalID, status.Metadata["rerun_root"])
+	assert.Equal(t, "rerun", status.Metadata["rerun_mode"])
+
+	// Lineage points back to the first execution across generations
+	secondID, err := flowRuntime.Rerun("test-account", rerunID, runtime.RerunOptions{})
+	require.NoError(t, err)
+	status = waitForCompletion(t, flowRuntime, secondID)
+	assert.Equal(t, rerunID, status.Metadata["rerun_of"])
+	assert.Equal(t, originalID, status.Metadata["rerun_root"])
+
+	// Other accounts cannot rerun the execution
+	_, err = flowRuntime.Rerun("other-account", originalID, runtime.RerunOptions{})
+	assert.ErrorIs(t, err, runtime.ErrExecutionForbidden)
+	_, err = flowRuntime.Rerun("test-account", "missing", runtime.RerunOptions{})
+	assert.ErrorIs(t, err, runtime.ErrExecutionNotFound)
+
+	// Executions stored without their account in the metadata are checked
+	// against the account of the stored execution
+	legacy := store.executions[originalID]
+	legacy.Metadata = map[string]string{}
+	require.NoError(t, store.SaveExecution(legacy))
+	_, err = flowRuntime.Rerun("other-account", originalID, runtime.RerunOptions{})
+	assert.ErrorIs(t, err, runtime.ErrExecutionForbidden)
+	legacyRerunID, err := flowRuntime.Rerun("test-account", originalID, runtime.RerunOptions{})
+	require.NoError(t, err)
+	status = waitForCompletion(t, flowRuntime, legacyRerunID)
+	assert.Equal(t, "completed", status.Status, status.Error)
+}
+
+// unavailableExecutionStore fails to get executions
+type unavailableExecutionStore struct {
+	*replayExecutionStore
+}
+
+func (s unavailableExecutionStore) GetExecution(executionID string) (runtime.ExecutionStatus, error) {
+	return runtime.ExecutionStatus{}, errors.New("store unavailable")
+}
+
+func TestFlowRuntime_RerunStoreFailure(t *testing.T) {
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{}, plugins.NewPluginRegistry())
+	flowRuntime := runtime.NewFlowRuntimeWithStore(new(IntegrationMockFlowRegistry), yamlLoader, unavailableExecutionStore{newReplayExecutionStore()})
+
+	// Failing to read the execution is not reported as a missing execution
+	_, err := flowRuntime.(runtime.RerunFlowRuntime).Rerun("test-account", "original", runtime.RerunOptions{})
+	assert.ErrorContains(t, err, "store unavailable")
+	assert.NotErrorIs(t, err, runtime.ErrExecutionNotFound)
+}
+
+func TestFlowRuntime_RerunReplaysRedactedInput(t *testing.T) {
+	flowRuntime, _, checkpoints := newReplayRuntime(t)
+
+	originalID, err := flowRuntime.Execute("test-account", "echo-flow", map[string]interface{}{
+		"data":      map[string]interface{}{"value": 1},
+		"api_token": "super-secret",
+	})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, originalID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, "[REDACTED]", status.Input["api_token"])
+
+	// Checkpoints keep the input sealed
+	checkpoint, err := checkpoints.GetCheckpoint(originalID, "echo")
+	require.NoError(t, err)
+	assert.NotContains(t, string(checkpoint.Data), "super-secret")
+
+	rerunID, err := flowRuntime.Rerun("test-account", originalID, runtime.RerunOptions{})
+	require.NoError(t, err)
+	status = waitForCompletion(t, flowRuntime, rerunID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, map[string]interface{}{"token": "super-secret"}, status.Results["result"])
+
+	// Without the input checkpoint, redacted inputs cannot be replayed
+	mockRegistry := new(IntegrationMockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{
+		"transform": &replayNodeFactory{factory: runtime.NewTransformNodeWrapper},
+	}, plugins.NewPluginRegistry())
+	store := newReplayExecutionStore()
+	withoutCheckpoints := runtime.NewFlowRuntimeWithStore(mockRegistry, yamlLoader, store).(runtime.RerunFlowRuntime)
+	original, err := flowRuntime.GetStatus(originalID)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveExecution(original))
+	_, err = withoutCheckpoints.Rerun("test-account", originalID, runtime.RerunOptions{})
+	assert.ErrorContains(t, err, "was redacted and cannot be replayed")
+}
+
+func TestFlowRuntime_ReplayFromNode(t *testing.T) {
+	flowRuntime, _, checkpoints := newReplayRuntime(t)
+
+	originalID, err := flowRuntime.Execute("test-account", "replay-flow", map[string]interface{}{
+		"data": map[string]interface{}{"value": 21},
+	})
+	require.NoError(t, err)
+	waitForCompletion(t, flowRuntime, originalID)
+
+	replayID, err := flowRuntime.Rerun("test-account", originalID, runtime.RerunOptions{FromNode: "second"})
+	require.NoError(t, err)
+
+	status := waitForCompletion(t, flowRuntime, replayID)
+	assert.Equal(t, "completed", status.Status)
+	assert.Equal(t, "replay", status.Metadata["rerun_mode"])
+	assert.Equal(t, "second", status.Metadata["replay_from_node"])
+
+	// Only the second node ran in the replay
+	assert.Equal(t, []string{"second"}, checkpointedNodes(t, checkpoints, replayID, "first", "second"))
+
+	_, err = flowRuntime.Rerun("test-account", originalID, runtime.RerunOptions{FromNode: "missing"})
+	assert.Error(t, err)
+}
+
+func TestFlowRuntime_ExecuteEntrypoint(t *testing.T) {
+	mockRegistry := new(IntegrationMockFlowRegistry)
+	yamlLoader := loader.NewYAMLLoader(map[string]plugins.NodeFactory{
+		"transform": &replayNodeFactory{factory: runtime.NewTransformNodeWrapper},
+	}, plugins.NewPluginRegistry())
+
+	mockRegistry.On("GetFlow", "test-account", "trigger-flow").Return(&runtime.Flow{
+		ID: "trigger-flow",
+		YAML: `
+metadata:
+  name: trigger-flow
+entrypoints:
+  on_email: from_email
+  on_http: from_http
+nodes:
+  from_email:
+    type: transform
+    params:
+      script: "return {source: 'email'};"
+    next:
+      default: handle
+  from_http:
+    type: transform
+    params:
+      script: "return {source: 'http'};"
+    next:
+      default: handle
+  handle:
+    type: transform
+    params:
+      script: "return {handled: input.result.source};"
+`,
+	}, nil)
+
+	checkpoints := storage.NewMemoryCheckpointStore()
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockRegistry, yamlLoader, newReplayExecutionStore())
+	require.NoError(t, flowRuntime.(runtime.CheckpointFlowRuntime).SetCheckpointStore(checkpoints, nil))
+
+	executionID, err := flowRuntime.(runtime.EntrypointFlowRuntime).ExecuteWithOptions("test-account", "trigger-flow", map[string]interface{}{
+		"data": map[string]interface{}{"body": "hello"},
+	}, runtime.ExecuteOptions{Entrypoint: "on_http"})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, "on_http", status.Metadata["entrypoint"])
+
+	assert.Equal(t, []string{"from_http", "handle"}, checkpointedNodes(t, checkpoints, executionID, "from_email", "from_http", "handle"))
+
+	// Reruns start at the same entry point
+	rerunID, err := flowRuntime.(runtime.RerunFlowRuntime).Rerun("test-account", executionID, runtime.RerunOptions{})
+	require.NoError(t, err)
+	status = waitForCompletion(t, flowRuntime, rerunID)
+	assert.Equal(t, "on_http", status.Metadata["entrypoint"])
+
+	// The flow has no default start node
+	_, err = flowRuntime.Execute("test-account", "trigger-flow", nil)
+	assert.ErrorContains(t, err, "no default start node")
+
+	_, err = flowRuntime.(runtime.EntrypointFlowRuntime).ExecuteWithOptions("test-account", "trigger-flow", nil, runtime.ExecuteOptions{Entrypoint: "on_sms"})
+	assert.ErrorContains(t, err, "entry point 'on_sms' not found")
+}
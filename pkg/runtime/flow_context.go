@@ -1,6 +1,8 @@
 package runtime
 
 import (
+	"strings"
+
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/scripting"
 )
@@ -98,3 +100,10 @@ func (fc *FlowContext) createEvaluationContext() map[string]any {
 func (fc *FlowContext) GetEvaluationContext() map[string]any {
 	return fc.createEvaluationContext()
 }
+
+// isReservedSharedKey reports whether a key of the shared context is owned by
+// the runtime: internal keys carry the execution handle, flow context and
+// secret vault, and accountID selects the vault secrets are read from
+func isReservedSharedKey(key string) bool {
+	return strings.HasPrefix(key, "_") || key == "accountID"
+}
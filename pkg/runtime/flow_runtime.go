@@ -2,11 +2,14 @@ package runtime
 
 import (
 	"context"
+	"crypto/cipher"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/tcmartin/flowlib"
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/loader"
 )
@@ -26,6 +29,31 @@ type flowRuntime struct {
 	yamlLoader     loader.YAMLLoader
 	executionStore ExecutionStore
 	secretVault    auth.SecretVault // Add secret vault support
+	llmPrices      LLMPriceTable
+	quotaSource    QuotaSource
+	quotas         quotaTracker
+
+	// conversationStore is guarded by mu
+	conversationStore ConversationStore
+
+	// promptStore is guarded by mu; promptsMu serializes the tagging of its
+	// versions in this process
+	promptStore PromptStore
+	promptsMu   sync.Mutex
+
+	// llmCacheStore and llmCacheOptions are guarded by mu
+	llmCacheStore   LLMCacheStore
+	llmCacheOptions LLMCacheOptions
+
+	// artifactStore and downloadDir are guarded by mu
+	artifactStore ArtifactStore
+	downloadDir   string
+
+	// checkpointsMu guards the checkpoint store and the cipher sealing its
+	// checkpoints
+	checkpointStore  CheckpointStore
+	checkpointCipher cipher.AEAD
+	checkpointsMu    sync.RWMutex
 
 	// In-memory tracking for active executions
 	activeExecutions map[string]*executionContext
@@ -36,10 +64,13 @@ type flowRuntime struct {
 type executionContext struct {
 	accountID   string
 	flowID      string
+	graph       *loader.FlowGraph
+	startNode   string
 	status      ExecutionStatus
 	cancel      context.CancelFunc
-	logChannel  chan ExecutionLog
-	subscribers []chan ExecutionLog
+	subscribers []*logSubscriber
+	done        chan struct{}
+	quota       *quotaTicket
 	mu          sync.RWMutex
 }
 
@@ -84,26 +115,162 @@ func NewFlowRuntimeWithStoreAndSecrets(registry FlowRegistry, yamlLoader loader.
 }
 
 func (r *flowRuntime) Execute(accountID string, flowID string, input map[string]interface{}) (string, error) {
+	return r.ExecuteWithOptions(accountID, flowID, input, ExecuteOptions{})
+}
+
+func (r *flowRuntime) ExecuteWithOptions(accountID string, flowID string, input map[string]interface{}, options ExecuteOptions) (string, error) {
 	flowDef, err := r.registry.GetFlow(accountID, flowID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get flow: %w", err)
 	}
 
-	flow, err := r.yamlLoader.Parse(flowDef.YAML)
+	return r.startExecution(accountID, flowID, flowDef, input, executionStart{entrypoint: options.Entrypoint})
+}
+
+// executionStart describes where and with what state a new execution begins
+type executionStart struct {
+	// entrypoint names the flow entry point to start at
+	entrypoint string
+
+	// startNode overrides the flow's start node and entry point
+	startNode string
+
+	// shared replaces the input as the initial shared context
+	shared map[string]interface{}
+
+	// metadata is merged into the execution metadata
+	metadata map[string]string
+
+	// admit counts the execution against the account's quota
+	admit bool
+}
+
+// loaderFor returns the YAML loader for flows of an account, resolving
+// imports to the account's other flows when the loader supports them
+func (r *flowRuntime) loaderFor(accountID string) loader.YAMLLoader {
+	resolving, ok := r.yamlLoader.(loader.ResolvingLoader)
+	if !ok {
+		return r.yamlLoader
+	}
+
+	if registry, ok := r.registry.(ImportResolvingFlowRegistry); ok {
+		return resolving.WithResolver(registry.ImportResolver(accountID))
+	}
+	return resolving.WithResolver(loader.ImportResolverFunc(func(name string) (string, string, error) {
+		flowDef, err := r.registry.GetFlow(accountID, name)
+		if err != nil {
+			return "", "", err
+		}
+		return flowDef.YAML, "flow:" + name, nil
+	}))
+}
+
+// startExecution parses the flow, registers the execution and runs it in the background
+func (r *flowRuntime) startExecution(accountID, flowID string, flowDef *Flow, input map[string]interface{}, start executionStart) (string, error) {
+	start.admit = true
+	execCtx, err := r.launchExecution(accountID, flowID, flowDef, input, start)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse flow YAML: %w", err)
+		return "", err
+	}
+	return execCtx.status.ID, nil
+}
+
+// launchExecution is startExecution returning the context of the running execution
+func (r *flowRuntime) launchExecution(accountID, flowID string, flowDef *Flow, input map[string]interface{}, start executionStart) (*executionContext, error) {
+	yamlLoader := r.loaderFor(accountID)
+
+	var flow interface{}
+	var graph *loader.FlowGraph
+	if graphLoader, ok := yamlLoader.(loader.GraphLoader); ok {
+		parsed, err := graphLoader.ParseGraph(flowDef.YAML)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse flow YAML: %w", err)
+		}
+		graph = parsed
+		flow = parsed.Flow
+	} else {
+		parsed, err := yamlLoader.Parse(flowDef.YAML)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse flow YAML: %w", err)
+		}
+		flow = parsed
+	}
+
+	startNode := ""
+	if graph != nil {
+		startNode = graph.StartNode
+	}
+	if start.entrypoint != "" {
+		if graph == nil {
+			return nil, fmt.Errorf("cannot start at entry point '%s': flow loader does not expose entry points", start.entrypoint)
+		}
+		node, ok := graph.Entrypoints[start.entrypoint]
+		if !ok {
+			return nil, fmt.Errorf("entry point '%s' not found in flow '%s'", start.entrypoint, flowID)
+		}
+		startNode = node
+	}
+	if start.startNode != "" {
+		if graph == nil {
+			return nil, fmt.Errorf("cannot start at node '%s': flow loader does not expose node names", start.startNode)
+		}
+		if _, ok := graph.Nodes[start.startNode]; !ok {
+			return nil, fmt.Errorf("node '%s' not found in flow '%s'", start.startNode, flowID)
+		}
+		startNode = start.startNode
+	}
+	if graph != nil && startNode == "" {
+		return nil, fmt.Errorf("flow '%s' has no default start node; specify one of its entry points", flowID)
+	}
+
+	var ticket *quotaTicket
+	if start.admit {
+		var err error
+		if ticket, err = r.admitExecution(accountID); err != nil {
+			return nil, err
+		}
 	}
 
 	executionID := uuid.New().String()
 
+	// Byte contents of the input are stored as artifacts of the execution
+	r.mu.RLock()
+	artifactStore := r.artifactStore
+	r.mu.RUnlock()
+	if artifactStore != nil {
+		x := artifactExternalizer{store: artifactStore, accountID: accountID, executionID: executionID}
+		externalized, replaced, err := x.externalize(input)
+		if err != nil {
+			ticket.release()
+			return nil, err
+		}
+		if replaced {
+			input = externalized.(map[string]interface{})
+		}
+	}
+
+	metadata := map[string]string{"account_id": accountID}
+	if flowDef.Version != "" {
+		metadata["flow_version"] = flowDef.Version
+	}
+	if start.entrypoint != "" {
+		metadata["entrypoint"] = start.entrypoint
+	}
+	for k, v := range start.metadata {
+		metadata[k] = v
+	}
+
 	// Create execution context
 	ctx, cancel := context.WithCancel(context.Background())
 	execCtx := &executionContext{
 		accountID:   accountID,
 		flowID:      flowID,
+		graph:       graph,
+		startNode:   startNode,
 		cancel:      cancel,
-		logChannel:  make(chan ExecutionLog, 100),
-		subscribers: make([]chan ExecutionLog, 0),
+		subscribers: make([]*logSubscriber, 0),
+		done:        make(chan struct{}),
+		quota:       ticket,
 		status: ExecutionStatus{
 			ID:        executionID,
 			FlowID:    flowID,
@@ -111,9 +278,18 @@ func (r *flowRuntime) Execute(accountID string, flowID string, input map[string]
 			StartTime: time.Now(),
 			Progress:  0.0,
 			Results:   make(map[string]interface{}),
+			Input:     r.redactSecrets(accountID, input),
+			Metadata:  metadata,
 		},
 	}
 
+	if ticket != nil && ticket.ready != nil {
+		execCtx.status.Status = "queued"
+	}
+
+	// The input is kept unredacted for reruns
+	r.checkpoint(executionID, inputCheckpoint, input)
+
 	// Store in active executions
 	r.mu.Lock()
 	r.activeExecutions[executionID] = execCtx
@@ -133,10 +309,15 @@ func (r *flowRuntime) Execute(accountID string, flowID string, input map[string]
 		}
 	}
 
+	shared := input
+	if start.shared != nil {
+		shared = start.shared
+	}
+
 	// Start execution in goroutine
-	go r.executeFlow(ctx, execCtx, flow, input)
+	go r.executeFlow(ctx, execCtx, flow, shared)
 
-	return executionID, nil
+	return execCtx, nil
 }
 
 func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext, flow interface{}, input map[string]interface{}) {
@@ -146,8 +327,10 @@ func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext
 			r.updateExecutionStatus(execCtx.status.ID, "failed", fmt.Sprintf("Flow execution panicked: %v", rec), nil)
 		}
 
-		// Close log channel when execution is done
-		close(execCtx.logChannel)
+		execCtx.quota.release()
+
+		// Subscriptions end once the execution is done
+		close(execCtx.done)
 
 		// Remove from active executions
 		r.mu.Lock()
@@ -155,6 +338,10 @@ func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext
 		r.mu.Unlock()
 	}()
 
+	if !r.awaitQuota(ctx, execCtx) {
+		return
+	}
+
 	r.logExecution(execCtx.status.ID, "info", "Starting flow execution", map[string]interface{}{"flowID": execCtx.flowID, "accountID": execCtx.accountID})
 
 	// Create FlowContext for proper expression evaluation
@@ -179,6 +366,7 @@ func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext
 		"flow_id":      execCtx.flowID,
 		"account_id":   execCtx.accountID,
 		"logger":       r.logExecution,
+		"stream":       r.streamExecution,
 	}
 
 	// Add flow context if available for expression evaluation
@@ -191,12 +379,17 @@ func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext
 		enhancedInput["_secret_vault"] = r.secretVault  // Add secret vault for NodeWrapper access
 	}
 
+	// Let agent tools run nodes and flows of this execution
+	enhancedInput[toolEnvironmentKey] = &toolEnvironment{runtime: r, execCtx: execCtx, ctx: ctx, shared: enhancedInput}
+
 	// Execute the flow
 	var result interface{}
 	var err error
 
-	// Check if flow supports context-aware execution
-	if flowWithCtx, ok := flow.(interface {
+	// Walk named graphs node by node so every step can be checkpointed
+	if execCtx.graph != nil {
+		result, err = r.runGraph(ctx, execCtx, enhancedInput)
+	} else if flowWithCtx, ok := flow.(interface {
 		RunWithContext(ctx context.Context, shared interface{}) (interface{}, error)
 	}); ok {
 		result, err = flowWithCtx.RunWithContext(ctx, enhancedInput)
@@ -218,6 +411,10 @@ func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext
 	}
 
 	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			r.logExecution(execCtx.status.ID, "info", "Flow execution stopped after cancellation", nil)
+			return
+		}
 		r.logExecution(execCtx.status.ID, "error", "Flow execution failed", map[string]interface{}{"error": err.Error()})
 		r.updateExecutionStatus(execCtx.status.ID, "failed", err.Error(), nil)
 		return
@@ -237,6 +434,46 @@ func (r *flowRuntime) executeFlow(ctx context.Context, execCtx *executionContext
 	r.updateExecutionStatus(execCtx.status.ID, "completed", "", resultMap)
 }
 
+// runGraph executes a named flow graph from the execution's start node,
+// checkpointing the shared context before each node runs
+func (r *flowRuntime) runGraph(ctx context.Context, execCtx *executionContext, shared map[string]interface{}) (interface{}, error) {
+	nodeNames := make(map[flowlib.Node]string, len(execCtx.graph.Nodes))
+	for name, node := range execCtx.graph.Nodes {
+		nodeNames[node] = name
+	}
+
+	var last flowlib.Action
+	curr := execCtx.graph.Nodes[execCtx.startNode]
+	for curr != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if name, ok := nodeNames[curr]; ok {
+			r.setCurrentNode(execCtx, name)
+			r.checkpoint(execCtx.status.ID, name, shared)
+		}
+
+		var err error
+		last, err = curr.Run(shared)
+		if err != nil {
+			return nil, err
+		}
+
+		action := last
+		if action == "" {
+			action = flowlib.DefaultAction
+		}
+		curr = curr.Successors()[action]
+	}
+
+	results := map[string]interface{}{"action": last}
+	if result, ok := shared["result"]; ok {
+		results["result"] = result
+	}
+	return results, nil
+}
+
 func (r *flowRuntime) GetStatus(executionID string) (ExecutionStatus, error) {
 	// First check active executions
 	r.mu.RLock()
@@ -254,7 +491,7 @@ func (r *flowRuntime) GetStatus(executionID string) (ExecutionStatus, error) {
 		return r.executionStore.GetExecution(executionID)
 	}
 
-	return ExecutionStatus{}, fmt.Errorf("execution not found: %s", executionID)
+	return ExecutionStatus{}, fmt.Errorf("%w: %s", ErrExecutionNotFound, executionID)
 }
 
 func (r *flowRuntime) GetLogs(executionID string) ([]ExecutionLog, error) {
@@ -275,26 +512,20 @@ func (r *flowRuntime) SubscribeToLogs(executionID string) (<-chan ExecutionLog,
 		return nil, fmt.Errorf("execution not found or not active: %s", executionID)
 	}
 
-	// Create a subscriber channel
-	subscriber := make(chan ExecutionLog, 100)
+	// Create a subscriber
+	subscriber := &logSubscriber{
+		logs:   make(chan ExecutionLog, 100),
+		notify: make(chan struct{}, 1),
+	}
 
 	execCtx.mu.Lock()
 	execCtx.subscribers = append(execCtx.subscribers, subscriber)
 	execCtx.mu.Unlock()
 
 	// Start a goroutine to forward logs to the subscriber
-	go func() {
-		defer close(subscriber)
-		for log := range execCtx.logChannel {
-			select {
-			case subscriber <- log:
-			default:
-				// Subscriber channel is full, skip this log
-			}
-		}
-	}()
+	go subscriber.forward(execCtx.done)
 
-	return subscriber, nil
+	return subscriber.logs, nil
 }
 
 func (r *flowRuntime) Cancel(executionID string) error {
@@ -320,12 +551,16 @@ func (r *flowRuntime) Cancel(executionID string) error {
 // Helper methods
 
 func (r *flowRuntime) logExecution(executionID, level, message string, data map[string]interface{}) {
-	log := ExecutionLog{
-		Timestamp: time.Now(),
-		Level:     level,
-		Message:   message,
-		Data:      data,
-	}
+	r.publishLog(executionID, ExecutionLog{
+		Level:   level,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// publishLog timestamps a log entry, persists it and forwards it to subscribers
+func (r *flowRuntime) publishLog(executionID string, log ExecutionLog) {
+	log.Timestamp = time.Now()
 
 	// Save to execution store if available
 	if r.executionStore != nil {
@@ -335,22 +570,96 @@ func (r *flowRuntime) logExecution(executionID, level, message string, data map[
 		}
 	}
 
-	// Send to active subscribers
+	r.sendToSubscribers(executionID, log)
+}
+
+// streamExecution forwards a transient entry, such as a token delta of a
+// streamed LLM response, to the subscribers of an execution without
+// persisting it
+func (r *flowRuntime) streamExecution(executionID, level, message string, data map[string]interface{}) {
+	r.sendToSubscribers(executionID, ExecutionLog{
+		Timestamp: time.Now(),
+		Level:     level,
+		Message:   message,
+		Data:      data,
+	})
+}
+
+// sendToSubscribers queues a log entry for the subscribers of an active
+// execution
+func (r *flowRuntime) sendToSubscribers(executionID string, log ExecutionLog) {
 	r.mu.RLock()
 	if execCtx, ok := r.activeExecutions[executionID]; ok {
 		execCtx.mu.RLock()
 		for _, subscriber := range execCtx.subscribers {
-			select {
-			case subscriber <- log:
-			default:
-				// Subscriber channel is full, skip this log
-			}
+			subscriber.push(log)
 		}
 		execCtx.mu.RUnlock()
 	}
 	r.mu.RUnlock()
 }
 
+// logSubscriber queues the log entries of an execution for a subscriber, so
+// that a slow subscriber neither misses entries nor holds up the execution
+type logSubscriber struct {
+	logs chan ExecutionLog
+
+	// notify wakes forward up when entries are pending
+	notify  chan struct{}
+	pending []ExecutionLog
+	mu      sync.Mutex
+}
+
+// push queues a log entry for the subscriber
+func (s *logSubscriber) push(log ExecutionLog) {
+	s.mu.Lock()
+	s.pending = append(s.pending, log)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+		// forward is already notified
+	}
+}
+
+// take removes and returns the pending entries
+func (s *logSubscriber) take() []ExecutionLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
+// forward sends the queued entries to the subscriber in order, and closes
+// its channel once the execution is done and every entry is sent
+func (s *logSubscriber) forward(done <-chan struct{}) {
+	defer close(s.logs)
+	for {
+		pending := s.take()
+		for _, log := range pending {
+			s.logs <- log
+		}
+		if len(pending) > 0 {
+			continue
+		}
+		select {
+		case <-s.notify:
+		case <-done:
+			for _, log := range s.take() {
+				s.logs <- log
+			}
+			return
+		}
+	}
+}
+
+func (r *flowRuntime) setCurrentNode(execCtx *executionContext, nodeID string) {
+	execCtx.mu.Lock()
+	execCtx.status.CurrentNode = nodeID
+	execCtx.mu.Unlock()
+}
+
 func (r *flowRuntime) updateExecutionStatus(executionID, status, errorMsg string, results map[string]interface{}) {
 	r.mu.RLock()
 	execCtx, ok := r.activeExecutions[executionID]
@@ -0,0 +1,261 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// graphqlPagination follows a Relay-style connection of a query: the
+// cursor variable is set to pageInfo.endCursor while pageInfo.hasNextPage
+type graphqlPagination struct {
+	connectionPath string
+	cursorVariable string
+	maxPages       int
+}
+
+// parseGraphQLPagination reads the pagination param of a graphql node; it
+// returns nil when the node does not paginate
+func parseGraphQLPagination(value interface{}) (*graphqlPagination, error) {
+	params := mapParam(value)
+	if params == nil {
+		return nil, nil
+	}
+	p := &graphqlPagination{
+		cursorVariable: stringParamOr(params["cursor_variable"], "after"),
+		maxPages:       intParam(params["max_pages"], defaultHTTPMaxPages),
+	}
+	p.connectionPath, _ = params["connection_path"].(string)
+	if p.connectionPath == "" {
+		return nil, fmt.Errorf("graphql pagination requires connection_path")
+	}
+	if p.maxPages < 1 {
+		return nil, fmt.Errorf("pagination max_pages must be at least 1")
+	}
+	return p, nil
+}
+
+// connectionPage returns the nodes of a connection, from nodes or
+// edges[].node, and the cursor of the next page, or "" on the last page
+func (p *graphqlPagination) connectionPage(data interface{}) ([]interface{}, string, error) {
+	value, err := evaluateResponsePath(data, p.connectionPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if value == nil {
+		return nil, "", nil
+	}
+	connection, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("connection_path %q is not a connection object", p.connectionPath)
+	}
+
+	var nodes []interface{}
+	if list, ok := connection["nodes"].([]interface{}); ok {
+		nodes = list
+	} else if edges, ok := connection["edges"].([]interface{}); ok {
+		for _, edge := range edges {
+			if edgeMap, ok := edge.(map[string]interface{}); ok {
+				nodes = append(nodes, edgeMap["node"])
+			}
+		}
+	}
+
+	pageInfo, _ := connection["pageInfo"].(map[string]interface{})
+	if hasNext, _ := pageInfo["hasNextPage"].(bool); !hasNext {
+		return nodes, "", nil
+	}
+	cursor, _ := pageInfo["endCursor"].(string)
+	if cursor == "" {
+		return nil, "", fmt.Errorf("connection %q has a next page but no pageInfo.endCursor", p.connectionPath)
+	}
+	return nodes, cursor, nil
+}
+
+// graphqlErrorMessages returns the messages of the errors of a GraphQL
+// response
+func graphqlErrorMessages(errors []interface{}) string {
+	messages := make([]string, 0, len(errors))
+	for _, item := range errors {
+		if errMap, ok := item.(map[string]interface{}); ok {
+			if message, ok := errMap["message"].(string); ok {
+				if path, ok := errMap["path"].([]interface{}); ok && len(path) > 0 {
+					parts := make([]string, len(path))
+					for i, part := range path {
+						parts[i] = fmt.Sprint(part)
+					}
+					message = fmt.Sprintf("%s (at %s)", message, strings.Join(parts, "."))
+				}
+				messages = append(messages, message)
+				continue
+			}
+		}
+		messages = append(messages, fmt.Sprint(item))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// NewGraphQLNodeWrapper creates a new graphql node wrapper, sending a query
+// to a GraphQL endpoint and following connection pages
+func NewGraphQLNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
+	// Create the base node
+	baseNode := flowlib.NewNode(1, 0)
+
+	// Create HTTP client
+	httpClient := utils.NewHTTPClient()
+
+	// Create the wrapper
+	wrapper := &NodeWrapper{
+		node: baseNode,
+		exec: func(input interface{}) (interface{}, error) {
+			params, err := combinedParams(input)
+			if err != nil {
+				return nil, err
+			}
+
+			url, ok := params["url"].(string)
+			if !ok || url == "" {
+				return nil, fmt.Errorf("url parameter is required")
+			}
+			query, ok := params["query"].(string)
+			if !ok || query == "" {
+				return nil, fmt.Errorf("query parameter is required")
+			}
+			operationName, _ := params["operation_name"].(string)
+			allowPartial, _ := params["allow_partial"].(bool)
+
+			// Variables are copied, as pagination sets the cursor
+			variables := make(map[string]interface{})
+			for name, value := range mapParam(params["variables"]) {
+				variables[name] = value
+			}
+
+			pagination, err := parseGraphQLPagination(params["pagination"])
+			if err != nil {
+				return nil, err
+			}
+
+			headers := map[string]string{"Accept": "application/json"}
+			for key, value := range mapParam(params["headers"]) {
+				headers[key] = fmt.Sprintf("%v", value)
+			}
+			env := toolEnvironmentFrom(input)
+			auth, err := requestAuth(params, env)
+			if err != nil {
+				return nil, err
+			}
+			timeout := durationParam(params["timeout"], 0)
+
+			// send posts the query with the current variables and returns the
+			// decoded GraphQL response
+			send := func() (map[string]interface{}, error) {
+				requestURL, redirectOrigin := url, ""
+				if secretKey, ok := params["credential"].(string); ok && secretKey != "" {
+					resolvedURL, origin, err := applyCredential(secretKey, env, url, headers)
+					if err != nil {
+						return nil, err
+					}
+					requestURL, redirectOrigin = resolvedURL, origin
+				}
+				body := map[string]interface{}{"query": query, "variables": variables}
+				if operationName != "" {
+					body["operationName"] = operationName
+				}
+				resp, err := httpClient.Do(&utils.HTTPRequest{
+					URL:            requestURL,
+					Method:         "POST",
+					Headers:        headers,
+					Body:           body,
+					Timeout:        timeout,
+					Auth:           auth,
+					FollowRedirect: true,
+					RedirectOrigin: redirectOrigin,
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				// Servers may report errors with a non-2xx status and a
+				// GraphQL body; other bodies are transport failures
+				response, ok := httpResponseData(resp).(map[string]interface{})
+				if !ok || (response["data"] == nil && response["errors"] == nil) {
+					return nil, fmt.Errorf("graphql request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(resp.RawBody)))
+				}
+				if errors, _ := response["errors"].([]interface{}); len(errors) > 0 {
+					if !allowPartial || response["data"] == nil {
+						return nil, fmt.Errorf("graphql errors: %s", graphqlErrorMessages(errors))
+					}
+				}
+				return response, nil
+			}
+
+			start := time.Now()
+			result := map[string]interface{}{}
+			var errors []interface{}
+			if pagination == nil {
+				response, err := send()
+				if err != nil {
+					return nil, err
+				}
+				result["data"] = response["data"]
+				errors, _ = response["errors"].([]interface{})
+			} else {
+				items := []interface{}{}
+				pages, truncated := 0, false
+				for {
+					response, err := send()
+					if err != nil {
+						return nil, fmt.Errorf("page %d: %w", pages+1, err)
+					}
+					pages++
+					result["data"] = response["data"]
+					if pageErrors, ok := response["errors"].([]interface{}); ok {
+						errors = append(errors, pageErrors...)
+					}
+
+					nodes, cursor, err := pagination.connectionPage(response["data"])
+					if err != nil {
+						return nil, fmt.Errorf("page %d: %w", pages, err)
+					}
+					items = append(items, nodes...)
+					if cursor == "" {
+						break
+					}
+					if pages >= pagination.maxPages {
+						truncated = true
+						break
+					}
+					variables[pagination.cursorVariable] = cursor
+				}
+				result["items"] = items
+				result["pages"] = pages
+				result["truncated"] = truncated
+			}
+
+			if len(errors) > 0 {
+				result["errors"] = errors
+			}
+			result["duration"] = time.Since(start).String()
+			return result, nil
+		},
+		post: func(shared, p, e interface{}) (flowlib.Action, error) {
+			// Partial results go to the "errors" action when the node has one
+			if result, ok := e.(map[string]interface{}); ok {
+				if _, hasErrors := result["errors"]; hasErrors {
+					if _, ok := baseNode.Successors()["errors"]; ok {
+						return "errors", nil
+					}
+				}
+			}
+			return flowlib.DefaultAction, nil
+		},
+	}
+
+	// Set the parameters
+	wrapper.SetParams(params)
+
+	return wrapper, nil
+}
@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowlib"
+)
+
+// execGraphQL runs a graphql node with params and returns its result and
+// action
+func execGraphQL(t *testing.T, params map[string]interface{}, actions ...flowlib.Action) (map[string]interface{}, flowlib.Action, error) {
+	t.Helper()
+	node, err := NewGraphQLNodeWrapper(params)
+	require.NoError(t, err)
+	for _, action := range actions {
+		node.Next(action, flowlib.NewNode(1, 0))
+	}
+	result, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": params})
+	if err != nil {
+		return nil, "", err
+	}
+	action, err := node.(*NodeWrapper).post(nil, nil, result)
+	require.NoError(t, err)
+	return result.(map[string]interface{}), action, nil
+}
+
+func TestGraphQLNode(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+		var request map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+
+		w.Header().Set("Content-Type", "application/graphql-response+json")
+		variables, _ := request["variables"].(map[string]interface{})
+		switch request["operationName"] {
+		case "Viewer":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"viewer": map[string]interface{}{"login": variables["login"]}}})
+		case "Partial":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data":   map[string]interface{}{"viewer": nil},
+				"errors": []interface{}{map[string]interface{}{"message": "forbidden", "path": []interface{}{"viewer", 0}}},
+			})
+		case "Broken":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []interface{}{map[string]interface{}{"message": "syntax error"}}})
+		case "Issues":
+			pages := map[interface{}]map[string]interface{}{
+				nil:  {"edges": []interface{}{map[string]interface{}{"node": "a"}, map[string]interface{}{"node": "b"}}, "pageInfo": map[string]interface{}{"hasNextPage": true, "endCursor": "c2"}},
+				"c2": {"nodes": []interface{}{"c"}, "pageInfo": map[string]interface{}{"hasNextPage": false, "endCursor": "c3"}},
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"repo": map[string]interface{}{"issues": pages[variables["cursor"]]}}})
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+		}
+	}))
+	defer server.Close()
+
+	params := func(operation string, extra map[string]interface{}) map[string]interface{} {
+		p := map[string]interface{}{
+			"url":            server.URL,
+			"query":          "query " + operation + " { ... }",
+			"operation_name": operation,
+			"auth":           map[string]interface{}{"token": "token-1"},
+		}
+		for key, value := range extra {
+			p[key] = value
+		}
+		return p
+	}
+
+	result, action, err := execGraphQL(t, params("Viewer", map[string]interface{}{"variables": map[string]interface{}{"login": "ada"}}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"viewer": map[string]interface{}{"login": "ada"}}, result["data"])
+	assert.NotContains(t, result, "errors")
+	assert.Equal(t, flowlib.DefaultAction, action)
+	assert.Equal(t, "query Viewer { ... }", requests[0]["query"])
+
+	// Errors fail the node unless partial data is allowed
+	_, _, err = execGraphQL(t, params("Partial", nil))
+	assert.ErrorContains(t, err, "graphql errors: forbidden (at viewer.0)")
+	result, action, err = execGraphQL(t, params("Partial", map[string]interface{}{"allow_partial": true}), "errors", "default")
+	require.NoError(t, err)
+	assert.Len(t, result["errors"], 1)
+	assert.Equal(t, flowlib.Action("errors"), action)
+
+	_, _, err = execGraphQL(t, params("Broken", map[string]interface{}{"allow_partial": true}))
+	assert.ErrorContains(t, err, "syntax error")
+	_, _, err = execGraphQL(t, params("Down", nil))
+	assert.ErrorContains(t, err, "graphql request failed with status 502: bad gateway")
+
+	// Connections are followed through the cursor variable
+	requests = nil
+	result, _, err = execGraphQL(t, params("Issues", map[string]interface{}{
+		"pagination": map[string]interface{}{"connection_path": "repo.issues", "cursor_variable": "cursor"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, result["items"])
+	assert.Equal(t, 2, result["pages"])
+	assert.Equal(t, false, result["truncated"])
+	require.Len(t, requests, 2)
+	assert.Equal(t, "c2", requests[1]["variables"].(map[string]interface{})["cursor"])
+
+	result, _, err = execGraphQL(t, params("Issues", map[string]interface{}{
+		"pagination": map[string]interface{}{"connection_path": "$.repo.issues", "cursor_variable": "cursor", "max_pages": 1},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, result["items"])
+	assert.Equal(t, true, result["truncated"])
+}
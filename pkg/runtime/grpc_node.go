@@ -0,0 +1,511 @@
+package runtime
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// defaultGRPCTimeout bounds a gRPC call when the node sets no timeout
+const defaultGRPCTimeout = 30 * time.Second
+
+// grpcJSON maps messages to JSON with the field names of the .proto files
+// and all fields present
+var grpcJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// grpcResolver resolves descriptors from the files of a service, falling
+// back to the well-known types compiled into the binary
+type grpcResolver struct {
+	files *protoregistry.Files
+}
+
+func (r grpcResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if file, err := r.files.FindFileByPath(path); err == nil {
+		return file, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r grpcResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if descriptor, err := r.files.FindDescriptorByName(name); err == nil {
+		return descriptor, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// buildGRPCFiles builds the descriptors of a set of file descriptor protos.
+// Dependencies missing from the set are taken from the well-known types or
+// requested from fetch, when set.
+func buildGRPCFiles(protos map[string]*descriptorpb.FileDescriptorProto, fetch func(filename string) ([]*descriptorpb.FileDescriptorProto, error)) (grpcResolver, error) {
+	resolver := grpcResolver{files: new(protoregistry.Files)}
+
+	var register func(filename string) error
+	register = func(filename string) error {
+		if _, err := resolver.files.FindFileByPath(filename); err == nil {
+			return nil
+		}
+		fileProto, ok := protos[filename]
+		if !ok {
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(filename); err == nil {
+				return nil
+			}
+			if fetch == nil {
+				return fmt.Errorf("descriptor of %s is missing", filename)
+			}
+			fetched, err := fetch(filename)
+			if err != nil {
+				return fmt.Errorf("failed to fetch descriptor of %s: %w", filename, err)
+			}
+			for _, file := range fetched {
+				if _, known := protos[file.GetName()]; !known {
+					protos[file.GetName()] = file
+				}
+			}
+			if fileProto, ok = protos[filename]; !ok {
+				return fmt.Errorf("descriptor of %s is missing", filename)
+			}
+		}
+		for _, dependency := range fileProto.GetDependency() {
+			if err := register(dependency); err != nil {
+				return err
+			}
+		}
+		file, err := protodesc.NewFile(fileProto, resolver)
+		if err != nil {
+			return fmt.Errorf("invalid descriptor of %s: %w", filename, err)
+		}
+		return resolver.files.RegisterFile(file)
+	}
+
+	// Files are registered in a fixed order, so that errors do not vary
+	// between runs
+	names := make([]string, 0, len(protos))
+	for name := range protos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := register(name); err != nil {
+			return resolver, err
+		}
+	}
+	return resolver, nil
+}
+
+// loadDescriptorSet reads a FileDescriptorSet, as written by
+// protoc --descriptor_set_out or buf build, from uploaded content, an
+// artifact of the execution's account or base64 content. Files of the
+// server are not read.
+func loadDescriptorSet(params map[string]interface{}, env *toolEnvironment) (map[string]*descriptorpb.FileDescriptorProto, error) {
+	var data []byte
+	var err error
+	if content, ok := params["descriptor_set"].([]byte); ok {
+		data = content
+	} else if ref := params["descriptor_set"]; ref != nil && ref != "" {
+		if !isArtifactRef(ref) {
+			return nil, fmt.Errorf("descriptor_set must be uploaded content or an artifact reference, got %v", ref)
+		}
+		if _, data, err = env.readArtifact(ref); err != nil {
+			return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+		}
+	} else if encoded, ok := params["descriptor_set_base64"].(string); ok && encoded != "" {
+		if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("invalid descriptor_set_base64: %w", err)
+		}
+	} else {
+		return nil, nil
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	protos := make(map[string]*descriptorpb.FileDescriptorProto, len(set.GetFile()))
+	for _, file := range set.GetFile() {
+		protos[file.GetName()] = file
+	}
+	return protos, nil
+}
+
+// grpcReflection requests descriptors from the reflection service of a
+// server, with the v1 protocol or, for older servers, v1alpha
+type grpcReflection struct {
+	ctx     context.Context
+	conn    *grpc.ClientConn
+	v1      reflectionv1.ServerReflection_ServerReflectionInfoClient
+	v1alpha reflectionv1alpha.ServerReflection_ServerReflectionInfoClient
+	alpha   bool
+}
+
+// fileContainingSymbol returns the file defining a symbol and its
+// dependencies, as far as the server sends them
+func (r *grpcReflection) fileContainingSymbol(symbol string) ([]*descriptorpb.FileDescriptorProto, error) {
+	return r.request(
+		&reflectionv1.ServerReflectionRequest{MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol}},
+		&reflectionv1alpha.ServerReflectionRequest{MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol}},
+	)
+}
+
+// fileByFilename returns a file and its dependencies
+func (r *grpcReflection) fileByFilename(filename string) ([]*descriptorpb.FileDescriptorProto, error) {
+	return r.request(
+		&reflectionv1.ServerReflectionRequest{MessageRequest: &reflectionv1.ServerReflectionRequest_FileByFilename{FileByFilename: filename}},
+		&reflectionv1alpha.ServerReflectionRequest{MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileByFilename{FileByFilename: filename}},
+	)
+}
+
+func (r *grpcReflection) request(v1Request *reflectionv1.ServerReflectionRequest, v1alphaRequest *reflectionv1alpha.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+	if !r.alpha {
+		files, err := r.requestV1(v1Request)
+		if status.Code(err) != codes.Unimplemented {
+			return files, err
+		}
+		r.alpha = true
+	}
+	return r.requestV1Alpha(v1alphaRequest)
+}
+
+func (r *grpcReflection) requestV1(request *reflectionv1.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+	if r.v1 == nil {
+		stream, err := reflectionv1.NewServerReflectionClient(r.conn).ServerReflectionInfo(r.ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.v1 = stream
+	}
+	if err := r.v1.Send(request); err != nil {
+		return nil, err
+	}
+	response, err := r.v1.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errorResponse := response.GetErrorResponse(); errorResponse != nil {
+		return nil, status.Error(codes.Code(errorResponse.GetErrorCode()), errorResponse.GetErrorMessage())
+	}
+	return decodeFileDescriptors(response.GetFileDescriptorResponse().GetFileDescriptorProto())
+}
+
+func (r *grpcReflection) requestV1Alpha(request *reflectionv1alpha.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+	if r.v1alpha == nil {
+		stream, err := reflectionv1alpha.NewServerReflectionClient(r.conn).ServerReflectionInfo(r.ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.v1alpha = stream
+	}
+	if err := r.v1alpha.Send(request); err != nil {
+		return nil, err
+	}
+	response, err := r.v1alpha.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errorResponse := response.GetErrorResponse(); errorResponse != nil {
+		return nil, status.Error(codes.Code(errorResponse.GetErrorCode()), errorResponse.GetErrorMessage())
+	}
+	return decodeFileDescriptors(response.GetFileDescriptorResponse().GetFileDescriptorProto())
+}
+
+// decodeFileDescriptors decodes the serialized file descriptor protos of a
+// reflection response
+func decodeFileDescriptors(encoded [][]byte) ([]*descriptorpb.FileDescriptorProto, error) {
+	files := make([]*descriptorpb.FileDescriptorProto, 0, len(encoded))
+	for _, data := range encoded {
+		file := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("invalid file descriptor: %w", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// resolveGRPCMethod returns the descriptor of a method given as
+// "package.Service/Method", from the node's descriptor set or the server's
+// reflection service
+func resolveGRPCMethod(ctx context.Context, conn *grpc.ClientConn, params map[string]interface{}, env *toolEnvironment, method string) (protoreflect.MethodDescriptor, error) {
+	serviceName, methodName, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !ok {
+		// Also accept package.Service.Method
+		if i := strings.LastIndex(method, "."); i > 0 {
+			serviceName, methodName, ok = method[:i], method[i+1:], true
+		}
+	}
+	if !ok || serviceName == "" || methodName == "" {
+		return nil, fmt.Errorf("method must be given as package.Service/Method, got %q", method)
+	}
+
+	protos, err := loadDescriptorSet(params, env)
+	if err != nil {
+		return nil, err
+	}
+	var resolver grpcResolver
+	if protos != nil {
+		resolver, err = buildGRPCFiles(protos, nil)
+	} else {
+		reflection := &grpcReflection{ctx: ctx, conn: conn}
+		var files []*descriptorpb.FileDescriptorProto
+		if files, err = reflection.fileContainingSymbol(serviceName); err != nil {
+			return nil, fmt.Errorf("server reflection failed for %s: %w", serviceName, err)
+		}
+		protos = make(map[string]*descriptorpb.FileDescriptorProto, len(files))
+		for _, file := range files {
+			protos[file.GetName()] = file
+		}
+		resolver, err = buildGRPCFiles(protos, reflection.fileByFilename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := resolver.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", serviceName)
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", serviceName)
+	}
+	methodDescriptor := service.Methods().ByName(protoreflect.Name(methodName))
+	if methodDescriptor == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", methodName, serviceName)
+	}
+	return methodDescriptor, nil
+}
+
+// grpcOutgoingMetadata returns the request metadata of a grpc node: its
+// metadata param, its auth token and its credential secret's key
+func grpcOutgoingMetadata(params map[string]interface{}, env *toolEnvironment) (metadata.MD, error) {
+	md := metadata.MD{}
+	for key, value := range mapParam(params["metadata"]) {
+		md.Set(key, fmt.Sprintf("%v", value))
+	}
+
+	auth, err := requestAuth(params, env)
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := auth["token"].(string); ok && token != "" && len(md.Get("authorization")) == 0 {
+		md.Set("authorization", "Bearer "+token)
+	}
+
+	if secretKey, ok := params["credential"].(string); ok && secretKey != "" {
+		apiKey, err := loadCredential(secretKey, env)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range apiKey.Headers {
+			if len(md.Get(name)) == 0 {
+				md.Set(name, value)
+			}
+		}
+		headerName, value := credentialKeyHeader(apiKey)
+		if headerName == "" {
+			return nil, fmt.Errorf("credential %q sends its key as query param, which gRPC does not support", secretKey)
+		}
+		if len(md.Get(headerName)) == 0 {
+			md.Set(headerName, value)
+		}
+	}
+	return md, nil
+}
+
+// grpcTransportCredentials returns TLS credentials, or none when the node
+// sets plaintext
+func grpcTransportCredentials(params map[string]interface{}) credentials.TransportCredentials {
+	if plaintext, _ := params["plaintext"].(bool); plaintext {
+		return insecure.NewCredentials()
+	}
+	config := &tls.Config{}
+	config.ServerName, _ = params["server_name"].(string)
+	config.InsecureSkipVerify, _ = params["insecure_skip_verify"].(bool)
+	return credentials.NewTLS(config)
+}
+
+// grpcMessageJSON returns a message as JSON-mapped value
+func grpcMessageJSON(message proto.Message) (interface{}, error) {
+	data, err := grpcJSON.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// grpcMetadataMap returns metadata as a map of single values, joining
+// repeated keys with commas
+func grpcMetadataMap(md metadata.MD) map[string]interface{} {
+	values := make(map[string]interface{}, len(md))
+	for key, list := range md {
+		values[key] = strings.Join(list, ",")
+	}
+	return values
+}
+
+// NewGRPCNodeWrapper creates a new grpc node wrapper, calling unary and
+// server-streaming methods with JSON-mapped messages
+func NewGRPCNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
+	// Create the base node
+	baseNode := flowlib.NewNode(3, 1*time.Second)
+
+	// Create the wrapper
+	wrapper := &NodeWrapper{
+		node: baseNode,
+		exec: func(input interface{}) (interface{}, error) {
+			params, err := combinedParams(input)
+			if err != nil {
+				return nil, err
+			}
+
+			address, ok := params["address"].(string)
+			if !ok || address == "" {
+				return nil, fmt.Errorf("address parameter is required")
+			}
+			method, ok := params["method"].(string)
+			if !ok || method == "" {
+				return nil, fmt.Errorf("method parameter is required")
+			}
+			maxMessages := intParam(params["max_messages"], 0)
+
+			md, err := grpcOutgoingMetadata(params, toolEnvironmentFrom(input))
+			if err != nil {
+				return nil, err
+			}
+
+			// The call is bounded by the execution when running in a flow
+			parent := context.Background()
+			if env := toolEnvironmentFrom(input); env != nil && env.ctx != nil {
+				parent = env.ctx
+			}
+			ctx, cancel := context.WithTimeout(parent, durationParam(params["timeout"], defaultGRPCTimeout))
+			defer cancel()
+
+			conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(grpcTransportCredentials(params)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+			}
+			defer conn.Close()
+
+			methodDescriptor, err := resolveGRPCMethod(ctx, conn, params, toolEnvironmentFrom(input), method)
+			if err != nil {
+				return nil, err
+			}
+			if methodDescriptor.IsStreamingClient() {
+				return nil, fmt.Errorf("method %s streams requests, which is not supported", methodDescriptor.FullName())
+			}
+			fullMethod := fmt.Sprintf("/%s/%s", methodDescriptor.Parent().FullName(), methodDescriptor.Name())
+
+			// The message param is mapped to the request like protojson
+			request := dynamicpb.NewMessage(methodDescriptor.Input())
+			if message, ok := params["message"]; ok && message != nil {
+				data, err := json.Marshal(message)
+				if err != nil {
+					return nil, fmt.Errorf("invalid message: %w", err)
+				}
+				if err := protojson.Unmarshal(data, request); err != nil {
+					return nil, fmt.Errorf("message does not match %s: %w", methodDescriptor.Input().FullName(), err)
+				}
+			}
+
+			ctx = metadata.NewOutgoingContext(ctx, md)
+			start := time.Now()
+			result := map[string]interface{}{"method": fullMethod}
+
+			if !methodDescriptor.IsStreamingServer() {
+				response := dynamicpb.NewMessage(methodDescriptor.Output())
+				var header, trailer metadata.MD
+				if err := conn.Invoke(ctx, fullMethod, request, response, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+					return nil, grpcCallError(fullMethod, err)
+				}
+				value, err := grpcMessageJSON(response)
+				if err != nil {
+					return nil, err
+				}
+				result["response"] = value
+				result["headers"] = grpcMetadataMap(header)
+				result["trailers"] = grpcMetadataMap(trailer)
+				result["duration"] = time.Since(start).String()
+				return result, nil
+			}
+
+			// Server streams are read to their end, or up to max_messages
+			streamCtx, stopStream := context.WithCancel(ctx)
+			defer stopStream()
+			stream, err := conn.NewStream(streamCtx, &grpc.StreamDesc{ServerStreams: true}, fullMethod)
+			if err != nil {
+				return nil, grpcCallError(fullMethod, err)
+			}
+			if err := stream.SendMsg(request); err != nil {
+				return nil, grpcCallError(fullMethod, err)
+			}
+			if err := stream.CloseSend(); err != nil {
+				return nil, grpcCallError(fullMethod, err)
+			}
+
+			responses := []interface{}{}
+			for maxMessages <= 0 || len(responses) < maxMessages {
+				response := dynamicpb.NewMessage(methodDescriptor.Output())
+				err := stream.RecvMsg(response)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					return nil, grpcCallError(fullMethod, err)
+				}
+				value, err := grpcMessageJSON(response)
+				if err != nil {
+					return nil, err
+				}
+				responses = append(responses, value)
+			}
+			header, _ := stream.Header()
+			result["responses"] = responses
+			result["count"] = len(responses)
+			result["headers"] = grpcMetadataMap(header)
+			result["trailers"] = grpcMetadataMap(stream.Trailer())
+			result["duration"] = time.Since(start).String()
+			return result, nil
+		},
+	}
+
+	// Set the parameters
+	wrapper.SetParams(params)
+
+	return wrapper, nil
+}
+
+// grpcCallError describes a failed call with its gRPC status
+func grpcCallError(method string, err error) error {
+	if st, ok := status.FromError(err); ok {
+		return fmt.Errorf("grpc call %s failed: %s: %s", method, st.Code(), st.Message())
+	}
+	return fmt.Errorf("grpc call %s failed: %w", method, err)
+}
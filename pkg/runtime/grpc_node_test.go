@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// startGRPCServer serves the health service, with reflection when asked,
+// and returns its address and the metadata of the last call
+func startGRPCServer(t *testing.T, withReflection bool) (string, *metadata.MD) {
+	t.Helper()
+	var lastMetadata metadata.MD
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			lastMetadata, _ = metadata.FromIncomingContext(ctx)
+			return handler(ctx, req)
+		}),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	if withReflection {
+		reflection.Register(server)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), &lastMetadata
+}
+
+// execGRPC runs a grpc node with params
+func execGRPC(t *testing.T, params map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := NewGRPCNodeWrapper(params)
+	require.NoError(t, err)
+	result, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": params})
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]interface{}), nil
+}
+
+func TestGRPCNode_Reflection(t *testing.T) {
+	address, lastMetadata := startGRPCServer(t, true)
+
+	result, err := execGRPC(t, map[string]interface{}{
+		"address":   address,
+		"plaintext": true,
+		"method":    "grpc.health.v1.Health/Check",
+		"message":   map[string]interface{}{"service": "orders"},
+		"metadata":  map[string]interface{}{"x-request-id": "r-1"},
+		"auth":      map[string]interface{}{"token": "token-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/grpc.health.v1.Health/Check", result["method"])
+	assert.Equal(t, map[string]interface{}{"status": "SERVING"}, result["response"])
+	assert.Equal(t, []string{"r-1"}, lastMetadata.Get("x-request-id"))
+	assert.Equal(t, []string{"Bearer token-1"}, lastMetadata.Get("authorization"))
+
+	// Server streams are read up to max_messages
+	result, err = execGRPC(t, map[string]interface{}{
+		"address":      address,
+		"plaintext":    true,
+		"method":       "grpc.health.v1.Health.Watch",
+		"message":      map[string]interface{}{"service": "orders"},
+		"max_messages": 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"status": "SERVING"}}, result["responses"])
+	assert.Equal(t, 1, result["count"])
+
+	// Status errors fail the node
+	_, err = execGRPC(t, map[string]interface{}{
+		"address":   address,
+		"plaintext": true,
+		"method":    "grpc.health.v1.Health/Check",
+		"message":   map[string]interface{}{"service": "missing"},
+	})
+	assert.ErrorContains(t, err, "NotFound")
+
+	_, err = execGRPC(t, map[string]interface{}{
+		"address":   address,
+		"plaintext": true,
+		"method":    "grpc.health.v1.Health/Check",
+		"message":   map[string]interface{}{"unknown_field": true},
+	})
+	assert.ErrorContains(t, err, "message does not match grpc.health.v1.HealthCheckRequest")
+
+	_, err = execGRPC(t, map[string]interface{}{
+		"address":   address,
+		"plaintext": true,
+		"method":    "grpc.health.v1.Health/Probe",
+	})
+	assert.ErrorContains(t, err, "method Probe not found")
+}
+
+func TestGRPCNode_CanceledExecution(t *testing.T) {
+	address, _ := startGRPCServer(t, true)
+
+	// A call of a canceled execution fails instead of waiting for its timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	params := map[string]interface{}{
+		"address":   address,
+		"plaintext": true,
+		"method":    "grpc.health.v1.Health/Check",
+		"message":   map[string]interface{}{"service": "orders"},
+	}
+	node, err := NewGRPCNodeWrapper(params)
+	require.NoError(t, err)
+	_, err = node.(*NodeWrapper).exec(map[string]interface{}{
+		"params":           params,
+		toolEnvironmentKey: &toolEnvironment{ctx: ctx},
+	})
+	assert.ErrorContains(t, err, "Canceled")
+}
+
+func TestGRPCNode_DescriptorSet(t *testing.T) {
+	address, _ := startGRPCServer(t, false)
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	data, err := proto.Marshal(set)
+	require.NoError(t, err)
+
+	// Without reflection the server cannot describe itself
+	_, err = execGRPC(t, map[string]interface{}{
+		"address":   address,
+		"plaintext": true,
+		"method":    "grpc.health.v1.Health/Check",
+	})
+	assert.ErrorContains(t, err, "server reflection failed")
+
+	for _, source := range []map[string]interface{}{
+		{"descriptor_set": data},
+		{"descriptor_set_base64": base64.StdEncoding.EncodeToString(data)},
+	} {
+		params := map[string]interface{}{
+			"address":   address,
+			"plaintext": true,
+			"method":    "grpc.health.v1.Health/Check",
+			"message":   map[string]interface{}{"service": "orders"},
+		}
+		for key, value := range source {
+			params[key] = value
+		}
+		result, err := execGRPC(t, params)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"status": "SERVING"}, result["response"])
+	}
+
+	// Files of the server are not read
+	path := filepath.Join(t.TempDir(), "health.pb")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	_, err = execGRPC(t, map[string]interface{}{
+		"address":        address,
+		"plaintext":      true,
+		"method":         "grpc.health.v1.Health/Check",
+		"descriptor_set": path,
+	})
+	assert.ErrorContains(t, err, "descriptor_set must be uploaded content or an artifact reference")
+}
@@ -0,0 +1,51 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// testFlow is the definition of a flow run by the runtime tests
+type testFlow struct {
+	Metadata map[string]interface{} `yaml:"metadata"`
+	Nodes    map[string]testNode    `yaml:"nodes"`
+}
+
+// testNode is a node of a testFlow
+type testNode struct {
+	Type   string                 `yaml:"type"`
+	Params map[string]interface{} `yaml:"params,omitempty"`
+	Next   map[string]string      `yaml:"next,omitempty"`
+}
+
+// nodeFlow returns a flow of a single node "node" of the given type
+func nodeFlow(nodeType string, params map[string]interface{}) testFlow {
+	return testFlow{
+		Metadata: map[string]interface{}{"name": "flow"},
+		Nodes:    map[string]testNode{"node": {Type: nodeType, Params: params}},
+	}
+}
+
+// newCoreRuntime returns a runtime of the core node types running flows of
+// the test account by ID, with the secrets of vault when it is not nil
+func newCoreRuntime(t *testing.T, vault auth.SecretVault, flows map[string]testFlow) runtime.FlowRuntime {
+	t.Helper()
+	mockRegistry := new(IntegrationMockFlowRegistry)
+	for flowID, flow := range flows {
+		data, err := yaml.Marshal(flow)
+		require.NoError(t, err)
+		mockRegistry.On("GetFlow", "test-account", flowID).Return(&runtime.Flow{ID: flowID, YAML: string(data)}, nil)
+	}
+	nodeFactories := map[string]plugins.NodeFactory{}
+	for nodeType, factory := range runtime.CoreNodeTypes() {
+		nodeFactories[nodeType] = &replayNodeFactory{factory: factory}
+	}
+	yamlLoader := loader.NewYAMLLoader(nodeFactories, plugins.NewPluginRegistry())
+	return runtime.NewFlowRuntimeWithStoreAndSecrets(mockRegistry, yamlLoader, newReplayExecutionStore(), vault)
+}
@@ -0,0 +1,255 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+)
+
+// ErrCredentialRateLimited is returned for requests beyond the hourly or
+// daily rate limit of a credential
+var ErrCredentialRateLimited = errors.New("credential rate limit exceeded")
+
+// credentialLimiter enforces the rate limit of an API key secret of an
+// account. Limiters are shared by all executions in the process.
+type credentialLimiter struct {
+	mu sync.Mutex
+
+	// Token bucket of the per-second limit
+	tokens float64
+	filled time.Time
+
+	// Counters of the current UTC hour and day
+	hour      time.Time
+	hourCount int
+	day       time.Time
+	dayCount  int
+}
+
+var credentialLimiters sync.Map // accountID + "/" + key -> *credentialLimiter
+
+// maxCredentialWait bounds how long a request waits for the per-second
+// rate limit of a credential; requests that would wait longer fail
+const maxCredentialWait = 30 * time.Second
+
+// reserve takes a request from the limits and returns how long to wait
+// before sending it. Requests beyond the hourly or daily limit fail rather
+// than wait for the next window, as do requests that would wait longer than
+// maxCredentialWait for the per-second limit.
+func (l *credentialLimiter) reserve(limit auth.RateLimit, now time.Time) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if hour := now.UTC().Truncate(time.Hour); !hour.Equal(l.hour) {
+		l.hour, l.hourCount = hour, 0
+	}
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(l.day) {
+		l.day, l.dayCount = day, 0
+	}
+	if limit.RequestsPerHour > 0 && l.hourCount >= limit.RequestsPerHour {
+		return 0, fmt.Errorf("%w: %d requests per hour", ErrCredentialRateLimited, limit.RequestsPerHour)
+	}
+	if limit.RequestsPerDay > 0 && l.dayCount >= limit.RequestsPerDay {
+		return 0, fmt.Errorf("%w: %d requests per day", ErrCredentialRateLimited, limit.RequestsPerDay)
+	}
+
+	var wait time.Duration
+	if limit.RequestsPerSecond > 0 {
+		burst := float64(limit.BurstLimit)
+		if burst < 1 {
+			burst = float64(limit.RequestsPerSecond)
+		}
+		rate := float64(limit.RequestsPerSecond)
+		if l.filled.IsZero() {
+			l.tokens = burst
+		} else {
+			l.tokens += now.Sub(l.filled).Seconds() * rate
+			if l.tokens > burst {
+				l.tokens = burst
+			}
+		}
+		l.filled = now
+
+		// A request without a token waits for the next one; the bucket goes
+		// negative so that waiting requests queue up in order, down to the
+		// longest wait allowed
+		if l.tokens < 1 {
+			wait = time.Duration((1 - l.tokens) / rate * float64(time.Second))
+			if wait > maxCredentialWait {
+				return 0, fmt.Errorf("%w: %d requests per second", ErrCredentialRateLimited, limit.RequestsPerSecond)
+			}
+		}
+		l.tokens--
+	}
+	l.hourCount++
+	l.dayCount++
+	return wait, nil
+}
+
+// cancel returns a request reserved for the per-second limit that was not
+// sent
+func (l *credentialLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// oauthAccessToken returns a valid access token of an OAuth secret of the
+// running execution's account, refreshing it first when it is about to
+// expire
+func oauthAccessToken(key string, env *toolEnvironment) (string, error) {
+	if env == nil || env.runtime == nil || env.runtime.secretVault == nil || env.execCtx == nil {
+		return "", fmt.Errorf("oauth_secret %q requires a flow execution with a secret vault", key)
+	}
+	vault, ok := env.runtime.secretVault.(auth.ExtendedSecretVault)
+	if !ok {
+		return "", fmt.Errorf("oauth_secret %q requires a structured secret vault", key)
+	}
+	oauth, err := auth.ValidOAuthToken(context.Background(), vault, env.execCtx.accountID, key, time.Minute)
+	if err != nil {
+		return "", err
+	}
+	return oauth.AccessToken, nil
+}
+
+// requestAuth returns the auth param of a request node, with an
+// oauth_secret replaced by the secret's access token
+func requestAuth(params map[string]interface{}, env *toolEnvironment) (map[string]interface{}, error) {
+	auth := mapParam(params["auth"])
+	if secretKey, ok := auth["oauth_secret"].(string); ok && secretKey != "" {
+		token, err := oauthAccessToken(secretKey, env)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"token": token}, nil
+	}
+	return auth, nil
+}
+
+// loadCredential returns an API key secret of the running execution's
+// account, once its rate limit lets the request through
+func loadCredential(key string, env *toolEnvironment) (auth.APIKeySecret, error) {
+	var apiKey auth.APIKeySecret
+	if env == nil || env.runtime == nil || env.runtime.secretVault == nil || env.execCtx == nil {
+		return apiKey, fmt.Errorf("credential %q requires a flow execution with a secret vault", key)
+	}
+	vault, ok := env.runtime.secretVault.(auth.ExtendedSecretVault)
+	if !ok {
+		return apiKey, fmt.Errorf("credential %q requires a structured secret vault", key)
+	}
+	accountID := env.execCtx.accountID
+
+	secret, err := vault.GetStructured(accountID, key)
+	if err != nil {
+		return apiKey, fmt.Errorf("failed to load credential %q: %w", key, err)
+	}
+	if secret.Metadata.Type != auth.SecretTypeAPIKey {
+		return apiKey, fmt.Errorf("credential %q is not an API key secret", key)
+	}
+	if err := json.Unmarshal([]byte(secret.Value), &apiKey); err != nil {
+		return apiKey, fmt.Errorf("failed to parse credential %q: %w", key, err)
+	}
+	vault.MarkUsed(accountID, key)
+
+	if apiKey.RateLimit != nil {
+		stored, _ := credentialLimiters.LoadOrStore(accountID+"/"+key, &credentialLimiter{})
+		limiter := stored.(*credentialLimiter)
+		wait, err := limiter.reserve(*apiKey.RateLimit, time.Now())
+		if err != nil {
+			return apiKey, fmt.Errorf("credential %q: %w", key, err)
+		}
+		if wait > 0 {
+			ctx := env.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				limiter.cancel()
+				return apiKey, fmt.Errorf("credential %q: %w", key, ctx.Err())
+			}
+		}
+	}
+	return apiKey, nil
+}
+
+// credentialKeyHeader returns the header carrying the key of an API key
+// secret, with its prefix. Keys go in the named header, and by default in
+// the Authorization header as a bearer token; the name is empty when the
+// key only goes in a query param.
+func credentialKeyHeader(apiKey auth.APIKeySecret) (string, string) {
+	headerName, prefix := apiKey.HeaderName, apiKey.Prefix
+	if headerName == "" && apiKey.QueryParam == "" {
+		headerName = "Authorization"
+		if prefix == "" {
+			prefix = "Bearer "
+		}
+	}
+	return headerName, prefix + apiKey.Key
+}
+
+// applyCredential applies an API key secret of the running execution's
+// account to a request: its header or query param, with prefix, its extra
+// headers, and its base URL for relative URLs. Headers set by the node win.
+// A secret with a base URL is only applied to URLs on its origin. The
+// request is held back or failed according to the secret's rate limit.
+// The origin the request may be redirected to is returned with its URL.
+func applyCredential(key string, env *toolEnvironment, requestURL string, headers map[string]string) (string, string, error) {
+	apiKey, err := loadCredential(key, env)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Relative URLs are appended to the base URL, and absolute URLs must
+	// be on its origin
+	if apiKey.BaseURL != "" {
+		if !strings.Contains(requestURL, "://") {
+			requestURL = strings.TrimRight(apiKey.BaseURL, "/") + "/" + strings.TrimLeft(requestURL, "/")
+		}
+		baseOrigin, err := urlOrigin(apiKey.BaseURL)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base_url of credential %s: %w", key, err)
+		}
+		if origin, err := urlOrigin(requestURL); err != nil || origin != baseOrigin {
+			return "", "", fmt.Errorf("credential %s is only applied to %s, not %s", key, baseOrigin, requestURL)
+		}
+	}
+
+	for name, value := range apiKey.Headers {
+		if _, set := headers[name]; !set {
+			headers[name] = value
+		}
+	}
+
+	if headerName, value := credentialKeyHeader(apiKey); headerName != "" {
+		if _, set := headers[headerName]; !set {
+			headers[headerName] = value
+		}
+	}
+	if apiKey.QueryParam != "" {
+		parsed, err := url.Parse(requestURL)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid url %q: %w", requestURL, err)
+		}
+		query := parsed.Query()
+		query.Set(apiKey.QueryParam, apiKey.Key)
+		parsed.RawQuery = query.Encode()
+		requestURL = parsed.String()
+	}
+
+	redirectOrigin, err := urlOrigin(requestURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid url %q: %w", requestURL, err)
+	}
+	return requestURL, redirectOrigin, nil
+}
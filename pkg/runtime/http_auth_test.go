@@ -0,0 +1,272 @@
+package runtime_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+)
+
+// newHTTPAuthRuntime returns a runtime with a secret vault running an
+// http.request flow "call" with the given url and params
+func newHTTPAuthRuntime(t *testing.T, url string, params map[string]interface{}) (runtime.FlowRuntime, *services.ExtendedSecretVaultService) {
+	t.Helper()
+	params["url"] = url
+	return newNodeAuthRuntime(t, "http.request", params)
+}
+
+// newNodeAuthRuntime returns a runtime with a secret vault running a flow
+// "call" of a single node of the given type and params
+func newNodeAuthRuntime(t *testing.T, nodeType string, params map[string]interface{}) (runtime.FlowRuntime, *services.ExtendedSecretVaultService) {
+	t.Helper()
+	vault, err := services.NewExtendedSecretVaultService(storage.NewMemoryProvider().GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+	return newCoreRuntime(t, vault, map[string]testFlow{"call": nodeFlow(nodeType, params)}), vault
+}
+
+func TestHTTPRequest_OAuthSecretRefreshesExpiredToken(t *testing.T) {
+	var refreshes int
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh-1", r.PostForm.Get("refresh_token"))
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-2", "expires_in": 3600})
+	}))
+	defer tokenServer.Close()
+
+	var authorizations []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer apiServer.Close()
+
+	flowRuntime, vault := newHTTPAuthRuntime(t, apiServer.URL, map[string]interface{}{
+		"auth": map[string]interface{}{"oauth_secret": "github"},
+	})
+	expired := time.Now().Add(-time.Minute)
+	require.NoError(t, vault.SetOAuth("test-account", "github", auth.OAuthSecret{
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		TokenURL:     tokenServer.URL,
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		ExpiresAt:    &expired,
+	}, auth.SecretMetadata{}))
+
+	for i := 0; i < 2; i++ {
+		executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+		require.NoError(t, err)
+		status := waitForCompletion(t, flowRuntime, executionID)
+		require.Equal(t, "completed", status.Status, status.Error)
+	}
+
+	// The token is refreshed once and then reused
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, []string{"Bearer access-2", "Bearer access-2"}, authorizations)
+	oauth, _, err := auth.GetOAuth(vault, "test-account", "github")
+	require.NoError(t, err)
+	assert.Equal(t, "access-2", oauth.AccessToken)
+	assert.Equal(t, "refresh-1", oauth.RefreshToken)
+}
+
+func TestHTTPRequest_OAuthSecretNotAuthorized(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent without a token")
+	}))
+	defer apiServer.Close()
+
+	flowRuntime, vault := newHTTPAuthRuntime(t, apiServer.URL, map[string]interface{}{
+		"auth": map[string]interface{}{"oauth_secret": "github"},
+	})
+	require.NoError(t, vault.SetOAuth("test-account", "github", auth.OAuthSecret{
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+	}, auth.SecretMetadata{}))
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "not authorized")
+}
+
+func TestHTTPRequest_CredentialAppliesAPIKey(t *testing.T) {
+	var requests []*http.Request
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer apiServer.Close()
+
+	flowRuntime, vault := newHTTPAuthRuntime(t, "/users/42", map[string]interface{}{
+		"credential": "crm",
+		"headers":    map[string]interface{}{"X-Trace": "abc"},
+	})
+	require.NoError(t, vault.SetAPIKey("test-account", "crm", auth.APIKeySecret{
+		Key:        "key-1",
+		HeaderName: "X-API-Key",
+		Prefix:     "Token ",
+		Headers:    map[string]string{"X-Client": "flowrunner", "X-Trace": "from-secret"},
+		QueryParam: "api_key",
+		BaseURL:    apiServer.URL + "/v1/",
+	}, auth.SecretMetadata{}))
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/v1/users/42", requests[0].URL.Path)
+	assert.Equal(t, "key-1", requests[0].URL.Query().Get("api_key"))
+	assert.Equal(t, "Token key-1", requests[0].Header.Get("X-API-Key"))
+	assert.Equal(t, "flowrunner", requests[0].Header.Get("X-Client"))
+	assert.Equal(t, "abc", requests[0].Header.Get("X-Trace"))
+}
+
+func TestHTTPRequest_CredentialStaysOnBaseURLOrigin(t *testing.T) {
+	var leaked []string
+	otherServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = append(leaked, r.Header.Get("X-API-Key"))
+		w.Write([]byte(`ok`))
+	}))
+	defer otherServer.Close()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, otherServer.URL+"/collect", http.StatusFound)
+	}))
+	defer apiServer.Close()
+
+	run := func(url string) runtime.ExecutionStatus {
+		flowRuntime, vault := newHTTPAuthRuntime(t, url, map[string]interface{}{"credential": "crm"})
+		require.NoError(t, vault.SetAPIKey("test-account", "crm", auth.APIKeySecret{
+			Key:        "key-1",
+			HeaderName: "X-API-Key",
+			BaseURL:    apiServer.URL + "/v1/",
+		}, auth.SecretMetadata{}))
+		executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+		require.NoError(t, err)
+		return waitForCompletion(t, flowRuntime, executionID)
+	}
+
+	// Absolute URLs outside the base URL's origin are refused
+	status := run(otherServer.URL + "/users/42")
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "credential crm is only applied to "+apiServer.URL)
+
+	// So are redirects leaving it
+	status = run("/users/42")
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "redirect to "+otherServer.URL)
+	assert.Empty(t, leaked)
+}
+
+func TestHTTPRequest_CredentialDefaultsToBearer(t *testing.T) {
+	var authorization string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`ok`))
+	}))
+	defer apiServer.Close()
+
+	flowRuntime, vault := newHTTPAuthRuntime(t, apiServer.URL, map[string]interface{}{"credential": "plain"})
+	require.NoError(t, vault.SetAPIKey("test-account", "plain", auth.APIKeySecret{Key: "key-1"}, auth.SecretMetadata{}))
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, "Bearer key-1", authorization)
+}
+
+func TestHTTPRequest_CredentialRateLimit(t *testing.T) {
+	var sent int
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Write([]byte(`ok`))
+	}))
+	defer apiServer.Close()
+
+	run := func(flowRuntime runtime.FlowRuntime) runtime.ExecutionStatus {
+		executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+		require.NoError(t, err)
+		return waitForCompletion(t, flowRuntime, executionID)
+	}
+
+	// Requests beyond the per-second rate wait for their turn
+	flowRuntime, vault := newHTTPAuthRuntime(t, apiServer.URL, map[string]interface{}{"credential": "paced"})
+	require.NoError(t, vault.SetAPIKey("test-account", "paced", auth.APIKeySecret{
+		Key:       "key-1",
+		RateLimit: &auth.RateLimit{RequestsPerSecond: 10, BurstLimit: 1},
+	}, auth.SecretMetadata{}))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.Equal(t, "completed", run(flowRuntime).Status)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	// Requests beyond the daily limit fail, whatever the execution
+	flowRuntime, vault = newHTTPAuthRuntime(t, apiServer.URL, map[string]interface{}{"credential": "daily"})
+	require.NoError(t, vault.SetAPIKey("test-account", "daily", auth.APIKeySecret{
+		Key:       "key-1",
+		RateLimit: &auth.RateLimit{RequestsPerDay: 2},
+	}, auth.SecretMetadata{}))
+	sent = 0
+	require.Equal(t, "completed", run(flowRuntime).Status)
+	require.Equal(t, "completed", run(flowRuntime).Status)
+	status := run(flowRuntime)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "rate limit exceeded")
+	assert.Equal(t, 2, sent)
+}
+
+func TestGRPC_CredentialSetsMetadata(t *testing.T) {
+	var received metadata.MD
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		received, _ = metadata.FromIncomingContext(ctx)
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	flowRuntime, vault := newNodeAuthRuntime(t, "grpc", map[string]interface{}{
+		"address":    listener.Addr().String(),
+		"plaintext":  true,
+		"method":     "grpc.health.v1.Health/Check",
+		"credential": "orders",
+	})
+	require.NoError(t, vault.SetAPIKey("test-account", "orders", auth.APIKeySecret{
+		Key:        "key-1",
+		HeaderName: "X-API-Key",
+		Headers:    map[string]string{"X-Tenant": "acme"},
+	}, auth.SecretMetadata{}))
+
+	executionID, err := flowRuntime.Execute("test-account", "call", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, []string{"key-1"}, received.Get("x-api-key"))
+	assert.Equal(t, []string{"acme"}, received.Get("x-tenant"))
+}
@@ -0,0 +1,650 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// defaultHTTPMaxPages bounds the pages fetched by a paginated request when
+// the node sets no max_pages
+const defaultHTTPMaxPages = 100
+
+// httpPagination is the pagination strategy of an http.request node
+type httpPagination struct {
+	strategy  string
+	itemsPath string
+	maxPages  int
+
+	// cursor strategy
+	cursorPath  string
+	cursorParam string
+
+	// offset strategy
+	offsetParam string
+	limitParam  string
+	offset      int
+	limit       int
+
+	// page strategy
+	pageParam string
+	page      int
+}
+
+// parseHTTPPagination reads the pagination param of an http.request node;
+// it returns nil when the node does not paginate
+func parseHTTPPagination(value interface{}) (*httpPagination, error) {
+	params := mapParam(value)
+	if params == nil {
+		return nil, nil
+	}
+	p := &httpPagination{maxPages: intParam(params["max_pages"], defaultHTTPMaxPages)}
+	p.strategy, _ = params["strategy"].(string)
+	p.itemsPath, _ = params["items_path"].(string)
+	if p.maxPages < 1 {
+		return nil, fmt.Errorf("pagination max_pages must be at least 1")
+	}
+
+	switch p.strategy {
+	case "link":
+	case "cursor":
+		p.cursorPath, _ = params["cursor_path"].(string)
+		if p.cursorPath == "" {
+			return nil, fmt.Errorf("cursor pagination requires cursor_path")
+		}
+		p.cursorParam = stringParamOr(params["cursor_param"], "cursor")
+	case "offset":
+		p.offsetParam = stringParamOr(params["offset_param"], "offset")
+		p.limitParam = stringParamOr(params["limit_param"], "limit")
+		p.offset = intParam(params["offset"], 0)
+		p.limit = intParam(params["limit"], 0)
+	case "page":
+		p.pageParam = stringParamOr(params["page_param"], "page")
+		p.page = intParam(params["start_page"], 1)
+	default:
+		return nil, fmt.Errorf("unknown pagination strategy %q (expected link, cursor, offset or page)", p.strategy)
+	}
+	return p, nil
+}
+
+// stringParamOr returns a string param, or fallback when unset
+func stringParamOr(value interface{}, fallback string) string {
+	if s, ok := value.(string); ok && s != "" {
+		return s
+	}
+	return fallback
+}
+
+// paginationResult is the outcome of fetching the pages of a request
+type paginationResult struct {
+	response  *utils.HTTPResponse
+	items     []interface{}
+	pages     int
+	truncated bool
+}
+
+// fetch requests pages until the strategy finds no next page, a response
+// is not successful, or max_pages is reached. The items of all successful
+// pages are collected; the last response is returned for routing. Pages are
+// sent with the auth of the request, so they must stay on the origin of the
+// first page.
+func (p *httpPagination) fetch(requestURL string, send func(string) (*utils.HTTPResponse, error)) (*paginationResult, error) {
+	pageURL, err := p.firstURL(requestURL)
+	if err != nil {
+		return nil, err
+	}
+	origin, err := urlOrigin(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &paginationResult{items: []interface{}{}}
+	for {
+		resp, err := send(pageURL)
+		if err != nil {
+			return nil, err
+		}
+		result.response = resp
+		result.pages++
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return result, nil
+		}
+
+		data := httpResponseData(resp)
+		items, err := p.pageItems(data)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", result.pages, err)
+		}
+		result.items = append(result.items, items...)
+
+		next, err := p.nextURL(pageURL, resp, data, len(items))
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", result.pages, err)
+		}
+		if next == "" {
+			return result, nil
+		}
+		if nextOrigin, err := urlOrigin(next); err != nil || nextOrigin != origin {
+			return nil, fmt.Errorf("page %d: next page %q is not on %q", result.pages, next, origin)
+		}
+		if result.pages >= p.maxPages {
+			result.truncated = true
+			return result, nil
+		}
+		pageURL = next
+	}
+}
+
+// firstURL returns the URL of the first page
+func (p *httpPagination) firstURL(requestURL string) (string, error) {
+	switch p.strategy {
+	case "offset":
+		values := map[string]string{p.offsetParam: strconv.Itoa(p.offset)}
+		if p.limit > 0 {
+			values[p.limitParam] = strconv.Itoa(p.limit)
+		}
+		return setQueryParams(requestURL, values)
+	case "page":
+		return setQueryParams(requestURL, map[string]string{p.pageParam: strconv.Itoa(p.page)})
+	}
+	return requestURL, nil
+}
+
+// pageItems returns the items of a page: the value at items_path, or the
+// body itself when it is an array
+func (p *httpPagination) pageItems(data interface{}) ([]interface{}, error) {
+	if p.itemsPath != "" {
+		value, err := evaluateResponsePath(data, p.itemsPath)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, nil
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("items_path %q is not an array", p.itemsPath)
+		}
+		return items, nil
+	}
+	if items, ok := data.([]interface{}); ok {
+		return items, nil
+	}
+	return nil, fmt.Errorf("pagination requires items_path when the response body is not an array")
+}
+
+// nextURL returns the URL of the page after pageURL, or "" on the last page
+func (p *httpPagination) nextURL(pageURL string, resp *utils.HTTPResponse, data interface{}, count int) (string, error) {
+	switch p.strategy {
+	case "link":
+		for _, header := range resp.Headers["Link"] {
+			if next := linkRelNext(header); next != "" {
+				base, err := url.Parse(pageURL)
+				if err != nil {
+					return "", err
+				}
+				ref, err := url.Parse(next)
+				if err != nil {
+					return "", fmt.Errorf("invalid next link %q: %w", next, err)
+				}
+				return base.ResolveReference(ref).String(), nil
+			}
+		}
+		return "", nil
+	case "cursor":
+		cursor, err := evaluateResponsePath(data, p.cursorPath)
+		if err != nil {
+			return "", err
+		}
+		if cursor == nil || cursor == "" || cursor == false {
+			return "", nil
+		}
+		return setQueryParams(pageURL, map[string]string{p.cursorParam: fmt.Sprint(cursor)})
+	case "offset":
+		if count == 0 || (p.limit > 0 && count < p.limit) {
+			return "", nil
+		}
+		p.offset += count
+		return setQueryParams(pageURL, map[string]string{p.offsetParam: strconv.Itoa(p.offset)})
+	case "page":
+		if count == 0 {
+			return "", nil
+		}
+		p.page++
+		return setQueryParams(pageURL, map[string]string{p.pageParam: strconv.Itoa(p.page)})
+	}
+	return "", nil
+}
+
+// linkRelNext returns the target of the rel="next" link of a Link header
+func linkRelNext(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, attr := range parts[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(attr), "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "next") {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// urlOrigin returns the scheme and host of a URL, which are empty for a
+// relative URL
+func urlOrigin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host), nil
+}
+
+// setQueryParams returns rawURL with the given query params set
+func setQueryParams(rawURL string, values map[string]string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	query := parsed.Query()
+	for name, value := range values {
+		query.Set(name, value)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// httpResponseData returns the decoded body of a response. Bodies the
+// client left as text are decoded when they hold JSON, so that APIs using
+// vendor content types such as application/hal+json can be navigated.
+func httpResponseData(resp *utils.HTTPResponse) interface{} {
+	text, ok := resp.Body.(string)
+	if !ok {
+		return resp.Body
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(text), &data); err == nil {
+		return data
+	}
+	return text
+}
+
+// extractResponseFields evaluates the named expressions of the extract
+// param against a response body
+func extractResponseFields(data interface{}, expressions map[string]interface{}) (map[string]interface{}, error) {
+	extracted := make(map[string]interface{}, len(expressions))
+	for name, value := range expressions {
+		expr, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("extract %q must be a string expression", name)
+		}
+		result, err := evaluateResponsePath(data, expr)
+		if err != nil {
+			return nil, fmt.Errorf("extract %q: %w", name, err)
+		}
+		extracted[name] = result
+	}
+	return extracted, nil
+}
+
+// evaluateResponsePath evaluates a JSONPath expression (starting with $)
+// or otherwise a JMESPath expression against a response body
+func evaluateResponsePath(data interface{}, expr string) (interface{}, error) {
+	if strings.HasPrefix(expr, "$") {
+		return evaluateJSONPath(data, expr)
+	}
+	result, err := jmespath.Search(expr, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JMESPath expression %q: %w", expr, err)
+	}
+	return result, nil
+}
+
+// jsonPathStep is a step of a JSONPath expression
+type jsonPathStep struct {
+	key       string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// evaluateJSONPath evaluates the JSONPath subset of child names ($.a,
+// $['a']), array indexes ($[0], $[-1]), wildcards ($.*, $[*]) and
+// recursive descent ($..a). Paths with a wildcard or recursive descent
+// return the list of matches; others return the single value, or nil.
+func evaluateJSONPath(data interface{}, expr string) (interface{}, error) {
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []interface{}{data}
+	multiple := false
+	for _, step := range steps {
+		multiple = multiple || step.wildcard || step.recursive
+		var next []interface{}
+		for _, node := range nodes {
+			if step.recursive {
+				for _, descendant := range jsonPathDescendants(node) {
+					next = append(next, step.children(descendant)...)
+				}
+			} else {
+				next = append(next, step.children(node)...)
+			}
+		}
+		nodes = next
+	}
+
+	if multiple {
+		if nodes == nil {
+			return []interface{}{}, nil
+		}
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	return nodes[0], nil
+}
+
+// parseJSONPath splits a JSONPath expression into steps
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid JSONPath expression %q: %s", expr, reason)
+	}
+	if !strings.HasPrefix(expr, "$") {
+		return nil, invalid("must start with $")
+	}
+
+	var steps []jsonPathStep
+	rest := expr[1:]
+	for rest != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, invalid("empty name")
+			}
+			if name == "*" {
+				step.wildcard = true
+			} else {
+				step.key = name
+			}
+			rest = rest[end:]
+			steps = append(steps, step)
+			continue
+		case strings.HasPrefix(rest, "["):
+		default:
+			return nil, invalid(fmt.Sprintf("unexpected %q", rest))
+		}
+
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, invalid("unclosed [")
+		}
+		selector := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case selector == "*":
+			step.wildcard = true
+		case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+			step.key = selector[1 : len(selector)-1]
+		default:
+			index, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, invalid(fmt.Sprintf("unsupported selector [%s]", selector))
+			}
+			step.index, step.isIndex = index, true
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// children returns the values a step selects from a node
+func (s jsonPathStep) children(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			values := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				values = append(values, v[key])
+			}
+			return values
+		}
+		if value, ok := v[s.key]; ok && !s.isIndex {
+			return []interface{}{value}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return append([]interface{}{}, v...)
+		}
+		if s.isIndex {
+			index := s.index
+			if index < 0 {
+				index += len(v)
+			}
+			if index >= 0 && index < len(v) {
+				return []interface{}{v[index]}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonPathDescendants returns a node and all values nested in it
+func jsonPathDescendants(node interface{}) []interface{} {
+	nodes := []interface{}{node}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			nodes = append(nodes, jsonPathDescendants(v[key])...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			nodes = append(nodes, jsonPathDescendants(item)...)
+		}
+	}
+	return nodes
+}
+
+// httpDownload is the download param of an http.request node: a path in
+// the download directory of the account, or an artifact of the execution
+type httpDownload struct {
+	path string
+
+	// target is the file path resolves to, set by file
+	target string
+
+	// artifact stores the body as an artifact named name
+	artifact bool
+	name     string
+}
+
+// parseHTTPDownload reads the download param of an http.request node, given
+// as a path, as {path: ...} or as {artifact: true | name}
+func parseHTTPDownload(value interface{}) (*httpDownload, error) {
+	if path, ok := value.(string); ok && path != "" {
+		return newHTTPPathDownload(path)
+	}
+	params := mapParam(value)
+	switch artifact := params["artifact"].(type) {
+	case bool:
+		if artifact {
+			return &httpDownload{artifact: true}, nil
+		}
+	case string:
+		if artifact != "" {
+			return &httpDownload{artifact: true, name: artifact}, nil
+		}
+	}
+	if path, ok := params["path"].(string); ok && path != "" {
+		return newHTTPPathDownload(path)
+	}
+	return nil, fmt.Errorf("download requires a path or artifact")
+}
+
+// newHTTPPathDownload returns the download to a path, which must be relative
+// and stay within the download directory
+func newHTTPPathDownload(path string) (*httpDownload, error) {
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("download path %q must be relative and within the download directory", path)
+	}
+	return &httpDownload{path: filepath.Clean(path)}, nil
+}
+
+// file creates the file receiving the response body; it is renamed to the
+// path, or removed once stored as an artifact, by finish
+func (d *httpDownload) file(env *toolEnvironment) (*os.File, error) {
+	if d.artifact {
+		file, err := os.CreateTemp("", "flowrunner-download-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create download file: %w", err)
+		}
+		return file, nil
+	}
+	dir := env.downloadDir()
+	if dir == "" {
+		return nil, fmt.Errorf("download directory is not configured")
+	}
+	d.target = filepath.Join(dir, d.path)
+	return createHTTPDownload(d.target)
+}
+
+// finish moves a complete download to its path, or stores it as an
+// artifact of the execution and returns its reference
+func (d *httpDownload) finish(file string, requestURL, contentType string, env *toolEnvironment) (map[string]interface{}, error) {
+	if !d.artifact {
+		return map[string]interface{}{"path": d.path}, os.Rename(file, d.target)
+	}
+	defer os.Remove(file)
+
+	name := d.name
+	if name == "" {
+		if parsed, err := url.Parse(requestURL); err == nil {
+			name = path.Base(parsed.Path)
+		}
+		if name == "/" || name == "." {
+			name = ""
+		}
+	}
+	content, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download file: %w", err)
+	}
+	defer content.Close()
+	artifact, err := env.createArtifact(name, contentType, content)
+	if err != nil {
+		return nil, err
+	}
+	return artifact.Ref(), nil
+}
+
+// createHTTPDownload creates a temporary file next to path receiving a
+// response body; it is renamed to path once the body is complete
+func createHTTPDownload(path string) (*os.File, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	return file, nil
+}
+
+// SetDownloadDir sets the directory http.request nodes download files to.
+// Each account downloads to its own subdirectory; without a directory,
+// downloads are only kept as artifacts.
+func (r *flowRuntime) SetDownloadDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downloadDir = dir
+}
+
+// downloadDir returns the download directory of the execution's account, or
+// "" when the runtime has none
+func (env *toolEnvironment) downloadDir() string {
+	if env == nil || env.runtime == nil || env.execCtx == nil || env.execCtx.accountID == "" {
+		return ""
+	}
+	env.runtime.mu.RLock()
+	defer env.runtime.mu.RUnlock()
+	if env.runtime.downloadDir == "" || !filepath.IsLocal(env.execCtx.accountID) {
+		return ""
+	}
+	return filepath.Join(env.runtime.downloadDir, env.execCtx.accountID)
+}
+
+// httpStatusAction returns the action routing a response: the most
+// specific of the status code ("429"), its class ("4xx"), the named
+// outcome ("success", "client_error", "server_error") and "default" that
+// the node has a successor for. Without any, the named outcome is returned.
+func httpStatusAction(statusCode int, successors map[flowlib.Action]flowlib.Node) flowlib.Action {
+	outcome := flowlib.DefaultAction
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		outcome = "success"
+	case statusCode >= 400 && statusCode < 500:
+		outcome = "client_error"
+	case statusCode >= 500:
+		outcome = "server_error"
+	}
+
+	candidates := []flowlib.Action{
+		flowlib.Action(strconv.Itoa(statusCode)),
+		flowlib.Action(fmt.Sprintf("%dxx", statusCode/100)),
+		outcome,
+		flowlib.DefaultAction,
+	}
+	for _, action := range candidates {
+		if _, ok := successors[action]; ok {
+			return action
+		}
+	}
+	return outcome
+}
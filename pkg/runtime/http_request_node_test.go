@@ -2,11 +2,19 @@ package runtime
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/auth"
 )
 
 func TestEnhancedHTTPRequestNode(t *testing.T) {
@@ -235,3 +243,283 @@ func TestEnhancedHTTPRequestNode(t *testing.T) {
 		assert.Equal(t, "client_error", action)
 	})
 }
+
+// execHTTPRequest runs an http.request node with params and returns its
+// result
+func execHTTPRequest(t *testing.T, params map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	node, err := NewHTTPRequestNodeWrapper(params)
+	require.NoError(t, err)
+	result, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": params})
+	require.NoError(t, err)
+	return result.(map[string]interface{})
+}
+
+func TestHTTPRequestNode_Pagination(t *testing.T) {
+	records := make([]interface{}, 7)
+	for i := range records {
+		records[i] = map[string]interface{}{"id": float64(i + 1)}
+	}
+	// page returns the records of a 0-based position with a page size of 3
+	page := func(start int) []interface{} {
+		if start >= len(records) {
+			return []interface{}{}
+		}
+		return records[start:min(start+3, len(records))]
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/link":
+			start, _ := strconv.Atoi(query.Get("start"))
+			if start+3 < len(records) {
+				w.Header().Set("Link", fmt.Sprintf(`</first>; rel="first", </link?start=%d>; rel="next"`, start+3))
+			}
+			json.NewEncoder(w).Encode(page(start))
+		case "/elsewhere":
+			w.Header().Set("Link", `<https://collector.example.com/steal>; rel="next"`)
+			json.NewEncoder(w).Encode(page(0))
+		case "/cursor":
+			start, _ := strconv.Atoi(query.Get("after"))
+			next := ""
+			if start+3 < len(records) {
+				next = strconv.Itoa(start + 3)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": page(start), "meta": map[string]interface{}{"next": next}})
+		case "/offset":
+			offset, _ := strconv.Atoi(query.Get("skip"))
+			assert.Equal(t, "3", query.Get("take"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": page(offset)})
+		case "/page":
+			number, _ := strconv.Atoi(query.Get("page"))
+			json.NewEncoder(w).Encode(page((number - 1) * 3))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		pagination map[string]interface{}
+		requests   int
+	}{
+		{"link", "/link", map[string]interface{}{"strategy": "link"}, 3},
+		{"cursor", "/cursor", map[string]interface{}{"strategy": "cursor", "items_path": "data", "cursor_path": "$.meta.next", "cursor_param": "after"}, 3},
+		{"offset", "/offset", map[string]interface{}{"strategy": "offset", "items_path": "results", "offset_param": "skip", "limit_param": "take", "limit": 3}, 3},
+		{"page", "/page", map[string]interface{}{"strategy": "page"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			result := execHTTPRequest(t, map[string]interface{}{
+				"url":        server.URL + tt.path,
+				"pagination": tt.pagination,
+			})
+			assert.Equal(t, records, result["items"])
+			assert.Equal(t, tt.requests, result["pages"])
+			assert.Equal(t, false, result["truncated"])
+			assert.Equal(t, tt.requests, requests)
+		})
+	}
+
+	// max_pages stops the requests and flags the result as truncated
+	requests = 0
+	result := execHTTPRequest(t, map[string]interface{}{
+		"url":        server.URL + "/page",
+		"pagination": map[string]interface{}{"strategy": "page", "max_pages": 2},
+	})
+	assert.Len(t, result["items"], 6)
+	assert.Equal(t, 2, result["pages"])
+	assert.Equal(t, true, result["truncated"])
+	assert.Equal(t, 2, requests)
+
+	node, _ := NewHTTPRequestNodeWrapper(map[string]interface{}{})
+	_, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": map[string]interface{}{
+		"url":        server.URL + "/page",
+		"pagination": map[string]interface{}{"strategy": "scroll"},
+	}})
+	assert.ErrorContains(t, err, "unknown pagination strategy")
+
+	// Next links to another origin are not followed with the request's auth
+	requests = 0
+	_, err = node.(*NodeWrapper).exec(map[string]interface{}{"params": map[string]interface{}{
+		"url":        server.URL + "/elsewhere",
+		"headers":    map[string]interface{}{"Authorization": "Bearer token-1"},
+		"pagination": map[string]interface{}{"strategy": "link"},
+	}})
+	assert.ErrorContains(t, err, `next page "https://collector.example.com/steal" is not on`)
+	assert.Equal(t, 1, requests)
+}
+
+func TestHTTPRequestNode_Download(t *testing.T) {
+	content := make([]byte, 1<<20)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("no such file"))
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	// Paths are relative to the account's subdirectory of the download
+	// directory
+	dir := t.TempDir()
+	r := &flowRuntime{}
+	r.SetDownloadDir(dir)
+	env := &toolEnvironment{runtime: r, execCtx: &executionContext{accountID: "test-account"}}
+	download := func(params map[string]interface{}) (map[string]interface{}, error) {
+		node, err := NewHTTPRequestNodeWrapper(params)
+		require.NoError(t, err)
+		result, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": params, toolEnvironmentKey: env})
+		if err != nil {
+			return nil, err
+		}
+		return result.(map[string]interface{}), nil
+	}
+
+	result, err := download(map[string]interface{}{
+		"url":      server.URL + "/data",
+		"download": map[string]interface{}{"path": "exports/data.bin"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, result["status_code"])
+	assert.Nil(t, result["body"])
+	assert.Equal(t, map[string]interface{}{"path": filepath.Join("exports", "data.bin"), "bytes": int64(len(content))}, result["download"])
+	written, err := os.ReadFile(filepath.Join(dir, "test-account", "exports", "data.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, content, written)
+
+	// Unsuccessful responses are kept in memory and leave no file behind
+	result, err = download(map[string]interface{}{
+		"url":      server.URL + "/missing",
+		"download": "missing.bin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 404, result["status_code"])
+	assert.Equal(t, "no such file", result["body"])
+	assert.NotContains(t, result, "download")
+	entries, err := os.ReadDir(filepath.Join(dir, "test-account"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Paths cannot leave the download directory
+	for _, path := range []string{filepath.Join(dir, "data.bin"), "../other-account/data.bin", "exports/../../data.bin"} {
+		_, err = download(map[string]interface{}{"url": server.URL + "/data", "download": path})
+		assert.ErrorContains(t, err, "must be relative and within the download directory", path)
+	}
+
+	// Path downloads require a download directory
+	r.SetDownloadDir("")
+	_, err = download(map[string]interface{}{"url": server.URL + "/data", "download": "data.bin"})
+	assert.ErrorContains(t, err, "download directory is not configured")
+}
+
+func TestHTTPRequestNode_Extract(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A vendor JSON content type is left as text by the client
+		w.Header().Set("Content-Type", "application/hal+json")
+		w.Write([]byte(`{"order": {"id": "o-1", "lines": [{"sku": "a", "qty": 2}, {"sku": "b", "qty": 5}]}}`))
+	}))
+	defer server.Close()
+
+	result := execHTTPRequest(t, map[string]interface{}{
+		"url": server.URL,
+		"extract": map[string]interface{}{
+			"order_id":  "$.order.id",
+			"first_sku": "$['order'].lines[0].sku",
+			"last_qty":  "$.order.lines[-1].qty",
+			"skus":      "$..sku",
+			"large":     "order.lines[?qty > `3`].sku",
+			"missing":   "$.order.customer",
+		},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"order_id":  "o-1",
+		"first_sku": "a",
+		"last_qty":  float64(5),
+		"skus":      []interface{}{"a", "b"},
+		"large":     []interface{}{"b"},
+		"missing":   nil,
+	}, result["extracted"])
+
+	node, _ := NewHTTPRequestNodeWrapper(map[string]interface{}{})
+	_, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": map[string]interface{}{
+		"url":     server.URL,
+		"extract": map[string]interface{}{"bad": "$.order[?(@.id)]"},
+	}})
+	assert.ErrorContains(t, err, "invalid JSONPath expression")
+}
+
+func TestHTTPRequestNode_StatusRouting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	route := func(status int, actions ...flowlib.Action) flowlib.Action {
+		node, err := NewHTTPRequestNodeWrapper(map[string]interface{}{})
+		require.NoError(t, err)
+		for _, action := range actions {
+			node.Next(action, flowlib.NewNode(1, time.Millisecond))
+		}
+		result, err := node.(*NodeWrapper).exec(map[string]interface{}{"params": map[string]interface{}{
+			"url": fmt.Sprintf("%s?status=%d", server.URL, status),
+		}})
+		require.NoError(t, err)
+		action, err := node.(*NodeWrapper).post(nil, nil, result)
+		require.NoError(t, err)
+		return action
+	}
+
+	// The most specific connected action wins
+	assert.Equal(t, flowlib.Action("429"), route(429, "429", "4xx", "client_error", "default"))
+	assert.Equal(t, flowlib.Action("4xx"), route(404, "429", "4xx", "client_error", "default"))
+	assert.Equal(t, flowlib.Action("5xx"), route(503, "2xx", "5xx"))
+	assert.Equal(t, flowlib.Action("2xx"), route(201, "2xx", "success"))
+	assert.Equal(t, flowlib.Action("success"), route(200, "success", "default"))
+	assert.Equal(t, flowlib.Action("default"), route(200, "default"))
+	assert.Equal(t, flowlib.Action("default"), route(429, "5xx", "default"))
+
+	// Without a connected action the named outcome is returned
+	assert.Equal(t, flowlib.Action("server_error"), route(502))
+	assert.Equal(t, flowlib.Action("default"), route(304))
+}
+
+func TestCredentialLimiter_BoundsWait(t *testing.T) {
+	limiter := &credentialLimiter{}
+	limit := auth.RateLimit{RequestsPerSecond: 1, BurstLimit: 1}
+	now := time.Now()
+
+	// Requests queue up to the longest wait allowed, then fail without
+	// taking a token
+	var last time.Duration
+	for {
+		wait, err := limiter.reserve(limit, now)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrCredentialRateLimited)
+			break
+		}
+		last = wait
+	}
+	assert.Equal(t, maxCredentialWait, last)
+	tokens := limiter.tokens
+	_, err := limiter.reserve(limit, now)
+	assert.ErrorIs(t, err, ErrCredentialRateLimited)
+	assert.Equal(t, tokens, limiter.tokens)
+
+	// A canceled request gives its token back
+	limiter.cancel()
+	wait, err := limiter.reserve(limit, now)
+	require.NoError(t, err)
+	assert.Equal(t, maxCredentialWait, wait)
+}
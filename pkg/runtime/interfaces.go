@@ -2,7 +2,10 @@
 package runtime
 
 import (
+	"io"
 	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/loader"
 )
 
 // FlowRuntime executes flows
@@ -26,15 +29,177 @@ type FlowRuntime interface {
 	ListExecutions(accountID string) ([]ExecutionStatus, error)
 }
 
+// ExecuteOptions controls how a flow execution starts
+type ExecuteOptions struct {
+	// Entrypoint names one of the flow's entrypoints to start at instead of
+	// its default start node
+	Entrypoint string `json:"entrypoint,omitempty"`
+}
+
+// RerunOptions controls how a previous execution is re-run
+type RerunOptions struct {
+	// UseLatestVersion runs the latest flow version instead of the version
+	// the original execution used
+	UseLatestVersion bool `json:"use_latest_version,omitempty"`
+
+	// FromNode replays the execution from this node, restoring the shared
+	// context checkpointed before the node originally ran
+	FromNode string `json:"from_node,omitempty"`
+}
+
+// EntrypointFlowRuntime is implemented by runtimes that start flows at
+// named entry points
+type EntrypointFlowRuntime interface {
+	FlowRuntime
+
+	// ExecuteWithOptions runs a flow with the given input, starting at a named entry point
+	ExecuteWithOptions(accountID string, flowID string, input map[string]interface{}, options ExecuteOptions) (string, error)
+}
+
+// RerunFlowRuntime is implemented by runtimes that re-run previous
+// executions from their stored input
+type RerunFlowRuntime interface {
+	FlowRuntime
+
+	// Rerun starts a new execution from the stored input of a previous one
+	Rerun(accountID string, executionID string, options RerunOptions) (string, error)
+}
+
+// LLMPricedFlowRuntime is implemented by runtimes that cost the LLM usage
+// of executions
+type LLMPricedFlowRuntime interface {
+	FlowRuntime
+
+	// SetLLMPrices sets the prices LLM usage is costed with
+	SetLLMPrices(prices LLMPriceTable)
+}
+
+// QuotaFlowRuntime is implemented by runtimes that enforce account quotas
+type QuotaFlowRuntime interface {
+	FlowRuntime
+
+	// SetQuotaSource sets where account quotas are read from
+	SetQuotaSource(source QuotaSource)
+
+	// QuotaUsage returns the usage of an account counted against its quota
+	QuotaUsage(accountID string) QuotaUsage
+}
+
+// ConversationFlowRuntime is implemented by runtimes that keep the
+// conversation memory of llm and agent nodes
+type ConversationFlowRuntime interface {
+	FlowRuntime
+
+	// SetConversationStore sets where conversation memory is kept
+	SetConversationStore(store ConversationStore)
+
+	// GetConversation returns the conversation of a session
+	GetConversation(accountID, sessionID string) (Conversation, error)
+
+	// ListConversations returns the conversations of an account
+	ListConversations(accountID string) ([]Conversation, error)
+
+	// DeleteConversation forgets the conversation of a session
+	DeleteConversation(accountID, sessionID string) error
+}
+
+// PromptFlowRuntime is implemented by runtimes that keep a library of
+// versioned prompt templates, referenced by llm nodes with template_ref
+type PromptFlowRuntime interface {
+	FlowRuntime
+
+	// SetPromptStore sets where prompt templates are kept
+	SetPromptStore(store PromptStore)
+
+	// CreatePrompt stores a new version of a prompt
+	CreatePrompt(accountID string, prompt Prompt) (Prompt, error)
+
+	// GetPrompt returns the version of a prompt a reference selects
+	GetPrompt(accountID, ref string) (Prompt, error)
+
+	// ListPrompts returns the latest version of each prompt of an account
+	ListPrompts(accountID string) ([]Prompt, error)
+
+	// ListPromptVersions returns the versions of a prompt
+	ListPromptVersions(accountID, name string) ([]Prompt, error)
+
+	// TagPrompt puts a tag on a version of a prompt
+	TagPrompt(accountID, name string, version int, tag string) (Prompt, error)
+
+	// DeletePrompt removes all versions of a prompt
+	DeletePrompt(accountID, name string) error
+}
+
+// LLMCachedFlowRuntime is implemented by runtimes that cache the responses
+// of LLM requests
+type LLMCachedFlowRuntime interface {
+	FlowRuntime
+
+	// SetLLMCache sets where LLM responses are cached and how
+	SetLLMCache(store LLMCacheStore, options LLMCacheOptions)
+}
+
+// ArtifactFlowRuntime is implemented by runtimes that keep the files
+// produced and consumed by executions as artifacts
+type ArtifactFlowRuntime interface {
+	FlowRuntime
+
+	// SetArtifactStore sets where artifacts are kept
+	SetArtifactStore(store ArtifactStore)
+
+	// ListArtifacts returns the artifacts of an execution of an account
+	ListArtifacts(accountID, executionID string) ([]Artifact, error)
+
+	// OpenArtifact returns an artifact of an account and opens its content
+	OpenArtifact(accountID, executionID, artifactID string) (Artifact, io.ReadCloser, error)
+}
+
+// DownloadFlowRuntime is implemented by runtimes that let http.request
+// nodes download files to a directory of the server
+type DownloadFlowRuntime interface {
+	FlowRuntime
+
+	// SetDownloadDir sets the directory files are downloaded to
+	SetDownloadDir(dir string)
+}
+
+// CheckpointFlowRuntime is implemented by runtimes that checkpoint the
+// shared context of executions so that they can be replayed
+type CheckpointFlowRuntime interface {
+	FlowRuntime
+
+	// SetCheckpointStore sets where checkpoints are kept and the key sealing
+	// them
+	SetCheckpointStore(store CheckpointStore, key []byte) error
+}
+
 // FlowRegistry is an interface for retrieving flow definitions
 type FlowRegistry interface {
 	GetFlow(accountID, flowID string) (*Flow, error)
 }
 
+// VersionedFlowRegistry is implemented by registries that can retrieve specific flow versions
+type VersionedFlowRegistry interface {
+	FlowRegistry
+
+	// GetFlowVersion retrieves a specific version of a flow definition
+	GetFlowVersion(accountID, flowID, version string) (*Flow, error)
+}
+
+// ImportResolvingFlowRegistry is implemented by registries that resolve the
+// imports of a flow themselves, e.g. by flow name as well as ID
+type ImportResolvingFlowRegistry interface {
+	FlowRegistry
+
+	// ImportResolver returns the resolver for imports in flows of an account
+	ImportResolver(accountID string) loader.ImportResolver
+}
+
 // Flow represents a flow definition
 type Flow struct {
-	ID   string
-	YAML string
+	ID      string
+	YAML    string
+	Version string
 }
 
 // ExecutionStatus represents the current state of a flow execution
@@ -46,7 +211,7 @@ type ExecutionStatus struct {
 	FlowID string `json:"flow_id"`
 
 	// Status of the execution
-	Status string `json:"status"` // "running", "completed", "failed", "canceled"
+	Status string `json:"status"` // "queued", "running", "completed", "failed", "canceled"
 
 	// StartTime is when the execution started
 	StartTime time.Time `json:"start_time"`
@@ -66,8 +231,14 @@ type ExecutionStatus struct {
 	// CurrentNode is the ID of the currently executing node
 	CurrentNode string `json:"current_node,omitempty"`
 
+	// Input the execution was started with, with secret values redacted
+	Input map[string]interface{} `json:"input,omitempty"`
+
 	// Metadata is a map of additional metadata for the execution
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Usage is the LLM token usage and cost of the execution
+	Usage *ExecutionUsage `json:"usage,omitempty"`
 }
 
 // ExecutionLog represents a log entry for an execution
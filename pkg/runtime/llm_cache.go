@@ -0,0 +1,218 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// ErrLLMCacheMiss is returned for LLM requests without a cached response
+var ErrLLMCacheMiss = errors.New("llm response not cached")
+
+// Modes of the LLM response cache
+const (
+	// LLMCacheOff sends every request to the provider
+	LLMCacheOff = "off"
+
+	// LLMCacheReadWrite answers requests from the cache while their
+	// responses are fresh and caches the responses of the others
+	LLMCacheReadWrite = "read_write"
+
+	// LLMCacheRecord sends every request to the provider and records the
+	// responses, which do not expire
+	LLMCacheRecord = "record"
+
+	// LLMCacheReplay answers requests from the cache only, whatever the age
+	// of the responses; requests without one fail
+	LLMCacheReplay = "replay"
+)
+
+// defaultLLMCacheTTL is how long cached responses stay fresh by default
+const defaultLLMCacheTTL = 24 * time.Hour
+
+// IsLLMCacheMode reports whether mode names a mode of the LLM cache
+func IsLLMCacheMode(mode string) bool {
+	switch mode {
+	case LLMCacheOff, LLMCacheReadWrite, LLMCacheRecord, LLMCacheReplay:
+		return true
+	}
+	return false
+}
+
+// LLMCacheEntry is a cached response to an LLM request of an account
+type LLMCacheEntry struct {
+	AccountID string            `json:"account_id"`
+	Key       string            `json:"key"`
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model"`
+	Response  utils.LLMResponse `json:"response"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	// ExpiresAt is when the response goes stale; recorded responses have
+	// none
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// LLMCacheStore persists cached LLM responses
+type LLMCacheStore interface {
+	GetLLMResponse(accountID, key string) (LLMCacheEntry, error)
+	SaveLLMResponse(entry LLMCacheEntry) error
+}
+
+// LLMCacheOptions configures the LLM cache of a runtime
+type LLMCacheOptions struct {
+	// Mode applies to llm nodes that do not set their own. The record and
+	// replay modes apply to all llm nodes, so that test runs can record
+	// responses and replay them offline.
+	Mode string
+
+	// TTL is how long responses stay fresh unless a flow or node sets its
+	// own
+	TTL time.Duration
+}
+
+// SetLLMCache sets where the runtime caches LLM responses and how
+func (r *flowRuntime) SetLLMCache(store LLMCacheStore, options LLMCacheOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.llmCacheStore = store
+	r.llmCacheOptions = options
+}
+
+// llmCache is the cache of the LLM requests of a node
+type llmCache struct {
+	store     LLMCacheStore
+	accountID string
+	mode      string
+	ttl       time.Duration
+}
+
+// newLLMCache returns the cache of an llm node, or nil when its requests are
+// not cached. The mode and ttl come from the node's cache param, or else the
+// llm_cache metadata of the flow, either of which may be a bool or a map
+// with enabled, mode and ttl.
+func newLLMCache(params map[string]interface{}, input interface{}) (*llmCache, error) {
+	env := toolEnvironmentFrom(input)
+	if env == nil || env.runtime == nil || env.execCtx == nil {
+		return nil, nil
+	}
+	env.runtime.mu.RLock()
+	store, options := env.runtime.llmCacheStore, env.runtime.llmCacheOptions
+	env.runtime.mu.RUnlock()
+	if store == nil {
+		return nil, nil
+	}
+
+	cache := &llmCache{store: store, accountID: env.execCtx.accountID, mode: options.Mode, ttl: options.TTL}
+	if cache.mode == "" {
+		cache.mode = LLMCacheOff
+	}
+	if cache.ttl <= 0 {
+		cache.ttl = defaultLLMCacheTTL
+	}
+
+	setting := params["cache"]
+	if setting == nil && env.execCtx.graph != nil {
+		setting = env.execCtx.graph.Metadata.LLMCache
+	}
+	switch v := setting.(type) {
+	case nil:
+	case bool:
+		if cache.mode != LLMCacheRecord && cache.mode != LLMCacheReplay {
+			cache.mode = LLMCacheOff
+			if v {
+				cache.mode = LLMCacheReadWrite
+			}
+		}
+	default:
+		config := mapParam(v)
+		if config == nil {
+			return nil, fmt.Errorf("cache must be a bool or a map")
+		}
+		if cache.mode != LLMCacheRecord && cache.mode != LLMCacheReplay {
+			cache.mode = LLMCacheReadWrite
+			if mode, ok := config["mode"].(string); ok && mode != "" {
+				if !IsLLMCacheMode(mode) {
+					return nil, fmt.Errorf("unknown cache mode %q", mode)
+				}
+				cache.mode = mode
+			}
+			if enabled, ok := config["enabled"].(bool); ok && !enabled {
+				cache.mode = LLMCacheOff
+			}
+		}
+		if ttl, ok := config["ttl"].(string); ok && ttl != "" {
+			parsed, err := time.ParseDuration(ttl)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid cache ttl %q", ttl)
+			}
+			cache.ttl = parsed
+		}
+	}
+
+	if cache.mode == LLMCacheOff {
+		return nil, nil
+	}
+	return cache, nil
+}
+
+// llmCacheKey hashes what determines the response to a request: the
+// provider, model, messages, tools and sampling params
+func llmCacheKey(provider string, request utils.LLMRequest) (string, error) {
+	request.Stream = false
+	data, err := json.Marshal(struct {
+		Provider string           `json:"provider"`
+		Request  utils.LLMRequest `json:"request"`
+	}{provider, request})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash LLM request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lookup returns the cached response for key, or nil when the request must
+// be sent. In replay mode a missing response is an error.
+func (c *llmCache) lookup(key string) (*utils.LLMResponse, error) {
+	if c.mode == LLMCacheRecord {
+		return nil, nil
+	}
+	entry, err := c.store.GetLLMResponse(c.accountID, key)
+	if errors.Is(err, ErrLLMCacheMiss) {
+		if c.mode == LLMCacheReplay {
+			return nil, fmt.Errorf("no recorded response for LLM request %s", key)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LLM cache: %w", err)
+	}
+	if c.mode != LLMCacheReplay && !entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt) {
+		return nil, nil
+	}
+	return &entry.Response, nil
+}
+
+// save caches the response to a request
+func (c *llmCache) save(key, provider, model string, resp *utils.LLMResponse) error {
+	entry := LLMCacheEntry{
+		AccountID: c.accountID,
+		Key:       key,
+		Provider:  provider,
+		Model:     model,
+		Response:  *resp,
+		CreatedAt: time.Now(),
+	}
+	if c.mode != LLMCacheRecord {
+		entry.ExpiresAt = entry.CreatedAt.Add(c.ttl)
+	}
+	if err := c.store.SaveLLMResponse(entry); err != nil {
+		return fmt.Errorf("failed to write LLM cache: %w", err)
+	}
+	return nil
+}
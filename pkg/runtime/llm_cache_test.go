@@ -0,0 +1,138 @@
+package runtime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// newCachedRuntime returns a runtime running an llm flow "ask" with the
+// given llm_cache metadata, when not nil, and extra node params, caching
+// responses in store
+func newCachedRuntime(t *testing.T, baseURL string, llmCache interface{}, extra map[string]interface{}, store runtime.LLMCacheStore, options runtime.LLMCacheOptions) runtime.LLMCachedFlowRuntime {
+	t.Helper()
+	params := map[string]interface{}{
+		"provider": "ollama",
+		"model":    "llama3",
+		"prompt":   "{{.question}}",
+		"options":  map[string]interface{}{"base_url": baseURL},
+	}
+	for key, value := range extra {
+		params[key] = value
+	}
+	flow := nodeFlow("llm", params)
+	if llmCache != nil {
+		flow.Metadata["llm_cache"] = llmCache
+	}
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{"ask": flow})
+	caching, ok := flowRuntime.(runtime.LLMCachedFlowRuntime)
+	require.True(t, ok)
+	caching.SetLLMCache(store, options)
+	return caching
+}
+
+// ask runs the ask flow with a question and returns its status
+func ask(t *testing.T, flowRuntime runtime.LLMCachedFlowRuntime, question string) (string, runtime.ExecutionStatus) {
+	t.Helper()
+	executionID, err := flowRuntime.Execute("test-account", "ask", map[string]interface{}{"question": question})
+	require.NoError(t, err)
+	return executionID, waitForCompletion(t, flowRuntime, executionID)
+}
+
+// cacheStatus returns the cache status in the result of the ask node
+func cacheStatus(t *testing.T, status runtime.ExecutionStatus) interface{} {
+	t.Helper()
+	require.Equal(t, "completed", status.Status, status.Error)
+	result := status.Results["result"].(map[string]interface{})
+	cache, ok := result["cache"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return cache["status"]
+}
+
+func TestLLMCache_RepeatedRequestHitsCache(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"Paris"`), completionWith(`"Lyon"`))
+	flowRuntime := newCachedRuntime(t, server.URL, true, nil, storage.NewMemoryLLMCacheStore(), runtime.LLMCacheOptions{})
+
+	_, first := ask(t, flowRuntime, "What is the capital of France?")
+	assert.Equal(t, "miss", cacheStatus(t, first))
+	executionID, second := ask(t, flowRuntime, "What is the capital of France?")
+	assert.Equal(t, "hit", cacheStatus(t, second))
+	assert.Equal(t, "Paris", second.Results["result"].(map[string]interface{})["content"])
+	require.Len(t, *requests, 1)
+
+	logs, err := flowRuntime.GetLogs(executionID)
+	require.NoError(t, err)
+	var logged bool
+	for _, entry := range logs {
+		logged = logged || entry.Message == "LLM cache hit"
+	}
+	assert.True(t, logged, "cache hit should be logged")
+
+	// Other messages are sent
+	_, third := ask(t, flowRuntime, "What is the capital of Italy?")
+	assert.Equal(t, "miss", cacheStatus(t, third))
+	assert.Len(t, *requests, 2)
+}
+
+func TestLLMCache_DisabledByDefaultAndByNode(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"Paris"`))
+	store := storage.NewMemoryLLMCacheStore()
+
+	flowRuntime := newCachedRuntime(t, server.URL, nil, nil, store, runtime.LLMCacheOptions{})
+	_, status := ask(t, flowRuntime, "What is the capital of France?")
+	assert.Nil(t, cacheStatus(t, status))
+	_, status = ask(t, flowRuntime, "What is the capital of France?")
+	assert.Nil(t, cacheStatus(t, status))
+	assert.Len(t, *requests, 2)
+
+	// The node's setting wins over the flow's
+	flowRuntime = newCachedRuntime(t, server.URL, true, map[string]interface{}{"cache": false}, store, runtime.LLMCacheOptions{})
+	_, status = ask(t, flowRuntime, "What is the capital of France?")
+	assert.Nil(t, cacheStatus(t, status))
+	_, status = ask(t, flowRuntime, "What is the capital of France?")
+	assert.Nil(t, cacheStatus(t, status))
+	assert.Len(t, *requests, 4)
+}
+
+func TestLLMCache_ExpiredResponsesAreSent(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"Paris"`))
+	flowRuntime := newCachedRuntime(t, server.URL, map[string]interface{}{"ttl": "10ms"}, nil, storage.NewMemoryLLMCacheStore(), runtime.LLMCacheOptions{})
+
+	_, status := ask(t, flowRuntime, "What is the capital of France?")
+	assert.Equal(t, "miss", cacheStatus(t, status))
+	time.Sleep(20 * time.Millisecond)
+	_, status = ask(t, flowRuntime, "What is the capital of France?")
+	assert.Equal(t, "miss", cacheStatus(t, status))
+	assert.Len(t, *requests, 2)
+}
+
+func TestLLMCache_RecordAndReplay(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"Paris"`))
+	store := storage.NewMemoryLLMCacheStore()
+
+	// Recording sends every request, even for flows that disable the cache
+	recording := newCachedRuntime(t, server.URL, false, nil, store, runtime.LLMCacheOptions{Mode: runtime.LLMCacheRecord})
+	_, status := ask(t, recording, "What is the capital of France?")
+	assert.Equal(t, "recorded", cacheStatus(t, status))
+	_, status = ask(t, recording, "What is the capital of France?")
+	assert.Equal(t, "recorded", cacheStatus(t, status))
+	assert.Len(t, *requests, 2)
+	server.Close()
+
+	// Replaying answers from the recording without the provider
+	replaying := newCachedRuntime(t, server.URL, false, nil, store, runtime.LLMCacheOptions{Mode: runtime.LLMCacheReplay})
+	_, status = ask(t, replaying, "What is the capital of France?")
+	assert.Equal(t, "hit", cacheStatus(t, status))
+	assert.Equal(t, "Paris", status.Results["result"].(map[string]interface{})["content"])
+
+	// Requests that were not recorded fail
+	_, status = ask(t, replaying, "What is the capital of Italy?")
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "no recorded response")
+}
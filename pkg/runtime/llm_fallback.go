@@ -0,0 +1,451 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// Defaults for the retry and circuit breaker settings of llm nodes
+const (
+	defaultLLMMaxAttempts      = 3
+	defaultLLMInitialDelay     = 1 * time.Second
+	defaultLLMMaxDelay         = 30 * time.Second
+	defaultLLMFailureThreshold = 5
+	defaultLLMBreakerCooldown  = 30 * time.Second
+)
+
+// llmRetryPolicy controls how an llm node retries a model before falling back
+type llmRetryPolicy struct {
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+// newLLMRetryPolicy reads the retry param:
+//
+//	retry:
+//	  max_attempts: 3
+//	  initial_delay: 1s
+//	  max_delay: 30s
+func newLLMRetryPolicy(params map[string]interface{}) llmRetryPolicy {
+	retry := mapParam(params["retry"])
+	policy := llmRetryPolicy{
+		maxAttempts:  intParam(retry["max_attempts"], defaultLLMMaxAttempts),
+		initialDelay: durationParam(retry["initial_delay"], defaultLLMInitialDelay),
+		maxDelay:     durationParam(retry["max_delay"], defaultLLMMaxDelay),
+	}
+	if policy.maxAttempts < 1 {
+		policy.maxAttempts = 1
+	}
+	return policy
+}
+
+// delay returns the wait before the given retry. A delay requested by the
+// provider is honoured as is; otherwise the exponential backoff is jittered so
+// that executions failing together do not retry together.
+func (p llmRetryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	backoff := p.maxDelay
+	if retry < 32 && p.initialDelay<<(retry-1) < p.maxDelay {
+		backoff = p.initialDelay << (retry - 1)
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// llmBreakerConfig controls when the circuit breaker of a provider opens
+type llmBreakerConfig struct {
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+// newLLMBreakerConfig reads the circuit_breaker param:
+//
+//	circuit_breaker:
+//	  failure_threshold: 5
+//	  cooldown: 30s
+func newLLMBreakerConfig(params map[string]interface{}) llmBreakerConfig {
+	breaker := mapParam(params["circuit_breaker"])
+	return llmBreakerConfig{
+		failureThreshold: intParam(breaker["failure_threshold"], defaultLLMFailureThreshold),
+		cooldown:         durationParam(breaker["cooldown"], defaultLLMBreakerCooldown),
+	}
+}
+
+// llmCircuitBreaker stops requests to a provider endpoint after repeated
+// temporary failures. Breakers are shared by all executions in the process.
+type llmCircuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var (
+	llmBreakersMu sync.Mutex
+	llmBreakers   = make(map[string]*llmCircuitBreaker)
+)
+
+// llmCircuitBreakerFor returns the shared breaker of a provider endpoint
+// and credential
+func llmCircuitBreakerFor(key string) *llmCircuitBreaker {
+	llmBreakersMu.Lock()
+	defer llmBreakersMu.Unlock()
+	breaker, ok := llmBreakers[key]
+	if !ok {
+		breaker = &llmCircuitBreaker{}
+		llmBreakers[key] = breaker
+	}
+	return breaker
+}
+
+// allow reports whether a request may be sent. Once the cooldown of an open
+// breaker has passed, a single probe request is let through.
+func (b *llmCircuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record updates the breaker with the outcome of a request and reports
+// whether it opened. Only temporary errors count as failures; any other
+// outcome shows the provider is serving requests.
+func (b *llmCircuitBreaker) record(err error, config llmBreakerConfig, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.probing
+	b.probing = false
+
+	// A cancelled request says nothing about the provider
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if !utils.IsTemporaryLLMError(err) {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return false
+	}
+
+	b.failures++
+	if probe || b.failures >= config.failureThreshold {
+		b.openUntil = now.Add(config.cooldown)
+		return true
+	}
+	return false
+}
+
+// llmAnswer records which model answered an llm node request
+type llmAnswer struct {
+	Provider      string
+	Model         string
+	FallbackIndex int
+	Attempts      int
+	Failures      []map[string]interface{}
+
+	// Cache is the outcome of the LLM cache lookup: hit, miss or recorded;
+	// it is empty when the request was not cached
+	Cache    string
+	CacheKey string
+}
+
+// result returns the answer as recorded in the node result
+func (a *llmAnswer) result() map[string]interface{} {
+	return map[string]interface{}{
+		"provider":       a.Provider,
+		"model":          a.Model,
+		"fallback_index": a.FallbackIndex,
+		"attempts":       a.Attempts,
+		"failures":       a.Failures,
+	}
+}
+
+// llmCandidates returns the params of the node's model followed by those of
+// each entry in fallbacks. A fallback inherits the provider settings and
+// model of the node unless it names its own provider or provider_secret; a
+// fallback given as a string names another model of the node's provider.
+func llmCandidates(params map[string]interface{}) []map[string]interface{} {
+	candidates := []map[string]interface{}{params}
+	fallbacks, _ := params["fallbacks"].([]interface{})
+	for _, fallback := range fallbacks {
+		entry := mapParam(fallback)
+		if model, ok := fallback.(string); ok {
+			entry = map[string]interface{}{"model": model}
+		}
+		if entry == nil {
+			continue
+		}
+
+		candidate := map[string]interface{}{}
+		if entry["provider"] == nil && entry["provider_secret"] == nil {
+			for _, key := range []string{"provider", "api_key", "provider_secret", "options", "model"} {
+				if value, ok := params[key]; ok {
+					candidate[key] = value
+				}
+			}
+		}
+		for key, value := range entry {
+			candidate[key] = value
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// completeWithFallbacks sends request to the node's model, retrying temporary
+// failures, and moves on to each fallback in turn while requests keep
+// failing. send performs a single request; logf writes to the execution log.
+func completeWithFallbacks(ctx context.Context, params map[string]interface{}, input interface{}, request utils.LLMRequest,
+	send func(client *utils.LLMClient, request utils.LLMRequest) (*utils.LLMResponse, error),
+	logf func(level, message string, data map[string]interface{})) (*utils.LLMResponse, *llmAnswer, error) {
+
+	policy := newLLMRetryPolicy(params)
+	breakerConfig := newLLMBreakerConfig(params)
+	candidates := llmCandidates(params)
+	answer := &llmAnswer{}
+	cache, err := newLLMCache(params, input)
+	if err != nil {
+		return nil, answer, err
+	}
+
+	var lastErr error
+	for index, candidateParams := range candidates {
+		model, _ := candidateParams["model"].(string)
+		provider, _ := candidateParams["provider"].(string)
+		fail := func(err error) {
+			lastErr = err
+			answer.Failures = append(answer.Failures, map[string]interface{}{
+				"provider":       provider,
+				"model":          model,
+				"fallback_index": index,
+				"error":          err.Error(),
+			})
+			if index < len(candidates)-1 {
+				logf("warn", "LLM model failed, trying fallback", map[string]interface{}{
+					"provider":       provider,
+					"model":          model,
+					"fallback_index": index + 1,
+					"error":          err.Error(),
+				})
+			}
+		}
+
+		settings, err := resolveLLMProvider(candidateParams, input)
+		var client *utils.LLMClient
+		if err == nil {
+			client, err = settings.client()
+		}
+		if err != nil {
+			fail(err)
+			continue
+		}
+		provider = string(client.Provider())
+		if model == "" {
+			model = client.DefaultModel()
+		}
+		if model == "" {
+			fail(fmt.Errorf("model parameter is required"))
+			continue
+		}
+
+		candidateRequest := request
+		candidateRequest.Model = model
+		candidateRequest.Options = llmRequestOptions(candidateParams, params)
+		if schema := utils.NormalizeJSONSchema(params["output_schema"]); schema != nil {
+			candidateRequest = withOutputSchema(client, candidateRequest, schema)
+		}
+		if err := checkLLMCapabilities(client, candidateRequest); err != nil {
+			fail(err)
+			continue
+		}
+
+		// Answer from the cache when it holds a response to the request
+		var cacheKey string
+		if cache != nil {
+			var cached *utils.LLMResponse
+			if cacheKey, err = llmCacheKey(provider, candidateRequest); err == nil {
+				cached, err = cache.lookup(cacheKey)
+			}
+			if err != nil {
+				fail(err)
+				continue
+			}
+			answer.CacheKey = cacheKey
+			if cached != nil {
+				logf("info", "LLM cache hit", map[string]interface{}{
+					"provider": provider,
+					"model":    model,
+					"key":      cacheKey,
+					"mode":     cache.mode,
+				})
+				answer.Provider = provider
+				answer.Model = model
+				answer.FallbackIndex = index
+				answer.Cache = "hit"
+				return cached, answer, nil
+			}
+			answer.Cache = "miss"
+			if cache.mode == LLMCacheRecord {
+				answer.Cache = "recorded"
+			}
+			logf("info", "LLM cache miss", map[string]interface{}{
+				"provider": provider,
+				"model":    model,
+				"key":      cacheKey,
+				"mode":     cache.mode,
+			})
+		}
+
+		breaker := llmCircuitBreakerFor(settings.breakerKey())
+		for attempt := 1; ; attempt++ {
+			if !breaker.allow(time.Now()) {
+				err = fmt.Errorf("circuit breaker open for provider %s", settings.endpoint())
+				break
+			}
+
+			logf("info", "Making LLM API request", map[string]interface{}{
+				"provider":       provider,
+				"model":          model,
+				"attempt":        attempt,
+				"fallback_index": index,
+			})
+			answer.Attempts++
+			var resp *utils.LLMResponse
+			resp, err = send(client, candidateRequest)
+			if err == nil && resp.Error != nil {
+				err = fmt.Errorf("LLM API error: %s", resp.Error.Message)
+			}
+			if breaker.record(err, breakerConfig, time.Now()) {
+				logf("warn", "LLM circuit breaker opened", map[string]interface{}{
+					"provider": settings.endpoint(),
+					"cooldown": breakerConfig.cooldown.String(),
+				})
+			}
+			if err == nil {
+				answer.Provider = provider
+				answer.Model = model
+				answer.FallbackIndex = index
+				if cache != nil {
+					if err := cache.save(cacheKey, provider, model, resp); err != nil {
+						logf("warn", "LLM response not cached", map[string]interface{}{"error": err.Error()})
+					}
+				}
+				return resp, answer, nil
+			}
+			if ctx.Err() != nil || errors.Is(err, errLLMStreamInterrupted) {
+				return nil, answer, err
+			}
+			if !utils.IsTemporaryLLMError(err) || attempt >= policy.maxAttempts {
+				break
+			}
+
+			var retryAfter time.Duration
+			var apiErr *utils.LLMAPIError
+			if errors.As(err, &apiErr) {
+				retryAfter = apiErr.RetryAfter
+			}
+			delay := policy.delay(attempt, retryAfter)
+			if delay > policy.maxDelay {
+				// The provider asks for a longer wait than allowed
+				break
+			}
+			logf("warn", "LLM request failed, retrying", map[string]interface{}{
+				"provider": provider,
+				"model":    model,
+				"attempt":  attempt,
+				"delay":    delay.String(),
+				"error":    err.Error(),
+			})
+			select {
+			case <-ctx.Done():
+				return nil, answer, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		fail(err)
+	}
+
+	if len(candidates) > 1 {
+		return nil, answer, fmt.Errorf("all %d models failed, last error: %w", len(candidates), lastErr)
+	}
+	return nil, answer, lastErr
+}
+
+// llmRequestOptions returns the request options of a candidate: its own
+// options and the node's response_format
+func llmRequestOptions(candidateParams, params map[string]interface{}) map[string]interface{} {
+	options := make(map[string]interface{})
+	for k, v := range mapParam(candidateParams["options"]) {
+		options[k] = v
+	}
+	if format := mapParam(params["response_format"]); format != nil {
+		options["response_format"] = format
+	}
+	return options
+}
+
+// checkLLMCapabilities rejects requests using features the provider lacks
+func checkLLMCapabilities(client *utils.LLMClient, request utils.LLMRequest) error {
+	capabilities := client.Capabilities()
+	if (len(request.Tools) > 0 || len(request.Functions) > 0) && !capabilities.Tools {
+		return fmt.Errorf("provider %s does not support tools", client.Provider())
+	}
+	if request.Options["response_format"] != nil && !capabilities.JSONMode {
+		return fmt.Errorf("provider %s does not support response_format", client.Provider())
+	}
+	return nil
+}
+
+// mapParam returns a param holding a map, converting maps decoded from YAML
+func mapParam(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case map[interface{}]interface{}:
+		return convertInterfaceMapToStringMap(v)
+	}
+	return nil
+}
+
+// intParam returns a numeric param as int, or fallback when unset
+func intParam(value interface{}, fallback int) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return fallback
+}
+
+// durationParam returns a param given as duration string or number of
+// seconds, or fallback when unset or invalid
+func durationParam(value interface{}, fallback time.Duration) time.Duration {
+	switch v := value.(type) {
+	case string:
+		if duration, err := time.ParseDuration(v); err == nil {
+			return duration
+		}
+	case int:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	}
+	return fallback
+}
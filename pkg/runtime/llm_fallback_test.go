@@ -0,0 +1,189 @@
+package runtime_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// providerReply is one scripted response of a fake provider
+type providerReply struct {
+	status  int
+	headers map[string]string
+	body    string
+}
+
+// newScriptedProvider returns a server answering with the given replies in
+// turn, repeating the last one, and the models it was asked for
+func newScriptedProvider(t *testing.T, replies ...providerReply) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		models = append(models, body.Model)
+		reply := replies[len(replies)-1]
+		if len(models) <= len(replies) {
+			reply = replies[len(models)-1]
+		}
+		mu.Unlock()
+
+		for key, value := range reply.headers {
+			w.Header().Set(key, value)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(reply.status)
+		fmt.Fprint(w, reply.body)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), models...)
+	}
+}
+
+var (
+	replyOK          = providerReply{status: http.StatusOK, body: chatCompletion}
+	replyUnavailable = providerReply{status: http.StatusServiceUnavailable, body: `{"error": {"message": "overloaded", "type": "server_error"}}`}
+	replyInvalid     = providerReply{status: http.StatusBadRequest, body: `{"error": {"message": "context too long", "type": "invalid_request_error"}}`}
+)
+
+func TestLLMNode_RetriesHonourRetryAfter(t *testing.T) {
+	server, models := newScriptedProvider(t,
+		providerReply{status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After-Ms": "50"}, body: `{"error": {"message": "slow down"}}`},
+		replyOK,
+	)
+
+	start := time.Now()
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider": "ollama",
+		"model":    "llama3",
+		"prompt":   "ping",
+		"options":  map[string]interface{}{"base_url": server.URL},
+		"retry":    map[string]interface{}{"initial_delay": "1ms"},
+	})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, []string{"llama3", "llama3"}, models())
+
+	answeredBy := result["answered_by"].(map[string]interface{})
+	assert.Equal(t, "ollama", answeredBy["provider"])
+	assert.Equal(t, "llama3", answeredBy["model"])
+	assert.Equal(t, 0, answeredBy["fallback_index"])
+	assert.Equal(t, 2, answeredBy["attempts"])
+}
+
+func TestLLMNode_ValidationErrorsFallBackWithoutRetry(t *testing.T) {
+	server, models := newScriptedProvider(t, replyInvalid, replyOK)
+
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider":  "ollama",
+		"model":     "small-context",
+		"prompt":    "ping",
+		"options":   map[string]interface{}{"base_url": server.URL},
+		"fallbacks": []interface{}{"large-context"},
+		"retry":     map[string]interface{}{"initial_delay": "1ms"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"small-context", "large-context"}, models())
+
+	answeredBy := result["answered_by"].(map[string]interface{})
+	assert.Equal(t, "large-context", answeredBy["model"])
+	assert.Equal(t, 1, answeredBy["fallback_index"])
+	failures := answeredBy["failures"].([]map[string]interface{})
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0]["error"], "context too long")
+}
+
+func TestLLMNode_FallbackProviders(t *testing.T) {
+	primary, primaryModels := newScriptedProvider(t, replyUnavailable)
+	fallback, fallbackModels := newScriptedProvider(t, replyOK)
+
+	params := map[string]interface{}{
+		"provider": "ollama",
+		"model":    "llama3",
+		"prompt":   "ping",
+		"options":  map[string]interface{}{"base_url": primary.URL},
+		"fallbacks": []interface{}{
+			map[string]interface{}{
+				"provider": "llamacpp",
+				"model":    "qwen",
+				"options":  map[string]interface{}{"base_url": fallback.URL},
+			},
+		},
+		"retry":           map[string]interface{}{"max_attempts": 2, "initial_delay": "1ms"},
+		"circuit_breaker": map[string]interface{}{"failure_threshold": 2, "cooldown": "1m"},
+	}
+
+	result, err := runLLMNode(t, params)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", result["content"])
+	assert.Equal(t, "llamacpp", result["provider"])
+	assert.Equal(t, []string{"llama3", "llama3"}, primaryModels())
+	assert.Equal(t, []string{"qwen"}, fallbackModels())
+
+	// The primary's breaker opened and is shared by later requests
+	result, err = runLLMNode(t, params)
+	require.NoError(t, err)
+	assert.Len(t, primaryModels(), 2)
+	answeredBy := result["answered_by"].(map[string]interface{})
+	assert.Equal(t, 1, answeredBy["fallback_index"])
+	assert.Contains(t, answeredBy["failures"].([]map[string]interface{})[0]["error"], "circuit breaker open")
+
+	// Without a working fallback every failure is reported
+	delete(params, "fallbacks")
+	_, err = runLLMNode(t, params)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "circuit breaker open")
+
+	// Requests with another key, such as another account's, have a breaker
+	// of their own
+	params["api_key"] = "other-key"
+	_, err = runLLMNode(t, params)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "circuit breaker open")
+	assert.Len(t, primaryModels(), 4)
+}
+
+func TestLLMClient_ClassifiesErrors(t *testing.T) {
+	server, _ := newScriptedProvider(t,
+		providerReply{status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "7"}, body: `{"error": {"message": "rate limited", "type": "requests", "code": "rate_limit_exceeded"}}`},
+		providerReply{status: http.StatusUnauthorized, body: `{"error": {"message": "bad key"}}`},
+	)
+	client := utils.NewLLMClient(utils.OpenAI, "key", map[string]interface{}{"base_url": server.URL})
+	request := utils.LLMRequest{Model: "gpt-test", Messages: []utils.Message{{Role: "user", Content: "ping"}}}
+
+	_, err := client.Complete(context.Background(), request)
+	var apiErr *utils.LLMAPIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, 7*time.Second, apiErr.RetryAfter)
+	assert.Equal(t, "rate limited", apiErr.Message)
+	assert.Equal(t, "rate_limit_exceeded", apiErr.Code)
+	assert.True(t, utils.IsTemporaryLLMError(err))
+
+	_, err = client.Complete(context.Background(), request)
+	assert.EqualError(t, err, "OpenAI API error (status 401): bad key")
+	assert.False(t, utils.IsTemporaryLLMError(err))
+
+	server.Close()
+	_, err = client.Complete(context.Background(), request)
+	assert.True(t, utils.IsTemporaryLLMError(err), "connection failures are temporary: %v", err)
+	assert.False(t, utils.IsTemporaryLLMError(context.Canceled))
+}
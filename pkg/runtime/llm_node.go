@@ -2,9 +2,9 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/tcmartin/flowlib"
 	"github.com/tcmartin/flowrunner/pkg/utils"
@@ -38,6 +38,31 @@ func convertInterfaceMapToStringMap(input map[interface{}]interface{}) map[strin
 	return result
 }
 
+// LLMDeltaEvent marks execution log entries carrying a token delta of a
+// streamed LLM response in Data["delta"]
+const LLMDeltaEvent = "llm_delta"
+
+// errLLMStreamInterrupted fails a streamed LLM response whose deltas were
+// already sent; neither retries nor fallbacks can take them back
+var errLLMStreamInterrupted = errors.New("stream interrupted")
+
+// sharedTemplateVariables returns the shared context of a flow execution as
+// prompt template variables, so that templates can use the results of
+// earlier nodes by name. Internal keys are left out.
+func sharedTemplateVariables(input any) map[string]any {
+	variables := make(map[string]any)
+	env := toolEnvironmentFrom(input)
+	if env == nil {
+		return variables
+	}
+	for key, value := range env.shared {
+		if !isReservedSharedKey(key) {
+			variables[key] = value
+		}
+	}
+	return variables
+}
+
 // LLMNodeWrapper is a wrapper for LLM nodes
 type LLMNodeWrapper struct {
 	*NodeWrapper
@@ -46,8 +71,8 @@ type LLMNodeWrapper struct {
 
 // NewLLMNodeWrapper creates a new LLM node wrapper
 func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
-	// Create the base node
-	baseNode := flowlib.NewNode(3, 5*time.Second)
+	// Create the base node; requests are retried per model, see retry
+	baseNode := flowlib.NewNode(1, 0)
 
 	// Create the wrapper
 	wrapper := &NodeWrapper{
@@ -114,50 +139,36 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 				}
 			}
 
+			// Helper function sending transient entries to the subscribers
+			// of the execution without logging them
+			streamToExecution := func(message string, data map[string]interface{}) {
+				if executionID == "" {
+					return
+				}
+				data["node_type"] = "llm"
+				if nodeID != "" {
+					data["node_id"] = nodeID
+				}
+				if execCtx, ok := flowInput["_execution"].(map[string]interface{}); ok {
+					if stream, ok := execCtx["stream"].(func(string, string, string, map[string]interface{})); ok {
+						stream(executionID, "debug", message, data)
+					}
+				}
+			}
+
 			// Convert params to map[string]any for compatibility
 			paramsAny := make(map[string]any)
 			for k, v := range params {
 				paramsAny[k] = v
 			}
 
-			// Extract provider
-			providerStr, ok := paramsAny["provider"].(string)
-			if !ok {
-				providerStr = "openai" // Default to OpenAI
-			}
-
 			// Log the start of LLM execution
+			providerStr, _ := paramsAny["provider"].(string)
+			model, _ := paramsAny["model"].(string)
 			logToExecution("info", "Starting LLM execution", map[string]interface{}{
-				"provider": providerStr,
-			})
-
-			var provider utils.LLMProvider
-			switch providerStr {
-			case "openai":
-				provider = utils.OpenAI
-			case "anthropic":
-				provider = utils.Anthropic
-			default:
-				provider = utils.Generic
-			}
-
-			// Extract API key
-			apiKey, ok := paramsAny["api_key"].(string)
-			if !ok {
-				logToExecution("error", "api_key parameter is required", nil)
-				return nil, fmt.Errorf("api_key parameter is required")
-			}
-
-			// Extract model
-			model, ok := paramsAny["model"].(string)
-			if !ok {
-				logToExecution("error", "model parameter is required", nil)
-				return nil, fmt.Errorf("model parameter is required")
-			}
-
-			logToExecution("info", "LLM configuration set", map[string]interface{}{
-				"provider": providerStr,
-				"model":    model,
+				"provider":  providerStr,
+				"model":     model,
+				"fallbacks": len(llmCandidates(paramsAny)) - 1,
 			})
 
 			// Extract messages - check if we should use dynamic input
@@ -192,12 +203,48 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 			}
 
 			// If no dynamic content was used, fall back to static parameters
+			var promptUsed *Prompt
 			if len(messages) == 0 {
 
-			// Check if we're using templates
-			if templatesParam, ok := paramsAny["templates"].([]any); ok {
-				// Extract template variables
-				variables := make(map[string]any)
+			// Check if we're using a prompt of the library or templates
+			if refParam, ok := paramsAny["template_ref"].(string); ok {
+				prompt, err := toolEnvironmentFrom(input).loadPrompt(refParam)
+				if err != nil {
+					return nil, err
+				}
+
+				// Variables come from the shared context, context and variables
+				variables := sharedTemplateVariables(input)
+				for _, key := range []string{"context", "variables"} {
+					if extra, ok := paramsAny[key].(map[string]any); ok {
+						for k, v := range extra {
+							variables[k] = v
+						}
+					}
+				}
+
+				templateDefs := make([]struct {
+					Role     string
+					Template string
+				}, len(prompt.Messages))
+				for i, message := range prompt.Messages {
+					templateDefs[i].Role = message.Role
+					templateDefs[i].Template = message.Template
+				}
+				renderedMessages, err := utils.MessagesFromTemplates(templateDefs, variables)
+				if err != nil {
+					return nil, fmt.Errorf("failed to render prompt %s@%d: %w", prompt.Name, prompt.Version, err)
+				}
+
+				messages = renderedMessages
+				promptUsed = &prompt
+				logToExecution("info", "Rendered prompt from library", map[string]interface{}{
+					"prompt":  prompt.Name,
+					"version": prompt.Version,
+				})
+			} else if templatesParam, ok := paramsAny["templates"].([]any); ok {
+				// Extract template variables, starting from the shared context
+				variables := sharedTemplateVariables(input)
 
 				// Add context variables if provided
 				if contextParam, ok := paramsAny["context"].(map[string]any); ok {
@@ -266,11 +313,17 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 						Content: promptParam,
 					},
 				}
-			} else if templateParam, ok := paramsAny["template"].(string); ok && paramsAny["variables"] != nil {
-				// Support single template with variables
-				variables, ok := paramsAny["variables"].(map[string]any)
-				if !ok {
-					return nil, fmt.Errorf("variables must be a map[string]any")
+			} else if templateParam, ok := paramsAny["template"].(string); ok {
+				// Support single template with variables and the shared context
+				variables := sharedTemplateVariables(input)
+				if variablesParam, ok := paramsAny["variables"]; ok {
+					variablesMap, ok := variablesParam.(map[string]any)
+					if !ok {
+						return nil, fmt.Errorf("variables must be a map[string]any")
+					}
+					for k, v := range variablesMap {
+						variables[k] = v
+					}
 				}
 
 				// Create template
@@ -298,10 +351,29 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 					},
 				}
 			} else {
-				return nil, fmt.Errorf("either messages, prompt, template, or templates parameter is required")
+				return nil, fmt.Errorf("either messages, prompt, template, templates, or template_ref parameter is required")
 			}
 			} // Close the "if len(messages) == 0" block
 
+			// Continue the conversation of the node's memory session
+			memory, err := newConversationMemory(paramsAny, toolEnvironmentFrom(input))
+			if err != nil {
+				return nil, err
+			}
+			var conversation *Conversation
+			turn := newTurn(messages)
+			if memory != nil {
+				if conversation, err = toolEnvironmentFrom(input).loadConversation(memory); err != nil {
+					return nil, err
+				}
+				messages = conversation.withHistory(messages)
+				logToExecution("info", "Continuing conversation", map[string]interface{}{
+					"session_id": memory.sessionID,
+					"remembered": len(conversation.Messages),
+					"summarized": conversation.Summary != "",
+				})
+			}
+
 			// Extract temperature
 			temperature := 0.7 // Default temperature
 			if tempParam, ok := paramsAny["temperature"].(float64); ok {
@@ -390,32 +462,14 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 				}
 			}
 
-			// Extract additional options
-			options := make(map[string]any)
-			if optsParam, ok := params["options"].(map[string]any); ok {
-				for k, v := range optsParam {
-					options[k] = v
-				}
-			}
-
-			// Extract response format (for structured output)
-			if formatParam, ok := params["response_format"].(map[string]any); ok {
-				options["response_format"] = formatParam
-			}
-
-			// Create LLM client
-			client := utils.NewLLMClient(provider, apiKey, options)
-
-			// Create LLM request
+			// Create LLM request; the model and options are set per candidate
 			request := utils.LLMRequest{
-				Model:       model,
 				Messages:    messages,
 				Temperature: temperature,
 				MaxTokens:   maxTokens,
 				Stop:        stop,
 				Functions:   functions,
 				Tools:       tools,
-				Options:     options,
 			}
 
 			log.Printf("[LLM Node] Making LLM request - Model: %s, Messages: %d, Temperature: %.2f, MaxTokens: %d", 
@@ -427,44 +481,118 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 				}
 			}
 
-			logToExecution("info", "Making LLM API request", map[string]interface{}{
-				"model":        model,
-				"messages":     len(messages),
-				"temperature":  temperature,
-				"max_tokens":   maxTokens,
-				"provider":     providerStr,
-			})
-
-			// Execute request
+			// Execute request, bounded by the execution when running in a flow
 			ctx := context.Background()
-			resp, err := client.Complete(ctx, request)
-			if err != nil {
-				logToExecution("error", "LLM request failed", map[string]interface{}{
-					"error": err.Error(),
-					"model": model,
-				})
-				return nil, fmt.Errorf("LLM request failed: %w", err)
+			if env := toolEnvironmentFrom(input); env != nil && env.ctx != nil {
+				ctx = env.ctx
 			}
 
-			logToExecution("info", "LLM request completed successfully", map[string]interface{}{
-				"model": model,
-			})
+			stream, _ := paramsAny["stream"].(bool)
+			send := func(client *utils.LLMClient, request utils.LLMRequest) (*utils.LLMResponse, error) {
+				if !stream {
+					return client.Complete(ctx, request)
+				}
 
-			// Check for errors
-			if resp.Error != nil {
-				logToExecution("error", "LLM API error", map[string]interface{}{
-					"error": resp.Error.Message,
-					"model": model,
+				// Token deltas are sent to the subscribers of the execution as
+				// they arrive so clients can render the response live; only
+				// the complete response is logged
+				deltaIndex := 0
+				chunks, err := client.Stream(ctx, request)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := utils.CollectStream(chunks, func(delta string) {
+					streamToExecution("LLM token delta", map[string]interface{}{
+						"event": LLMDeltaEvent,
+						"delta": delta,
+						"index": deltaIndex,
+					})
+					deltaIndex++
 				})
-				return nil, fmt.Errorf("LLM API error: %s", resp.Error.Message)
+				if err != nil && deltaIndex > 0 {
+					// Retrying would repeat the deltas already sent
+					return nil, fmt.Errorf("%w after %d deltas: %v", errLLMStreamInterrupted, deltaIndex, err)
+				}
+				return resp, err
 			}
 
-			// Extract response
-			if len(resp.Choices) == 0 {
-				logToExecution("error", "No choices returned from LLM", map[string]interface{}{
-					"model": model,
+			// Responses not matching the output_schema are sent back to the
+			// model with the validation errors until the repairs are used up
+			schema := newOutputSchema(paramsAny)
+			var output interface{}
+			var validationErrors []string
+			var resp *utils.LLMResponse
+			var answer *llmAnswer
+			repairs := 0
+			for {
+				// Fail fast once the account has spent its LLM budget
+				if err := toolEnvironmentFrom(input).checkLLMBudget(); err != nil {
+					logToExecution("error", "LLM budget exhausted", map[string]interface{}{"error": err.Error()})
+					return nil, err
+				}
+
+				var err error
+				resp, answer, err = completeWithFallbacks(ctx, paramsAny, input, request, send, logToExecution)
+				if err != nil {
+					logToExecution("error", "LLM request failed", map[string]interface{}{
+						"error":    err.Error(),
+						"attempts": answer.Attempts,
+					})
+					return nil, fmt.Errorf("LLM request failed: %w", err)
+				}
+
+				logToExecution("info", "LLM request completed successfully", map[string]interface{}{
+					"provider":       answer.Provider,
+					"model":          answer.Model,
+					"fallback_index": answer.FallbackIndex,
+					"attempts":       answer.Attempts,
 				})
-				return nil, fmt.Errorf("no choices returned from LLM")
+
+				// Providers that do not echo the model are reported by name
+				if resp.Model == "" {
+					resp.Model = answer.Model
+				}
+				// Cached responses cost nothing
+				if answer.Cache != "hit" {
+					toolEnvironmentFrom(input).recordLLMUsage(answer.Provider, resp.Model, resp.Usage, 1)
+				}
+
+				// Extract response
+				if len(resp.Choices) == 0 {
+					logToExecution("error", "No choices returned from LLM", map[string]interface{}{
+						"model": answer.Model,
+					})
+					return nil, fmt.Errorf("no choices returned from LLM")
+				}
+
+				if schema == nil {
+					break
+				}
+				output, validationErrors = schema.validate(resp.Choices[0].Message.Content)
+				if len(validationErrors) == 0 {
+					logToExecution("info", "LLM output matches output_schema", map[string]interface{}{"repairs": repairs})
+					break
+				}
+				if repairs >= schema.maxRepairs {
+					logToExecution("warn", "LLM output does not match output_schema", map[string]interface{}{
+						"errors":  validationErrors,
+						"repairs": repairs,
+					})
+					break
+				}
+				repairs++
+				logToExecution("warn", "LLM output does not match output_schema, asking for a repair", map[string]interface{}{
+					"errors": validationErrors,
+					"repair": repairs,
+				})
+				request.Messages = repairMessages(request.Messages, resp.Choices[0].Message.Content, validationErrors)
+			}
+
+			// Remember the turn and its answer in the session
+			if conversation != nil {
+				if err := toolEnvironmentFrom(input).rememberTurn(memory, conversation, append(turn, resp.Choices[0].Message), llmSummarizer(ctx, paramsAny, input, logToExecution), logToExecution); err != nil {
+					return nil, err
+				}
 			}
 
 			content := resp.Choices[0].Message.Content
@@ -512,6 +640,23 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 				"raw_response":  resp.RawResponse,
 				"has_tool_calls": hasToolCalls,
 				"tool_calls":    toolCalls,
+				"provider":      answer.Provider,
+				"answered_by":   answer.result(),
+			}
+			if memory != nil {
+				result["session_id"] = memory.sessionID
+			}
+			if answer.Cache != "" {
+				result["cache"] = map[string]any{
+					"status": answer.Cache,
+					"key":    answer.CacheKey,
+				}
+			}
+			if promptUsed != nil {
+				result["prompt"] = map[string]any{
+					"name":    promptUsed.Name,
+					"version": promptUsed.Version,
+				}
 			}
 
 			// Add structured output if available
@@ -520,6 +665,18 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 				log.Printf("[LLM Node] Structured output parsed successfully")
 			}
 
+			// Add the output validated against the output_schema
+			if schema != nil {
+				result["output_valid"] = len(validationErrors) == 0
+				result["repairs"] = repairs
+				if len(validationErrors) == 0 {
+					result["output"] = output
+					result["structured_output"] = output
+				} else {
+					result["validation_errors"] = validationErrors
+				}
+			}
+
 			log.Printf("[LLM Node] Execution completed successfully - Response ID: %s", resp.ID)
 			// Extract keys for debugging
 			keys := make([]string, 0, len(result))
@@ -533,6 +690,11 @@ func NewLLMNodeWrapper(params map[string]any) (flowlib.Node, error) {
 		},
 	}
 
+	// Route by the validation of the output_schema, if any
+	wrapper.post = func(shared, p, e interface{}) (flowlib.Action, error) {
+		return routeOutput(wrapper, shared, e)
+	}
+
 	// Set the parameters
 	wrapper.SetParams(params)
 
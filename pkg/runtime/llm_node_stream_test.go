@@ -0,0 +1,252 @@
+package runtime_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// newStreamingLLM returns a server answering every request with the given
+// server-sent events, after checking that streaming was requested
+func newStreamingLLM(t *testing.T, path string, events []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, path, r.URL.Path)
+		assert.Equal(t, true, request["stream"])
+		assert.NotContains(t, request, "base_url")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprint(w, event+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+// runStreamingLLMNode runs a streaming llm node and returns its result and the
+// token deltas it streamed
+func runStreamingLLMNode(t *testing.T, provider, baseURL string) (map[string]interface{}, []string) {
+	t.Helper()
+	node, err := runtime.NewLLMNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(map[string]interface{}{
+		"provider": provider,
+		"api_key":  "test-key",
+		"model":    "test-model",
+		"stream":   true,
+		"options":  map[string]interface{}{"base_url": baseURL},
+	})
+
+	var mu sync.Mutex
+	var deltas []string
+	shared := map[string]interface{}{
+		"question": "Say hello",
+		"_execution": map[string]interface{}{
+			"execution_id": "exec-1",
+			"stream": func(executionID, level, message string, data map[string]interface{}) {
+				if data["event"] == runtime.LLMDeltaEvent {
+					mu.Lock()
+					deltas = append(deltas, data["delta"].(string))
+					mu.Unlock()
+				}
+			},
+		},
+	}
+	_, err = node.Run(shared)
+	require.NoError(t, err)
+	return shared["result"].(map[string]interface{}), deltas
+}
+
+func TestLLMNode_StreamOpenAI(t *testing.T) {
+	llm := newStreamingLLM(t, "/chat/completions", []string{
+		`data: {"id":"chatcmpl-1","model":"test-model","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+		": keep-alive",
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"lo!"}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}`,
+		`data: [DONE]`,
+	})
+	defer llm.Close()
+
+	result, deltas := runStreamingLLMNode(t, "openai", llm.URL)
+	assert.Equal(t, []string{"Hel", "lo!"}, deltas)
+	assert.Equal(t, "Hello!", result["content"])
+	assert.Equal(t, "stop", result["finish_reason"])
+	assert.Equal(t, "chatcmpl-1", result["id"])
+	assert.Equal(t, utils.Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9}, result["usage"])
+}
+
+func TestLLMNode_StreamAnthropic(t *testing.T) {
+	llm := newStreamingLLM(t, "/messages", []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"test-model\",\"usage\":{\"input_tokens\":5,\"output_tokens\":1}}}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+		"event: ping\ndata: {\"type\":\"ping\"}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi \"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"there\"}}",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":3}}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+	})
+	defer llm.Close()
+
+	result, deltas := runStreamingLLMNode(t, "anthropic", llm.URL)
+	assert.Equal(t, []string{"Hi ", "there"}, deltas)
+	assert.Equal(t, "Hi there", result["content"])
+	assert.Equal(t, "end_turn", result["finish_reason"])
+	assert.Equal(t, "msg_1", result["id"])
+	assert.Equal(t, utils.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}, result["usage"])
+}
+
+func TestLLMClient_StreamCollectsToolCalls(t *testing.T) {
+	llm := newStreamingLLM(t, "/chat/completions", []string{
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":""}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"id\":"}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"c-42\"}"}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	})
+	defer llm.Close()
+
+	// Complete collects streamed responses into a single response
+	client := utils.NewLLMClient(utils.OpenAI, "test-key", map[string]interface{}{"base_url": llm.URL})
+	resp, err := client.Complete(t.Context(), utils.LLMRequest{Model: "test-model", Stream: true})
+	require.NoError(t, err)
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	call := resp.Choices[0].Message.ToolCalls[0]
+	assert.Equal(t, "call_1", call.ID)
+	assert.Equal(t, "lookup", call.Function.Name)
+	assert.Equal(t, `{"id":"c-42"}`, call.Function.Arguments)
+	assert.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+}
+
+func TestLLMClient_StreamReportsErrors(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "messages") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+			return
+		}
+		http.Error(w, `{"error":{"message":"bad key"}}`, http.StatusUnauthorized)
+	}))
+	defer llm.Close()
+
+	_, err := utils.NewLLMClient(utils.OpenAI, "bad", map[string]interface{}{"base_url": llm.URL}).
+		Stream(t.Context(), utils.LLMRequest{Model: "test-model"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 401")
+
+	chunks, err := utils.NewLLMClient(utils.Anthropic, "key", map[string]interface{}{"base_url": llm.URL}).
+		Stream(t.Context(), utils.LLMRequest{Model: "test-model"})
+	require.NoError(t, err)
+	_, err = utils.CollectStream(chunks, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Overloaded")
+}
+
+func TestLLMNode_StreamTruncatedAfterDeltas(t *testing.T) {
+	// The primary drops the connection before [DONE], after a delta
+	var primaryRequests, fallbackRequests int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Hel"}}]}`+"\n\n")
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackRequests++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer fallback.Close()
+
+	node, err := runtime.NewLLMNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(map[string]interface{}{
+		"provider": "openai",
+		"api_key":  "test-key",
+		"model":    "test-model",
+		"prompt":   "Say hello",
+		"stream":   true,
+		"options":  map[string]interface{}{"base_url": primary.URL},
+		"retry":    map[string]interface{}{"max_attempts": 3, "initial_delay": "1ms"},
+		"fallbacks": []interface{}{
+			map[string]interface{}{"provider": "openai", "api_key": "test-key", "options": map[string]interface{}{"base_url": fallback.URL}},
+		},
+	})
+
+	// The delta already reached subscribers, so neither a retry nor a
+	// fallback may answer in its place
+	_, err = node.Run(map[string]interface{}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream interrupted after 1 deltas")
+	assert.Contains(t, err.Error(), "stream ended before the end of the response")
+	assert.Equal(t, 1, primaryRequests)
+	assert.Equal(t, 0, fallbackRequests)
+}
+
+func TestLLMNode_StreamDeltasReachSubscribersOnly(t *testing.T) {
+	// Many more deltas than a subscriber channel buffers, sent once the
+	// subscriber is in place
+	const deltaCount = 300
+	subscribed := make(chan struct{})
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-subscribed
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < deltaCount; i++ {
+			fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"%d \"}}]}\n\n", i)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer llm.Close()
+
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{"stream": nodeFlow("llm", map[string]interface{}{
+		"provider": "openai",
+		"api_key":  "test-key",
+		"model":    "test-model",
+		"stream":   true,
+		"options":  map[string]interface{}{"base_url": llm.URL},
+	})})
+
+	executionID, err := flowRuntime.Execute("test-account", "stream", map[string]interface{}{"question": "Count"})
+	require.NoError(t, err)
+	logs, err := flowRuntime.SubscribeToLogs(executionID)
+	require.NoError(t, err)
+	close(subscribed)
+
+	// The subscriber only reads once the execution is done, and still
+	// receives every delta in order
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	var deltas []string
+	for entry := range logs {
+		if entry.Data["event"] == runtime.LLMDeltaEvent {
+			deltas = append(deltas, entry.Data["delta"].(string))
+		}
+	}
+	require.Len(t, deltas, deltaCount)
+	for i, delta := range deltas {
+		assert.Equal(t, fmt.Sprintf("%d ", i), delta)
+	}
+
+	// Deltas are not persisted, the complete response is
+	stored, err := flowRuntime.GetLogs(executionID)
+	require.NoError(t, err)
+	var received bool
+	for _, entry := range stored {
+		assert.NotEqual(t, runtime.LLMDeltaEvent, entry.Data["event"])
+		received = received || entry.Message == "LLM response received"
+	}
+	assert.True(t, received)
+}
@@ -0,0 +1,139 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tcmartin/flowlib"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// InvalidOutputAction is the action of an llm node whose response still does
+// not match its output_schema once the repairs are used up
+const InvalidOutputAction flowlib.Action = "invalid_output"
+
+// defaultMaxRepairs is how often a response not matching the output_schema is
+// sent back to the model for correction
+const defaultMaxRepairs = 2
+
+// outputSchema is the JSON Schema an llm node's response must match
+type outputSchema struct {
+	schema     map[string]interface{}
+	maxRepairs int
+}
+
+// newOutputSchema returns the output_schema of an llm node, or nil when the
+// node has none
+func newOutputSchema(params map[string]interface{}) *outputSchema {
+	schema := utils.NormalizeJSONSchema(params["output_schema"])
+	if schema == nil {
+		return nil
+	}
+	maxRepairs := defaultMaxRepairs
+	switch v := params["max_repairs"].(type) {
+	case int:
+		maxRepairs = v
+	case float64:
+		maxRepairs = int(v)
+	}
+	if maxRepairs < 0 {
+		maxRepairs = 0
+	}
+	return &outputSchema{schema: schema, maxRepairs: maxRepairs}
+}
+
+// validate parses a response as JSON and validates it against the schema,
+// returning the parsed output and the violations found
+func (s *outputSchema) validate(content string) (interface{}, []string) {
+	var output interface{}
+	if err := utils.ParseJSON(content, &output); err != nil {
+		return nil, []string{fmt.Sprintf("$: response is not valid JSON: %v", err)}
+	}
+	return output, utils.ValidateJSONSchema(s.schema, output)
+}
+
+// withOutputSchema asks a model for output matching the schema, with the
+// provider's native JSON schema mode where it has one and through the system
+// prompt otherwise. A response_format set on the node is left alone.
+func withOutputSchema(client *utils.LLMClient, request utils.LLMRequest, schema map[string]interface{}) utils.LLMRequest {
+	if request.Options["response_format"] != nil {
+		return request
+	}
+	if client.Capabilities().JSONMode {
+		request.Options["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "output",
+				"schema": schema,
+			},
+		}
+		return request
+	}
+
+	schemaJSON, _ := json.Marshal(schema)
+	instruction := "Respond only with JSON matching this JSON Schema:\n" + string(schemaJSON)
+
+	// Providers take a single system prompt, so the instruction joins it
+	messages := make([]utils.Message, 0, len(request.Messages)+1)
+	instructed := false
+	for _, message := range request.Messages {
+		if message.Role == "system" && !instructed {
+			message.Content += "\n\n" + instruction
+			instructed = true
+		}
+		messages = append(messages, message)
+	}
+	if !instructed {
+		messages = append([]utils.Message{{Role: "system", Content: instruction}}, messages...)
+	}
+	request.Messages = messages
+	return request
+}
+
+// repairMessages continues a conversation with the model's invalid response
+// and a request to correct it
+func repairMessages(messages []utils.Message, content string, validationErrors []string) []utils.Message {
+	repaired := make([]utils.Message, 0, len(messages)+2)
+	repaired = append(repaired, messages...)
+	return append(repaired,
+		utils.Message{Role: "assistant", Content: content},
+		utils.Message{
+			Role: "user",
+			Content: "Your response does not match the required JSON Schema:\n- " +
+				strings.Join(validationErrors, "\n- ") +
+				"\nRespond again with only the corrected JSON.",
+		},
+	)
+}
+
+// routeOutput routes an llm node by the validation of its output: fields of
+// valid output are placed into the shared context by name, and invalid output
+// takes the invalid_output action, or fails the node when it has none
+func routeOutput(node flowlib.Node, shared interface{}, result interface{}) (flowlib.Action, error) {
+	resultMap, _ := result.(map[string]interface{})
+	valid, checked := resultMap["output_valid"].(bool)
+	if !checked {
+		return flowlib.DefaultAction, nil
+	}
+
+	if !valid {
+		if node.Successors()[InvalidOutputAction] != nil {
+			return InvalidOutputAction, nil
+		}
+		validationErrors, _ := resultMap["validation_errors"].([]string)
+		return "", fmt.Errorf("LLM output does not match output_schema: %s", strings.Join(validationErrors, "; "))
+	}
+
+	if sharedMap, ok := shared.(map[string]interface{}); ok {
+		if fields, ok := resultMap["output"].(map[string]interface{}); ok {
+			for name, value := range fields {
+				// Keys owned by the runtime are never overwritten
+				if !isReservedSharedKey(name) {
+					sharedMap[name] = value
+				}
+			}
+		}
+	}
+	return flowlib.DefaultAction, nil
+}
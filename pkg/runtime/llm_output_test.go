@@ -0,0 +1,190 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// completionWith returns a chat completion answering with content
+func completionWith(content string) string {
+	return `{"id": "chatcmpl-1", "model": "llama3", "choices": [{"index": 0, "message": {"role": "assistant", "content": ` + content + `}, "finish_reason": "stop"}]}`
+}
+
+var invoiceSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"customer", "total"},
+	"properties": map[string]interface{}{
+		"customer": map[string]interface{}{"type": "string", "minLength": 1},
+		"total":    map[string]interface{}{"type": "number", "minimum": 0},
+	},
+	"additionalProperties": false,
+}
+
+func TestLLMNode_OutputSchemaRepair(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		completionWith(`"{\"customer\": \"ACME\"}"`),
+		completionWith(`"`+"```json\\n"+`{\"customer\": \"ACME\", \"total\": 42.5}`+"\\n```"+`"`),
+	)
+
+	node, err := runtime.NewLLMNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(map[string]interface{}{
+		"provider":      "ollama",
+		"model":         "llama3",
+		"prompt":        "Extract the invoice",
+		"output_schema": invoiceSchema,
+		"options":       map[string]interface{}{"base_url": server.URL},
+	})
+
+	shared := map[string]interface{}{}
+	action, err := node.Run(shared)
+	require.NoError(t, err)
+	assert.Equal(t, "default", string(action))
+
+	result := shared["result"].(map[string]interface{})
+	assert.Equal(t, true, result["output_valid"])
+	assert.Equal(t, 1, result["repairs"])
+	assert.Equal(t, map[string]interface{}{"customer": "ACME", "total": 42.5}, result["output"])
+
+	// Validated fields are placed into the shared context by name
+	assert.Equal(t, "ACME", shared["customer"])
+	assert.Equal(t, 42.5, shared["total"])
+
+	// The schema is sent natively, and the repair request carries the errors
+	require.Len(t, *requests, 2)
+	format := (*requests)[0].body["response_format"].(map[string]interface{})
+	assert.Equal(t, "json_schema", format["type"])
+	assert.Equal(t, "object", format["json_schema"].(map[string]interface{})["schema"].(map[string]interface{})["type"])
+
+	messages := (*requests)[1].body["messages"].([]interface{})
+	require.Len(t, messages, 3)
+	assert.Equal(t, "assistant", messages[1].(map[string]interface{})["role"])
+	assert.Contains(t, messages[2].(map[string]interface{})["content"], `$: missing required property "total"`)
+}
+
+func TestLLMNode_OutputSchemaKeepsReservedKeys(t *testing.T) {
+	server, _ := newFakeProvider(t, completionWith(`"{\"customer\": \"ACME\", \"accountID\": \"other-account\", \"_flow_context\": null}"`))
+
+	node, err := runtime.NewLLMNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(map[string]interface{}{
+		"provider":      "ollama",
+		"model":         "llama3",
+		"prompt":        "Extract the invoice",
+		"output_schema": map[string]interface{}{"type": "object"},
+		"options":       map[string]interface{}{"base_url": server.URL},
+	})
+
+	shared := map[string]interface{}{"accountID": "test-account"}
+	_, err = node.Run(shared)
+	require.NoError(t, err)
+
+	// Output fields never replace the keys the runtime owns, such as the
+	// account whose secrets the following nodes read
+	assert.Equal(t, "ACME", shared["customer"])
+	assert.Equal(t, "test-account", shared["accountID"])
+	assert.NotContains(t, shared, "_flow_context")
+}
+
+func TestLLMNode_OutputSchemaWithoutNativeMode(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		`{"id": "msg_1", "model": "claude-test", "stop_reason": "end_turn", "content": [{"type": "text", "text": "{\"customer\": \"ACME\", \"total\": 3}"}]}`,
+	)
+
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider": "anthropic",
+		"api_key":  "test-key",
+		"model":    "claude-test",
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": "You read invoices."},
+			map[string]interface{}{"role": "user", "content": "Extract the invoice"},
+		},
+		"output_schema": invoiceSchema,
+		"options":       map[string]interface{}{"base_url": server.URL},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, true, result["output_valid"])
+
+	// The schema joins the system prompt instead
+	require.Len(t, *requests, 1)
+	system := (*requests)[0].body["system"].(string)
+	assert.Contains(t, system, "You read invoices.")
+	assert.Contains(t, system, "JSON Schema")
+	assert.Nil(t, (*requests)[0].body["response_format"])
+}
+
+func TestLLMNode_InvalidOutputRoute(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"not json"`))
+
+	extract := testNode{Type: "llm", Params: map[string]interface{}{
+		"provider":      "ollama",
+		"model":         "llama3",
+		"prompt":        "Extract the invoice",
+		"max_repairs":   1,
+		"output_schema": map[string]interface{}{"type": "object", "required": []string{"customer"}},
+		"options":       map[string]interface{}{"base_url": server.URL},
+	}}
+	routedExtract := extract
+	routedExtract.Next = map[string]string{"invalid_output": "review"}
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{
+		"routed": {Metadata: map[string]interface{}{"name": "routed"}, Nodes: map[string]testNode{
+			"extract": routedExtract,
+			"review":  {Type: "transform", Params: map[string]interface{}{"script": "return {review: true};"}},
+		}},
+		"unrouted": {Metadata: map[string]interface{}{"name": "unrouted"}, Nodes: map[string]testNode{"extract": extract}},
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "routed", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	assert.Equal(t, map[string]interface{}{"review": true}, status.Results["result"])
+	assert.Len(t, *requests, 2)
+
+	// Without an invalid_output route the node fails
+	executionID, err = flowRuntime.Execute("test-account", "unrouted", map[string]interface{}{})
+	require.NoError(t, err)
+	status = waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "does not match output_schema")
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"id", "tags"},
+		"properties": map[string]interface{}{
+			"id":     map[string]interface{}{"type": "integer"},
+			"status": map[string]interface{}{"enum": []interface{}{"open", "closed"}},
+			"tags": map[string]interface{}{
+				"type":     "array",
+				"minItems": 1,
+				"items":    map[string]interface{}{"type": "string", "pattern": "^[a-z]+$"},
+			},
+			"owner": map[string]interface{}{"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "null"},
+			}},
+		},
+	}
+
+	assert.Empty(t, utils.ValidateJSONSchema(schema, map[string]interface{}{
+		"id": 7.0, "status": "open", "tags": []interface{}{"a"}, "owner": nil,
+	}))
+	assert.Equal(t, []string{
+		"$.id: expected integer, got number",
+		"$.owner: must match at least one of the anyOf schemas",
+		"$.status: must be one of [\"open\",\"closed\"]",
+		"$.tags[1]: must match pattern \"^[a-z]+$\"",
+	}, utils.ValidateJSONSchema(schema, map[string]interface{}{
+		"id": 7.5, "status": "done", "tags": []interface{}{"a", "B"}, "owner": 1.0,
+	}))
+	assert.Equal(t, []string{
+		`$: missing required property "id"`,
+		"$.tags: expected array, got string",
+	}, utils.ValidateJSONSchema(schema, map[string]interface{}{"tags": "a"}))
+}
@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// llmProviderSettings are the provider settings of an llm or agent node
+type llmProviderSettings struct {
+	provider utils.LLMProvider
+	config   utils.LLMProviderConfig
+}
+
+// newLLMClient creates the LLM client for the provider settings in node params.
+//
+// Settings can be kept per account in a structured secret named by the
+// provider_secret param, holding provider, api_key (or key), base_url,
+// default_model and provider specific options. Params override the secret:
+// provider, api_key, and options including base_url and default_model.
+func newLLMClient(params map[string]interface{}, input interface{}) (*utils.LLMClient, error) {
+	settings, err := resolveLLMProvider(params, input)
+	if err != nil {
+		return nil, err
+	}
+	return settings.client()
+}
+
+// resolveLLMProvider returns the provider settings of node params without
+// creating a client
+func resolveLLMProvider(params map[string]interface{}, input interface{}) (llmProviderSettings, error) {
+	settings := llmProviderSettings{config: utils.LLMProviderConfig{Options: map[string]interface{}{}}}
+
+	if secretKey, ok := params["provider_secret"].(string); ok && secretKey != "" {
+		values, err := loadProviderSecret(secretKey, toolEnvironmentFrom(input))
+		if err != nil {
+			return settings, err
+		}
+		settings.apply(values)
+	}
+
+	overrides := map[string]interface{}{}
+	for _, key := range []string{"provider", "api_key"} {
+		if value, ok := params[key]; ok {
+			overrides[key] = value
+		}
+	}
+	if options, ok := params["options"].(map[string]interface{}); ok {
+		for k, v := range options {
+			overrides[k] = v
+		}
+	}
+	settings.apply(overrides)
+
+	if settings.provider == "" {
+		settings.provider = utils.OpenAI // Default to OpenAI
+	}
+	if !utils.IsLLMProviderRegistered(settings.provider) {
+		// Unknown providers with an endpoint are treated as OpenAI compatible
+		if settings.config.BaseURL == "" {
+			return settings, fmt.Errorf("unknown LLM provider %q, registered providers: %v", settings.provider, utils.LLMProviders())
+		}
+		settings.provider = utils.Generic
+	}
+	return settings, nil
+}
+
+// client creates the LLM client for the settings
+func (s llmProviderSettings) client() (*utils.LLMClient, error) {
+	return utils.NewLLMClientWithConfig(s.provider, s.config)
+}
+
+// endpoint identifies the service the settings address, so that providers
+// served from several endpoints are told apart
+func (s llmProviderSettings) endpoint() string {
+	if s.config.BaseURL == "" {
+		return string(s.provider)
+	}
+	return fmt.Sprintf("%s %s", s.provider, s.config.BaseURL)
+}
+
+// breakerKey identifies the endpoint and the credential the settings send
+// requests with, so that the rate limits and failures of one account's key
+// do not open the circuit breaker of others. Credentials are hashed.
+func (s llmProviderSettings) breakerKey() string {
+	accessKey, _ := s.config.Options["access_key_id"].(string)
+	if s.config.APIKey == "" && accessKey == "" {
+		return s.endpoint()
+	}
+	credential := sha256.Sum256([]byte(s.config.APIKey + "\x00" + accessKey))
+	return s.endpoint() + " " + hex.EncodeToString(credential[:8])
+}
+
+// apply sets the provider settings found in values. Keys other than the
+// common settings become provider options.
+func (s *llmProviderSettings) apply(values map[string]interface{}) {
+	for key, value := range values {
+		str, _ := value.(string)
+		switch key {
+		case "provider":
+			s.provider = utils.LLMProvider(str)
+		case "api_key", "key":
+			s.config.APIKey = str
+		case "base_url":
+			s.config.BaseURL = str
+		case "default_model":
+			s.config.DefaultModel = str
+		case "options":
+			if options, ok := value.(map[string]interface{}); ok {
+				for k, v := range options {
+					s.config.Options[k] = v
+				}
+			}
+		default:
+			s.config.Options[key] = value
+		}
+	}
+}
+
+// loadProviderSecret reads the provider settings stored in an account secret
+func loadProviderSecret(key string, env *toolEnvironment) (map[string]interface{}, error) {
+	if env == nil || env.runtime == nil || env.runtime.secretVault == nil || env.execCtx == nil {
+		return nil, fmt.Errorf("provider_secret %q requires a flow execution with a secret vault", key)
+	}
+	accountID := env.execCtx.accountID
+
+	var value string
+	if vault, ok := env.runtime.secretVault.(auth.ExtendedSecretVault); ok {
+		secret, err := vault.GetStructured(accountID, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load provider_secret %q: %w", key, err)
+		}
+		value = secret.Value
+		vault.MarkUsed(accountID, key)
+	} else {
+		var err error
+		if value, err = env.runtime.secretVault.Get(accountID, key); err != nil {
+			return nil, fmt.Errorf("failed to load provider_secret %q: %w", key, err)
+		}
+	}
+
+	// A plain secret holds just the API key
+	values := map[string]interface{}{}
+	if json.Unmarshal([]byte(value), &values) != nil {
+		values = map[string]interface{}{"api_key": value}
+	}
+	return values, nil
+}
@@ -0,0 +1,297 @@
+package runtime_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/services"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// recordedRequest is a request received by a fake provider
+type recordedRequest struct {
+	path    string
+	query   string
+	headers http.Header
+	body    map[string]interface{}
+}
+
+// newFakeProvider returns a server recording requests and answering with
+// the given JSON responses in turn
+func newFakeProvider(t *testing.T, responses ...string) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, recordedRequest{path: r.URL.Path, query: r.URL.RawQuery, headers: r.Header, body: body})
+
+		response := responses[len(responses)-1]
+		if len(requests) <= len(responses) {
+			response = responses[len(requests)-1]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// runLLMNode runs an llm node with the given params outside of a flow
+func runLLMNode(t *testing.T, params map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := runtime.NewLLMNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(params)
+
+	shared := map[string]interface{}{}
+	if _, err := node.Run(shared); err != nil {
+		return nil, err
+	}
+	return shared["result"].(map[string]interface{}), nil
+}
+
+const chatCompletion = `{"id": "chatcmpl-1", "model": "served-model", "choices": [{"index": 0, "message": {"role": "assistant", "content": "pong"}, "finish_reason": "stop"}]}`
+
+// fakeBackend answers every request with the name of the requested model
+type fakeBackend struct {
+	capabilities utils.LLMCapabilities
+}
+
+func (b *fakeBackend) Capabilities() utils.LLMCapabilities { return b.capabilities }
+
+func (b *fakeBackend) Complete(ctx context.Context, request utils.LLMRequest) (*utils.LLMResponse, error) {
+	return &utils.LLMResponse{Model: request.Model, Choices: []utils.Choice{{
+		Message:      utils.Message{Role: "assistant", Content: "model " + request.Model},
+		FinishReason: "stop",
+	}}}, nil
+}
+
+func (b *fakeBackend) Stream(ctx context.Context, request utils.LLMRequest) (<-chan utils.LLMStreamChunk, error) {
+	return nil, fmt.Errorf("not streaming")
+}
+
+func TestLLMNode_RegisteredProvider(t *testing.T) {
+	utils.RegisterLLMProvider("fake-test", func(config utils.LLMProviderConfig) (utils.LLMBackend, error) {
+		return &fakeBackend{}, nil
+	})
+	assert.Contains(t, utils.LLMProviders(), utils.LLMProvider("fake-test"))
+
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider": "fake-test",
+		"model":    "tiny",
+		"prompt":   "ping",
+		"stream":   true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "model tiny", result["content"])
+
+	// Capabilities the provider lacks are rejected before any request
+	_, err = runLLMNode(t, map[string]interface{}{
+		"provider": "fake-test",
+		"model":    "tiny",
+		"prompt":   "ping",
+		"tools": []interface{}{map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": "lookup"},
+		}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not support tools")
+
+	_, err = runLLMNode(t, map[string]interface{}{"provider": "no-such-provider", "model": "x", "prompt": "ping"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown LLM provider "no-such-provider"`)
+
+	_, err = runLLMNode(t, map[string]interface{}{"provider": "openai", "model": "x", "prompt": "ping"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "openai provider requires an api_key")
+}
+
+func TestLLMNode_OpenAICompatibleProviders(t *testing.T) {
+	server, requests := newFakeProvider(t, chatCompletion)
+
+	// Local servers run without a key; the model defaults from the options
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider": "ollama",
+		"prompt":   "ping",
+		"options":  map[string]interface{}{"base_url": server.URL + "/v1", "default_model": "llama3"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pong", result["content"])
+	assert.Equal(t, "/v1/chat/completions", (*requests)[0].path)
+	assert.Equal(t, "llama3", (*requests)[0].body["model"])
+	assert.Empty(t, (*requests)[0].headers.Get("Authorization"))
+	assert.NotContains(t, (*requests)[0].body, "default_model")
+
+	// Azure addresses deployments and authenticates with an api-key header
+	_, err = runLLMNode(t, map[string]interface{}{
+		"provider": "azure",
+		"api_key":  "azure-key",
+		"model":    "gpt-4o",
+		"prompt":   "ping",
+		"options":  map[string]interface{}{"base_url": server.URL, "deployment": "prod-gpt", "api_version": "2024-06-01"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/openai/deployments/prod-gpt/chat/completions", (*requests)[1].path)
+	assert.Equal(t, "api-version=2024-06-01", (*requests)[1].query)
+	assert.Equal(t, "azure-key", (*requests)[1].headers.Get("api-key"))
+	assert.NotContains(t, (*requests)[1].body, "deployment")
+}
+
+func TestLLMNode_GeminiProvider(t *testing.T) {
+	server, requests := newFakeProvider(t, `{
+		"responseId": "resp-1",
+		"modelVersion": "gemini-test-001",
+		"candidates": [{"content": {"role": "model", "parts": [
+			{"text": "Looking it up"},
+			{"functionCall": {"name": "lookup", "args": {"id": "c-42"}}}
+		]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 4, "candidatesTokenCount": 6, "totalTokenCount": 10}
+	}`)
+
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider": "gemini",
+		"api_key":  "gemini-key",
+		"model":    "gemini-test",
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": "Be brief"},
+			map[string]interface{}{"role": "user", "content": "Find c-42"},
+		},
+		"tools": []interface{}{map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": "lookup", "parameters": map[string]interface{}{"type": "object"}},
+		}},
+		"response_format": map[string]interface{}{"type": "json_object"},
+		"options":         map[string]interface{}{"base_url": server.URL},
+	})
+	require.NoError(t, err)
+
+	request := (*requests)[0]
+	assert.Equal(t, "/models/gemini-test:generateContent", request.path)
+	assert.Equal(t, "gemini-key", request.headers.Get("x-goog-api-key"))
+	assert.Equal(t, "Be brief", request.body["systemInstruction"].(map[string]interface{})["parts"].([]interface{})[0].(map[string]interface{})["text"])
+	assert.Equal(t, "application/json", request.body["generationConfig"].(map[string]interface{})["responseMimeType"])
+	assert.Len(t, request.body["tools"].([]interface{})[0].(map[string]interface{})["functionDeclarations"], 1)
+
+	assert.Equal(t, "Looking it up", result["content"])
+	assert.Equal(t, "tool_calls", result["finish_reason"])
+	assert.Equal(t, utils.Usage{PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10}, result["usage"])
+	toolCalls := result["tool_calls"].([]utils.ToolCall)
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "lookup", toolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"id": "c-42"}`, toolCalls[0].Function.Arguments)
+}
+
+func TestLLMNode_BedrockProvider(t *testing.T) {
+	server, requests := newFakeProvider(t, `{
+		"output": {"message": {"role": "assistant", "content": [{"text": "pong"}]}},
+		"stopReason": "end_turn",
+		"usage": {"inputTokens": 3, "outputTokens": 1, "totalTokens": 4}
+	}`)
+
+	result, err := runLLMNode(t, map[string]interface{}{
+		"provider": "bedrock",
+		"model":    "anthropic.claude-test",
+		"prompt":   "ping",
+		"options": map[string]interface{}{
+			"base_url":          server.URL,
+			"region":            "eu-west-1",
+			"access_key_id":     "AKIDEXAMPLE",
+			"secret_access_key": "secret",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pong", result["content"])
+	assert.Equal(t, "stop", result["finish_reason"])
+
+	request := (*requests)[0]
+	assert.Equal(t, "/model/anthropic.claude-test/converse", request.path)
+	authorization := request.headers.Get("Authorization")
+	assert.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), authorization)
+	assert.Contains(t, authorization, "/eu-west-1/bedrock/aws4_request")
+	assert.NotContains(t, request.body, "additionalModelRequestFields")
+	assert.Equal(t, "ping", request.body["messages"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["text"])
+}
+
+func TestAgentNode_AnthropicToolUse(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		`{"id": "msg_1", "model": "claude-test", "stop_reason": "tool_use", "content": [
+			{"type": "tool_use", "id": "toolu_1", "name": "double", "input": {"value": 21}}
+		]}`,
+		`{"id": "msg_2", "model": "claude-test", "stop_reason": "end_turn", "content": [{"type": "text", "text": "42"}]}`,
+	)
+
+	node, err := runtime.NewAgentNodeWrapper(nil)
+	require.NoError(t, err)
+	node.SetParams(map[string]interface{}{
+		"provider": "anthropic",
+		"api_key":  "test-key",
+		"model":    "claude-test",
+		"prompt":   "Double 21",
+		"options":  map[string]interface{}{"base_url": server.URL},
+		"tools": []interface{}{map[string]interface{}{
+			"function": map[string]interface{}{"name": "double", "parameters": map[string]interface{}{"type": "object"}},
+			"script":   "return {doubled: args.value * 2};",
+		}},
+	})
+
+	shared := map[string]interface{}{}
+	_, err = node.Run(shared)
+	require.NoError(t, err)
+	assert.Equal(t, "42", shared["result"].(map[string]interface{})["response"])
+
+	// The tool result is sent back as a tool_result block
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "/messages", (*requests)[0].path)
+	assert.Equal(t, "double", (*requests)[0].body["tools"].([]interface{})[0].(map[string]interface{})["name"])
+	messages := (*requests)[1].body["messages"].([]interface{})
+	toolResult := messages[len(messages)-1].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "tool_result", toolResult["type"])
+	assert.Equal(t, "toolu_1", toolResult["tool_use_id"])
+	assert.JSONEq(t, `{"doubled": 42}`, toolResult["content"].(string))
+}
+
+func TestLLMNode_ProviderSecret(t *testing.T) {
+	server, requests := newFakeProvider(t, chatCompletion)
+
+	memoryProvider := storage.NewMemoryProvider()
+	encKey, err := services.GenerateEncryptionKey()
+	require.NoError(t, err)
+	vault, err := services.NewExtendedSecretVaultService(memoryProvider.GetSecretStore(), encKey)
+	require.NoError(t, err)
+	require.NoError(t, vault.SetCustom("test-account", "local-llm", map[string]interface{}{
+		"provider":      "llamacpp",
+		"base_url":      server.URL,
+		"default_model": "qwen-7b",
+		"api_key":       "local-key",
+	}, auth.SecretMetadata{Description: "Local model server"}))
+
+	flowRuntime := newCoreRuntime(t, vault, map[string]testFlow{"ask": nodeFlow("llm", map[string]interface{}{
+		"provider_secret": "local-llm",
+		"prompt":          "ping",
+	})})
+	executionID, err := flowRuntime.Execute("test-account", "ask", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	require.Len(t, *requests, 1)
+	assert.Equal(t, "/chat/completions", (*requests)[0].path)
+	assert.Equal(t, "qwen-7b", (*requests)[0].body["model"])
+	assert.Equal(t, "Bearer local-key", (*requests)[0].headers.Get("Authorization"))
+
+	secret, err := vault.GetStructured("test-account", "local-llm")
+	require.NoError(t, err)
+	assert.NotNil(t, secret.Metadata.LastUsed)
+}
@@ -3,7 +3,8 @@ package runtime
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
+	"io"
+	"os"
 	"time"
 
 	"github.com/robertkrimen/otto"
@@ -107,7 +108,7 @@ func (w *NodeWrapper) Run(shared interface{}) (flowlib.Action, error) {
 				
 				for key, value := range sharedMap {
 					// Skip internal flow context keys
-					if !strings.HasPrefix(key, "_") && key != "accountID" {
+					if !isReservedSharedKey(key) {
 						flowContext.SetSharedData(key, value)
 					}
 				}
@@ -178,12 +179,25 @@ func (w *NodeWrapper) Run(shared interface{}) (flowlib.Action, error) {
 			}
 		}
 
+		// Nodes calling back into the execution (agent tools) need its environment
+		if sharedMap, ok := shared.(map[string]interface{}); ok {
+			if env, ok := sharedMap[toolEnvironmentKey]; ok {
+				combinedInput[toolEnvironmentKey] = env
+			}
+		}
+
 		// Execute the function
 		result, err := w.exec(combinedInput)
 		if err != nil {
 			return "", err
 		}
 
+		// Byte contents of the result are stored as artifacts, so that the
+		// shared context carries references to them
+		if result, err = externalizeArtifacts(toolEnvironmentFrom(combinedInput), result); err != nil {
+			return "", err
+		}
+
 		// Store the result in the shared context if it's a map
 		if sharedMap, ok := shared.(map[string]interface{}); ok {
 			// Store the result with a type-specific key
@@ -232,6 +246,19 @@ func (w *NodeWrapper) Run(shared interface{}) (flowlib.Action, error) {
 	return w.node.Run(shared)
 }
 
+// combinedParams returns the params of a node's combined input
+func combinedParams(input interface{}) (map[string]interface{}, error) {
+	combinedInput, ok := input.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected map[string]interface{}, got %T", input)
+	}
+	params, ok := combinedInput["params"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected params to be map[string]interface{}")
+	}
+	return params, nil
+}
+
 // NewHTTPRequestNodeWrapper creates a new HTTP request node wrapper
 func NewHTTPRequestNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
 	// Create the base node
@@ -361,10 +388,11 @@ func NewHTTPRequestNodeWrapper(params map[string]interface{}) (flowlib.Node, err
 				timeout = time.Duration(timeoutNum * float64(time.Second))
 			}
 
-			// Extract authentication
-			var auth map[string]interface{}
-			if authParam, ok := params["auth"].(map[string]interface{}); ok {
-				auth = authParam
+			// Extract authentication; an OAuth secret provides a bearer
+			// token, renewed when it expires
+			auth, err := requestAuth(params, toolEnvironmentFrom(input))
+			if err != nil {
+				return nil, err
 			}
 
 			// Handle specific auth types
@@ -404,22 +432,85 @@ func NewHTTPRequestNodeWrapper(params map[string]interface{}) (flowlib.Node, err
 				followRedirects = followParam
 			}
 
-			// Create HTTP request
-			httpRequest := &utils.HTTPRequest{
-				URL:            url,
-				Method:         method,
-				Headers:        headers,
-				Body:           body,
-				Timeout:        timeout,
-				Auth:           auth,
-				FollowRedirect: followRedirects,
-			}
-
-			// Execute request
-			resp, err := httpClient.Do(httpRequest)
+			pagination, err := parseHTTPPagination(params["pagination"])
 			if err != nil {
 				return nil, err
 			}
+			extract := mapParam(params["extract"])
+			var download *httpDownload
+			if downloadParam, ok := params["download"]; ok {
+				if download, err = parseHTTPDownload(downloadParam); err != nil {
+					return nil, err
+				}
+				if pagination != nil || extract != nil {
+					return nil, fmt.Errorf("download cannot be combined with pagination or extract")
+				}
+			}
+
+			// send executes the request for a URL; a credential secret
+			// provides the API key, base URL and rate limit of every page
+			send := func(requestURL string, bodyWriter io.Writer) (*utils.HTTPResponse, error) {
+				var redirectOrigin string
+				if secretKey, ok := params["credential"].(string); ok && secretKey != "" {
+					resolvedURL, origin, err := applyCredential(secretKey, toolEnvironmentFrom(input), requestURL, headers)
+					if err != nil {
+						return nil, err
+					}
+					requestURL, redirectOrigin = resolvedURL, origin
+				}
+				return httpClient.Do(&utils.HTTPRequest{
+					URL:            requestURL,
+					Method:         method,
+					Headers:        headers,
+					Body:           body,
+					Timeout:        timeout,
+					Auth:           auth,
+					FollowRedirect: followRedirects,
+					BodyWriter:     bodyWriter,
+					RedirectOrigin: redirectOrigin,
+				})
+			}
+
+			// Execute request, following the pages or streaming the body
+			// to a file when asked to
+			var resp *utils.HTTPResponse
+			var pages *paginationResult
+			var downloaded map[string]interface{}
+			switch {
+			case pagination != nil:
+				pages, err = pagination.fetch(url, func(pageURL string) (*utils.HTTPResponse, error) {
+					return send(pageURL, nil)
+				})
+				if err != nil {
+					return nil, err
+				}
+				resp = pages.response
+			case download != nil:
+				file, err := download.file(toolEnvironmentFrom(input))
+				if err != nil {
+					return nil, err
+				}
+				resp, err = send(url, file)
+				closeErr := file.Close()
+				if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+					err = closeErr
+					if err == nil {
+						contentType, _ := resp.Metadata["content_type"].(string)
+						downloaded, err = download.finish(file.Name(), url, contentType, toolEnvironmentFrom(input))
+					}
+				}
+				if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+					os.Remove(file.Name())
+				}
+				if err != nil {
+					return nil, err
+				}
+			default:
+				resp, err = send(url, nil)
+				if err != nil {
+					return nil, err
+				}
+			}
 
 			// Return response
 			result := map[string]interface{}{
@@ -438,6 +529,23 @@ func NewHTTPRequestNodeWrapper(params map[string]interface{}) (flowlib.Node, err
 				}
 			}
 
+			if pages != nil {
+				result["items"] = pages.items
+				result["pages"] = pages.pages
+				result["truncated"] = pages.truncated
+			}
+			if written, ok := resp.Metadata["bytes_written"].(int64); ok && downloaded != nil {
+				downloaded["bytes"] = written
+				result["download"] = downloaded
+			}
+			if extract != nil {
+				extracted, err := extractResponseFields(httpResponseData(resp), extract)
+				if err != nil {
+					return nil, err
+				}
+				result["extracted"] = extracted
+			}
+
 			return result, nil
 		},
 		post: func(shared, p, e interface{}) (flowlib.Action, error) {
@@ -447,16 +555,10 @@ func NewHTTPRequestNodeWrapper(params map[string]interface{}) (flowlib.Node, err
 				return flowlib.DefaultAction, nil
 			}
 
-			// Check if we should route based on status code
+			// Route on the status code, to the most specific action the
+			// node has a successor for
 			if statusCode, ok := result["status_code"].(int); ok {
-				// Route based on status code range
-				if statusCode >= 200 && statusCode < 300 {
-					return "success", nil
-				} else if statusCode >= 400 && statusCode < 500 {
-					return "client_error", nil
-				} else if statusCode >= 500 {
-					return "server_error", nil
-				}
+				return httpStatusAction(statusCode, baseNode.Successors()), nil
 			}
 
 			return flowlib.DefaultAction, nil
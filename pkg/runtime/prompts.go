@@ -0,0 +1,344 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// ErrPromptNotFound is returned for prompt names, versions and tags that are
+// not stored
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// ErrPromptVersionExists is returned when creating a prompt version that
+// is already stored, such as one numbered by another writer at the same time
+var ErrPromptVersionExists = errors.New("prompt version already exists")
+
+// ErrInvalidPrompt is returned for prompts, names and tags that are rejected
+var ErrInvalidPrompt = errors.New("invalid prompt")
+
+// LatestPromptTag selects the highest version of a prompt
+const LatestPromptTag = "latest"
+
+// maxPromptCreates bounds the attempts to number a new prompt version when
+// other writers take the numbers first
+const maxPromptCreates = 5
+
+// promptName matches the names of prompts and their tags
+var promptName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// PromptMessage is a message template of a prompt
+type PromptMessage struct {
+	Role     string `json:"role"`
+	Template string `json:"template"`
+}
+
+// Prompt is a version of a prompt template of an account. Versions are
+// immutable once created, except for their tags.
+type Prompt struct {
+	AccountID   string          `json:"account_id"`
+	Name        string          `json:"name"`
+	Version     int             `json:"version"`
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+
+	// Variables are the variables the message templates use
+	Variables []string `json:"variables,omitempty"`
+
+	// Tags name the version, e.g. "production"; a tag is on at most one
+	// version of a prompt
+	Tags []string `json:"tags,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PromptStore persists prompt versions
+type PromptStore interface {
+	// CreatePromptVersion stores a new version of a prompt, or returns
+	// ErrPromptVersionExists when the version is already stored
+	CreatePromptVersion(prompt Prompt) error
+	// SavePrompt replaces a stored version, e.g. to change its tags
+	SavePrompt(prompt Prompt) error
+	GetPrompt(accountID, name string, version int) (Prompt, error)
+	ListPromptVersions(accountID, name string) ([]Prompt, error)
+	ListPrompts(accountID string) ([]Prompt, error)
+	DeletePrompt(accountID, name string) error
+}
+
+// ParsePromptRef splits a reference of the form name, name@version or
+// name@tag into the name and the version or tag, which is empty when not
+// given
+func ParsePromptRef(ref string) (name, selector string) {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// SetPromptStore sets where the runtime keeps prompt templates
+func (r *flowRuntime) SetPromptStore(store PromptStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.promptStore = store
+}
+
+func (r *flowRuntime) prompts() (PromptStore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.promptStore == nil {
+		return nil, fmt.Errorf("prompt library is not configured")
+	}
+	return r.promptStore, nil
+}
+
+// CreatePrompt stores a new version of a prompt, numbered after the latest
+// one; the number is taken again when another writer stored it first. The
+// tags of the new version are moved from older versions.
+func (r *flowRuntime) CreatePrompt(accountID string, prompt Prompt) (Prompt, error) {
+	store, err := r.prompts()
+	if err != nil {
+		return Prompt{}, err
+	}
+	if !promptName.MatchString(prompt.Name) {
+		return Prompt{}, fmt.Errorf("%w: invalid name %q", ErrInvalidPrompt, prompt.Name)
+	}
+	for _, tag := range prompt.Tags {
+		if err := validatePromptTag(tag); err != nil {
+			return Prompt{}, err
+		}
+	}
+	if len(prompt.Messages) == 0 {
+		return Prompt{}, fmt.Errorf("%w: at least one message is required", ErrInvalidPrompt)
+	}
+
+	// Templates are checked now rather than when a flow renders them
+	var variables []string
+	seen := make(map[string]bool)
+	for i, message := range prompt.Messages {
+		if message.Role == "" {
+			return Prompt{}, fmt.Errorf("%w: message %d requires a role", ErrInvalidPrompt, i)
+		}
+		if _, err := utils.NewPromptTemplate(message.Template); err != nil {
+			return Prompt{}, fmt.Errorf("%w: message %d: %v", ErrInvalidPrompt, i, err)
+		}
+		for _, variable := range utils.ParseVariables(message.Template) {
+			if !seen[variable] {
+				seen[variable] = true
+				variables = append(variables, variable)
+			}
+		}
+	}
+
+	prompt.AccountID = accountID
+	prompt.Variables = variables
+	prompt.Tags = uniqueTags(prompt.Tags)
+
+	r.promptsMu.Lock()
+	defer r.promptsMu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		versions, err := store.ListPromptVersions(accountID, prompt.Name)
+		if err != nil {
+			return Prompt{}, err
+		}
+		prompt.Version = 1
+		if len(versions) > 0 {
+			prompt.Version = versions[len(versions)-1].Version + 1
+		}
+		prompt.CreatedAt = time.Now()
+
+		err = store.CreatePromptVersion(prompt)
+		if errors.Is(err, ErrPromptVersionExists) && attempt < maxPromptCreates {
+			continue
+		}
+		if err != nil {
+			return Prompt{}, fmt.Errorf("failed to create version %d of prompt %s: %w", prompt.Version, prompt.Name, err)
+		}
+
+		if err := untagPromptVersions(store, versions, prompt.Tags); err != nil {
+			return Prompt{}, err
+		}
+		return prompt, nil
+	}
+}
+
+// GetPrompt returns the prompt version a reference of the form name,
+// name@version, name@tag or name@latest selects
+func (r *flowRuntime) GetPrompt(accountID, ref string) (Prompt, error) {
+	store, err := r.prompts()
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	name, selector := ParsePromptRef(ref)
+	if version, err := strconv.Atoi(selector); err == nil {
+		return store.GetPrompt(accountID, name, version)
+	}
+	versions, err := store.ListPromptVersions(accountID, name)
+	if err != nil {
+		return Prompt{}, err
+	}
+	if len(versions) == 0 {
+		return Prompt{}, ErrPromptNotFound
+	}
+	if selector == "" || selector == LatestPromptTag {
+		return versions[len(versions)-1], nil
+	}
+	for _, version := range versions {
+		for _, tag := range version.Tags {
+			if tag == selector {
+				return version, nil
+			}
+		}
+	}
+	return Prompt{}, ErrPromptNotFound
+}
+
+// ListPrompts returns the latest version of each prompt of an account
+func (r *flowRuntime) ListPrompts(accountID string) ([]Prompt, error) {
+	store, err := r.prompts()
+	if err != nil {
+		return nil, err
+	}
+	all, err := store.ListPrompts(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]Prompt)
+	for _, prompt := range all {
+		if current, ok := latest[prompt.Name]; !ok || prompt.Version > current.Version {
+			latest[prompt.Name] = prompt
+		}
+	}
+	prompts := make([]Prompt, 0, len(latest))
+	for _, prompt := range latest {
+		prompts = append(prompts, prompt)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts, nil
+}
+
+// ListPromptVersions returns the versions of a prompt, oldest first
+func (r *flowRuntime) ListPromptVersions(accountID, name string) ([]Prompt, error) {
+	store, err := r.prompts()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := store.ListPromptVersions(accountID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrPromptNotFound
+	}
+	return versions, nil
+}
+
+// TagPrompt puts a tag on a version of a prompt, moving it from the version
+// it was on
+func (r *flowRuntime) TagPrompt(accountID, name string, version int, tag string) (Prompt, error) {
+	store, err := r.prompts()
+	if err != nil {
+		return Prompt{}, err
+	}
+	if err := validatePromptTag(tag); err != nil {
+		return Prompt{}, err
+	}
+
+	r.promptsMu.Lock()
+	defer r.promptsMu.Unlock()
+
+	prompt, err := store.GetPrompt(accountID, name, version)
+	if err != nil {
+		return Prompt{}, err
+	}
+	versions, err := store.ListPromptVersions(accountID, name)
+	if err != nil {
+		return Prompt{}, err
+	}
+	if err := untagPromptVersions(store, versions, []string{tag}); err != nil {
+		return Prompt{}, err
+	}
+	prompt.Tags = uniqueTags(append(prompt.Tags, tag))
+	if err := store.SavePrompt(prompt); err != nil {
+		return Prompt{}, err
+	}
+	return prompt, nil
+}
+
+// DeletePrompt removes all versions of a prompt
+func (r *flowRuntime) DeletePrompt(accountID, name string) error {
+	store, err := r.prompts()
+	if err != nil {
+		return err
+	}
+	return store.DeletePrompt(accountID, name)
+}
+
+// validatePromptTag rejects tags that could be taken for a version
+func validatePromptTag(tag string) error {
+	if !promptName.MatchString(tag) {
+		return fmt.Errorf("%w: invalid tag %q", ErrInvalidPrompt, tag)
+	}
+	if _, err := strconv.Atoi(tag); err == nil || tag == LatestPromptTag {
+		return fmt.Errorf("%w: tag %q is reserved", ErrInvalidPrompt, tag)
+	}
+	return nil
+}
+
+// uniqueTags returns tags without duplicates, in order
+func uniqueTags(tags []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	return unique
+}
+
+// untagPromptVersions removes tags from the versions carrying them
+func untagPromptVersions(store PromptStore, versions []Prompt, tags []string) error {
+	moved := make(map[string]bool)
+	for _, tag := range tags {
+		moved[tag] = true
+	}
+	for _, version := range versions {
+		kept := version.Tags[:0:0]
+		for _, tag := range version.Tags {
+			if !moved[tag] {
+				kept = append(kept, tag)
+			}
+		}
+		if len(kept) == len(version.Tags) {
+			continue
+		}
+		version.Tags = kept
+		if err := store.SavePrompt(version); err != nil {
+			return fmt.Errorf("failed to move tags from version %d: %w", version.Version, err)
+		}
+	}
+	return nil
+}
+
+// loadPrompt returns the prompt a template_ref of the running execution's
+// account selects
+func (e *toolEnvironment) loadPrompt(ref string) (Prompt, error) {
+	if e == nil || e.runtime == nil || e.execCtx == nil {
+		return Prompt{}, fmt.Errorf("template_ref requires a flow execution")
+	}
+	prompt, err := e.runtime.GetPrompt(e.execCtx.accountID, ref)
+	if err != nil {
+		return Prompt{}, fmt.Errorf("failed to load prompt %s: %w", ref, err)
+	}
+	return prompt, nil
+}
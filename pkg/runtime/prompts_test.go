@@ -0,0 +1,184 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// newPromptRuntime returns a runtime with an in-memory prompt library
+// running an llm flow "greet" that renders the prompt ref
+func newPromptRuntime(t *testing.T, baseURL, ref string) runtime.PromptFlowRuntime {
+	t.Helper()
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{"greet": nodeFlow("llm", map[string]interface{}{
+		"provider":     "ollama",
+		"model":        "llama3",
+		"template_ref": ref,
+		"variables":    map[string]interface{}{"tone": "cheerful"},
+		"options":      map[string]interface{}{"base_url": baseURL},
+	})})
+	prompting, ok := flowRuntime.(runtime.PromptFlowRuntime)
+	require.True(t, ok)
+	prompting.SetPromptStore(storage.NewMemoryPromptStore())
+	return prompting
+}
+
+func TestPromptLibrary_VersionsAndTags(t *testing.T) {
+	flowRuntime := newPromptRuntime(t, "http://localhost", "greeting")
+
+	v1, err := flowRuntime.CreatePrompt("test-account", runtime.Prompt{
+		Name:     "greeting",
+		Messages: []runtime.PromptMessage{{Role: "user", Template: "Hello {{.name}}"}},
+		Tags:     []string{"production"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, []string{"name"}, v1.Variables)
+
+	v2, err := flowRuntime.CreatePrompt("test-account", runtime.Prompt{
+		Name: "greeting",
+		Messages: []runtime.PromptMessage{
+			{Role: "system", Template: "Be {{.tone}}."},
+			{Role: "user", Template: "Hello {{.name}}"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+	assert.Equal(t, []string{"tone", "name"}, v2.Variables)
+
+	// References select by version, tag or latest
+	for ref, version := range map[string]int{
+		"greeting":            2,
+		"greeting@latest":     2,
+		"greeting@1":          1,
+		"greeting@production": 1,
+	} {
+		prompt, err := flowRuntime.GetPrompt("test-account", ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, version, prompt.Version, ref)
+	}
+
+	// Tagging moves the tag to the new version
+	_, err = flowRuntime.TagPrompt("test-account", "greeting", 2, "production")
+	require.NoError(t, err)
+	prompt, err := flowRuntime.GetPrompt("test-account", "greeting@production")
+	require.NoError(t, err)
+	assert.Equal(t, 2, prompt.Version)
+	prompt, err = flowRuntime.GetPrompt("test-account", "greeting@1")
+	require.NoError(t, err)
+	assert.Empty(t, prompt.Tags)
+
+	// Prompts belong to their account
+	_, err = flowRuntime.GetPrompt("other-account", "greeting")
+	assert.ErrorIs(t, err, runtime.ErrPromptNotFound)
+	_, err = flowRuntime.GetPrompt("test-account", "greeting@staging")
+	assert.ErrorIs(t, err, runtime.ErrPromptNotFound)
+
+	prompts, err := flowRuntime.ListPrompts("test-account")
+	require.NoError(t, err)
+	require.Len(t, prompts, 1)
+	assert.Equal(t, 2, prompts[0].Version)
+
+	require.NoError(t, flowRuntime.DeletePrompt("test-account", "greeting"))
+	_, err = flowRuntime.ListPromptVersions("test-account", "greeting")
+	assert.ErrorIs(t, err, runtime.ErrPromptNotFound)
+}
+
+// racingPromptStore stores a version of another server right before the
+// first version it is asked to create
+type racingPromptStore struct {
+	runtime.PromptStore
+	raced bool
+}
+
+func (s *racingPromptStore) CreatePromptVersion(prompt runtime.Prompt) error {
+	if !s.raced {
+		s.raced = true
+		other := prompt
+		other.Tags = []string{"other-server"}
+		if err := s.PromptStore.CreatePromptVersion(other); err != nil {
+			return err
+		}
+	}
+	return s.PromptStore.CreatePromptVersion(prompt)
+}
+
+func TestPromptLibrary_VersionTakenByAnotherWriter(t *testing.T) {
+	flowRuntime := newPromptRuntime(t, "", "greeting")
+	flowRuntime.SetPromptStore(&racingPromptStore{PromptStore: storage.NewMemoryPromptStore()})
+
+	// The version is numbered again after the one stored first
+	prompt, err := flowRuntime.CreatePrompt("test-account", runtime.Prompt{
+		Name:     "greeting",
+		Messages: []runtime.PromptMessage{{Role: "user", Template: "Hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, prompt.Version)
+
+	versions, err := flowRuntime.ListPromptVersions("test-account", "greeting")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, []string{"other-server"}, versions[0].Tags)
+}
+
+func TestPromptLibrary_RejectsInvalidPrompts(t *testing.T) {
+	flowRuntime := newPromptRuntime(t, "http://localhost", "greeting")
+
+	for name, prompt := range map[string]runtime.Prompt{
+		"name":     {Name: "bad name@1", Messages: []runtime.PromptMessage{{Role: "user", Template: "Hi"}}},
+		"messages": {Name: "empty"},
+		"role":     {Name: "norole", Messages: []runtime.PromptMessage{{Template: "Hi"}}},
+		"template": {Name: "broken", Messages: []runtime.PromptMessage{{Role: "user", Template: "{{.name"}}},
+		"tag":      {Name: "numeric", Messages: []runtime.PromptMessage{{Role: "user", Template: "Hi"}}, Tags: []string{"3"}},
+		"latest":   {Name: "reserved", Messages: []runtime.PromptMessage{{Role: "user", Template: "Hi"}}, Tags: []string{"latest"}},
+	} {
+		_, err := flowRuntime.CreatePrompt("test-account", prompt)
+		assert.ErrorIs(t, err, runtime.ErrInvalidPrompt, name)
+	}
+}
+
+func TestLLMNode_TemplateRef(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"Hi Ada!"`))
+	flowRuntime := newPromptRuntime(t, server.URL, "greeting@production")
+
+	_, err := flowRuntime.CreatePrompt("test-account", runtime.Prompt{
+		Name: "greeting",
+		Messages: []runtime.PromptMessage{
+			{Role: "system", Template: "Be {{.tone}}."},
+			{Role: "user", Template: "Greet {{.name}}"},
+		},
+		Tags: []string{"production"},
+	})
+	require.NoError(t, err)
+	_, err = flowRuntime.CreatePrompt("test-account", runtime.Prompt{
+		Name:     "greeting",
+		Messages: []runtime.PromptMessage{{Role: "user", Template: "Ignore {{.name}}"}},
+	})
+	require.NoError(t, err)
+
+	// Variables come from the shared context and the node's variables
+	executionID, err := flowRuntime.Execute("test-account", "greet", map[string]interface{}{"name": "Ada"})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	require.Len(t, *requests, 1)
+	assert.Equal(t, []string{"system: Be cheerful.", "user: Greet Ada"}, requestContents((*requests)[0]))
+	result := status.Results["result"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "greeting", "version": 1}, result["prompt"])
+}
+
+func TestLLMNode_TemplateRefNotFound(t *testing.T) {
+	server, requests := newFakeProvider(t, completionWith(`"unused"`))
+	flowRuntime := newPromptRuntime(t, server.URL, "missing@2")
+
+	executionID, err := flowRuntime.Execute("test-account", "greet", map[string]interface{}{"name": "Ada"})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, "prompt not found")
+	assert.Empty(t, *requests)
+}
@@ -0,0 +1,392 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+)
+
+// ErrQuotaExceeded is wrapped by the errors of work rejected because an
+// account is over quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Codes of the quota an account exceeded
+const (
+	QuotaExecutionsPerHour    = "executions_per_hour_exceeded"
+	QuotaConcurrentExecutions = "concurrent_executions_exceeded"
+	QuotaDailyLLMSpend        = "llm_budget_exceeded"
+)
+
+// QuotaError reports work rejected because an account is over quota
+type QuotaError struct {
+	// Code names the exceeded quota, e.g. QuotaExecutionsPerHour
+	Code string
+
+	AccountID string
+	Limit     float64
+	Used      float64
+
+	// RetryAfter is when the quota frees up again, if known
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("account %s is over quota: %s (%g of %g)", e.AccountID, e.Code, e.Used, e.Limit)
+}
+
+// Unwrap makes errors.Is(err, ErrQuotaExceeded) hold for quota errors
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaSource provides the quotas of accounts; auth.QuotaManager satisfies it
+type QuotaSource interface {
+	// GetQuota returns the quota of an account, or nil when it has none
+	GetQuota(accountID string) (*auth.AccountQuota, error)
+}
+
+// QuotaUsage is the current usage of an account counted against its quota
+type QuotaUsage struct {
+	ExecutionsLastHour int     `json:"executions_last_hour"`
+	RunningExecutions  int     `json:"running_executions"`
+	QueuedExecutions   int     `json:"queued_executions"`
+	LLMSpendToday      float64 `json:"llm_spend_today"`
+}
+
+// quotaTracker counts the work of accounts against their quotas. Counts are
+// seeded from the stored executions the first time an account is seen.
+type quotaTracker struct {
+	mu       sync.Mutex
+	accounts map[string]*accountUsage
+}
+
+// accountUsage is the work of an account counted by the tracker
+type accountUsage struct {
+	starts   []time.Time // start times of executions in the last hour
+	running  int
+	queue    []*quotaTicket
+	spendDay time.Time // UTC day the spend is counted for
+	spend    float64
+}
+
+// quotaTicket admits an execution. A queued ticket's ready channel is closed
+// once a running execution of the account finishes.
+type quotaTicket struct {
+	tracker   *quotaTracker
+	accountID string
+	ready     chan struct{}
+	holding   bool
+	released  bool
+	warnings  []string
+}
+
+// SetQuotaSource sets where the runtime reads account quotas from
+func (r *flowRuntime) SetQuotaSource(source QuotaSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quotaSource = source
+}
+
+// quotaFor returns the quota of an account, or nil when it is unlimited
+func (r *flowRuntime) quotaFor(accountID string) (*auth.AccountQuota, error) {
+	r.mu.RLock()
+	source := r.quotaSource
+	r.mu.RUnlock()
+	if source == nil {
+		return nil, nil
+	}
+	quota, err := source.GetQuota(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota of account %s: %w", accountID, err)
+	}
+	return quota, nil
+}
+
+// QuotaUsage returns the usage of an account counted against its quota
+func (r *flowRuntime) QuotaUsage(accountID string) QuotaUsage {
+	now := time.Now()
+	r.seedAccountUsage(accountID, now)
+	r.quotas.mu.Lock()
+	defer r.quotas.mu.Unlock()
+	usage := r.quotas.usage(accountID, now)
+	return QuotaUsage{
+		ExecutionsLastHour: len(usage.starts),
+		RunningExecutions:  usage.running,
+		QueuedExecutions:   len(usage.queue),
+		LLMSpendToday:      usage.spend,
+	}
+}
+
+// seedAccountUsage counts the usage of an account from its stored executions
+// the first time the account is seen. It does not hold the tracker lock while
+// listing, as listing may be slow.
+func (r *flowRuntime) seedAccountUsage(accountID string, now time.Time) {
+	r.quotas.mu.Lock()
+	_, ok := r.quotas.accounts[accountID]
+	r.quotas.mu.Unlock()
+	if ok {
+		return
+	}
+
+	seeded := r.countAccountUsage(accountID, now)
+	r.quotas.mu.Lock()
+	defer r.quotas.mu.Unlock()
+	if r.quotas.accounts == nil {
+		r.quotas.accounts = make(map[string]*accountUsage)
+	}
+	if _, ok := r.quotas.accounts[accountID]; !ok {
+		r.quotas.accounts[accountID] = seeded
+	}
+}
+
+// usage returns the counted usage of an account as of now. The tracker must
+// be locked.
+func (t *quotaTracker) usage(accountID string, now time.Time) *accountUsage {
+	usage, ok := t.accounts[accountID]
+	if !ok {
+		if t.accounts == nil {
+			t.accounts = make(map[string]*accountUsage)
+		}
+		usage = &accountUsage{spendDay: utcDay(now)}
+		t.accounts[accountID] = usage
+	}
+
+	hourAgo := now.Add(-time.Hour)
+	for len(usage.starts) > 0 && !usage.starts[0].After(hourAgo) {
+		usage.starts = usage.starts[1:]
+	}
+	if day := utcDay(now); !usage.spendDay.Equal(day) {
+		usage.spendDay = day
+		usage.spend = 0
+	}
+	return usage
+}
+
+// countAccountUsage counts the executions of an account started in the last
+// hour and the LLM spend of those started today
+func (r *flowRuntime) countAccountUsage(accountID string, now time.Time) *accountUsage {
+	usage := &accountUsage{spendDay: utcDay(now)}
+	executions, _ := r.ListExecutions(accountID)
+	for _, execution := range executions {
+		if execution.Metadata["parent_execution"] != "" {
+			continue
+		}
+		if execution.StartTime.After(now.Add(-time.Hour)) {
+			usage.starts = append(usage.starts, execution.StartTime)
+		}
+		if execution.Usage != nil && !execution.StartTime.Before(usage.spendDay) {
+			usage.spend += execution.Usage.Total.Cost
+		}
+	}
+	sort.Slice(usage.starts, func(i, j int) bool { return usage.starts[i].Before(usage.starts[j]) })
+	return usage
+}
+
+// admitExecution checks a new execution of an account against its quota.
+// It returns a nil ticket when the account has no quota, and a queued ticket
+// when the execution has to wait for a running one to finish.
+func (r *flowRuntime) admitExecution(accountID string) (*quotaTicket, error) {
+	quota, err := r.quotaFor(accountID)
+	if err != nil || quota == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	r.seedAccountUsage(accountID, now)
+	r.quotas.mu.Lock()
+	defer r.quotas.mu.Unlock()
+	usage := r.quotas.usage(accountID, now)
+
+	if limit := quota.MaxExecutionsPerHour; limit > 0 && len(usage.starts) >= limit {
+		return nil, &QuotaError{
+			Code:       QuotaExecutionsPerHour,
+			AccountID:  accountID,
+			Limit:      float64(limit),
+			Used:       float64(len(usage.starts)),
+			RetryAfter: usage.starts[0].Add(time.Hour).Sub(now),
+		}
+	}
+
+	ticket := &quotaTicket{tracker: &r.quotas, accountID: accountID}
+	if limit := quota.MaxConcurrentExecutions; limit > 0 && usage.running >= limit {
+		if !quota.QueueExecutions {
+			return nil, &QuotaError{
+				Code:      QuotaConcurrentExecutions,
+				AccountID: accountID,
+				Limit:     float64(limit),
+				Used:      float64(usage.running),
+			}
+		}
+		ticket.ready = make(chan struct{})
+		usage.queue = append(usage.queue, ticket)
+	} else {
+		ticket.holding = true
+		usage.running++
+	}
+	usage.starts = append(usage.starts, now)
+
+	ticket.warnings = softLimitWarnings(quota,
+		quotaLevel{"executions per hour", float64(len(usage.starts)), float64(quota.MaxExecutionsPerHour)},
+		quotaLevel{"concurrent executions", float64(usage.running + len(usage.queue)), float64(quota.MaxConcurrentExecutions)},
+		quotaLevel{"daily LLM spend", usage.spend, quota.MaxDailyLLMSpend},
+	)
+	return ticket, nil
+}
+
+// awaitQuota logs the soft limit warnings of an execution and, when it was
+// queued, waits for a running execution of the account to finish. It reports
+// false when the execution was canceled while queued.
+func (r *flowRuntime) awaitQuota(ctx context.Context, execCtx *executionContext) bool {
+	ticket := execCtx.quota
+	if ticket == nil {
+		return true
+	}
+	for _, warning := range ticket.warnings {
+		r.logExecution(execCtx.status.ID, "warn", "Account quota soft limit reached", map[string]interface{}{"quota": warning})
+	}
+	if ticket.ready == nil {
+		return true
+	}
+
+	r.logExecution(execCtx.status.ID, "info", "Execution queued until a running execution of the account finishes", nil)
+	select {
+	case <-ticket.ready:
+		r.updateExecutionStatus(execCtx.status.ID, "running", "", nil)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release gives up the ticket's place, handing a held slot to the next
+// queued execution of the account
+func (t *quotaTicket) release() {
+	if t == nil {
+		return
+	}
+	t.tracker.mu.Lock()
+	defer t.tracker.mu.Unlock()
+	if t.released {
+		return
+	}
+	t.released = true
+
+	usage := t.tracker.accounts[t.accountID]
+	if !t.holding {
+		for i, queued := range usage.queue {
+			if queued == t {
+				usage.queue = append(usage.queue[:i:i], usage.queue[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+
+	if len(usage.queue) > 0 {
+		next := usage.queue[0]
+		usage.queue = usage.queue[1:]
+		next.holding = true
+		close(next.ready)
+		return
+	}
+	usage.running--
+}
+
+// checkLLMBudget returns a QuotaError once the account has spent its daily
+// LLM budget
+func (r *flowRuntime) checkLLMBudget(accountID string) error {
+	quota, err := r.quotaFor(accountID)
+	if err != nil || quota == nil || quota.MaxDailyLLMSpend <= 0 {
+		return err
+	}
+
+	now := time.Now()
+	r.seedAccountUsage(accountID, now)
+	r.quotas.mu.Lock()
+	defer r.quotas.mu.Unlock()
+	usage := r.quotas.usage(accountID, now)
+	if usage.spend < quota.MaxDailyLLMSpend {
+		return nil
+	}
+	return &QuotaError{
+		Code:       QuotaDailyLLMSpend,
+		AccountID:  accountID,
+		Limit:      quota.MaxDailyLLMSpend,
+		Used:       usage.spend,
+		RetryAfter: utcDay(now).AddDate(0, 0, 1).Sub(now),
+	}
+}
+
+// addLLMSpend counts the cost of LLM requests against the account's budget
+// and reports a warning when the spend crossed its soft limit
+func (r *flowRuntime) addLLMSpend(accountID string, cost float64) string {
+	if cost <= 0 {
+		return ""
+	}
+	quota, err := r.quotaFor(accountID)
+	if err != nil || quota == nil {
+		return ""
+	}
+
+	now := time.Now()
+	r.seedAccountUsage(accountID, now)
+	r.quotas.mu.Lock()
+	defer r.quotas.mu.Unlock()
+	usage := r.quotas.usage(accountID, now)
+	before := quotaLevel{"daily LLM spend", usage.spend, quota.MaxDailyLLMSpend}
+	usage.spend += cost
+	after := quotaLevel{"daily LLM spend", usage.spend, quota.MaxDailyLLMSpend}
+
+	// Warn only when crossing the soft limit, not on every request after it
+	if len(softLimitWarnings(quota, before)) > 0 {
+		return ""
+	}
+	if warnings := softLimitWarnings(quota, after); len(warnings) > 0 {
+		return warnings[0]
+	}
+	return ""
+}
+
+// checkLLMBudget fails once the account of the running execution has spent
+// its daily LLM budget
+func (e *toolEnvironment) checkLLMBudget() error {
+	if e == nil || e.runtime == nil || e.execCtx == nil {
+		return nil
+	}
+	return e.runtime.checkLLMBudget(e.execCtx.accountID)
+}
+
+// quotaLevel is the usage of one limit of a quota
+type quotaLevel struct {
+	name  string
+	used  float64
+	limit float64
+}
+
+// softLimitWarnings describes each level at or above the quota's soft limit
+// percentage of its limit
+func softLimitWarnings(quota *auth.AccountQuota, levels ...quotaLevel) []string {
+	if quota.SoftLimitPercent <= 0 {
+		return nil
+	}
+	var warnings []string
+	for _, level := range levels {
+		if level.limit <= 0 {
+			continue
+		}
+		if percent := level.used / level.limit * 100; percent >= quota.SoftLimitPercent {
+			warnings = append(warnings, fmt.Sprintf("%s at %.0f%% of quota (%g of %g)", level.name, percent, level.used, level.limit))
+		}
+	}
+	return warnings
+}
+
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
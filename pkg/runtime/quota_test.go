@@ -0,0 +1,199 @@
+package runtime_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/loader"
+	"github.com/tcmartin/flowrunner/pkg/plugins"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// staticQuotas is a quota source with fixed quotas
+type staticQuotas map[string]*auth.AccountQuota
+
+func (q staticQuotas) GetQuota(accountID string) (*auth.AccountQuota, error) {
+	return q[accountID], nil
+}
+
+// newQuotaRuntime returns a runtime enforcing quota for test-account, running
+// the given flows
+func newQuotaRuntime(t *testing.T, store runtime.ExecutionStore, quota *auth.AccountQuota, flows map[string]string) runtime.QuotaFlowRuntime {
+	t.Helper()
+	mockRegistry := new(IntegrationMockFlowRegistry)
+	nodeFactories := map[string]plugins.NodeFactory{}
+	for nodeType, factory := range runtime.CoreNodeTypes() {
+		nodeFactories[nodeType] = &replayNodeFactory{factory: factory}
+	}
+	for flowID, yaml := range flows {
+		mockRegistry.On("GetFlow", "test-account", flowID).Return(&runtime.Flow{ID: flowID, YAML: yaml}, nil)
+	}
+
+	flowRuntime := runtime.NewFlowRuntimeWithStore(mockRegistry, loader.NewYAMLLoader(nodeFactories, plugins.NewPluginRegistry()), store)
+	limited, ok := flowRuntime.(runtime.QuotaFlowRuntime)
+	require.True(t, ok)
+	limited.SetQuotaSource(staticQuotas{"test-account": quota})
+	return limited
+}
+
+func delayFlow(duration string) string {
+	return `
+metadata:
+  name: wait
+nodes:
+  pause:
+    type: delay
+    params:
+      duration: ` + duration + `
+`
+}
+
+func TestQuota_ExecutionsPerHour(t *testing.T) {
+	store := storage.NewMemoryProvider().GetExecutionStore()
+	store.SaveExecution(runtime.ExecutionStatus{
+		ID:        "earlier",
+		FlowID:    "wait",
+		Status:    "completed",
+		StartTime: time.Now().Add(-10 * time.Minute),
+		Metadata:  map[string]string{"account_id": "test-account"},
+	})
+	store.SaveExecution(runtime.ExecutionStatus{
+		ID:        "yesterday",
+		FlowID:    "wait",
+		Status:    "completed",
+		StartTime: time.Now().Add(-24 * time.Hour),
+		Metadata:  map[string]string{"account_id": "test-account"},
+	})
+	flowRuntime := newQuotaRuntime(t, store, &auth.AccountQuota{MaxExecutionsPerHour: 2}, map[string]string{"wait": delayFlow("1ms")})
+
+	// The execution stored earlier in the hour counts
+	executionID, err := flowRuntime.Execute("test-account", "wait", nil)
+	require.NoError(t, err)
+	waitForCompletion(t, flowRuntime, executionID)
+
+	_, err = flowRuntime.Execute("test-account", "wait", nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, runtime.ErrQuotaExceeded))
+	var quotaErr *runtime.QuotaError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, runtime.QuotaExecutionsPerHour, quotaErr.Code)
+	assert.Equal(t, 2.0, quotaErr.Used)
+	assert.InDelta(t, 50*time.Minute, quotaErr.RetryAfter, float64(time.Minute))
+
+	assert.Equal(t, 2, flowRuntime.QuotaUsage("test-account").ExecutionsLastHour)
+}
+
+func TestQuota_ConcurrentExecutions(t *testing.T) {
+	flows := map[string]string{"wait": delayFlow("200ms")}
+
+	t.Run("rejects executions over the limit", func(t *testing.T) {
+		flowRuntime := newQuotaRuntime(t, newReplayExecutionStore(), &auth.AccountQuota{MaxConcurrentExecutions: 1}, flows)
+
+		first, err := flowRuntime.Execute("test-account", "wait", nil)
+		require.NoError(t, err)
+		_, err = flowRuntime.Execute("test-account", "wait", nil)
+		var quotaErr *runtime.QuotaError
+		require.True(t, errors.As(err, &quotaErr))
+		assert.Equal(t, runtime.QuotaConcurrentExecutions, quotaErr.Code)
+
+		// The slot frees up once the running execution finishes
+		waitForCompletion(t, flowRuntime, first)
+		assert.Eventually(t, func() bool { return flowRuntime.QuotaUsage("test-account").RunningExecutions == 0 }, time.Second, 5*time.Millisecond)
+		_, err = flowRuntime.Execute("test-account", "wait", nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("queues executions over the limit", func(t *testing.T) {
+		flowRuntime := newQuotaRuntime(t, newReplayExecutionStore(), &auth.AccountQuota{MaxConcurrentExecutions: 1, QueueExecutions: true}, flows)
+
+		first, err := flowRuntime.Execute("test-account", "wait", nil)
+		require.NoError(t, err)
+		second, err := flowRuntime.Execute("test-account", "wait", nil)
+		require.NoError(t, err)
+		third, err := flowRuntime.Execute("test-account", "wait", nil)
+		require.NoError(t, err)
+
+		status, err := flowRuntime.GetStatus(second)
+		require.NoError(t, err)
+		assert.Equal(t, "queued", status.Status)
+		usage := flowRuntime.QuotaUsage("test-account")
+		assert.Equal(t, 1, usage.RunningExecutions)
+		assert.Equal(t, 2, usage.QueuedExecutions)
+
+		// A canceled queued execution gives up its place
+		require.NoError(t, flowRuntime.Cancel(third))
+
+		assert.Eventually(t, func() bool {
+			status, err := flowRuntime.GetStatus(second)
+			return err == nil && status.Status == "completed"
+		}, 2*time.Second, 10*time.Millisecond)
+		status, err = flowRuntime.GetStatus(first)
+		require.NoError(t, err)
+		assert.Equal(t, "completed", status.Status)
+
+		status, err = flowRuntime.GetStatus(third)
+		require.NoError(t, err)
+		assert.Equal(t, "canceled", status.Status)
+	})
+}
+
+func TestQuota_DailyLLMSpend(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		`{"id": "chatcmpl-1", "model": "llama3", "choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+		  "usage": {"prompt_tokens": 1000, "completion_tokens": 500, "total_tokens": 1500}}`,
+	)
+	store := newReplayExecutionStore()
+	flowRuntime := newQuotaRuntime(t, store, &auth.AccountQuota{MaxDailyLLMSpend: 0.002, SoftLimitPercent: 50}, map[string]string{
+		"ask": `
+metadata:
+  name: ask
+nodes:
+  answer:
+    type: llm
+    params:
+      provider: ollama
+      model: llama3
+      prompt: Say hi
+      options:
+        base_url: ` + server.URL + `
+`,
+	})
+	flowRuntime.(runtime.LLMPricedFlowRuntime).SetLLMPrices(runtime.LLMPriceTable{"llama3": {Input: 1, Output: 1}})
+
+	// Each execution costs 0.0015: the first crosses the soft limit and the
+	// second exhausts the budget
+	for i := 0; i < 2; i++ {
+		executionID, err := flowRuntime.Execute("test-account", "ask", nil)
+		require.NoError(t, err)
+		status := waitForCompletion(t, flowRuntime, executionID)
+		require.Equal(t, "completed", status.Status, status.Error)
+
+		if i == 0 {
+			logs, err := store.GetExecutionLogs(executionID)
+			require.NoError(t, err)
+			assert.True(t, containsLog(logs, "warn", "Account quota soft limit reached"))
+		}
+	}
+	assert.InDelta(t, 0.003, flowRuntime.QuotaUsage("test-account").LLMSpendToday, 1e-9)
+
+	executionID, err := flowRuntime.Execute("test-account", "ask", nil)
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.Error, runtime.QuotaDailyLLMSpend)
+	assert.Len(t, *requests, 2)
+}
+
+func containsLog(logs []runtime.ExecutionLog, level, message string) bool {
+	for _, log := range logs {
+		if log.Level == level && log.Message == message {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+package runtime
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// TokenUsage counts the LLM requests, tokens and cost of part of the work
+type TokenUsage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Add adds other to the usage
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.Requests += other.Requests
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.Cost += other.Cost
+}
+
+// ExecutionUsage is the LLM usage of an execution
+type ExecutionUsage struct {
+	// Total is the usage of the whole execution
+	Total TokenUsage `json:"total"`
+
+	// Nodes breaks the usage down by the node that sent the requests
+	Nodes map[string]TokenUsage `json:"nodes,omitempty"`
+
+	// Models breaks the usage down by model, keyed "provider/model"
+	Models map[string]TokenUsage `json:"models,omitempty"`
+}
+
+// clone returns a copy of the usage; the copy of nil is empty
+func (u *ExecutionUsage) clone() *ExecutionUsage {
+	clone := &ExecutionUsage{}
+	if u == nil {
+		return clone
+	}
+	clone.Total = u.Total
+	for nodeID, usage := range u.Nodes {
+		addKeyedUsage(clone.nodes(), nodeID, usage)
+	}
+	for model, usage := range u.Models {
+		addKeyedUsage(clone.models(), model, usage)
+	}
+	return clone
+}
+
+func (u *ExecutionUsage) nodes() map[string]TokenUsage {
+	if u.Nodes == nil {
+		u.Nodes = make(map[string]TokenUsage)
+	}
+	return u.Nodes
+}
+
+func (u *ExecutionUsage) models() map[string]TokenUsage {
+	if u.Models == nil {
+		u.Models = make(map[string]TokenUsage)
+	}
+	return u.Models
+}
+
+// add records usage of a node and model
+func (u *ExecutionUsage) add(nodeID, model string, usage TokenUsage) {
+	u.Total.Add(usage)
+	if nodeID != "" {
+		addKeyedUsage(u.nodes(), nodeID, usage)
+	}
+	addKeyedUsage(u.models(), model, usage)
+}
+
+// LLMPrice is the price of a model per million tokens
+type LLMPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// LLMPriceTable maps models to their prices. Keys are either "provider/model"
+// or a model name of any provider; a key ending in "*" matches by prefix, so
+// that "gpt-4o*" also prices dated versions such as "gpt-4o-2024-08-06".
+type LLMPriceTable map[string]LLMPrice
+
+// Price returns the price of a model, preferring exact keys over prefixes and
+// longer prefixes over shorter ones
+func (t LLMPriceTable) Price(provider, model string) (LLMPrice, bool) {
+	qualified := provider + "/" + model
+	if price, ok := t[qualified]; ok {
+		return price, true
+	}
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for key := range t {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if !ok || len(prefix) <= len(best) {
+			continue
+		}
+		if strings.HasPrefix(qualified, prefix) || strings.HasPrefix(model, prefix) {
+			best = key
+		}
+	}
+	if best == "" {
+		return LLMPrice{}, false
+	}
+	return t[best], true
+}
+
+// Cost returns the cost of the tokens used by a request to a model, or 0 when
+// the model has no price
+func (t LLMPriceTable) Cost(provider, model string, usage utils.Usage) float64 {
+	price, ok := t.Price(provider, model)
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6
+}
+
+// SetLLMPrices sets the prices LLM usage is costed with
+func (r *flowRuntime) SetLLMPrices(prices LLMPriceTable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.llmPrices = prices
+}
+
+// recordLLMUsage adds the usage of LLM requests to the execution, attributed
+// to the node currently running
+func (r *flowRuntime) recordLLMUsage(execCtx *executionContext, provider, model string, usage utils.Usage, requests int) {
+	r.mu.RLock()
+	prices := r.llmPrices
+	r.mu.RUnlock()
+
+	tokens := TokenUsage{
+		Requests:         requests,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Cost:             prices.Cost(provider, model, usage),
+	}
+	if tokens.TotalTokens == 0 {
+		tokens.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	// Status copies handed out share the usage, so it is replaced rather
+	// than updated in place
+	execCtx.mu.Lock()
+	updated := execCtx.status.Usage.clone()
+	updated.add(execCtx.status.CurrentNode, provider+"/"+model, tokens)
+	execCtx.status.Usage = updated
+	executionID := execCtx.status.ID
+	execCtx.mu.Unlock()
+
+	if warning := r.addLLMSpend(execCtx.accountID, tokens.Cost); warning != "" {
+		r.logExecution(executionID, "warn", "Account quota soft limit reached", map[string]interface{}{"quota": warning})
+	}
+}
+
+// recordLLMUsage adds the usage of LLM requests to the running execution
+func (e *toolEnvironment) recordLLMUsage(provider, model string, usage utils.Usage, requests int) {
+	if e == nil || e.runtime == nil || e.execCtx == nil {
+		return
+	}
+	e.runtime.recordLLMUsage(e.execCtx, provider, model, usage, requests)
+}
+
+// UsageQuery selects the executions and time buckets of a usage report
+type UsageQuery struct {
+	// From and To bound the start time of the executions; zero means unbounded
+	From time.Time
+	To   time.Time
+
+	// FlowID restricts the report to one flow
+	FlowID string
+
+	// Bucket is the bucket size: "hour", "day", "week" or "month"
+	Bucket string
+}
+
+// UsageBucket is the usage of the executions started in a time bucket
+type UsageBucket struct {
+	Start time.Time             `json:"start"`
+	Total TokenUsage            `json:"total"`
+	Flows map[string]TokenUsage `json:"flows,omitempty"`
+}
+
+// UsageReport aggregates the LLM usage of executions
+type UsageReport struct {
+	Bucket     string                `json:"bucket"`
+	Executions int                   `json:"executions"`
+	Total      TokenUsage            `json:"total"`
+	Flows      map[string]TokenUsage `json:"flows"`
+	Models     map[string]TokenUsage `json:"models"`
+	Buckets    []UsageBucket         `json:"buckets"`
+}
+
+// AggregateUsage totals the usage of the executions matching the query per
+// flow, per model and per time bucket. Buckets are in UTC and only buckets
+// with usage are reported.
+func AggregateUsage(executions []ExecutionStatus, query UsageQuery) UsageReport {
+	if query.Bucket == "" {
+		query.Bucket = "day"
+	}
+	report := UsageReport{
+		Bucket:  query.Bucket,
+		Flows:   make(map[string]TokenUsage),
+		Models:  make(map[string]TokenUsage),
+		Buckets: []UsageBucket{},
+	}
+
+	buckets := make(map[time.Time]*UsageBucket)
+	for _, execution := range executions {
+		if execution.Usage == nil || (query.FlowID != "" && execution.FlowID != query.FlowID) {
+			continue
+		}
+		if (!query.From.IsZero() && execution.StartTime.Before(query.From)) ||
+			(!query.To.IsZero() && !execution.StartTime.Before(query.To)) {
+			continue
+		}
+
+		usage := execution.Usage.Total
+		report.Executions++
+		report.Total.Add(usage)
+		addKeyedUsage(report.Flows, execution.FlowID, usage)
+		for model, modelUsage := range execution.Usage.Models {
+			addKeyedUsage(report.Models, model, modelUsage)
+		}
+
+		start := bucketStart(execution.StartTime, query.Bucket)
+		bucket, ok := buckets[start]
+		if !ok {
+			bucket = &UsageBucket{Start: start, Flows: make(map[string]TokenUsage)}
+			buckets[start] = bucket
+		}
+		bucket.Total.Add(usage)
+		addKeyedUsage(bucket.Flows, execution.FlowID, usage)
+	}
+
+	for _, bucket := range buckets {
+		report.Buckets = append(report.Buckets, *bucket)
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool { return report.Buckets[i].Start.Before(report.Buckets[j].Start) })
+	return report
+}
+
+// IsUsageBucket reports whether name is a supported bucket size
+func IsUsageBucket(name string) bool {
+	switch name {
+	case "hour", "day", "week", "month":
+		return true
+	}
+	return false
+}
+
+func addKeyedUsage(totals map[string]TokenUsage, key string, usage TokenUsage) {
+	total := totals[key]
+	total.Add(usage)
+	totals[key] = total
+}
+
+// bucketStart returns the start of the UTC bucket containing t; weeks start
+// on Monday
+func bucketStart(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
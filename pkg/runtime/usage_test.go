@@ -0,0 +1,94 @@
+package runtime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+func TestExecutionUsage_PerNodeAndModel(t *testing.T) {
+	server, requests := newFakeProvider(t,
+		`{"id": "chatcmpl-1", "model": "llama3", "choices": [{"index": 0, "message": {"role": "assistant", "content": "draft"}, "finish_reason": "stop"}],
+		  "usage": {"prompt_tokens": 1000, "completion_tokens": 500, "total_tokens": 1500}}`,
+		`{"id": "chatcmpl-2", "model": "qwen", "choices": [{"index": 0, "message": {"role": "assistant", "content": "reviewed"}, "finish_reason": "stop"}],
+		  "usage": {"prompt_tokens": 2000, "completion_tokens": 100}}`,
+	)
+
+	options := map[string]interface{}{"base_url": server.URL}
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{"write": {
+		Metadata: map[string]interface{}{"name": "write"},
+		Nodes: map[string]testNode{
+			"draft": {
+				Type:   "llm",
+				Params: map[string]interface{}{"provider": "ollama", "model": "llama3", "prompt": "Write a haiku", "options": options},
+				Next:   map[string]string{"default": "review"},
+			},
+			"review": {
+				Type:   "agent",
+				Params: map[string]interface{}{"provider": "llamacpp", "model": "qwen", "prompt": "Review the haiku", "options": options},
+			},
+		},
+	}})
+	priced, ok := flowRuntime.(runtime.LLMPricedFlowRuntime)
+	require.True(t, ok)
+	priced.SetLLMPrices(runtime.LLMPriceTable{
+		"ollama/llama3": {Input: 1, Output: 2},
+		"qw*":           {Input: 10, Output: 10},
+	})
+
+	executionID, err := flowRuntime.Execute("test-account", "write", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+	require.Len(t, *requests, 2)
+
+	require.NotNil(t, status.Usage)
+	assert.Equal(t, runtime.TokenUsage{Requests: 1, PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500, Cost: 0.002}, status.Usage.Nodes["draft"])
+	assert.Equal(t, runtime.TokenUsage{Requests: 1, PromptTokens: 2000, CompletionTokens: 100, TotalTokens: 2100, Cost: 0.021}, status.Usage.Nodes["review"])
+	assert.Equal(t, status.Usage.Nodes["draft"], status.Usage.Models["ollama/llama3"])
+	assert.Equal(t, status.Usage.Nodes["review"], status.Usage.Models["llamacpp/qwen"])
+	assert.Equal(t, 2, status.Usage.Total.Requests)
+	assert.Equal(t, 3600, status.Usage.Total.TotalTokens)
+	assert.InDelta(t, 0.023, status.Usage.Total.Cost, 1e-9)
+}
+
+func TestAggregateUsage(t *testing.T) {
+	usage := func(tokens int, cost float64) *runtime.ExecutionUsage {
+		total := runtime.TokenUsage{Requests: 1, TotalTokens: tokens, Cost: cost}
+		return &runtime.ExecutionUsage{Total: total, Models: map[string]runtime.TokenUsage{"openai/gpt-4o": total}}
+	}
+	day := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC) // a Wednesday
+	executions := []runtime.ExecutionStatus{
+		{FlowID: "a", StartTime: day.Add(9 * time.Hour), Usage: usage(100, 1)},
+		{FlowID: "b", StartTime: day.Add(10 * time.Hour), Usage: usage(200, 2)},
+		{FlowID: "a", StartTime: day.AddDate(0, 0, 1), Usage: usage(300, 3)},
+		{FlowID: "a", StartTime: day.AddDate(0, 0, 7), Usage: usage(400, 4)},
+		{FlowID: "c", StartTime: day},
+	}
+
+	report := runtime.AggregateUsage(executions, runtime.UsageQuery{})
+	assert.Equal(t, "day", report.Bucket)
+	assert.Equal(t, 4, report.Executions)
+	assert.Equal(t, 1000, report.Total.TotalTokens)
+	assert.Equal(t, 800, report.Flows["a"].TotalTokens)
+	assert.Equal(t, 4, report.Models["openai/gpt-4o"].Requests)
+	require.Len(t, report.Buckets, 3)
+	assert.Equal(t, day, report.Buckets[0].Start)
+	assert.Equal(t, 300, report.Buckets[0].Total.TotalTokens)
+	assert.Equal(t, 200, report.Buckets[0].Flows["b"].TotalTokens)
+
+	report = runtime.AggregateUsage(executions, runtime.UsageQuery{Bucket: "week", FlowID: "a", To: day.AddDate(0, 0, 7)})
+	assert.Equal(t, 2, report.Executions)
+	require.Len(t, report.Buckets, 1)
+	assert.Equal(t, day.AddDate(0, 0, -2), report.Buckets[0].Start)
+	assert.Equal(t, 400, report.Buckets[0].Total.TotalTokens)
+
+	report = runtime.AggregateUsage(executions, runtime.UsageQuery{Bucket: "month", From: day.AddDate(0, 0, 1)})
+	assert.Equal(t, 2, report.Executions)
+	require.Len(t, report.Buckets, 1)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), report.Buckets[0].Start)
+	assert.InDelta(t, 7.0, report.Total.Cost, 1e-9)
+}
@@ -0,0 +1,207 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// VectorRecord is a document stored in a vector index
+type VectorRecord struct {
+	ID       string                 `json:"id"`
+	Vector   []float64              `json:"-"`
+	Text     string                 `json:"text,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// VectorMatch is a record found by a similarity search, scored by the cosine
+// similarity of its vector to the query
+type VectorMatch struct {
+	VectorRecord
+	Score float64 `json:"score"`
+}
+
+// VectorIndex stores vectors in named collections of an account and searches
+// them by similarity
+type VectorIndex interface {
+	// Upsert adds records, replacing those with the same IDs
+	Upsert(accountID, collection string, records []VectorRecord) error
+
+	// Query returns the topK records most similar to vector, best first.
+	// Only records whose metadata holds every entry of filter are searched.
+	Query(accountID, collection string, vector []float64, topK int, filter map[string]interface{}) ([]VectorMatch, error)
+
+	// Delete removes the records with the given IDs and returns how many
+	// were found
+	Delete(accountID, collection string, ids []string) (int, error)
+}
+
+// VectorIndexFactory creates a vector index from the connection params of a
+// vector node
+type VectorIndexFactory func(config map[string]interface{}) (VectorIndex, error)
+
+// Built-in vector indexes
+const (
+	// MemoryVectorIndex keeps vectors in process; they are lost on restart
+	MemoryVectorIndex = "memory"
+
+	// PGVectorIndex keeps vectors in PostgreSQL with the pgvector extension
+	PGVectorIndex = "pgvector"
+)
+
+var (
+	vectorIndexesMu sync.RWMutex
+	vectorIndexes   = map[string]VectorIndexFactory{
+		MemoryVectorIndex: func(map[string]interface{}) (VectorIndex, error) { return sharedMemoryVectorIndex, nil },
+		PGVectorIndex:     newPGVectorIndex,
+	}
+
+	// sharedMemoryVectorIndex is shared by all executions in the process
+	sharedMemoryVectorIndex = NewInMemoryVectorIndex()
+)
+
+// RegisterVectorIndex registers a vector index under the given name,
+// replacing any index registered under the same name
+func RegisterVectorIndex(name string, factory VectorIndexFactory) {
+	vectorIndexesMu.Lock()
+	defer vectorIndexesMu.Unlock()
+	vectorIndexes[name] = factory
+}
+
+// openVectorIndex returns the vector index registered under name
+func openVectorIndex(name string, config map[string]interface{}) (VectorIndex, error) {
+	vectorIndexesMu.RLock()
+	factory, ok := vectorIndexes[name]
+	vectorIndexesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown vector index %q", name)
+	}
+	return factory(config)
+}
+
+// InMemoryVectorIndex is a vector index searched by brute force, for tests
+// and small deployments
+type InMemoryVectorIndex struct {
+	mu          sync.RWMutex
+	collections map[string]map[string]VectorRecord
+}
+
+// NewInMemoryVectorIndex creates an empty in-process vector index
+func NewInMemoryVectorIndex() *InMemoryVectorIndex {
+	return &InMemoryVectorIndex{collections: make(map[string]map[string]VectorRecord)}
+}
+
+func vectorCollectionKey(accountID, collection string) string {
+	return accountID + "/" + collection
+}
+
+// Upsert adds records, replacing those with the same IDs
+func (idx *InMemoryVectorIndex) Upsert(accountID, collection string, records []VectorRecord) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := vectorCollectionKey(accountID, collection)
+	stored, ok := idx.collections[key]
+	if !ok {
+		stored = make(map[string]VectorRecord)
+		idx.collections[key] = stored
+	}
+	for _, record := range records {
+		for _, existing := range stored {
+			// All vectors of a collection come from the same model
+			if len(existing.Vector) != len(record.Vector) {
+				return fmt.Errorf("vector of %q has %d dimensions, collection %s has %d", record.ID, len(record.Vector), collection, len(existing.Vector))
+			}
+			break
+		}
+		record.Vector = append([]float64(nil), record.Vector...)
+		stored[record.ID] = record
+	}
+	return nil
+}
+
+// Query returns the topK records most similar to vector, best first
+func (idx *InMemoryVectorIndex) Query(accountID, collection string, vector []float64, topK int, filter map[string]interface{}) ([]VectorMatch, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	matches := []VectorMatch{}
+	for _, record := range idx.collections[vectorCollectionKey(accountID, collection)] {
+		if len(record.Vector) != len(vector) {
+			return nil, fmt.Errorf("query vector has %d dimensions, collection %s has %d", len(vector), collection, len(record.Vector))
+		}
+		if !metadataMatches(record.Metadata, filter) {
+			continue
+		}
+		matches = append(matches, VectorMatch{VectorRecord: record, Score: cosineSimilarity(vector, record.Vector)})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches, nil
+}
+
+// Delete removes the records with the given IDs
+func (idx *InMemoryVectorIndex) Delete(accountID, collection string, ids []string) (int, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	stored := idx.collections[vectorCollectionKey(accountID, collection)]
+	deleted := 0
+	for _, id := range ids {
+		if _, ok := stored[id]; ok {
+			delete(stored, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// metadataMatches reports whether metadata holds every entry of filter
+func metadataMatches(metadata, filter map[string]interface{}) bool {
+	for key, want := range filter {
+		got, ok := metadata[key]
+		if !ok || !reflect.DeepEqual(normalizeJSONValue(got), normalizeJSONValue(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeJSONValue makes numbers comparable whether they were decoded from
+// JSON or YAML
+func normalizeJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or 0
+// when either is zero
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,201 @@
+package runtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// defaultVectorTable is the table of the pgvector index
+const defaultVectorTable = "flowrunner_vectors"
+
+var (
+	vectorTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// pgVectorTables records the pgVectorTable already created in this
+	// process
+	pgVectorTables sync.Map
+)
+
+// pgVectorTable is a vector table of a database connection
+type pgVectorTable struct {
+	db    *sql.DB
+	table string
+}
+
+// pgVectorIndex is a vector index in PostgreSQL, using the pgvector extension
+// on the connection of the PostgresManager
+type pgVectorIndex struct {
+	db    *sql.DB
+	table string
+}
+
+// newPGVectorIndex connects through the PostgresManager with the connection
+// params of the postgres node, and creates the vector table when missing
+func newPGVectorIndex(config map[string]interface{}) (VectorIndex, error) {
+	table, _ := config["vector_table"].(string)
+	if table == "" {
+		table = defaultVectorTable
+	}
+	if !vectorTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid vector_table %q", table)
+	}
+
+	manager, err := GetPostgresManager(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PostgreSQL manager: %w", err)
+	}
+	index := &pgVectorIndex{db: manager.db, table: table}
+	key := pgVectorTable{db: manager.db, table: table}
+	if _, created := pgVectorTables.Load(key); !created {
+		if err := index.ensureTableExists(); err != nil {
+			return nil, err
+		}
+		pgVectorTables.Store(key, true)
+	}
+	return index, nil
+}
+
+// ensureTableExists creates the vector extension and table if they don't
+// exist. The column takes vectors of any dimension, so collections may hold
+// embeddings of different models.
+func (idx *pgVectorIndex) ensureTableExists() error {
+	if _, err := idx.db.Exec(`CREATE EXTENSION IF NOT EXISTS vector`); err != nil {
+		return fmt.Errorf("failed to create vector extension: %w", err)
+	}
+
+	_, err := idx.db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			account_id TEXT NOT NULL,
+			collection TEXT NOT NULL,
+			id TEXT NOT NULL,
+			embedding vector NOT NULL,
+			text TEXT NOT NULL DEFAULT '',
+			metadata JSONB NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (account_id, collection, id)
+		)
+	`, idx.table))
+	if err != nil {
+		return fmt.Errorf("failed to create vector table: %w", err)
+	}
+	return nil
+}
+
+// vectorLiteral formats a vector as pgvector input
+func vectorLiteral(vector []float64) string {
+	parts := make([]string, len(vector))
+	for i, value := range vector {
+		parts[i] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// Upsert adds records, replacing those with the same IDs
+func (idx *pgVectorIndex) Upsert(accountID, collection string, records []VectorRecord) error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(fmt.Sprintf(`
+		INSERT INTO %s (account_id, collection, id, embedding, text, metadata, updated_at)
+		VALUES ($1, $2, $3, $4::vector, $5, $6, NOW())
+		ON CONFLICT (account_id, collection, id) DO UPDATE
+		SET embedding = EXCLUDED.embedding, text = EXCLUDED.text, metadata = EXCLUDED.metadata, updated_at = NOW()
+	`, idx.table))
+	if err != nil {
+		return fmt.Errorf("failed to prepare upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		metadata := record.Metadata
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		metadataJSON, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata of %q: %w", record.ID, err)
+		}
+		if _, err := stmt.Exec(accountID, collection, record.ID, vectorLiteral(record.Vector), record.Text, string(metadataJSON)); err != nil {
+			return fmt.Errorf("failed to upsert %q: %w", record.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit upsert: %w", err)
+	}
+	return nil
+}
+
+// Query returns the topK records nearest to vector by cosine distance
+func (idx *pgVectorIndex) Query(accountID, collection string, vector []float64, topK int, filter map[string]interface{}) ([]VectorMatch, error) {
+	if filter == nil {
+		filter = map[string]interface{}{}
+	}
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal filter: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, text, metadata, 1 - (embedding <=> $3::vector) AS score
+		FROM %s
+		WHERE account_id = $1 AND collection = $2 AND metadata @> $4
+		ORDER BY embedding <=> $3::vector
+	`, idx.table)
+	args := []interface{}{accountID, collection, vectorLiteral(vector), string(filterJSON)}
+	if topK > 0 {
+		query += " LIMIT $5"
+		args = append(args, topK)
+	}
+
+	rows, err := idx.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vectors: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []VectorMatch{}
+	for rows.Next() {
+		var match VectorMatch
+		var metadataJSON []byte
+		var score sql.NullFloat64
+		if err := rows.Scan(&match.ID, &match.Text, &metadataJSON, &score); err != nil {
+			return nil, fmt.Errorf("failed to scan vector: %w", err)
+		}
+		if err := json.Unmarshal(metadataJSON, &match.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of %q: %w", match.ID, err)
+		}
+		// The cosine distance of a zero vector is undefined
+		match.Score = score.Float64
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating vectors: %w", err)
+	}
+	return matches, nil
+}
+
+// Delete removes the records with the given IDs
+func (idx *pgVectorIndex) Delete(accountID, collection string, ids []string) (int, error) {
+	result, err := idx.db.Exec(fmt.Sprintf(`
+		DELETE FROM %s WHERE account_id = $1 AND collection = $2 AND id = ANY($3)
+	`, idx.table), accountID, collection, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(deleted), nil
+}
@@ -0,0 +1,266 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcmartin/flowlib"
+)
+
+// Defaults of the vector node
+const (
+	defaultVectorTopK      = 5
+	defaultVectorOutputKey = "retrieval"
+)
+
+// vectorParam returns a param holding a vector of numbers
+func vectorParam(value interface{}) ([]float64, bool) {
+	switch v := value.(type) {
+	case []float64:
+		return v, true
+	case []interface{}:
+		vector := make([]float64, len(v))
+		for i, item := range v {
+			switch n := item.(type) {
+			case float64:
+				vector[i] = n
+			case int:
+				vector[i] = float64(n)
+			default:
+				return nil, false
+			}
+		}
+		return vector, true
+	}
+	return nil, false
+}
+
+// vectorDocuments reads the documents param of an upsert. Documents without
+// a vector are embedded from their text with the embedding params.
+func vectorDocuments(params map[string]interface{}, input interface{}) ([]VectorRecord, error) {
+	documents, ok := params["documents"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("documents parameter is required for upsert operation")
+	}
+
+	records := make([]VectorRecord, len(documents))
+	var unembedded []int
+	for i, document := range documents {
+		doc := mapParam(document)
+		if doc == nil {
+			return nil, fmt.Errorf("document %d must be a map", i)
+		}
+		id, _ := doc["id"].(string)
+		if id == "" {
+			return nil, fmt.Errorf("document %d requires an id", i)
+		}
+		records[i] = VectorRecord{ID: id, Metadata: mapParam(doc["metadata"])}
+		records[i].Text, _ = doc["text"].(string)
+
+		if vector, ok := doc["vector"]; ok {
+			if records[i].Vector, ok = vectorParam(vector); !ok {
+				return nil, fmt.Errorf("vector of document %q must be a list of numbers", id)
+			}
+		} else if records[i].Text == "" {
+			return nil, fmt.Errorf("document %q requires a text or a vector", id)
+		} else {
+			unembedded = append(unembedded, i)
+		}
+	}
+
+	if len(unembedded) > 0 {
+		embedding := mapParam(params["embedding"])
+		if embedding == nil {
+			return nil, fmt.Errorf("embedding parameter is required to embed documents without a vector")
+		}
+		texts := make([]string, len(unembedded))
+		for i, index := range unembedded {
+			texts[i] = records[index].Text
+		}
+		resp, _, err := embedTexts(embedding, input, texts)
+		if err != nil {
+			return nil, err
+		}
+		for i, index := range unembedded {
+			records[index].Vector = resp.Embeddings[i]
+		}
+	}
+	return records, nil
+}
+
+// queryVector returns the vector param of a query, or the embedding of its
+// query text
+func queryVector(params map[string]interface{}, input interface{}) ([]float64, error) {
+	if value, ok := params["vector"]; ok {
+		vector, ok := vectorParam(value)
+		if !ok {
+			return nil, fmt.Errorf("vector parameter must be a list of numbers")
+		}
+		return vector, nil
+	}
+
+	text, _ := params["query"].(string)
+	if text == "" {
+		return nil, fmt.Errorf("query or vector parameter is required for query operation")
+	}
+	embedding := mapParam(params["embedding"])
+	if embedding == nil {
+		return nil, fmt.Errorf("embedding parameter is required to embed the query")
+	}
+	resp, _, err := embedTexts(embedding, input, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Embeddings[0], nil
+}
+
+// NewVectorNodeWrapper creates a new vector node wrapper, upserting, querying
+// and deleting documents of a vector index
+func NewVectorNodeWrapper(params map[string]interface{}) (flowlib.Node, error) {
+	// Create the base node
+	baseNode := flowlib.NewNode(1, 0)
+
+	// Create the wrapper
+	wrapper := &NodeWrapper{
+		node: baseNode,
+		exec: func(input interface{}) (interface{}, error) {
+			params, err := combinedParams(input)
+			if err != nil {
+				return nil, err
+			}
+
+			// Open the index
+			indexName, _ := params["index"].(string)
+			if indexName == "" {
+				indexName = MemoryVectorIndex
+			}
+			connection := mapParam(params["connection"])
+			if connection == nil {
+				connection = map[string]interface{}{}
+			}
+			index, err := openVectorIndex(indexName, connection)
+			if err != nil {
+				return nil, err
+			}
+
+			collection, _ := params["collection"].(string)
+			if collection == "" {
+				return nil, fmt.Errorf("collection parameter is required")
+			}
+
+			// Collections belong to the account of the execution
+			var accountID string
+			if env := toolEnvironmentFrom(input); env != nil && env.execCtx != nil {
+				accountID = env.execCtx.accountID
+			}
+
+			operation, _ := params["operation"].(string)
+			start := time.Now()
+			switch operation {
+			case "upsert":
+				records, err := vectorDocuments(params, input)
+				if err != nil {
+					return nil, err
+				}
+				if err := index.Upsert(accountID, collection, records); err != nil {
+					return nil, err
+				}
+				ids := make([]string, len(records))
+				for i, record := range records {
+					ids[i] = record.ID
+				}
+				return map[string]interface{}{
+					"operation":  operation,
+					"collection": collection,
+					"upserted":   len(records),
+					"ids":        ids,
+					"duration":   time.Since(start).String(),
+				}, nil
+
+			case "query":
+				vector, err := queryVector(params, input)
+				if err != nil {
+					return nil, err
+				}
+				matches, err := index.Query(accountID, collection, vector, intParam(params["top_k"], defaultVectorTopK), mapParam(params["filter"]))
+				if err != nil {
+					return nil, err
+				}
+
+				// Drop matches below min_score
+				if minScore, ok := params["min_score"].(float64); ok {
+					kept := matches[:0]
+					for _, match := range matches {
+						if match.Score >= minScore {
+							kept = append(kept, match)
+						}
+					}
+					matches = kept
+				}
+
+				results := make([]map[string]interface{}, len(matches))
+				texts := make([]string, 0, len(matches))
+				for i, match := range matches {
+					results[i] = map[string]interface{}{
+						"id":       match.ID,
+						"score":    match.Score,
+						"text":     match.Text,
+						"metadata": match.Metadata,
+					}
+					if match.Text != "" {
+						texts = append(texts, match.Text)
+					}
+				}
+				return map[string]interface{}{
+					"operation":  operation,
+					"collection": collection,
+					"matches":    results,
+					"count":      len(results),
+					// The texts of the matches, ready for a prompt
+					"context":  strings.Join(texts, "\n\n"),
+					"duration": time.Since(start).String(),
+				}, nil
+
+			case "delete":
+				ids, ok := stringsParam(params["ids"])
+				if !ok {
+					return nil, fmt.Errorf("ids parameter is required for delete operation")
+				}
+				deleted, err := index.Delete(accountID, collection, ids)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{
+					"operation":  operation,
+					"collection": collection,
+					"deleted":    deleted,
+					"duration":   time.Since(start).String(),
+				}, nil
+
+			default:
+				return nil, fmt.Errorf("unknown operation: %s", operation)
+			}
+		},
+	}
+
+	// Results are also placed into the shared context under output_key, so
+	// that llm templates can use them by name
+	wrapper.post = func(shared, params, result interface{}) (flowlib.Action, error) {
+		sharedMap, ok := shared.(map[string]interface{})
+		paramsMap, _ := params.(map[string]interface{})
+		if ok {
+			outputKey, _ := paramsMap["output_key"].(string)
+			if outputKey == "" {
+				outputKey = defaultVectorOutputKey
+			}
+			sharedMap[outputKey] = result
+		}
+		return flowlib.DefaultAction, nil
+	}
+
+	// Set the parameters
+	wrapper.SetParams(params)
+
+	return wrapper, nil
+}
@@ -0,0 +1,222 @@
+package runtime_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+func TestInMemoryVectorIndex(t *testing.T) {
+	index := runtime.NewInMemoryVectorIndex()
+	require.NoError(t, index.Upsert("acct", "docs", []runtime.VectorRecord{
+		{ID: "a", Vector: []float64{1, 0}, Text: "alpha", Metadata: map[string]interface{}{"lang": "en", "year": 2024.0}},
+		{ID: "b", Vector: []float64{0.8, 0.6}, Text: "beta", Metadata: map[string]interface{}{"lang": "de"}},
+		{ID: "c", Vector: []float64{0, 1}, Text: "gamma", Metadata: map[string]interface{}{"lang": "en"}},
+	}))
+
+	matches, err := index.Query("acct", "docs", []float64{1, 0}, 2, nil)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "a", matches[0].ID)
+	assert.InDelta(t, 1.0, matches[0].Score, 1e-9)
+	assert.Equal(t, "b", matches[1].ID)
+	assert.InDelta(t, 0.8, matches[1].Score, 1e-9)
+
+	// Filters match metadata entries, whatever the number type
+	matches, err = index.Query("acct", "docs", []float64{1, 0}, 5, map[string]interface{}{"lang": "en", "year": 2024})
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, "a", matches[0].ID)
+
+	// Upserts replace records with the same ID
+	require.NoError(t, index.Upsert("acct", "docs", []runtime.VectorRecord{{ID: "c", Vector: []float64{1, 0.1}, Text: "gamma 2"}}))
+	matches, err = index.Query("acct", "docs", []float64{0, 1}, 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "b", matches[0].ID)
+
+	// Collections are scoped to their account
+	matches, err = index.Query("other", "docs", []float64{1, 0}, 5, nil)
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	// Vectors of a collection share their dimensions
+	assert.Error(t, index.Upsert("acct", "docs", []runtime.VectorRecord{{ID: "d", Vector: []float64{1, 0, 0}}}))
+	_, err = index.Query("acct", "docs", []float64{1, 0, 0}, 5, nil)
+	assert.Error(t, err)
+
+	deleted, err := index.Delete("acct", "docs", []string{"a", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	matches, err = index.Query("acct", "docs", []float64{1, 0}, 5, nil)
+	require.NoError(t, err)
+	assert.Len(t, matches, 2)
+}
+
+// newRAGProvider serves embeddings placing texts on axes by topic, and chat
+// completions answering with the prompt they were sent
+func newRAGProvider(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var prompts []string
+	embed := func(text string) []float64 {
+		text = strings.ToLower(text)
+		switch {
+		case strings.Contains(text, "refund"):
+			return []float64{1, 0.1, 0}
+		case strings.Contains(text, "shipping"):
+			return []float64{0, 1, 0.1}
+		}
+		return []float64{0.1, 0, 1}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/embeddings":
+			var body struct {
+				Input []string `json:"input"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			var data []map[string]interface{}
+			for i, text := range body.Input {
+				data = append(data, map[string]interface{}{"index": i, "embedding": embed(text)})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "usage": map[string]int{"prompt_tokens": len(body.Input), "total_tokens": len(body.Input)}})
+		case "/chat/completions":
+			var body struct {
+				Messages []utils.Message `json:"messages"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			prompt := body.Messages[len(body.Messages)-1].Content
+			mu.Lock()
+			prompts = append(prompts, prompt)
+			mu.Unlock()
+			content, _ := json.Marshal("answered")
+			fmt.Fprint(w, completionWith(string(content)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), prompts...)
+	}
+}
+
+func TestVectorNode_RetrievalFlow(t *testing.T) {
+	server, prompts := newRAGProvider(t)
+
+	embedding := map[string]interface{}{
+		"provider": "ollama",
+		"model":    "nomic-embed-text",
+		"options":  map[string]interface{}{"base_url": server.URL},
+	}
+	flowRuntime := newCoreRuntime(t, nil, map[string]testFlow{"rag": {
+		Metadata: map[string]interface{}{"name": "rag"},
+		Nodes: map[string]testNode{
+			"index": {
+				Type: "vector",
+				Params: map[string]interface{}{
+					"operation":  "upsert",
+					"collection": "faq",
+					"embedding":  embedding,
+					"documents": []interface{}{
+						map[string]interface{}{"id": "refunds", "text": "Refunds are paid within 14 days.", "metadata": map[string]interface{}{"topic": "billing"}},
+						map[string]interface{}{"id": "shipping", "text": "Shipping takes 3 days.", "metadata": map[string]interface{}{"topic": "delivery"}},
+						map[string]interface{}{"id": "hours", "text": "We are open 9 to 5."},
+					},
+				},
+				Next: map[string]string{"default": "retrieve"},
+			},
+			"retrieve": {
+				Type: "vector",
+				Params: map[string]interface{}{
+					"operation":  "query",
+					"collection": "faq",
+					"query":      "How do refunds work?",
+					"top_k":      2,
+					"min_score":  0.5,
+					"embedding":  embedding,
+				},
+				Next: map[string]string{"default": "answer"},
+			},
+			"answer": {
+				Type: "llm",
+				Params: map[string]interface{}{
+					"provider": "ollama",
+					"model":    "llama3",
+					"template": "Answer from these documents:\n{{range .retrieval.matches}}- {{.text}} ({{.id}})\n{{end}}",
+					"options":  map[string]interface{}{"base_url": server.URL},
+				},
+			},
+		},
+	}})
+
+	executionID, err := flowRuntime.Execute("test-account", "rag", map[string]interface{}{})
+	require.NoError(t, err)
+	status := waitForCompletion(t, flowRuntime, executionID)
+	require.Equal(t, "completed", status.Status, status.Error)
+
+	// The best match is placed into the prompt; the others score below
+	// min_score
+	require.Equal(t, []string{"Answer from these documents:\n- Refunds are paid within 14 days. (refunds)\n"}, prompts())
+
+	// Embedding requests count towards usage
+	require.NotNil(t, status.Usage)
+	assert.Equal(t, 2, status.Usage.Models["ollama/nomic-embed-text"].Requests)
+	assert.Equal(t, 4, status.Usage.Models["ollama/nomic-embed-text"].PromptTokens)
+}
+
+func TestVectorNode_Operations(t *testing.T) {
+	run := func(params map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+		node, err := runtime.NewVectorNodeWrapper(params)
+		require.NoError(t, err)
+		shared := map[string]interface{}{}
+		if _, err := node.Run(shared); err != nil {
+			return nil, shared, err
+		}
+		return shared["result"].(map[string]interface{}), shared, nil
+	}
+
+	result, _, err := run(map[string]interface{}{
+		"operation":  "upsert",
+		"collection": "operations-test",
+		"documents": []interface{}{
+			map[string]interface{}{"id": "x", "vector": []interface{}{1.0, 0.0}, "text": "x axis"},
+			map[string]interface{}{"id": "y", "vector": []interface{}{0.0, 1.0}, "text": "y axis"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result["upserted"])
+
+	result, shared, err := run(map[string]interface{}{
+		"operation":  "query",
+		"collection": "operations-test",
+		"vector":     []interface{}{0.9, 0.1},
+		"top_k":      1,
+		"output_key": "nearest",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "x axis", result["context"])
+	assert.Equal(t, result, shared["nearest"])
+
+	result, _, err = run(map[string]interface{}{"operation": "delete", "collection": "operations-test", "ids": []interface{}{"x", "y"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result["deleted"])
+
+	_, _, err = run(map[string]interface{}{"operation": "query", "collection": "operations-test", "query": "text"})
+	assert.EqualError(t, err, "embedding parameter is required to embed the query")
+	_, _, err = run(map[string]interface{}{"operation": "query", "collection": "operations-test", "index": "faiss", "vector": []interface{}{1.0}})
+	assert.EqualError(t, err, `unknown vector index "faiss"`)
+}
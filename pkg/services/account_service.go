@@ -177,6 +177,39 @@ func (s *AccountService) ListAccounts() ([]auth.Account, error) {
 	return accounts, nil
 }
 
+// GetQuota returns the quota of an account, or nil when it has none
+func (s *AccountService) GetQuota(accountID string) (*auth.AccountQuota, error) {
+	account, err := s.GetAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return account.Quota, nil
+}
+
+// SetQuota replaces the quota of an account; nil removes it
+func (s *AccountService) SetQuota(accountID string, quota *auth.AccountQuota) error {
+	if quota != nil {
+		if quota.MaxExecutionsPerHour < 0 || quota.MaxConcurrentExecutions < 0 || quota.MaxDailyLLMSpend < 0 {
+			return fmt.Errorf("quota limits must not be negative")
+		}
+		if quota.SoftLimitPercent < 0 || quota.SoftLimitPercent > 100 {
+			return fmt.Errorf("soft limit percent must be between 0 and 100")
+		}
+	}
+
+	account, err := s.GetAccount(accountID)
+	if err != nil {
+		return err
+	}
+	account.Quota = quota
+	account.UpdatedAt = time.Now()
+
+	if err := s.store.SaveAccount(account); err != nil {
+		return fmt.Errorf("failed to save account: %w", err)
+	}
+	return nil
+}
+
 // generateAPIToken generates a secure random API token
 func generateAPIToken() (string, error) {
 	bytes := make([]byte, 32) // 256 bits
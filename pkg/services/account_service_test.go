@@ -209,6 +209,47 @@ func TestAccountService_GetAccount(t *testing.T) {
 	})
 }
 
+func TestAccountService_Quota(t *testing.T) {
+	store := storage.NewMemoryAccountStore()
+	service := NewAccountService(store)
+	var _ auth.QuotaManager = service
+
+	accountID, err := service.CreateAccount("testuser", "testpassword")
+	require.NoError(t, err)
+
+	quota, err := service.GetQuota(accountID)
+	require.NoError(t, err)
+	assert.Nil(t, quota)
+
+	t.Run("set and remove quota", func(t *testing.T) {
+		require.NoError(t, service.SetQuota(accountID, &auth.AccountQuota{MaxExecutionsPerHour: 10, MaxDailyLLMSpend: 5}))
+		quota, err := service.GetQuota(accountID)
+		require.NoError(t, err)
+		assert.Equal(t, &auth.AccountQuota{MaxExecutionsPerHour: 10, MaxDailyLLMSpend: 5}, quota)
+
+		// Other account settings are kept
+		_, err = service.Authenticate("testuser", "testpassword")
+		assert.NoError(t, err)
+
+		require.NoError(t, service.SetQuota(accountID, nil))
+		quota, err = service.GetQuota(accountID)
+		require.NoError(t, err)
+		assert.Nil(t, quota)
+	})
+
+	t.Run("invalid quota", func(t *testing.T) {
+		err := service.SetQuota(accountID, &auth.AccountQuota{MaxConcurrentExecutions: -1})
+		assert.Error(t, err)
+		err = service.SetQuota(accountID, &auth.AccountQuota{SoftLimitPercent: 120})
+		assert.Error(t, err)
+	})
+
+	t.Run("non-existent account", func(t *testing.T) {
+		err := service.SetQuota("non-existent", &auth.AccountQuota{})
+		assert.Error(t, err)
+	})
+}
+
 func TestAccountService_DeleteAccount(t *testing.T) {
 	store := storage.NewMemoryAccountStore()
 	service := NewAccountService(store)
@@ -146,9 +146,6 @@ func (s *ExtendedSecretVaultService) GetStructured(accountID string, key string)
 		}
 	}
 
-	// Mark as used
-	s.MarkUsed(accountID, key)
-
 	return auth.StructuredSecret{
 		AccountID: accountID,
 		Key:       key,
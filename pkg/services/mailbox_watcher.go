@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+	"github.com/tcmartin/flowrunner/pkg/utils"
+)
+
+// Defaults of mailbox watchers
+const (
+	DefaultMailboxPollInterval   = time.Minute
+	DefaultMailboxReconnectDelay = 30 * time.Second
+)
+
+// FlowExecutor starts flow executions
+type FlowExecutor interface {
+	// Execute runs a flow with the given input and returns the execution ID
+	Execute(accountID string, flowID string, input map[string]interface{}) (string, error)
+}
+
+// MailboxWatch configures a mailbox watcher
+type MailboxWatch struct {
+	// ID keys the progress of the watcher in the state store
+	ID string
+
+	// Account is the ID or username of the account running the flow
+	Account string
+
+	// FlowID is the flow started for each new message
+	FlowID string
+
+	// Host, Port and Security ("tls", "starttls" or "none") locate the
+	// IMAP server
+	Host     string
+	Port     int
+	Security string
+
+	// Username and Password log in to the server; PasswordSecret names a
+	// secret of the account holding the password instead
+	Username       string
+	Password       string
+	PasswordSecret string
+
+	// Folders are watched on a connection each (default INBOX)
+	Folders []string
+
+	// PollInterval is how often folders are checked when IDLE reports
+	// nothing, and how often servers without IDLE are polled
+	PollInterval time.Duration
+
+	// ReconnectDelay is the wait before reconnecting after a failure
+	ReconnectDelay time.Duration
+
+	// ProcessExisting starts flows for the messages already in a folder
+	// when it is first watched, instead of only for new ones
+	ProcessExisting bool
+}
+
+// MailboxWatcher starts a flow execution for each new message of IMAP
+// folders. It waits for messages with IDLE, and records the last UID
+// processed in each folder so that no message is processed twice across
+// restarts.
+type MailboxWatcher struct {
+	watch    MailboxWatch
+	accounts auth.AccountService
+	vault    auth.SecretVault
+	flows    FlowExecutor
+	states   storage.MailboxStateStore
+}
+
+// NewMailboxWatcher creates a watcher starting flows of the watch's account
+func NewMailboxWatcher(watch MailboxWatch, accounts auth.AccountService, vault auth.SecretVault, flows FlowExecutor, states storage.MailboxStateStore) *MailboxWatcher {
+	if len(watch.Folders) == 0 {
+		watch.Folders = []string{"INBOX"}
+	}
+	if watch.Port == 0 {
+		watch.Port = 993
+		if watch.Security == "starttls" || watch.Security == "none" {
+			watch.Port = 143
+		}
+	}
+	if watch.PollInterval <= 0 {
+		watch.PollInterval = DefaultMailboxPollInterval
+	}
+	if watch.ReconnectDelay <= 0 {
+		watch.ReconnectDelay = DefaultMailboxReconnectDelay
+	}
+	return &MailboxWatcher{
+		watch:    watch,
+		accounts: accounts,
+		vault:    vault,
+		flows:    flows,
+		states:   states,
+	}
+}
+
+// Run watches the folders until ctx is done
+func (w *MailboxWatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, folder := range w.watch.Folders {
+		wg.Add(1)
+		go func(folder string) {
+			defer wg.Done()
+			w.watchFolder(ctx, folder)
+		}(folder)
+	}
+	wg.Wait()
+}
+
+// watchFolder runs sessions on a folder, reconnecting after failures,
+// until ctx is done
+func (w *MailboxWatcher) watchFolder(ctx context.Context, folder string) {
+	for {
+		err := w.session(ctx, folder)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Mailbox watcher %s failed on %s: %v", w.watch.ID, folder, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.watch.ReconnectDelay):
+		}
+	}
+}
+
+// session connects to the server and processes the new messages of a
+// folder as they arrive, until the connection fails or ctx is done
+func (w *MailboxWatcher) session(ctx context.Context, folder string) error {
+	accountID, password, err := w.credentials()
+	if err != nil {
+		return err
+	}
+
+	c, err := utils.DialIMAP(w.watch.Host, w.watch.Port, w.watch.Security, w.watch.Username, password)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	// Updates are drained for the whole connection, as the client blocks
+	// on them; new messages wake the session up
+	updates := make(chan client.Update, 16)
+	wake := make(chan struct{}, 1)
+	c.Updates = updates
+	go func() {
+		for {
+			select {
+			case update := <-updates:
+				if _, ok := update.(*client.MailboxUpdate); ok {
+					select {
+					case wake <- struct{}{}:
+					default:
+					}
+				}
+			case <-c.LoggedOut():
+				return
+			}
+		}
+	}()
+
+	status, err := c.Select(folder, true)
+	if err != nil {
+		return fmt.Errorf("failed to select folder: %w", err)
+	}
+	state, err := w.startState(c, folder, status)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := w.processNew(ctx, c, accountID, &state); err != nil {
+			return err
+		}
+		if err := w.idle(ctx, c, wake); err != nil {
+			return err
+		}
+	}
+}
+
+// credentials resolves the account running the flows and the password of
+// the server, read again on each connection so that changes apply
+func (w *MailboxWatcher) credentials() (string, string, error) {
+	accounts, err := w.accounts.ListAccounts()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list accounts: %w", err)
+	}
+	accountID := ""
+	for _, account := range accounts {
+		if account.ID == w.watch.Account || account.Username == w.watch.Account {
+			accountID = account.ID
+			break
+		}
+	}
+	if accountID == "" {
+		return "", "", fmt.Errorf("account %s not found", w.watch.Account)
+	}
+
+	password := w.watch.Password
+	if w.watch.PasswordSecret != "" {
+		password, err = w.vault.Get(accountID, w.watch.PasswordSecret)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get secret %s: %w", w.watch.PasswordSecret, err)
+		}
+	}
+	return accountID, password, nil
+}
+
+// startState returns the stored progress of the folder, or starts it
+// when the folder is watched for the first time or its UIDs changed
+func (w *MailboxWatcher) startState(c *client.Client, folder string, status *imap.MailboxStatus) (storage.MailboxState, error) {
+	state, err := w.states.GetMailboxState(w.watch.ID, folder)
+	if err == nil && state.UIDValidity == status.UidValidity {
+		return state, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrMailboxStateNotFound) {
+		return storage.MailboxState{}, err
+	}
+	if err == nil {
+		log.Printf("Mailbox watcher %s: UIDs of %s changed, starting over", w.watch.ID, folder)
+	}
+
+	state = storage.MailboxState{
+		WatcherID:   w.watch.ID,
+		Folder:      folder,
+		UIDValidity: status.UidValidity,
+		UpdatedAt:   time.Now(),
+	}
+	if !w.watch.ProcessExisting {
+		if status.UidNext > 0 {
+			state.LastUID = status.UidNext - 1
+		} else if uids, err := utils.SearchUIDsAfter(c, 0); err != nil {
+			return storage.MailboxState{}, err
+		} else if len(uids) > 0 {
+			state.LastUID = uids[len(uids)-1]
+		}
+	}
+	if err := w.states.SaveMailboxState(state); err != nil {
+		return storage.MailboxState{}, err
+	}
+	return state, nil
+}
+
+// processNew starts a flow for each message above the last UID processed,
+// recording each one as it goes. A message whose flow fails to start
+// fails the session, so that it is retried after reconnecting.
+func (w *MailboxWatcher) processNew(ctx context.Context, c *client.Client, accountID string, state *storage.MailboxState) error {
+	uids, err := utils.SearchUIDsAfter(c, state.LastUID)
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		email, err := utils.FetchEmailByUID(c, uid)
+		if err != nil {
+			return err
+		}
+		email.Metadata["folder"] = state.Folder
+
+		input, err := mailboxFlowInput(w.watch.ID, email)
+		if err != nil {
+			return err
+		}
+		if _, err := w.flows.Execute(accountID, w.watch.FlowID, input); err != nil {
+			return fmt.Errorf("failed to start flow %s for message %d: %w", w.watch.FlowID, uid, err)
+		}
+
+		state.LastUID = uid
+		state.UpdatedAt = time.Now()
+		if err := w.states.SaveMailboxState(*state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idle waits with IDLE until the server reports new messages, the poll
+// interval elapses or ctx is done
+func (w *MailboxWatcher) idle(ctx context.Context, c *client.Client, wake <-chan struct{}) error {
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stop, &client.IdleOptions{PollInterval: w.watch.PollInterval})
+	}()
+
+	timer := time.NewTimer(w.watch.PollInterval)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			err = fmt.Errorf("IDLE ended unexpectedly")
+		}
+		return err
+	case <-wake:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// mailboxFlowInput returns the input of the flow started for a message:
+// the message in the JSON form of utils.EmailMessage, and the watcher ID.
+// Attachment contents are kept as bytes, which runtimes keeping artifacts
+// store as artifacts.
+func mailboxFlowInput(watcherID string, email utils.EmailMessage) (map[string]interface{}, error) {
+	data, err := json.Marshal(email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	if attachments, ok := message["attachments"].([]interface{}); ok {
+		for i, attachment := range attachments {
+			attachment.(map[string]interface{})["content"] = email.Attachments[i].Content
+		}
+	}
+	return map[string]interface{}{
+		"email":   message,
+		"watcher": watcherID,
+	}, nil
+}
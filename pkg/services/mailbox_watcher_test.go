@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+// notifyingBackend is an in-memory IMAP backend that notifies the
+// connections of the updates sent on its channel
+type notifyingBackend struct {
+	*memory.Backend
+	updates chan backend.Update
+}
+
+func (b *notifyingBackend) Updates() <-chan backend.Update {
+	return b.updates
+}
+
+// recordingExecutor records the inputs of the flows it starts
+type recordingExecutor struct {
+	mu     sync.Mutex
+	inputs []map[string]interface{}
+}
+
+func (e *recordingExecutor) Execute(accountID, flowID string, input map[string]interface{}) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.inputs = append(e.inputs, input)
+	return "exec-1", nil
+}
+
+func (e *recordingExecutor) subjects() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	subjects := make([]string, len(e.inputs))
+	for i, input := range e.inputs {
+		subjects[i] = input["email"].(map[string]interface{})["subject"].(string)
+	}
+	return subjects
+}
+
+// appendMessage adds a message to the INBOX of the backend and notifies
+// the connections when asked
+func appendMessage(t *testing.T, be *notifyingBackend, raw string, notify bool) {
+	t.Helper()
+	user, err := be.Login(nil, "username", "password")
+	require.NoError(t, err)
+	mailbox, err := user.GetMailbox("INBOX")
+	require.NoError(t, err)
+	require.NoError(t, mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(strings.ReplaceAll(raw, "\n", "\r\n"))))
+
+	if notify {
+		status, err := mailbox.Status([]imap.StatusItem{imap.StatusMessages})
+		require.NoError(t, err)
+		be.updates <- &backend.MailboxUpdate{Update: backend.NewUpdate("username", "INBOX"), MailboxStatus: status}
+	}
+}
+
+const attachmentMessage = `From: Ada Lovelace <ada@example.com>
+To: support@example.com
+Subject: Invoice
+Message-Id: <invoice-1@example.com>
+Content-Type: multipart/mixed; boundary=frontier
+
+--frontier
+Content-Type: text/plain; charset=utf-8
+
+Please find the invoice attached.
+--frontier
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="invoice.pdf"
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQ=
+--frontier--
+`
+
+func TestMailboxWatcher(t *testing.T) {
+	be := &notifyingBackend{Backend: memory.New(), updates: make(chan backend.Update, 1)}
+	imapServer := server.New(be)
+	imapServer.AllowInsecureAuth = true
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go imapServer.Serve(listener)
+	defer imapServer.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	provider := storage.NewMemoryProvider()
+	accounts := NewAccountService(provider.GetAccountStore())
+	accountID, err := accounts.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := NewExtendedSecretVaultService(provider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+	require.NoError(t, vault.Set(accountID, "imap_password", "password"))
+	states := provider.GetMailboxStateStore()
+
+	// The poll interval is long, so new messages are seen through IDLE
+	watch := MailboxWatch{
+		ID:             "support",
+		Account:        "testuser",
+		FlowID:         "triage",
+		Host:           "127.0.0.1",
+		Port:           port,
+		Security:       "none",
+		Username:       "username",
+		PasswordSecret: "imap_password",
+		PollInterval:   time.Hour,
+	}
+	start := func(executor *recordingExecutor) (context.CancelFunc, chan struct{}) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			NewMailboxWatcher(watch, accounts, vault, executor, states).Run(ctx)
+			close(stopped)
+		}()
+		return cancel, stopped
+	}
+
+	executor := &recordingExecutor{}
+	cancel, stopped := start(executor)
+	require.Eventually(t, func() bool {
+		_, err := states.GetMailboxState("support", "INBOX")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Messages already in the folder are skipped; new ones start a flow each
+	appendMessage(t, be, attachmentMessage, true)
+	require.Eventually(t, func() bool { return len(executor.subjects()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	email := executor.inputs[0]["email"].(map[string]interface{})
+	assert.Equal(t, "support", executor.inputs[0]["watcher"])
+	assert.Equal(t, "Ada Lovelace <ada@example.com>", email["from"])
+	assert.Equal(t, []interface{}{"support@example.com"}, email["to"])
+	assert.Equal(t, "<invoice-1@example.com>", email["message_id"])
+	assert.Equal(t, "Please find the invoice attached.", email["body"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"filename":     "invoice.pdf",
+		"content_type": "application/pdf",
+		"content":      []byte("%PDF-1.4"),
+	}}, email["attachments"])
+	metadata := email["metadata"].(map[string]interface{})
+	assert.Equal(t, "INBOX", metadata["folder"])
+	assert.Equal(t, false, metadata["seen"])
+
+	appendMessage(t, be, "From: bob@example.com\nSubject: Second\n\nHello\n", true)
+	require.Eventually(t, func() bool { return len(executor.subjects()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-stopped
+
+	// After a restart, only the messages that arrived meanwhile are processed
+	appendMessage(t, be, "From: bob@example.com\nSubject: Third\n\nHello again\n", false)
+	restarted := &recordingExecutor{}
+	cancel, stopped = start(restarted)
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	require.Eventually(t, func() bool { return len(restarted.subjects()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"Third"}, restarted.subjects())
+	assert.Equal(t, []string{"Invoice", "Second"}, executor.subjects())
+
+	state, err := states.GetMailboxState("support", "INBOX")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(9), state.LastUID)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+)
+
+// OAuthRefresher renews the access tokens of OAuth secrets before they
+// expire, so that flows never wait on a token endpoint
+type OAuthRefresher struct {
+	accounts auth.AccountService
+	vault    auth.ExtendedSecretVault
+	leeway   time.Duration
+}
+
+// NewOAuthRefresher creates a refresher renewing tokens expiring within
+// leeway
+func NewOAuthRefresher(accounts auth.AccountService, vault auth.ExtendedSecretVault, leeway time.Duration) *OAuthRefresher {
+	if leeway <= 0 {
+		leeway = auth.DefaultOAuthRefreshLeeway
+	}
+	return &OAuthRefresher{
+		accounts: accounts,
+		vault:    vault,
+		leeway:   leeway,
+	}
+}
+
+// RefreshDue renews the tokens of all accounts that expire within the
+// leeway and returns how many were renewed. Secrets that fail are logged
+// and retried on the next run.
+func (r *OAuthRefresher) RefreshDue(ctx context.Context) (int, error) {
+	accounts, err := r.accounts.ListAccounts()
+	if err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, account := range accounts {
+		secrets, err := r.vault.ListByType(account.ID, auth.SecretTypeOAuth)
+		if err != nil {
+			log.Printf("Failed to list OAuth secrets of account %s: %v", account.ID, err)
+			continue
+		}
+		for _, secret := range secrets {
+			oauth, _, err := auth.GetOAuth(r.vault, account.ID, secret.Key)
+			if err != nil {
+				log.Printf("Failed to read OAuth secret %s of account %s: %v", secret.Key, account.ID, err)
+				continue
+			}
+			// Only tokens that expire and can be renewed are refreshed ahead
+			if oauth.RefreshToken == "" || oauth.ExpiresAt == nil || !oauth.NeedsRefresh(r.leeway) {
+				continue
+			}
+			if _, err := auth.ValidOAuthToken(ctx, r.vault, account.ID, secret.Key, r.leeway); err != nil {
+				log.Printf("Failed to refresh OAuth secret %s of account %s: %v", secret.Key, account.ID, err)
+				continue
+			}
+			refreshed++
+		}
+	}
+	return refreshed, nil
+}
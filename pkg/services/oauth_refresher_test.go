@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tcmartin/flowrunner/pkg/auth"
+	"github.com/tcmartin/flowrunner/pkg/storage"
+)
+
+func TestOAuthRefresher_RefreshDue(t *testing.T) {
+	var grants []string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client-1", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret-1", r.PostForm.Get("client_secret"))
+		grants = append(grants, r.PostForm.Get("grant_type")+" "+r.PostForm.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-2",
+			"refresh_token": "refresh-2",
+			"expires_in":    3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	provider := storage.NewMemoryProvider()
+	accounts := NewAccountService(provider.GetAccountStore())
+	accountID, err := accounts.CreateAccount("testuser", "testpass")
+	require.NoError(t, err)
+	vault, err := NewExtendedSecretVaultService(provider.GetSecretStore(), []byte("test-encryption-key-32-bytes-123"))
+	require.NoError(t, err)
+
+	soon := time.Now().Add(time.Minute)
+	later := time.Now().Add(time.Hour)
+	for key, expiresAt := range map[string]time.Time{"expiring": soon, "fresh": later} {
+		require.NoError(t, vault.SetOAuth(accountID, key, auth.OAuthSecret{
+			ClientID:     "client-1",
+			ClientSecret: "secret-1",
+			TokenURL:     tokenServer.URL,
+			AccessToken:  "access-1",
+			RefreshToken: "refresh-1",
+			ExpiresAt:    &expiresAt,
+		}, auth.SecretMetadata{Description: key}))
+	}
+
+	refresher := NewOAuthRefresher(accounts, vault, 5*time.Minute)
+	refreshed, err := refresher.RefreshDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, refreshed)
+	assert.Equal(t, []string{"refresh_token refresh-1"}, grants)
+
+	// The renewed tokens are stored, keeping the metadata
+	oauth, metadata, err := auth.GetOAuth(vault, accountID, "expiring")
+	require.NoError(t, err)
+	assert.Equal(t, "access-2", oauth.AccessToken)
+	assert.Equal(t, "refresh-2", oauth.RefreshToken)
+	assert.True(t, oauth.ExpiresAt.After(later.Add(-time.Minute)))
+	assert.Equal(t, "expiring", metadata.Description)
+
+	oauth, _, err = auth.GetOAuth(vault, accountID, "fresh")
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", oauth.AccessToken)
+
+	// Nothing is due any more
+	refreshed, err = refresher.RefreshDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, refreshed)
+	assert.Len(t, grants, 1)
+}
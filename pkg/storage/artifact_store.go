@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// artifactDigestPrefix prefixes the digests of artifact blobs
+const artifactDigestPrefix = "sha256:"
+
+// artifactID matches the execution and artifact IDs used in blob store keys
+var artifactID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parseArtifactDigest returns the hex SHA-256 of a blob digest
+func parseArtifactDigest(digest string) (string, error) {
+	sum, ok := strings.CutPrefix(digest, artifactDigestPrefix)
+	if !ok || len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid artifact digest %q", digest)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("invalid artifact digest %q", digest)
+	}
+	return sum, nil
+}
+
+// checkArtifactIDs rejects IDs that cannot be used in blob store keys
+func checkArtifactIDs(ids ...string) error {
+	for _, id := range ids {
+		if !artifactID.MatchString(id) {
+			return fmt.Errorf("invalid artifact ID %q", id)
+		}
+	}
+	return nil
+}
+
+// spoolBlob copies content to a temporary file in dir, hashing it, and
+// returns the file positioned at its start with the digest and size
+func spoolBlob(dir string, content io.Reader) (*os.File, string, int64, error) {
+	file, err := os.CreateTemp(dir, "blob-*")
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to create blob file: %w", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	return file, artifactDigestPrefix + hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// sortArtifacts orders artifacts by creation
+func sortArtifacts(artifacts []runtime.Artifact) {
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].CreatedAt.Equal(artifacts[j].CreatedAt) {
+			return artifacts[i].ID < artifacts[j].ID
+		}
+		return artifacts[i].CreatedAt.Before(artifacts[j].CreatedAt)
+	})
+}
+
+// FileArtifactStore implements runtime.ArtifactStore on the local
+// filesystem. Blobs are kept under blobs/sha256 and the artifacts of each
+// execution as JSON files under executions/<execution ID>.
+type FileArtifactStore struct {
+	root string
+}
+
+// NewFileArtifactStore creates an artifact store in the directory, which is
+// created if missing
+func NewFileArtifactStore(root string) (*FileArtifactStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("artifact directory is required")
+	}
+	for _, dir := range []string{"blobs", "executions", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+		}
+	}
+	return &FileArtifactStore{root: root}, nil
+}
+
+func (s *FileArtifactStore) blobPath(sum string) string {
+	return filepath.Join(s.root, "blobs", "sha256", sum[:2], sum)
+}
+
+// PutBlob stores the content, once for any number of identical contents
+func (s *FileArtifactStore) PutBlob(content io.Reader) (string, int64, error) {
+	file, digest, size, err := spoolBlob(filepath.Join(s.root, "tmp"), content)
+	if err != nil {
+		return "", 0, err
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	blobPath := s.blobPath(strings.TrimPrefix(digest, artifactDigestPrefix))
+	if _, err := os.Stat(blobPath); err == nil {
+		return digest, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := os.Rename(file.Name(), blobPath); err != nil {
+		return "", 0, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return digest, size, nil
+}
+
+// OpenBlob opens the content of a blob
+func (s *FileArtifactStore) OpenBlob(digest string) (io.ReadCloser, error) {
+	sum, err := parseArtifactDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(s.blobPath(sum))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, runtime.ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return file, nil
+}
+
+// SaveArtifact records an artifact of an execution
+func (s *FileArtifactStore) SaveArtifact(artifact runtime.Artifact) error {
+	if err := checkArtifactIDs(artifact.ExecutionID, artifact.ID); err != nil {
+		return err
+	}
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		return fmt.Errorf("failed to marshal artifact: %w", err)
+	}
+	dir := filepath.Join(s.root, "executions", artifact.ExecutionID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, artifact.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to save artifact: %w", err)
+	}
+	return nil
+}
+
+// GetArtifact returns an artifact of an execution
+func (s *FileArtifactStore) GetArtifact(executionID, id string) (runtime.Artifact, error) {
+	if err := checkArtifactIDs(executionID, id); err != nil {
+		return runtime.Artifact{}, runtime.ErrArtifactNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.root, "executions", executionID, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return runtime.Artifact{}, runtime.ErrArtifactNotFound
+	}
+	if err != nil {
+		return runtime.Artifact{}, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	var artifact runtime.Artifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return runtime.Artifact{}, fmt.Errorf("failed to unmarshal artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// ListArtifacts returns the artifacts of an execution in order of creation
+func (s *FileArtifactStore) ListArtifacts(executionID string) ([]runtime.Artifact, error) {
+	if err := checkArtifactIDs(executionID); err != nil {
+		return []runtime.Artifact{}, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(s.root, "executions", executionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return []runtime.Artifact{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	artifacts := make([]runtime.Artifact, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		artifact, err := s.GetArtifact(executionID, id)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	sortArtifacts(artifacts)
+	return artifacts, nil
+}
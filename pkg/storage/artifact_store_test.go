@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// fakeS3 serves the object operations of a single bucket from memory, with
+// path-style addressing
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "artifacts" {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		type object struct {
+			Key  string
+			Size int
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			Prefix      string
+			KeyCount    int
+			IsTruncated bool
+			Contents    []object
+		}{Name: bucket, Prefix: r.URL.Query().Get("prefix")}
+		for k, data := range f.objects {
+			if strings.HasPrefix(k, result.Prefix) {
+				result.Contents = append(result.Contents, object{Key: k, Size: len(data)})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		result.KeyCount = len(result.Contents)
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+		f.puts++
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+// testArtifactStore runs the behaviour every artifact store shares
+func testArtifactStore(t *testing.T, store runtime.ArtifactStore) {
+	// Identical contents share a blob
+	digest, size, err := store.PutBlob(strings.NewReader("quarterly report"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), size)
+	sum := sha256.Sum256([]byte("quarterly report"))
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), digest)
+	again, _, err := store.PutBlob(strings.NewReader("quarterly report"))
+	require.NoError(t, err)
+	assert.Equal(t, digest, again)
+
+	content, err := store.OpenBlob(digest)
+	require.NoError(t, err)
+	data, err := io.ReadAll(content)
+	content.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "quarterly report", string(data))
+
+	_, err = store.OpenBlob("sha256:" + strings.Repeat("0", 64))
+	assert.ErrorIs(t, err, runtime.ErrArtifactNotFound)
+	_, err = store.OpenBlob("sha256:../../etc/passwd")
+	assert.Error(t, err)
+
+	// Artifacts are listed per execution in order of creation
+	created := time.Now().UTC().Truncate(time.Second)
+	report := runtime.Artifact{ID: "b-report", ExecutionID: "exec-1", AccountID: "account-1", Name: "report.txt", ContentType: "text/plain", Size: size, Digest: digest, CreatedAt: created}
+	copied := runtime.Artifact{ID: "a-copy", ExecutionID: "exec-1", AccountID: "account-1", ContentType: "text/plain", Size: size, Digest: digest, CreatedAt: created.Add(time.Second)}
+	other := runtime.Artifact{ID: "c-other", ExecutionID: "exec-2", AccountID: "account-1", ContentType: "text/plain", Size: size, Digest: digest, CreatedAt: created}
+	for _, artifact := range []runtime.Artifact{copied, report, other} {
+		require.NoError(t, store.SaveArtifact(artifact))
+	}
+
+	saved, err := store.GetArtifact("exec-1", "b-report")
+	require.NoError(t, err)
+	assert.Equal(t, report, saved)
+	_, err = store.GetArtifact("exec-2", "b-report")
+	assert.ErrorIs(t, err, runtime.ErrArtifactNotFound)
+	_, err = store.GetArtifact("exec-1", "../exec-2/c-other")
+	assert.ErrorIs(t, err, runtime.ErrArtifactNotFound)
+
+	artifacts, err := store.ListArtifacts("exec-1")
+	require.NoError(t, err)
+	assert.Equal(t, []runtime.Artifact{report, copied}, artifacts)
+	artifacts, err = store.ListArtifacts("exec-3")
+	require.NoError(t, err)
+	assert.Empty(t, artifacts)
+
+	assert.Error(t, store.SaveArtifact(runtime.Artifact{ID: "../escape", ExecutionID: "exec-1"}))
+}
+
+func TestFileArtifactStore(t *testing.T) {
+	store, err := NewFileArtifactStore(t.TempDir())
+	require.NoError(t, err)
+	testArtifactStore(t, store)
+}
+
+func TestS3ArtifactStore(t *testing.T) {
+	s3 := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	store, err := NewS3ArtifactStore(S3ArtifactStoreConfig{
+		Bucket:    "artifacts",
+		Prefix:    "flowrunner/",
+		Region:    "us-east-1",
+		AccessKey: "key",
+		SecretKey: "secret",
+		Endpoint:  server.URL,
+		PathStyle: true,
+	})
+	require.NoError(t, err)
+	testArtifactStore(t, store)
+
+	// The blob was uploaded once, next to the three artifact records
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+	assert.Equal(t, 4, s3.puts)
+	blobs := 0
+	for key, data := range s3.objects {
+		assert.True(t, strings.HasPrefix(key, "flowrunner/"), key)
+		if strings.HasPrefix(key, "flowrunner/blobs/sha256/") {
+			blobs++
+			assert.True(t, bytes.Equal([]byte("quarterly report"), data))
+		}
+	}
+	assert.Equal(t, 1, blobs)
+}
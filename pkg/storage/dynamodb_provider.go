@@ -3,6 +3,7 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
@@ -26,6 +27,12 @@ type DynamoDBProvider struct {
 	executionStore *DynamoDBExecutionStore
 	accountStore   *DynamoDBAccountStore
 	tablePrefix    string
+
+	conversationStore *DynamoDBConversationStore
+	promptStore       *DynamoDBPromptStore
+	llmCacheStore     *DynamoDBLLMCacheStore
+	mailboxStateStore *DynamoDBMailboxStateStore
+	checkpointStore   *DynamoDBCheckpointStore
 }
 
 // DynamoDBProviderConfig contains configuration for the DynamoDB provider
@@ -78,6 +85,11 @@ func NewDynamoDBProvider(config DynamoDBProviderConfig) (*DynamoDBProvider, erro
 	provider.secretStore = NewDynamoDBSecretStore(client, config.TablePrefix)
 	provider.executionStore = NewDynamoDBExecutionStore(client, config.TablePrefix)
 	provider.accountStore = NewDynamoDBAccountStore(client, config.TablePrefix)
+	provider.conversationStore = NewDynamoDBConversationStore(client, config.TablePrefix)
+	provider.promptStore = NewDynamoDBPromptStore(client, config.TablePrefix)
+	provider.llmCacheStore = NewDynamoDBLLMCacheStore(client, config.TablePrefix)
+	provider.mailboxStateStore = NewDynamoDBMailboxStateStore(client, config.TablePrefix)
+	provider.checkpointStore = NewDynamoDBCheckpointStore(client, config.TablePrefix)
 
 	return provider, nil
 }
@@ -96,6 +108,11 @@ func NewDynamoDBProviderWithClient(client dynamodbiface.DynamoDBAPI, tablePrefix
 	provider.secretStore = NewDynamoDBSecretStore(client, tablePrefix)
 	provider.executionStore = NewDynamoDBExecutionStore(client, tablePrefix)
 	provider.accountStore = NewDynamoDBAccountStore(client, tablePrefix)
+	provider.conversationStore = NewDynamoDBConversationStore(client, tablePrefix)
+	provider.promptStore = NewDynamoDBPromptStore(client, tablePrefix)
+	provider.llmCacheStore = NewDynamoDBLLMCacheStore(client, tablePrefix)
+	provider.mailboxStateStore = NewDynamoDBMailboxStateStore(client, tablePrefix)
+	provider.checkpointStore = NewDynamoDBCheckpointStore(client, tablePrefix)
 
 	return provider
 }
@@ -119,6 +136,25 @@ func (p *DynamoDBProvider) Initialize() error {
 		return fmt.Errorf("failed to initialize account store: %w", err)
 	}
 
+	if err := p.conversationStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize conversation store: %w", err)
+	}
+
+	if err := p.promptStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize prompt store: %w", err)
+	}
+
+	if err := p.llmCacheStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize LLM cache store: %w", err)
+	}
+
+	if err := p.mailboxStateStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize mailbox state store: %w", err)
+	}
+	if err := p.checkpointStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize checkpoint store: %w", err)
+	}
+
 	return nil
 }
 
@@ -148,6 +184,31 @@ func (p *DynamoDBProvider) GetAccountStore() AccountStore {
 	return p.accountStore
 }
 
+// GetConversationStore returns a store for conversation memory
+func (p *DynamoDBProvider) GetConversationStore() ConversationStore {
+	return p.conversationStore
+}
+
+// GetPromptStore returns a store for prompt templates
+func (p *DynamoDBProvider) GetPromptStore() PromptStore {
+	return p.promptStore
+}
+
+// GetLLMCacheStore returns a store for cached LLM responses
+func (p *DynamoDBProvider) GetLLMCacheStore() LLMCacheStore {
+	return p.llmCacheStore
+}
+
+// GetMailboxStateStore returns a store for the progress of mailbox watchers
+func (p *DynamoDBProvider) GetMailboxStateStore() MailboxStateStore {
+	return p.mailboxStateStore
+}
+
+// GetCheckpointStore returns a store for execution checkpoints
+func (p *DynamoDBProvider) GetCheckpointStore() CheckpointStore {
+	return p.checkpointStore
+}
+
 // DynamoDBFlowStore implements the FlowStore interface using DynamoDB
 type DynamoDBFlowStore struct {
 	client      dynamodbiface.DynamoDBAPI
@@ -1114,6 +1175,30 @@ func (s *DynamoDBExecutionStore) SaveExecution(execution runtime.ExecutionStatus
 
 	av["Progress"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatFloat(execution.Progress, 'f', -1, 64))}
 
+	if len(execution.Input) > 0 {
+		input, err := dynamodbattribute.MarshalMap(execution.Input)
+		if err != nil {
+			return fmt.Errorf("failed to marshal execution input: %w", err)
+		}
+		av["Input"] = &dynamodb.AttributeValue{M: input}
+	}
+
+	if len(execution.Metadata) > 0 {
+		metadata, err := dynamodbattribute.MarshalMap(execution.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal execution metadata: %w", err)
+		}
+		av["Metadata"] = &dynamodb.AttributeValue{M: metadata}
+	}
+
+	if execution.Usage != nil {
+		usage, err := dynamodbattribute.MarshalMap(execution.Usage)
+		if err != nil {
+			return fmt.Errorf("failed to marshal execution usage: %w", err)
+		}
+		av["Usage"] = &dynamodb.AttributeValue{M: usage}
+	}
+
 	// Save execution
 	_, err := s.client.PutItem(&dynamodb.PutItemInput{
 		TableName: aws.String(s.execTableName),
@@ -1204,9 +1289,32 @@ func (s *DynamoDBExecutionStore) GetExecution(executionID string) (runtime.Execu
 		}
 	}
 
+	// Extract input if available
+	if v, ok := result.Item["Input"]; ok && v.M != nil {
+		input := make(map[string]interface{})
+		if err := dynamodbattribute.UnmarshalMap(v.M, &input); err == nil {
+			execution.Input = input
+		}
+	}
+
+	execution.Usage = unmarshalExecutionUsage(result.Item)
+
 	return execution, nil
 }
 
+// unmarshalExecutionUsage extracts the usage of an execution item, if any
+func unmarshalExecutionUsage(item map[string]*dynamodb.AttributeValue) *runtime.ExecutionUsage {
+	v, ok := item["Usage"]
+	if !ok || v.M == nil {
+		return nil
+	}
+	var usage runtime.ExecutionUsage
+	if err := dynamodbattribute.UnmarshalMap(v.M, &usage); err != nil {
+		return nil
+	}
+	return &usage
+}
+
 // ListExecutions returns all executions for an account
 func (s *DynamoDBExecutionStore) ListExecutions(accountID string) ([]runtime.ExecutionStatus, error) {
 	// Create query expression
@@ -1246,6 +1354,7 @@ func (s *DynamoDBExecutionStore) ListExecutions(accountID string) ([]runtime.Exe
 		execution := execItem.ExecutionStatus
 		execution.StartTime = time.Unix(execItem.StartTimeUnix, 0)
 		execution.EndTime = time.Unix(execItem.EndTimeUnix, 0)
+		execution.Usage = unmarshalExecutionUsage(item)
 
 		executions = append(executions, execution)
 	}
@@ -1464,12 +1573,13 @@ func (s *DynamoDBAccountStore) Initialize() error {
 func (s *DynamoDBAccountStore) SaveAccount(account auth.Account) error {
 	// Create DynamoDB-specific item structure
 	item := struct {
-		ID           string `json:"ID"`
-		Username     string `json:"Username"`
-		PasswordHash string `json:"PasswordHash"`
-		APIToken     string `json:"APIToken"`
-		CreatedAt    int64  `json:"CreatedAt"`
-		UpdatedAt    int64  `json:"UpdatedAt"`
+		ID           string             `json:"ID"`
+		Username     string             `json:"Username"`
+		PasswordHash string             `json:"PasswordHash"`
+		APIToken     string             `json:"APIToken"`
+		CreatedAt    int64              `json:"CreatedAt"`
+		UpdatedAt    int64              `json:"UpdatedAt"`
+		Quota        *auth.AccountQuota `json:"Quota,omitempty"`
 	}{
 		ID:           account.ID,
 		Username:     account.Username,
@@ -1477,6 +1587,7 @@ func (s *DynamoDBAccountStore) SaveAccount(account auth.Account) error {
 		APIToken:     account.APIToken,
 		CreatedAt:    account.CreatedAt.Unix(),
 		UpdatedAt:    account.UpdatedAt.Unix(),
+		Quota:        account.Quota,
 	}
 
 	// Marshal account
@@ -1520,12 +1631,13 @@ func (s *DynamoDBAccountStore) GetAccount(accountID string) (auth.Account, error
 
 	// Unmarshal account with explicit field mapping
 	var item struct {
-		ID           string `json:"ID"`
-		Username     string `json:"Username"`
-		PasswordHash string `json:"PasswordHash"`
-		APIToken     string `json:"APIToken"`
-		CreatedAt    int64  `json:"CreatedAt"`
-		UpdatedAt    int64  `json:"UpdatedAt"`
+		ID           string             `json:"ID"`
+		Username     string             `json:"Username"`
+		PasswordHash string             `json:"PasswordHash"`
+		APIToken     string             `json:"APIToken"`
+		CreatedAt    int64              `json:"CreatedAt"`
+		UpdatedAt    int64              `json:"UpdatedAt"`
+		Quota        *auth.AccountQuota `json:"Quota,omitempty"`
 	}
 	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
 		return auth.Account{}, fmt.Errorf("failed to unmarshal account: %w", err)
@@ -1539,6 +1651,7 @@ func (s *DynamoDBAccountStore) GetAccount(accountID string) (auth.Account, error
 		APIToken:     item.APIToken,
 		CreatedAt:    time.Unix(item.CreatedAt, 0),
 		UpdatedAt:    time.Unix(item.UpdatedAt, 0),
+		Quota:        item.Quota,
 	}
 
 	return account, nil
@@ -1572,12 +1685,13 @@ func (s *DynamoDBAccountStore) GetAccountByUsername(username string) (auth.Accou
 
 	// Unmarshal account with explicit field mapping
 	var item struct {
-		ID           string `json:"ID"`
-		Username     string `json:"Username"`
-		PasswordHash string `json:"PasswordHash"`
-		APIToken     string `json:"APIToken"`
-		CreatedAt    int64  `json:"CreatedAt"`
-		UpdatedAt    int64  `json:"UpdatedAt"`
+		ID           string             `json:"ID"`
+		Username     string             `json:"Username"`
+		PasswordHash string             `json:"PasswordHash"`
+		APIToken     string             `json:"APIToken"`
+		CreatedAt    int64              `json:"CreatedAt"`
+		UpdatedAt    int64              `json:"UpdatedAt"`
+		Quota        *auth.AccountQuota `json:"Quota,omitempty"`
 	}
 	if err := dynamodbattribute.UnmarshalMap(result.Items[0], &item); err != nil {
 		return auth.Account{}, fmt.Errorf("failed to unmarshal account: %w", err)
@@ -1591,6 +1705,7 @@ func (s *DynamoDBAccountStore) GetAccountByUsername(username string) (auth.Accou
 		APIToken:     item.APIToken,
 		CreatedAt:    time.Unix(item.CreatedAt, 0),
 		UpdatedAt:    time.Unix(item.UpdatedAt, 0),
+		Quota:        item.Quota,
 	}
 
 	return account, nil
@@ -1624,12 +1739,13 @@ func (s *DynamoDBAccountStore) GetAccountByToken(token string) (auth.Account, er
 
 	// Unmarshal account with explicit field mapping
 	var item struct {
-		ID           string `json:"ID"`
-		Username     string `json:"Username"`
-		PasswordHash string `json:"PasswordHash"`
-		APIToken     string `json:"APIToken"`
-		CreatedAt    int64  `json:"CreatedAt"`
-		UpdatedAt    int64  `json:"UpdatedAt"`
+		ID           string             `json:"ID"`
+		Username     string             `json:"Username"`
+		PasswordHash string             `json:"PasswordHash"`
+		APIToken     string             `json:"APIToken"`
+		CreatedAt    int64              `json:"CreatedAt"`
+		UpdatedAt    int64              `json:"UpdatedAt"`
+		Quota        *auth.AccountQuota `json:"Quota,omitempty"`
 	}
 	if err := dynamodbattribute.UnmarshalMap(result.Items[0], &item); err != nil {
 		return auth.Account{}, fmt.Errorf("failed to unmarshal account: %w", err)
@@ -1643,6 +1759,7 @@ func (s *DynamoDBAccountStore) GetAccountByToken(token string) (auth.Account, er
 		APIToken:     item.APIToken,
 		CreatedAt:    time.Unix(item.CreatedAt, 0),
 		UpdatedAt:    time.Unix(item.UpdatedAt, 0),
+		Quota:        item.Quota,
 	}
 
 	return account, nil
@@ -1663,12 +1780,13 @@ func (s *DynamoDBAccountStore) ListAccounts() ([]auth.Account, error) {
 	accounts := make([]auth.Account, 0, len(result.Items))
 	for _, item := range result.Items {
 		var accItem struct {
-			ID           string `json:"ID"`
-			Username     string `json:"Username"`
-			PasswordHash string `json:"PasswordHash"`
-			APIToken     string `json:"APIToken"`
-			CreatedAt    int64  `json:"CreatedAt"`
-			UpdatedAt    int64  `json:"UpdatedAt"`
+			ID           string             `json:"ID"`
+			Username     string             `json:"Username"`
+			PasswordHash string             `json:"PasswordHash"`
+			APIToken     string             `json:"APIToken"`
+			CreatedAt    int64              `json:"CreatedAt"`
+			UpdatedAt    int64              `json:"UpdatedAt"`
+			Quota        *auth.AccountQuota `json:"Quota,omitempty"`
 		}
 		if err := dynamodbattribute.UnmarshalMap(item, &accItem); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal account: %w", err)
@@ -1682,6 +1800,7 @@ func (s *DynamoDBAccountStore) ListAccounts() ([]auth.Account, error) {
 			APIToken:     accItem.APIToken,
 			CreatedAt:    time.Unix(accItem.CreatedAt, 0),
 			UpdatedAt:    time.Unix(accItem.UpdatedAt, 0),
+			Quota:        accItem.Quota,
 		}
 
 		accounts = append(accounts, account)
@@ -1895,3 +2014,972 @@ func (s *DynamoDBFlowStore) ListFlowVersions(accountID, flowID string) ([]string
 }
 
 // SaveFlowVersion persists a new version of a flow definition
+
+// DynamoDBConversationStore implements the ConversationStore interface using DynamoDB
+type DynamoDBConversationStore struct {
+	client      dynamodbiface.DynamoDBAPI
+	tablePrefix string
+	tableName   string
+}
+
+// conversationItem is a conversation as stored in DynamoDB, with its
+// messages as JSON
+type conversationItem struct {
+	AccountID string `dynamodbav:"AccountID"`
+	SessionID string `dynamodbav:"SessionID"`
+	Messages  string `dynamodbav:"Messages"`
+	Summary   string `dynamodbav:"Summary"`
+	Version   int64  `dynamodbav:"Version"`
+	CreatedAt int64  `dynamodbav:"CreatedAt"`
+	UpdatedAt int64  `dynamodbav:"UpdatedAt"`
+}
+
+// NewDynamoDBConversationStore creates a new DynamoDB conversation store
+func NewDynamoDBConversationStore(client dynamodbiface.DynamoDBAPI, tablePrefix string) *DynamoDBConversationStore {
+	return &DynamoDBConversationStore{
+		client:      client,
+		tablePrefix: tablePrefix,
+		tableName:   tablePrefix + "conversations",
+	}
+}
+
+// Initialize creates the DynamoDB table if it doesn't exist
+func (s *DynamoDBConversationStore) Initialize() error {
+	// Check if table exists
+	_, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+
+	if err == nil {
+		// Table exists
+		return nil
+	}
+
+	// Check if error is "table not found"
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		// Create table
+		_, err = s.client.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(s.tableName),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("AccountID"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("SessionID"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("AccountID"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("SessionID"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		// Wait for table to be created
+		err = s.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String(s.tableName),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to wait for table creation: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to check if table exists: %w", err)
+}
+
+// SaveConversation persists a conversation
+func (s *DynamoDBConversationStore) SaveConversation(conversation runtime.Conversation) error {
+	messagesJSON, err := json.Marshal(conversation.Messages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation messages: %w", err)
+	}
+
+	av, err := dynamodbattribute.MarshalMap(conversationItem{
+		AccountID: conversation.AccountID,
+		SessionID: conversation.SessionID,
+		Messages:  string(messagesJSON),
+		Summary:   conversation.Summary,
+		Version:   conversation.Version + 1,
+		CreatedAt: conversation.CreatedAt.UnixNano(),
+		UpdatedAt: conversation.UpdatedAt.UnixNano(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+
+	// Only the version that was loaded can be replaced; conversations saved
+	// before versioning have none
+	condition := "Version = :version"
+	if conversation.Version == 0 {
+		condition = "attribute_not_exists(AccountID) OR attribute_not_exists(Version)"
+	}
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                av,
+		ConditionExpression: aws.String(condition),
+	}
+	if conversation.Version != 0 {
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":version": {N: aws.String(strconv.FormatInt(conversation.Version, 10))},
+		}
+	}
+	_, err = s.client.PutItem(input)
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return runtime.ErrConversationConflict
+		}
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+
+	return nil
+}
+
+// conversationKey is the primary key of the conversation of a session
+func conversationKey(accountID, sessionID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"AccountID": {
+			S: aws.String(accountID),
+		},
+		"SessionID": {
+			S: aws.String(sessionID),
+		},
+	}
+}
+
+// GetConversation retrieves the conversation of a session
+func (s *DynamoDBConversationStore) GetConversation(accountID, sessionID string) (runtime.Conversation, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       conversationKey(accountID, sessionID),
+	})
+
+	if err != nil {
+		return runtime.Conversation{}, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	if result.Item == nil {
+		return runtime.Conversation{}, runtime.ErrConversationNotFound
+	}
+
+	return unmarshalConversation(result.Item)
+}
+
+// ListConversations returns all conversations for an account
+func (s *DynamoDBConversationStore) ListConversations(accountID string) ([]runtime.Conversation, error) {
+	// Create query expression
+	keyCond := expression.Key("AccountID").Equal(expression.Value(accountID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %w", err)
+	}
+
+	// Query conversations
+	result, err := s.client.Query(&dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversations: %w", err)
+	}
+
+	conversations := make([]runtime.Conversation, 0, len(result.Items))
+	for _, item := range result.Items {
+		conversation, err := unmarshalConversation(item)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	return conversations, nil
+}
+
+func unmarshalConversation(av map[string]*dynamodb.AttributeValue) (runtime.Conversation, error) {
+	var item conversationItem
+	if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+		return runtime.Conversation{}, fmt.Errorf("failed to unmarshal conversation: %w", err)
+	}
+
+	conversation := runtime.Conversation{
+		AccountID: item.AccountID,
+		SessionID: item.SessionID,
+		Summary:   item.Summary,
+		Version:   item.Version,
+		CreatedAt: time.Unix(0, item.CreatedAt),
+		UpdatedAt: time.Unix(0, item.UpdatedAt),
+	}
+	if err := json.Unmarshal([]byte(item.Messages), &conversation.Messages); err != nil {
+		return runtime.Conversation{}, fmt.Errorf("failed to unmarshal conversation messages: %w", err)
+	}
+
+	return conversation, nil
+}
+
+// DeleteConversation removes the conversation of a session
+func (s *DynamoDBConversationStore) DeleteConversation(accountID, sessionID string) error {
+	if _, err := s.GetConversation(accountID, sessionID); err != nil {
+		return err
+	}
+
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       conversationKey(accountID, sessionID),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+
+	return nil
+}
+
+// DynamoDBPromptStore implements the PromptStore interface using DynamoDB
+type DynamoDBPromptStore struct {
+	client      dynamodbiface.DynamoDBAPI
+	tablePrefix string
+	tableName   string
+}
+
+// promptItem is a prompt version as stored in DynamoDB, keyed by the name
+// and the zero padded version so that versions sort in order
+type promptItem struct {
+	AccountID   string   `dynamodbav:"AccountID"`
+	PromptKey   string   `dynamodbav:"PromptKey"`
+	Name        string   `dynamodbav:"Name"`
+	Version     int      `dynamodbav:"Version"`
+	Description string   `dynamodbav:"Description"`
+	Messages    string   `dynamodbav:"Messages"`
+	Variables   []string `dynamodbav:"Variables"`
+	Tags        []string `dynamodbav:"Tags"`
+	CreatedAt   int64    `dynamodbav:"CreatedAt"`
+}
+
+// NewDynamoDBPromptStore creates a new DynamoDB prompt store
+func NewDynamoDBPromptStore(client dynamodbiface.DynamoDBAPI, tablePrefix string) *DynamoDBPromptStore {
+	return &DynamoDBPromptStore{
+		client:      client,
+		tablePrefix: tablePrefix,
+		tableName:   tablePrefix + "prompts",
+	}
+}
+
+// Initialize creates the DynamoDB table if it doesn't exist
+func (s *DynamoDBPromptStore) Initialize() error {
+	// Check if table exists
+	_, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+
+	if err == nil {
+		// Table exists
+		return nil
+	}
+
+	// Check if error is "table not found"
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		// Create table
+		_, err = s.client.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(s.tableName),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("AccountID"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("PromptKey"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("AccountID"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("PromptKey"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		// Wait for table to be created
+		err = s.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String(s.tableName),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to wait for table creation: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to check if table exists: %w", err)
+}
+
+// promptKey is the primary key of a prompt version
+func promptKey(accountID, name string, version int) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"AccountID": {
+			S: aws.String(accountID),
+		},
+		"PromptKey": {
+			S: aws.String(fmt.Sprintf("%s#%010d", name, version)),
+		},
+	}
+}
+
+// CreatePromptVersion persists a new prompt version
+func (s *DynamoDBPromptStore) CreatePromptVersion(prompt runtime.Prompt) error {
+	input, err := s.putPromptInput(prompt)
+	if err != nil {
+		return err
+	}
+
+	// Another writer may have stored the version first
+	input.ConditionExpression = aws.String("attribute_not_exists(PromptKey)")
+	_, err = s.client.PutItem(input)
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return runtime.ErrPromptVersionExists
+		}
+		return fmt.Errorf("failed to create prompt: %w", err)
+	}
+
+	return nil
+}
+
+// SavePrompt persists a prompt version
+func (s *DynamoDBPromptStore) SavePrompt(prompt runtime.Prompt) error {
+	input, err := s.putPromptInput(prompt)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutItem(input)
+
+	if err != nil {
+		return fmt.Errorf("failed to save prompt: %w", err)
+	}
+
+	return nil
+}
+
+// putPromptInput returns the request putting a prompt version
+func (s *DynamoDBPromptStore) putPromptInput(prompt runtime.Prompt) (*dynamodb.PutItemInput, error) {
+	messagesJSON, err := json.Marshal(prompt.Messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal prompt messages: %w", err)
+	}
+
+	av, err := dynamodbattribute.MarshalMap(promptItem{
+		AccountID:   prompt.AccountID,
+		PromptKey:   fmt.Sprintf("%s#%010d", prompt.Name, prompt.Version),
+		Name:        prompt.Name,
+		Version:     prompt.Version,
+		Description: prompt.Description,
+		Messages:    string(messagesJSON),
+		Variables:   prompt.Variables,
+		Tags:        prompt.Tags,
+		CreatedAt:   prompt.CreatedAt.UnixNano(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal prompt: %w", err)
+	}
+
+	return &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	}, nil
+}
+
+// GetPrompt retrieves a version of a prompt
+func (s *DynamoDBPromptStore) GetPrompt(accountID, name string, version int) (runtime.Prompt, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       promptKey(accountID, name, version),
+	})
+
+	if err != nil {
+		return runtime.Prompt{}, fmt.Errorf("failed to get prompt: %w", err)
+	}
+
+	if result.Item == nil {
+		return runtime.Prompt{}, runtime.ErrPromptNotFound
+	}
+
+	return unmarshalPrompt(result.Item)
+}
+
+// ListPromptVersions returns the versions of a prompt, oldest first
+func (s *DynamoDBPromptStore) ListPromptVersions(accountID, name string) ([]runtime.Prompt, error) {
+	prompts, err := s.ListPrompts(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]runtime.Prompt, 0, len(prompts))
+	for _, prompt := range prompts {
+		if prompt.Name == name {
+			versions = append(versions, prompt)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	return versions, nil
+}
+
+// ListPrompts returns all versions of all prompts for an account
+func (s *DynamoDBPromptStore) ListPrompts(accountID string) ([]runtime.Prompt, error) {
+	// Create query expression
+	keyCond := expression.Key("AccountID").Equal(expression.Value(accountID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %w", err)
+	}
+
+	// Query prompts
+	result, err := s.client.Query(&dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query prompts: %w", err)
+	}
+
+	prompts := make([]runtime.Prompt, 0, len(result.Items))
+	for _, item := range result.Items {
+		prompt, err := unmarshalPrompt(item)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, prompt)
+	}
+
+	return prompts, nil
+}
+
+func unmarshalPrompt(av map[string]*dynamodb.AttributeValue) (runtime.Prompt, error) {
+	var item promptItem
+	if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+		return runtime.Prompt{}, fmt.Errorf("failed to unmarshal prompt: %w", err)
+	}
+
+	prompt := runtime.Prompt{
+		AccountID:   item.AccountID,
+		Name:        item.Name,
+		Version:     item.Version,
+		Description: item.Description,
+		Variables:   item.Variables,
+		Tags:        item.Tags,
+		CreatedAt:   time.Unix(0, item.CreatedAt),
+	}
+	if err := json.Unmarshal([]byte(item.Messages), &prompt.Messages); err != nil {
+		return runtime.Prompt{}, fmt.Errorf("failed to unmarshal prompt messages: %w", err)
+	}
+
+	return prompt, nil
+}
+
+// DeletePrompt removes all versions of a prompt
+func (s *DynamoDBPromptStore) DeletePrompt(accountID, name string) error {
+	versions, err := s.ListPromptVersions(accountID, name)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return runtime.ErrPromptNotFound
+	}
+
+	for _, version := range versions {
+		_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String(s.tableName),
+			Key:       promptKey(accountID, name, version.Version),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to delete prompt version %d: %w", version.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// DynamoDBLLMCacheStore implements the LLMCacheStore interface using DynamoDB
+type DynamoDBLLMCacheStore struct {
+	client      dynamodbiface.DynamoDBAPI
+	tablePrefix string
+	tableName   string
+}
+
+// llmCacheItem is a cached LLM response as stored in DynamoDB
+type llmCacheItem struct {
+	AccountID string `dynamodbav:"AccountID"`
+	Key       string `dynamodbav:"Key"`
+	Provider  string `dynamodbav:"Provider"`
+	Model     string `dynamodbav:"Model"`
+	Response  string `dynamodbav:"Response"`
+	CreatedAt int64  `dynamodbav:"CreatedAt"`
+	ExpiresAt int64  `dynamodbav:"ExpiresAt"` // 0 for responses that do not expire
+}
+
+// NewDynamoDBLLMCacheStore creates a new DynamoDB LLM cache store
+func NewDynamoDBLLMCacheStore(client dynamodbiface.DynamoDBAPI, tablePrefix string) *DynamoDBLLMCacheStore {
+	return &DynamoDBLLMCacheStore{
+		client:      client,
+		tablePrefix: tablePrefix,
+		tableName:   tablePrefix + "llm_cache",
+	}
+}
+
+// Initialize creates the DynamoDB table if it doesn't exist
+func (s *DynamoDBLLMCacheStore) Initialize() error {
+	// Check if table exists
+	_, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+
+	if err == nil {
+		// Table exists
+		return nil
+	}
+
+	// Check if error is "table not found"
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		// Create table
+		_, err = s.client.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(s.tableName),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("AccountID"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("Key"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("AccountID"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("Key"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		// Wait for table to be created
+		err = s.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String(s.tableName),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to wait for table creation: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to check if table exists: %w", err)
+}
+
+// GetLLMResponse retrieves the cached response for a request key
+func (s *DynamoDBLLMCacheStore) GetLLMResponse(accountID, key string) (runtime.LLMCacheEntry, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"AccountID": {
+				S: aws.String(accountID),
+			},
+			"Key": {
+				S: aws.String(key),
+			},
+		},
+	})
+
+	if err != nil {
+		return runtime.LLMCacheEntry{}, fmt.Errorf("failed to get cached LLM response: %w", err)
+	}
+
+	if result.Item == nil {
+		return runtime.LLMCacheEntry{}, runtime.ErrLLMCacheMiss
+	}
+
+	var item llmCacheItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return runtime.LLMCacheEntry{}, fmt.Errorf("failed to unmarshal cached LLM response: %w", err)
+	}
+
+	entry := runtime.LLMCacheEntry{
+		AccountID: item.AccountID,
+		Key:       item.Key,
+		Provider:  item.Provider,
+		Model:     item.Model,
+		CreatedAt: time.Unix(0, item.CreatedAt),
+	}
+	if item.ExpiresAt != 0 {
+		entry.ExpiresAt = time.Unix(0, item.ExpiresAt)
+	}
+	if err := json.Unmarshal([]byte(item.Response), &entry.Response); err != nil {
+		return runtime.LLMCacheEntry{}, fmt.Errorf("failed to unmarshal cached LLM response: %w", err)
+	}
+
+	return entry, nil
+}
+
+// SaveLLMResponse persists a cached response
+func (s *DynamoDBLLMCacheStore) SaveLLMResponse(entry runtime.LLMCacheEntry) error {
+	responseJSON, err := json.Marshal(entry.Response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal LLM response: %w", err)
+	}
+
+	item := llmCacheItem{
+		AccountID: entry.AccountID,
+		Key:       entry.Key,
+		Provider:  entry.Provider,
+		Model:     entry.Model,
+		Response:  string(responseJSON),
+		CreatedAt: entry.CreatedAt.UnixNano(),
+	}
+	if !entry.ExpiresAt.IsZero() {
+		item.ExpiresAt = entry.ExpiresAt.UnixNano()
+	}
+
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached LLM response: %w", err)
+	}
+
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to save cached LLM response: %w", err)
+	}
+
+	return nil
+}
+
+// DynamoDBMailboxStateStore implements the MailboxStateStore interface using DynamoDB
+type DynamoDBMailboxStateStore struct {
+	client      dynamodbiface.DynamoDBAPI
+	tablePrefix string
+	tableName   string
+}
+
+// mailboxStateItem is a mailbox watcher's folder state as stored in DynamoDB
+type mailboxStateItem struct {
+	WatcherID   string `dynamodbav:"WatcherID"`
+	Folder      string `dynamodbav:"Folder"`
+	UIDValidity uint32 `dynamodbav:"UIDValidity"`
+	LastUID     uint32 `dynamodbav:"LastUID"`
+	UpdatedAt   int64  `dynamodbav:"UpdatedAt"`
+}
+
+// NewDynamoDBMailboxStateStore creates a new DynamoDB mailbox state store
+func NewDynamoDBMailboxStateStore(client dynamodbiface.DynamoDBAPI, tablePrefix string) *DynamoDBMailboxStateStore {
+	return &DynamoDBMailboxStateStore{
+		client:      client,
+		tablePrefix: tablePrefix,
+		tableName:   tablePrefix + "mailbox_state",
+	}
+}
+
+// Initialize creates the DynamoDB table if it doesn't exist
+func (s *DynamoDBMailboxStateStore) Initialize() error {
+	// Check if table exists
+	_, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+
+	if err == nil {
+		// Table exists
+		return nil
+	}
+
+	// Check if error is "table not found"
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		// Create table
+		_, err = s.client.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(s.tableName),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("WatcherID"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("Folder"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("WatcherID"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("Folder"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		// Wait for table to be created
+		err = s.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String(s.tableName),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to wait for table creation: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to check if table exists: %w", err)
+}
+
+// GetMailboxState retrieves the state of a watcher's folder
+func (s *DynamoDBMailboxStateStore) GetMailboxState(watcherID, folder string) (MailboxState, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"WatcherID": {
+				S: aws.String(watcherID),
+			},
+			"Folder": {
+				S: aws.String(folder),
+			},
+		},
+	})
+
+	if err != nil {
+		return MailboxState{}, fmt.Errorf("failed to get mailbox state: %w", err)
+	}
+
+	if result.Item == nil {
+		return MailboxState{}, ErrMailboxStateNotFound
+	}
+
+	var item mailboxStateItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return MailboxState{}, fmt.Errorf("failed to unmarshal mailbox state: %w", err)
+	}
+
+	return MailboxState{
+		WatcherID:   item.WatcherID,
+		Folder:      item.Folder,
+		UIDValidity: item.UIDValidity,
+		LastUID:     item.LastUID,
+		UpdatedAt:   time.Unix(0, item.UpdatedAt),
+	}, nil
+}
+
+// SaveMailboxState persists the state of a watcher's folder
+func (s *DynamoDBMailboxStateStore) SaveMailboxState(state MailboxState) error {
+	av, err := dynamodbattribute.MarshalMap(mailboxStateItem{
+		WatcherID:   state.WatcherID,
+		Folder:      state.Folder,
+		UIDValidity: state.UIDValidity,
+		LastUID:     state.LastUID,
+		UpdatedAt:   state.UpdatedAt.UnixNano(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal mailbox state: %w", err)
+	}
+
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save mailbox state: %w", err)
+	}
+
+	return nil
+}
+
+// DynamoDBCheckpointStore implements the CheckpointStore interface using DynamoDB
+type DynamoDBCheckpointStore struct {
+	client      dynamodbiface.DynamoDBAPI
+	tablePrefix string
+	tableName   string
+}
+
+// checkpointItem is an execution checkpoint as stored in DynamoDB
+type checkpointItem struct {
+	ExecutionID string `dynamodbav:"ExecutionID"`
+	NodeID      string `dynamodbav:"NodeID"`
+	Data        []byte `dynamodbav:"Data"`
+	CreatedAt   int64  `dynamodbav:"CreatedAt"`
+}
+
+// NewDynamoDBCheckpointStore creates a new DynamoDB checkpoint store
+func NewDynamoDBCheckpointStore(client dynamodbiface.DynamoDBAPI, tablePrefix string) *DynamoDBCheckpointStore {
+	return &DynamoDBCheckpointStore{
+		client:      client,
+		tablePrefix: tablePrefix,
+		tableName:   tablePrefix + "checkpoints",
+	}
+}
+
+// Initialize creates the DynamoDB table if it doesn't exist
+func (s *DynamoDBCheckpointStore) Initialize() error {
+	// Check if table exists
+	_, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+
+	if err == nil {
+		// Table exists
+		return nil
+	}
+
+	// Check if error is "table not found"
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		// Create table
+		_, err = s.client.CreateTable(&dynamodb.CreateTableInput{
+			TableName: aws.String(s.tableName),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("ExecutionID"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("NodeID"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("ExecutionID"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("NodeID"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		// Wait for table to be created
+		err = s.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String(s.tableName),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to wait for table creation: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to check if table exists: %w", err)
+}
+
+// SaveCheckpoint persists the checkpoint of a node
+func (s *DynamoDBCheckpointStore) SaveCheckpoint(checkpoint runtime.Checkpoint) error {
+	av, err := dynamodbattribute.MarshalMap(checkpointItem{
+		ExecutionID: checkpoint.ExecutionID,
+		NodeID:      checkpoint.NodeID,
+		Data:        checkpoint.Data,
+		CreatedAt:   checkpoint.CreatedAt.UnixNano(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// GetCheckpoint retrieves the checkpoint of a node
+func (s *DynamoDBCheckpointStore) GetCheckpoint(executionID, nodeID string) (runtime.Checkpoint, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ExecutionID": {
+				S: aws.String(executionID),
+			},
+			"NodeID": {
+				S: aws.String(nodeID),
+			},
+		},
+	})
+
+	if err != nil {
+		return runtime.Checkpoint{}, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+
+	if result.Item == nil {
+		return runtime.Checkpoint{}, runtime.ErrCheckpointNotFound
+	}
+
+	var item checkpointItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return runtime.Checkpoint{}, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+
+	return runtime.Checkpoint{
+		ExecutionID: item.ExecutionID,
+		NodeID:      item.NodeID,
+		Data:        item.Data,
+		CreatedAt:   time.Unix(0, item.CreatedAt),
+	}, nil
+}
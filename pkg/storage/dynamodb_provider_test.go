@@ -58,6 +58,10 @@ func cleanupTables(t *testing.T, provider *DynamoDBProvider) {
 		provider.executionStore.execTableName,
 		provider.executionStore.logsTableName,
 		provider.accountStore.tableName,
+		provider.conversationStore.tableName,
+		provider.promptStore.tableName,
+		provider.llmCacheStore.tableName,
+		provider.mailboxStateStore.tableName,
 	}
 
 	for _, table := range tables {
@@ -0,0 +1,612 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gitSyncedRef records the last commit whose flows were imported into the store
+const gitSyncedRef = "refs/flowrunner/synced"
+
+// gitEmptyTree is the hash of git's empty tree, used as the diff base before the first sync
+const gitEmptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// ErrGitSyncConflict is returned when pulled changes cannot be merged
+var ErrGitSyncConflict = errors.New("git sync conflict")
+
+// GitFlowStoreConfig contains configuration for the git-backed flow store
+type GitFlowStoreConfig struct {
+	// Path is the working copy that flows are mirrored into; it is created if missing
+	Path string
+
+	// Remote is an optional URL or path of a repository (typically bare) to pull from and push to
+	Remote string
+
+	// Branch to commit to (default "main")
+	Branch string
+
+	// AutoPush pushes to the remote after every commit
+	AutoPush bool
+
+	// EmailDomain is used to build author emails from account usernames (default "flowrunner.local")
+	EmailDomain string
+}
+
+// GitSyncResult describes the changes imported from the repository
+type GitSyncResult struct {
+	// Commit is the repository head after the sync
+	Commit string `json:"commit"`
+
+	// Imported lists flows saved into the store
+	Imported []GitSyncChange `json:"imported"`
+
+	// Deleted lists flows removed from the repository; they are kept in the store
+	Deleted []GitSyncChange `json:"deleted,omitempty"`
+
+	// Skipped lists flow files that are not valid flows; they are not imported
+	Skipped []GitSyncChange `json:"skipped,omitempty"`
+}
+
+// GitSyncChange describes one flow changed by a sync
+type GitSyncChange struct {
+	AccountID string `json:"account_id"`
+	FlowID    string `json:"flow_id"`
+	Version   string `json:"version,omitempty"`
+
+	// Error tells why a skipped flow file is not valid
+	Error string `json:"error,omitempty"`
+}
+
+// GitFlowValidator validates the flow files pulled from the repository
+type GitFlowValidator interface {
+	// ValidateWithFlows validates a flow definition, resolving its imports
+	// against the given flows, by ID, before the flows of the account
+	ValidateWithFlows(accountID, yamlContent string, flows map[string]string) error
+}
+
+// GitFlowStore mirrors a FlowStore into a git repository. The wrapped store
+// stays the source of truth; every saved version becomes one commit authored
+// by the owning account, and Sync imports commits made elsewhere as new versions.
+// Changes that cannot be committed are logged and mirrored again by the next sync.
+type GitFlowStore struct {
+	FlowStore
+
+	accountStore AccountStore
+	config       GitFlowStoreConfig
+	validator    GitFlowValidator
+
+	// pending holds the flows whose last change is not mirrored yet
+	pending map[gitFlowKey]gitPendingChange
+	mu      sync.Mutex
+}
+
+// gitFlowKey identifies a flow of an account
+type gitFlowKey struct {
+	accountID string
+	flowID    string
+}
+
+// gitPendingChange is a flow change that failed to be committed
+type gitPendingChange struct {
+	message string
+	deleted bool
+}
+
+// NewGitFlowStore wraps a flow store with a git mirror. accountStore may be nil,
+// in which case commits are authored by the account ID.
+func NewGitFlowStore(flowStore FlowStore, accountStore AccountStore, config GitFlowStoreConfig) (*GitFlowStore, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("git repository path is required")
+	}
+	if config.Branch == "" {
+		config.Branch = "main"
+	}
+	if config.EmailDomain == "" {
+		config.EmailDomain = "flowrunner.local"
+	}
+
+	s := &GitFlowStore{
+		FlowStore:    flowStore,
+		accountStore: accountStore,
+		config:       config,
+		pending:      make(map[gitFlowKey]gitPendingChange),
+	}
+	if err := s.initRepository(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetValidator sets the validator of the flow files pulled by Sync. Without
+// one, pulled files are imported as they are.
+func (s *GitFlowStore) SetValidator(validator GitFlowValidator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validator = validator
+}
+
+// SaveFlow persists a flow definition and commits it to the repository
+func (s *GitFlowStore) SaveFlow(accountID, flowID string, definition []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := flowFilePath(accountID, flowID); err != nil {
+		return err
+	}
+	if err := s.FlowStore.SaveFlow(accountID, flowID, definition); err != nil {
+		return err
+	}
+
+	change := gitPendingChange{message: fmt.Sprintf("Create flow %s", flowID)}
+	s.mirror(accountID, flowID, change, s.mirrorFlow(accountID, flowID, definition, change.message))
+	return nil
+}
+
+// SaveFlowVersion persists a new version of a flow definition and commits it to the repository
+func (s *GitFlowStore) SaveFlowVersion(accountID, flowID string, definition []byte, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := flowFilePath(accountID, flowID); err != nil {
+		return err
+	}
+	if err := s.FlowStore.SaveFlowVersion(accountID, flowID, definition, version); err != nil {
+		return err
+	}
+
+	change := gitPendingChange{message: fmt.Sprintf("Update flow %s", flowID)}
+	s.mirror(accountID, flowID, change, s.commitFlow(accountID, flowID, definition, change.message, version))
+	return nil
+}
+
+// DeleteFlow removes a flow definition and commits its removal
+func (s *GitFlowStore) DeleteFlow(accountID, flowID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := flowFilePath(accountID, flowID); err != nil {
+		return err
+	}
+	if err := s.FlowStore.DeleteFlow(accountID, flowID); err != nil {
+		return err
+	}
+
+	change := gitPendingChange{message: fmt.Sprintf("Delete flow %s", flowID), deleted: true}
+	s.mirror(accountID, flowID, change, s.removeFlow(accountID, flowID, change.message))
+	return nil
+}
+
+// mirror records the outcome of mirroring a change of a flow. The wrapped
+// store already holds the change, so a failure is logged and the change is
+// mirrored again by the next sync.
+func (s *GitFlowStore) mirror(accountID, flowID string, change gitPendingChange, err error) {
+	key := gitFlowKey{accountID: accountID, flowID: flowID}
+	if err == nil {
+		delete(s.pending, key)
+		return
+	}
+	log.Printf("Failed to mirror flow %s to git, retrying on the next sync: %v", flowID, err)
+	s.pending[key] = change
+}
+
+// mirrorPending commits the changes that failed to be mirrored, from the
+// current state of the wrapped store
+func (s *GitFlowStore) mirrorPending() error {
+	keys := make([]gitFlowKey, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].accountID != keys[j].accountID {
+			return keys[i].accountID < keys[j].accountID
+		}
+		return keys[i].flowID < keys[j].flowID
+	})
+
+	for _, key := range keys {
+		change := s.pending[key]
+		var err error
+		if change.deleted {
+			err = s.removeFlow(key.accountID, key.flowID, change.message)
+		} else {
+			var definition []byte
+			if definition, err = s.FlowStore.GetFlow(key.accountID, key.flowID); err == nil {
+				err = s.mirrorFlow(key.accountID, key.flowID, definition, change.message)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to mirror pending change of flow %s: %w", key.flowID, err)
+		}
+		delete(s.pending, key)
+	}
+	return nil
+}
+
+// mirrorFlow commits a flow definition with the current version of the flow
+func (s *GitFlowStore) mirrorFlow(accountID, flowID string, definition []byte, message string) error {
+	version := ""
+	if metadata, err := s.FlowStore.GetFlowMetadata(accountID, flowID); err == nil {
+		version = metadata.Version
+	}
+	return s.commitFlow(accountID, flowID, definition, message, version)
+}
+
+// removeFlow removes a flow file and commits its removal
+func (s *GitFlowStore) removeFlow(accountID, flowID, message string) error {
+	file, err := flowFilePath(accountID, flowID)
+	if err != nil {
+		return err
+	}
+	fullPath := filepath.Join(s.config.Path, file)
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		return nil
+	}
+	// The file may not be committed yet when mirroring its creation failed
+	if _, err := s.git(nil, "rm", "-q", "-f", "--ignore-unmatch", "--", file); err != nil {
+		return fmt.Errorf("failed to mirror flow deletion to git: %w", err)
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to mirror flow deletion to git: %w", err)
+	}
+	return s.commit(accountID, message, "")
+}
+
+// Sync pulls from the remote, imports changed flows as new versions and pushes local commits
+func (s *GitFlowStore) Sync() (*GitSyncResult, error) {
+	result, err := s.Pull()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Push(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Pull commits the changes that failed to be mirrored, merges changes from the
+// remote, if any, and imports flows changed in the repository since the last
+// sync. Flows whose content already matches the store are skipped.
+func (s *GitFlowStore) Pull() (*GitSyncResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mirrorPending(); err != nil {
+		return nil, err
+	}
+
+	if s.config.Remote != "" {
+		if _, err := s.git(nil, "fetch", "-q", "origin"); err != nil {
+			return nil, fmt.Errorf("failed to fetch from remote: %w", err)
+		}
+		remoteBranch := "origin/" + s.config.Branch
+		if _, err := s.git(nil, "rev-parse", "-q", "--verify", remoteBranch); err == nil {
+			if _, err := s.git(nil, "merge", "-q", "--no-edit", remoteBranch); err != nil {
+				s.git(nil, "merge", "--abort")
+				return nil, fmt.Errorf("%w: failed to merge %s: %v", ErrGitSyncConflict, remoteBranch, err)
+			}
+		}
+	}
+
+	result := &GitSyncResult{}
+	head, err := s.git(nil, "rev-parse", "-q", "--verify", "HEAD")
+	if err != nil {
+		// Nothing has been committed yet
+		return result, nil
+	}
+	result.Commit = head
+
+	base, err := s.git(nil, "rev-parse", "-q", "--verify", gitSyncedRef)
+	if err != nil {
+		base = gitEmptyTree
+	}
+	if base == head {
+		return result, nil
+	}
+
+	diff, err := s.git(nil, "diff", "--name-status", "--no-renames", base, head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff repository: %w", err)
+	}
+
+	for _, line := range strings.Split(diff, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		status, file := fields[0], fields[1]
+		accountID, flowID, ok := parseFlowFilePath(file)
+		if !ok {
+			continue
+		}
+
+		if status == "D" {
+			result.Deleted = append(result.Deleted, GitSyncChange{AccountID: accountID, FlowID: flowID})
+			continue
+		}
+
+		definition, err := s.gitOutput(nil, "show", head+":"+file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		change, err := s.importFlow(accountID, flowID, definition, head)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case change == nil:
+		case change.Error != "":
+			result.Skipped = append(result.Skipped, *change)
+		default:
+			result.Imported = append(result.Imported, *change)
+		}
+	}
+
+	if _, err := s.git(nil, "update-ref", gitSyncedRef, head); err != nil {
+		return nil, fmt.Errorf("failed to record sync state: %w", err)
+	}
+	return result, nil
+}
+
+// Push pushes local commits to the remote; it is a no-op without a remote
+func (s *GitFlowStore) Push() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.push()
+}
+
+// importFlow saves a flow file from the repository into the wrapped store.
+// A file that is not a valid flow is not saved; its change holds the error.
+func (s *GitFlowStore) importFlow(accountID, flowID string, definition []byte, commit string) (*GitSyncChange, error) {
+	if s.validator != nil {
+		if err := s.validator.ValidateWithFlows(accountID, string(definition), nil); err != nil {
+			return &GitSyncChange{AccountID: accountID, FlowID: flowID, Error: err.Error()}, nil
+		}
+	}
+
+	existing, err := s.FlowStore.GetFlow(accountID, flowID)
+	if err != nil {
+		if err := s.FlowStore.SaveFlow(accountID, flowID, definition); err != nil {
+			return nil, fmt.Errorf("failed to import flow %s: %w", flowID, err)
+		}
+		change := &GitSyncChange{AccountID: accountID, FlowID: flowID}
+		if metadata, err := s.FlowStore.GetFlowMetadata(accountID, flowID); err == nil {
+			change.Version = metadata.Version
+		}
+		return change, nil
+	}
+
+	if bytes.Equal(bytes.TrimSpace(existing), bytes.TrimSpace(definition)) {
+		return nil, nil
+	}
+
+	version := s.importVersion(accountID, flowID, definition, commit)
+	if err := s.FlowStore.SaveFlowVersion(accountID, flowID, definition, version); err != nil {
+		return nil, fmt.Errorf("failed to import flow %s: %w", flowID, err)
+	}
+	return &GitSyncChange{AccountID: accountID, FlowID: flowID, Version: version}, nil
+}
+
+// importVersion uses the version declared in the flow metadata unless it
+// already exists, in which case the commit hash identifies the version
+func (s *GitFlowStore) importVersion(accountID, flowID string, definition []byte, commit string) string {
+	var flowDef struct {
+		Metadata struct {
+			Version string `yaml:"version"`
+		} `yaml:"metadata"`
+	}
+	if err := yaml.Unmarshal(definition, &flowDef); err == nil && flowDef.Metadata.Version != "" {
+		versions, err := s.FlowStore.ListFlowVersions(accountID, flowID)
+		exists := false
+		for _, version := range versions {
+			if version == flowDef.Metadata.Version {
+				exists = true
+				break
+			}
+		}
+		if err == nil && !exists {
+			return flowDef.Metadata.Version
+		}
+	}
+
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return "git-" + commit
+}
+
+// commitFlow writes a flow file and commits it
+func (s *GitFlowStore) commitFlow(accountID, flowID string, definition []byte, message, version string) error {
+	file, err := flowFilePath(accountID, flowID)
+	if err != nil {
+		return err
+	}
+
+	fullPath := filepath.Join(s.config.Path, file)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("failed to mirror flow to git: %w", err)
+	}
+	if err := os.WriteFile(fullPath, definition, 0644); err != nil {
+		return fmt.Errorf("failed to mirror flow to git: %w", err)
+	}
+	if _, err := s.git(nil, "add", "--", file); err != nil {
+		return fmt.Errorf("failed to mirror flow to git: %w", err)
+	}
+
+	if version != "" {
+		message = fmt.Sprintf("%s (version %s)", message, version)
+	}
+	return s.commit(accountID, message, version)
+}
+
+// commit records the staged changes with the account as author
+func (s *GitFlowStore) commit(accountID, message, version string) error {
+	// Nothing staged, e.g. the same definition saved twice
+	if _, err := s.git(nil, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+
+	before, _ := s.git(nil, "rev-parse", "-q", "--verify", "HEAD")
+	synced, _ := s.git(nil, "rev-parse", "-q", "--verify", gitSyncedRef)
+
+	name, email := s.author(accountID)
+	body := fmt.Sprintf("%s\n\nAccount: %s", message, accountID)
+	if version != "" {
+		body += fmt.Sprintf("\nVersion: %s", version)
+	}
+	env := []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + email,
+	}
+	if _, err := s.git(env, "commit", "-q", "-m", body); err != nil {
+		return fmt.Errorf("failed to commit flow to git: %w", err)
+	}
+
+	// Our own commits are already in the store, so keep the sync point on
+	// them unless there are pulled changes still waiting to be imported
+	if synced == before {
+		if head, err := s.git(nil, "rev-parse", "HEAD"); err == nil {
+			s.git(nil, "update-ref", gitSyncedRef, head)
+		}
+	}
+
+	if s.config.AutoPush {
+		// The store already holds the version; a failed push is retried on the next sync
+		if err := s.push(); err != nil {
+			log.Printf("Failed to push flow commit: %v", err)
+		}
+	}
+	return nil
+}
+
+// author returns the commit author for an account
+func (s *GitFlowStore) author(accountID string) (string, string) {
+	name := accountID
+	if s.accountStore != nil {
+		if account, err := s.accountStore.GetAccount(accountID); err == nil && account.Username != "" {
+			name = account.Username
+		}
+	}
+
+	local := strings.Map(func(r rune) rune {
+		if r == '@' || r == '<' || r == '>' || r == ' ' {
+			return '.'
+		}
+		return r
+	}, name)
+	return name, fmt.Sprintf("%s@%s", local, s.config.EmailDomain)
+}
+
+func (s *GitFlowStore) push() error {
+	if s.config.Remote == "" {
+		return nil
+	}
+	if _, err := s.git(nil, "rev-parse", "-q", "--verify", "HEAD"); err != nil {
+		return nil
+	}
+	if _, err := s.git(nil, "push", "-q", "origin", "HEAD:refs/heads/"+s.config.Branch); err != nil {
+		return fmt.Errorf("failed to push to remote: %w", err)
+	}
+	return nil
+}
+
+// initRepository clones or initializes the working copy
+func (s *GitFlowStore) initRepository() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git executable not found: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.config.Path, ".git")); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.config.Path, 0755); err != nil {
+		return fmt.Errorf("failed to create git repository directory: %w", err)
+	}
+
+	if _, err := s.git(nil, "init", "-q"); err != nil {
+		return fmt.Errorf("failed to initialize git repository: %w", err)
+	}
+	if _, err := s.git(nil, "symbolic-ref", "HEAD", "refs/heads/"+s.config.Branch); err != nil {
+		return fmt.Errorf("failed to initialize git repository: %w", err)
+	}
+
+	if s.config.Remote != "" {
+		if _, err := s.git(nil, "remote", "add", "origin", s.config.Remote); err != nil {
+			return fmt.Errorf("failed to add git remote: %w", err)
+		}
+		if _, err := s.git(nil, "fetch", "-q", "origin"); err != nil {
+			return fmt.Errorf("failed to fetch from remote: %w", err)
+		}
+		remoteBranch := "origin/" + s.config.Branch
+		if _, err := s.git(nil, "rev-parse", "-q", "--verify", remoteBranch); err == nil {
+			if _, err := s.git(nil, "reset", "-q", "--hard", remoteBranch); err != nil {
+				return fmt.Errorf("failed to check out %s: %w", remoteBranch, err)
+			}
+		}
+	}
+	return nil
+}
+
+// git runs a git command in the working copy and returns its trimmed output
+func (s *GitFlowStore) git(env []string, args ...string) (string, error) {
+	output, err := s.gitOutput(env, args...)
+	return strings.TrimSpace(string(output)), err
+}
+
+// gitOutput runs a git command in the working copy and returns its raw output
+func (s *GitFlowStore) gitOutput(env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", s.config.Path}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_COMMITTER_NAME=flowrunner",
+		"GIT_COMMITTER_EMAIL=flowrunner@"+s.config.EmailDomain,
+		"GIT_AUTHOR_NAME=flowrunner",
+		"GIT_AUTHOR_EMAIL=flowrunner@"+s.config.EmailDomain,
+	)
+	cmd.Env = append(cmd.Env, env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// flowFilePath returns the repository path of a flow file
+func flowFilePath(accountID, flowID string) (string, error) {
+	for _, id := range []string{accountID, flowID} {
+		if id == "" || id == "." || id == ".." || strings.ContainsAny(id, "/\\") {
+			return "", fmt.Errorf("cannot mirror flow to git: invalid path component %q", id)
+		}
+	}
+	return path.Join(accountID, flowID+".yaml"), nil
+}
+
+// parseFlowFilePath extracts the account and flow IDs from a repository path
+func parseFlowFilePath(file string) (string, string, bool) {
+	parts := strings.Split(file, "/")
+	if len(parts) != 2 || !strings.HasSuffix(parts[1], ".yaml") {
+		return "", "", false
+	}
+	flowID := strings.TrimSuffix(parts[1], ".yaml")
+	if parts[0] == "" || flowID == "" {
+		return "", "", false
+	}
+	return parts[0], flowID, true
+}
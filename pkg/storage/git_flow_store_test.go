@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcmartin/flowrunner/pkg/auth"
+)
+
+// runGit runs a git command for test setup and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=reviewer", "GIT_AUTHOR_EMAIL=reviewer@example.com",
+		"GIT_COMMITTER_NAME=reviewer", "GIT_COMMITTER_EMAIL=reviewer@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+func TestGitFlowStore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	runGit(t, dir, "init", "-q", "--bare", remote)
+
+	accounts := NewMemoryAccountStore()
+	require.NoError(t, accounts.SaveAccount(auth.Account{
+		ID:        "account-1",
+		Username:  "alice",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}))
+
+	inner := NewMemoryFlowStore()
+	store, err := NewGitFlowStore(inner, accounts, GitFlowStoreConfig{
+		Path:     filepath.Join(dir, "mirror"),
+		Remote:   remote,
+		AutoPush: true,
+	})
+	require.NoError(t, err)
+
+	// Each saved version becomes one commit authored by the account
+	require.NoError(t, store.SaveFlow("account-1", "flow-1", []byte("metadata:\n  name: Flow\nnodes: {}\n")))
+	require.NoError(t, store.SaveFlowVersion("account-1", "flow-1", []byte("metadata:\n  name: Flow\n  version: 1.1.0\nnodes: {}\n"), "1.1.0"))
+
+	log := runGit(t, remote, "log", "--format=%an <%ae>|%s", "main")
+	lines := strings.Split(log, "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "alice <alice@flowrunner.local>|Update flow flow-1 (version 1.1.0)", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "alice <alice@flowrunner.local>|Create flow flow-1"))
+
+	// Nothing to import from our own commits
+	result, err := store.Sync()
+	require.NoError(t, err)
+	assert.Empty(t, result.Imported)
+
+	// A reviewer edits the flow and adds a new one in another clone
+	clone := filepath.Join(dir, "clone")
+	runGit(t, dir, "clone", "-q", "-b", "main", remote, clone)
+	edited := "metadata:\n  name: Flow\n  version: 1.2.0\nnodes: {}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "account-1", "flow-1.yaml"), []byte(edited), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "account-1", "flow-2.yaml"), []byte("metadata:\n  name: New\nnodes: {}\n"), 0644))
+	runGit(t, clone, "add", "-A")
+	runGit(t, clone, "commit", "-q", "-m", "Review changes")
+	runGit(t, clone, "push", "-q", "origin", "HEAD:main")
+
+	result, err = store.Sync()
+	require.NoError(t, err)
+	require.Len(t, result.Imported, 2)
+
+	content, err := inner.GetFlow("account-1", "flow-1")
+	require.NoError(t, err)
+	assert.Equal(t, edited, string(content))
+
+	versions, err := inner.ListFlowVersions("account-1", "flow-1")
+	require.NoError(t, err)
+	assert.Contains(t, versions, "1.2.0")
+
+	_, err = inner.GetFlow("account-1", "flow-2")
+	assert.NoError(t, err)
+
+	// Imports are not committed again and a second sync is a no-op
+	assert.Equal(t, runGit(t, remote, "rev-parse", "main"), result.Commit)
+	result, err = store.Sync()
+	require.NoError(t, err)
+	assert.Empty(t, result.Imported)
+
+	// Deletions are committed
+	require.NoError(t, store.DeleteFlow("account-1", "flow-2"))
+	assert.Equal(t, "Delete flow flow-2", runGit(t, remote, "log", "-1", "--format=%s", "main"))
+}
+
+func TestGitFlowStoreRejectsUnsafePaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	store, err := NewGitFlowStore(NewMemoryFlowStore(), nil, GitFlowStoreConfig{Path: t.TempDir()})
+	require.NoError(t, err)
+
+	assert.Error(t, store.SaveFlow("account-1", "../escape", []byte("nodes: {}\n")))
+}
+
+func TestGitFlowStoreRetriesFailedCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	runGit(t, dir, "init", "-q", "--bare", remote)
+
+	inner := NewMemoryFlowStore()
+	mirror := filepath.Join(dir, "mirror")
+	store, err := NewGitFlowStore(inner, nil, GitFlowStoreConfig{Path: mirror, Remote: remote, AutoPush: true})
+	require.NoError(t, err)
+	require.NoError(t, store.SaveFlow("account-1", "flow-1", []byte("metadata:\n  name: Flow\nnodes: {}\n")))
+
+	// A locked index fails the commits, but not the saves
+	lock := filepath.Join(mirror, ".git", "index.lock")
+	require.NoError(t, os.WriteFile(lock, nil, 0644))
+	updated := "metadata:\n  name: Flow\n  version: 1.1.0\nnodes: {}\n"
+	require.NoError(t, store.SaveFlowVersion("account-1", "flow-1", []byte(updated), "1.1.0"))
+	require.NoError(t, store.SaveFlow("account-1", "flow-2", []byte("metadata:\n  name: Other\nnodes: {}\n")))
+	require.NoError(t, store.DeleteFlow("account-1", "flow-2"))
+
+	content, err := inner.GetFlow("account-1", "flow-1")
+	require.NoError(t, err)
+	assert.Equal(t, updated, string(content))
+	assert.True(t, strings.HasPrefix(runGit(t, remote, "log", "-1", "--format=%s", "main"), "Create flow flow-1"))
+
+	// The next sync mirrors the pending changes
+	_, err = store.Sync()
+	assert.Error(t, err)
+	require.NoError(t, os.Remove(lock))
+	result, err := store.Sync()
+	require.NoError(t, err)
+	assert.Empty(t, result.Imported)
+
+	assert.Equal(t, "Update flow flow-1 (version 1.1.0)", runGit(t, remote, "log", "-1", "--format=%s", "main"))
+	assert.Equal(t, updated, runGit(t, remote, "show", "main:account-1/flow-1.yaml")+"\n")
+	assert.Equal(t, "account-1/flow-1.yaml", runGit(t, remote, "ls-tree", "-r", "--name-only", "main"))
+}
+
+// nodesValidator accepts flow definitions that declare nodes
+type nodesValidator struct{}
+
+func (nodesValidator) ValidateWithFlows(accountID, yamlContent string, flows map[string]string) error {
+	if !strings.Contains(yamlContent, "nodes:") {
+		return errors.New("flow has no nodes")
+	}
+	return nil
+}
+
+func TestGitFlowStoreSkipsInvalidFlows(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	runGit(t, dir, "init", "-q", "--bare", remote)
+
+	inner := NewMemoryFlowStore()
+	store, err := NewGitFlowStore(inner, nil, GitFlowStoreConfig{Path: filepath.Join(dir, "mirror"), Remote: remote, AutoPush: true})
+	require.NoError(t, err)
+	store.SetValidator(nodesValidator{})
+	original := "metadata:\n  name: Flow\nnodes: {}\n"
+	require.NoError(t, store.SaveFlow("account-1", "flow-1", []byte(original)))
+
+	// A reviewer breaks one flow and adds a valid one
+	clone := filepath.Join(dir, "clone")
+	runGit(t, dir, "clone", "-q", "-b", "main", remote, clone)
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "account-1", "flow-1.yaml"), []byte("metadata:\n  name: Flow\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "account-1", "flow-2.yaml"), []byte("metadata:\n  name: New\nnodes: {}\n"), 0644))
+	runGit(t, clone, "add", "-A")
+	runGit(t, clone, "commit", "-q", "-m", "Review changes")
+	runGit(t, clone, "push", "-q", "origin", "HEAD:main")
+
+	// The invalid file is reported and the stored flow is kept
+	result, err := store.Sync()
+	require.NoError(t, err)
+	require.Len(t, result.Imported, 1)
+	assert.Equal(t, "flow-2", result.Imported[0].FlowID)
+	assert.Equal(t, []GitSyncChange{{AccountID: "account-1", FlowID: "flow-1", Error: "flow has no nodes"}}, result.Skipped)
+
+	content, err := inner.GetFlow("account-1", "flow-1")
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+}
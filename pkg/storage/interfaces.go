@@ -2,6 +2,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/runtime"
 )
@@ -25,6 +27,21 @@ type StorageProvider interface {
 
 	// GetAccountStore returns a store for account data
 	GetAccountStore() AccountStore
+
+	// GetConversationStore returns a store for conversation memory
+	GetConversationStore() ConversationStore
+
+	// GetPromptStore returns a store for prompt templates
+	GetPromptStore() PromptStore
+
+	// GetLLMCacheStore returns a store for cached LLM responses
+	GetLLMCacheStore() LLMCacheStore
+
+	// GetMailboxStateStore returns a store for the progress of mailbox watchers
+	GetMailboxStateStore() MailboxStateStore
+
+	// GetCheckpointStore returns a store for execution checkpoints
+	GetCheckpointStore() CheckpointStore
 }
 
 // FlowStore manages flow definition persistence
@@ -173,3 +190,85 @@ type AccountStore interface {
 	// DeleteAccount removes an account
 	DeleteAccount(accountID string) error
 }
+
+// ConversationStore manages the persistence of conversation memory
+type ConversationStore interface {
+	// SaveConversation persists a conversation when the stored one is still
+	// at its Version, or none is stored for Version 0, and increments the
+	// stored Version. Otherwise it returns runtime.ErrConversationConflict.
+	SaveConversation(conversation runtime.Conversation) error
+
+	// GetConversation retrieves the conversation of a session, or
+	// runtime.ErrConversationNotFound
+	GetConversation(accountID, sessionID string) (runtime.Conversation, error)
+
+	// ListConversations returns all conversations for an account
+	ListConversations(accountID string) ([]runtime.Conversation, error)
+
+	// DeleteConversation removes the conversation of a session
+	DeleteConversation(accountID, sessionID string) error
+}
+
+// PromptStore manages the persistence of versioned prompt templates
+type PromptStore interface {
+	// CreatePromptVersion persists a new prompt version, or returns
+	// runtime.ErrPromptVersionExists when the version is already stored
+	CreatePromptVersion(prompt runtime.Prompt) error
+
+	// SavePrompt persists a prompt version, replacing the stored one
+	SavePrompt(prompt runtime.Prompt) error
+
+	// GetPrompt retrieves a version of a prompt, or runtime.ErrPromptNotFound
+	GetPrompt(accountID, name string, version int) (runtime.Prompt, error)
+
+	// ListPromptVersions returns the versions of a prompt, oldest first
+	ListPromptVersions(accountID, name string) ([]runtime.Prompt, error)
+
+	// ListPrompts returns all versions of all prompts for an account
+	ListPrompts(accountID string) ([]runtime.Prompt, error)
+
+	// DeletePrompt removes all versions of a prompt
+	DeletePrompt(accountID, name string) error
+}
+
+// LLMCacheStore manages the persistence of cached LLM responses
+type LLMCacheStore interface {
+	// GetLLMResponse retrieves the cached response for a request key, or
+	// runtime.ErrLLMCacheMiss. Expired entries are returned too.
+	GetLLMResponse(accountID, key string) (runtime.LLMCacheEntry, error)
+
+	// SaveLLMResponse persists a cached response, replacing the stored one
+	SaveLLMResponse(entry runtime.LLMCacheEntry) error
+}
+
+// MailboxState is the progress of a mailbox watcher in a folder: the
+// messages up to LastUID have been processed. UIDs are only meaningful
+// while the folder keeps its UIDValidity.
+type MailboxState struct {
+	WatcherID   string    `json:"watcher_id"`
+	Folder      string    `json:"folder"`
+	UIDValidity uint32    `json:"uid_validity"`
+	LastUID     uint32    `json:"last_uid"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MailboxStateStore manages the persistence of mailbox watcher progress
+type MailboxStateStore interface {
+	// GetMailboxState retrieves the state of a watcher's folder, or
+	// ErrMailboxStateNotFound
+	GetMailboxState(watcherID, folder string) (MailboxState, error)
+
+	// SaveMailboxState persists the state, replacing the stored one
+	SaveMailboxState(state MailboxState) error
+}
+
+// CheckpointStore manages the persistence of execution checkpoints
+type CheckpointStore interface {
+	// SaveCheckpoint persists a checkpoint, replacing the one of the same
+	// execution and node
+	SaveCheckpoint(checkpoint runtime.Checkpoint) error
+
+	// GetCheckpoint retrieves the checkpoint of a node, or
+	// runtime.ErrCheckpointNotFound
+	GetCheckpoint(executionID, nodeID string) (runtime.Checkpoint, error)
+}
@@ -3,19 +3,23 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/utils"
 )
 
 // Errors returned by the in-memory storage provider
 var (
 	ErrFlowNotFound      = errors.New("flow not found")
 	ErrSecretNotFound    = errors.New("secret not found")
-	ErrExecutionNotFound = errors.New("execution not found")
+	ErrExecutionNotFound = runtime.ErrExecutionNotFound
 	ErrAccountNotFound   = errors.New("account not found")
+
+	ErrMailboxStateNotFound = errors.New("mailbox state not found")
 )
 
 // MemoryProvider implements the StorageProvider interface using in-memory storage
@@ -24,6 +28,12 @@ type MemoryProvider struct {
 	secretStore    *MemorySecretStore
 	executionStore *MemoryExecutionStore
 	accountStore   *MemoryAccountStore
+
+	conversationStore *MemoryConversationStore
+	promptStore       *MemoryPromptStore
+	llmCacheStore     *MemoryLLMCacheStore
+	mailboxStateStore *MemoryMailboxStateStore
+	checkpointStore   *MemoryCheckpointStore
 }
 
 // NewMemoryProvider creates a new in-memory storage provider
@@ -33,6 +43,12 @@ func NewMemoryProvider() *MemoryProvider {
 		secretStore:    NewMemorySecretStore(),
 		executionStore: NewMemoryExecutionStore(),
 		accountStore:   NewMemoryAccountStore(),
+
+		conversationStore: NewMemoryConversationStore(),
+		promptStore:       NewMemoryPromptStore(),
+		llmCacheStore:     NewMemoryLLMCacheStore(),
+		mailboxStateStore: NewMemoryMailboxStateStore(),
+		checkpointStore:   NewMemoryCheckpointStore(),
 	}
 }
 
@@ -68,6 +84,31 @@ func (p *MemoryProvider) GetAccountStore() AccountStore {
 	return p.accountStore
 }
 
+// GetConversationStore returns a store for conversation memory
+func (p *MemoryProvider) GetConversationStore() ConversationStore {
+	return p.conversationStore
+}
+
+// GetPromptStore returns a store for prompt templates
+func (p *MemoryProvider) GetPromptStore() PromptStore {
+	return p.promptStore
+}
+
+// GetLLMCacheStore returns a store for cached LLM responses
+func (p *MemoryProvider) GetLLMCacheStore() LLMCacheStore {
+	return p.llmCacheStore
+}
+
+// GetMailboxStateStore returns a store for the progress of mailbox watchers
+func (p *MemoryProvider) GetMailboxStateStore() MailboxStateStore {
+	return p.mailboxStateStore
+}
+
+// GetCheckpointStore returns a store for execution checkpoints
+func (p *MemoryProvider) GetCheckpointStore() CheckpointStore {
+	return p.checkpointStore
+}
+
 // MemoryFlowStore implements the FlowStore interface using in-memory storage
 type MemoryFlowStore struct {
 	flows    map[string]map[string][]byte
@@ -358,6 +399,9 @@ func (s *MemoryExecutionStore) SaveExecution(execution runtime.ExecutionStatus)
 	if wrapper, ok := s.executions[execution.ID]; ok {
 		accountID = wrapper.AccountID
 	}
+	if accountID == "" {
+		accountID = execution.Metadata["account_id"]
+	}
 
 	// Store the execution
 	s.executions[execution.ID] = ExecutionWrapper{
@@ -545,6 +589,318 @@ func (s *MemoryAccountStore) DeleteAccount(accountID string) error {
 	return nil
 }
 
+// MemoryConversationStore implements the ConversationStore interface using in-memory storage
+type MemoryConversationStore struct {
+	conversations map[string]map[string]runtime.Conversation // accountID -> sessionID -> conversation
+	mu            sync.RWMutex
+}
+
+// NewMemoryConversationStore creates a new in-memory conversation store
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{
+		conversations: make(map[string]map[string]runtime.Conversation),
+	}
+}
+
+// SaveConversation persists a conversation
+func (s *MemoryConversationStore) SaveConversation(conversation runtime.Conversation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conversations[conversation.AccountID]; !ok {
+		s.conversations[conversation.AccountID] = make(map[string]runtime.Conversation)
+	}
+
+	// Only the version that was loaded can be replaced
+	stored := s.conversations[conversation.AccountID][conversation.SessionID]
+	if stored.Version != conversation.Version {
+		return runtime.ErrConversationConflict
+	}
+	conversation.Version++
+
+	// Copy the messages so that callers appending to theirs do not change the stored ones
+	conversation.Messages = append([]utils.Message(nil), conversation.Messages...)
+	s.conversations[conversation.AccountID][conversation.SessionID] = conversation
+
+	return nil
+}
+
+// GetConversation retrieves the conversation of a session
+func (s *MemoryConversationStore) GetConversation(accountID, sessionID string) (runtime.Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversation, ok := s.conversations[accountID][sessionID]
+	if !ok {
+		return runtime.Conversation{}, runtime.ErrConversationNotFound
+	}
+	conversation.Messages = append([]utils.Message(nil), conversation.Messages...)
+
+	return conversation, nil
+}
+
+// ListConversations returns all conversations for an account
+func (s *MemoryConversationStore) ListConversations(accountID string) ([]runtime.Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversations := make([]runtime.Conversation, 0, len(s.conversations[accountID]))
+	for _, conversation := range s.conversations[accountID] {
+		conversation.Messages = append([]utils.Message(nil), conversation.Messages...)
+		conversations = append(conversations, conversation)
+	}
+
+	return conversations, nil
+}
+
+// DeleteConversation removes the conversation of a session
+func (s *MemoryConversationStore) DeleteConversation(accountID, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conversations[accountID][sessionID]; !ok {
+		return runtime.ErrConversationNotFound
+	}
+	delete(s.conversations[accountID], sessionID)
+
+	return nil
+}
+
+// MemoryPromptStore implements the PromptStore interface using in-memory storage
+type MemoryPromptStore struct {
+	prompts map[string]map[string]map[int]runtime.Prompt // accountID -> name -> version -> prompt
+	mu      sync.RWMutex
+}
+
+// NewMemoryPromptStore creates a new in-memory prompt store
+func NewMemoryPromptStore() *MemoryPromptStore {
+	return &MemoryPromptStore{
+		prompts: make(map[string]map[string]map[int]runtime.Prompt),
+	}
+}
+
+// copyPrompt returns a prompt whose slices are not shared with p
+func copyPrompt(p runtime.Prompt) runtime.Prompt {
+	p.Messages = append([]runtime.PromptMessage(nil), p.Messages...)
+	p.Variables = append([]string(nil), p.Variables...)
+	p.Tags = append([]string(nil), p.Tags...)
+	return p
+}
+
+// CreatePromptVersion persists a new prompt version
+func (s *MemoryPromptStore) CreatePromptVersion(prompt runtime.Prompt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.prompts[prompt.AccountID][prompt.Name][prompt.Version]; ok {
+		return runtime.ErrPromptVersionExists
+	}
+	s.savePrompt(prompt)
+
+	return nil
+}
+
+// SavePrompt persists a prompt version
+func (s *MemoryPromptStore) SavePrompt(prompt runtime.Prompt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.savePrompt(prompt)
+
+	return nil
+}
+
+// savePrompt stores a prompt version; the caller holds s.mu
+func (s *MemoryPromptStore) savePrompt(prompt runtime.Prompt) {
+	if _, ok := s.prompts[prompt.AccountID]; !ok {
+		s.prompts[prompt.AccountID] = make(map[string]map[int]runtime.Prompt)
+	}
+	if _, ok := s.prompts[prompt.AccountID][prompt.Name]; !ok {
+		s.prompts[prompt.AccountID][prompt.Name] = make(map[int]runtime.Prompt)
+	}
+	s.prompts[prompt.AccountID][prompt.Name][prompt.Version] = copyPrompt(prompt)
+}
+
+// GetPrompt retrieves a version of a prompt
+func (s *MemoryPromptStore) GetPrompt(accountID, name string, version int) (runtime.Prompt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prompt, ok := s.prompts[accountID][name][version]
+	if !ok {
+		return runtime.Prompt{}, runtime.ErrPromptNotFound
+	}
+
+	return copyPrompt(prompt), nil
+}
+
+// ListPromptVersions returns the versions of a prompt, oldest first
+func (s *MemoryPromptStore) ListPromptVersions(accountID, name string) ([]runtime.Prompt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := make([]runtime.Prompt, 0, len(s.prompts[accountID][name]))
+	for _, prompt := range s.prompts[accountID][name] {
+		versions = append(versions, copyPrompt(prompt))
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	return versions, nil
+}
+
+// ListPrompts returns all versions of all prompts for an account
+func (s *MemoryPromptStore) ListPrompts(accountID string) ([]runtime.Prompt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var prompts []runtime.Prompt
+	for _, versions := range s.prompts[accountID] {
+		for _, prompt := range versions {
+			prompts = append(prompts, copyPrompt(prompt))
+		}
+	}
+
+	return prompts, nil
+}
+
+// DeletePrompt removes all versions of a prompt
+func (s *MemoryPromptStore) DeletePrompt(accountID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.prompts[accountID][name]; !ok {
+		return runtime.ErrPromptNotFound
+	}
+	delete(s.prompts[accountID], name)
+
+	return nil
+}
+
+// MemoryLLMCacheStore implements the LLMCacheStore interface using in-memory storage
+type MemoryLLMCacheStore struct {
+	entries map[string]map[string]runtime.LLMCacheEntry // accountID -> key -> entry
+	mu      sync.RWMutex
+}
+
+// NewMemoryLLMCacheStore creates a new in-memory LLM cache store
+func NewMemoryLLMCacheStore() *MemoryLLMCacheStore {
+	return &MemoryLLMCacheStore{
+		entries: make(map[string]map[string]runtime.LLMCacheEntry),
+	}
+}
+
+// GetLLMResponse retrieves the cached response for a request key
+func (s *MemoryLLMCacheStore) GetLLMResponse(accountID, key string) (runtime.LLMCacheEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.entries[accountID][key]
+	if !ok {
+		return runtime.LLMCacheEntry{}, runtime.ErrLLMCacheMiss
+	}
+
+	return entry, nil
+}
+
+// SaveLLMResponse persists a cached response
+func (s *MemoryLLMCacheStore) SaveLLMResponse(entry runtime.LLMCacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[entry.AccountID]; !ok {
+		s.entries[entry.AccountID] = make(map[string]runtime.LLMCacheEntry)
+	}
+
+	// Expired entries of the account are dropped as new ones come in
+	now := time.Now()
+	for key, stored := range s.entries[entry.AccountID] {
+		if !stored.ExpiresAt.IsZero() && now.After(stored.ExpiresAt) {
+			delete(s.entries[entry.AccountID], key)
+		}
+	}
+	s.entries[entry.AccountID][entry.Key] = entry
+
+	return nil
+}
+
+// MemoryMailboxStateStore implements the MailboxStateStore interface using in-memory storage
+type MemoryMailboxStateStore struct {
+	states map[string]map[string]MailboxState // watcherID -> folder -> state
+	mu     sync.RWMutex
+}
+
+// NewMemoryMailboxStateStore creates a new in-memory mailbox state store
+func NewMemoryMailboxStateStore() *MemoryMailboxStateStore {
+	return &MemoryMailboxStateStore{
+		states: make(map[string]map[string]MailboxState),
+	}
+}
+
+// GetMailboxState retrieves the state of a watcher's folder
+func (s *MemoryMailboxStateStore) GetMailboxState(watcherID, folder string) (MailboxState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.states[watcherID][folder]
+	if !ok {
+		return MailboxState{}, ErrMailboxStateNotFound
+	}
+
+	return state, nil
+}
+
+// SaveMailboxState persists the state of a watcher's folder
+func (s *MemoryMailboxStateStore) SaveMailboxState(state MailboxState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.states[state.WatcherID]; !ok {
+		s.states[state.WatcherID] = make(map[string]MailboxState)
+	}
+	s.states[state.WatcherID][state.Folder] = state
+
+	return nil
+}
+
+// MemoryCheckpointStore implements the CheckpointStore interface using in-memory storage
+type MemoryCheckpointStore struct {
+	checkpoints map[string]map[string]runtime.Checkpoint // executionID -> nodeID -> checkpoint
+	mu          sync.RWMutex
+}
+
+// NewMemoryCheckpointStore creates a new in-memory checkpoint store
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		checkpoints: make(map[string]map[string]runtime.Checkpoint),
+	}
+}
+
+// SaveCheckpoint persists the checkpoint of a node
+func (s *MemoryCheckpointStore) SaveCheckpoint(checkpoint runtime.Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.checkpoints[checkpoint.ExecutionID]; !ok {
+		s.checkpoints[checkpoint.ExecutionID] = make(map[string]runtime.Checkpoint)
+	}
+	s.checkpoints[checkpoint.ExecutionID][checkpoint.NodeID] = checkpoint
+
+	return nil
+}
+
+// GetCheckpoint retrieves the checkpoint of a node
+func (s *MemoryCheckpointStore) GetCheckpoint(executionID, nodeID string) (runtime.Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	checkpoint, ok := s.checkpoints[executionID][nodeID]
+	if !ok {
+		return runtime.Checkpoint{}, runtime.ErrCheckpointNotFound
+	}
+
+	return checkpoint, nil
+}
+
 // SaveFlowVersion persists a new version of a flow definition
 func (s *MemoryFlowStore) SaveFlowVersion(accountID, flowID string, definition []byte, version string) error {
 	s.mu.Lock()
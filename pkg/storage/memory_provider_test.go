@@ -1,12 +1,14 @@
 package storage
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tcmartin/flowrunner/pkg/auth"
 	"github.com/tcmartin/flowrunner/pkg/runtime"
+	"github.com/tcmartin/flowrunner/pkg/utils"
 )
 
 func TestMemoryProvider(t *testing.T) {
@@ -19,6 +21,9 @@ func TestMemoryProvider(t *testing.T) {
 	assert.NotNil(t, provider.GetSecretStore())
 	assert.NotNil(t, provider.GetExecutionStore())
 	assert.NotNil(t, provider.GetAccountStore())
+	assert.NotNil(t, provider.GetConversationStore())
+	assert.NotNil(t, provider.GetPromptStore())
+	assert.NotNil(t, provider.GetMailboxStateStore())
 
 	// Test closing provider
 	err = provider.Close()
@@ -256,3 +261,204 @@ func TestMemoryAccountStore(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, ErrAccountNotFound, err)
 }
+
+func TestMemoryConversationStore(t *testing.T) {
+	store := NewMemoryConversationStore()
+
+	// Test saving and retrieving a conversation
+	conversation := runtime.Conversation{
+		AccountID: "test-account",
+		SessionID: "session-1",
+		Messages: []utils.Message{
+			{Role: "user", Content: "Hello"},
+			{Role: "assistant", Content: "Hi there"},
+		},
+		Summary:   "Greetings",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err := store.SaveConversation(conversation)
+	assert.NoError(t, err)
+
+	retrieved, err := store.GetConversation("test-account", "session-1")
+	assert.NoError(t, err)
+	assert.Equal(t, conversation.Messages, retrieved.Messages)
+	assert.Equal(t, "Greetings", retrieved.Summary)
+
+	// Saves replace the version they loaded only
+	assert.Equal(t, int64(1), retrieved.Version)
+	assert.Equal(t, runtime.ErrConversationConflict, store.SaveConversation(conversation))
+	retrieved.Summary = "Greetings again"
+	assert.NoError(t, store.SaveConversation(retrieved))
+	assert.Equal(t, runtime.ErrConversationConflict, store.SaveConversation(retrieved))
+	retrieved, _ = store.GetConversation("test-account", "session-1")
+	assert.Equal(t, int64(2), retrieved.Version)
+	assert.Equal(t, "Greetings again", retrieved.Summary)
+
+	// Retrieved messages are copies
+	retrieved.Messages[0].Content = "changed"
+	retrieved, _ = store.GetConversation("test-account", "session-1")
+	assert.Equal(t, "Hello", retrieved.Messages[0].Content)
+
+	// Sessions are scoped to their account
+	_, err = store.GetConversation("other-account", "session-1")
+	assert.Equal(t, runtime.ErrConversationNotFound, err)
+
+	// Test listing conversations
+	conversations, err := store.ListConversations("test-account")
+	assert.NoError(t, err)
+	assert.Len(t, conversations, 1)
+	conversations, err = store.ListConversations("other-account")
+	assert.NoError(t, err)
+	assert.Empty(t, conversations)
+
+	// Test deleting a conversation
+	err = store.DeleteConversation("test-account", "session-1")
+	assert.NoError(t, err)
+	_, err = store.GetConversation("test-account", "session-1")
+	assert.Equal(t, runtime.ErrConversationNotFound, err)
+	err = store.DeleteConversation("test-account", "session-1")
+	assert.Equal(t, runtime.ErrConversationNotFound, err)
+}
+
+func TestMemoryPromptStore(t *testing.T) {
+	store := NewMemoryPromptStore()
+
+	// Test saving versions out of order
+	for _, version := range []int{2, 1} {
+		err := store.SavePrompt(runtime.Prompt{
+			AccountID: "test-account",
+			Name:      "greeting",
+			Version:   version,
+			Messages:  []runtime.PromptMessage{{Role: "user", Template: "Hello {{.name}}"}},
+			Tags:      []string{fmt.Sprintf("v%d", version)},
+			CreatedAt: time.Now(),
+		})
+		assert.NoError(t, err)
+	}
+
+	retrieved, err := store.GetPrompt("test-account", "greeting", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v2"}, retrieved.Tags)
+
+	// New versions never replace stored ones
+	err = store.CreatePromptVersion(runtime.Prompt{AccountID: "test-account", Name: "greeting", Version: 2})
+	assert.Equal(t, runtime.ErrPromptVersionExists, err)
+	err = store.CreatePromptVersion(runtime.Prompt{AccountID: "test-account", Name: "greeting", Version: 3, CreatedAt: time.Now()})
+	assert.NoError(t, err)
+	retrieved, _ = store.GetPrompt("test-account", "greeting", 2)
+	assert.Equal(t, []string{"v2"}, retrieved.Tags)
+
+	// Retrieved prompts are copies
+	retrieved.Tags[0] = "changed"
+	retrieved, _ = store.GetPrompt("test-account", "greeting", 2)
+	assert.Equal(t, "v2", retrieved.Tags[0])
+
+	// Versions are listed oldest first
+	versions, err := store.ListPromptVersions("test-account", "greeting")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, 1, versions[0].Version)
+
+	// Prompts are scoped to their account
+	_, err = store.GetPrompt("other-account", "greeting", 1)
+	assert.Equal(t, runtime.ErrPromptNotFound, err)
+	prompts, err := store.ListPrompts("other-account")
+	assert.NoError(t, err)
+	assert.Empty(t, prompts)
+
+	// Test deleting all versions
+	err = store.DeletePrompt("test-account", "greeting")
+	assert.NoError(t, err)
+	_, err = store.GetPrompt("test-account", "greeting", 1)
+	assert.Equal(t, runtime.ErrPromptNotFound, err)
+	err = store.DeletePrompt("test-account", "greeting")
+	assert.Equal(t, runtime.ErrPromptNotFound, err)
+}
+
+func TestMemoryLLMCacheStore(t *testing.T) {
+	store := NewMemoryLLMCacheStore()
+
+	// Test a key that was never cached
+	_, err := store.GetLLMResponse("test-account", "key-1")
+	assert.Equal(t, runtime.ErrLLMCacheMiss, err)
+
+	entry := runtime.LLMCacheEntry{
+		AccountID: "test-account",
+		Key:       "key-1",
+		Provider:  "openai",
+		Model:     "gpt-4o",
+		Response:  utils.LLMResponse{ID: "chatcmpl-1", Model: "gpt-4o"},
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	err = store.SaveLLMResponse(entry)
+	assert.NoError(t, err)
+
+	cached, err := store.GetLLMResponse("test-account", "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "chatcmpl-1", cached.Response.ID)
+	assert.Equal(t, "gpt-4o", cached.Model)
+
+	// Entries are scoped to their account
+	_, err = store.GetLLMResponse("other-account", "key-1")
+	assert.Equal(t, runtime.ErrLLMCacheMiss, err)
+
+	// Expired entries are dropped when others are saved
+	entry.Key = "key-2"
+	entry.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.NoError(t, store.SaveLLMResponse(entry))
+	entry.Key = "key-3"
+	entry.ExpiresAt = time.Time{}
+	assert.NoError(t, store.SaveLLMResponse(entry))
+	_, err = store.GetLLMResponse("test-account", "key-2")
+	assert.Equal(t, runtime.ErrLLMCacheMiss, err)
+	_, err = store.GetLLMResponse("test-account", "key-3")
+	assert.NoError(t, err)
+}
+
+func TestMemoryMailboxStateStore(t *testing.T) {
+	store := NewMemoryMailboxStateStore()
+
+	_, err := store.GetMailboxState("support", "INBOX")
+	assert.Equal(t, ErrMailboxStateNotFound, err)
+
+	state := MailboxState{WatcherID: "support", Folder: "INBOX", UIDValidity: 7, LastUID: 42, UpdatedAt: time.Now()}
+	assert.NoError(t, store.SaveMailboxState(state))
+
+	saved, err := store.GetMailboxState("support", "INBOX")
+	assert.NoError(t, err)
+	assert.Equal(t, state, saved)
+
+	// States are scoped to their folder and replaced on save
+	_, err = store.GetMailboxState("support", "Archive")
+	assert.Equal(t, ErrMailboxStateNotFound, err)
+	state.LastUID = 43
+	assert.NoError(t, store.SaveMailboxState(state))
+	saved, err = store.GetMailboxState("support", "INBOX")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(43), saved.LastUID)
+}
+
+func TestMemoryCheckpointStore(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+
+	_, err := store.GetCheckpoint("exec-1", "first")
+	assert.Equal(t, runtime.ErrCheckpointNotFound, err)
+
+	checkpoint := runtime.Checkpoint{ExecutionID: "exec-1", NodeID: "first", Data: []byte(`{"value":1}`), CreatedAt: time.Now()}
+	assert.NoError(t, store.SaveCheckpoint(checkpoint))
+
+	saved, err := store.GetCheckpoint("exec-1", "first")
+	assert.NoError(t, err)
+	assert.Equal(t, checkpoint, saved)
+
+	// Checkpoints are scoped to their node and replaced on save
+	_, err = store.GetCheckpoint("exec-1", "second")
+	assert.Equal(t, runtime.ErrCheckpointNotFound, err)
+	checkpoint.Data = []byte(`{"value":2}`)
+	assert.NoError(t, store.SaveCheckpoint(checkpoint))
+	saved, err = store.GetCheckpoint("exec-1", "first")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"value":2}`, string(saved.Data))
+}
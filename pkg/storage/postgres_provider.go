@@ -18,6 +18,12 @@ type PostgreSQLProvider struct {
 	secretStore    *PostgreSQLSecretStore
 	executionStore *PostgreSQLExecutionStore
 	accountStore   *PostgreSQLAccountStore
+
+	conversationStore *PostgreSQLConversationStore
+	promptStore       *PostgreSQLPromptStore
+	llmCacheStore     *PostgreSQLLLMCacheStore
+	mailboxStateStore *PostgreSQLMailboxStateStore
+	checkpointStore   *PostgreSQLCheckpointStore
 }
 
 // PostgreSQLProviderConfig contains configuration for the PostgreSQL provider
@@ -69,6 +75,11 @@ func NewPostgreSQLProvider(config PostgreSQLProviderConfig) (*PostgreSQLProvider
 	provider.secretStore = NewPostgreSQLSecretStore(db)
 	provider.executionStore = NewPostgreSQLExecutionStore(db)
 	provider.accountStore = NewPostgreSQLAccountStore(db)
+	provider.conversationStore = NewPostgreSQLConversationStore(db)
+	provider.promptStore = NewPostgreSQLPromptStore(db)
+	provider.llmCacheStore = NewPostgreSQLLLMCacheStore(db)
+	provider.mailboxStateStore = NewPostgreSQLMailboxStateStore(db)
+	provider.checkpointStore = NewPostgreSQLCheckpointStore(db)
 
 	return provider, nil
 }
@@ -92,6 +103,25 @@ func (p *PostgreSQLProvider) Initialize() error {
 		return fmt.Errorf("failed to initialize account store: %w", err)
 	}
 
+	if err := p.conversationStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize conversation store: %w", err)
+	}
+
+	if err := p.promptStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize prompt store: %w", err)
+	}
+
+	if err := p.llmCacheStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize LLM cache store: %w", err)
+	}
+
+	if err := p.mailboxStateStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize mailbox state store: %w", err)
+	}
+	if err := p.checkpointStore.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize checkpoint store: %w", err)
+	}
+
 	return nil
 }
 
@@ -120,6 +150,31 @@ func (p *PostgreSQLProvider) GetAccountStore() AccountStore {
 	return p.accountStore
 }
 
+// GetConversationStore returns a store for conversation memory
+func (p *PostgreSQLProvider) GetConversationStore() ConversationStore {
+	return p.conversationStore
+}
+
+// GetPromptStore returns a store for prompt templates
+func (p *PostgreSQLProvider) GetPromptStore() PromptStore {
+	return p.promptStore
+}
+
+// GetLLMCacheStore returns a store for cached LLM responses
+func (p *PostgreSQLProvider) GetLLMCacheStore() LLMCacheStore {
+	return p.llmCacheStore
+}
+
+// GetMailboxStateStore returns a store for the progress of mailbox watchers
+func (p *PostgreSQLProvider) GetMailboxStateStore() MailboxStateStore {
+	return p.mailboxStateStore
+}
+
+// GetCheckpointStore returns a store for execution checkpoints
+func (p *PostgreSQLProvider) GetCheckpointStore() CheckpointStore {
+	return p.checkpointStore
+}
+
 // PostgreSQLFlowStore implements the FlowStore interface using PostgreSQL
 type PostgreSQLFlowStore struct {
 	db *sql.DB
@@ -563,6 +618,9 @@ func (s *PostgreSQLExecutionStore) Initialize() error {
 		);
 		CREATE INDEX IF NOT EXISTS executions_account_id_idx ON executions (account_id);
 		CREATE INDEX IF NOT EXISTS executions_flow_id_idx ON executions (flow_id);
+		ALTER TABLE executions ADD COLUMN IF NOT EXISTS input JSONB;
+		ALTER TABLE executions ADD COLUMN IF NOT EXISTS metadata JSONB;
+		ALTER TABLE executions ADD COLUMN IF NOT EXISTS usage JSONB;
 	`)
 
 	if err != nil {
@@ -601,6 +659,27 @@ func (s *PostgreSQLExecutionStore) SaveExecution(execution runtime.ExecutionStat
 		}
 	}
 
+	// Marshal input, metadata and usage to JSON
+	var inputJSON, metadataJSON, usageJSON []byte
+	if execution.Input != nil {
+		inputJSON, err = json.Marshal(execution.Input)
+		if err != nil {
+			return fmt.Errorf("failed to marshal execution input: %w", err)
+		}
+	}
+	if execution.Metadata != nil {
+		metadataJSON, err = json.Marshal(execution.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal execution metadata: %w", err)
+		}
+	}
+	if execution.Usage != nil {
+		usageJSON, err = json.Marshal(execution.Usage)
+		if err != nil {
+			return fmt.Errorf("failed to marshal execution usage: %w", err)
+		}
+	}
+
 	// Check if execution already exists and get the account ID
 	var exists bool
 	var accountID sql.NullString
@@ -620,8 +699,11 @@ func (s *PostgreSQLExecutionStore) SaveExecution(execution runtime.ExecutionStat
 				error = $5, 
 				results = $6, 
 				progress = $7, 
-				current_node = $8 
-			WHERE id = $9`,
+				current_node = $8,
+				input = $9,
+				metadata = $10,
+				usage = $11
+			WHERE id = $12`,
 			execution.FlowID,
 			execution.Status,
 			execution.StartTime,
@@ -630,16 +712,21 @@ func (s *PostgreSQLExecutionStore) SaveExecution(execution runtime.ExecutionStat
 			resultsJSON,
 			execution.Progress,
 			execution.CurrentNode,
+			inputJSON,
+			metadataJSON,
+			usageJSON,
 			execution.ID,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to update execution: %w", err)
 		}
 	} else {
-		// For new executions, we need to extract the account ID from the execution ID
-		// This is a temporary workaround - in production, you'd want to pass account ID explicitly
-		// For now, we'll set a placeholder account ID that can be updated later
+		// The runtime records the owning account in the metadata; older
+		// executions without it get a placeholder that can be updated later
 		placeholderAccountID := "unknown"
+		if id := execution.Metadata["account_id"]; id != "" {
+			placeholderAccountID = id
+		}
 
 		_, err = s.db.Exec(
 			`INSERT INTO executions (
@@ -652,8 +739,11 @@ func (s *PostgreSQLExecutionStore) SaveExecution(execution runtime.ExecutionStat
 				error, 
 				results, 
 				progress, 
-				current_node
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+				current_node,
+				input,
+				metadata,
+				usage
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
 			execution.ID,
 			execution.FlowID,
 			placeholderAccountID,
@@ -664,6 +754,9 @@ func (s *PostgreSQLExecutionStore) SaveExecution(execution runtime.ExecutionStat
 			resultsJSON,
 			execution.Progress,
 			execution.CurrentNode,
+			inputJSON,
+			metadataJSON,
+			usageJSON,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert execution: %w", err)
@@ -690,7 +783,7 @@ func (s *PostgreSQLExecutionStore) SetExecutionAccountID(executionID, accountID
 // GetExecution retrieves execution data
 func (s *PostgreSQLExecutionStore) GetExecution(executionID string) (runtime.ExecutionStatus, error) {
 	var execution runtime.ExecutionStatus
-	var resultsJSON []byte
+	var resultsJSON, inputJSON, metadataJSON, usageJSON []byte
 	var endTime sql.NullTime
 
 	var accountID string         // We'll ignore this since ExecutionStatus doesn't have AccountID
@@ -708,7 +801,10 @@ func (s *PostgreSQLExecutionStore) GetExecution(executionID string) (runtime.Exe
 			error, 
 			results, 
 			progress, 
-			current_node 
+			current_node,
+			input,
+			metadata,
+			usage
 		FROM executions WHERE id = $1`,
 		executionID,
 	).Scan(
@@ -722,6 +818,9 @@ func (s *PostgreSQLExecutionStore) GetExecution(executionID string) (runtime.Exe
 		&resultsJSON,
 		&progress,
 		&currentNode,
+		&inputJSON,
+		&metadataJSON,
+		&usageJSON,
 	)
 
 	// Handle nullable fields
@@ -760,9 +859,33 @@ func (s *PostgreSQLExecutionStore) GetExecution(executionID string) (runtime.Exe
 		}
 	}
 
+	if err := unmarshalExecutionExtras(&execution, inputJSON, metadataJSON, usageJSON); err != nil {
+		return runtime.ExecutionStatus{}, err
+	}
+
 	return execution, nil
 }
 
+// unmarshalExecutionExtras decodes the optional input, metadata and usage columns of an execution row
+func unmarshalExecutionExtras(execution *runtime.ExecutionStatus, inputJSON, metadataJSON, usageJSON []byte) error {
+	if len(inputJSON) > 0 {
+		if err := json.Unmarshal(inputJSON, &execution.Input); err != nil {
+			return fmt.Errorf("failed to unmarshal execution input: %w", err)
+		}
+	}
+	if len(metadataJSON) > 0 {
+		if err := json.Unmarshal(metadataJSON, &execution.Metadata); err != nil {
+			return fmt.Errorf("failed to unmarshal execution metadata: %w", err)
+		}
+	}
+	if len(usageJSON) > 0 {
+		if err := json.Unmarshal(usageJSON, &execution.Usage); err != nil {
+			return fmt.Errorf("failed to unmarshal execution usage: %w", err)
+		}
+	}
+	return nil
+}
+
 // ListExecutions returns all executions for an account
 func (s *PostgreSQLExecutionStore) ListExecutions(accountID string) ([]runtime.ExecutionStatus, error) {
 	rows, err := s.db.Query(
@@ -776,7 +899,10 @@ func (s *PostgreSQLExecutionStore) ListExecutions(accountID string) ([]runtime.E
 			error, 
 			results, 
 			progress, 
-			current_node 
+			current_node,
+			input,
+			metadata,
+			usage
 		FROM executions WHERE account_id = $1
 		ORDER BY start_time DESC`,
 		accountID,
@@ -789,7 +915,7 @@ func (s *PostgreSQLExecutionStore) ListExecutions(accountID string) ([]runtime.E
 	var executions []runtime.ExecutionStatus
 	for rows.Next() {
 		var execution runtime.ExecutionStatus
-		var resultsJSON []byte
+		var resultsJSON, inputJSON, metadataJSON, usageJSON []byte
 		var endTime sql.NullTime
 
 		var accountID string         // Local variable for account ID
@@ -807,6 +933,9 @@ func (s *PostgreSQLExecutionStore) ListExecutions(accountID string) ([]runtime.E
 			&resultsJSON,
 			&progress,
 			&currentNode,
+			&inputJSON,
+			&metadataJSON,
+			&usageJSON,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan execution: %w", err)
 		}
@@ -823,6 +952,10 @@ func (s *PostgreSQLExecutionStore) ListExecutions(accountID string) ([]runtime.E
 			}
 		}
 
+		if err := unmarshalExecutionExtras(&execution, inputJSON, metadataJSON, usageJSON); err != nil {
+			return nil, err
+		}
+
 		executions = append(executions, execution)
 	}
 
@@ -931,6 +1064,7 @@ func (s *PostgreSQLAccountStore) Initialize() error {
 		);
 		CREATE INDEX IF NOT EXISTS accounts_username_idx ON accounts (username);
 		CREATE INDEX IF NOT EXISTS accounts_api_token_idx ON accounts (api_token);
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS quota JSONB;
 	`)
 
 	if err != nil {
@@ -949,14 +1083,23 @@ func (s *PostgreSQLAccountStore) SaveAccount(account auth.Account) error {
 		return fmt.Errorf("failed to check if account exists: %w", err)
 	}
 
+	var quotaJSON []byte
+	if account.Quota != nil {
+		quotaJSON, err = json.Marshal(account.Quota)
+		if err != nil {
+			return fmt.Errorf("failed to marshal account quota: %w", err)
+		}
+	}
+
 	if exists {
 		// Update existing account
 		_, err = s.db.Exec(
-			"UPDATE accounts SET username = $1, password_hash = $2, api_token = $3, updated_at = $4 WHERE id = $5",
+			"UPDATE accounts SET username = $1, password_hash = $2, api_token = $3, updated_at = $4, quota = $5 WHERE id = $6",
 			account.Username,
 			account.PasswordHash,
 			account.APIToken,
 			account.UpdatedAt,
+			quotaJSON,
 			account.ID,
 		)
 		if err != nil {
@@ -965,13 +1108,14 @@ func (s *PostgreSQLAccountStore) SaveAccount(account auth.Account) error {
 	} else {
 		// Insert new account
 		_, err = s.db.Exec(
-			"INSERT INTO accounts (id, username, password_hash, api_token, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
+			"INSERT INTO accounts (id, username, password_hash, api_token, created_at, updated_at, quota) VALUES ($1, $2, $3, $4, $5, $6, $7)",
 			account.ID,
 			account.Username,
 			account.PasswordHash,
 			account.APIToken,
 			account.CreatedAt,
 			account.UpdatedAt,
+			quotaJSON,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert account: %w", err)
@@ -984,9 +1128,10 @@ func (s *PostgreSQLAccountStore) SaveAccount(account auth.Account) error {
 // GetAccount retrieves an account
 func (s *PostgreSQLAccountStore) GetAccount(accountID string) (auth.Account, error) {
 	var account auth.Account
+	var quotaJSON []byte
 
 	err := s.db.QueryRow(
-		"SELECT id, username, password_hash, api_token, created_at, updated_at FROM accounts WHERE id = $1",
+		"SELECT id, username, password_hash, api_token, created_at, updated_at, quota FROM accounts WHERE id = $1",
 		accountID,
 	).Scan(
 		&account.ID,
@@ -995,7 +1140,11 @@ func (s *PostgreSQLAccountStore) GetAccount(accountID string) (auth.Account, err
 		&account.APIToken,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&quotaJSON,
 	)
+	if err == nil {
+		err = unmarshalAccountQuota(&account, quotaJSON)
+	}
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1010,9 +1159,10 @@ func (s *PostgreSQLAccountStore) GetAccount(accountID string) (auth.Account, err
 // GetAccountByUsername retrieves an account by username
 func (s *PostgreSQLAccountStore) GetAccountByUsername(username string) (auth.Account, error) {
 	var account auth.Account
+	var quotaJSON []byte
 
 	err := s.db.QueryRow(
-		"SELECT id, username, password_hash, api_token, created_at, updated_at FROM accounts WHERE username = $1",
+		"SELECT id, username, password_hash, api_token, created_at, updated_at, quota FROM accounts WHERE username = $1",
 		username,
 	).Scan(
 		&account.ID,
@@ -1021,7 +1171,11 @@ func (s *PostgreSQLAccountStore) GetAccountByUsername(username string) (auth.Acc
 		&account.APIToken,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&quotaJSON,
 	)
+	if err == nil {
+		err = unmarshalAccountQuota(&account, quotaJSON)
+	}
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1036,9 +1190,10 @@ func (s *PostgreSQLAccountStore) GetAccountByUsername(username string) (auth.Acc
 // GetAccountByToken retrieves an account by API token
 func (s *PostgreSQLAccountStore) GetAccountByToken(token string) (auth.Account, error) {
 	var account auth.Account
+	var quotaJSON []byte
 
 	err := s.db.QueryRow(
-		"SELECT id, username, password_hash, api_token, created_at, updated_at FROM accounts WHERE api_token = $1",
+		"SELECT id, username, password_hash, api_token, created_at, updated_at, quota FROM accounts WHERE api_token = $1",
 		token,
 	).Scan(
 		&account.ID,
@@ -1047,7 +1202,11 @@ func (s *PostgreSQLAccountStore) GetAccountByToken(token string) (auth.Account,
 		&account.APIToken,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&quotaJSON,
 	)
+	if err == nil {
+		err = unmarshalAccountQuota(&account, quotaJSON)
+	}
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1062,7 +1221,7 @@ func (s *PostgreSQLAccountStore) GetAccountByToken(token string) (auth.Account,
 // ListAccounts returns all accounts
 func (s *PostgreSQLAccountStore) ListAccounts() ([]auth.Account, error) {
 	rows, err := s.db.Query(
-		"SELECT id, username, password_hash, api_token, created_at, updated_at FROM accounts",
+		"SELECT id, username, password_hash, api_token, created_at, updated_at, quota FROM accounts",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list accounts: %w", err)
@@ -1072,6 +1231,7 @@ func (s *PostgreSQLAccountStore) ListAccounts() ([]auth.Account, error) {
 	var accounts []auth.Account
 	for rows.Next() {
 		var account auth.Account
+		var quotaJSON []byte
 
 		if err := rows.Scan(
 			&account.ID,
@@ -1080,9 +1240,13 @@ func (s *PostgreSQLAccountStore) ListAccounts() ([]auth.Account, error) {
 			&account.APIToken,
 			&account.CreatedAt,
 			&account.UpdatedAt,
+			&quotaJSON,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan account: %w", err)
 		}
+		if err := unmarshalAccountQuota(&account, quotaJSON); err != nil {
+			return nil, err
+		}
 
 		accounts = append(accounts, account)
 	}
@@ -1094,6 +1258,19 @@ func (s *PostgreSQLAccountStore) ListAccounts() ([]auth.Account, error) {
 	return accounts, nil
 }
 
+// unmarshalAccountQuota sets the quota of an account from its JSON column
+func unmarshalAccountQuota(account *auth.Account, quotaJSON []byte) error {
+	if len(quotaJSON) == 0 {
+		return nil
+	}
+	var quota auth.AccountQuota
+	if err := json.Unmarshal(quotaJSON, &quota); err != nil {
+		return fmt.Errorf("failed to unmarshal account quota: %w", err)
+	}
+	account.Quota = &quota
+	return nil
+}
+
 // DeleteAccount removes an account
 func (s *PostgreSQLAccountStore) DeleteAccount(accountID string) error {
 	result, err := s.db.Exec(
@@ -1221,3 +1398,595 @@ func (s *PostgreSQLFlowStore) ListFlowVersions(accountID, flowID string) ([]stri
 
 	return versions, nil
 }
+
+// PostgreSQLConversationStore implements the ConversationStore interface using PostgreSQL
+type PostgreSQLConversationStore struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLConversationStore creates a new PostgreSQL conversation store
+func NewPostgreSQLConversationStore(db *sql.DB) *PostgreSQLConversationStore {
+	return &PostgreSQLConversationStore{
+		db: db,
+	}
+}
+
+// Initialize creates the PostgreSQL tables if they don't exist
+func (s *PostgreSQLConversationStore) Initialize() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS conversations (
+			account_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			messages JSONB NOT NULL,
+			summary TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (account_id, session_id)
+		);
+		ALTER TABLE conversations ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+	`)
+
+	if err != nil {
+		return fmt.Errorf("failed to create conversations table: %w", err)
+	}
+
+	return nil
+}
+
+// SaveConversation persists a conversation
+func (s *PostgreSQLConversationStore) SaveConversation(conversation runtime.Conversation) error {
+	messagesJSON, err := json.Marshal(conversation.Messages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation messages: %w", err)
+	}
+
+	// Only the version that was loaded can be replaced
+	result, err := s.db.Exec(`
+		INSERT INTO conversations (account_id, session_id, messages, summary, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5 + 1, $6, $7)
+		ON CONFLICT (account_id, session_id)
+		DO UPDATE SET messages = $3, summary = $4, version = conversations.version + 1, updated_at = $7
+		WHERE conversations.version = $5`,
+		conversation.AccountID, conversation.SessionID, messagesJSON, conversation.Summary,
+		conversation.Version, conversation.CreatedAt, conversation.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	saved, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	if saved == 0 {
+		return runtime.ErrConversationConflict
+	}
+
+	return nil
+}
+
+// GetConversation retrieves the conversation of a session
+func (s *PostgreSQLConversationStore) GetConversation(accountID, sessionID string) (runtime.Conversation, error) {
+	rows, err := s.db.Query(
+		"SELECT account_id, session_id, messages, summary, version, created_at, updated_at FROM conversations WHERE account_id = $1 AND session_id = $2",
+		accountID, sessionID,
+	)
+	if err != nil {
+		return runtime.Conversation{}, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	conversations, err := scanConversations(rows)
+	if err != nil {
+		return runtime.Conversation{}, err
+	}
+	if len(conversations) == 0 {
+		return runtime.Conversation{}, runtime.ErrConversationNotFound
+	}
+
+	return conversations[0], nil
+}
+
+// ListConversations returns all conversations for an account
+func (s *PostgreSQLConversationStore) ListConversations(accountID string) ([]runtime.Conversation, error) {
+	rows, err := s.db.Query(
+		"SELECT account_id, session_id, messages, summary, version, created_at, updated_at FROM conversations WHERE account_id = $1 ORDER BY updated_at DESC",
+		accountID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	return scanConversations(rows)
+}
+
+// scanConversations reads and closes rows of the conversations table
+func scanConversations(rows *sql.Rows) ([]runtime.Conversation, error) {
+	defer rows.Close()
+
+	conversations := []runtime.Conversation{}
+	for rows.Next() {
+		var conversation runtime.Conversation
+		var messagesJSON []byte
+
+		if err := rows.Scan(
+			&conversation.AccountID,
+			&conversation.SessionID,
+			&messagesJSON,
+			&conversation.Summary,
+			&conversation.Version,
+			&conversation.CreatedAt,
+			&conversation.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+
+		if err := json.Unmarshal(messagesJSON, &conversation.Messages); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conversation messages: %w", err)
+		}
+
+		conversations = append(conversations, conversation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating conversation rows: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// DeleteConversation removes the conversation of a session
+func (s *PostgreSQLConversationStore) DeleteConversation(accountID, sessionID string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM conversations WHERE account_id = $1 AND session_id = $2",
+		accountID, sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return runtime.ErrConversationNotFound
+	}
+
+	return nil
+}
+
+// PostgreSQLPromptStore implements the PromptStore interface using PostgreSQL
+type PostgreSQLPromptStore struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLPromptStore creates a new PostgreSQL prompt store
+func NewPostgreSQLPromptStore(db *sql.DB) *PostgreSQLPromptStore {
+	return &PostgreSQLPromptStore{
+		db: db,
+	}
+}
+
+// Initialize creates the PostgreSQL tables if they don't exist
+func (s *PostgreSQLPromptStore) Initialize() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS prompts (
+			account_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			messages JSONB NOT NULL,
+			variables JSONB NOT NULL,
+			tags JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (account_id, name, version)
+		);
+	`)
+
+	if err != nil {
+		return fmt.Errorf("failed to create prompts table: %w", err)
+	}
+
+	return nil
+}
+
+// CreatePromptVersion persists a new prompt version
+func (s *PostgreSQLPromptStore) CreatePromptVersion(prompt runtime.Prompt) error {
+	rowsAffected, err := s.insertPrompt(prompt, "DO NOTHING")
+	if err != nil {
+		return fmt.Errorf("failed to create prompt: %w", err)
+	}
+
+	// Another writer stored the version first
+	if rowsAffected == 0 {
+		return runtime.ErrPromptVersionExists
+	}
+
+	return nil
+}
+
+// SavePrompt persists a prompt version
+func (s *PostgreSQLPromptStore) SavePrompt(prompt runtime.Prompt) error {
+	if _, err := s.insertPrompt(prompt, "DO UPDATE SET description = $4, messages = $5, variables = $6, tags = $7"); err != nil {
+		return fmt.Errorf("failed to save prompt: %w", err)
+	}
+
+	return nil
+}
+
+// insertPrompt inserts a prompt version, resolving a stored one with the
+// onConflict action, and returns the number of rows written
+func (s *PostgreSQLPromptStore) insertPrompt(prompt runtime.Prompt, onConflict string) (int64, error) {
+	messagesJSON, err := json.Marshal(prompt.Messages)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal prompt messages: %w", err)
+	}
+	variablesJSON, err := json.Marshal(append([]string{}, prompt.Variables...))
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal prompt variables: %w", err)
+	}
+	tagsJSON, err := json.Marshal(append([]string{}, prompt.Tags...))
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal prompt tags: %w", err)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO prompts (account_id, name, version, description, messages, variables, tags, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (account_id, name, version) `+onConflict,
+		prompt.AccountID, prompt.Name, prompt.Version, prompt.Description,
+		messagesJSON, variablesJSON, tagsJSON, prompt.CreatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetPrompt retrieves a version of a prompt
+func (s *PostgreSQLPromptStore) GetPrompt(accountID, name string, version int) (runtime.Prompt, error) {
+	rows, err := s.db.Query(
+		"SELECT account_id, name, version, description, messages, variables, tags, created_at FROM prompts WHERE account_id = $1 AND name = $2 AND version = $3",
+		accountID, name, version,
+	)
+	if err != nil {
+		return runtime.Prompt{}, fmt.Errorf("failed to get prompt: %w", err)
+	}
+
+	prompts, err := scanPrompts(rows)
+	if err != nil {
+		return runtime.Prompt{}, err
+	}
+	if len(prompts) == 0 {
+		return runtime.Prompt{}, runtime.ErrPromptNotFound
+	}
+
+	return prompts[0], nil
+}
+
+// ListPromptVersions returns the versions of a prompt, oldest first
+func (s *PostgreSQLPromptStore) ListPromptVersions(accountID, name string) ([]runtime.Prompt, error) {
+	rows, err := s.db.Query(
+		"SELECT account_id, name, version, description, messages, variables, tags, created_at FROM prompts WHERE account_id = $1 AND name = $2 ORDER BY version",
+		accountID, name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt versions: %w", err)
+	}
+
+	return scanPrompts(rows)
+}
+
+// ListPrompts returns all versions of all prompts for an account
+func (s *PostgreSQLPromptStore) ListPrompts(accountID string) ([]runtime.Prompt, error) {
+	rows, err := s.db.Query(
+		"SELECT account_id, name, version, description, messages, variables, tags, created_at FROM prompts WHERE account_id = $1 ORDER BY name, version",
+		accountID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompts: %w", err)
+	}
+
+	return scanPrompts(rows)
+}
+
+// scanPrompts reads and closes rows of the prompts table
+func scanPrompts(rows *sql.Rows) ([]runtime.Prompt, error) {
+	defer rows.Close()
+
+	prompts := []runtime.Prompt{}
+	for rows.Next() {
+		var prompt runtime.Prompt
+		var messagesJSON, variablesJSON, tagsJSON []byte
+
+		if err := rows.Scan(
+			&prompt.AccountID,
+			&prompt.Name,
+			&prompt.Version,
+			&prompt.Description,
+			&messagesJSON,
+			&variablesJSON,
+			&tagsJSON,
+			&prompt.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan prompt: %w", err)
+		}
+
+		if err := json.Unmarshal(messagesJSON, &prompt.Messages); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prompt messages: %w", err)
+		}
+		if err := json.Unmarshal(variablesJSON, &prompt.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prompt variables: %w", err)
+		}
+		if err := json.Unmarshal(tagsJSON, &prompt.Tags); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prompt tags: %w", err)
+		}
+
+		prompts = append(prompts, prompt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating prompt rows: %w", err)
+	}
+
+	return prompts, nil
+}
+
+// DeletePrompt removes all versions of a prompt
+func (s *PostgreSQLPromptStore) DeletePrompt(accountID, name string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM prompts WHERE account_id = $1 AND name = $2",
+		accountID, name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete prompt: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return runtime.ErrPromptNotFound
+	}
+
+	return nil
+}
+
+// PostgreSQLLLMCacheStore implements the LLMCacheStore interface using PostgreSQL
+type PostgreSQLLLMCacheStore struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLLLMCacheStore creates a new PostgreSQL LLM cache store
+func NewPostgreSQLLLMCacheStore(db *sql.DB) *PostgreSQLLLMCacheStore {
+	return &PostgreSQLLLMCacheStore{
+		db: db,
+	}
+}
+
+// Initialize creates the PostgreSQL tables if they don't exist
+func (s *PostgreSQLLLMCacheStore) Initialize() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS llm_cache (
+			account_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			response JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP,
+			PRIMARY KEY (account_id, key)
+		);
+	`)
+
+	if err != nil {
+		return fmt.Errorf("failed to create llm_cache table: %w", err)
+	}
+
+	return nil
+}
+
+// GetLLMResponse retrieves the cached response for a request key
+func (s *PostgreSQLLLMCacheStore) GetLLMResponse(accountID, key string) (runtime.LLMCacheEntry, error) {
+	var entry runtime.LLMCacheEntry
+	var responseJSON []byte
+	var expiresAt sql.NullTime
+
+	err := s.db.QueryRow(
+		"SELECT account_id, key, provider, model, response, created_at, expires_at FROM llm_cache WHERE account_id = $1 AND key = $2",
+		accountID, key,
+	).Scan(
+		&entry.AccountID,
+		&entry.Key,
+		&entry.Provider,
+		&entry.Model,
+		&responseJSON,
+		&entry.CreatedAt,
+		&expiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return runtime.LLMCacheEntry{}, runtime.ErrLLMCacheMiss
+	}
+	if err != nil {
+		return runtime.LLMCacheEntry{}, fmt.Errorf("failed to get cached LLM response: %w", err)
+	}
+
+	if err := json.Unmarshal(responseJSON, &entry.Response); err != nil {
+		return runtime.LLMCacheEntry{}, fmt.Errorf("failed to unmarshal cached LLM response: %w", err)
+	}
+	if expiresAt.Valid {
+		entry.ExpiresAt = expiresAt.Time
+	}
+
+	return entry, nil
+}
+
+// SaveLLMResponse persists a cached response
+func (s *PostgreSQLLLMCacheStore) SaveLLMResponse(entry runtime.LLMCacheEntry) error {
+	responseJSON, err := json.Marshal(entry.Response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal LLM response: %w", err)
+	}
+
+	var expiresAt sql.NullTime
+	if !entry.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: entry.ExpiresAt, Valid: true}
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO llm_cache (account_id, key, provider, model, response, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (account_id, key)
+		DO UPDATE SET provider = $3, model = $4, response = $5, created_at = $6, expires_at = $7`,
+		entry.AccountID, entry.Key, entry.Provider, entry.Model, responseJSON, entry.CreatedAt, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save cached LLM response: %w", err)
+	}
+
+	// Expired entries of the account are dropped as new ones come in
+	if _, err := s.db.Exec(
+		"DELETE FROM llm_cache WHERE account_id = $1 AND expires_at < NOW()",
+		entry.AccountID,
+	); err != nil {
+		return fmt.Errorf("failed to expire cached LLM responses: %w", err)
+	}
+
+	return nil
+}
+
+// PostgreSQLMailboxStateStore implements the MailboxStateStore interface using PostgreSQL
+type PostgreSQLMailboxStateStore struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLMailboxStateStore creates a new PostgreSQL mailbox state store
+func NewPostgreSQLMailboxStateStore(db *sql.DB) *PostgreSQLMailboxStateStore {
+	return &PostgreSQLMailboxStateStore{
+		db: db,
+	}
+}
+
+// Initialize creates the PostgreSQL tables if they don't exist
+func (s *PostgreSQLMailboxStateStore) Initialize() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS mailbox_state (
+			watcher_id TEXT NOT NULL,
+			folder TEXT NOT NULL,
+			uid_validity BIGINT NOT NULL,
+			last_uid BIGINT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (watcher_id, folder)
+		);
+	`)
+
+	if err != nil {
+		return fmt.Errorf("failed to create mailbox_state table: %w", err)
+	}
+
+	return nil
+}
+
+// GetMailboxState retrieves the state of a watcher's folder
+func (s *PostgreSQLMailboxStateStore) GetMailboxState(watcherID, folder string) (MailboxState, error) {
+	var state MailboxState
+	var uidValidity, lastUID int64
+
+	err := s.db.QueryRow(
+		"SELECT watcher_id, folder, uid_validity, last_uid, updated_at FROM mailbox_state WHERE watcher_id = $1 AND folder = $2",
+		watcherID, folder,
+	).Scan(&state.WatcherID, &state.Folder, &uidValidity, &lastUID, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return MailboxState{}, ErrMailboxStateNotFound
+	}
+	if err != nil {
+		return MailboxState{}, fmt.Errorf("failed to get mailbox state: %w", err)
+	}
+
+	state.UIDValidity = uint32(uidValidity)
+	state.LastUID = uint32(lastUID)
+	return state, nil
+}
+
+// SaveMailboxState persists the state of a watcher's folder
+func (s *PostgreSQLMailboxStateStore) SaveMailboxState(state MailboxState) error {
+	_, err := s.db.Exec(`
+		INSERT INTO mailbox_state (watcher_id, folder, uid_validity, last_uid, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (watcher_id, folder)
+		DO UPDATE SET uid_validity = $3, last_uid = $4, updated_at = $5`,
+		state.WatcherID, state.Folder, int64(state.UIDValidity), int64(state.LastUID), state.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save mailbox state: %w", err)
+	}
+
+	return nil
+}
+
+// PostgreSQLCheckpointStore implements the CheckpointStore interface using PostgreSQL
+type PostgreSQLCheckpointStore struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLCheckpointStore creates a new PostgreSQL checkpoint store
+func NewPostgreSQLCheckpointStore(db *sql.DB) *PostgreSQLCheckpointStore {
+	return &PostgreSQLCheckpointStore{
+		db: db,
+	}
+}
+
+// Initialize creates the PostgreSQL tables if they don't exist
+func (s *PostgreSQLCheckpointStore) Initialize() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS checkpoints (
+			execution_id TEXT NOT NULL,
+			node_id TEXT NOT NULL,
+			data BYTEA NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (execution_id, node_id)
+		);
+	`)
+
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoints table: %w", err)
+	}
+
+	return nil
+}
+
+// SaveCheckpoint persists the checkpoint of a node
+func (s *PostgreSQLCheckpointStore) SaveCheckpoint(checkpoint runtime.Checkpoint) error {
+	_, err := s.db.Exec(`
+		INSERT INTO checkpoints (execution_id, node_id, data, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (execution_id, node_id)
+		DO UPDATE SET data = $3, created_at = $4`,
+		checkpoint.ExecutionID, checkpoint.NodeID, checkpoint.Data, checkpoint.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// GetCheckpoint retrieves the checkpoint of a node
+func (s *PostgreSQLCheckpointStore) GetCheckpoint(executionID, nodeID string) (runtime.Checkpoint, error) {
+	var checkpoint runtime.Checkpoint
+
+	err := s.db.QueryRow(
+		"SELECT execution_id, node_id, data, created_at FROM checkpoints WHERE execution_id = $1 AND node_id = $2",
+		executionID, nodeID,
+	).Scan(&checkpoint.ExecutionID, &checkpoint.NodeID, &checkpoint.Data, &checkpoint.CreatedAt)
+	if err == sql.ErrNoRows {
+		return runtime.Checkpoint{}, runtime.ErrCheckpointNotFound
+	}
+	if err != nil {
+		return runtime.Checkpoint{}, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
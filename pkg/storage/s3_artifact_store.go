@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/tcmartin/flowrunner/pkg/runtime"
+)
+
+// S3ArtifactStoreConfig contains configuration for the S3 artifact store
+type S3ArtifactStoreConfig struct {
+	Bucket    string
+	Prefix    string // Optional, prepended to all keys
+	Region    string
+	AccessKey string
+	SecretKey string
+	Endpoint  string // Optional, for S3-compatible stores
+
+	// PathStyle addresses the bucket in the URL path rather than the host
+	// name, as most S3-compatible stores expect
+	PathStyle bool
+}
+
+// S3ArtifactStore implements runtime.ArtifactStore on S3 or an
+// S3-compatible store, with the layout of FileArtifactStore except that
+// blobs are not grouped by digest prefix
+type S3ArtifactStore struct {
+	client s3iface.S3API
+	bucket string
+	prefix string
+}
+
+// NewS3ArtifactStore creates an artifact store in a bucket
+func NewS3ArtifactStore(config S3ArtifactStoreConfig) (*S3ArtifactStore, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("artifact bucket is required")
+	}
+
+	// Create AWS session
+	awsConfig := &aws.Config{
+		Region:           aws.String(config.Region),
+		S3ForcePathStyle: aws.Bool(config.PathStyle),
+	}
+
+	// Set credentials if provided
+	if config.AccessKey != "" && config.SecretKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(
+			config.AccessKey,
+			config.SecretKey,
+			"",
+		)
+	}
+
+	// Set endpoint for S3-compatible stores if provided
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	return &S3ArtifactStore{
+		client: s3.New(sess),
+		bucket: config.Bucket,
+		prefix: config.Prefix,
+	}, nil
+}
+
+func (s *S3ArtifactStore) key(parts ...string) string {
+	return s.prefix + path.Join(parts...)
+}
+
+// isS3NotFound reports whether an S3 error is for a missing object
+func isS3NotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return false
+}
+
+// PutBlob stores the content, uploading it only when no identical content
+// is stored
+func (s *S3ArtifactStore) PutBlob(content io.Reader) (string, int64, error) {
+	file, digest, size, err := spoolBlob("", content)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	key := s.key("blobs", "sha256", strings.TrimPrefix(digest, artifactDigestPrefix))
+	_, err = s.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err == nil {
+		return digest, size, nil
+	}
+	if !isS3NotFound(err) {
+		return "", 0, fmt.Errorf("failed to check blob: %w", err)
+	}
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   file,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to upload blob: %w", err)
+	}
+	return digest, size, nil
+}
+
+// OpenBlob opens the content of a blob
+func (s *S3ArtifactStore) OpenBlob(digest string) (io.ReadCloser, error) {
+	sum, err := parseArtifactDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key("blobs", "sha256", sum)),
+	})
+	if isS3NotFound(err) {
+		return nil, runtime.ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	return output.Body, nil
+}
+
+// SaveArtifact records an artifact of an execution
+func (s *S3ArtifactStore) SaveArtifact(artifact runtime.Artifact) error {
+	if err := checkArtifactIDs(artifact.ExecutionID, artifact.ID); err != nil {
+		return err
+	}
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		return fmt.Errorf("failed to marshal artifact: %w", err)
+	}
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key("executions", artifact.ExecutionID, artifact.ID+".json")),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save artifact: %w", err)
+	}
+	return nil
+}
+
+// GetArtifact returns an artifact of an execution
+func (s *S3ArtifactStore) GetArtifact(executionID, id string) (runtime.Artifact, error) {
+	if err := checkArtifactIDs(executionID, id); err != nil {
+		return runtime.Artifact{}, runtime.ErrArtifactNotFound
+	}
+	return s.getArtifact(s.key("executions", executionID, id+".json"))
+}
+
+func (s *S3ArtifactStore) getArtifact(key string) (runtime.Artifact, error) {
+	output, err := s.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if isS3NotFound(err) {
+		return runtime.Artifact{}, runtime.ErrArtifactNotFound
+	}
+	if err != nil {
+		return runtime.Artifact{}, fmt.Errorf("failed to get artifact: %w", err)
+	}
+	defer output.Body.Close()
+
+	var artifact runtime.Artifact
+	if err := json.NewDecoder(output.Body).Decode(&artifact); err != nil {
+		return runtime.Artifact{}, fmt.Errorf("failed to unmarshal artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// ListArtifacts returns the artifacts of an execution in order of creation
+func (s *S3ArtifactStore) ListArtifacts(executionID string) ([]runtime.Artifact, error) {
+	if err := checkArtifactIDs(executionID); err != nil {
+		return []runtime.Artifact{}, nil
+	}
+
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.key("executions", executionID) + "/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if strings.HasSuffix(aws.StringValue(object.Key), ".json") {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	artifacts := make([]runtime.Artifact, 0, len(keys))
+	for _, key := range keys {
+		artifact, err := s.getArtifact(key)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	sortArtifacts(artifacts)
+	return artifacts, nil
+}
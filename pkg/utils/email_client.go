@@ -2,15 +2,12 @@ package utils
 
 import (
 	"bytes"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/mail"
 	"net/smtp"
-	"net/textproto"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -35,6 +32,7 @@ type EmailClient struct {
 	imapClient   *client.Client
 	connected    bool
 	lastActivity time.Time
+	dkim         *DKIMOptions
 }
 
 // EmailMessage represents an email message
@@ -50,6 +48,8 @@ type EmailMessage struct {
 	Headers     map[string]string `json:"headers,omitempty"`
 	Date        time.Time         `json:"date,omitempty"`
 	MessageID   string            `json:"message_id,omitempty"`
+	InReplyTo   string            `json:"in_reply_to,omitempty"`
+	References  []string          `json:"references,omitempty"`
 	Metadata    map[string]any    `json:"metadata,omitempty"`
 }
 
@@ -58,6 +58,7 @@ type EmailAttachment struct {
 	Filename    string `json:"filename"`
 	ContentType string `json:"content_type"`
 	Content     []byte `json:"content"`
+	ContentID   string `json:"content_id,omitempty"` // Inline parts only, referenced as cid:<ContentID>
 }
 
 // EmailFilter represents a filter for retrieving emails
@@ -145,96 +146,40 @@ func (c *EmailClient) ensureConnected() error {
 	return nil
 }
 
-// SendEmail sends an email
-func (c *EmailClient) SendEmail(message EmailMessage) error {
-	if err := c.ensureConnected(); err != nil {
-		return err
-	}
+// SetDKIM signs the emails sent afterwards with DKIM; nil disables signing
+func (c *EmailClient) SetDKIM(options *DKIMOptions) {
+	c.dkim = options
+}
 
+// SendEmail sends an email. Sending only uses SMTP, so it does not need
+// Connect.
+func (c *EmailClient) SendEmail(message EmailMessage) error {
 	// Create the message
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	// Add headers
-	fmt.Fprintf(&buf, "From: %s\r\n", message.From)
-	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(message.To, ", "))
-	if len(message.Cc) > 0 {
-		fmt.Fprintf(&buf, "Cc: %s\r\n", strings.Join(message.Cc, ", "))
-	}
-	fmt.Fprintf(&buf, "Subject: %s\r\n", message.Subject)
-	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
-	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n", writer.Boundary())
-	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
-
-	// Add custom headers
-	for key, value := range message.Headers {
-		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
-	}
-	fmt.Fprintf(&buf, "\r\n")
-
-	// Add text body
-	if message.Body != "" {
-		textPart, err := writer.CreatePart(textproto.MIMEHeader{
-			"Content-Type":              {"text/plain; charset=UTF-8"},
-			"Content-Transfer-Encoding": {"quoted-printable"},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create text part: %w", err)
-		}
-		fmt.Fprintf(textPart, "%s", message.Body)
-	}
-
-	// Add HTML body
-	if message.HTML != "" {
-		htmlPart, err := writer.CreatePart(textproto.MIMEHeader{
-			"Content-Type":              {"text/html; charset=UTF-8"},
-			"Content-Transfer-Encoding": {"quoted-printable"},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create HTML part: %w", err)
-		}
-		fmt.Fprintf(htmlPart, "%s", message.HTML)
+	raw, err := ComposeEmail(message)
+	if err != nil {
+		return err
 	}
-
-	// Add attachments
-	for _, attachment := range message.Attachments {
-		contentType := attachment.ContentType
-		if contentType == "" {
-			contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
-			if contentType == "" {
-				contentType = "application/octet-stream"
-			}
-		}
-
-		attachmentPart, err := writer.CreatePart(textproto.MIMEHeader{
-			"Content-Type":              {fmt.Sprintf("%s; name=%q", contentType, attachment.Filename)},
-			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.Filename)},
-			"Content-Transfer-Encoding": {"base64"},
-		})
+	if c.dkim != nil {
+		raw, err = SignDKIM(raw, *c.dkim)
 		if err != nil {
-			return fmt.Errorf("failed to create attachment part: %w", err)
+			return err
 		}
-
-		encoder := base64.NewEncoder(base64.StdEncoding, attachmentPart)
-		encoder.Write(attachment.Content)
-		encoder.Close()
 	}
 
-	// Close the writer
-	writer.Close()
-
 	// Create auth
 	auth := smtp.PlainAuth("", c.username, c.password, c.smtpHost)
 
-	// Create recipient list
+	// Create recipient list; the envelope takes bare addresses
 	recipients := make([]string, 0, len(message.To)+len(message.Cc)+len(message.Bcc))
-	recipients = append(recipients, message.To...)
-	recipients = append(recipients, message.Cc...)
-	recipients = append(recipients, message.Bcc...)
+	for _, list := range [][]string{message.To, message.Cc, message.Bcc} {
+		for _, recipient := range list {
+			recipients = append(recipients, envelopeAddress(recipient))
+		}
+	}
 
 	// Send the email using smtp.SendMail
 	smtpAddr := fmt.Sprintf("%s:%d", c.smtpHost, c.smtpPort)
-	err := smtp.SendMail(smtpAddr, auth, message.From, recipients, buf.Bytes())
+	err = smtp.SendMail(smtpAddr, auth, envelopeAddress(message.From), recipients, raw)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
@@ -437,6 +382,14 @@ func (c *EmailClient) GetEmails(filter EmailFilter) ([]EmailMessage, error) {
 	return emails, nil
 }
 
+// envelopeAddress returns the bare address of "Name <address>"
+func envelopeAddress(address string) string {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		return addr.Address
+	}
+	return address
+}
+
 // formatAddress formats an IMAP address
 func formatAddress(addr *imap.Address) string {
 	if addr.PersonalName != "" {
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"mime"
+	netmail "net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// DKIMOptions configures the DKIM signature of outgoing mail
+type DKIMOptions struct {
+	// Domain is the signing domain (d=)
+	Domain string
+
+	// Selector is the DNS selector of the public key (s=)
+	Selector string
+
+	// Signer is the private key, RSA or Ed25519
+	Signer crypto.Signer
+}
+
+// ParseDKIMPrivateKey parses a PEM encoded RSA (PKCS #1 or #8) or Ed25519
+// (PKCS #8) private key
+func ParseDKIMPrivateKey(pemData string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, fmt.Errorf("DKIM private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DKIM private key: %w", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DKIM private key: %w", err)
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported DKIM private key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DKIM private key block %q", block.Type)
+	}
+}
+
+// SignDKIM returns the message with a DKIM-Signature header added
+func SignDKIM(raw []byte, options DKIMOptions) ([]byte, error) {
+	var signed bytes.Buffer
+	err := dkim.Sign(&signed, bytes.NewReader(raw), &dkim.SignOptions{
+		Domain:   options.Domain,
+		Selector: options.Selector,
+		Signer:   options.Signer,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return signed.Bytes(), nil
+}
+
+// GenerateMessageID returns a new Message-ID, with brackets, in the domain
+// of the sender
+func GenerateMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	random := make([]byte, 16)
+	rand.Read(random)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(random), time.Now().UnixNano(), domain)
+}
+
+// mimeEntity is a part of a message being composed, either a leaf with a
+// body or a multipart with children
+type mimeEntity struct {
+	header   message.Header
+	body     []byte
+	children []mimeEntity
+}
+
+// write writes the body or the children of the entity and closes w
+func (e mimeEntity) write(w *message.Writer) error {
+	for _, child := range e.children {
+		part, err := w.CreatePart(child.header)
+		if err != nil {
+			return err
+		}
+		if err := child.write(part); err != nil {
+			return err
+		}
+	}
+	if len(e.children) == 0 {
+		if _, err := w.Write(e.body); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// multipartEntity returns a multipart entity of the children
+func multipartEntity(mediaType string, children ...mimeEntity) mimeEntity {
+	var h message.Header
+	h.SetContentType(mediaType, nil)
+	return mimeEntity{header: h, children: children}
+}
+
+// textEntity returns a quoted-printable UTF-8 text part
+func textEntity(mediaType, text string) mimeEntity {
+	var h message.Header
+	h.SetContentType(mediaType, map[string]string{"charset": "utf-8"})
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return mimeEntity{header: h, body: []byte(text)}
+}
+
+// attachmentEntity returns a base64 part of an attachment, inline when it
+// has a content ID
+func attachmentEntity(attachment EmailAttachment) mimeEntity {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+
+	var h message.Header
+	var dispositionParams map[string]string
+	if attachment.Filename != "" {
+		h.SetContentType(contentType, map[string]string{"name": attachment.Filename})
+		dispositionParams = map[string]string{"filename": attachment.Filename}
+	} else {
+		h.SetContentType(contentType, nil)
+	}
+	if attachment.ContentID != "" {
+		h.Set("Content-Id", "<"+strings.Trim(attachment.ContentID, "<>")+">")
+		h.SetContentDisposition("inline", dispositionParams)
+	} else {
+		h.SetContentDisposition("attachment", dispositionParams)
+	}
+	h.Set("Content-Transfer-Encoding", "base64")
+	return mimeEntity{header: h, body: attachment.Content}
+}
+
+// ComposeEmail renders a message in RFC 5322 format. Attachments with a
+// ContentID are inline parts that the HTML body references as
+// cid:<ContentID>. A Message-ID and date are generated when the message
+// has none.
+func ComposeEmail(msg EmailMessage) ([]byte, error) {
+	// The body is text and HTML alternatives, related to the inline parts,
+	// mixed with the attachments
+	var body mimeEntity
+	switch {
+	case msg.Body != "" && msg.HTML != "":
+		body = multipartEntity("multipart/alternative", textEntity("text/plain", msg.Body), textEntity("text/html", msg.HTML))
+	case msg.HTML != "":
+		body = textEntity("text/html", msg.HTML)
+	default:
+		body = textEntity("text/plain", msg.Body)
+	}
+
+	var inline, attached []mimeEntity
+	for _, attachment := range msg.Attachments {
+		if attachment.ContentID != "" {
+			inline = append(inline, attachmentEntity(attachment))
+		} else {
+			attached = append(attached, attachmentEntity(attachment))
+		}
+	}
+	if len(inline) > 0 {
+		body = multipartEntity("multipart/related", append([]mimeEntity{body}, inline...)...)
+	}
+	if len(attached) > 0 {
+		body = multipartEntity("multipart/mixed", append([]mimeEntity{body}, attached...)...)
+	}
+
+	var h mail.Header
+	date := msg.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	h.SetDate(date)
+	setAddressHeader(&h, "From", []string{msg.From})
+	setAddressHeader(&h, "To", msg.To)
+	setAddressHeader(&h, "Cc", msg.Cc)
+	h.SetSubject(msg.Subject)
+
+	messageID := msg.MessageID
+	if messageID == "" {
+		messageID = GenerateMessageID(msg.From)
+	}
+	h.Set("Message-Id", messageID)
+	if msg.InReplyTo != "" {
+		h.Set("In-Reply-To", msg.InReplyTo)
+	}
+	if len(msg.References) > 0 {
+		h.Set("References", strings.Join(msg.References, " "))
+	}
+	for key, value := range msg.Headers {
+		h.Set(key, value)
+	}
+
+	fields := body.header.Fields()
+	for fields.Next() {
+		h.Set(fields.Key(), fields.Value())
+	}
+	body.header = h.Header
+
+	var buf bytes.Buffer
+	w, err := message.CreateWriter(&buf, body.header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose message: %w", err)
+	}
+	if err := body.write(w); err != nil {
+		return nil, fmt.Errorf("failed to compose message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setAddressHeader sets an address header, encoding the display names;
+// addresses that do not parse are written as given
+func setAddressHeader(h *mail.Header, key string, addresses []string) {
+	if len(addresses) == 0 || (len(addresses) == 1 && addresses[0] == "") {
+		return
+	}
+
+	parsed := make([]*mail.Address, 0, len(addresses))
+	for _, address := range addresses {
+		addr, err := netmail.ParseAddress(address)
+		if err != nil {
+			h.Set(key, strings.Join(addresses, ", "))
+			return
+		}
+		parsed = append(parsed, addr)
+	}
+	h.SetAddressList(key, parsed)
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+)
+
+// DialIMAP connects and logs in to an IMAP server. Security is "tls"
+// (default), "starttls" or "none".
+func DialIMAP(host string, port int, security, username, password string) (*client.Client, error) {
+	addr := fmt.Sprintf("%s:%d", host, port)
+
+	var c *client.Client
+	var err error
+	switch security {
+	case "", "tls":
+		c, err = client.DialTLS(addr, nil)
+	case "starttls", "none":
+		c, err = client.Dial(addr)
+	default:
+		return nil, fmt.Errorf("unsupported IMAP security %q", security)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+
+	if security == "starttls" {
+		if err := c.StartTLS(nil); err != nil {
+			c.Logout()
+			return nil, fmt.Errorf("IMAP STARTTLS failed: %w", err)
+		}
+	}
+
+	if err := c.Login(username, password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("IMAP authentication failed: %w", err)
+	}
+
+	return c, nil
+}
+
+// SearchUIDsAfter returns the UIDs above uid in the selected mailbox, in
+// ascending order
+func SearchUIDsAfter(c *client.Client, uid uint32) ([]uint32, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(uid+1, 0)
+
+	found, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	// "N:*" always matches the last message, even when its UID is below N
+	uids := make([]uint32, 0, len(found))
+	for _, candidate := range found {
+		if candidate > uid {
+			uids = append(uids, candidate)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// FetchEmailByUID fetches and parses a message of the selected mailbox,
+// including its attachments, without marking it as seen
+func FetchEmailByUID(c *client.Client, uid uint32) (EmailMessage, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchInternalDate, imap.FetchRFC822Size, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, items, messages)
+	}()
+
+	var fetched *imap.Message
+	for msg := range messages {
+		if msg.Uid == uid {
+			fetched = msg
+		}
+	}
+	if err := <-done; err != nil {
+		return EmailMessage{}, fmt.Errorf("fetch failed: %w", err)
+	}
+	if fetched == nil {
+		return EmailMessage{}, fmt.Errorf("message %d not found", uid)
+	}
+
+	body := fetched.GetBody(section)
+	if body == nil {
+		return EmailMessage{}, fmt.Errorf("message %d has no body", uid)
+	}
+	email, err := ParseEmailMessage(body)
+	if err != nil {
+		return EmailMessage{}, fmt.Errorf("message %d: %w", uid, err)
+	}
+
+	email.Metadata = map[string]any{
+		"uid":      fetched.Uid,
+		"flags":    fetched.Flags,
+		"date":     fetched.InternalDate,
+		"size":     fetched.Size,
+		"answered": hasFlag(fetched.Flags, imap.AnsweredFlag),
+		"flagged":  hasFlag(fetched.Flags, imap.FlaggedFlag),
+		"seen":     hasFlag(fetched.Flags, imap.SeenFlag),
+	}
+	return email, nil
+}
+
+// ParseEmailMessage parses an RFC 5322 message into an EmailMessage. Text
+// parts are decoded to UTF-8; other parts, inline or not, are returned as
+// attachments, inline ones with their content ID.
+func ParseEmailMessage(r io.Reader) (EmailMessage, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil && !message.IsUnknownCharset(err) {
+		return EmailMessage{}, fmt.Errorf("failed to parse message: %w", err)
+	}
+	defer mr.Close()
+
+	email := EmailMessage{
+		Headers:   make(map[string]string),
+		MessageID: mr.Header.Get("Message-Id"),
+		InReplyTo: strings.TrimSpace(mr.Header.Get("In-Reply-To")),
+	}
+	if references := strings.Fields(mr.Header.Get("References")); len(references) > 0 {
+		email.References = references
+	}
+	email.Subject, _ = mr.Header.Subject()
+	email.Date, _ = mr.Header.Date()
+	if from, err := mr.Header.AddressList("From"); err == nil && len(from) > 0 {
+		email.From = formatMailAddress(from[0])
+	}
+	email.To = formatMailAddresses(mr.Header, "To")
+	email.Cc = formatMailAddresses(mr.Header, "Cc")
+
+	fields := mr.Header.Fields()
+	for fields.Next() {
+		value, err := fields.Text()
+		if err != nil {
+			value = fields.Value()
+		}
+		if existing, ok := email.Headers[fields.Key()]; ok {
+			value = existing + ", " + value
+		}
+		email.Headers[fields.Key()] = value
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !message.IsUnknownCharset(err) {
+			return EmailMessage{}, fmt.Errorf("failed to read message part: %w", err)
+		}
+
+		var content bytes.Buffer
+		if _, err := content.ReadFrom(part.Body); err != nil {
+			return EmailMessage{}, fmt.Errorf("failed to read message part: %w", err)
+		}
+
+		switch header := part.Header.(type) {
+		case *mail.InlineHeader:
+			contentType, params, _ := header.ContentType()
+			switch {
+			case contentType == "text/plain" && email.Body == "":
+				email.Body = content.String()
+				continue
+			case contentType == "text/html" && email.HTML == "":
+				email.HTML = content.String()
+				continue
+			}
+			_, dispositionParams, _ := header.ContentDisposition()
+			filename := dispositionParams["filename"]
+			if filename == "" {
+				filename = params["name"]
+			}
+			email.Attachments = append(email.Attachments, EmailAttachment{
+				Filename:    filename,
+				ContentType: contentType,
+				Content:     content.Bytes(),
+				ContentID:   strings.Trim(header.Get("Content-Id"), "<> "),
+			})
+		case *mail.AttachmentHeader:
+			contentType, _, _ := header.ContentType()
+			filename, _ := header.Filename()
+			email.Attachments = append(email.Attachments, EmailAttachment{
+				Filename:    filename,
+				ContentType: contentType,
+				Content:     content.Bytes(),
+			})
+		}
+	}
+
+	return email, nil
+}
+
+// formatMailAddresses formats the addresses of a header field, falling
+// back to its raw value when it does not parse
+func formatMailAddresses(header mail.Header, key string) []string {
+	addresses, err := header.AddressList(key)
+	if err != nil {
+		if raw := strings.TrimSpace(header.Get(key)); raw != "" {
+			return []string{raw}
+		}
+		return nil
+	}
+
+	formatted := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		formatted = append(formatted, formatMailAddress(addr))
+	}
+	return formatted
+}
+
+// formatMailAddress formats an address like formatAddress does for IMAP
+// envelopes
+func formatMailAddress(addr *mail.Address) string {
+	if addr.Name != "" {
+		return fmt.Sprintf("%s <%s>", addr.Name, addr.Address)
+	}
+	return addr.Address
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -24,6 +25,15 @@ type HTTPRequest struct {
 	Timeout        time.Duration          `json:"timeout,omitempty"`
 	Auth           map[string]interface{} `json:"auth,omitempty"`
 	FollowRedirect bool                   `json:"follow_redirect,omitempty"`
+
+	// BodyWriter receives the body of successful (2xx) responses instead
+	// of it being read into memory
+	BodyWriter io.Writer `json:"-"`
+
+	// RedirectOrigin, when set, is the only scheme and host redirects are
+	// followed to, such as the origin a credential of the request is
+	// meant for; redirects elsewhere fail the request
+	RedirectOrigin string `json:"-"`
 }
 
 // HTTPResponse represents an HTTP response
@@ -122,6 +132,18 @@ func (c *HTTPClient) Do(req *HTTPRequest) (*HTTPResponse, error) {
 			return http.ErrUseLastResponse
 		}
 		defer func() { c.client.CheckRedirect = originalCheckRedirect }()
+	} else if req.RedirectOrigin != "" {
+		redirectOrigin := req.RedirectOrigin
+		c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if origin := strings.ToLower(req.URL.Scheme + "://" + req.URL.Host); origin != redirectOrigin {
+				return fmt.Errorf("redirect to %s leaves %s", origin, redirectOrigin)
+			}
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return nil
+		}
+		defer func() { c.client.CheckRedirect = originalCheckRedirect }()
 	}
 
 	// Record start time for timing information
@@ -137,6 +159,30 @@ func (c *HTTPClient) Do(req *HTTPRequest) (*HTTPResponse, error) {
 	// Calculate request duration
 	requestDuration := time.Since(startTime)
 
+	contentType := resp.Header.Get("Content-Type")
+
+	// Successful responses are streamed to the body writer when one is set
+	if req.BodyWriter != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		written, err := io.Copy(req.BodyWriter, resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write response body: %w", err)
+		}
+		requestDuration = time.Since(startTime)
+		return &HTTPResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header,
+			Metadata: map[string]interface{}{
+				"content_type":   contentType,
+				"content_length": resp.ContentLength,
+				"bytes_written":  written,
+				"request_url":    req.URL,
+				"request_method": req.Method,
+				"timing":         requestDuration,
+				"timing_ms":      requestDuration.Milliseconds(),
+			},
+		}, nil
+	}
+
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -145,7 +191,6 @@ func (c *HTTPClient) Do(req *HTTPRequest) (*HTTPResponse, error) {
 
 	// Parse response body based on content type
 	var parsedBody interface{}
-	contentType := resp.Header.Get("Content-Type")
 	if contentType != "" && (contentType == "application/json" || contentType == "application/json; charset=utf-8") {
 		if err := json.Unmarshal(body, &parsedBody); err != nil {
 			// If JSON parsing fails, use the raw body
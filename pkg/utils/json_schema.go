@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ValidateJSONSchema validates a decoded JSON value against a JSON Schema and
+// returns a description of each violation, prefixed with the JSON path of the
+// offending value. It supports the keywords commonly used to describe
+// structured output: type, enum, const, properties, required,
+// additionalProperties, items, min/max items, lengths and bounds, pattern,
+// allOf, anyOf, oneOf and not. Unknown keywords are ignored.
+func ValidateJSONSchema(schema map[string]interface{}, value interface{}) []string {
+	var errs []string
+	validateSchema(schema, value, "$", &errs)
+	return errs
+}
+
+func validateSchema(schema map[string]interface{}, value interface{}, path string, errs *[]string) {
+	if schema == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if jsonTypeMatches(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(value))
+			// Further keywords would only repeat the type mismatch
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", compactJSON(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		fail("must be %s", compactJSON(constant))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		validateObject(schema, v, path, errs)
+	case []interface{}:
+		if limit, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < limit {
+			fail("must have at least %g items", limit)
+		}
+		if limit, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > limit {
+			fail("must have at most %g items", limit)
+		}
+		if items := schemaObject(schema["items"]); items != nil {
+			for i, item := range v {
+				validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if limit, ok := schemaNumber(schema["minLength"]); ok && length < limit {
+			fail("must be at least %g characters long", limit)
+		}
+		if limit, ok := schemaNumber(schema["maxLength"]); ok && length > limit {
+			fail("must be at most %g characters long", limit)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("must match pattern %q", pattern)
+			}
+		}
+	case float64:
+		if limit, ok := schemaNumber(schema["minimum"]); ok && v < limit {
+			fail("must be >= %g", limit)
+		}
+		if limit, ok := schemaNumber(schema["maximum"]); ok && v > limit {
+			fail("must be <= %g", limit)
+		}
+		if limit, ok := schemaNumber(schema["exclusiveMinimum"]); ok && v <= limit {
+			fail("must be > %g", limit)
+		}
+		if limit, ok := schemaNumber(schema["exclusiveMaximum"]); ok && v >= limit {
+			fail("must be < %g", limit)
+		}
+	}
+
+	for _, sub := range schemaList(schema["allOf"]) {
+		validateSchema(sub, value, path, errs)
+	}
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 && countMatches(anyOf, value, path) == 0 {
+		fail("must match at least one of the anyOf schemas")
+	}
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 && countMatches(oneOf, value, path) != 1 {
+		fail("must match exactly one of the oneOf schemas")
+	}
+	if not := schemaObject(schema["not"]); not != nil && countMatches([]map[string]interface{}{not}, value, path) == 1 {
+		fail("must not match the not schema")
+	}
+}
+
+func validateObject(schema map[string]interface{}, object map[string]interface{}, path string, errs *[]string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := object[key]; !present {
+					*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, key))
+				}
+			}
+		}
+	}
+
+	properties := schemaObject(schema["properties"])
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertyPath := path + "." + key
+		if property := schemaObject(properties[key]); property != nil {
+			validateSchema(property, object[key], propertyPath, errs)
+			continue
+		}
+		if _, declared := properties[key]; declared {
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, fmt.Sprintf("%s: property %q is not allowed", path, key))
+			}
+		default:
+			if additionalSchema := schemaObject(additional); additionalSchema != nil {
+				validateSchema(additionalSchema, object[key], propertyPath, errs)
+			}
+		}
+	}
+}
+
+// countMatches returns the number of schemas the value is valid against
+func countMatches(schemas []map[string]interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, schema := range schemas {
+		var errs []string
+		validateSchema(schema, value, path, &errs)
+		if len(errs) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func jsonTypeMatches(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeName(value) == schemaType
+	}
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// jsonEqual compares values by their JSON encoding, so that numbers written
+// as integers in a YAML schema equal the float64 of decoded JSON
+func jsonEqual(a, b interface{}) bool {
+	var left, right interface{}
+	if json.Unmarshal([]byte(compactJSON(a)), &left) != nil || json.Unmarshal([]byte(compactJSON(b)), &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(schemaValue(value))
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func schemaTypes(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var types []string
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// schemaObject returns a schema given as a map, converting maps decoded from
+// YAML
+func schemaObject(value interface{}) map[string]interface{} {
+	if m, ok := schemaValue(value).(map[string]interface{}); ok {
+		return m
+	}
+	return nil
+}
+
+func schemaList(value interface{}) []map[string]interface{} {
+	list, _ := value.([]interface{})
+	var schemas []map[string]interface{}
+	for _, item := range list {
+		if schema := schemaObject(item); schema != nil {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+// schemaValue converts the map[interface{}]interface{} values of YAML into
+// map[string]interface{}
+func schemaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprintf("%v", key)] = schemaValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = schemaValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = schemaValue(item)
+		}
+		return list
+	}
+	return value
+}
+
+// NormalizeJSONSchema returns a schema with the maps decoded from YAML
+// converted, ready to be sent to providers as JSON
+func NormalizeJSONSchema(schema interface{}) map[string]interface{} {
+	return schemaObject(schema)
+}
@@ -15,11 +15,11 @@ func ParseJSON(jsonStr string, result any) error {
 	if strings.HasPrefix(jsonStr, "```json") {
 		// Extract the JSON content from the code block
 		endIndex := strings.LastIndex(jsonStr, "```")
-		if endIndex > 6 { // 6 is the length of "```json"
-			jsonStr = strings.TrimSpace(jsonStr[6:endIndex])
+		if endIndex > 7 { // 7 is the length of "```json"
+			jsonStr = strings.TrimSpace(jsonStr[7:endIndex])
 		} else {
 			// If no closing code block, just remove the opening one
-			jsonStr = strings.TrimSpace(jsonStr[6:])
+			jsonStr = strings.TrimSpace(jsonStr[7:])
 		}
 	} else if strings.HasPrefix(jsonStr, "```") {
 		// Generic code block without language specification
@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 )
 
-// LLMProvider represents the type of LLM provider
+// LLMProvider names a registered LLM provider
 type LLMProvider string
 
 const (
@@ -22,11 +23,33 @@ const (
 
 // LLMClient provides a unified interface for interacting with different LLM providers
 type LLMClient struct {
-	httpClient *HTTPClient
-	provider   LLMProvider
-	apiKey     string
-	baseURL    string
-	options    map[string]interface{}
+	provider     LLMProvider
+	backend      LLMBackend
+	defaultModel string
+	err          error
+}
+
+// llmEndpoint holds the connection settings shared by HTTP based providers
+type llmEndpoint struct {
+	httpClient   *HTTPClient
+	streamClient *http.Client
+	apiKey       string
+	baseURL      string
+	options      map[string]interface{}
+}
+
+// clientOptions are options that configure the client rather than the
+// request, and are therefore not sent to the provider
+var clientOptions = map[string]bool{
+	"base_url":          true,
+	"endpoint":          true,
+	"default_model":     true,
+	"api_version":       true,
+	"deployment":        true,
+	"region":            true,
+	"access_key_id":     true,
+	"secret_access_key": true,
+	"session_token":     true,
 }
 
 // ToolCall represents a tool call from the LLM
@@ -115,86 +138,112 @@ type ErrorInfo struct {
 	Code    string `json:"code"`
 }
 
-// NewLLMClient creates a new LLM client
+// NewLLMClient creates a new LLM client for a registered provider. The
+// base_url and default_model options override the provider defaults; other
+// options are provider specific.
 func NewLLMClient(provider LLMProvider, apiKey string, options map[string]interface{}) *LLMClient {
-	client := &LLMClient{
-		httpClient: NewHTTPClient(),
-		provider:   provider,
-		apiKey:     apiKey,
-		options:    options,
-	}
-
-	// Set base URL based on provider
-	switch provider {
-	case OpenAI:
-		client.baseURL = "https://api.openai.com/v1"
-	case Anthropic:
-		client.baseURL = "https://api.anthropic.com/v1"
-	case Generic:
-		if baseURL, ok := options["base_url"].(string); ok {
-			client.baseURL = baseURL
-		}
+	config := LLMProviderConfig{APIKey: apiKey, Options: options}
+	if baseURL, ok := options["base_url"].(string); ok {
+		config.BaseURL = baseURL
+	}
+	if defaultModel, ok := options["default_model"].(string); ok {
+		config.DefaultModel = defaultModel
 	}
 
+	client, err := NewLLMClientWithConfig(provider, config)
+	if err != nil {
+		// Reported by the first request
+		return &LLMClient{provider: provider, err: err}
+	}
 	return client
 }
 
-// Complete sends a completion request to the LLM
-func (c *LLMClient) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
-	switch c.provider {
-	case OpenAI:
-		return c.completeOpenAI(ctx, request)
-	case Anthropic:
-		// For Claude 3 models, use the messages API
-		if strings.Contains(request.Model, "claude-3") {
-			return c.completeAnthropicMessages(ctx, request)
-		}
-		// For older Claude models, use the legacy API
-		return c.completeAnthropic(ctx, request)
-	case Generic:
-		return c.completeGeneric(ctx, request)
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", c.provider)
+// NewLLMClientWithConfig creates a new LLM client for a registered provider
+func NewLLMClientWithConfig(provider LLMProvider, config LLMProviderConfig) (*LLMClient, error) {
+	factory, ok := lookupLLMProvider(provider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
-}
+	if config.Options == nil {
+		config.Options = map[string]interface{}{}
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
 
-// completeOpenAI sends a completion request to OpenAI
-func (c *LLMClient) completeOpenAI(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
-	// Create request body
-	requestBody := map[string]interface{}{
-		"model":       request.Model,
-		"messages":    request.Messages,
-		"temperature": request.Temperature,
+	backend, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure provider %s: %w", provider, err)
 	}
+	return &LLMClient{provider: provider, backend: backend, defaultModel: config.DefaultModel}, nil
+}
 
-	if request.MaxTokens > 0 {
-		requestBody["max_tokens"] = request.MaxTokens
+// Provider returns the provider of the client
+func (c *LLMClient) Provider() LLMProvider {
+	return c.provider
+}
+
+// DefaultModel returns the model used by requests that do not name one
+func (c *LLMClient) DefaultModel() string {
+	return c.defaultModel
+}
+
+// Capabilities returns the capabilities of the client's provider
+func (c *LLMClient) Capabilities() LLMCapabilities {
+	if c.backend == nil {
+		return LLMCapabilities{}
 	}
+	return c.backend.Capabilities()
+}
 
-	if len(request.Stop) > 0 {
-		requestBody["stop"] = request.Stop
+// Complete sends a completion request to the LLM
+func (c *LLMClient) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if request.Model == "" {
+		request.Model = c.defaultModel
 	}
 
+	// Streamed responses are collected so callers get a complete response
 	if request.Stream {
-		requestBody["stream"] = request.Stream
+		chunks, err := c.Stream(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		return CollectStream(chunks, nil)
 	}
+	return c.backend.Complete(ctx, request)
+}
 
-	if len(request.Functions) > 0 {
-		requestBody["functions"] = request.Functions
+// Stream sends a completion request with streaming enabled and returns the
+// incremental tokens through a channel. The channel is closed when the
+// response ends, fails or ctx is canceled. Providers that cannot stream
+// deliver the complete response as a single chunk.
+func (c *LLMClient) Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error) {
+	if c.err != nil {
+		return nil, c.err
 	}
-
-	if len(request.Tools) > 0 {
-		requestBody["tools"] = request.Tools
+	if request.Model == "" {
+		request.Model = c.defaultModel
 	}
+	request.Stream = false
 
-	if request.ToolChoice != nil {
-		requestBody["tool_choice"] = request.ToolChoice
+	if c.backend.Capabilities().Streaming {
+		return c.backend.Stream(ctx, request)
 	}
 
-	// Add any additional options
-	for key, value := range request.Options {
-		requestBody[key] = value
+	resp, err := c.backend.Complete(ctx, request)
+	if err != nil {
+		return nil, err
 	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("LLM API error: %s", resp.Error.Message)
+	}
+	return responseAsStream(resp), nil
+}
+
+// completeChat sends a chat completions request to an OpenAI compatible API
+func (c *llmEndpoint) completeChat(ctx context.Context, url string, headers map[string]string, request LLMRequest) (*LLMResponse, error) {
+	requestBody := openAIRequestBody(request)
 
 	// Debug: Log what we're sending to OpenAI for tools
 	if len(request.Tools) > 0 {
@@ -206,15 +255,15 @@ func (c *LLMClient) completeOpenAI(ctx context.Context, request LLMRequest) (*LL
 
 	// Create HTTP request
 	httpRequest := &HTTPRequest{
-		URL:    fmt.Sprintf("%s/chat/completions", c.baseURL),
-		Method: "POST",
-		Body:   requestBody,
-		Headers: map[string]string{
-			"Authorization": fmt.Sprintf("Bearer %s", c.apiKey),
-			"Content-Type":  "application/json",
-		},
+		URL:     url,
+		Method:  "POST",
+		Body:    requestBody,
+		Headers: map[string]string{"Content-Type": "application/json"},
 		Timeout: 60 * time.Second,
 	}
+	for key, value := range headers {
+		httpRequest.Headers[key] = value
+	}
 
 	// Execute request
 	resp, err := c.httpClient.Do(httpRequest)
@@ -224,24 +273,7 @@ func (c *LLMClient) completeOpenAI(ctx context.Context, request LLMRequest) (*LL
 
 	// Check for errors
 	if resp.StatusCode >= 400 {
-		var errorResp struct {
-			Error struct {
-				Message string `json:"message"`
-				Type    string `json:"type"`
-				Code    string `json:"code"`
-			} `json:"error"`
-		}
-		if err := json.Unmarshal(resp.RawBody, &errorResp); err != nil {
-			return nil, fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(resp.RawBody))
-		}
-		fmt.Printf("[DEBUG] OpenAI API Error: %s (Type: %s, Code: %s)\n", errorResp.Error.Message, errorResp.Error.Type, errorResp.Error.Code)
-		return &LLMResponse{
-			Error: &ErrorInfo{
-				Message: errorResp.Error.Message,
-				Type:    errorResp.Error.Type,
-				Code:    errorResp.Error.Code,
-			},
-		}, nil
+		return nil, newLLMAPIError("OpenAI", resp.StatusCode, resp.Headers, resp.RawBody)
 	}
 
 	// Parse response
@@ -258,19 +290,87 @@ func (c *LLMClient) completeOpenAI(ctx context.Context, request LLMRequest) (*LL
 	return &openAIResp, nil
 }
 
-// completeAnthropicMessages sends a completion request to Anthropic using the messages API (Claude 3)
-func (c *LLMClient) completeAnthropicMessages(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+// openAIRequestBody builds the body of a chat completions request
+func openAIRequestBody(request LLMRequest) map[string]interface{} {
+	requestBody := map[string]interface{}{
+		"model":       request.Model,
+		"messages":    request.Messages,
+		"temperature": request.Temperature,
+	}
+
+	if request.MaxTokens > 0 {
+		requestBody["max_tokens"] = request.MaxTokens
+	}
+
+	if len(request.Stop) > 0 {
+		requestBody["stop"] = request.Stop
+	}
+
+	if len(request.Functions) > 0 {
+		requestBody["functions"] = request.Functions
+	}
+
+	if len(request.Tools) > 0 {
+		requestBody["tools"] = request.Tools
+	}
+
+	if request.ToolChoice != nil {
+		requestBody["tool_choice"] = request.ToolChoice
+	}
+
+	// Add any additional options
+	addRequestOptions(requestBody, request.Options)
+
+	return requestBody
+}
+
+// anthropicMessagesRequestBody builds the body of a messages API request
+func anthropicMessagesRequestBody(request LLMRequest) map[string]interface{} {
 	// Extract system message if present
 	var systemPrompt string
-	var userAssistantMessages []Message
+	var userAssistantMessages []map[string]interface{}
 
 	for _, msg := range request.Messages {
-		if msg.Role == "system" {
+		switch {
+		case msg.Role == "system":
 			systemPrompt = msg.Content
-		} else {
-			userAssistantMessages = append(userAssistantMessages, msg)
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			// Tool calls are content blocks of the assistant turn
+			var blocks []map[string]interface{}
+			if msg.Content != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := map[string]interface{}{}
+				json.Unmarshal([]byte(call.Function.Arguments), &input)
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": input,
+				})
+			}
+			userAssistantMessages = append(userAssistantMessages, map[string]interface{}{"role": "assistant", "content": blocks})
+		case msg.Role == "tool":
+			// Tool results are content blocks of a user turn, shared by
+			// the results of parallel calls
+			block := map[string]interface{}{"type": "tool_result", "tool_use_id": msg.ToolCallID, "content": msg.Content}
+			if last := len(userAssistantMessages) - 1; last >= 0 && userAssistantMessages[last]["tool_results"] == true {
+				userAssistantMessages[last]["content"] = append(userAssistantMessages[last]["content"].([]map[string]interface{}), block)
+			} else {
+				userAssistantMessages = append(userAssistantMessages, map[string]interface{}{
+					"role":         "user",
+					"content":      []map[string]interface{}{block},
+					"tool_results": true,
+				})
+			}
+		default:
+			userAssistantMessages = append(userAssistantMessages, map[string]interface{}{"role": msg.Role, "content": msg.Content})
 		}
 	}
+	for _, msg := range userAssistantMessages {
+		delete(msg, "tool_results")
+	}
 
 	// Create request body for Claude 3 messages API
 	requestBody := map[string]interface{}{
@@ -292,10 +392,49 @@ func (c *LLMClient) completeAnthropicMessages(ctx context.Context, request LLMRe
 		requestBody["stop_sequences"] = request.Stop
 	}
 
+	var tools []map[string]interface{}
+	for _, tool := range request.Tools {
+		tools = append(tools, anthropicTool(tool.Function))
+	}
+	for _, function := range request.Functions {
+		tools = append(tools, anthropicTool(function))
+	}
+	if len(tools) > 0 {
+		requestBody["tools"] = tools
+	}
+
 	// Add any additional options
-	for key, value := range request.Options {
-		requestBody[key] = value
+	addRequestOptions(requestBody, request.Options)
+
+	return requestBody
+}
+
+// anthropicTool converts a function definition to an Anthropic tool
+func anthropicTool(function FunctionDefinition) map[string]interface{} {
+	schema := function.Parameters
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object"}
+	}
+	return map[string]interface{}{
+		"name":         function.Name,
+		"description":  function.Description,
+		"input_schema": schema,
 	}
+}
+
+// addRequestOptions copies request options other than client options into
+// the request body
+func addRequestOptions(requestBody map[string]interface{}, options map[string]interface{}) {
+	for key, value := range options {
+		if !clientOptions[key] {
+			requestBody[key] = value
+		}
+	}
+}
+
+// completeAnthropicMessages sends a completion request to Anthropic using the messages API (Claude 3)
+func (c *llmEndpoint) completeAnthropicMessages(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	requestBody := anthropicMessagesRequestBody(request)
 
 	// Create HTTP request
 	httpRequest := &HTTPRequest{
@@ -318,7 +457,7 @@ func (c *LLMClient) completeAnthropicMessages(ctx context.Context, request LLMRe
 
 	// Check for errors
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("Anthropic API error (status %d): %s", resp.StatusCode, string(resp.RawBody))
+		return nil, newLLMAPIError("Anthropic", resp.StatusCode, resp.Headers, resp.RawBody)
 	}
 
 	// Parse response
@@ -340,14 +479,22 @@ func (c *LLMClient) completeAnthropicMessages(ctx context.Context, request LLMRe
 		return nil, fmt.Errorf("failed to parse Anthropic response: %w", err)
 	}
 
-	// Extract text content from the response
+	// Extract text content and tool calls from the response
 	var content string
+	var toolCalls []ToolCall
 	for _, block := range anthropicResp.Content {
-		if blockType, ok := block["type"].(string); ok && blockType == "text" {
-			if textContent, ok := block["text"].(string); ok {
+		switch block["type"] {
+		case "text":
+			if textContent, ok := block["text"].(string); ok && content == "" {
 				content = textContent
-				break
 			}
+		case "tool_use":
+			call := ToolCall{Type: "function"}
+			call.ID, _ = block["id"].(string)
+			call.Function.Name, _ = block["name"].(string)
+			arguments, _ := json.Marshal(block["input"])
+			call.Function.Arguments = string(arguments)
+			toolCalls = append(toolCalls, call)
 		}
 	}
 
@@ -359,8 +506,9 @@ func (c *LLMClient) completeAnthropicMessages(ctx context.Context, request LLMRe
 			{
 				Index: 0,
 				Message: Message{
-					Role:    "assistant",
-					Content: content,
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
 				},
 				FinishReason: anthropicResp.StopReason,
 			},
@@ -381,7 +529,7 @@ func (c *LLMClient) completeAnthropicMessages(ctx context.Context, request LLMRe
 }
 
 // completeAnthropic sends a completion request to Anthropic using the legacy API
-func (c *LLMClient) completeAnthropic(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+func (c *llmEndpoint) completeAnthropic(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
 	// Convert messages to Anthropic format
 	var systemPrompt string
 	var userMessages []string
@@ -431,9 +579,7 @@ func (c *LLMClient) completeAnthropic(ctx context.Context, request LLMRequest) (
 	}
 
 	// Add any additional options
-	for key, value := range request.Options {
-		requestBody[key] = value
-	}
+	addRequestOptions(requestBody, request.Options)
 
 	// Create HTTP request
 	httpRequest := &HTTPRequest{
@@ -456,7 +602,7 @@ func (c *LLMClient) completeAnthropic(ctx context.Context, request LLMRequest) (
 
 	// Check for errors
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("Anthropic API error (status %d): %s", resp.StatusCode, string(resp.RawBody))
+		return nil, newLLMAPIError("Anthropic", resp.StatusCode, resp.Headers, resp.RawBody)
 	}
 
 	// Parse response
@@ -493,7 +639,7 @@ func (c *LLMClient) completeAnthropic(ctx context.Context, request LLMRequest) (
 }
 
 // completeGeneric sends a completion request to a generic API
-func (c *LLMClient) completeGeneric(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+func (c *llmEndpoint) completeGeneric(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
 	// Get endpoint from options
 	endpoint, ok := c.options["endpoint"].(string)
 	if !ok {
@@ -520,7 +666,7 @@ func (c *LLMClient) completeGeneric(ctx context.Context, request LLMRequest) (*L
 
 	// Check for errors
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("LLM API error (status %d): %s", resp.StatusCode, string(resp.RawBody))
+		return nil, newLLMAPIError("LLM", resp.StatusCode, resp.Headers, resp.RawBody)
 	}
 
 	// Parse response
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EmbeddingRequest asks a model for the embeddings of texts
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+
+	// Dimensions shortens the embeddings of models that support it
+	Dimensions int `json:"dimensions,omitempty"`
+
+	// Options holds provider specific request options
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// EmbeddingResponse holds an embedding for each input, in request order
+type EmbeddingResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Usage      Usage       `json:"usage"`
+}
+
+// LLMEmbedder is implemented by backends whose provider serves embeddings
+type LLMEmbedder interface {
+	// Embed returns the embeddings of the request's inputs
+	Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// Embed returns the embeddings of the request's inputs
+func (c *LLMClient) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	embedder, ok := c.backend.(LLMEmbedder)
+	if !ok || !c.backend.Capabilities().Embeddings {
+		return nil, fmt.Errorf("provider %s does not support embeddings", c.provider)
+	}
+	if request.Model == "" {
+		request.Model = c.defaultModel
+	}
+	if len(request.Input) == 0 {
+		return &EmbeddingResponse{Model: request.Model, Embeddings: [][]float64{}}, nil
+	}
+
+	resp, err := embedder.Embed(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(request.Input) {
+		return nil, fmt.Errorf("provider %s returned %d embeddings for %d inputs", c.provider, len(resp.Embeddings), len(request.Input))
+	}
+	return resp, nil
+}
+
+// embedOpenAI sends an embeddings request to an OpenAI compatible API
+func (c *llmEndpoint) embedOpenAI(ctx context.Context, url string, headers map[string]string, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	requestBody := map[string]interface{}{
+		"model": request.Model,
+		"input": request.Input,
+	}
+	if request.Dimensions > 0 {
+		requestBody["dimensions"] = request.Dimensions
+	}
+	addRequestOptions(requestBody, request.Options)
+
+	httpRequest := &HTTPRequest{
+		URL:     url,
+		Method:  "POST",
+		Body:    requestBody,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Timeout: 60 * time.Second,
+	}
+	for key, value := range headers {
+		httpRequest.Headers[key] = value
+	}
+
+	resp, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newLLMAPIError("OpenAI", resp.StatusCode, resp.Headers, resp.RawBody)
+	}
+
+	var embeddingResp struct {
+		Model string `json:"model"`
+		Data  []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(resp.RawBody, &embeddingResp); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAI response: %w", err)
+	}
+
+	result := &EmbeddingResponse{
+		Model:      embeddingResp.Model,
+		Embeddings: make([][]float64, len(embeddingResp.Data)),
+		Usage:      embeddingResp.Usage,
+	}
+	if result.Model == "" {
+		result.Model = request.Model
+	}
+	for i, data := range embeddingResp.Data {
+		// Embeddings are returned in input order unless indexed otherwise
+		index := i
+		if data.Index >= 0 && data.Index < len(result.Embeddings) {
+			index = data.Index
+		}
+		result.Embeddings[index] = data.Embedding
+	}
+	return result, nil
+}
+
+func (b *chatBackend) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	return b.embedOpenAI(ctx, b.embeddingsURL(request), b.headers, request)
+}
+
+func (b *genericBackend) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	endpoint := "/v1/embeddings"
+	if path, ok := b.options["embeddings_endpoint"].(string); ok {
+		endpoint = path
+	}
+	return b.embedOpenAI(ctx, b.baseURL+endpoint, bearerAuth(b.apiKey), request)
+}
+
+func (b *geminiBackend) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	model := "models/" + strings.TrimPrefix(request.Model, "models/")
+	requests := make([]map[string]interface{}, len(request.Input))
+	for i, input := range request.Input {
+		requests[i] = map[string]interface{}{
+			"model":   model,
+			"content": map[string]interface{}{"parts": []map[string]interface{}{{"text": input}}},
+		}
+		if request.Dimensions > 0 {
+			requests[i]["outputDimensionality"] = request.Dimensions
+		}
+		for key, value := range request.Options {
+			if !clientOptions[key] {
+				requests[i][key] = value
+			}
+		}
+	}
+
+	httpRequest := &HTTPRequest{
+		URL:     b.url(strings.TrimPrefix(model, "models/"), "batchEmbedContents"),
+		Method:  "POST",
+		Body:    map[string]interface{}{"requests": requests},
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Timeout: 60 * time.Second,
+	}
+	for key, value := range b.headers() {
+		httpRequest.Headers[key] = value
+	}
+
+	resp, err := b.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Gemini API request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newLLMAPIError("Gemini", resp.StatusCode, resp.Headers, resp.RawBody)
+	}
+
+	var embeddingResp struct {
+		Embeddings []struct {
+			Values []float64 `json:"values"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(resp.RawBody, &embeddingResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Gemini response: %w", err)
+	}
+
+	result := &EmbeddingResponse{Model: request.Model}
+	for _, embedding := range embeddingResp.Embeddings {
+		result.Embeddings = append(result.Embeddings, embedding.Values)
+	}
+	return result, nil
+}
+
+// Embed invokes a Titan or Cohere embedding model. Titan models embed a
+// single text per request.
+func (b *bedrockBackend) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	path := fmt.Sprintf("/model/%s/invoke", url.PathEscape(request.Model))
+	result := &EmbeddingResponse{Model: request.Model}
+
+	if strings.HasPrefix(request.Model, "cohere.") {
+		body := map[string]interface{}{"texts": request.Input, "input_type": "search_document"}
+		addRequestOptions(body, request.Options)
+		raw, err := b.invoke(ctx, path, body)
+		if err != nil {
+			return nil, err
+		}
+		var cohereResp struct {
+			Embeddings [][]float64 `json:"embeddings"`
+		}
+		if err := json.Unmarshal(raw, &cohereResp); err != nil {
+			return nil, fmt.Errorf("failed to parse Bedrock response: %w", err)
+		}
+		result.Embeddings = cohereResp.Embeddings
+		return result, nil
+	}
+
+	for _, input := range request.Input {
+		body := map[string]interface{}{"inputText": input}
+		if request.Dimensions > 0 {
+			body["dimensions"] = request.Dimensions
+		}
+		addRequestOptions(body, request.Options)
+		raw, err := b.invoke(ctx, path, body)
+		if err != nil {
+			return nil, err
+		}
+		var titanResp struct {
+			Embedding           []float64 `json:"embedding"`
+			InputTextTokenCount int       `json:"inputTextTokenCount"`
+		}
+		if err := json.Unmarshal(raw, &titanResp); err != nil {
+			return nil, fmt.Errorf("failed to parse Bedrock response: %w", err)
+		}
+		result.Embeddings = append(result.Embeddings, titanResp.Embedding)
+		result.Usage.PromptTokens += titanResp.InputTextTokenCount
+		result.Usage.TotalTokens += titanResp.InputTextTokenCount
+	}
+	return result, nil
+}
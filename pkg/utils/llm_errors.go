@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LLMAPIError is an error response from an LLM provider
+type LLMAPIError struct {
+	// Provider names the API that answered, e.g. "OpenAI"
+	Provider string
+
+	// StatusCode is the HTTP status, or 0 for errors reported inside a stream
+	StatusCode int
+
+	// Message, Type and Code are taken from the error body when it has one
+	Message string
+	Type    string
+	Code    string
+
+	// RetryAfter is the delay the provider asked for before the next request
+	RetryAfter time.Duration
+}
+
+func (e *LLMAPIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s API error: %s", e.Provider, e.Message)
+	}
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the same request may succeed when retried:
+// rate limits, timeouts, overload and server errors
+func (e *LLMAPIError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	case 0:
+		switch e.Type {
+		case "overloaded_error", "rate_limit_error", "api_error", "server_error", "timeout_error":
+			return true
+		}
+		return false
+	}
+	return e.StatusCode >= 500
+}
+
+// IsTemporaryLLMError reports whether a failed LLM request may succeed when
+// retried. Besides provider errors, connection failures and timeouts are
+// temporary; cancellation of the caller's context is not.
+func IsTemporaryLLMError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *LLMAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// newLLMAPIError builds the error for a failed response, reading the message
+// from the usual error body shapes and the delay from Retry-After headers
+func newLLMAPIError(provider string, statusCode int, header http.Header, body []byte) *LLMAPIError {
+	apiErr := &LLMAPIError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Message:    string(body),
+		RetryAfter: parseRetryAfter(header, time.Now()),
+	}
+
+	var errorBody struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(body, &errorBody) != nil {
+		return apiErr
+	}
+	var details struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Status  string          `json:"status"`
+		Code    json.RawMessage `json:"code"`
+	}
+	if len(errorBody.Error) > 0 && json.Unmarshal(errorBody.Error, &details) == nil && details.Message != "" {
+		apiErr.Message = details.Message
+		apiErr.Type = details.Type
+		if apiErr.Type == "" {
+			apiErr.Type = details.Status
+		}
+		var code string
+		if json.Unmarshal(details.Code, &code) != nil {
+			code = string(details.Code)
+		}
+		apiErr.Code = code
+	} else if errorBody.Message != "" {
+		apiErr.Message = errorBody.Message
+	}
+	return apiErr
+}
+
+// parseRetryAfter reads the delay from a retry-after-ms header or from a
+// Retry-After header holding seconds or an HTTP date
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// LLMCapabilities describes the features a provider supports
+type LLMCapabilities struct {
+	// Tools is set when the provider accepts tool definitions and returns tool calls
+	Tools bool `json:"tools"`
+
+	// JSONMode is set when the provider can be asked for JSON output
+	JSONMode bool `json:"json_mode"`
+
+	// Vision is set when the provider's models accept images
+	Vision bool `json:"vision"`
+
+	// Streaming is set when responses can be streamed token by token
+	Streaming bool `json:"streaming"`
+
+	// Embeddings is set when the provider serves embedding models
+	Embeddings bool `json:"embeddings"`
+}
+
+// LLMProviderConfig configures a provider for one client
+type LLMProviderConfig struct {
+	// APIKey authenticates requests; providers with other schemes may ignore it
+	APIKey string `json:"api_key,omitempty"`
+
+	// BaseURL overrides the provider's default endpoint
+	BaseURL string `json:"base_url,omitempty"`
+
+	// DefaultModel is used by requests that do not name a model
+	DefaultModel string `json:"default_model,omitempty"`
+
+	// Options holds provider specific settings, e.g. api_version for Azure
+	// or region for Bedrock
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// option returns a provider specific string option, or fallback when unset
+func (c LLMProviderConfig) option(key, fallback string) string {
+	if value, ok := c.Options[key].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// LLMBackend sends requests to an LLM provider
+type LLMBackend interface {
+	// Capabilities returns the features the provider supports
+	Capabilities() LLMCapabilities
+
+	// Complete sends a completion request
+	Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error)
+
+	// Stream sends a completion request and returns the incremental tokens.
+	// It is only called when Capabilities reports streaming support.
+	Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error)
+}
+
+// LLMProviderFactory creates a backend for the given configuration
+type LLMProviderFactory func(config LLMProviderConfig) (LLMBackend, error)
+
+var (
+	llmProvidersMu sync.RWMutex
+	llmProviders   = make(map[LLMProvider]LLMProviderFactory)
+)
+
+// RegisterLLMProvider registers a provider under the given name, replacing
+// any provider registered under the same name
+func RegisterLLMProvider(name LLMProvider, factory LLMProviderFactory) {
+	llmProvidersMu.Lock()
+	defer llmProvidersMu.Unlock()
+	llmProviders[name] = factory
+}
+
+// LLMProviders returns the names of the registered providers
+func LLMProviders() []LLMProvider {
+	llmProvidersMu.RLock()
+	defer llmProvidersMu.RUnlock()
+
+	names := make([]LLMProvider, 0, len(llmProviders))
+	for name := range llmProviders {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// IsLLMProviderRegistered reports whether a provider is registered under name
+func IsLLMProviderRegistered(name LLMProvider) bool {
+	_, ok := lookupLLMProvider(name)
+	return ok
+}
+
+func lookupLLMProvider(name LLMProvider) (LLMProviderFactory, bool) {
+	llmProvidersMu.RLock()
+	defer llmProvidersMu.RUnlock()
+	factory, ok := llmProviders[name]
+	return factory, ok
+}
+
+// requireBaseURL returns the configured base URL or an error naming the provider
+func requireBaseURL(provider LLMProvider, config LLMProviderConfig) (string, error) {
+	if config.BaseURL == "" {
+		return "", fmt.Errorf("%s provider requires a base_url", provider)
+	}
+	return config.BaseURL, nil
+}
+
+// requireAPIKey returns an error naming the provider when no API key is set
+func requireAPIKey(provider LLMProvider, config LLMProviderConfig) error {
+	if config.APIKey == "" {
+		return fmt.Errorf("%s provider requires an api_key", provider)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// bedrockBackend talks to the Bedrock Converse API with SigV4 signed requests
+type bedrockBackend struct {
+	client  *http.Client
+	baseURL string
+	region  string
+	signer  *v4.Signer
+	options map[string]interface{}
+}
+
+// newBedrockBackend creates a Bedrock backend. Credentials are taken from the
+// access_key_id, secret_access_key and session_token options, or from the
+// default AWS credential chain when the options are unset.
+func newBedrockBackend(config LLMProviderConfig) (LLMBackend, error) {
+	region := config.option("region", os.Getenv("AWS_REGION"))
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var creds *credentials.Credentials
+	if accessKey := config.option("access_key_id", ""); accessKey != "" {
+		creds = credentials.NewStaticCredentials(accessKey, config.option("secret_access_key", ""), config.option("session_token", ""))
+	} else {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS credentials: %w", err)
+		}
+		creds = sess.Config.Credentials
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", region)
+	}
+
+	return &bedrockBackend{
+		client:  &http.Client{},
+		baseURL: baseURL,
+		region:  region,
+		signer:  v4.NewSigner(creds),
+		options: config.Options,
+	}, nil
+}
+
+func (b *bedrockBackend) Capabilities() LLMCapabilities {
+	// ConverseStream uses the AWS event stream encoding rather than SSE
+	return LLMCapabilities{Tools: true, Vision: true, Embeddings: true}
+}
+
+func (b *bedrockBackend) Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error) {
+	return nil, fmt.Errorf("bedrock provider does not support streaming")
+}
+
+// invoke posts a signed request to a Bedrock runtime path and returns the
+// response body
+func (b *bedrockBackend) invoke(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if _, err := b.signer.Sign(httpReq, bytes.NewReader(payload), "bedrock", b.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign Bedrock request: %w", err)
+	}
+
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("Bedrock API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Bedrock response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newLLMAPIError("Bedrock", resp.StatusCode, resp.Header, raw)
+	}
+	return raw, nil
+}
+
+func (b *bedrockBackend) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	raw, err := b.invoke(ctx, fmt.Sprintf("/model/%s/converse", url.PathEscape(request.Model)), bedrockRequestBody(request))
+	if err != nil {
+		return nil, err
+	}
+
+	var converseResp struct {
+		Output struct {
+			Message struct {
+				Content []bedrockContent `json:"content"`
+			} `json:"message"`
+		} `json:"output"`
+		StopReason string `json:"stopReason"`
+		Usage      struct {
+			InputTokens  int `json:"inputTokens"`
+			OutputTokens int `json:"outputTokens"`
+			TotalTokens  int `json:"totalTokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(raw, &converseResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Bedrock response: %w", err)
+	}
+
+	message := Message{Role: "assistant"}
+	for _, block := range converseResp.Output.Message.Content {
+		message.Content += block.Text
+		if block.ToolUse != nil {
+			arguments, _ := json.Marshal(block.ToolUse.Input)
+			call := ToolCall{ID: block.ToolUse.ToolUseID, Type: "function"}
+			call.Function.Name = block.ToolUse.Name
+			call.Function.Arguments = string(arguments)
+			message.ToolCalls = append(message.ToolCalls, call)
+		}
+	}
+
+	finishReason := converseResp.StopReason
+	switch finishReason {
+	case "end_turn", "stop_sequence":
+		finishReason = "stop"
+	case "tool_use":
+		finishReason = "tool_calls"
+	case "max_tokens":
+		finishReason = "length"
+	}
+
+	llmResp := &LLMResponse{
+		Model:   request.Model,
+		Choices: []Choice{{Index: 0, Message: message, FinishReason: finishReason}},
+		Usage: Usage{
+			PromptTokens:     converseResp.Usage.InputTokens,
+			CompletionTokens: converseResp.Usage.OutputTokens,
+			TotalTokens:      converseResp.Usage.TotalTokens,
+		},
+	}
+	var rawMap map[string]interface{}
+	if json.Unmarshal(raw, &rawMap) == nil {
+		llmResp.RawResponse = rawMap
+	}
+	return llmResp, nil
+}
+
+// bedrockContent is a content block of a Converse message
+type bedrockContent struct {
+	Text       string             `json:"text,omitempty"`
+	ToolUse    *bedrockToolUse    `json:"toolUse,omitempty"`
+	ToolResult *bedrockToolResult `json:"toolResult,omitempty"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string                 `json:"toolUseId"`
+	Name      string                 `json:"name"`
+	Input     map[string]interface{} `json:"input"`
+}
+
+type bedrockToolResult struct {
+	ToolUseID string                   `json:"toolUseId"`
+	Content   []map[string]interface{} `json:"content"`
+}
+
+type bedrockMessage struct {
+	Role    string           `json:"role"`
+	Content []bedrockContent `json:"content"`
+}
+
+// bedrockRequestBody translates a chat request to a Converse request
+func bedrockRequestBody(request LLMRequest) map[string]interface{} {
+	var system []bedrockContent
+	var messages []bedrockMessage
+
+	for _, msg := range request.Messages {
+		switch msg.Role {
+		case "system":
+			system = append(system, bedrockContent{Text: msg.Content})
+		case "assistant":
+			message := bedrockMessage{Role: "assistant"}
+			if msg.Content != "" {
+				message.Content = append(message.Content, bedrockContent{Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := map[string]interface{}{}
+				json.Unmarshal([]byte(call.Function.Arguments), &input)
+				message.Content = append(message.Content, bedrockContent{ToolUse: &bedrockToolUse{
+					ToolUseID: call.ID,
+					Name:      call.Function.Name,
+					Input:     input,
+				}})
+			}
+			messages = append(messages, message)
+		case "tool":
+			result := map[string]interface{}{"text": msg.Content}
+			var value map[string]interface{}
+			if json.Unmarshal([]byte(msg.Content), &value) == nil {
+				result = map[string]interface{}{"json": value}
+			}
+			block := bedrockContent{ToolResult: &bedrockToolResult{ToolUseID: msg.ToolCallID, Content: []map[string]interface{}{result}}}
+			// Results of parallel tool calls share one user turn
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "user" && messages[last].Content[0].ToolResult != nil {
+				messages[last].Content = append(messages[last].Content, block)
+			} else {
+				messages = append(messages, bedrockMessage{Role: "user", Content: []bedrockContent{block}})
+			}
+		default:
+			messages = append(messages, bedrockMessage{Role: "user", Content: []bedrockContent{{Text: msg.Content}}})
+		}
+	}
+
+	inferenceConfig := map[string]interface{}{"temperature": request.Temperature}
+	if request.MaxTokens > 0 {
+		inferenceConfig["maxTokens"] = request.MaxTokens
+	}
+	if len(request.Stop) > 0 {
+		inferenceConfig["stopSequences"] = request.Stop
+	}
+
+	body := map[string]interface{}{
+		"messages":        messages,
+		"inferenceConfig": inferenceConfig,
+	}
+	if len(system) > 0 {
+		body["system"] = system
+	}
+
+	var tools []interface{}
+	for _, tool := range request.Tools {
+		tools = append(tools, bedrockToolSpec(tool.Function))
+	}
+	for _, function := range request.Functions {
+		tools = append(tools, bedrockToolSpec(function))
+	}
+	if len(tools) > 0 {
+		body["toolConfig"] = map[string]interface{}{"tools": tools}
+	}
+
+	// Model specific fields, e.g. top_k for Anthropic models
+	additional := map[string]interface{}{}
+	for key, value := range request.Options {
+		if !clientOptions[key] {
+			additional[key] = value
+		}
+	}
+	if len(additional) > 0 {
+		body["additionalModelRequestFields"] = additional
+	}
+	return body
+}
+
+func bedrockToolSpec(function FunctionDefinition) map[string]interface{} {
+	schema := function.Parameters
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object"}
+	}
+	return map[string]interface{}{"toolSpec": map[string]interface{}{
+		"name":        function.Name,
+		"description": function.Description,
+		"inputSchema": map[string]interface{}{"json": schema},
+	}}
+}
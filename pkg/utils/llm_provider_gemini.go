@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// geminiBackend talks to the Gemini generateContent API
+type geminiBackend struct {
+	*llmEndpoint
+}
+
+// geminiPart is a piece of Gemini content
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiResponse is a generateContent response, or one chunk of a stream
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+	Error        *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func (b *geminiBackend) Capabilities() LLMCapabilities {
+	return LLMCapabilities{Tools: true, JSONMode: true, Vision: true, Streaming: true, Embeddings: true}
+}
+
+func (b *geminiBackend) url(model, method string) string {
+	return fmt.Sprintf("%s/models/%s:%s", b.baseURL, url.PathEscape(model), method)
+}
+
+func (b *geminiBackend) headers() map[string]string {
+	return map[string]string{"x-goog-api-key": b.apiKey}
+}
+
+func (b *geminiBackend) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	httpRequest := &HTTPRequest{
+		URL:     b.url(request.Model, "generateContent"),
+		Method:  "POST",
+		Body:    geminiRequestBody(request),
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Timeout: 60 * time.Second,
+	}
+	for key, value := range b.headers() {
+		httpRequest.Headers[key] = value
+	}
+
+	resp, err := b.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Gemini API request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newLLMAPIError("Gemini", resp.StatusCode, resp.Headers, resp.RawBody)
+	}
+
+	var geminiResp geminiResponse
+	if err := json.Unmarshal(resp.RawBody, &geminiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Gemini response: %w", err)
+	}
+
+	chunk := geminiChunk(geminiResp)
+	llmResp, err := CollectStream(responseChunks(chunk), nil)
+	if err != nil {
+		return nil, err
+	}
+	if llmResp.Model == "" {
+		llmResp.Model = request.Model
+	}
+	if rawMap, ok := resp.Body.(map[string]interface{}); ok {
+		llmResp.RawResponse = rawMap
+	}
+	return llmResp, nil
+}
+
+func (b *geminiBackend) Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error) {
+	calls := 0
+	return b.streamSSE(ctx, b.url(request.Model, "streamGenerateContent")+"?alt=sse", geminiRequestBody(request), b.headers(),
+		func(event, data string) ([]LLMStreamChunk, bool, error) {
+			var geminiResp geminiResponse
+			if err := json.Unmarshal([]byte(data), &geminiResp); err != nil {
+				return nil, false, fmt.Errorf("failed to parse stream chunk: %w", err)
+			}
+			chunk := geminiChunk(geminiResp)
+			if chunk.Err != nil {
+				return nil, false, chunk.Err
+			}
+			// Function calls arrive whole, so each one gets its own index
+			for i := range chunk.ToolCalls {
+				chunk.ToolCalls[i].Index = calls
+				if chunk.ToolCalls[i].ID == "" {
+					chunk.ToolCalls[i].ID = fmt.Sprintf("call_%d", calls)
+				}
+				calls++
+			}
+			// The stream has no end event; the chunk with the finish
+			// reason is the last one
+			return []LLMStreamChunk{chunk}, chunk.FinishReason != "", nil
+		})
+}
+
+// responseChunks returns a closed channel holding the given chunks
+func responseChunks(chunks ...LLMStreamChunk) <-chan LLMStreamChunk {
+	ch := make(chan LLMStreamChunk, len(chunks))
+	for _, chunk := range chunks {
+		ch <- chunk
+	}
+	close(ch)
+	return ch
+}
+
+// geminiChunk converts a generateContent response to a stream chunk
+func geminiChunk(resp geminiResponse) LLMStreamChunk {
+	if resp.Error != nil {
+		return LLMStreamChunk{Err: &LLMAPIError{Provider: "Gemini", StatusCode: resp.Error.Code, Message: resp.Error.Message, Type: resp.Error.Status}}
+	}
+
+	chunk := LLMStreamChunk{ID: resp.ResponseID, Model: resp.ModelVersion}
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			chunk.Delta += part.Text
+			if part.FunctionCall != nil {
+				arguments, _ := json.Marshal(part.FunctionCall.Args)
+				id := part.FunctionCall.ID
+				if id == "" {
+					id = fmt.Sprintf("call_%d", len(chunk.ToolCalls))
+				}
+				chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+					Index:     len(chunk.ToolCalls),
+					ID:        id,
+					Type:      "function",
+					Name:      part.FunctionCall.Name,
+					Arguments: string(arguments),
+				})
+			}
+		}
+		switch {
+		case candidate.FinishReason == "":
+		case len(chunk.ToolCalls) > 0:
+			chunk.FinishReason = "tool_calls"
+		case candidate.FinishReason == "STOP":
+			chunk.FinishReason = "stop"
+		case candidate.FinishReason == "MAX_TOKENS":
+			chunk.FinishReason = "length"
+		default:
+			chunk.FinishReason = strings.ToLower(candidate.FinishReason)
+		}
+	}
+	if resp.UsageMetadata != nil {
+		chunk.Usage = &Usage{
+			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
+		}
+	}
+	return chunk
+}
+
+// geminiRequestBody translates a chat request to a generateContent request
+func geminiRequestBody(request LLMRequest) map[string]interface{} {
+	var system []geminiPart
+	var contents []geminiContent
+	toolNames := make(map[string]string)
+
+	for _, msg := range request.Messages {
+		switch msg.Role {
+		case "system":
+			system = append(system, geminiPart{Text: msg.Content})
+		case "assistant":
+			content := geminiContent{Role: "model"}
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				var args map[string]interface{}
+				json.Unmarshal([]byte(call.Function.Arguments), &args)
+				content.Parts = append(content.Parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+			contents = append(contents, content)
+		case "tool":
+			// Function responses must be objects
+			var response map[string]interface{}
+			if json.Unmarshal([]byte(msg.Content), &response) != nil {
+				response = map[string]interface{}{"content": msg.Content}
+			}
+			name := msg.Name
+			if name == "" {
+				name = toolNames[msg.ToolCallID]
+			}
+			contents = append(contents, geminiContent{Role: "user", Parts: []geminiPart{
+				{FunctionResponse: &geminiFunctionResponse{Name: name, Response: response}},
+			}})
+		default:
+			contents = append(contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: msg.Content}}})
+		}
+	}
+
+	generationConfig := map[string]interface{}{"temperature": request.Temperature}
+	if request.MaxTokens > 0 {
+		generationConfig["maxOutputTokens"] = request.MaxTokens
+	}
+	if len(request.Stop) > 0 {
+		generationConfig["stopSequences"] = request.Stop
+	}
+	for key, value := range request.Options {
+		switch {
+		case clientOptions[key]:
+		case key == "response_format":
+			// JSON mode
+			if format, ok := value.(map[string]interface{}); ok && format["type"] != "text" {
+				generationConfig["responseMimeType"] = "application/json"
+				if schema, ok := format["json_schema"].(map[string]interface{}); ok && schema["schema"] != nil {
+					generationConfig["responseSchema"] = schema["schema"]
+				}
+			}
+		default:
+			generationConfig[key] = value
+		}
+	}
+
+	body := map[string]interface{}{
+		"contents":         contents,
+		"generationConfig": generationConfig,
+	}
+	if len(system) > 0 {
+		body["systemInstruction"] = geminiContent{Parts: system}
+	}
+
+	var declarations []FunctionDefinition
+	for _, tool := range request.Tools {
+		declarations = append(declarations, tool.Function)
+	}
+	declarations = append(declarations, request.Functions...)
+	if len(declarations) > 0 {
+		body["tools"] = []interface{}{map[string]interface{}{"functionDeclarations": declarations}}
+	}
+	return body
+}
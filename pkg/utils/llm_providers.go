@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Built-in providers. Ollama and llama.cpp serve the OpenAI chat completions
+// API locally; Azure serves it per deployment.
+const (
+	Ollama   LLMProvider = "ollama"
+	LlamaCPP LLMProvider = "llamacpp"
+	Azure    LLMProvider = "azure"
+	Gemini   LLMProvider = "gemini"
+	Bedrock  LLMProvider = "bedrock"
+)
+
+func init() {
+	RegisterLLMProvider(OpenAI, func(config LLMProviderConfig) (LLMBackend, error) {
+		if err := requireAPIKey(OpenAI, config); err != nil {
+			return nil, err
+		}
+		endpoint := newLLMEndpoint(config, "https://api.openai.com/v1")
+		return &chatBackend{
+			llmEndpoint:   endpoint,
+			capabilities:  LLMCapabilities{Tools: true, JSONMode: true, Vision: true, Streaming: true, Embeddings: true},
+			url:           func(LLMRequest) string { return endpoint.baseURL + "/chat/completions" },
+			embeddingsURL: func(EmbeddingRequest) string { return endpoint.baseURL + "/embeddings" },
+			headers:       bearerAuth(config.APIKey),
+			usageInStream: true,
+		}, nil
+	})
+
+	RegisterLLMProvider(Anthropic, func(config LLMProviderConfig) (LLMBackend, error) {
+		if err := requireAPIKey(Anthropic, config); err != nil {
+			return nil, err
+		}
+		return &anthropicBackend{newLLMEndpoint(config, "https://api.anthropic.com/v1")}, nil
+	})
+
+	RegisterLLMProvider(Generic, func(config LLMProviderConfig) (LLMBackend, error) {
+		if _, err := requireBaseURL(Generic, config); err != nil {
+			return nil, err
+		}
+		return &genericBackend{newLLMEndpoint(config, "")}, nil
+	})
+
+	RegisterLLMProvider(Ollama, localChatProvider("http://localhost:11434/v1", true))
+	RegisterLLMProvider(LlamaCPP, localChatProvider("http://localhost:8080/v1", false))
+
+	RegisterLLMProvider(Azure, func(config LLMProviderConfig) (LLMBackend, error) {
+		baseURL, err := requireBaseURL(Azure, config)
+		if err != nil {
+			return nil, err
+		}
+		if err := requireAPIKey(Azure, config); err != nil {
+			return nil, err
+		}
+		apiVersion := config.option("api_version", "2024-10-21")
+		deployment := config.option("deployment", "")
+		deploymentURL := func(model, operation string) string {
+			// Deployments are addressed by name, defaulting to the model
+			name := deployment
+			if name == "" {
+				name = model
+			}
+			return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+				baseURL, url.PathEscape(name), operation, url.QueryEscape(apiVersion))
+		}
+		return &chatBackend{
+			llmEndpoint:  newLLMEndpoint(config, baseURL),
+			capabilities: LLMCapabilities{Tools: true, JSONMode: true, Vision: true, Streaming: true, Embeddings: true},
+			url: func(request LLMRequest) string {
+				return deploymentURL(request.Model, "chat/completions")
+			},
+			embeddingsURL: func(request EmbeddingRequest) string {
+				// Embedding models have their own deployments
+				return deploymentURL(request.Model, "embeddings")
+			},
+			headers:       map[string]string{"api-key": config.APIKey},
+			usageInStream: true,
+		}, nil
+	})
+
+	RegisterLLMProvider(Gemini, func(config LLMProviderConfig) (LLMBackend, error) {
+		if err := requireAPIKey(Gemini, config); err != nil {
+			return nil, err
+		}
+		return &geminiBackend{newLLMEndpoint(config, "https://generativelanguage.googleapis.com/v1beta")}, nil
+	})
+
+	RegisterLLMProvider(Bedrock, newBedrockBackend)
+}
+
+// newLLMEndpoint returns the connection settings for a provider, using
+// defaultBaseURL unless the configuration names another
+func newLLMEndpoint(config LLMProviderConfig, defaultBaseURL string) *llmEndpoint {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &llmEndpoint{
+		httpClient:   NewHTTPClient(),
+		streamClient: &http.Client{},
+		apiKey:       config.APIKey,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		options:      config.Options,
+	}
+}
+
+// bearerAuth returns the headers authenticating with an API key as bearer token
+func bearerAuth(apiKey string) map[string]string {
+	return map[string]string{"Authorization": fmt.Sprintf("Bearer %s", apiKey)}
+}
+
+// localChatProvider returns a factory for a locally served OpenAI compatible
+// API. Local servers usually run without authentication.
+func localChatProvider(defaultBaseURL string, vision bool) LLMProviderFactory {
+	return func(config LLMProviderConfig) (LLMBackend, error) {
+		endpoint := newLLMEndpoint(config, defaultBaseURL)
+		headers := map[string]string{}
+		if config.APIKey != "" {
+			headers = bearerAuth(config.APIKey)
+		}
+		return &chatBackend{
+			llmEndpoint:   endpoint,
+			capabilities:  LLMCapabilities{Tools: true, JSONMode: true, Vision: vision, Streaming: true, Embeddings: true},
+			url:           func(LLMRequest) string { return endpoint.baseURL + "/chat/completions" },
+			embeddingsURL: func(EmbeddingRequest) string { return endpoint.baseURL + "/embeddings" },
+			headers:       headers,
+		}, nil
+	}
+}
+
+// chatBackend talks to an OpenAI compatible chat completions API
+type chatBackend struct {
+	*llmEndpoint
+	capabilities LLMCapabilities
+	url          func(request LLMRequest) string
+	headers      map[string]string
+
+	// embeddingsURL returns the URL of the embeddings API
+	embeddingsURL func(request EmbeddingRequest) string
+
+	// usageInStream asks for the token usage in the final stream chunk
+	usageInStream bool
+}
+
+func (b *chatBackend) Capabilities() LLMCapabilities { return b.capabilities }
+
+func (b *chatBackend) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	return b.completeChat(ctx, b.url(request), b.headers, request)
+}
+
+func (b *chatBackend) Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error) {
+	body := openAIRequestBody(request)
+	body["stream"] = true
+	if b.usageInStream {
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	return b.streamSSE(ctx, b.url(request), body, b.headers, parseOpenAIStreamEvent)
+}
+
+// anthropicBackend talks to the Anthropic messages and legacy completion APIs
+type anthropicBackend struct {
+	*llmEndpoint
+}
+
+func (b *anthropicBackend) Capabilities() LLMCapabilities {
+	return LLMCapabilities{Tools: true, Vision: true, Streaming: true}
+}
+
+func (b *anthropicBackend) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	// Claude 2 and Instant models only serve the legacy API
+	if strings.HasPrefix(request.Model, "claude-2") || strings.HasPrefix(request.Model, "claude-instant") {
+		return b.completeAnthropic(ctx, request)
+	}
+	return b.completeAnthropicMessages(ctx, request)
+}
+
+func (b *anthropicBackend) Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error) {
+	// Only the messages API streams; it serves every current model
+	body := anthropicMessagesRequestBody(request)
+	body["stream"] = true
+	headers := map[string]string{
+		"x-api-key":         b.apiKey,
+		"anthropic-version": "2023-06-01",
+	}
+	return b.streamSSE(ctx, b.baseURL+"/messages", body, headers, newAnthropicStreamParser())
+}
+
+// genericBackend posts requests as they are to a custom endpoint
+type genericBackend struct {
+	*llmEndpoint
+}
+
+func (b *genericBackend) Capabilities() LLMCapabilities {
+	return LLMCapabilities{Tools: true, JSONMode: true, Streaming: true, Embeddings: true}
+}
+
+func (b *genericBackend) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	return b.completeGeneric(ctx, request)
+}
+
+func (b *genericBackend) Stream(ctx context.Context, request LLMRequest) (<-chan LLMStreamChunk, error) {
+	body := openAIRequestBody(request)
+	body["stream"] = true
+	return b.streamSSE(ctx, b.baseURL+b.endpoint(), body, bearerAuth(b.apiKey), parseOpenAIStreamEvent)
+}
+
+// endpoint returns the path requests are posted to
+func (b *genericBackend) endpoint() string {
+	if endpoint, ok := b.options["endpoint"].(string); ok {
+		return endpoint
+	}
+	return "/v1/chat/completions"
+}
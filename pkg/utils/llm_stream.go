@@ -0,0 +1,378 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// LLMStreamChunk is an incremental piece of a streamed completion. The last
+// chunk sent before the channel closes carries Err if the stream failed.
+type LLMStreamChunk struct {
+	ID           string          `json:"id,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Delta        string          `json:"delta,omitempty"`
+	ToolCalls    []ToolCallDelta `json:"tool_calls,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Usage        *Usage          `json:"usage,omitempty"`
+	Err          error           `json:"-"`
+}
+
+// ToolCallDelta is a fragment of a streamed tool call. Fragments with the same
+// index belong to the same call; their arguments are concatenated.
+type ToolCallDelta struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// streamSSE posts a streaming request and parses the server-sent events of
+// the response with parse until it reports the end of the stream
+func (c *llmEndpoint) streamSSE(ctx context.Context, url string, body map[string]interface{}, headers map[string]string, parse func(event, data string) ([]LLMStreamChunk, bool, error)) (<-chan LLMStreamChunk, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	for key, value := range headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	// Streams are bounded by ctx rather than a client timeout
+	resp, err := c.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("LLM stream request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, newLLMAPIError("LLM", resp.StatusCode, resp.Header, raw)
+	}
+
+	chunks := make(chan LLMStreamChunk, 16)
+	go func() {
+		defer close(chunks)
+		defer resp.Body.Close()
+
+		send := func(chunk LLMStreamChunk) bool {
+			select {
+			case chunks <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		err := readSSE(resp.Body, func(event, data string) (bool, error) {
+			parsed, done, err := parse(event, data)
+			if err != nil {
+				return false, err
+			}
+			for _, chunk := range parsed {
+				if !send(chunk) {
+					return false, ctx.Err()
+				}
+			}
+			return done, nil
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			send(LLMStreamChunk{Err: err})
+		}
+	}()
+	return chunks, nil
+}
+
+// responseAsStream delivers a complete response as a single chunk
+func responseAsStream(resp *LLMResponse) <-chan LLMStreamChunk {
+	chunk := LLMStreamChunk{ID: resp.ID, Model: resp.Model, Usage: &resp.Usage}
+	if len(resp.Choices) > 0 {
+		chunk.Delta = resp.Choices[0].Message.Content
+		chunk.FinishReason = resp.Choices[0].FinishReason
+		for i, call := range resp.Choices[0].Message.ToolCalls {
+			chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+				Index:     i,
+				ID:        call.ID,
+				Type:      call.Type,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			})
+		}
+	}
+
+	chunks := make(chan LLMStreamChunk, 1)
+	chunks <- chunk
+	close(chunks)
+	return chunks
+}
+
+// CollectStream drains a stream into a response equivalent to Complete.
+// onDelta, if set, is called with each text delta as it arrives.
+func CollectStream(chunks <-chan LLMStreamChunk, onDelta func(delta string)) (*LLMResponse, error) {
+	var (
+		content   strings.Builder
+		toolCalls = make(map[int]*ToolCall)
+		response  = &LLMResponse{Object: "chat.completion"}
+		finish    string
+	)
+
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			return nil, chunk.Err
+		}
+		if chunk.ID != "" {
+			response.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.Delta != "" {
+			content.WriteString(chunk.Delta)
+			if onDelta != nil {
+				onDelta(chunk.Delta)
+			}
+		}
+		for _, delta := range chunk.ToolCalls {
+			call, ok := toolCalls[delta.Index]
+			if !ok {
+				call = &ToolCall{Type: "function"}
+				toolCalls[delta.Index] = call
+			}
+			if delta.ID != "" {
+				call.ID = delta.ID
+			}
+			if delta.Type != "" {
+				call.Type = delta.Type
+			}
+			if delta.Name != "" {
+				call.Function.Name = delta.Name
+			}
+			call.Function.Arguments += delta.Arguments
+		}
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+	}
+
+	message := Message{Role: "assistant", Content: content.String()}
+	indexes := make([]int, 0, len(toolCalls))
+	for index := range toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		message.ToolCalls = append(message.ToolCalls, *toolCalls[index])
+	}
+
+	response.Choices = []Choice{{Index: 0, Message: message, FinishReason: finish}}
+	return response, nil
+}
+
+// readSSE calls fn for every server-sent event in r until fn reports that
+// the stream is done. A stream that ends before is truncated, and fails
+// with io.ErrUnexpectedEOF so that it is retried like a dropped connection.
+func readSSE(r io.Reader, fn func(event, data string) (bool, error)) error {
+	reader := bufio.NewReader(r)
+	var event string
+	var data []string
+
+	dispatch := func() (bool, error) {
+		if len(data) == 0 {
+			event = ""
+			return false, nil
+		}
+		done, err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return done, err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "" && err == nil:
+			if done, err := dispatch(); done || err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment, used by servers as keep-alive
+		case line != "":
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+
+		if err == io.EOF {
+			done, err := dispatch()
+			if err == nil && !done {
+				err = fmt.Errorf("stream ended before the end of the response: %w", io.ErrUnexpectedEOF)
+			}
+			return err
+		}
+	}
+}
+
+// parseOpenAIStreamEvent parses a chat.completion.chunk event
+func parseOpenAIStreamEvent(event, data string) ([]LLMStreamChunk, bool, error) {
+	if strings.TrimSpace(data) == "[DONE]" {
+		return nil, true, nil
+	}
+
+	var payload struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Delta struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *Usage     `json:"usage"`
+		Error *ErrorInfo `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return nil, false, fmt.Errorf("failed to parse stream chunk: %w", err)
+	}
+	if payload.Error != nil {
+		return nil, false, &LLMAPIError{Provider: "LLM", Message: payload.Error.Message, Type: payload.Error.Type, Code: payload.Error.Code}
+	}
+
+	chunk := LLMStreamChunk{ID: payload.ID, Model: payload.Model, Usage: payload.Usage}
+	for _, choice := range payload.Choices {
+		chunk.Delta += choice.Delta.Content
+		for _, call := range choice.Delta.ToolCalls {
+			chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+				Index:     call.Index,
+				ID:        call.ID,
+				Type:      call.Type,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			})
+		}
+		if choice.FinishReason != nil {
+			chunk.FinishReason = *choice.FinishReason
+		}
+	}
+	return []LLMStreamChunk{chunk}, false, nil
+}
+
+// newAnthropicStreamParser returns a parser for the events of a messages API
+// stream. Input token counts arrive in message_start and output counts in
+// message_delta, so the parser keeps them between events.
+func newAnthropicStreamParser() func(event, data string) ([]LLMStreamChunk, bool, error) {
+	var usage Usage
+	toolIndexes := make(map[int]int)
+
+	return func(event, data string) ([]LLMStreamChunk, bool, error) {
+		var payload struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				ID    string `json:"id"`
+				Model string `json:"model"`
+				Usage struct {
+					InputTokens  int `json:"input_tokens"`
+					OutputTokens int `json:"output_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			return nil, false, fmt.Errorf("failed to parse stream event: %w", err)
+		}
+		if payload.Type == "" {
+			payload.Type = event
+		}
+
+		switch payload.Type {
+		case "message_start":
+			usage.PromptTokens = payload.Message.Usage.InputTokens
+			usage.CompletionTokens = payload.Message.Usage.OutputTokens
+			return []LLMStreamChunk{{ID: payload.Message.ID, Model: payload.Message.Model}}, false, nil
+		case "content_block_start":
+			if payload.ContentBlock.Type == "tool_use" {
+				index := len(toolIndexes)
+				toolIndexes[payload.Index] = index
+				return []LLMStreamChunk{{ToolCalls: []ToolCallDelta{{
+					Index: index,
+					ID:    payload.ContentBlock.ID,
+					Type:  "function",
+					Name:  payload.ContentBlock.Name,
+				}}}}, false, nil
+			}
+		case "content_block_delta":
+			switch payload.Delta.Type {
+			case "text_delta":
+				return []LLMStreamChunk{{Delta: payload.Delta.Text}}, false, nil
+			case "input_json_delta":
+				return []LLMStreamChunk{{ToolCalls: []ToolCallDelta{{
+					Index:     toolIndexes[payload.Index],
+					Arguments: payload.Delta.PartialJSON,
+				}}}}, false, nil
+			}
+		case "message_delta":
+			usage.CompletionTokens = payload.Usage.OutputTokens
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			final := usage
+			return []LLMStreamChunk{{FinishReason: payload.Delta.StopReason, Usage: &final}}, false, nil
+		case "message_stop":
+			return nil, true, nil
+		case "error":
+			return nil, false, &LLMAPIError{Provider: "Anthropic", Message: payload.Error.Message, Type: payload.Error.Type}
+		}
+		return nil, false, nil
+	}
+}